@@ -0,0 +1,101 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.sia.tech/core/types"
+)
+
+const (
+	AlertSeverityInfo     = "info"
+	AlertSeverityWarning  = "warning"
+	AlertSeverityCritical = "critical"
+
+	// AlertEventRaised and AlertEventResolved are the types of the events
+	// that are pushed to the alerts webhook. AlertEventNotified is pushed
+	// for one-off events, e.g. wallet deposits, that never become active.
+	AlertEventRaised   = "raised"
+	AlertEventResolved = "resolved"
+	AlertEventNotified = "notified"
+)
+
+type (
+	// An Alert describes a condition that requires the operator's attention.
+	Alert struct {
+		// ID identifies the condition, there's at most one active alert per
+		// ID.
+		ID       string    `json:"id"`
+		Severity string    `json:"severity"`
+		Message  string    `json:"message"`
+		Raised   time.Time `json:"raised"`
+	}
+
+	// An AlertEvent is pushed to the alerts webhook when an alert is raised
+	// or resolved.
+	AlertEvent struct {
+		Event string `json:"event"`
+		Alert Alert  `json:"alert"`
+	}
+
+	// AlertSettings contain the thresholds that are watched by the bus, a
+	// zero threshold disables the corresponding alert.
+	AlertSettings struct {
+		// MinWalletBalance raises an alert if the wallet balance drops below
+		// it.
+		MinWalletBalance types.Currency `json:"minWalletBalance"`
+
+		// MinWalletNeedRatio raises an alert if the wallet balance drops
+		// below this fraction of the funds that are needed to renew the
+		// contracts in the contract set.
+		MinWalletNeedRatio float64 `json:"minWalletNeedRatio"`
+
+		// MinContracts raises an alert if the contract set contains fewer
+		// contracts.
+		MinContracts uint64 `json:"minContracts"`
+
+		// MinContractFundsRatio raises an alert for every contract in the
+		// contract set whose remaining funds drop below this fraction of its
+		// total cost.
+		MinContractFundsRatio float64 `json:"minContractFundsRatio"`
+
+		// MinSlabHealth raises an alert if any slab's health drops below it.
+		MinSlabHealth float64 `json:"minSlabHealth"`
+
+		// MaxHostChurn raises an alert if more hosts than this were lost
+		// today.
+		MaxHostChurn uint64 `json:"maxHostChurn"`
+
+		// WebhookURL is the URL alert events are POSTed to, alerts aren't
+		// pushed if it's empty.
+		WebhookURL string `json:"webhookURL"`
+	}
+)
+
+// Validate returns an error if the alert is not considered valid.
+func (a Alert) Validate() error {
+	if a.ID == "" {
+		return errors.New("alert ID can't be empty")
+	}
+	switch a.Severity {
+	case AlertSeverityInfo, AlertSeverityWarning, AlertSeverityCritical:
+	default:
+		return fmt.Errorf("unknown severity '%v'", a.Severity)
+	}
+	return nil
+}
+
+// Validate returns an error if the alert settings are not considered valid.
+func (as AlertSettings) Validate() error {
+	if as.MinWalletNeedRatio < 0 {
+		return errors.New("MinWalletNeedRatio can't be negative")
+	}
+	if as.MinContractFundsRatio < 0 || as.MinContractFundsRatio > 1 {
+		return errors.New("MinContractFundsRatio must be between 0 and 1")
+	}
+	if as.MinSlabHealth < 0 || as.MinSlabHealth > 1 {
+		return errors.New("MinSlabHealth must be between 0 and 1")
+	}
+	return nil
+}
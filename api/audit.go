@@ -0,0 +1,26 @@
+package api
+
+import "time"
+
+type (
+	// An AuditEntry records a mutating API call.
+	AuditEntry struct {
+		Timestamp time.Time `json:"timestamp"`
+
+		// Module is the module that served the call, e.g. "bus" or "worker".
+		Module string `json:"module"`
+		Method string `json:"method"`
+		Path   string `json:"path"`
+
+		// Identity identifies the caller, it's empty if the caller
+		// authenticated using the API password.
+		Identity string `json:"identity"`
+
+		// Params is a summary of the call's query parameters, the request body
+		// is never recorded.
+		Params string `json:"params"`
+
+		// Status is the HTTP status code of the response.
+		Status int `json:"status"`
+	}
+)
@@ -1,11 +1,30 @@
 package api
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"go.sia.tech/core/types"
 )
 
+const (
+	// HostProtocolRHP3 requires hosts to expose a SiaMux port to support
+	// RHP3.
+	HostProtocolRHP3 = "rhp3"
+
+	// HostProtocolAccounts requires hosts to support ephemeral accounts.
+	HostProtocolAccounts = "accounts"
+)
+
+const (
+	// maintenanceWindowLayout is the layout of a maintenance window's start
+	// and end.
+	maintenanceWindowLayout = "15:04"
+)
+
 const (
 	// blocksPerDay defines the amount of blocks that are mined in a day (one
 	// block every 10 minutes roughly)
@@ -22,21 +41,102 @@ type (
 
 	// AutopilotConfig contains all autopilot configuration parameters.
 	AutopilotConfig struct {
-		Wallet    WalletConfig    `json:"wallet"`
-		Hosts     HostsConfig     `json:"hosts"`
-		Contracts ContractsConfig `json:"contracts"`
+		Wallet      WalletConfig      `json:"wallet"`
+		Hosts       HostsConfig       `json:"hosts"`
+		Contracts   ContractsConfig   `json:"contracts"`
+		Scanner     ScannerConfig     `json:"scanner"`
+		Maintenance MaintenanceConfig `json:"maintenance"`
 	}
 
-	// WalletConfig contains all wallet configuration parameters.
+	// WalletConfig contains all wallet configuration parameters. The wallet
+	// is defragmented when it holds more than DefragThreshold spendable
+	// outputs, its smallest outputs are then consolidated until
+	// DefragTargetOutputs are left. Outputs smaller than
+	// DefragMinOutputSize are always consolidated. Defragmentation runs at
+	// most once every DefragIntervalHours and is skipped if the fee exceeds
+	// DefragMaxFee, a zero fee disables the ceiling.
 	WalletConfig struct {
-		DefragThreshold uint64 `json:"defragThreshold"`
+		DefragThreshold     uint64         `json:"defragThreshold"`
+		DefragTargetOutputs uint64         `json:"defragTargetOutputs"`
+		DefragMinOutputSize types.Currency `json:"defragMinOutputSize"`
+		DefragIntervalHours uint64         `json:"defragIntervalHours"`
+		DefragMaxFee        types.Currency `json:"defragMaxFee"`
 	}
 
-	// HostsConfig contains all hosts configuration parameters.
+	// WalletDefragRun describes a run of the wallet defragmentation.
+	WalletDefragRun struct {
+		Time          time.Time           `json:"time"`
+		OutputsBefore int                 `json:"outputsBefore"`
+		OutputsAfter  int                 `json:"outputsAfter"`
+		Consolidated  types.Currency      `json:"consolidated"`
+		Fee           types.Currency      `json:"fee"`
+		TransactionID types.TransactionID `json:"transactionID"`
+		Error         string              `json:"error,omitempty"`
+	}
+
+	// HostsConfig contains all hosts configuration parameters. Hosts running
+	// a version lower than MinVersion or lacking any of the
+	// RequiredProtocols score zero and aren't considered for contract
+	// formation. VersionPenalties are applied to the score of hosts below
+	// the penalty's version, the default penalties are used if it's nil.
+	//
+	// Hosts we have a contract with may exceed the gouging limits by
+	// GougingLeewayPct percent, if they exceed them by more their contract
+	// is kept, but not used, for GougingGraceHours before it's dropped.
+	//
+	// MaxContractsPerGroup limits the number of contracts with hosts that
+	// are suspected to be run by the same operator, zero means no limit.
 	HostsConfig struct {
 		IgnoreRedundantIPs bool                        `json:"ignoreRedundantIPs"`
 		MaxDowntimeHours   uint64                      `json:"maxDowntimeHours"`
 		ScoreOverrides     map[types.PublicKey]float64 `json:"scoreOverrides"`
+		MinVersion         string                      `json:"minVersion"`
+		RequiredProtocols  []string                    `json:"requiredProtocols"`
+		VersionPenalties   []VersionPenalty            `json:"versionPenalties"`
+		GougingLeewayPct   uint64                      `json:"gougingLeewayPct"`
+		GougingGraceHours  uint64                      `json:"gougingGraceHours"`
+
+		MaxContractsPerGroup uint64 `json:"maxContractsPerGroup"`
+
+		// ExternalScoreWeight is the exponent the score an external
+		// host-data provider reported for a host is raised to before it's
+		// factored into the host's score, zero ignores external scores.
+		ExternalScoreWeight float64 `json:"externalScoreWeight"`
+	}
+
+	// A VersionPenalty multiplies the score of hosts running a version lower
+	// than Version by Penalty.
+	VersionPenalty struct {
+		Version string  `json:"version"`
+		Penalty float64 `json:"penalty"`
+	}
+
+	// ScannerConfig contains all scanner configuration parameters. Threads is
+	// the number of hosts that are scanned in parallel. Hosts in the
+	// contract set are rescanned at most once every ContractHostInterval,
+	// all other hosts at most once every HostInterval. A zero value falls
+	// back to the autopilot's default, a zero Timeout derives the scan
+	// timeout from the durations of previous scans.
+	ScannerConfig struct {
+		Threads              uint64        `json:"threads"`
+		ContractHostInterval time.Duration `json:"contractHostInterval"`
+		HostInterval         time.Duration `json:"hostInterval"`
+		Timeout              time.Duration `json:"timeout"`
+	}
+
+	// MaintenanceConfig restricts bandwidth-heavy maintenance, i.e.
+	// migrations, pruning and wallet defragmentation, to the given daily
+	// windows. Maintenance is allowed at any time if there are no windows.
+	MaintenanceConfig struct {
+		Windows []MaintenanceWindow `json:"windows"`
+	}
+
+	// A MaintenanceWindow is a daily time window in UTC, Start and End are
+	// formatted as "15:04". A window that ends before it starts wraps around
+	// midnight.
+	MaintenanceWindow struct {
+		Start string `json:"start"`
+		End   string `json:"end"`
 	}
 
 	// ContractsConfig contains all contracts configuration parameters.
@@ -54,13 +154,72 @@ type (
 	// AutopilotStatusResponseGET is the response type for the /autopilot/status
 	// endpoint.
 	AutopilotStatusResponseGET struct {
-		CurrentPeriod uint64 `json:"currentPeriod"`
+		AutopilotState
+
+		// CommittedFunds are the funds committed to contracts in the current
+		// period, RemainingAllowance is what's left of the allowance.
+		CommittedFunds     types.Currency `json:"committedFunds"`
+		RemainingAllowance types.Currency `json:"remainingAllowance"`
+
+		Scanner ScannerStatus `json:"scanner"`
+	}
+
+	// A CandidateHost is a host the autopilot would consider forming a
+	// contract with, along with its score and prices.
+	CandidateHost struct {
+		HostKey    types.PublicKey `json:"hostKey"`
+		NetAddress string          `json:"netAddress"`
+		Score      float64         `json:"score"`
+
+		ContractPrice          types.Currency `json:"contractPrice"`
+		StoragePrice           types.Currency `json:"storagePrice"`
+		UploadBandwidthPrice   types.Currency `json:"uploadBandwidthPrice"`
+		DownloadBandwidthPrice types.Currency `json:"downloadBandwidthPrice"`
+		Collateral             types.Currency `json:"collateral"`
+	}
+
+	// AutopilotState is the state the autopilot persists in the bus so it can
+	// resume where it left off after a restart.
+	AutopilotState struct {
+		CurrentPeriod   uint64          `json:"currentPeriod"`
+		LastMaintenance time.Time       `json:"lastMaintenance"`
+		LastScan        time.Time       `json:"lastScan"`
+		LastMigration   time.Time       `json:"lastMigration"`
+		MigrationCursor MigrationCursor `json:"migrationCursor"`
+	}
+
+	// MigrationCursor is the position of the migrator in the repair queue.
+	// The queue is migrated in order of descending priority and ascending
+	// slab ID, a migration pass that was interrupted resumes after the last
+	// slab that was migrated. Started is zero if no pass is in progress,
+	// JobID is the migration job that tracks the pass.
+	MigrationCursor struct {
+		Started  time.Time `json:"started"`
+		Priority float64   `json:"priority"`
+		SlabID   SlabID    `json:"slabID"`
+		Migrated uint64    `json:"migrated"`
+		Failed   uint64    `json:"failed"`
+		JobID    uint      `json:"jobID"`
+	}
+
+	// ScannerStatus describes the progress of the current, or last, host
+	// scan cycle. Remaining are the hosts that were queued for scanning but
+	// weren't scanned yet.
+	ScannerStatus struct {
+		Scanning  bool          `json:"scanning"`
+		LastStart time.Time     `json:"lastStart"`
+		Scanned   uint64        `json:"scanned"`
+		Remaining uint64        `json:"remaining"`
+		Timeout   time.Duration `json:"timeout"`
 	}
 )
 
 // DefaultAutopilotConfig returns a configuration with sane default values.
 func DefaultAutopilotConfig() (c AutopilotConfig) {
 	c.Wallet.DefragThreshold = 1000
+	c.Wallet.DefragTargetOutputs = 100
+	c.Wallet.DefragIntervalHours = 24
+	c.Wallet.DefragMaxFee = types.Siacoins(1)
 	c.Hosts.MaxDowntimeHours = 24 * 7 * 2 // 2 weeks
 	c.Hosts.ScoreOverrides = make(map[types.PublicKey]float64)
 	c.Contracts.Set = "autopilot"
@@ -73,3 +232,91 @@ func DefaultAutopilotConfig() (c AutopilotConfig) {
 	c.Contracts.Storage = 1 << 42                  // 4 TiB
 	return
 }
+
+// DefaultVersionPenalties returns the score penalties applied to hosts
+// running outdated versions.
+func DefaultVersionPenalties() []VersionPenalty {
+	return []VersionPenalty{
+		{Version: "1.5.10", Penalty: 1.0},
+		{Version: "1.5.9", Penalty: 0.99},
+		{Version: "1.5.8", Penalty: 0.99},
+		{Version: "1.5.6", Penalty: 0.90},
+	}
+}
+
+// Validate returns an error if the autopilot config is not considered valid.
+func (c AutopilotConfig) Validate() error {
+	if c.Hosts.MinVersion != "" && !isVersion(c.Hosts.MinVersion) {
+		return fmt.Errorf("invalid MinVersion '%v'", c.Hosts.MinVersion)
+	}
+	for _, p := range c.Hosts.RequiredProtocols {
+		if p != HostProtocolRHP3 && p != HostProtocolAccounts {
+			return fmt.Errorf("unknown protocol '%v'", p)
+		}
+	}
+	for _, w := range c.Maintenance.Windows {
+		if _, err := time.Parse(maintenanceWindowLayout, w.Start); err != nil {
+			return fmt.Errorf("invalid maintenance window start '%v', expected format HH:MM", w.Start)
+		} else if _, err := time.Parse(maintenanceWindowLayout, w.End); err != nil {
+			return fmt.Errorf("invalid maintenance window end '%v', expected format HH:MM", w.End)
+		}
+	}
+	if c.Scanner.ContractHostInterval < 0 || c.Scanner.HostInterval < 0 || c.Scanner.Timeout < 0 {
+		return errors.New("scanner intervals and timeout can't be negative")
+	}
+	if c.Hosts.ExternalScoreWeight < 0 {
+		return errors.New("external score weight can't be negative")
+	}
+	for _, vp := range c.Hosts.VersionPenalties {
+		if !isVersion(vp.Version) {
+			return fmt.Errorf("invalid penalty version '%v'", vp.Version)
+		} else if vp.Penalty < 0 || vp.Penalty > 1 {
+			return fmt.Errorf("penalty for version '%v' must be between 0 and 1", vp.Version)
+		}
+	}
+	return nil
+}
+
+// Allowed returns whether maintenance is allowed at the given time.
+func (mc MaintenanceConfig) Allowed(t time.Time) bool {
+	if len(mc.Windows) == 0 {
+		return true
+	}
+	for _, w := range mc.Windows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains returns whether the given time falls within the window, invalid
+// windows never contain any time.
+func (w MaintenanceWindow) Contains(t time.Time) bool {
+	start, err1 := time.Parse(maintenanceWindowLayout, w.Start)
+	end, err2 := time.Parse(maintenanceWindowLayout, w.End)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+
+	t = t.UTC()
+	since := func(d time.Time) time.Duration {
+		return time.Duration(d.Hour())*time.Hour + time.Duration(d.Minute())*time.Minute
+	}
+	now := since(t) + time.Duration(t.Second())*time.Second
+	if since(start) <= since(end) {
+		return now >= since(start) && now < since(end)
+	}
+	return now >= since(start) || now < since(end)
+}
+
+// isVersion returns whether v is a version string made up of dot-separated
+// numbers, e.g. "1.5.10".
+func isVersion(v string) bool {
+	for _, n := range strings.Split(v, ".") {
+		if _, err := strconv.ParseUint(n, 10, 64); err != nil {
+			return false
+		}
+	}
+	return true
+}
@@ -2,7 +2,10 @@ package api
 
 import (
 	"errors"
+	"fmt"
 	"math/big"
+	"strings"
+	"time"
 
 	rhpv2 "go.sia.tech/core/rhp/v2"
 	"go.sia.tech/core/types"
@@ -10,10 +13,50 @@ import (
 )
 
 var (
+	// ErrConsensusChangeNotFound is returned if the consensus changes following
+	// an unknown consensus change are requested.
+	ErrConsensusChangeNotFound = errors.New("consensus change not found")
+
 	// ErrSettingNotFound is returned if a requested setting is not present in the
 	// database.
 	ErrSettingNotFound = errors.New("setting not found")
 
+	// ErrContractSetNotFound is returned if a contract set doesn't exist.
+	ErrContractSetNotFound = errors.New("couldn't find contract set")
+
+	// ErrSettingUpdateNotFound is returned if a setting is rolled back to an
+	// update that isn't in its history.
+	ErrSettingUpdateNotFound = errors.New("setting update not found")
+
+	// ErrInsufficientContracts is returned if the redundancy settings are
+	// updated to more shards than there are contracts in the contract set.
+	ErrInsufficientContracts = errors.New("not enough contracts for the redundancy settings")
+
+	// ErrContractExists is returned if a contract is recovered that is
+	// already known.
+	ErrContractExists = errors.New("contract already exists")
+
+	// ErrContractRootsUnknown is returned if the roots of a contract are
+	// requested that was found on the blockchain and whose roots haven't been
+	// restored from its host yet.
+	ErrContractRootsUnknown = errors.New("contract roots are unknown")
+
+	// ErrObjectExists is returned if an object can't be restored from the
+	// trash because another object was stored under its key.
+	ErrObjectExists = errors.New("object already exists")
+
+	// ErrPreconditionFailed is returned if an object is updated or deleted
+	// conditionally and its ETag doesn't match.
+	ErrPreconditionFailed = errors.New("precondition failed")
+
+	// ErrSlabNotQueued is returned if a slab's migration is retried while it
+	// isn't in the repair queue.
+	ErrSlabNotQueued = errors.New("slab is not in the repair queue")
+
+	// ErrTrashedObjectNotFound is returned if a requested object is not in the
+	// trash.
+	ErrTrashedObjectNotFound = errors.New("trashed object not found")
+
 	// DefaultRedundancySettings define the default redundancy settings the bus
 	// is configured with on startup. These values can be adjusted using the
 	// settings API.
@@ -42,6 +85,38 @@ type ConsensusState struct {
 	Synced      bool
 }
 
+// ConsensusChanges is the response type for the /consensus/changes endpoint.
+// The changes are encoded by the bus' consensus set and are consumed by buses
+// that follow the chain through another bus rather than running their own
+// consensus set.
+type ConsensusChanges struct {
+	Changes [][]byte `json:"changes"`
+
+	// More is set if there are more changes following the returned ones.
+	More bool `json:"more"`
+}
+
+// ConsensusProcessingStats describes how far the processing of consensus
+// changes by the bus' store is behind the tip of the chain and how long it
+// takes to persist the host announcements found in them.
+type ConsensusProcessingStats struct {
+	TipHeight       uint64    `json:"tipHeight"`
+	ProcessedHeight uint64    `json:"processedHeight"`
+	BlocksBehind    uint64    `json:"blocksBehind"`
+	LastProcessed   time.Time `json:"lastProcessed"`
+
+	// PendingAnnouncements is the number of announcements that were
+	// processed but not persisted yet.
+	PendingAnnouncements int `json:"pendingAnnouncements"`
+
+	AnnouncementBatches       uint64        `json:"announcementBatches"`
+	FailedAnnouncementBatches uint64        `json:"failedAnnouncementBatches"`
+	LastBatchSize             int           `json:"lastBatchSize"`
+	LastBatchDuration         time.Duration `json:"lastBatchDuration"`
+	MaxBatchDuration          time.Duration `json:"maxBatchDuration"`
+	AvgBatchDuration          time.Duration `json:"avgBatchDuration"`
+}
+
 // ContractsIDAddRequest is the request type for the /contract/:id endpoint.
 type ContractsIDAddRequest struct {
 	Contract    rhpv2.ContractRevision `json:"contract"`
@@ -77,16 +152,121 @@ type ContractAcquireResponse struct {
 	LockID uint64 `json:"lockID"`
 }
 
+// ContractKeepaliveRequest is the request type for the /contract/:id/keepalive
+// endpoint. It extends the lease of a lock by Duration.
+type ContractKeepaliveRequest struct {
+	LockID   uint64        `json:"lockID"`
+	Duration ParamDuration `json:"duration"`
+}
+
+// ContractLockStats describes the contention on a contract's lock.
+type ContractLockStats struct {
+	ContractID types.FileContractID `json:"contractID"`
+	Held       bool                 `json:"held"`
+	Queued     int                  `json:"queued"`
+
+	// ContendedAcquisitions is the number of acquisitions that had to wait
+	// for another holder, WaitTime is the total time they waited.
+	Acquisitions          uint64        `json:"acquisitions"`
+	ContendedAcquisitions uint64        `json:"contendedAcquisitions"`
+	WaitTime              ParamDuration `json:"waitTime"`
+
+	// Timeouts is the number of acquisitions that gave up waiting,
+	// Expirations is the number of leases that expired because their holder
+	// neither released nor kept them alive.
+	Timeouts     uint64    `json:"timeouts"`
+	Expirations  uint64    `json:"expirations"`
+	LastAcquired time.Time `json:"lastAcquired"`
+}
+
 // HostsRemoveRequest is the request type for the /hosts/remove endpoint.
 type HostsRemoveRequest struct {
 	MinRecentScanFailures uint64            `json:"minRecentScanFailures"`
 	MaxDowntimeHours      ParamDurationHour `json:"maxDowntimeHours"`
 }
 
+// NetworkStats is the response type for the /network/stats endpoint. It
+// summarizes the hosts in the hostdb, active hosts are online hosts that
+// accept contracts. The prices and storage only consider active hosts.
+type NetworkStats struct {
+	Hosts            uint64            `json:"hosts"`
+	ActiveHosts      uint64            `json:"activeHosts"`
+	TotalStorage     uint64            `json:"totalStorage"`
+	RemainingStorage uint64            `json:"remainingStorage"`
+	MedianPrices     HostPrices        `json:"medianPrices"`
+	Versions         map[string]uint64 `json:"versions"`
+
+	ContractSet ContractSetStats `json:"contractSet"`
+}
+
+// ContractSetStats compares the hosts of a contract set to the network.
+// Percentiles are the share of active hosts that are cheaper than the median
+// host of the set.
+type ContractSetStats struct {
+	Name         string     `json:"name"`
+	Contracts    uint64     `json:"contracts"`
+	MedianPrices HostPrices `json:"medianPrices"`
+
+	StoragePricePercentile  float64 `json:"storagePricePercentile"`
+	UploadPricePercentile   float64 `json:"uploadPricePercentile"`
+	DownloadPricePercentile float64 `json:"downloadPricePercentile"`
+}
+
+// HostPrices contains the prices hosts advertise in their settings, the
+// storage price is per byte per block and the bandwidth prices are per byte.
+type HostPrices struct {
+	ContractPrice types.Currency `json:"contractPrice"`
+	StoragePrice  types.Currency `json:"storagePrice"`
+	Collateral    types.Currency `json:"collateral"`
+	UploadPrice   types.Currency `json:"uploadPrice"`
+	DownloadPrice types.Currency `json:"downloadPrice"`
+}
+
 // WalletFundRequest is the request type for the /wallet/fund endpoint.
 type WalletFundRequest struct {
 	Transaction types.Transaction `json:"transaction"`
 	Amount      types.Currency    `json:"amount"`
+
+	// Outputs pins the outputs used to fund the transaction, all of them are
+	// spent. If empty, the wallet picks the outputs itself.
+	Outputs []types.Hash256 `json:"outputs,omitempty"`
+}
+
+// UnsignedTransaction is a transaction funded by a watch-only wallet that has
+// to be signed externally. Once signed, it's broadcast together with the
+// transactions it depends on.
+type UnsignedTransaction struct {
+	ID            types.TransactionID `json:"id"`
+	Transaction   types.Transaction   `json:"transaction"`
+	ToSign        []types.Hash256     `json:"toSign"`
+	CoveredFields types.CoveredFields `json:"coveredFields"`
+	DependsOn     []types.Transaction `json:"dependsOn"`
+	Created       time.Time           `json:"created"`
+}
+
+// FeeEstimate is the response type for the /wallet/fee endpoint. FeePerByte
+// is the recommended fee, it's derived from the fee recommended by the
+// transaction pool and the median fee paid in recent blocks.
+type FeeEstimate struct {
+	FeePerByte       types.Currency `json:"feePerByte"`
+	PoolFeePerByte   types.Currency `json:"poolFeePerByte"`
+	BlocksFeePerByte types.Currency `json:"blocksFeePerByte"`
+}
+
+// A FeeMetric is a sample of the fee estimate the bus recorded at a point in
+// time, the samples form the series returned by the /metrics/fees endpoint.
+type FeeMetric struct {
+	Timestamp   time.Time `json:"timestamp"`
+	BlockHeight uint64    `json:"blockHeight"`
+	FeeEstimate
+}
+
+// WalletOutput is a spendable siacoin output controlled by the wallet.
+type WalletOutput struct {
+	ID            types.Hash256  `json:"id"`
+	Address       types.Address  `json:"address"`
+	Value         types.Currency `json:"value"`
+	Confirmations uint64         `json:"confirmations"`
 }
 
 // WalletFundResponse is the response type for the /wallet/fund endpoint.
@@ -144,14 +324,88 @@ type WalletPrepareRenewResponse struct {
 
 // ObjectsResponse is the response type for the /objects endpoint.
 type ObjectsResponse struct {
-	Entries []string       `json:"entries,omitempty"`
-	Object  *object.Object `json:"object,omitempty"`
+	Entries []ObjectMetadata `json:"entries,omitempty"`
+	Object  *object.Object   `json:"object,omitempty"`
+}
+
+// ObjectMetadata describes an entry of an object listing, which is either an
+// object or a directory. The metadata of a directory is aggregated over all
+// objects beneath it, its name ends in a slash.
+type ObjectMetadata struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	Slabs   int       `json:"slabs"`
+
+	// Health is the health of the entry's least healthy slab, it's 1 if the
+	// entry has no slabs.
+	Health float64 `json:"health"`
 }
 
 // AddObjectRequest is the request type for the /object/*key endpoint.
 type AddObjectRequest struct {
 	Object        object.Object                            `json:"object"`
 	UsedContracts map[types.PublicKey]types.FileContractID `json:"usedContracts"`
+
+	// Redundancy overrides the redundancy settings of the bus for this
+	// object, it's nil if the object was uploaded with the default
+	// redundancy.
+	Redundancy *RedundancySettings `json:"redundancy,omitempty"`
+}
+
+// ObjectsRenameRequest is the request type for the /objects/rename endpoint.
+// Both prefixes are directories, they start and end in a slash.
+type ObjectsRenameRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+const (
+	// RejectReasonNoContract is the reason a shard is rejected if no contract
+	// was provided for its host.
+	RejectReasonNoContract = "no contract was provided for the host"
+
+	// RejectReasonUnknownHost is the reason a shard is rejected if its host
+	// is unknown to the bus.
+	RejectReasonUnknownHost = "unknown host"
+
+	// RejectReasonUnknownContract is the reason a shard is rejected if the
+	// contract provided for its host is unknown to the bus.
+	RejectReasonUnknownContract = "unknown contract"
+
+	// RejectReasonArchivedContract is the reason a shard is rejected if the
+	// contract provided for its host was archived.
+	RejectReasonArchivedContract = "contract was archived"
+
+	// RejectReasonHostMismatch is the reason a shard is rejected if the
+	// contract provided for its host was formed with a different host.
+	RejectReasonHostMismatch = "contract belongs to a different host"
+)
+
+// RejectedShard is a shard of an object that couldn't be linked to a known
+// contract of its host.
+type RejectedShard struct {
+	Slab       int                  `json:"slab"`
+	Shard      int                  `json:"shard"`
+	Root       types.Hash256        `json:"root"`
+	HostKey    types.PublicKey      `json:"hostKey"`
+	ContractID types.FileContractID `json:"contractID"`
+	Reason     string               `json:"reason"`
+}
+
+// UsedContractsError is returned when an object is added with used contracts
+// that reference hosts or contracts the bus doesn't know.
+type UsedContractsError struct {
+	Rejected []RejectedShard `json:"rejected"`
+}
+
+// Error implements the error interface.
+func (e *UsedContractsError) Error() string {
+	reasons := make([]string, len(e.Rejected))
+	for i, rs := range e.Rejected {
+		reasons[i] = fmt.Sprintf("slab %d shard %d (host %v, contract %v): %v", rs.Slab, rs.Shard, rs.HostKey, rs.ContractID, rs.Reason)
+	}
+	return fmt.Sprintf("%d shards were rejected: %v", len(e.Rejected), strings.Join(reasons, "; "))
 }
 
 // MigrationSlabsRequest is the request type for the /slabs/migration endpoint.
@@ -161,12 +415,145 @@ type MigrationSlabsRequest struct {
 	Limit        int     `json:"limit"`
 }
 
+// SlabHealth is the health of a slab with regard to a contract set. The health
+// is the fraction of the slab's redundancy that is left, it's negative if the
+// slab can't be recovered from the hosts in the set.
+type SlabHealth struct {
+	ID          SlabID               `json:"id"`
+	Key         object.EncryptionKey `json:"key"`
+	Health      float64              `json:"health"`
+	MinShards   uint8                `json:"minShards"`
+	TotalShards uint8                `json:"totalShards"`
+
+	// Hosts is the number of distinct hosts in the set that store a shard of
+	// the slab.
+	Hosts int `json:"hosts"`
+}
+
+// SlabHealthSummary summarizes the health of all slabs as periodically
+// computed by the bus.
+type SlabHealthSummary struct {
+	// Set is the contract set the health was computed for, it's empty if it
+	// wasn't computed since the bus was started.
+	Set string `json:"set"`
+
+	// Refreshed is the time the least recently computed health was computed,
+	// it's zero if the health of some slabs was never computed.
+	Refreshed time.Time `json:"refreshed"`
+
+	Slabs     uint64  `json:"slabs"`
+	Unhealthy uint64  `json:"unhealthy"`
+	MinHealth float64 `json:"minHealth"`
+
+	// UnhealthyWrapped is the number of unhealthy slabs of objects protected
+	// by a passphrase. They're included in Unhealthy but are never migrated
+	// since their keys can't be unwrapped without the passphrase.
+	UnhealthyWrapped uint64 `json:"unhealthyWrapped"`
+}
+
+// A RepairQueueEntry is a slab in the repair queue.
+type RepairQueueEntry struct {
+	SlabID      SlabID      `json:"slabID"`
+	Slab        object.Slab `json:"slab"`
+	Health      float64     `json:"health"`
+	Priority    float64     `json:"priority"`
+	Attempts    uint64      `json:"attempts"`
+	NextAttempt time.Time   `json:"nextAttempt"`
+	LastError   string      `json:"lastError,omitempty"`
+}
+
+// A RepairResult is the result of repairing a slab from the repair queue, the
+// slab is removed from the queue if the error is empty.
+type RepairResult struct {
+	SlabID SlabID `json:"slabID"`
+	Error  string `json:"error,omitempty"`
+}
+
+const (
+	SlabMigrationStatusPending    = "pending"
+	SlabMigrationStatusInProgress = "inProgress"
+	SlabMigrationStatusDone       = "done"
+	SlabMigrationStatusFailed     = "failed"
+)
+
+// A SlabMigration is the state of the latest migration of a slab.
+type SlabMigration struct {
+	SlabID    SlabID    `json:"slabID"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Attempts  uint64    `json:"attempts"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// A SlabMigrationUpdate updates the migration state of a slab, the error is
+// only set if the migration failed.
+type SlabMigrationUpdate struct {
+	SlabID SlabID `json:"slabID"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// RepairEnqueueRequest is the request type for the /slabs/repair/enqueue
+// endpoint.
+type RepairEnqueueRequest struct {
+	ContractSet  string  `json:"contractSet"`
+	HealthCutoff float64 `json:"healthCutoff"`
+}
+
+// A ContractObject is an object with slabs that have shards stored on a
+// contract.
+type ContractObject struct {
+	Key   string         `json:"key"`
+	Slabs []ContractSlab `json:"slabs"`
+}
+
+// A ContractSlab is a slab with shards stored on a contract.
+type ContractSlab struct {
+	ID  SlabID               `json:"id"`
+	Key object.EncryptionKey `json:"key"`
+
+	// Shards is the number of the slab's shards stored on the contract.
+	Shards int `json:"shards"`
+}
+
 // UpdateSlabRequest is the request type for the /slab endpoint.
 type UpdateSlabRequest struct {
 	Slab          object.Slab                              `json:"slab"`
 	UsedContracts map[types.PublicKey]types.FileContractID `json:"usedContracts"`
 }
 
+// A PackedSlab is the data of buffered partial slabs packed together into a
+// single slab, ready to be uploaded.
+type PackedSlab struct {
+	Partials    []PackedPartialSlab `json:"partials"`
+	MinShards   uint8               `json:"minShards"`
+	TotalShards uint8               `json:"totalShards"`
+	Data        []byte              `json:"data"`
+}
+
+// A PackedPartialSlab is the region of a packed slab that holds the data of a
+// partial slab.
+type PackedPartialSlab struct {
+	ID     uint   `json:"id"`
+	Offset uint32 `json:"offset"`
+	Length uint32 `json:"length"`
+}
+
+// PackedSlabsRequest is the request type for the /slabs/packed endpoint.
+type PackedSlabsRequest struct {
+	LockingDuration ParamDuration `json:"lockingDuration"`
+	MinShards       uint8         `json:"minShards"`
+	TotalShards     uint8         `json:"totalShards"`
+	Limit           int           `json:"limit"`
+}
+
+// UploadedPackedSlab is a packed slab that was uploaded to hosts.
+type UploadedPackedSlab struct {
+	Partials      []PackedPartialSlab                      `json:"partials"`
+	Slab          object.Slab                              `json:"slab"`
+	UsedContracts map[types.PublicKey]types.FileContractID `json:"usedContracts"`
+}
+
 // UpdateAllowlistRequest is the request type for /hosts/allowlist endpoint.
 type UpdateAllowlistRequest struct {
 	Add    []types.PublicKey `json:"add"`
@@ -206,6 +593,7 @@ type DownloadParams struct {
 type UploadParams struct {
 	CurrentHeight uint64
 	ContractSet   string
+	UploadPacking bool
 	GougingParams
 }
 
@@ -239,11 +627,71 @@ type GougingSettings struct {
 	// MaxStoragePrice is the maximum allowed price to store 1 byte per block
 	MaxStoragePrice types.Currency `json:"maxStoragePrice"`
 
+	// MaxStoragePricePerPeriod is the maximum allowed price to store 1TiB of
+	// data for the duration of Period, it's converted into a price per byte
+	// per block when checking hosts
+	MaxStoragePricePerPeriod types.Currency `json:"maxStoragePricePerPeriod"`
+
+	// MaxSectorAccessPrice is the maximum allowed price to download a single
+	// sector from a host, including the base cost of the RPC
+	MaxSectorAccessPrice types.Currency `json:"maxSectorAccessPrice"`
+
+	// MaxDownloadBandwidthPriceRHPv2 and MaxUploadBandwidthPriceRHPv2 are the
+	// maximum allowed prices per byte of bandwidth in a host's RHPv2 settings
+	MaxDownloadBandwidthPriceRHPv2 types.Currency `json:"maxDownloadBandwidthPriceRHPv2"`
+	MaxUploadBandwidthPriceRHPv2   types.Currency `json:"maxUploadBandwidthPriceRHPv2"`
+
+	// MaxDownloadBandwidthPriceRHPv3 and MaxUploadBandwidthPriceRHPv3 are the
+	// maximum allowed prices per byte of bandwidth in a host's RHPv3 price
+	// table
+	MaxDownloadBandwidthPriceRHPv3 types.Currency `json:"maxDownloadBandwidthPriceRHPv3"`
+	MaxUploadBandwidthPriceRHPv3   types.Currency `json:"maxUploadBandwidthPriceRHPv3"`
+
+	// MaxReadBaseCost is the maximum allowed base cost of reading a sector,
+	// the sector access price in RHPv2 and the read base cost in RHPv3
+	MaxReadBaseCost types.Currency `json:"maxReadBaseCost"`
+
+	// MaxWriteBaseCost is the maximum allowed base cost of writing a sector in
+	// RHPv3
+	MaxWriteBaseCost types.Currency `json:"maxWriteBaseCost"`
+
+	// Period is the number of blocks MaxStoragePricePerPeriod refers to,
+	// usually the period of the renter's contracts
+	Period uint64 `json:"period"`
+
 	// HostBlockHeightLeeway is the amount of blocks of leeway given to the host
 	// block height in the host's price table
 	HostBlockHeightLeeway int `json:"hostBlockHeightLeeway"`
 }
 
+// Validate returns an error if the gouging settings are not considered valid.
+func (gs GougingSettings) Validate() error {
+	if !gs.MaxStoragePricePerPeriod.IsZero() && gs.Period == 0 {
+		return errors.New("Period must be set if MaxStoragePricePerPeriod is set")
+	}
+	return nil
+}
+
+// StoragePriceLimit returns the maximum allowed price to store 1 byte per
+// block. It's the stricter of MaxStoragePrice and MaxStoragePricePerPeriod
+// converted using Period, a zero currency means storage prices aren't limited.
+func (gs GougingSettings) StoragePriceLimit() types.Currency {
+	limit := gs.MaxStoragePrice
+	if gs.MaxStoragePricePerPeriod.IsZero() || gs.Period == 0 {
+		return limit
+	}
+
+	// round up to 1H, a zero limit would disable the check
+	perPeriod := gs.MaxStoragePricePerPeriod.Div64(1 << 40).Div64(gs.Period)
+	if perPeriod.IsZero() {
+		perPeriod = types.NewCurrency64(1)
+	}
+	if limit.IsZero() || perPeriod.Cmp(limit) < 0 {
+		limit = perPeriod
+	}
+	return limit
+}
+
 type SearchHostsRequest struct {
 	Offset          int               `json:"offset"`
 	Limit           int               `json:"limit"`
@@ -252,6 +700,28 @@ type SearchHostsRequest struct {
 	KeyIn           []types.PublicKey `json:"keyIn"`
 }
 
+// ReshardProgress is the progress of converting existing objects to the
+// current redundancy settings.
+type ReshardProgress struct {
+	MinShards   int `json:"minShards"`
+	TotalShards int `json:"totalShards"`
+
+	// Objects is the number of objects that use the default redundancy,
+	// Remaining is the number of those objects that still have slabs with a
+	// different redundancy.
+	Objects   uint64 `json:"objects"`
+	Remaining uint64 `json:"remaining"`
+}
+
+// UploadPackingSettings contain the settings for packing the tails of
+// objects into shared slabs.
+type UploadPackingSettings struct {
+	// Enabled is true if the tails of uploaded objects that don't fill a
+	// slab are buffered by the bus and packed together, instead of being
+	// padded to a full slab.
+	Enabled bool `json:"enabled"`
+}
+
 // RedundancySettings contain settings that dictate an object's redundancy.
 type RedundancySettings struct {
 	MinShards   int `json:"minShards"`
@@ -278,3 +748,182 @@ func (rs RedundancySettings) Validate() error {
 	}
 	return nil
 }
+
+// TracingSettings contain the settings of the OpenTelemetry exporter. Only
+// the sampling rate is applied at runtime, the bus applies it immediately and
+// workers and autopilots that run in a separate process pick it up
+// periodically. Changing the endpoint or service name requires a restart.
+type TracingSettings struct {
+	Endpoint     string  `json:"endpoint"`
+	ServiceName  string  `json:"serviceName"`
+	SamplingRate float64 `json:"samplingRate"`
+}
+
+// Validate returns an error if the tracing settings are not considered valid.
+func (ts TracingSettings) Validate() error {
+	if ts.SamplingRate < 0 || ts.SamplingRate > 1 {
+		return errors.New("SamplingRate must be between 0 and 1")
+	}
+	return nil
+}
+
+// TrashSettings contain the settings of the trash. If the trash is enabled,
+// deleted objects are moved to the trash and only purged once the retention
+// period passed.
+type TrashSettings struct {
+	Enabled   bool          `json:"enabled"`
+	Retention time.Duration `json:"retention"`
+}
+
+// Validate returns an error if the trash settings are not considered valid.
+func (ts TrashSettings) Validate() error {
+	if ts.Enabled && ts.Retention <= 0 {
+		return errors.New("Retention must be positive if the trash is enabled")
+	}
+	return nil
+}
+
+// MinAnnouncementsPerHost is the minimum number of announcements that are
+// kept per host when compacting announcements, so a host still has an address
+// if its latest announcement is reverted.
+const MinAnnouncementsPerHost = 2
+
+// AnnouncementSettings contain the settings of the host announcement
+// compaction, only the latest MaxPerHost announcements of every host are kept.
+// Announcements that could still be reverted by a reorg are always kept.
+type AnnouncementSettings struct {
+	MaxPerHost int `json:"maxPerHost"`
+}
+
+// Validate returns an error if the announcement settings are not considered
+// valid.
+func (as AnnouncementSettings) Validate() error {
+	if as.MaxPerHost < MinAnnouncementsPerHost {
+		return fmt.Errorf("MaxPerHost must be at least %v", MinAnnouncementsPerHost)
+	}
+	return nil
+}
+
+// SettingUpdate is an entry in the history of a setting. OldValue is empty if
+// the setting didn't exist before the update.
+type SettingUpdate struct {
+	ID        uint      `json:"id"`
+	Key       string    `json:"key"`
+	OldValue  string    `json:"oldValue"`
+	NewValue  string    `json:"newValue"`
+	Timestamp time.Time `json:"timestamp"`
+	Actor     string    `json:"actor"`
+}
+
+// SettingRollbackRequest is the request type for the /setting/:key/rollback
+// endpoint. The setting is reset to the value it had after the update with the
+// given ID.
+type SettingRollbackRequest struct {
+	UpdateID uint `json:"updateID"`
+}
+
+// TrashedObject describes an object in the trash.
+type TrashedObject struct {
+	ID        uint      `json:"id"`
+	Key       string    `json:"key"`
+	Size      int64     `json:"size"`
+	TrashedAt time.Time `json:"trashedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// QueryStats contains statistics about the database queries of a query
+// family.
+type QueryStats struct {
+	Family    string             `json:"family"`
+	Count     uint64             `json:"count"`
+	Errors    uint64             `json:"errors"`
+	Total     time.Duration      `json:"total"`
+	Max       time.Duration      `json:"max"`
+	Histogram []QueryStatsBucket `json:"histogram"`
+}
+
+// QueryStatsBucket is a bucket of the query duration histogram, it contains
+// the number of queries that took at most UpperBound but longer than the
+// previous bucket's bound. The last bucket has no upper bound.
+type QueryStatsBucket struct {
+	UpperBound time.Duration `json:"upperBound,omitempty"`
+	Count      uint64        `json:"count"`
+}
+
+// WalletUnlockRequest is the request type for the /wallet/unlock endpoint.
+type WalletUnlockRequest struct {
+	Passphrase string `json:"passphrase"`
+}
+
+// WalletSeedVersion is the version of the key derivation used by renterd. The
+// wallet's addresses and the renter keys of its contracts are derived from
+// the seed, a backup can only be imported by nodes using the same version.
+const WalletSeedVersion = 1
+
+// WalletSeedExportRequest is the request type for the /wallet/seed/export
+// endpoint. Passphrase decrypts the seed stored on the node, if the node
+// doesn't store its seed encrypted the seed it was started with is exported
+// and Passphrase is ignored. The exported seed is encrypted with
+// ExportPassphrase.
+type WalletSeedExportRequest struct {
+	Passphrase       string `json:"passphrase"`
+	ExportPassphrase string `json:"exportPassphrase"`
+}
+
+// WalletSeedBackup is an encrypted wallet seed together with the metadata
+// needed to restore the wallet's state on another node.
+type WalletSeedBackup struct {
+	Version       uint8         `json:"version"`
+	EncryptedSeed []byte        `json:"encryptedSeed"`
+	Address       types.Address `json:"address"`
+
+	// Addresses is the number of addresses that were derived from the seed.
+	Addresses uint64 `json:"addresses"`
+}
+
+// WalletSeedImportRequest is the request type for the /wallet/seed/import
+// endpoint. ExportPassphrase decrypts the backup, the seed is stored on the
+// node encrypted with Passphrase.
+type WalletSeedImportRequest struct {
+	Backup           WalletSeedBackup `json:"backup"`
+	ExportPassphrase string           `json:"exportPassphrase"`
+	Passphrase       string           `json:"passphrase"`
+}
+
+// WalletSeedImportResponse is the response type for the /wallet/seed/import
+// endpoint. RestartRequired is set if the imported seed belongs to another
+// wallet, it's used once the node is restarted.
+type WalletSeedImportResponse struct {
+	RestartRequired bool `json:"restartRequired"`
+}
+
+const (
+	// WorkerCapabilityUpload and WorkerCapabilityDownload are the
+	// capabilities a worker registers with, the bus only routes requests to
+	// workers with the matching capability.
+	WorkerCapabilityUpload   = "upload"
+	WorkerCapabilityDownload = "download"
+)
+
+// WorkerRegisterRequest is the request type for the /workers/register
+// endpoint. Workers register periodically, the registration doubles as a
+// heartbeat.
+type WorkerRegisterRequest struct {
+	ID           string   `json:"id"`
+	Address      string   `json:"address"`
+	Password     string   `json:"password"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// WorkerInfo describes a worker that registered with the bus.
+type WorkerInfo struct {
+	ID            string    `json:"id"`
+	Address       string    `json:"address"`
+	Capabilities  []string  `json:"capabilities"`
+	Registered    time.Time `json:"registered"`
+	LastHeartbeat time.Time `json:"lastHeartbeat"`
+
+	// Healthy is false if the worker missed its heartbeats or couldn't be
+	// reached when routing a request to it.
+	Healthy bool `json:"healthy"`
+}
@@ -0,0 +1,32 @@
+package api
+
+type (
+	// A ConsistencyCheck is the outcome of one of the checks of the
+	// database consistency checker. Repairable is true if the
+	// inconsistencies the check found can be repaired without losing data,
+	// Repaired is the number of inconsistencies that were repaired.
+	ConsistencyCheck struct {
+		Name            string `json:"name"`
+		Description     string `json:"description"`
+		Inconsistencies int64  `json:"inconsistencies"`
+		Repairable      bool   `json:"repairable"`
+		Repaired        int64  `json:"repaired"`
+	}
+
+	// ConsistencyReport is the response type for the /consistency
+	// endpoints.
+	ConsistencyReport struct {
+		Checks []ConsistencyCheck `json:"checks"`
+	}
+)
+
+// Consistent returns true if none of the checks found an inconsistency that
+// wasn't repaired.
+func (r ConsistencyReport) Consistent() bool {
+	for _, c := range r.Checks {
+		if c.Inconsistencies > c.Repaired {
+			return false
+		}
+	}
+	return true
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"time"
+
 	rhpv2 "go.sia.tech/core/rhp/v2"
 	"go.sia.tech/core/types"
 )
@@ -28,11 +30,63 @@ type (
 		RenewedFrom types.FileContractID `json:"renewedFrom"`
 		Spending    ContractSpending     `json:"spending"`
 		TotalCost   types.Currency       `json:"totalCost"`
+
+		// RemainingFunds are the renter funds left in the contract as of the
+		// latest revision a worker reported.
+		RemainingFunds types.Currency `json:"remainingFunds"`
+
+		// LatestRevisionNumber is the number of the latest revision a worker
+		// reported, RevisionNumber is the number of the latest revision that
+		// made it on chain.
+		LatestRevisionNumber uint64 `json:"latestRevisionNumber"`
+
+		// Broadcast is the latest revision that was broadcast before the
+		// contract's proof window opened, it's nil if the contract's
+		// revision was never broadcast.
+		Broadcast *ContractBroadcast `json:"broadcast,omitempty"`
+
+		ContractUsability
+	}
+
+	// ContractUsability describes what a contract can be used for, the flags
+	// are updated by the autopilot during contract maintenance.
+	ContractUsability struct {
+		GoodForUpload bool `json:"goodForUpload"`
+		GoodForRenew  bool `json:"goodForRenew"`
+	}
+
+	// ContractBroadcast describes a broadcast of a contract's latest signed
+	// revision.
+	ContractBroadcast struct {
+		RevisionNumber uint64              `json:"revisionNumber"`
+		Height         uint64              `json:"height"`
+		TransactionID  types.TransactionID `json:"transactionID"`
+	}
+
+	// ContractSetChange is a contract that was added to or removed from a
+	// contract set at the given time.
+	ContractSetChange struct {
+		ContractID types.FileContractID `json:"contractID"`
+		Time       time.Time            `json:"time"`
+	}
+
+	// ContractSetDiff contains the contracts that were added to and removed
+	// from a contract set over a period of time.
+	ContractSetDiff struct {
+		Added   []ContractSetChange `json:"added"`
+		Removed []ContractSetChange `json:"removed"`
+	}
+
+	// ContractUsabilityUpdate updates the usability flags of a contract.
+	ContractUsabilityUpdate struct {
+		ContractID types.FileContractID `json:"contractID"`
+		ContractUsability
 	}
 
 	// ContractSpending contains all spending details for a contract.
 	ContractSpending struct {
 		Uploads     types.Currency `json:"uploads"`
+		Storage     types.Currency `json:"storage"`
 		Downloads   types.Currency `json:"downloads"`
 		FundAccount types.Currency `json:"fundAccount"`
 	}
@@ -40,6 +94,12 @@ type (
 	ContractSpendingRecord struct {
 		ContractSpending
 		ContractID types.FileContractID `json:"contractID"`
+
+		// RevisionNumber and RemainingFunds describe the latest revision
+		// the spending was recorded for, RemainingFunds are the renter funds
+		// that are left in the contract.
+		RevisionNumber uint64         `json:"revisionNumber"`
+		RemainingFunds types.Currency `json:"remainingFunds"`
 	}
 
 	// An ArchivedContract contains all information about a contract with a host
@@ -62,6 +122,7 @@ type (
 // Add returns the sum of the current and given contract spending.
 func (x ContractSpending) Add(y ContractSpending) (z ContractSpending) {
 	z.Uploads = x.Uploads.Add(y.Uploads)
+	z.Storage = x.Storage.Add(y.Storage)
 	z.Downloads = x.Downloads.Add(y.Downloads)
 	z.FundAccount = x.FundAccount.Add(y.FundAccount)
 	return
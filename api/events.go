@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.sia.tech/core/types"
+)
+
+const (
+	// EventContractAdded is broadcast when a contract was formed or renewed.
+	EventContractAdded = "contract_added"
+
+	// EventContractArchived is broadcast when a contract was removed or
+	// archived because it was renewed.
+	EventContractArchived = "contract_archived"
+
+	// EventSettingChanged is broadcast when a setting was updated.
+	EventSettingChanged = "setting_changed"
+
+	// EventHostBlocked is broadcast when entries were added to the host
+	// blocklist.
+	EventHostBlocked = "host_blocked"
+
+	// EventAlertRaised is broadcast when an alert was raised.
+	EventAlertRaised = "alert_raised"
+
+	// EventObjectUploaded is broadcast when an object was added or updated.
+	EventObjectUploaded = "object_uploaded"
+
+	// EventContractExpired is broadcast once the proof window of an active
+	// contract closed.
+	EventContractExpired = "contract_expired"
+
+	// EventRevisionBroadcastDue is scheduled by the autopilot, it's broadcast
+	// when the latest revision of a contract has to be broadcast.
+	EventRevisionBroadcastDue = "revision_broadcast_due"
+
+	// EventContractRenewalDue is scheduled by the autopilot, it's broadcast
+	// when a contract enters its renew window.
+	EventContractRenewalDue = "contract_renewal_due"
+)
+
+const (
+	// ContractArchivalReasonRemoved and ContractArchivalReasonRenewed are the
+	// reasons a contract was archived.
+	ContractArchivalReasonRemoved = "removed"
+	ContractArchivalReasonRenewed = "renewed"
+)
+
+type (
+	// An Event is streamed by the bus's /events endpoint. Data contains the
+	// JSON encoding of the payload that belongs to the event's type, e.g.
+	// ContractMetadata for EventContractAdded.
+	Event struct {
+		ID        uint64          `json:"id"`
+		Type      string          `json:"type"`
+		Timestamp time.Time       `json:"timestamp"`
+		Data      json.RawMessage `json:"data"`
+	}
+
+	// EventContractArchivedData is the payload of EventContractArchived.
+	EventContractArchivedData struct {
+		ContractID types.FileContractID `json:"contractID"`
+		Reason     string               `json:"reason"`
+	}
+
+	// EventContractExpiredData is the payload of EventContractExpired.
+	EventContractExpiredData struct {
+		ContractID types.FileContractID `json:"contractID"`
+		WindowEnd  uint64               `json:"windowEnd"`
+	}
+
+	// EventContractDueData is the payload of EventRevisionBroadcastDue and
+	// EventContractRenewalDue.
+	EventContractDueData struct {
+		ContractID types.FileContractID `json:"contractID"`
+	}
+
+	// A ScheduledEvent is broadcast by the bus once the chain reaches its
+	// height, scheduled events are persisted until they are broadcast.
+	// Scheduling an event replaces the event scheduled under the same key.
+	ScheduledEvent struct {
+		Key    string          `json:"key"`
+		Height uint64          `json:"height"`
+		Type   string          `json:"type"`
+		Data   json.RawMessage `json:"data"`
+	}
+
+	// EventSettingChangedData is the payload of EventSettingChanged, the
+	// setting's value has to be fetched separately.
+	EventSettingChangedData struct {
+		Key string `json:"key"`
+	}
+
+	// EventHostBlockedData is the payload of EventHostBlocked.
+	EventHostBlockedData struct {
+		Entries []string `json:"entries"`
+	}
+
+	// EventObjectUploadedData is the payload of EventObjectUploaded.
+	EventObjectUploadedData struct {
+		Key  string `json:"key"`
+		Size int64  `json:"size"`
+	}
+)
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.sia.tech/core/types"
+)
+
+// SettingFaultInjection is the key of the bus setting that configures the
+// worker's fault injection, faults are only injected if it's enabled.
+const SettingFaultInjection = "faultinjection"
+
+type (
+	// FaultInjectionSettings configure the faults the worker injects into
+	// the sector transfers with hosts. They are meant to exercise the
+	// overdrive, retry and migration logic in test environments and should
+	// never be enabled in production. The Default config applies to every
+	// host that isn't configured in Hosts.
+	FaultInjectionSettings struct {
+		Enabled bool                            `json:"enabled"`
+		Default FaultConfig                     `json:"default"`
+		Hosts   map[types.PublicKey]FaultConfig `json:"hosts,omitempty"`
+	}
+
+	// FaultConfig configures the faults injected into the operations on a
+	// host's sectors. Every operation is delayed by Latency, then a fraction
+	// of TimeoutRate operations hangs for Timeout before failing, or until
+	// the operation's context is done if Timeout is zero, and a fraction of
+	// ErrorRate operations fails right away.
+	FaultConfig struct {
+		ErrorRate   float64       `json:"errorRate"`
+		Latency     time.Duration `json:"latency"`
+		TimeoutRate float64       `json:"timeoutRate"`
+		Timeout     time.Duration `json:"timeout"`
+	}
+)
+
+// Config returns the fault config of the host with given key.
+func (fs FaultInjectionSettings) Config(hk types.PublicKey) FaultConfig {
+	if fc, ok := fs.Hosts[hk]; ok {
+		return fc
+	}
+	return fs.Default
+}
+
+// Validate returns an error if the fault injection settings are not
+// considered valid.
+func (fs FaultInjectionSettings) Validate() error {
+	if err := fs.Default.Validate(); err != nil {
+		return fmt.Errorf("invalid default config: %w", err)
+	}
+	for hk, fc := range fs.Hosts {
+		if err := fc.Validate(); err != nil {
+			return fmt.Errorf("invalid config for host %v: %w", hk, err)
+		}
+	}
+	return nil
+}
+
+// Validate returns an error if the fault config is not considered valid.
+func (fc FaultConfig) Validate() error {
+	if fc.ErrorRate < 0 || fc.ErrorRate > 1 {
+		return errors.New("ErrorRate must be between 0 and 1")
+	} else if fc.TimeoutRate < 0 || fc.TimeoutRate > 1 {
+		return errors.New("TimeoutRate must be between 0 and 1")
+	} else if fc.Latency < 0 {
+		return errors.New("Latency can't be negative")
+	} else if fc.Timeout < 0 {
+		return errors.New("Timeout can't be negative")
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package api
+
+import "go.sia.tech/core/types"
+
+type (
+	// A GCResult summarizes a garbage collection run over the object
+	// metadata.
+	GCResult struct {
+		// Slabs and Sectors are the number of slabs and sectors that were
+		// no longer referenced and got pruned.
+		Slabs   int `json:"slabs"`
+		Sectors int `json:"sectors"`
+
+		// ReclaimedBytes is the amount of host storage that is freed up
+		// once the pruned sectors are deleted from their hosts.
+		ReclaimedBytes uint64 `json:"reclaimedBytes"`
+	}
+
+	// SectorDeletions are sectors that are no longer needed and should be
+	// deleted from the host of the given contract.
+	SectorDeletions struct {
+		ContractID types.FileContractID `json:"contractID"`
+		HostKey    types.PublicKey      `json:"hostKey"`
+		HostIP     string               `json:"hostIP"`
+		Roots      []types.Hash256      `json:"roots"`
+	}
+
+	// DeleteSectorsResponse is the response type for the /gc/sectors
+	// endpoint.
+	DeleteSectorsResponse struct {
+		Deleted        int      `json:"deleted"`
+		ReclaimedBytes uint64   `json:"reclaimedBytes"`
+		Errors         []string `json:"errors,omitempty"`
+	}
+)
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"sort"
+)
+
+// HealthCheck is the result of a single health check.
+type HealthCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// HealthResponse is the response type for the /health endpoint of every
+// module. It's only OK if all of its checks are OK.
+type HealthResponse struct {
+	OK     bool          `json:"ok"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+// NewHealthResponse creates a HealthResponse from the results of the checks
+// by name, a nil error means the check passed.
+func NewHealthResponse(results map[string]error) HealthResponse {
+	resp := HealthResponse{OK: true}
+	for name, err := range results {
+		check := HealthCheck{Name: name, OK: err == nil}
+		if err != nil {
+			check.Error = err.Error()
+			resp.OK = false
+		}
+		resp.Checks = append(resp.Checks, check)
+	}
+	sort.Slice(resp.Checks, func(i, j int) bool {
+		return resp.Checks[i].Name < resp.Checks[j].Name
+	})
+	return resp
+}
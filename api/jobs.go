@@ -0,0 +1,172 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.sia.tech/core/types"
+)
+
+const (
+	// JobTypeGC collects the slabs and sectors that are no longer referenced
+	// by any object, it's run by the bus.
+	JobTypeGC = "gc"
+
+	// JobTypePrune purges the objects in the trash, it's run by the bus.
+	JobTypePrune = "prune"
+
+	// JobTypeRescan rescans the blockchain for the renter's contracts, it's
+	// run by the bus.
+	JobTypeRescan = "rescan"
+
+	// JobTypeMigration tracks a pass of the autopilot's migrator over the
+	// repair queue, JobTypeReshard tracks a batch of objects resharded by
+	// the autopilot. The autopilot acquires them through the bus, pending
+	// jobs created through the API are picked up by the next pass or batch
+	// that has slabs or objects to process.
+	JobTypeMigration = "migration"
+	JobTypeReshard   = "reshard"
+)
+
+const (
+	// JobStatePending, JobStateRunning, JobStateDone, JobStateFailed and
+	// JobStateCancelled are the states of a job.
+	JobStatePending   = "pending"
+	JobStateRunning   = "running"
+	JobStateDone      = "done"
+	JobStateFailed    = "failed"
+	JobStateCancelled = "cancelled"
+)
+
+var (
+	// ErrJobNotFound is returned if an unknown job is requested.
+	ErrJobNotFound = errors.New("job not found")
+
+	// ErrNoJobAvailable is returned if a job is acquired while none of the
+	// requested type is pending.
+	ErrNoJobAvailable = errors.New("no job available")
+
+	// ErrJobNotActive is returned if a job is cancelled that is neither
+	// pending nor running.
+	ErrJobNotActive = errors.New("job is not active")
+
+	// ErrJobNotRunning is returned if the progress of a job is updated that
+	// isn't running, e.g. because it was cancelled.
+	ErrJobNotRunning = errors.New("job is not running")
+
+	// ErrJobNotRetryable is returned if a job is retried that neither failed
+	// nor was cancelled.
+	ErrJobNotRetryable = errors.New("only failed or cancelled jobs can be retried")
+)
+
+// A Job is a long-running operation tracked by the bus.
+type Job struct {
+	ID       uint            `json:"id"`
+	Type     string          `json:"type"`
+	State    string          `json:"state"`
+	Params   json.RawMessage `json:"params,omitempty"`
+	Progress float64         `json:"progress"`
+	Result   json.RawMessage `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+
+	// Attempts is the number of times the job was started.
+	Attempts  uint64    `json:"attempts"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// JobCreateRequest is the request type for the /jobs endpoint.
+type JobCreateRequest struct {
+	Type   string          `json:"type"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// Validate returns an error if the request has an unknown job type.
+func (r JobCreateRequest) Validate() error {
+	switch r.Type {
+	case JobTypeGC, JobTypePrune, JobTypeRescan, JobTypeMigration, JobTypeReshard:
+		return nil
+	default:
+		return fmt.Errorf("unknown job type %q", r.Type)
+	}
+}
+
+// JobAcquireRequest is the request type for the /jobs/acquire endpoint.
+type JobAcquireRequest struct {
+	Types []string `json:"types"`
+}
+
+// A JobUpdate reports the progress of a running job. Setting the state to
+// done or failed finishes the job.
+type JobUpdate struct {
+	State    string          `json:"state"`
+	Progress float64         `json:"progress"`
+	Result   json.RawMessage `json:"result,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// Validate returns an error if the update has an invalid state or progress.
+func (u JobUpdate) Validate() error {
+	switch u.State {
+	case JobStateRunning, JobStateDone, JobStateFailed:
+	default:
+		return fmt.Errorf("invalid job state %q", u.State)
+	}
+	if u.Progress < 0 || u.Progress > 1 {
+		return fmt.Errorf("progress must be between 0 and 1, got %v", u.Progress)
+	}
+	return nil
+}
+
+// PruneJobParams are the parameters of a prune job.
+type PruneJobParams struct {
+	// ExpiredOnly limits the job to the objects whose retention period in
+	// the trash passed.
+	ExpiredOnly bool `json:"expiredOnly"`
+}
+
+// PruneJobResult is the result of a prune job.
+type PruneJobResult struct {
+	Purged int `json:"purged"`
+}
+
+// MigrationJobResult is the result of a migration job. Migrated is the number
+// of slabs the pass attempted to migrate, Failed is the number of those that
+// couldn't be migrated.
+type MigrationJobResult struct {
+	Migrated uint64 `json:"migrated"`
+	Failed   uint64 `json:"failed"`
+}
+
+// ReshardJobResult is the result of a reshard job.
+type ReshardJobResult struct {
+	Resharded int `json:"resharded"`
+	Failed    int `json:"failed"`
+}
+
+// ContractKeys are the public keys of the renter and the host of a contract.
+type ContractKeys struct {
+	HostKey   types.PublicKey `json:"hostKey"`
+	RenterKey types.PublicKey `json:"renterKey"`
+}
+
+// RescanJobParams are the parameters of a rescan job.
+type RescanJobParams struct {
+	// Keys are the key pairs the renter forms contracts with, the renter
+	// keys are derived from the seed by the workers. Contracts with hosts
+	// that aren't listed can't be found.
+	Keys []ContractKeys `json:"keys"`
+}
+
+// RescanJobResult is the result of a rescan job. Found is the number of
+// contracts that can still be revised, Added is the number of those that
+// weren't known yet. Contracts are the IDs of the contracts that were found,
+// the roots of the added ones are unknown until they are restored.
+type RescanJobResult struct {
+	Height    uint64                 `json:"height"`
+	Found     int                    `json:"found"`
+	Added     int                    `json:"added"`
+	Contracts []types.FileContractID `json:"contracts"`
+}
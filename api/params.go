@@ -20,14 +20,35 @@ type (
 	// are encoded as an integer number of milliseconds.
 	ParamDuration time.Duration
 
+	// ParamFloat64 is a helper type since jape can't decode floats from
+	// query params.
+	ParamFloat64 float64
+
 	// ParamString is a helper type since jape expects query params to
 	// implement the TextMarshaler interface.
 	ParamString string
 
+	// ParamUint64 is a helper type since jape can't decode uint64s from
+	// query params.
+	ParamUint64 uint64
+
 	// A SlabID uniquely identifies a slab.
 	SlabID uint
 )
 
+// String implements fmt.Stringer.
+func (f ParamFloat64) String() string { return strconv.FormatFloat(float64(f), 'g', -1, 64) }
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (f *ParamFloat64) UnmarshalText(b []byte) error {
+	v, err := strconv.ParseFloat(string(b), 64)
+	if err != nil {
+		return err
+	}
+	*f = ParamFloat64(v)
+	return nil
+}
+
 // String implements fmt.Stringer.
 func (s ParamString) String() string { return string(s) }
 
@@ -42,6 +63,19 @@ func (s *ParamString) UnmarshalText(b []byte) error {
 	return nil
 }
 
+// String implements fmt.Stringer.
+func (u ParamUint64) String() string { return strconv.FormatUint(uint64(u), 10) }
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (u *ParamUint64) UnmarshalText(b []byte) error {
+	v, err := strconv.ParseUint(string(b), 10, 64)
+	if err != nil {
+		return err
+	}
+	*u = ParamUint64(v)
+	return nil
+}
+
 // String implements fmt.Stringer.
 func (t ParamTime) String() string { return url.QueryEscape((time.Time)(t).Format(time.RFC3339)) }
 
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"time"
+
+	"go.sia.tech/core/types"
+)
+
+type (
+	// A DailyReport summarizes the activity of the renter on a single day.
+	DailyReport struct {
+		// Date is the start of the day the report covers, in UTC.
+		Date time.Time `json:"date"`
+
+		// Spending is the total cost of the contracts formed and renewed,
+		// uploads, downloads and funding accounts are paid from those
+		// contracts and therefore aren't counted again.
+		Spending types.Currency `json:"spending"`
+
+		// Uploaded and Downloaded are the number of bytes transferred to and
+		// from hosts.
+		Uploaded   uint64 `json:"uploaded"`
+		Downloaded uint64 `json:"downloaded"`
+
+		ContractsFormed  uint64 `json:"contractsFormed"`
+		ContractsRenewed uint64 `json:"contractsRenewed"`
+
+		// HostsLost is the number of offline hosts that were removed from
+		// the host database.
+		HostsLost uint64 `json:"hostsLost"`
+
+		// Migrations is the number of slabs that were migrated.
+		Migrations uint64 `json:"migrations"`
+	}
+
+	// A ContractUtilization summarizes how much was spent on a contract
+	// compared to the amount of data it stores.
+	ContractUtilization struct {
+		ContractID types.FileContractID `json:"contractID"`
+		HostKey    types.PublicKey      `json:"hostKey"`
+
+		// Size is the number of bytes stored in the contract.
+		Size uint64 `json:"size"`
+
+		// Spending breaks down the spending recorded for the contract, Spent
+		// is the total amount of renter funds used, including the contract
+		// fees.
+		Spending ContractSpending `json:"spending"`
+		Spent    types.Currency   `json:"spent"`
+
+		// PricePerTB is the effective price paid per TB stored in the
+		// contract, it's zero if the contract doesn't store any data.
+		PricePerTB types.Currency `json:"pricePerTB"`
+	}
+
+	// A HostUtilization aggregates the utilization of all active contracts
+	// with a host.
+	HostUtilization struct {
+		HostKey    types.PublicKey `json:"hostKey"`
+		Contracts  uint64          `json:"contracts"`
+		Size       uint64          `json:"size"`
+		Spent      types.Currency  `json:"spent"`
+		PricePerTB types.Currency  `json:"pricePerTB"`
+	}
+
+	// A UtilizationReport summarizes the utilization of all active contracts,
+	// both per contract and per host.
+	UtilizationReport struct {
+		Contracts []ContractUtilization `json:"contracts"`
+		Hosts     []HostUtilization     `json:"hosts"`
+	}
+
+	// ReportSettings contain the settings of the daily reports.
+	ReportSettings struct {
+		// WebhookURL is the URL every report is POSTed to once the day it
+		// covers is over, reports aren't pushed if it's empty.
+		WebhookURL string `json:"webhookURL"`
+	}
+)
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"math"
+	"time"
+
+	"go.sia.tech/core/types"
+)
+
+type (
+	// A SectorAudit is a sector that should be verified to still be stored
+	// on the host of the given contract.
+	SectorAudit struct {
+		ContractID types.FileContractID `json:"contractID"`
+		HostKey    types.PublicKey      `json:"hostKey"`
+		HostIP     string               `json:"hostIP"`
+		Root       types.Hash256        `json:"root"`
+	}
+
+	// A SectorAuditResult is the outcome of a sector audit. A sector is
+	// missing if the host explicitly reported that it doesn't store it, the
+	// bus considers it lost once it was missing in several consecutive
+	// audits. Other errors like the host being offline or refusing to serve
+	// the sector because of its prices don't count towards that.
+	SectorAuditResult struct {
+		ContractID types.FileContractID `json:"contractID"`
+		HostKey    types.PublicKey      `json:"hostKey"`
+		Root       types.Hash256        `json:"root"`
+		Missing    bool                 `json:"missing"`
+		Error      string               `json:"error,omitempty"`
+	}
+
+	// RecordSectorAuditsRequest is the request type for the
+	// /sectors/audits endpoint.
+	RecordSectorAuditsRequest struct {
+		ContractSet string              `json:"contractset"`
+		Results     []SectorAuditResult `json:"results"`
+	}
+
+	// HostAuditStats are the accumulated sector audit results of a host.
+	// Failed audits are audits that couldn't be performed, e.g. because the
+	// host was offline, Lost audits are audits of sectors the host no
+	// longer stores.
+	HostAuditStats struct {
+		HostKey    types.PublicKey `json:"hostKey"`
+		Successful uint64          `json:"successful"`
+		Failed     uint64          `json:"failed"`
+		Lost       uint64          `json:"lost"`
+		LastAudit  time.Time       `json:"lastAudit"`
+		LastLoss   time.Time       `json:"lastLoss"`
+	}
+
+	// An ObjectAuditResult is the outcome of an object audit. An object is
+	// corrupt if its downloaded data doesn't match its ETag, other errors
+	// like a failed download don't mark it as corrupt.
+	ObjectAuditResult struct {
+		Path    string `json:"path"`
+		Corrupt bool   `json:"corrupt"`
+		Error   string `json:"error,omitempty"`
+	}
+)
+
+// auditConfidenceZ is the z-score of the 95% confidence level the
+// retrievability of a host's sectors is estimated with.
+const auditConfidenceZ = 1.96
+
+// Retrievability returns the lower bound of the 95% confidence interval of the
+// probability that a sector stored on the host can be retrieved, estimated
+// from the audits using the Wilson score interval. It's zero if none of the
+// host's audits succeeded.
+func (s HostAuditStats) Retrievability() float64 {
+	if s.Successful == 0 {
+		return 0
+	}
+	n := float64(s.Successful + s.Failed + s.Lost)
+	p := float64(s.Successful) / n
+	z2 := auditConfidenceZ * auditConfidenceZ
+	center := p + z2/(2*n)
+	margin := auditConfidenceZ * math.Sqrt(p*(1-p)/n+z2/(4*n*n))
+	return (center - margin) / (1 + z2/n)
+}
@@ -0,0 +1,118 @@
+package api
+
+import (
+	"errors"
+
+	"go.sia.tech/core/types"
+)
+
+const (
+	SpendingCategoryFormation   = "formation"
+	SpendingCategoryStorage     = "storage"
+	SpendingCategoryUpload      = "upload"
+	SpendingCategoryDownload    = "download"
+	SpendingCategoryFundAccount = "fundaccount"
+)
+
+// ErrSpendingCapExceeded is returned by the bus when a request would exceed
+// one of the spending caps.
+var ErrSpendingCapExceeded = errors.New("spending cap exceeded")
+
+type (
+	// SpendingCaps are hard limits on the renter's spending that are
+	// enforced by the bus. The caps apply to the spending within periods of
+	// Period blocks, a zero cap disables it.
+	SpendingCaps struct {
+		Period uint64 `json:"period"`
+
+		Total       types.Currency `json:"total"`
+		Formation   types.Currency `json:"formation"`
+		Storage     types.Currency `json:"storage"`
+		Upload      types.Currency `json:"upload"`
+		Download    types.Currency `json:"download"`
+		FundAccount types.Currency `json:"fundAccount"`
+	}
+
+	// PeriodSpending is the renter's spending within the current spending
+	// period, per category. Formation covers the fees of forming and
+	// renewing contracts, the funds locked in the contracts are counted when
+	// they're spent on storage, uploads, downloads or funding accounts.
+	PeriodSpending struct {
+		PeriodStart uint64 `json:"periodStart"`
+
+		Formation   types.Currency `json:"formation"`
+		Storage     types.Currency `json:"storage"`
+		Upload      types.Currency `json:"upload"`
+		Download    types.Currency `json:"download"`
+		FundAccount types.Currency `json:"fundAccount"`
+	}
+
+	// SpendingAuthorizeRequest is the request type for the
+	// /spending/authorize endpoint. The authorized amount is reserved until
+	// the spending is recorded or the reservation expires.
+	SpendingAuthorizeRequest struct {
+		Category string         `json:"category"`
+		Amount   types.Currency `json:"amount"`
+	}
+)
+
+// Validate returns an error if the spending caps are not considered valid.
+func (sc SpendingCaps) Validate() error {
+	if sc.Period == 0 && sc != (SpendingCaps{}) {
+		return errors.New("Period must be set if a cap is set")
+	}
+	return nil
+}
+
+// Category returns the cap for the given category.
+func (sc SpendingCaps) Category(category string) types.Currency {
+	switch category {
+	case SpendingCategoryFormation:
+		return sc.Formation
+	case SpendingCategoryStorage:
+		return sc.Storage
+	case SpendingCategoryUpload:
+		return sc.Upload
+	case SpendingCategoryDownload:
+		return sc.Download
+	case SpendingCategoryFundAccount:
+		return sc.FundAccount
+	default:
+		return types.ZeroCurrency
+	}
+}
+
+// Total returns the total spending within the period.
+func (ps PeriodSpending) Total() types.Currency {
+	return ps.Formation.Add(ps.Storage).Add(ps.Upload).Add(ps.Download).Add(ps.FundAccount)
+}
+
+// Add returns the sum of the spending within the period and the given
+// spending.
+func (ps PeriodSpending) Add(o PeriodSpending) PeriodSpending {
+	ps.Formation = ps.Formation.Add(o.Formation)
+	ps.Storage = ps.Storage.Add(o.Storage)
+	ps.Upload = ps.Upload.Add(o.Upload)
+	ps.Download = ps.Download.Add(o.Download)
+	ps.FundAccount = ps.FundAccount.Add(o.FundAccount)
+	return ps
+}
+
+// Category returns the spending within the period for the given category, it
+// returns false if the category is unknown.
+func (ps PeriodSpending) Category(category string) (types.Currency, bool) {
+	switch category {
+	case SpendingCategoryFormation:
+		return ps.Formation, true
+	case SpendingCategoryStorage:
+		return ps.Storage, true
+	case SpendingCategoryUpload:
+		return ps.Upload, true
+	case SpendingCategoryDownload:
+		return ps.Download, true
+	case SpendingCategoryFundAccount:
+		return ps.FundAccount, true
+	default:
+		return types.ZeroCurrency, false
+	}
+}
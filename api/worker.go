@@ -62,6 +62,47 @@ type RHPRenewRequest struct {
 	RenterFunds   types.Currency       `json:"renterFunds"`
 }
 
+// RHPContractRenewRequest is the request type for the /rhp/contract/:id/renew
+// endpoint.
+type RHPContractRenewRequest struct {
+	EndHeight   uint64         `json:"endHeight"`
+	RenterFunds types.Currency `json:"renterFunds"`
+}
+
+// RHPContractRefreshRequest is the request type for the
+// /rhp/contract/:id/refresh endpoint.
+type RHPContractRefreshRequest struct {
+	RenterFunds types.Currency `json:"renterFunds"`
+}
+
+// RHPContractPrunableResponse is the response type for the
+// /rhp/contract/:id/prunable endpoint.
+type RHPContractPrunableResponse struct {
+	Size     uint64 `json:"size"`
+	Prunable uint64 `json:"prunable"`
+}
+
+// RHPContractPruneResponse is the response type for the
+// /rhp/contract/:id/prune endpoint.
+type RHPContractPruneResponse struct {
+	Pruned    uint64 `json:"pruned"`
+	Remaining uint64 `json:"remaining"`
+}
+
+// RHPContractRootsRequest is the request type for the /rhp/contract/:id/roots
+// endpoint. The contract doesn't have to be known to the bus.
+type RHPContractRootsRequest struct {
+	HostKey types.PublicKey `json:"hostKey"`
+	HostIP  string          `json:"hostIP"`
+}
+
+// RHPContractRootsResponse is the response type for the
+// /rhp/contract/:id/roots endpoint.
+type RHPContractRootsResponse struct {
+	Revision rhpv2.ContractRevision `json:"revision"`
+	Roots    []types.Hash256        `json:"roots"`
+}
+
 // RHPRenewResponse is the response type for the /rhp/renew endpoint.
 type RHPRenewResponse struct {
 	Error          string                 `json:"error"`
@@ -103,3 +144,133 @@ type RHPRegistryUpdateRequest struct {
 	RegistryKey   rhpv3.RegistryKey   `json:"registryKey"`
 	RegistryValue rhpv3.RegistryValue `json:"registryValue"`
 }
+
+// RHPPrewarmRequest is the request type for the /rhp/prewarm endpoint.
+type RHPPrewarmRequest struct {
+	// HostKeys are the hosts to establish sessions with, if empty all hosts
+	// in the contract set are prewarmed.
+	HostKeys []types.PublicKey `json:"hostKeys"`
+}
+
+// RHPPrewarmResponse is the response type for the /rhp/prewarm endpoint.
+type RHPPrewarmResponse struct {
+	Warmed int `json:"warmed"`
+	Failed int `json:"failed"`
+}
+
+// PrewarmStats contains statistics about the host sessions the worker
+// established ahead of scheduled work.
+type PrewarmStats struct {
+	Active      int       `json:"active"`
+	Warmed      uint64    `json:"warmed"`
+	Failed      uint64    `json:"failed"`
+	LastPrewarm time.Time `json:"lastPrewarm"`
+}
+
+// WorkerStatsResponse is the response type for the /stats endpoint.
+type WorkerStatsResponse struct {
+	Prewarm PrewarmStats `json:"prewarm"`
+}
+
+// PresignRequest is the request type for the /presign endpoint.
+type PresignRequest struct {
+	Path     string        `json:"path"`
+	Validity ParamDuration `json:"validity"`
+}
+
+// PresignResponse is the response type for the /presign endpoint.
+type PresignResponse struct {
+	// URL is the presigned URL relative to the worker's API address.
+	URL     string    `json:"url"`
+	Expires time.Time `json:"expires"`
+}
+
+// TokenRequest is the request type for the /tokens endpoint.
+type TokenRequest struct {
+	// Prefix is the path prefix of the objects the token grants read-only
+	// access to, it can't be empty.
+	Prefix string `json:"prefix"`
+
+	// Validity is the amount of time the token is valid for, it has to be
+	// positive and is capped by the worker.
+	Validity ParamDuration `json:"validity"`
+}
+
+// TokenResponse is the response type for the /tokens endpoint.
+type TokenResponse struct {
+	Token   string    `json:"token"`
+	Expires time.Time `json:"expires"`
+}
+
+const (
+	// UploadStateActive, UploadStateDone and UploadStateFailed are the
+	// states of an object upload.
+	UploadStateActive = "active"
+	UploadStateDone   = "done"
+	UploadStateFailed = "failed"
+)
+
+// UploadStatus describes the progress of an object upload handled by the
+// worker.
+type UploadStatus struct {
+	ID       string    `json:"id"`
+	Key      string    `json:"key"`
+	State    string    `json:"state"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+
+	// SlabsTotal and BytesTotal are derived from the request's content
+	// length, they're zero and -1 respectively if it's unknown.
+	SlabsUploaded int    `json:"slabsUploaded"`
+	SlabsTotal    int    `json:"slabsTotal"`
+	BytesUploaded uint64 `json:"bytesUploaded"`
+	BytesTotal    int64  `json:"bytesTotal"`
+
+	// Hosts are the hosts the current slab is uploaded to.
+	Hosts  []types.PublicKey `json:"hosts"`
+	Errors []string          `json:"errors,omitempty"`
+}
+
+const (
+	// DownloadJobStateActive, DownloadJobStateDone, DownloadJobStateFailed and
+	// DownloadJobStateCancelled are the states of a download job.
+	DownloadJobStateActive    = "active"
+	DownloadJobStateDone      = "done"
+	DownloadJobStateFailed    = "failed"
+	DownloadJobStateCancelled = "cancelled"
+)
+
+// DownloadJobRequest is the request type for the /downloads endpoint.
+type DownloadJobRequest struct {
+	// Key is the key of the object to download, if it ends in a slash all
+	// objects under that prefix are downloaded.
+	Key string `json:"key"`
+
+	// Path is the path the object is written to, or the directory the
+	// objects of a prefix are written to. It's relative to the worker's
+	// export directory and can't escape it. If it's empty, a single object is
+	// staged by the worker and can be fetched from /downloads/:id/data once
+	// the job is done.
+	Path string `json:"path,omitempty"`
+
+	Passphrase  string `json:"passphrase,omitempty"`
+	ContractSet string `json:"contractSet,omitempty"`
+}
+
+// DownloadJob describes the progress of a download job handled by the
+// worker.
+type DownloadJob struct {
+	ID       string    `json:"id"`
+	Key      string    `json:"key"`
+	Path     string    `json:"path,omitempty"`
+	State    string    `json:"state"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+
+	ObjectsTotal    int    `json:"objectsTotal"`
+	ObjectsDone     int    `json:"objectsDone"`
+	BytesTotal      uint64 `json:"bytesTotal"`
+	BytesDownloaded uint64 `json:"bytesDownloaded"`
+
+	Error string `json:"error,omitempty"`
+}
@@ -0,0 +1,125 @@
+package autopilot
+
+import (
+	"context"
+	"sync"
+
+	"go.sia.tech/renterd/internal/tracing"
+	"go.uber.org/zap"
+)
+
+const (
+	// auditorBatchSize is the number of randomly sampled sectors that are
+	// audited per iteration.
+	auditorBatchSize = 10
+
+	// auditorObjectBatchSize is the number of randomly sampled objects whose
+	// data is verified against their ETag per iteration.
+	auditorObjectBatchSize = 1
+
+	// auditorMaxObjectSize is the size of the largest object that is
+	// sampled for an object audit, auditing an object downloads all of it.
+	auditorMaxObjectSize = 1 << 26 // 64 MiB
+)
+
+// An auditor periodically verifies that hosts still store a random sample of
+// sectors, so lost data is detected and repaired before it's downloaded. It
+// also verifies the data of a random sample of objects still matches their
+// ETag, which catches corruption the sector audits can't detect.
+type auditor struct {
+	ap     *Autopilot
+	logger *zap.SugaredLogger
+
+	mu      sync.Mutex
+	running bool
+}
+
+func newAuditor(ap *Autopilot) *auditor {
+	return &auditor{
+		ap:     ap,
+		logger: ap.logger.Named("auditor"),
+	}
+}
+
+func (a *auditor) tryPerformAudits(ctx context.Context, w Worker) {
+	a.mu.Lock()
+	if a.running || a.ap.isStopped() {
+		a.mu.Unlock()
+		return
+	}
+	a.running = true
+	a.mu.Unlock()
+
+	a.ap.wg.Add(1)
+	go func(set string) {
+		defer a.ap.wg.Done()
+		a.performAudits(w, set)
+		a.mu.Lock()
+		a.running = false
+		a.mu.Unlock()
+	}(a.ap.state.cfg.Contracts.Set)
+}
+
+func (a *auditor) performAudits(w Worker, set string) {
+	ctx, span := tracing.Tracer.Start(context.Background(), "auditor.performAudits")
+	defer span.End()
+
+	a.auditSectors(ctx, w, set)
+	a.auditObjects(ctx, w)
+}
+
+func (a *auditor) auditSectors(ctx context.Context, w Worker, set string) {
+	b := a.ap.bus
+	audits, err := b.SectorsForAudit(ctx, auditorBatchSize)
+	if err != nil {
+		a.logger.Errorf("failed to sample sectors for audit, err: %v", err)
+		return
+	} else if len(audits) == 0 {
+		return
+	}
+
+	results, err := w.AuditSectors(ctx, audits)
+	if err != nil {
+		a.logger.Errorf("failed to audit sectors, err: %v", err)
+		return
+	}
+	for _, res := range results {
+		if res.Error != "" && !res.Missing {
+			a.logger.Debugf("failed to audit sector %v on host %v, err: %v", res.Root, res.HostKey, res.Error)
+		}
+	}
+
+	lost, err := b.RecordSectorAudits(ctx, set, results)
+	if err != nil {
+		a.logger.Errorf("failed to record sector audits, err: %v", err)
+	} else if lost > 0 {
+		a.logger.Warnf("%d/%d audited sectors were lost, the affected slabs were queued for repair", lost, len(results))
+	}
+}
+
+func (a *auditor) auditObjects(ctx context.Context, w Worker) {
+	b := a.ap.bus
+	paths, err := b.ObjectsForAudit(ctx, auditorObjectBatchSize, auditorMaxObjectSize)
+	if err != nil {
+		a.logger.Errorf("failed to sample objects for audit, err: %v", err)
+		return
+	} else if len(paths) == 0 {
+		return
+	}
+
+	results, err := w.AuditObjects(ctx, paths)
+	if err != nil {
+		a.logger.Errorf("failed to audit objects, err: %v", err)
+		return
+	}
+	for _, res := range results {
+		if res.Corrupt {
+			a.logger.Errorf("object %v is corrupt, err: %v", res.Path, res.Error)
+		} else if res.Error != "" {
+			a.logger.Debugf("failed to audit object %v, err: %v", res.Path, res.Error)
+		}
+	}
+	if err := b.RecordObjectAudits(ctx, results); err != nil {
+		a.logger.Errorf("failed to record object audits, err: %v", err)
+	}
+}
@@ -18,7 +18,6 @@ import (
 	"go.sia.tech/renterd/hostdb"
 	"go.sia.tech/renterd/internal/tracing"
 	"go.sia.tech/renterd/object"
-	"go.sia.tech/renterd/wallet"
 	"go.uber.org/zap"
 	"lukechampine.com/frand"
 )
@@ -28,13 +27,26 @@ type Store interface {
 	SetConfig(c api.AutopilotConfig) error
 }
 
+// A stateStore persists the autopilot's state, it's implemented by the bus.
+type stateStore interface {
+	AutopilotState(ctx context.Context) (api.AutopilotState, error)
+	UpdateAutopilotState(ctx context.Context, state api.AutopilotState) error
+}
+
+const (
+	// sectorDeletionBatchSize is the max number of orphaned sectors the
+	// worker deletes from hosts per iteration.
+	sectorDeletionBatchSize = 1000
+)
+
 type Bus interface {
 	// wallet
 	WalletAddress(ctx context.Context) (types.Address, error)
 	WalletBalance(ctx context.Context) (types.Currency, error)
 	WalletDiscard(ctx context.Context, txn types.Transaction) error
 	WalletFund(ctx context.Context, txn *types.Transaction, amount types.Currency) ([]types.Hash256, []types.Transaction, error)
-	WalletOutputs(ctx context.Context) (resp []wallet.SiacoinElement, err error)
+	WalletFundWithOutputs(ctx context.Context, txn *types.Transaction, amount types.Currency, outputs []types.Hash256) ([]types.Hash256, []types.Transaction, error)
+	WalletSpendableOutputs(ctx context.Context) (resp []api.WalletOutput, err error)
 	WalletPending(ctx context.Context) (resp []types.Transaction, err error)
 	WalletPrepareForm(ctx context.Context, renterAddress types.Address, renterKey types.PrivateKey, renterFunds, hostCollateral types.Currency, hostKey types.PublicKey, hostSettings rhpv2.HostSettings, endHeight uint64) (txns []types.Transaction, err error)
 	WalletPrepareRenew(ctx context.Context, contract types.FileContractRevision, renterAddress types.Address, renterKey types.PrivateKey, renterFunds, newCollateral types.Currency, hostKey types.PublicKey, hostSettings rhpv2.HostSettings, endHeight uint64) ([]types.Transaction, types.Currency, error)
@@ -47,17 +59,21 @@ type Bus interface {
 	HostsForScanning(ctx context.Context, maxLastScan time.Time, offset, limit int) ([]hostdb.HostAddress, error)
 	RecordInteractions(ctx context.Context, interactions []hostdb.Interaction) error
 	RemoveOfflineHosts(ctx context.Context, minRecentScanFailures uint64, maxDowntime time.Duration) (uint64, error)
+	UpdateHostExternalData(ctx context.Context, data map[types.PublicKey]hostdb.ExternalData) error
 
 	// contracts
 	ActiveContracts(ctx context.Context) (contracts []api.ContractMetadata, err error)
+	Contract(ctx context.Context, id types.FileContractID) (api.ContractMetadata, error)
 	AddContract(ctx context.Context, c rhpv2.ContractRevision, totalCost types.Currency, startHeight uint64) (api.ContractMetadata, error)
 	AddRenewedContract(ctx context.Context, c rhpv2.ContractRevision, totalCost types.Currency, startHeight uint64, renewedFrom types.FileContractID) (api.ContractMetadata, error)
 	AncestorContracts(ctx context.Context, id types.FileContractID, minStartHeight uint64) ([]api.ArchivedContract, error)
 	Contracts(ctx context.Context, set string) ([]api.ContractMetadata, error)
 	DeleteContracts(ctx context.Context, ids []types.FileContractID) error
 	SetContractSet(ctx context.Context, set string, contracts []types.FileContractID) error
+	UpdateContractUsability(ctx context.Context, updates []api.ContractUsabilityUpdate) error
 
 	// txpool
+	BroadcastTransaction(ctx context.Context, txns []types.Transaction) error
 	RecommendedFee(ctx context.Context) (types.Currency, error)
 	TransactionPool(ctx context.Context) (txns []types.Transaction, err error)
 
@@ -65,7 +81,36 @@ type Bus interface {
 	ConsensusState(ctx context.Context) (api.ConsensusState, error)
 
 	// objects
-	SlabsForMigration(ctx context.Context, healthCutoff float64, set string, limit int) ([]object.Slab, error)
+	CollectGarbage(ctx context.Context) (api.GCResult, error)
+	EnqueueSlabsForRepair(ctx context.Context, set string, healthCutoff float64) (int, error)
+	ObjectsForAudit(ctx context.Context, limit int, maxSize uint64) ([]string, error)
+	ObjectsForReshard(ctx context.Context, limit int) ([]string, error)
+	RecordObjectAudits(ctx context.Context, results []api.ObjectAuditResult) error
+	RecordRepairResults(ctx context.Context, results []api.RepairResult) error
+	RecordSectorAudits(ctx context.Context, set string, results []api.SectorAuditResult) (int, error)
+	RepairQueue(ctx context.Context, limit int) ([]api.RepairQueueEntry, error)
+	ReshardProgress(ctx context.Context) (api.ReshardProgress, error)
+	SectorsForAudit(ctx context.Context, limit int) ([]api.SectorAudit, error)
+	SlabHealthSummary(ctx context.Context, healthCutoff float64) (api.SlabHealthSummary, error)
+	UpdateSlabMigrations(ctx context.Context, updates []api.SlabMigrationUpdate) error
+
+	// jobs
+	AcquireJob(ctx context.Context, types ...string) (api.Job, error)
+	AddJob(ctx context.Context, typ string, params interface{}) (api.Job, error)
+	Jobs(ctx context.Context, typ, state string, offset, limit int) ([]api.Job, error)
+	UpdateJob(ctx context.Context, id uint, u api.JobUpdate) error
+
+	// scheduled events
+	Events(ctx context.Context, types ...string) (<-chan api.Event, error)
+	ScheduleEvents(ctx context.Context, events []api.ScheduledEvent) error
+
+	// autopilot state
+	AutopilotState(ctx context.Context) (api.AutopilotState, error)
+	UpdateAutopilotState(ctx context.Context, state api.AutopilotState) error
+
+	// alerts
+	RaiseAlert(ctx context.Context, id, severity, msg string) error
+	ResolveAlert(ctx context.Context, id string) error
 
 	// settings
 	UpdateSetting(ctx context.Context, key string, value string) error
@@ -77,13 +122,21 @@ type Worker interface {
 	Account(ctx context.Context, host types.PublicKey) (account api.Account, err error)
 	Accounts(ctx context.Context) (accounts []api.Account, err error)
 	ActiveContracts(ctx context.Context, hostTimeout time.Duration) (api.ContractsResponse, error)
+	AuditObjects(ctx context.Context, paths []string) ([]api.ObjectAuditResult, error)
+	AuditSectors(ctx context.Context, audits []api.SectorAudit) ([]api.SectorAuditResult, error)
+	DeleteOrphanedSectors(ctx context.Context, limit int) (api.DeleteSectorsResponse, error)
 	ID(ctx context.Context) (string, error)
 	MigrateSlab(ctx context.Context, s object.Slab) error
+	RHPContractBroadcast(ctx context.Context, fcid types.FileContractID) (api.ContractBroadcast, error)
+	RHPContractPrunable(ctx context.Context, fcid types.FileContractID) (api.RHPContractPrunableResponse, error)
+	RHPContractPrune(ctx context.Context, fcid types.FileContractID) (api.RHPContractPruneResponse, error)
 	RHPForm(ctx context.Context, endHeight uint64, hk types.PublicKey, hostIP string, renterAddress types.Address, renterFunds types.Currency, hostCollateral types.Currency) (rhpv2.ContractRevision, []types.Transaction, error)
 	RHPFund(ctx context.Context, contractID types.FileContractID, hostKey types.PublicKey, amount types.Currency) (err error)
+	RHPPrewarm(ctx context.Context, hostKeys []types.PublicKey) (api.RHPPrewarmResponse, error)
 	RHPPriceTable(ctx context.Context, hostKey types.PublicKey, siamuxAddr string) (rhpv3.HostPriceTable, error)
 	RHPRenew(ctx context.Context, fcid types.FileContractID, endHeight uint64, hk types.PublicKey, hostIP string, renterAddress types.Address, renterFunds, newCollateral types.Currency) (rhpv2.ContractRevision, []types.Transaction, error)
 	RHPScan(ctx context.Context, hostKey types.PublicKey, hostIP string, timeout time.Duration) (api.RHPScanResponse, error)
+	ReshardObject(ctx context.Context, key string) error
 }
 
 type Autopilot struct {
@@ -93,14 +146,26 @@ type Autopilot struct {
 	store   Store
 	workers *workerPool
 
-	a *accounts
-	c *contractor
-	m *migrator
-	s *scanner
+	a  *accounts
+	au *auditor
+	b  *broadcaster
+	c  *contractor
+	d  *defragmenter
+	h  *hostDataFetcher
+	m  *migrator
+	p  *pruner
+	r  *resharder
+	s  *scanner
 
 	tickerDuration time.Duration
 	wg             sync.WaitGroup
 
+	// the state persisted in the bus, it's loaded in the first iteration
+	stateMu     sync.Mutex
+	stateStore  stateStore
+	stateLoaded bool
+	persisted   api.AutopilotState
+
 	startStopMu sync.Mutex
 	running     bool
 	ticker      *time.Ticker
@@ -118,6 +183,10 @@ type loopState struct {
 	rs  api.RedundancySettings
 	gs  api.GougingSettings
 	fee types.Currency
+
+	// now is the time the iteration started, it's used instead of the
+	// current time when scoring hosts so an iteration is reproducible.
+	now time.Time
 }
 
 // workerPool contains all workers known to the autopilot.  Users can call
@@ -167,6 +236,56 @@ func (ap *Autopilot) SetConfig(c api.AutopilotConfig) error {
 	return ap.store.SetConfig(c)
 }
 
+// loadState loads the state the autopilot persisted in the bus and resumes
+// from it, it's a no-op once the state was loaded.
+func (ap *Autopilot) loadState(ctx context.Context) error {
+	ap.stateMu.Lock()
+	loaded := ap.stateLoaded
+	ap.stateMu.Unlock()
+	if loaded {
+		return nil
+	}
+
+	state, err := ap.stateStore.AutopilotState(ctx)
+	if err != nil {
+		return err
+	}
+	ap.stateMu.Lock()
+	ap.persisted = state
+	ap.stateLoaded = true
+	ap.stateMu.Unlock()
+
+	ap.c.mu.Lock()
+	if ap.c.currPeriod == 0 {
+		ap.c.currPeriod = state.CurrentPeriod
+	}
+	ap.c.mu.Unlock()
+	ap.s.mu.Lock()
+	ap.s.scanningLastStart = state.LastScan
+	ap.s.mu.Unlock()
+	return nil
+}
+
+// persistedState returns the autopilot's persisted state.
+func (ap *Autopilot) persistedState() api.AutopilotState {
+	ap.stateMu.Lock()
+	defer ap.stateMu.Unlock()
+	return ap.persisted
+}
+
+// updateState applies the given update to the autopilot's persisted state.
+func (ap *Autopilot) updateState(update func(s *api.AutopilotState)) {
+	ap.stateMu.Lock()
+	defer ap.stateMu.Unlock()
+	update(&ap.persisted)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := ap.stateStore.UpdateAutopilotState(ctx, ap.persisted); err != nil {
+		ap.logger.Errorf("failed to persist autopilot state, err: %v", err)
+	}
+}
+
 func (ap *Autopilot) Run() error {
 	ap.startStopMu.Lock()
 	if ap.running {
@@ -180,6 +299,7 @@ func (ap *Autopilot) Run() error {
 
 	ap.wg.Add(1)
 	defer ap.wg.Done()
+	go ap.handleScheduledEvents(ap.stopChan)
 	ap.startStopMu.Unlock()
 
 	// update the contract set setting
@@ -214,6 +334,12 @@ func (ap *Autopilot) Run() error {
 			span.SetAttributes(attribute.String("worker", workerID))
 			ap.logger.Infof("using worker %s for iteration", workerID)
 
+			// resume from the state persisted in the bus
+			if err := ap.loadState(ctx); err != nil {
+				ap.logger.Errorf("failed to load autopilot state, err: %v", err)
+				return
+			}
+
 			// update the loop state
 			//
 			// NOTE: it is important this is the first action we perform in this
@@ -236,6 +362,9 @@ func (ap *Autopilot) Run() error {
 			ap.s.tryUpdateTimeout()
 			ap.s.tryPerformHostScan(ctx, w)
 
+			// pull the hosts' data from the external host-data provider
+			ap.h.tryFetchHostData()
+
 			// do not continue if we are not synced
 			if !ap.isSynced() {
 				ap.logger.Debug("iteration interrupted, consensus not synced")
@@ -251,12 +380,18 @@ func (ap *Autopilot) Run() error {
 				ap.logger.Errorf("wallet maintenance failed, err: %v", err)
 			}
 
+			// consolidate the wallet's outputs
+			ap.d.performWalletDefrag(ctx)
+
 			// perform maintenance
 			err = ap.c.performContractMaintenance(ctx, w)
 			if err != nil {
 				ap.logger.Errorf("contract maintenance failed, err: %v", err)
 			}
 			maintenanceSuccess := err == nil
+			if maintenanceSuccess {
+				ap.updateState(func(s *api.AutopilotState) { s.LastMaintenance = time.Now() })
+			}
 
 			// launch account refills after successful contract maintenance.
 			if maintenanceSuccess {
@@ -269,12 +404,51 @@ func (ap *Autopilot) Run() error {
 				ap.logger.Errorf("contract maintenance failed, err: %v", err)
 			}
 
+			// schedule the revision broadcasts and renewals of the contracts
+			ap.scheduleContractEvents(ctx)
+
 			// migration
 			ap.m.tryPerformMigrations(ctx, w)
+
+			// convert objects to the current redundancy settings
+			ap.r.tryPerformResharding(ctx, w)
+
+			// audit a sample of sectors
+			ap.au.tryPerformAudits(ctx, w)
+
+			// garbage collection
+			ap.performGarbageCollection(ctx, w)
+
+			// delete unreferenced sectors from the hosts
+			ap.p.tryPerformPruning(ctx, w)
 		})
 	}
 }
 
+// performGarbageCollection prunes slabs and sectors that are no longer
+// referenced and has the worker delete the pruned sectors from their hosts.
+func (ap *Autopilot) performGarbageCollection(ctx context.Context, w Worker) {
+	res, err := ap.bus.CollectGarbage(ctx)
+	if err != nil {
+		ap.logger.Errorf("garbage collection failed, err: %v", err)
+		return
+	} else if res.Sectors > 0 {
+		ap.logger.Infof("pruned %d slabs and %d sectors, reclaiming %d bytes", res.Slabs, res.Sectors, res.ReclaimedBytes)
+	}
+
+	resp, err := w.DeleteOrphanedSectors(ctx, sectorDeletionBatchSize)
+	if err != nil {
+		ap.logger.Errorf("failed to delete orphaned sectors, err: %v", err)
+		return
+	}
+	for _, err := range resp.Errors {
+		ap.logger.Debugf("failed to delete orphaned sectors, err: %v", err)
+	}
+	if resp.Deleted > 0 {
+		ap.logger.Infof("deleted %d orphaned sectors from hosts, reclaimed %d bytes", resp.Deleted, resp.ReclaimedBytes)
+	}
+}
+
 // Shutdown shuts down the autopilot.
 func (ap *Autopilot) Shutdown(_ context.Context) error {
 	ap.startStopMu.Lock()
@@ -293,6 +467,9 @@ func (ap *Autopilot) Shutdown(_ context.Context) error {
 func (ap *Autopilot) Trigger() bool {
 	ap.startStopMu.Lock()
 	defer ap.startStopMu.Unlock()
+	if !ap.running {
+		return false
+	}
 
 	select {
 	case ap.triggerChan <- struct{}{}:
@@ -303,42 +480,52 @@ func (ap *Autopilot) Trigger() bool {
 }
 
 func (ap *Autopilot) updateLoopState(ctx context.Context) error {
+	state, err := ap.fetchLoopState(ctx)
+	if err != nil {
+		return err
+	}
+	ap.state = state
+	return nil
+}
+
+// fetchLoopState fetches the state used by an iteration of the autopilot's
+// loop.
+func (ap *Autopilot) fetchLoopState(ctx context.Context) (loopState, error) {
 	// fetch the current config
 	cfg := ap.store.Config()
 
 	// fetch consensus state
 	cs, err := ap.bus.ConsensusState(ctx)
 	if err != nil {
-		return fmt.Errorf("could not fetch consensus state, err: %v", err)
+		return loopState{}, fmt.Errorf("could not fetch consensus state, err: %v", err)
 	}
 
 	// fetch redundancy settings
 	rs, err := ap.bus.RedundancySettings(ctx)
 	if err != nil {
-		return fmt.Errorf("could not fetch redundancy settings, err: %v", err)
+		return loopState{}, fmt.Errorf("could not fetch redundancy settings, err: %v", err)
 	}
 
 	// fetch gouging settings
 	gs, err := ap.bus.GougingSettings(ctx)
 	if err != nil {
-		return fmt.Errorf("could not fetch gouging settings, err: %v", err)
+		return loopState{}, fmt.Errorf("could not fetch gouging settings, err: %v", err)
 	}
 
 	// fetch recommended transaction fee
 	fee, err := ap.bus.RecommendedFee(ctx)
 	if err != nil {
-		return fmt.Errorf("could not fetch fee, err: %v", err)
+		return loopState{}, fmt.Errorf("could not fetch fee, err: %v", err)
 	}
 
-	// update the loop state
-	ap.state = loopState{
+	return loopState{
 		cfg: cfg,
 		cs:  cs,
 		rs:  rs,
 		gs:  gs,
 		fee: fee,
-	}
-	return nil
+		now: time.Now(),
+	}, nil
 }
 
 func (ap *Autopilot) isSynced() bool {
@@ -372,29 +559,129 @@ func (ap *Autopilot) configHandlerPUT(jc jape.Context) {
 	if jc.Decode(&c) != nil {
 		return
 	}
+	if err := c.Validate(); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+
+	// the autopilot has to form enough contracts to upload all shards of a
+	// slab
+	rs, err := ap.bus.RedundancySettings(jc.Request.Context())
+	if jc.Check("failed to fetch redundancy settings", err) != nil {
+		return
+	} else if c.Contracts.Amount > 0 && c.Contracts.Amount < uint64(rs.TotalShards) {
+		jc.Error(fmt.Errorf("%w: contract amount %v is lower than the %v total shards", api.ErrInsufficientContracts, c.Contracts.Amount, rs.TotalShards), http.StatusBadRequest)
+		return
+	}
 	if jc.Check("failed to set config", ap.SetConfig(c)) != nil {
 		return
 	}
 	ap.Trigger() // trigger the autopilot loop
 }
 
+func (ap *Autopilot) candidatesHandlerGET(jc jape.Context) {
+	n := 50
+	if jc.DecodeForm("n", &n) != nil {
+		return
+	} else if n <= 0 {
+		jc.Error(errors.New("n has to be greater than zero"), http.StatusBadRequest)
+		return
+	}
+
+	ctx := jc.Request.Context()
+	state, err := ap.fetchLoopState(ctx)
+	if jc.Check("failed to fetch autopilot state", err) != nil {
+		return
+	}
+	hosts, err := ap.bus.Hosts(ctx, 0, -1)
+	if jc.Check("failed to fetch hosts", err) != nil {
+		return
+	}
+	contracts, err := ap.bus.ActiveContracts(ctx)
+	if jc.Check("failed to fetch contracts", err) != nil {
+		return
+	}
+
+	// hosts we already have a contract with aren't candidates
+	exclude := make(map[types.PublicKey]struct{})
+	for _, c := range contracts {
+		exclude[c.HostKey] = struct{}{}
+	}
+	jc.Encode(ap.c.rankCandidateHosts(state, hosts, exclude, n))
+}
+
 func (ap *Autopilot) statusHandlerGET(jc jape.Context) {
+	committed, remaining := ap.c.allowanceStatus()
 	jc.Encode(api.AutopilotStatusResponseGET{
-		CurrentPeriod: ap.c.currentPeriod(),
+		AutopilotState:     ap.persistedState(),
+		CommittedFunds:     committed,
+		RemainingAllowance: remaining,
+		Scanner:            ap.s.status(ap.Config()),
+	})
+}
+
+func (ap *Autopilot) healthHandlerGET(jc jape.Context) {
+	ctx := jc.Request.Context()
+	results := make(map[string]error)
+	results["running"] = func() error {
+		ap.startStopMu.Lock()
+		defer ap.startStopMu.Unlock()
+		if !ap.running {
+			return errors.New("autopilot is not running")
+		}
+		return nil
+	}()
+	cs, err := ap.bus.ConsensusState(ctx)
+	results["bus"] = err
+	if err == nil {
+		results["consensus"] = nil
+		if !cs.Synced {
+			results["consensus"] = errors.New("consensus is not synced")
+		}
+	}
+	ap.workers.withWorkers(func(workers []Worker) {
+		var unreachable int
+		for _, w := range workers {
+			if _, err := w.ID(ctx); err != nil {
+				unreachable++
+			}
+		}
+		results["workers"] = nil
+		if unreachable > 0 {
+			results["workers"] = fmt.Errorf("%v/%v workers are unreachable", unreachable, len(workers))
+		}
 	})
+
+	resp := api.NewHealthResponse(results)
+	if !resp.OK {
+		jc.ResponseWriter.Header().Set("Content-Type", "application/json")
+		jc.ResponseWriter.WriteHeader(http.StatusServiceUnavailable)
+	}
+	jc.Encode(resp)
+}
+
+func (ap *Autopilot) walletDefragHandlerGET(jc jape.Context) {
+	run := ap.d.LastRun()
+	if run == nil {
+		jc.Error(errNoDefragRun, http.StatusNotFound)
+		return
+	}
+	jc.Encode(run)
 }
 
 func (ap *Autopilot) triggerHandlerPOST(jc jape.Context) {
 	jc.Encode(fmt.Sprintf("triggered: %t", ap.Trigger()))
 }
 
-// New initializes an Autopilot.
-func New(store Store, bus Bus, workers []Worker, logger *zap.Logger, heartbeat time.Duration, scannerScanInterval time.Duration, scannerBatchSize, scannerNumThreads uint64, migrationHealthCutoff float64, accountsRefillInterval time.Duration) (*Autopilot, error) {
+// New initializes an Autopilot. The host-data provider is optional, no
+// external host data is fetched if it's nil.
+func New(store Store, bus Bus, workers []Worker, logger *zap.Logger, heartbeat time.Duration, scannerScanInterval time.Duration, scannerBatchSize, scannerNumThreads uint64, migrationHealthCutoff float64, accountsRefillInterval time.Duration, hostDataProvider HostDataProvider) (*Autopilot, error) {
 	ap := &Autopilot{
-		bus:     bus,
-		logger:  logger.Sugar().Named("autopilot"),
-		store:   store,
-		workers: newWorkerPool(workers),
+		bus:        bus,
+		logger:     logger.Sugar().Named("autopilot"),
+		store:      store,
+		stateStore: bus,
+		workers:    newWorkerPool(workers),
 
 		tickerDuration: heartbeat,
 	}
@@ -414,6 +701,12 @@ func New(store Store, bus Bus, workers []Worker, logger *zap.Logger, heartbeat t
 	ap.s = scanner
 	ap.c = newContractor(ap)
 	ap.m = newMigrator(ap, migrationHealthCutoff)
+	ap.r = newResharder(ap)
+	ap.au = newAuditor(ap)
+	ap.d = newDefragmenter(ap)
+	ap.h = newHostDataFetcher(ap, hostDataProvider)
+	ap.p = newPruner(ap)
+	ap.b = newBroadcaster(ap)
 
 	return ap, nil
 }
@@ -421,10 +714,14 @@ func New(store Store, bus Bus, workers []Worker, logger *zap.Logger, heartbeat t
 // Handler returns an HTTP handler that serves the autopilot api.
 func (ap *Autopilot) Handler() http.Handler {
 	return jape.Mux(tracing.TracedRoutes("autopilot", map[string]jape.Handler{
-		"GET    /actions": ap.actionsHandler,
-		"GET    /config":  ap.configHandlerGET,
-		"PUT    /config":  ap.configHandlerPUT,
-		"GET    /status":  ap.statusHandlerGET,
+		"GET    /actions":    ap.actionsHandler,
+		"GET    /candidates": ap.candidatesHandlerGET,
+		"GET    /config":     ap.configHandlerGET,
+		"PUT    /config":     ap.configHandlerPUT,
+		"GET    /health":     ap.healthHandlerGET,
+		"GET    /status":     ap.statusHandlerGET,
+
+		"GET    /wallet/defrag": ap.walletDefragHandlerGET,
 
 		"POST    /debug/trigger": ap.triggerHandlerPOST,
 	}))
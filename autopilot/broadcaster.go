@@ -0,0 +1,127 @@
+package autopilot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/internal/tracing"
+	"go.uber.org/zap"
+)
+
+const (
+	// revisionBroadcastLeeway is the number of blocks before a contract's
+	// proof window opens at which its latest revision is broadcast.
+	revisionBroadcastLeeway = 6
+
+	// revisionRebroadcastInterval is the number of blocks after which a
+	// broadcast revision that didn't make it on chain is broadcast again.
+	revisionRebroadcastInterval = 3
+)
+
+// A broadcaster broadcasts the latest signed revision of every contract right
+// before its proof window opens, so hosts can't submit a stale revision. The
+// broadcasts are scheduled with the bus, which notifies the autopilot once
+// they are due.
+type broadcaster struct {
+	ap     *Autopilot
+	logger *zap.SugaredLogger
+}
+
+func newBroadcaster(ap *Autopilot) *broadcaster {
+	return &broadcaster{
+		ap:     ap,
+		logger: ap.logger.Named("broadcaster"),
+	}
+}
+
+// revisionBroadcastKey is the key of the event scheduled for the revision
+// broadcast of a contract.
+func revisionBroadcastKey(id types.FileContractID) string {
+	return fmt.Sprintf("revision_broadcast_%v", id)
+}
+
+// revisionBroadcastEvent returns the event that notifies the autopilot that
+// the revision of the contract has to be broadcast at the given height.
+func revisionBroadcastEvent(id types.FileContractID, height uint64) api.ScheduledEvent {
+	data, err := json.Marshal(api.EventContractDueData{ContractID: id})
+	if err != nil {
+		panic(err) // should never happen
+	}
+	return api.ScheduledEvent{
+		Key:    revisionBroadcastKey(id),
+		Height: height,
+		Type:   api.EventRevisionBroadcastDue,
+		Data:   data,
+	}
+}
+
+// revisionBroadcastEvents returns the revision broadcast events of the
+// contracts whose proof window didn't open yet. The broadcast is due once the
+// proof window is about to open, or at the next height if it's about to open
+// already.
+func revisionBroadcastEvents(contracts []api.ContractMetadata, bh uint64) (events []api.ScheduledEvent) {
+	for _, c := range contracts {
+		if bh+1 >= c.WindowStart {
+			continue
+		}
+		height := bh + 1
+		if c.WindowStart > revisionBroadcastLeeway && c.WindowStart-revisionBroadcastLeeway > height {
+			height = c.WindowStart - revisionBroadcastLeeway
+		}
+		events = append(events, revisionBroadcastEvent(c.ID, height))
+	}
+	return
+}
+
+// broadcastRevision broadcasts the latest revision of the contract if it
+// needs to be broadcast. Until the proof window opens the broadcast is
+// scheduled again for the next height, so revisions that were revised since or
+// didn't make it on chain are broadcast again.
+func (b *broadcaster) broadcastRevision(ctx context.Context, w Worker, fcid types.FileContractID) {
+	ctx, span := tracing.Tracer.Start(ctx, "broadcaster.broadcastRevision")
+	defer span.End()
+
+	cs, err := b.ap.bus.ConsensusState(ctx)
+	if err != nil {
+		b.logger.Errorf("failed to fetch consensus state, err: %v", err)
+		return
+	}
+	c, err := b.ap.bus.Contract(ctx, fcid)
+	if err != nil {
+		b.logger.Debugw("skipping revision broadcast of contract that isn't active", "fcid", fcid, "err", err)
+		return
+	}
+
+	bh := cs.BlockHeight
+	if cs.Synced && needsRevisionBroadcast(c, bh) {
+		cb, err := w.RHPContractBroadcast(ctx, c.ID)
+		if err != nil {
+			b.logger.Errorw("failed to broadcast contract revision", "fcid", c.ID, "hk", c.HostKey, "err", err)
+		} else {
+			b.logger.Debugw("broadcast contract revision", "fcid", c.ID, "revision", cb.RevisionNumber, "txn", cb.TransactionID)
+		}
+	}
+	if bh+1 < c.WindowStart {
+		if err := b.ap.bus.ScheduleEvents(ctx, []api.ScheduledEvent{revisionBroadcastEvent(c.ID, bh+1)}); err != nil {
+			b.logger.Errorw("failed to schedule revision broadcast", "fcid", c.ID, "err", err)
+		}
+	}
+}
+
+// needsRevisionBroadcast returns whether the latest revision of the contract
+// should be broadcast at the given height. Revisions are broadcast once the
+// proof window is about to open, again if the contract was revised since and
+// again if the broadcast revision didn't make it on chain.
+func needsRevisionBroadcast(c api.ContractMetadata, bh uint64) bool {
+	if bh >= c.WindowStart || bh+revisionBroadcastLeeway < c.WindowStart {
+		return false
+	} else if c.Broadcast == nil {
+		return true
+	} else if c.LatestRevisionNumber > c.Broadcast.RevisionNumber {
+		return true
+	}
+	return c.RevisionNumber < c.Broadcast.RevisionNumber && bh >= c.Broadcast.Height+revisionRebroadcastInterval
+}
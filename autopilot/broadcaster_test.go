@@ -0,0 +1,73 @@
+package autopilot
+
+import (
+	"encoding/json"
+	"testing"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+func TestNeedsRevisionBroadcast(t *testing.T) {
+	c := api.ContractMetadata{WindowStart: 100, RevisionNumber: 5, LatestRevisionNumber: 10}
+
+	// not yet within the leeway, or the proof window already opened
+	if needsRevisionBroadcast(c, 100-revisionBroadcastLeeway-1) || needsRevisionBroadcast(c, 100) {
+		t.Fatal("unexpected broadcast")
+	}
+
+	// within the leeway the revision is broadcast
+	if !needsRevisionBroadcast(c, 100-revisionBroadcastLeeway) {
+		t.Fatal("expected broadcast")
+	}
+
+	// once it was broadcast it's only broadcast again if it didn't make it
+	// on chain in time
+	c.Broadcast = &api.ContractBroadcast{RevisionNumber: 10, Height: 95}
+	if needsRevisionBroadcast(c, 95+revisionRebroadcastInterval-1) {
+		t.Fatal("unexpected broadcast")
+	} else if !needsRevisionBroadcast(c, 95+revisionRebroadcastInterval) {
+		t.Fatal("expected broadcast")
+	}
+	c.RevisionNumber = 10
+	if needsRevisionBroadcast(c, 95+revisionRebroadcastInterval) {
+		t.Fatal("unexpected broadcast")
+	}
+
+	// or if the contract was revised after the broadcast
+	c.LatestRevisionNumber = 11
+	if !needsRevisionBroadcast(c, 95+revisionRebroadcastInterval-1) {
+		t.Fatal("expected broadcast")
+	}
+
+	// the newer revision is broadcast once it's on chain
+	c.Broadcast = &api.ContractBroadcast{RevisionNumber: 11, Height: 96}
+	c.RevisionNumber = 11
+	if needsRevisionBroadcast(c, 99) {
+		t.Fatal("unexpected broadcast")
+	}
+}
+
+func TestRevisionBroadcastEvents(t *testing.T) {
+	contracts := []api.ContractMetadata{
+		{ID: types.FileContractID{1}, WindowStart: 100}, // before the leeway
+		{ID: types.FileContractID{2}, WindowStart: 53},  // within the leeway
+		{ID: types.FileContractID{3}, WindowStart: 51},  // proof window about to open
+		{ID: types.FileContractID{4}, WindowStart: 50},  // proof window open
+	}
+	events := revisionBroadcastEvents(contracts, 50)
+	if len(events) != 2 {
+		t.Fatal("unexpected events", events)
+	} else if events[0].Key != revisionBroadcastKey(contracts[0].ID) || events[0].Height != 100-revisionBroadcastLeeway || events[0].Type != api.EventRevisionBroadcastDue {
+		t.Fatal("unexpected event", events[0])
+	} else if events[1].Key != revisionBroadcastKey(contracts[1].ID) || events[1].Height != 51 {
+		t.Fatal("unexpected event", events[1])
+	}
+
+	var data api.EventContractDueData
+	if err := json.Unmarshal(events[0].Data, &data); err != nil {
+		t.Fatal(err)
+	} else if data.ContractID != contracts[0].ID {
+		t.Fatal("unexpected data", data)
+	}
+}
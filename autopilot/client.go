@@ -1,6 +1,8 @@
 package autopilot
 
 import (
+	"fmt"
+
 	"go.sia.tech/jape"
 	"go.sia.tech/renterd/api"
 )
@@ -33,12 +35,32 @@ func (c *Client) Config() (cfg api.AutopilotConfig, err error) {
 	return
 }
 
+// Candidates returns the n hosts with the highest score the autopilot would
+// currently consider forming a contract with.
+func (c *Client) Candidates(n int) (candidates []api.CandidateHost, err error) {
+	err = c.c.GET(fmt.Sprintf("/candidates?n=%d", n), &candidates)
+	return
+}
+
+// Health runs the autopilot's health checks, an error is returned if any of
+// them fails.
+func (c *Client) Health() (resp api.HealthResponse, err error) {
+	err = c.c.GET("/health", &resp)
+	return
+}
+
 func (c *Client) Status() (uint64, error) {
 	var resp api.AutopilotStatusResponseGET
 	err := c.c.GET("/status", &resp)
 	return resp.CurrentPeriod, err
 }
 
+// LastDefrag returns the last run of the wallet defragmentation.
+func (c *Client) LastDefrag() (run api.WalletDefragRun, err error) {
+	err = c.c.GET("/wallet/defrag", &run)
+	return
+}
+
 func (c *Client) Trigger() (res string, err error) {
 	err = c.c.POST("/debug/trigger", nil, &res)
 	return
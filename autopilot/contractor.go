@@ -21,6 +21,7 @@ import (
 	"go.sia.tech/renterd/wallet"
 	"go.sia.tech/renterd/worker"
 	"go.uber.org/zap"
+	"lukechampine.com/frand"
 )
 
 const (
@@ -56,8 +57,17 @@ const (
 	// score found in a random sample of scores before being considered not
 	// usable.
 	minAllowedScoreLeeway = 500
+
+	// alertAllowanceExhaustedID is the ID of the alert that's raised when
+	// the allowance of the current period doesn't cover the contracts that
+	// need to be formed, renewed or refreshed.
+	alertAllowanceExhaustedID = "allowance_exhausted"
 )
 
+// errInsufficientBudget is returned when the remaining allowance doesn't cover
+// the funds of a contract that's being formed, renewed or refreshed.
+var errInsufficientBudget = errors.New("insufficient budget")
+
 type (
 	contractor struct {
 		ap     *Autopilot
@@ -65,8 +75,17 @@ type (
 
 		maintenanceTxnID types.TransactionID
 
+		// rng is used to select candidate hosts weighted by their score.
+		rng *frand.RNG
+
 		mu         sync.Mutex
 		currPeriod uint64
+		committed  types.Currency
+		remaining  types.Currency
+
+		// gougingSince keeps track of when we first noticed hosts we have a
+		// contract with exceeding the gouging limits.
+		gougingSince map[types.PublicKey]time.Time
 	}
 
 	contractInfo struct {
@@ -79,6 +98,9 @@ func newContractor(ap *Autopilot) *contractor {
 	return &contractor{
 		ap:     ap,
 		logger: ap.logger.Named("contractor"),
+		rng:    frand.New(),
+
+		gougingSince: make(map[types.PublicKey]time.Time),
 	}
 }
 
@@ -162,15 +184,30 @@ func (c *contractor) performContractMaintenance(ctx context.Context, w Worker) e
 		return err
 	}
 
+	// keep track of whether the allowance was exhausted, in which case we
+	// stop forming contracts and raise an alert
+	var exhausted bool
+	defer func(budget types.Currency) {
+		c.mu.Lock()
+		c.committed = c.committed.Add(budget.Sub(remaining))
+		c.remaining = remaining
+		c.mu.Unlock()
+		c.updateAllowanceAlert(ctx, exhausted)
+	}(remaining)
+
 	// run renewals
 	renewed, err := c.runContractRenewals(ctx, w, &remaining, address, toRenew)
-	if err != nil {
+	if errors.Is(err, errInsufficientBudget) {
+		exhausted = true
+	} else if err != nil {
 		c.logger.Errorf("failed to renew contracts, err: %v", err) // continue
 	}
 
 	// run contract refreshes
 	refreshed, err := c.runContractRefreshes(ctx, w, &remaining, address, toRefresh)
-	if err != nil {
+	if errors.Is(err, errInsufficientBudget) {
+		exhausted = true
+	} else if err != nil {
 		c.logger.Errorf("failed to refresh contracts, err: %v", err) // continue
 	}
 
@@ -180,8 +217,13 @@ func (c *contractor) performContractMaintenance(ctx context.Context, w Worker) e
 
 	// check if we need to form contracts and add them to the contract set
 	var formed []types.FileContractID
-	if numContracts < addLeeway(state.cfg.Contracts.Amount, leewayPctRequiredContracts) {
-		if formed, err = c.runContractFormations(ctx, w, hosts, active, state.cfg.Contracts.Amount-numContracts, &remaining, address, minScore); err != nil {
+	if exhausted {
+		c.logger.Warn("allowance exhausted, skipping contract formations")
+	} else if numContracts < addLeeway(state.cfg.Contracts.Amount, leewayPctRequiredContracts) {
+		formed, err = c.runContractFormations(ctx, w, hosts, active, state.cfg.Contracts.Amount-numContracts, &remaining, address, minScore)
+		if errors.Is(err, errInsufficientBudget) {
+			exhausted = true
+		} else if err != nil {
 			c.logger.Errorf("failed to form contracts, err: %v", err) // continue
 		}
 	}
@@ -242,7 +284,7 @@ func (c *contractor) performWalletMaintenance(ctx context.Context) error {
 	}
 
 	// enough outputs - nothing to do
-	outputs, err := b.WalletOutputs(ctx)
+	outputs, err := b.WalletSpendableOutputs(ctx)
 	if err != nil {
 		return err
 	}
@@ -292,8 +334,9 @@ func (c *contractor) runContractChecks(ctx context.Context, w Worker, contracts
 		)
 	}()
 
-	// create a new ip filter
+	// create a new ip filter and group filter
 	f := newIPFilter(c.logger)
+	g := newGroupFilter(c.ap.state.cfg.Hosts.MaxContractsPerGroup, c.logger)
 
 	// convenience variables
 	state := c.ap.state
@@ -303,6 +346,22 @@ func (c *contractor) runContractChecks(ctx context.Context, w Worker, contracts
 	contractSizes := make(map[types.FileContractID]uint64)
 	contractMap := make(map[types.FileContractID]api.ContractMetadata)
 	renewIndices := make(map[types.FileContractID]int)
+	usability := make(map[types.FileContractID]api.ContractUsability)
+
+	// persist the usability flags, the worker only uploads to contracts that
+	// are good for upload
+	defer func() {
+		if len(usability) == 0 {
+			return
+		}
+		updates := make([]api.ContractUsabilityUpdate, 0, len(usability))
+		for fcid, u := range usability {
+			updates = append(updates, api.ContractUsabilityUpdate{ContractID: fcid, ContractUsability: u})
+		}
+		if err := c.ap.bus.UpdateContractUsability(ctx, updates); err != nil {
+			c.logger.Errorf("failed to update contract usability, err: %v", err)
+		}
+	}()
 
 	// check every active contract
 	for _, contract := range contracts {
@@ -322,6 +381,7 @@ func (c *contractor) runContractChecks(ctx context.Context, w Worker, contracts
 		if host.Blocked {
 			c.logger.Infow("blocked host", "hk", hk, "fcid", fcid, "reasons", errHostBlocked.Error())
 			toIgnore = append(toIgnore, fcid)
+			usability[fcid] = api.ContractUsability{}
 			continue
 		}
 
@@ -334,11 +394,26 @@ func (c *contractor) runContractChecks(ctx context.Context, w Worker, contracts
 		}
 		host.PriceTable = &pt
 
-		// decide whether the host is still good
-		usable, reasons := isUsableHost(state.cfg, state.gs, state.rs, state.cs, f, host.Host, minScore, contract.FileSize(), state.fee, false)
-		if !usable {
+		// decide whether the host is still good, we're more lenient with
+		// the gouging limits to avoid churn on transient price spikes
+		gs := relaxGougingSettings(state.gs, state.cfg.Hosts.GougingLeewayPct)
+		usable, reasons := isUsableHost(state.cfg, gs, state.rs, state.cs, f, host.Host, minScore, contract.FileSize(), state.fee, false, state.now)
+		if grace := c.inGougingGracePeriod(state.cfg, hk, reasons, state.now); !usable && grace {
+			c.logger.Infow("host exceeds gouging limits, keeping contract during grace period", "hk", hk, "fcid", fcid, "reasons", errStr(joinErrors(reasons)))
+			usability[fcid] = api.ContractUsability{}
+			contractIds = append(contractIds, fcid)
+			contractMap[fcid] = contract.ContractMetadata
+			contractSizes[fcid] = contract.FileSize()
+			continue
+		} else if !usable {
 			c.logger.Infow("unusable host", "hk", hk, "fcid", fcid, "reasons", errStr(joinErrors(reasons)))
 			toIgnore = append(toIgnore, fcid)
+			usability[fcid] = api.ContractUsability{}
+			continue
+		} else if g.exceedsLimit(host.Host) {
+			c.logger.Infow("unusable host", "hk", hk, "fcid", fcid, "reasons", errHostGroupLimit.Error())
+			toIgnore = append(toIgnore, fcid)
+			usability[fcid] = api.ContractUsability{}
 			continue
 		}
 
@@ -376,9 +451,11 @@ func (c *contractor) runContractChecks(ctx context.Context, w Worker, contracts
 				})
 			} else {
 				toDelete = append(toDelete, fcid)
+				usability[fcid] = api.ContractUsability{}
 				continue
 			}
 		}
+		usability[fcid] = api.ContractUsability{GoodForUpload: usable, GoodForRenew: true}
 
 		// keep track of file size
 		contractIds = append(contractIds, fcid)
@@ -397,11 +474,9 @@ func (c *contractor) runContractChecks(ctx context.Context, w Worker, contracts
 		// remove superfluous contract from renewal list and add to ignore list
 		prev := len(toIgnore)
 		for _, id := range contractIds[:numContractsTooMany] {
-			if index, exists := renewIndices[id]; exists {
-				toRenew[index] = toRenew[len(toRenew)-1]
-				toRenew = toRenew[:len(toRenew)-1]
-			}
+			toRenew = removeRenewal(toRenew, renewIndices, id)
 			toIgnore = append(toIgnore, contractMap[id].ID)
+			usability[id] = api.ContractUsability{}
 		}
 		c.logger.Debugf("%d contracts too many, added %d smallest contracts to the ignore list", numContractsTooMany, len(toIgnore)-prev)
 	}
@@ -409,6 +484,21 @@ func (c *contractor) runContractChecks(ctx context.Context, w Worker, contracts
 	return toDelete, toIgnore, toRefresh, toRenew, nil
 }
 
+// removeRenewal removes the contract with given id from the renewal list by
+// moving the last contract into its place, the index of the moved contract is
+// updated so it can still be removed.
+func removeRenewal(toRenew []contractInfo, renewIndices map[types.FileContractID]int, id types.FileContractID) []contractInfo {
+	index, exists := renewIndices[id]
+	if !exists {
+		return toRenew
+	}
+	last := toRenew[len(toRenew)-1]
+	toRenew[index] = last
+	renewIndices[last.contract.ID] = index
+	delete(renewIndices, id)
+	return toRenew[:len(toRenew)-1]
+}
+
 func (c *contractor) runContractFormations(ctx context.Context, w Worker, hosts []hostdb.Host, active []api.Contract, missing uint64, budget *types.Currency, renterAddress types.Address, minScore float64) ([]types.FileContractID, error) {
 	ctx, span := tracing.Tracer.Start(ctx, "runContractFormations")
 	defer span.End()
@@ -483,7 +573,9 @@ func (c *contractor) runContractFormations(ctx context.Context, w Worker, hosts
 			formed = append(formed, formedContract.ID)
 			missing--
 		}
-		if !proceed {
+		if errors.Is(err, errInsufficientBudget) {
+			return formed, err
+		} else if !proceed {
 			break
 		}
 	}
@@ -510,6 +602,7 @@ func (c *contractor) runContractRenewals(ctx context.Context, w Worker, budget *
 		)
 	}()
 
+	var insufficientBudget bool
 	for _, ci := range toRenew {
 		// TODO: keep track of consecutive failures and break at some point
 
@@ -518,15 +611,23 @@ func (c *contractor) runContractRenewals(ctx context.Context, w Worker, budget *
 			break
 		}
 
+		// skip contracts the remaining budget doesn't cover, renewing
+		// the other contracts might still be affordable
 		contract, proceed, err := c.renewContract(ctx, w, ci, budget, renterAddress)
 		if err == nil {
 			renewed = append(renewed, contract)
+		} else if errors.Is(err, errInsufficientBudget) {
+			insufficientBudget = true
+			continue
 		}
 		if !proceed {
 			break
 		}
 	}
 
+	if insufficientBudget {
+		return renewed, errInsufficientBudget
+	}
 	return renewed, nil
 }
 
@@ -549,6 +650,7 @@ func (c *contractor) runContractRefreshes(ctx context.Context, w Worker, budget
 		)
 	}()
 
+	var insufficientBudget bool
 	for _, ci := range toRefresh {
 		// TODO: keep track of consecutive failures and break at some point
 
@@ -557,15 +659,23 @@ func (c *contractor) runContractRefreshes(ctx context.Context, w Worker, budget
 			break
 		}
 
+		// skip contracts the remaining budget doesn't cover, renewing
+		// the other contracts might still be affordable
 		contract, proceed, err := c.refreshContract(ctx, w, ci, budget, renterAddress)
 		if err == nil {
 			refreshed = append(refreshed, contract)
+		} else if errors.Is(err, errInsufficientBudget) {
+			insufficientBudget = true
+			continue
 		}
 		if !proceed {
 			break
 		}
 	}
 
+	if insufficientBudget {
+		return refreshed, errInsufficientBudget
+	}
 	return refreshed, nil
 }
 
@@ -629,7 +739,7 @@ func (c *contractor) renewFundingEstimate(ctx context.Context, ci contractInfo,
 	//
 	// TODO: estimate is not ideal because price can change, better would be to
 	// look at the amount of data stored in the contract from the previous cycle
-	prevUploadDataEstimate := prevSpending.Uploads
+	prevUploadDataEstimate := prevSpending.Uploads.Add(prevSpending.Storage)
 	if !ci.settings.UploadBandwidthPrice.IsZero() {
 		prevUploadDataEstimate = prevUploadDataEstimate.Div(ci.settings.UploadBandwidthPrice)
 	}
@@ -641,7 +751,7 @@ func (c *contractor) renewFundingEstimate(ctx context.Context, ci contractInfo,
 	// - upload cost: previous uploads + prev storage
 	// - download cost: assumed to be the same
 	// - fund acount cost: assumed to be the same
-	newUploadsCost := prevSpending.Uploads.Add(prevUploadDataEstimate.Mul64(cfg.Contracts.Period).Mul(ci.settings.StoragePrice))
+	newUploadsCost := prevSpending.Uploads.Add(prevSpending.Storage).Add(prevUploadDataEstimate.Mul64(cfg.Contracts.Period).Mul(ci.settings.StoragePrice))
 	newDownloadsCost := prevSpending.Downloads
 	newFundAccountCost := prevSpending.FundAccount
 
@@ -710,7 +820,7 @@ func (c *contractor) managedFindMinAllowedHostScores(ctx context.Context, w Work
 	// good for upload.
 	lowestScore := math.MaxFloat64
 	for i := 0; i < len(hosts); i++ {
-		score := hostScore(c.ap.state.cfg, hosts[i], 0, c.ap.state.rs.Redundancy())
+		score := hostScore(c.ap.state.cfg, hosts[i], 0, c.ap.state.rs.Redundancy(), c.ap.state.now)
 		if score < lowestScore {
 			lowestScore = score
 		}
@@ -726,8 +836,70 @@ func (c *contractor) candidateHosts(ctx context.Context, w Worker, hosts []hostd
 		return nil, nil
 	}
 
-	state := c.ap.state
+	// score all usable hosts
+	scored, scores := c.scoreCandidateHosts(c.ap.state, hosts, exclude, storedData, minScore)
+
+	// create a group filter and add all excluded hosts to it
+	g := newGroupFilter(c.ap.state.cfg.Hosts.MaxContractsPerGroup, c.logger)
+	if g.limit > 0 {
+		for _, h := range hosts {
+			if _, exclude := exclude[h.PublicKey]; exclude {
+				g.exceedsLimit(h)
+			}
+		}
+	}
+
+	// select hosts
+	var selected []hostdb.Host
+	for len(selected) < wanted && len(scored) > 0 {
+		i := randSelectByWeight(c.rng, scores)
+		if !g.exceedsLimit(scored[i]) {
+			selected = append(selected, scored[i])
+		}
+
+		// remove selected host
+		scored[i], scored = scored[len(scored)-1], scored[:len(scored)-1]
+		scores[i], scores = scores[len(scores)-1], scores[:len(scores)-1]
+	}
+
+	if len(selected) < wanted {
+		c.logger.Debugf("could not fetch 'wanted' candidate hosts, %d<%d", len(selected), wanted)
+	}
+	return selected, nil
+}
+
+// rankCandidateHosts returns the n usable hosts with the highest score that
+// aren't excluded.
+// NOTE: contract formations select candidates randomly, weighted by their
+// score, so the ranking is a preview of the most likely selections.
+func (c *contractor) rankCandidateHosts(state loopState, hosts []hostdb.Host, exclude map[types.PublicKey]struct{}, n int) []api.CandidateHost {
+	scored, scores := c.scoreCandidateHosts(state, hosts, exclude, make(map[types.PublicKey]uint64), math.SmallestNonzeroFloat64)
+
+	candidates := make([]api.CandidateHost, len(scored))
+	for i, h := range scored {
+		candidates[i] = api.CandidateHost{
+			HostKey:                h.PublicKey,
+			NetAddress:             h.NetAddress,
+			Score:                  scores[i],
+			ContractPrice:          h.Settings.ContractPrice,
+			StoragePrice:           h.Settings.StoragePrice,
+			UploadBandwidthPrice:   h.Settings.UploadBandwidthPrice,
+			DownloadBandwidthPrice: h.Settings.DownloadBandwidthPrice,
+			Collateral:             h.Settings.Collateral,
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	return candidates
+}
 
+// scoreCandidateHosts returns the usable hosts that aren't excluded along with
+// their scores, hosts that score zero are skipped.
+func (c *contractor) scoreCandidateHosts(state loopState, hosts []hostdb.Host, exclude map[types.PublicKey]struct{}, storedData map[types.PublicKey]uint64, minScore float64) ([]hostdb.Host, []float64) {
 	// create IP filter and add all excluded hosts to it.
 	ipFilter := newIPFilter(c.logger)
 	for _, h := range hosts {
@@ -761,12 +933,12 @@ func (c *contractor) candidateHosts(ctx context.Context, w Worker, hosts []hostd
 		// with a host that's gouging its prices.
 		// NOTE: we ignore the host's blockheight here because we don't
 		// necessarily have a recent price table.
-		if usable, _ := isUsableHost(state.cfg, state.gs, state.rs, state.cs, ipFilter, h, minScore, storedData[h.PublicKey], state.fee, true); !usable {
+		if usable, _ := isUsableHost(state.cfg, state.gs, state.rs, state.cs, ipFilter, h, minScore, storedData[h.PublicKey], state.fee, true, state.now); !usable {
 			unusable++
 			continue
 		}
 
-		score := hostScore(state.cfg, h, 0, state.rs.Redundancy())
+		score := hostScore(state.cfg, h, 0, state.rs.Redundancy(), state.now)
 		if score == 0 {
 			zeros++
 			continue
@@ -780,22 +952,7 @@ func (c *contractor) candidateHosts(ctx context.Context, w Worker, hosts []hostd
 		"excluded", excluded,
 		"unscanned", unscanned,
 		"unusable", unusable)
-
-	// select hosts
-	var selected []hostdb.Host
-	for len(selected) < wanted && len(scored) > 0 {
-		i := randSelectByWeight(scores)
-		selected = append(selected, scored[i])
-
-		// remove selected host
-		scored[i], scored = scored[len(scored)-1], scored[:len(scored)-1]
-		scores[i], scores = scores[len(scores)-1], scores[:len(scores)-1]
-	}
-
-	if len(selected) < wanted {
-		c.logger.Debugf("could not fetch 'wanted' candidate hosts, %d<%d", len(selected), wanted)
-	}
-	return selected, nil
+	return scored, scores
 }
 
 func (c *contractor) renewContract(ctx context.Context, w Worker, ci contractInfo, budget *types.Currency, renterAddress types.Address) (cm api.ContractMetadata, proceed bool, err error) {
@@ -829,12 +986,12 @@ func (c *contractor) renewContract(ctx context.Context, w Worker, ci contractInf
 	// check our budget
 	if budget.Cmp(renterFunds) < 0 {
 		c.logger.Debugw("insufficient budget", "budget", budget, "needed", renterFunds)
-		return api.ContractMetadata{}, false, errors.New("insufficient budget")
+		return api.ContractMetadata{}, false, errInsufficientBudget
 	}
 
 	// calculate the host collateral
 	endHeight := endHeight(cfg, c.currentPeriod())
-	expectedStorage := renterFundsToExpectedStorage(renterFunds, endHeight-cs.BlockHeight, settings)
+	expectedStorage := worker.RenterFundsToExpectedStorage(renterFunds, endHeight-cs.BlockHeight, settings)
 	newCollateral := rhpv2.ContractRenewalCollateral(rev.FileContract, expectedStorage, settings, cs.BlockHeight, endHeight)
 
 	// renew the contract
@@ -898,11 +1055,11 @@ func (c *contractor) refreshContract(ctx context.Context, w Worker, ci contractI
 	// check our budget
 	if budget.Cmp(renterFunds) < 0 {
 		c.logger.Debugw("insufficient budget", "budget", budget, "needed", renterFunds)
-		return api.ContractMetadata{}, false, fmt.Errorf("insufficient budget: %s < %s", budget.String(), renterFunds.String())
+		return api.ContractMetadata{}, false, fmt.Errorf("%w: %s < %s", errInsufficientBudget, budget.String(), renterFunds.String())
 	}
 
 	// calculate the new collateral
-	expectedStorage := renterFundsToExpectedStorage(renterFunds, contract.EndHeight()-cs.BlockHeight, settings)
+	expectedStorage := worker.RenterFundsToExpectedStorage(renterFunds, contract.EndHeight()-cs.BlockHeight, settings)
 	newCollateral := rhpv2.ContractRenewalCollateral(rev.FileContract, expectedStorage, settings, cs.BlockHeight, contract.EndHeight())
 
 	// do not refresh if the contract's updated collateral will fall below the threshold anyway
@@ -970,12 +1127,12 @@ func (c *contractor) formContract(ctx context.Context, w Worker, host hostdb.Hos
 	renterFunds := initialContractFunding(scan.Settings, txnFee, minInitialContractFunds, maxInitialContractFunds)
 	if budget.Cmp(renterFunds) < 0 {
 		c.logger.Debugw("insufficient budget", "budget", budget, "needed", renterFunds)
-		return api.ContractMetadata{}, false, errors.New("insufficient budget")
+		return api.ContractMetadata{}, false, errInsufficientBudget
 	}
 
 	// calculate the host collateral
 	endHeight := endHeight(state.cfg, c.currentPeriod())
-	expectedStorage := renterFundsToExpectedStorage(renterFunds, endHeight-state.cs.BlockHeight, scan.Settings)
+	expectedStorage := worker.RenterFundsToExpectedStorage(renterFunds, endHeight-state.cs.BlockHeight, scan.Settings)
 	hostCollateral := rhpv2.ContractFormationCollateral(state.cfg.Contracts.Period, expectedStorage, scan.Settings)
 
 	// form contract
@@ -1073,6 +1230,60 @@ func initialContractFunding(settings rhpv2.HostSettings, txnFee, min, max types.
 	return funding
 }
 
+// relaxGougingSettings returns the gouging settings with the limits relaxed by
+// the given percentage.
+func relaxGougingSettings(gs api.GougingSettings, pct uint64) api.GougingSettings {
+	if pct == 0 {
+		return gs
+	}
+	relax := func(c types.Currency) types.Currency { return c.Mul64(100 + pct).Div64(100) }
+	gs.MinMaxCollateral = gs.MinMaxCollateral.Mul64(100).Div64(100 + pct)
+	gs.MaxRPCPrice = relax(gs.MaxRPCPrice)
+	gs.MaxContractPrice = relax(gs.MaxContractPrice)
+	gs.MaxDownloadPrice = relax(gs.MaxDownloadPrice)
+	gs.MaxUploadPrice = relax(gs.MaxUploadPrice)
+	gs.MaxStoragePrice = relax(gs.MaxStoragePrice)
+	gs.MaxStoragePricePerPeriod = relax(gs.MaxStoragePricePerPeriod)
+	gs.MaxSectorAccessPrice = relax(gs.MaxSectorAccessPrice)
+	gs.MaxDownloadBandwidthPriceRHPv2 = relax(gs.MaxDownloadBandwidthPriceRHPv2)
+	gs.MaxUploadBandwidthPriceRHPv2 = relax(gs.MaxUploadBandwidthPriceRHPv2)
+	gs.MaxDownloadBandwidthPriceRHPv3 = relax(gs.MaxDownloadBandwidthPriceRHPv3)
+	gs.MaxUploadBandwidthPriceRHPv3 = relax(gs.MaxUploadBandwidthPriceRHPv3)
+	gs.MaxReadBaseCost = relax(gs.MaxReadBaseCost)
+	gs.MaxWriteBaseCost = relax(gs.MaxWriteBaseCost)
+	return gs
+}
+
+// inGougingGracePeriod returns whether a host that's unusable for the given
+// reasons should be given a grace period, which is the case if it's only
+// unusable because it exceeds the gouging limits and it started doing so less
+// than the configured grace period ago.
+// NOTE: the grace period is tracked in memory, it restarts when the autopilot
+// is restarted.
+func (c *contractor) inGougingGracePeriod(cfg api.AutopilotConfig, hk types.PublicKey, reasons []error, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	gouging := len(reasons) > 0
+	for _, reason := range reasons {
+		if !errors.Is(reason, errHostPriceGouging) {
+			gouging = false
+			break
+		}
+	}
+	if !gouging {
+		delete(c.gougingSince, hk)
+		return false
+	}
+
+	since, ok := c.gougingSince[hk]
+	if !ok {
+		since = now
+		c.gougingSince[hk] = since
+	}
+	return now.Sub(since) < time.Duration(cfg.Hosts.GougingGraceHours)*time.Hour
+}
+
 func initialContractFundingMinMax(cfg api.AutopilotConfig) (min types.Currency, max types.Currency) {
 	allowance := cfg.Contracts.Allowance.Div64(cfg.Contracts.Amount)
 	min = allowance.Div64(minInitialContractFundingDivisor)
@@ -1098,19 +1309,3 @@ func contractMapBool(contracts []types.FileContractID) map[types.FileContractID]
 func endHeight(cfg api.AutopilotConfig, currentPeriod uint64) uint64 {
 	return currentPeriod + cfg.Contracts.Period + cfg.Contracts.RenewWindow
 }
-
-// renterFundsToExpectedStorage returns how much storage a renter is expected to
-// be able to afford given the provided 'renterFunds'.
-func renterFundsToExpectedStorage(renterFunds types.Currency, duration uint64, host rhpv2.HostSettings) uint64 {
-	costPerByte := host.UploadBandwidthPrice.Add(host.StoragePrice.Mul64(duration)).Add(host.DownloadBandwidthPrice)
-	// If storage is free, we can afford 'unlimited' data.
-	if costPerByte.IsZero() {
-		return math.MaxUint64
-	}
-	// Catch overflow.
-	expectedStorage := renterFunds.Div(costPerByte)
-	if expectedStorage.Cmp(types.NewCurrency64(math.MaxUint64)) > 0 {
-		return math.MaxUint64
-	}
-	return expectedStorage.Big().Uint64()
-}
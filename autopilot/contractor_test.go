@@ -0,0 +1,74 @@
+package autopilot
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+func TestGougingHysteresis(t *testing.T) {
+	// assert the gouging limits are relaxed by the given percentage
+	gs := api.GougingSettings{
+		MinMaxCollateral: types.Siacoins(110),
+		MaxContractPrice: types.Siacoins(100),
+	}
+	if relaxed := relaxGougingSettings(gs, 10); !relaxed.MaxContractPrice.Equals(types.Siacoins(110)) || !relaxed.MinMaxCollateral.Equals(types.Siacoins(100)) {
+		t.Fatal("unexpected relaxed settings", relaxed)
+	} else if relaxed := relaxGougingSettings(gs, 0); relaxed != gs {
+		t.Fatal("settings shouldn't be relaxed")
+	}
+
+	c := &contractor{gougingSince: make(map[types.PublicKey]time.Time)}
+	cfg := api.DefaultAutopilotConfig()
+	cfg.Hosts.GougingGraceHours = 1
+	hk := types.PublicKey{1}
+	gouging := []error{fmt.Errorf("%w: too expensive", errHostPriceGouging)}
+
+	// a host that's gouging gets a grace period
+	if !c.inGougingGracePeriod(cfg, hk, gouging, time.Now()) {
+		t.Fatal("expected grace period")
+	}
+
+	// a host that's unusable for other reasons doesn't
+	if c.inGougingGracePeriod(cfg, hk, append(gouging, errors.New("offline")), time.Now()) {
+		t.Fatal("unexpected grace period")
+	} else if _, ok := c.gougingSince[hk]; ok {
+		t.Fatal("expected grace period to be reset")
+	}
+
+	// the grace period expires
+	c.gougingSince[hk] = time.Now().Add(-2 * time.Hour)
+	if c.inGougingGracePeriod(cfg, hk, gouging, time.Now()) {
+		t.Fatal("expected grace period to be expired")
+	}
+
+	// once the host is usable again the grace period is reset
+	c.inGougingGracePeriod(cfg, hk, nil, time.Now())
+	if !c.inGougingGracePeriod(cfg, hk, gouging, time.Now()) {
+		t.Fatal("expected new grace period")
+	}
+}
+
+func TestRemoveRenewal(t *testing.T) {
+	var toRenew []contractInfo
+	renewIndices := make(map[types.FileContractID]int)
+	for i := 1; i <= 3; i++ {
+		renewIndices[types.FileContractID{byte(i)}] = len(toRenew)
+		toRenew = append(toRenew, contractInfo{contract: api.Contract{ContractMetadata: api.ContractMetadata{ID: types.FileContractID{byte(i)}}}})
+	}
+
+	// removing the first contract moves the last one into its place, which
+	// then has to be removable as well
+	toRenew = removeRenewal(toRenew, renewIndices, types.FileContractID{1})
+	toRenew = removeRenewal(toRenew, renewIndices, types.FileContractID{3})
+	toRenew = removeRenewal(toRenew, renewIndices, types.FileContractID{4})
+	if len(toRenew) != 1 || toRenew[0].contract.ID != (types.FileContractID{2}) {
+		t.Fatal("unexpected renewals", toRenew)
+	} else if len(renewIndices) != 1 || renewIndices[types.FileContractID{2}] != 0 {
+		t.Fatal("unexpected indices", renewIndices)
+	}
+}
@@ -2,6 +2,7 @@ package autopilot
 
 import (
 	"context"
+	"fmt"
 
 	"go.sia.tech/core/types"
 	"go.sia.tech/renterd/api"
@@ -16,10 +17,12 @@ func (c *contractor) currentPeriod() uint64 {
 func (c *contractor) updateCurrentPeriod() {
 	c.mu.Lock()
 	defer func(prevPeriod uint64) {
-		if c.currPeriod != prevPeriod {
-			c.logger.Debugf("updated current period, %d->%d", prevPeriod, c.currPeriod)
-		}
+		currPeriod := c.currPeriod
 		c.mu.Unlock()
+		if currPeriod != prevPeriod {
+			c.logger.Debugf("updated current period, %d->%d", prevPeriod, currPeriod)
+			c.ap.updateState(func(s *api.AutopilotState) { s.CurrentPeriod = currPeriod })
+		}
 	}(c.currPeriod)
 
 	cfg := c.ap.state.cfg
@@ -45,50 +48,58 @@ func (c *contractor) contractSpending(ctx context.Context, contract api.Contract
 	return total, nil
 }
 
-func (c *contractor) currentPeriodSpending(contracts []api.Contract) (types.Currency, error) {
-	totalCosts := make(map[types.FileContractID]types.Currency)
-	for _, c := range contracts {
-		totalCosts[c.ID] = c.TotalCost
-	}
-
-	// filter contracts in the current period
-	var filtered []api.Contract
+// currentPeriodCommitted returns the funds that were committed to contracts
+// that were formed, renewed or refreshed in the current period.
+// NOTE: contracts that were renewed or refreshed more than once within the
+// period only count with their latest total cost since archived contracts
+// don't keep track of it.
+func (c *contractor) currentPeriodCommitted(contracts []api.Contract) types.Currency {
 	c.mu.Lock()
-	for _, rev := range contracts {
-		if rev.EndHeight() <= c.currPeriod {
-			filtered = append(filtered, rev)
-		}
-	}
-	c.mu.Unlock()
+	defer c.mu.Unlock()
 
-	// calculate the money spent
-	var spent types.Currency
-	for _, rev := range filtered {
-		remaining := rev.RenterFunds()
-		totalCost := totalCosts[rev.ID]
-		if remaining.Cmp(totalCost) <= 0 {
-			spent = spent.Add(totalCost.Sub(remaining))
-		} else {
-			c.logger.DPanicw("sanity check failed", "remaining", remaining, "totalcost", totalCost)
+	var committed types.Currency
+	for _, contract := range contracts {
+		if contract.StartHeight >= c.currPeriod {
+			committed = committed.Add(contract.TotalCost)
 		}
 	}
-
-	return spent, nil
+	c.committed = committed
+	return committed
 }
 
 func (c *contractor) remainingFunds(contracts []api.Contract) (types.Currency, error) {
 	cfg := c.ap.state.cfg
 
-	// find out how much we spent in the current period
-	spent, err := c.currentPeriodSpending(contracts)
-	if err != nil {
-		return types.ZeroCurrency, err
-	}
+	// find out how much we committed in the current period
+	committed := c.currentPeriodCommitted(contracts)
 
 	// figure out remaining funds
 	var remaining types.Currency
-	if cfg.Contracts.Allowance.Cmp(spent) > 0 {
-		remaining = cfg.Contracts.Allowance.Sub(spent)
+	if cfg.Contracts.Allowance.Cmp(committed) > 0 {
+		remaining = cfg.Contracts.Allowance.Sub(committed)
 	}
 	return remaining, nil
 }
+
+// allowanceStatus returns the funds committed in the current period and what's
+// left of the allowance as of the last contract maintenance.
+func (c *contractor) allowanceStatus() (committed, remaining types.Currency) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.committed, c.remaining
+}
+
+// updateAllowanceAlert raises an alert if the allowance was exhausted during
+// contract maintenance and resolves it otherwise.
+func (c *contractor) updateAllowanceAlert(ctx context.Context, exhausted bool) {
+	var err error
+	if exhausted {
+		committed, remaining := c.allowanceStatus()
+		err = c.ap.bus.RaiseAlert(ctx, alertAllowanceExhaustedID, api.AlertSeverityWarning, fmt.Sprintf("the allowance of %v is exhausted, %v was committed to contracts in the current period and %v remains, contracts aren't formed or renewed until the allowance is increased or the next period starts", c.ap.state.cfg.Contracts.Allowance, committed, remaining))
+	} else {
+		err = c.ap.bus.ResolveAlert(ctx, alertAllowanceExhaustedID)
+	}
+	if err != nil {
+		c.logger.Errorf("failed to update allowance alert, err: %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package autopilot
+
+import (
+	"testing"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+func TestCurrentPeriodCommitted(t *testing.T) {
+	c := &contractor{currPeriod: 100}
+	contract := func(startHeight uint64, totalCost types.Currency) api.Contract {
+		return api.Contract{ContractMetadata: api.ContractMetadata{StartHeight: startHeight, TotalCost: totalCost}}
+	}
+
+	// only contracts formed in the current period count towards the
+	// committed funds
+	committed := c.currentPeriodCommitted([]api.Contract{
+		contract(99, types.Siacoins(1)),
+		contract(100, types.Siacoins(2)),
+		contract(150, types.Siacoins(3)),
+	})
+	if !committed.Equals(types.Siacoins(5)) {
+		t.Fatal("unexpected committed funds", committed)
+	} else if cf, _ := c.allowanceStatus(); !cf.Equals(committed) {
+		t.Fatal("unexpected committed funds", cf)
+	}
+}
@@ -0,0 +1,178 @@
+package autopilot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/internal/tracing"
+	"go.uber.org/zap"
+)
+
+const (
+	// defragMaxInputs is the maximum number of outputs consolidated by a
+	// single defrag transaction, it keeps the transaction size reasonable.
+	defragMaxInputs = 250
+)
+
+// errNoDefragRun is returned when the wallet was never defragmented.
+var errNoDefragRun = errors.New("the wallet was never defragmented")
+
+// A defragmenter consolidates the wallet's outputs according to the policy
+// in the autopilot's wallet config.
+type defragmenter struct {
+	ap     *Autopilot
+	logger *zap.SugaredLogger
+
+	mu      sync.Mutex
+	lastRun *api.WalletDefragRun
+}
+
+func newDefragmenter(ap *Autopilot) *defragmenter {
+	return &defragmenter{
+		ap:     ap,
+		logger: ap.logger.Named("defrag"),
+	}
+}
+
+// LastRun returns the last defrag run, it's nil if the wallet was never
+// defragmented.
+func (d *defragmenter) LastRun() *api.WalletDefragRun {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.lastRun == nil {
+		return nil
+	}
+	run := *d.lastRun
+	return &run
+}
+
+func (d *defragmenter) performWalletDefrag(ctx context.Context) {
+	ctx, span := tracing.Tracer.Start(ctx, "defragmenter.performWalletDefrag")
+	defer span.End()
+
+	if d.ap.isStopped() || !d.ap.isSynced() || !d.ap.state.cfg.Maintenance.Allowed(time.Now()) {
+		return
+	}
+
+	// respect the schedule
+	cfg := d.ap.state.cfg.Wallet
+	d.mu.Lock()
+	lastRun := d.lastRun
+	d.mu.Unlock()
+	if lastRun != nil && time.Since(lastRun.Time) < time.Duration(cfg.DefragIntervalHours)*time.Hour {
+		return
+	}
+
+	// check whether the wallet needs to be defragmented
+	b := d.ap.bus
+	outputs, err := b.WalletSpendableOutputs(ctx)
+	if err != nil {
+		d.logger.Errorf("failed to fetch wallet outputs, err: %v", err)
+		return
+	}
+	consolidate := defragOutputs(cfg, outputs)
+	if len(consolidate) == 0 {
+		return
+	}
+
+	run := api.WalletDefragRun{
+		Time:          time.Now(),
+		OutputsBefore: len(outputs),
+		OutputsAfter:  len(outputs),
+	}
+	txnID, fee, err := d.consolidate(ctx, cfg, consolidate)
+	if err != nil {
+		run.Error = err.Error()
+		d.logger.Errorf("wallet defrag failed, err: %v", err)
+	} else {
+		run.OutputsAfter = len(outputs) - len(consolidate) + 1
+		run.Consolidated = sumOutputs(consolidate)
+		run.Fee = fee
+		run.TransactionID = txnID
+		d.logger.Infof("wallet defrag consolidated %d outputs worth %v, fee %v, txn %v", len(consolidate), run.Consolidated, fee, txnID)
+	}
+
+	d.mu.Lock()
+	d.lastRun = &run
+	d.mu.Unlock()
+}
+
+// consolidate spends the given outputs into a single output of the wallet.
+func (d *defragmenter) consolidate(ctx context.Context, cfg api.WalletConfig, outputs []api.WalletOutput) (types.TransactionID, types.Currency, error) {
+	b := d.ap.bus
+	ids := make([]types.Hash256, len(outputs))
+	for i, o := range outputs {
+		ids[i] = o.ID
+	}
+
+	// fund the transaction using the outputs, the change output holds the
+	// consolidated value
+	var txn types.Transaction
+	toSign, parents, err := b.WalletFundWithOutputs(ctx, &txn, types.ZeroCurrency, ids)
+	if err != nil {
+		return types.TransactionID{}, types.ZeroCurrency, fmt.Errorf("failed to fund defrag transaction: %w", err)
+	}
+	var fee types.Currency
+	for _, mf := range txn.MinerFees {
+		fee = fee.Add(mf)
+	}
+	if !cfg.DefragMaxFee.IsZero() && fee.Cmp(cfg.DefragMaxFee) > 0 {
+		_ = b.WalletDiscard(ctx, txn)
+		return types.TransactionID{}, types.ZeroCurrency, fmt.Errorf("fee %v exceeds the max defrag fee %v", fee, cfg.DefragMaxFee)
+	}
+
+	// sign and broadcast
+	if err := b.WalletSign(ctx, &txn, toSign, types.CoveredFields{WholeTransaction: true}); err != nil {
+		_ = b.WalletDiscard(ctx, txn)
+		return types.TransactionID{}, types.ZeroCurrency, fmt.Errorf("failed to sign defrag transaction: %w", err)
+	} else if err := b.BroadcastTransaction(ctx, append(parents, txn)); err != nil {
+		_ = b.WalletDiscard(ctx, txn)
+		return types.TransactionID{}, types.ZeroCurrency, fmt.Errorf("failed to broadcast defrag transaction: %w", err)
+	}
+	return txn.ID(), fee, nil
+}
+
+// defragOutputs returns the outputs that should be consolidated according to
+// the given config. If the wallet holds more than the threshold, its
+// smallest outputs are consolidated until the target is reached, outputs
+// smaller than the min output size are always consolidated.
+func defragOutputs(cfg api.WalletConfig, outputs []api.WalletOutput) []api.WalletOutput {
+	sorted := append([]api.WalletOutput(nil), outputs...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Value.Cmp(sorted[j].Value) < 0
+	})
+
+	var n int
+	for n < len(sorted) && sorted[n].Value.Cmp(cfg.DefragMinOutputSize) < 0 {
+		n++
+	}
+	if cfg.DefragThreshold > 0 && uint64(len(sorted)) > cfg.DefragThreshold {
+		target := cfg.DefragTargetOutputs
+		if target == 0 {
+			target = 1
+		}
+		if excess := len(sorted) - int(target) + 1; excess > n {
+			n = excess
+		}
+	}
+	if n > defragMaxInputs {
+		n = defragMaxInputs
+	}
+	if n < 2 {
+		return nil
+	}
+	return sorted[:n]
+}
+
+func sumOutputs(outputs []api.WalletOutput) (sum types.Currency) {
+	for _, o := range outputs {
+		sum = sum.Add(o.Value)
+	}
+	return
+}
@@ -0,0 +1,48 @@
+package autopilot
+
+import (
+	"testing"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+func TestDefragOutputs(t *testing.T) {
+	outputs := func(values ...uint32) (outputs []api.WalletOutput) {
+		for i, v := range values {
+			outputs = append(outputs, api.WalletOutput{ID: types.Hash256{byte(i)}, Value: types.Siacoins(v)})
+		}
+		return
+	}
+	sum := func(outputs []api.WalletOutput) (sum uint64) {
+		for _, o := range outputs {
+			sum += o.Value.Div(types.Siacoins(1)).Big().Uint64()
+		}
+		return
+	}
+
+	// below the threshold nothing is consolidated
+	cfg := api.WalletConfig{DefragThreshold: 5, DefragTargetOutputs: 2}
+	if got := defragOutputs(cfg, outputs(5, 4, 3, 2, 1)); len(got) != 0 {
+		t.Fatalf("expected no outputs, got %d", len(got))
+	}
+
+	// above the threshold the smallest outputs are consolidated until the
+	// target is reached
+	got := defragOutputs(cfg, outputs(6, 5, 4, 3, 2, 1))
+	if len(got) != 5 || sum(got) != 15 {
+		t.Fatalf("unexpected outputs %v", got)
+	}
+
+	// dust is always consolidated
+	cfg.DefragMinOutputSize = types.Siacoins(3)
+	got = defragOutputs(cfg, outputs(5, 4, 2, 1))
+	if len(got) != 2 || sum(got) != 3 {
+		t.Fatalf("unexpected outputs %v", got)
+	}
+
+	// a single dust output is not consolidated
+	if got := defragOutputs(cfg, outputs(5, 4, 1)); len(got) != 0 {
+		t.Fatalf("expected no outputs, got %d", len(got))
+	}
+}
@@ -0,0 +1,92 @@
+package autopilot
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"go.sia.tech/renterd/hostdb"
+	"go.uber.org/zap"
+)
+
+const (
+	// number of bits of the host IP that make up the netblock hosts are
+	// grouped by if they aren't assigned to a group explicitly
+	groupIPv4Range = 16
+	groupIPv6Range = 32
+)
+
+// A groupFilter limits the number of hosts per group of hosts that are
+// suspected to be run by the same operator. Hosts are grouped by the group
+// stored in the hostdb, hosts without a group are grouped by their netblock.
+type groupFilter struct {
+	limit    uint64
+	counts   map[string]uint64
+	resolver resolver
+	timeout  time.Duration
+
+	logger *zap.SugaredLogger
+}
+
+func newGroupFilter(limit uint64, logger *zap.SugaredLogger) *groupFilter {
+	return &groupFilter{
+		limit:    limit,
+		counts:   make(map[string]uint64),
+		resolver: &net.Resolver{},
+		timeout:  resolverLookupTimeout,
+
+		logger: logger,
+	}
+}
+
+// exceedsLimit returns whether the host's group already reached the limit, if
+// it didn't the host is added to its group. A zero limit disables the filter.
+func (f *groupFilter) exceedsLimit(h hostdb.Host) bool {
+	if f.limit == 0 {
+		return false
+	}
+	group := f.group(h)
+	if group == "" {
+		return false
+	} else if f.counts[group] >= f.limit {
+		return true
+	}
+	f.counts[group]++
+	return false
+}
+
+// group returns the group of the host, or an empty string if the host's
+// address can't be resolved.
+func (f *groupFilter) group(h hostdb.Host) string {
+	if h.Group != "" {
+		return h.Group
+	}
+
+	ctx := context.Background()
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), f.timeout)
+		defer cancel()
+	}
+
+	host, _, err := net.SplitHostPort(h.NetAddress)
+	if err != nil {
+		return ""
+	}
+	addresses, err := f.resolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addresses) == 0 {
+		f.logger.Debugf("failed to lookup IP for host %v, err: %v", h.PublicKey, err)
+		return ""
+	}
+
+	ipRange := groupIPv6Range
+	if addresses[0].IP.To4() != nil {
+		ipRange = groupIPv4Range
+	}
+	_, ipnet, err := net.ParseCIDR(fmt.Sprintf("%s/%d", addresses[0].String(), ipRange))
+	if err != nil {
+		return ""
+	}
+	return ipnet.String()
+}
@@ -0,0 +1,58 @@
+package autopilot
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"go.sia.tech/renterd/hostdb"
+	"go.uber.org/zap"
+)
+
+type testResolver struct {
+	addrs map[string][]net.IPAddr
+}
+
+func (r *testResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	addrs, ok := r.addrs[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return addrs, nil
+}
+
+func TestGroupFilter(t *testing.T) {
+	f := newGroupFilter(2, zap.NewNop().Sugar())
+	f.resolver = &testResolver{addrs: map[string][]net.IPAddr{
+		"host1.com": {{IP: net.IPv4(1, 2, 3, 4)}},
+		"host2.com": {{IP: net.IPv4(1, 2, 4, 4)}},
+		"host3.com": {{IP: net.IPv4(1, 2, 5, 4)}},
+		"host4.com": {{IP: net.IPv4(1, 3, 3, 4)}},
+	}}
+	host := func(addr, group string) hostdb.Host {
+		return hostdb.Host{NetAddress: addr + ":9982", Group: group}
+	}
+
+	// hosts in the same netblock are grouped
+	if f.exceedsLimit(host("host1.com", "")) || f.exceedsLimit(host("host2.com", "")) {
+		t.Fatal("unexpected")
+	} else if !f.exceedsLimit(host("host3.com", "")) {
+		t.Fatal("expected the netblock to reach the limit")
+	} else if f.exceedsLimit(host("host4.com", "")) {
+		t.Fatal("unexpected")
+	}
+
+	// explicit groups take precedence over the netblock
+	if f.exceedsLimit(host("host3.com", "foo")) || f.exceedsLimit(host("host1.com", "foo")) {
+		t.Fatal("unexpected")
+	} else if !f.exceedsLimit(host("host4.com", "foo")) {
+		t.Fatal("expected the group to reach the limit")
+	}
+
+	// a zero limit disables the filter
+	f.limit = 0
+	if f.exceedsLimit(host("host3.com", "")) {
+		t.Fatal("unexpected")
+	}
+}
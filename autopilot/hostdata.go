@@ -0,0 +1,202 @@
+package autopilot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/hostdb"
+	"go.sia.tech/renterd/internal/tracing"
+	"go.uber.org/zap"
+)
+
+const (
+	// hostDataInterval is the minimum time between two fetches of external
+	// host data.
+	hostDataInterval = 6 * time.Hour
+
+	// hostDataBatchSize is the number of hosts the data is requested for at
+	// once.
+	hostDataBatchSize = 500
+
+	// hostDataTimeout is the timeout applied to a single request to the
+	// host-data provider.
+	hostDataTimeout = time.Minute
+
+	// hostDataMaxAge is the age after which external host data is no longer
+	// considered when scoring hosts.
+	hostDataMaxAge = 7 * 24 * time.Hour
+)
+
+// A HostDataProvider provides benchmark and score data about hosts from an
+// external source, e.g. a third-party benchmarking service. Hosts the provider
+// doesn't know are omitted from the result.
+type HostDataProvider interface {
+	HostData(ctx context.Context, hostKeys []types.PublicKey) (map[types.PublicKey]hostdb.ExternalData, error)
+}
+
+// A hostDataFetcher periodically pulls the data of all known hosts from a
+// HostDataProvider and stores it in the bus, where it's picked up as an extra
+// factor when scoring hosts.
+type hostDataFetcher struct {
+	ap       *Autopilot
+	logger   *zap.SugaredLogger
+	provider HostDataProvider
+
+	mu      sync.Mutex
+	running bool
+	lastRun time.Time
+}
+
+func newHostDataFetcher(ap *Autopilot, provider HostDataProvider) *hostDataFetcher {
+	return &hostDataFetcher{
+		ap:       ap,
+		logger:   ap.logger.Named("hostdata"),
+		provider: provider,
+	}
+}
+
+func (f *hostDataFetcher) tryFetchHostData() {
+	if f.provider == nil {
+		return
+	}
+	f.mu.Lock()
+	if f.running || f.ap.isStopped() || time.Since(f.lastRun) < hostDataInterval {
+		f.mu.Unlock()
+		return
+	}
+	f.running = true
+	f.lastRun = time.Now()
+	f.mu.Unlock()
+
+	f.ap.wg.Add(1)
+	go func() {
+		defer f.ap.wg.Done()
+		f.fetchHostData()
+		f.mu.Lock()
+		f.running = false
+		f.mu.Unlock()
+	}()
+}
+
+func (f *hostDataFetcher) fetchHostData() {
+	ctx, span := tracing.Tracer.Start(context.Background(), "hostdata.fetchHostData")
+	defer span.End()
+
+	hosts, err := f.ap.bus.Hosts(ctx, 0, -1)
+	if err != nil {
+		f.logger.Errorf("failed to fetch hosts, err: %v", err)
+		return
+	}
+
+	var updated int
+	for start := 0; start < len(hosts); start += hostDataBatchSize {
+		if f.ap.isStopped() {
+			return
+		}
+		end := start + hostDataBatchSize
+		if end > len(hosts) {
+			end = len(hosts)
+		}
+		hks := make([]types.PublicKey, 0, end-start)
+		for _, h := range hosts[start:end] {
+			hks = append(hks, h.PublicKey)
+		}
+
+		reqCtx, cancel := context.WithTimeout(ctx, hostDataTimeout)
+		data, err := f.provider.HostData(reqCtx, hks)
+		cancel()
+		if err != nil {
+			f.logger.Errorf("failed to fetch external host data, err: %v", err)
+			return
+		}
+		for hk, ed := range data {
+			if ed.Score < 0 || ed.Score > 1 {
+				f.logger.Warnf("ignoring external data for host %v, score %v is not between 0 and 1", hk, ed.Score)
+				delete(data, hk)
+				continue
+			} else if ed.Updated.IsZero() {
+				ed.Updated = time.Now()
+			}
+			data[hk] = ed
+		}
+		if err := f.ap.bus.UpdateHostExternalData(ctx, data); err != nil {
+			f.logger.Errorf("failed to store external host data, err: %v", err)
+			return
+		}
+		updated += len(data)
+	}
+	f.logger.Debugf("updated external data of %d hosts", updated)
+}
+
+// An httpHostDataProvider fetches host data from an HTTP API. The host keys
+// are POSTed as a JSON array, the API responds with an object mapping the keys
+// of the hosts it knows to their score and benchmarks.
+type httpHostDataProvider struct {
+	client *http.Client
+	name   string
+	url    string
+}
+
+// NewHTTPHostDataProvider returns a HostDataProvider that fetches host data
+// from the HTTP API at the given URL.
+func NewHTTPHostDataProvider(addr string) (HostDataProvider, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid host-data provider URL %q", addr)
+	}
+	return &httpHostDataProvider{
+		client: &http.Client{},
+		name:   u.Host,
+		url:    addr,
+	}, nil
+}
+
+// HostData implements the HostDataProvider interface.
+func (p *httpHostDataProvider) HostData(ctx context.Context, hostKeys []types.PublicKey) (map[types.PublicKey]hostdb.ExternalData, error) {
+	body, err := json.Marshal(hostKeys)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("host-data provider responded with status %v: %s", resp.StatusCode, bytes.TrimSpace(msg))
+	}
+
+	var results map[types.PublicKey]struct {
+		Score      float64            `json:"score"`
+		Benchmarks map[string]float64 `json:"benchmarks"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, fmt.Errorf("failed to decode host data: %w", err)
+	}
+	data := make(map[types.PublicKey]hostdb.ExternalData, len(results))
+	for hk, r := range results {
+		data[hk] = hostdb.ExternalData{
+			Provider:   p.name,
+			Score:      r.Score,
+			Benchmarks: r.Benchmarks,
+			Updated:    time.Now(),
+		}
+	}
+	return data, nil
+}
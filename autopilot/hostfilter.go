@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"math/big"
+	"time"
 
 	rhpv2 "go.sia.tech/core/rhp/v2"
 	"go.sia.tech/core/types"
@@ -35,6 +36,7 @@ var (
 	errHostBadSettings  = errors.New("host has bad settings")
 	errHostPriceGouging = errors.New("host is price gouging")
 	errHostNotAnnounced = errors.New("host is not announced")
+	errHostGroupLimit   = errors.New("host's group reached the contract limit")
 	errHostNoPriceTable = errors.New("no pricetable")
 
 	errContractOutOfCollateral   = errors.New("contract is out of collateral")
@@ -46,7 +48,7 @@ var (
 
 // isUsableHost returns whether the given host is usable along with a list of
 // reasons why it was deemed unusable.
-func isUsableHost(cfg api.AutopilotConfig, gs api.GougingSettings, rs api.RedundancySettings, cs api.ConsensusState, f *ipFilter, h hostdb.Host, minScore float64, storedData uint64, txnFee types.Currency, ignoreBlockHeight bool) (bool, []error) {
+func isUsableHost(cfg api.AutopilotConfig, gs api.GougingSettings, rs api.RedundancySettings, cs api.ConsensusState, f *ipFilter, h hostdb.Host, minScore float64, storedData uint64, txnFee types.Currency, ignoreBlockHeight bool, now time.Time) (bool, []error) {
 	var reasons []error
 
 	if !h.IsOnline() {
@@ -61,7 +63,7 @@ func isUsableHost(cfg api.AutopilotConfig, gs api.GougingSettings, rs api.Redund
 		reasons = append(reasons, errHostNoPriceTable)
 	} else if gouging, reason := worker.IsGouging(gs, rs, cs, settings, h.PriceTable, txnFee, cfg.Contracts.Period, cfg.Contracts.RenewWindow, ignoreBlockHeight); gouging {
 		reasons = append(reasons, fmt.Errorf("%w: %v", errHostPriceGouging, reason))
-	} else if score := hostScore(cfg, h, storedData, rs.Redundancy()); score < minScore {
+	} else if score := hostScore(cfg, h, storedData, rs.Redundancy(), now); score < minScore {
 		reasons = append(reasons, fmt.Errorf("%w: %v < %v", errLowScore, score, minScore))
 	}
 
@@ -112,16 +114,27 @@ func isOutOfFunds(cfg api.AutopilotConfig, s rhpv2.HostSettings, c api.Contract)
 	sectorDownloadBandwidthPrice := s.DownloadBandwidthPrice.Mul64(modules.SectorSize)
 	sectorBandwidthPrice := sectorUploadBandwidthPrice.Add(sectorDownloadBandwidthPrice)
 	sectorPrice := sectorStoragePrice.Add(sectorBandwidthPrice)
-	percentRemaining, _ := big.NewRat(0, 1).SetFrac(c.RenterFunds().Big(), c.TotalCost.Big()).Float64()
+	if c.RenterFunds().Cmp(sectorPrice.Mul64(3)) < 0 {
+		return true
+	}
 
-	return c.RenterFunds().Cmp(sectorPrice.Mul64(3)) < 0 || percentRemaining < minContractFundUploadThreshold
+	// the total cost of contracts that were found on the blockchain is unknown
+	if c.TotalCost.IsZero() {
+		return false
+	}
+	percentRemaining, _ := big.NewRat(0, 1).SetFrac(c.RenterFunds().Big(), c.TotalCost.Big()).Float64()
+	return percentRemaining < minContractFundUploadThreshold
 }
 
 // isOutOfCollateral returns 'true' if the remaining/unallocated collateral in
 // the contract is below a certain threshold of the collateral we would try to
 // put into a contract upon renew.
 func isOutOfCollateral(c api.Contract, s rhpv2.HostSettings, renterFunds types.Currency, blockHeight uint64) bool {
-	expectedStorage := renterFundsToExpectedStorage(renterFunds, c.EndHeight()-blockHeight, s)
+	// contracts that reached their end height can't be refreshed
+	if blockHeight >= c.EndHeight() {
+		return false
+	}
+	expectedStorage := worker.RenterFundsToExpectedStorage(renterFunds, c.EndHeight()-blockHeight, s)
 	expectedCollateral := rhpv2.ContractRenewalCollateral(c.Revision.FileContract, expectedStorage, s, blockHeight, c.EndHeight())
 	return isBelowCollateralThreshold(expectedCollateral, c.RemainingCollateral(s))
 }
@@ -152,6 +165,9 @@ func hasBadSettings(cfg api.AutopilotConfig, h hostdb.Host) (*rhpv2.HostSettings
 	if !settings.AcceptingContracts {
 		return nil, true, "not accepting contracts"
 	}
+	if ok, reason := meetsHostRequirements(cfg, *settings); !ok {
+		return nil, true, reason
+	}
 	if cfg.Contracts.Period+cfg.Contracts.RenewWindow > settings.MaxDuration {
 		return nil, true, fmt.Sprintf("max duration too low, %v > %v", cfg.Contracts.Period+cfg.Contracts.RenewWindow, settings.MaxDuration)
 	}
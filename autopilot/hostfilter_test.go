@@ -0,0 +1,65 @@
+package autopilot
+
+import (
+	"testing"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+func TestIsOutOfCollateral(t *testing.T) {
+	s := rhpv2.HostSettings{
+		Collateral:    types.NewCurrency64(1),
+		MaxCollateral: types.Siacoins(1000),
+		StoragePrice:  types.NewCurrency64(1),
+	}
+	c := api.Contract{Revision: types.FileContractRevision{
+		FileContract: types.FileContract{
+			WindowStart: 100,
+			MissedProofOutputs: []types.SiacoinOutput{
+				{Value: types.Siacoins(1)},
+				{Value: types.ZeroCurrency},
+				{Value: types.ZeroCurrency},
+			},
+		},
+	}}
+
+	// a contract without collateral is out of collateral before its end height
+	if !isOutOfCollateral(c, s, types.Siacoins(1), 99) {
+		t.Fatal("expected contract to be out of collateral")
+	}
+
+	// contracts that reached their end height are not
+	for _, bh := range []uint64{100, 101} {
+		if isOutOfCollateral(c, s, types.Siacoins(1), bh) {
+			t.Fatalf("expected contract to not be out of collateral at height %v", bh)
+		}
+	}
+}
+
+func TestIsOutOfFunds(t *testing.T) {
+	s := rhpv2.HostSettings{StoragePrice: types.NewCurrency64(1)}
+	c := api.Contract{
+		ContractMetadata: api.ContractMetadata{TotalCost: types.Siacoins(100)},
+		Revision: types.FileContractRevision{
+			FileContract: types.FileContract{
+				ValidProofOutputs: []types.SiacoinOutput{
+					{Value: types.Siacoins(1)},
+					{Value: types.ZeroCurrency},
+				},
+			},
+		},
+	}
+
+	// a contract with 1% of its funds left is out of funds
+	if !isOutOfFunds(api.AutopilotConfig{}, s, c) {
+		t.Fatal("expected contract to be out of funds")
+	}
+
+	// unless its total cost is unknown
+	c.TotalCost = types.ZeroCurrency
+	if isOutOfFunds(api.AutopilotConfig{}, s, c) {
+		t.Fatal("expected contract to not be out of funds")
+	}
+}
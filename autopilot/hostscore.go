@@ -1,6 +1,7 @@
 package autopilot
 
 import (
+	"fmt"
 	"math"
 	"math/big"
 	"time"
@@ -29,14 +30,19 @@ const (
 	maxSectorAccessPriceVsBandwidth = uint64(400e3)
 )
 
-func hostScore(cfg api.AutopilotConfig, h hostdb.Host, storedData uint64, expectedRedundancy float64) float64 {
+func hostScore(cfg api.AutopilotConfig, h hostdb.Host, storedData uint64, expectedRedundancy float64, now time.Time) float64 {
+	if ok, _ := meetsHostRequirements(cfg, *h.Settings); !ok {
+		return 0
+	}
+
 	// TODO: priceAdjustmentScore
-	return ageScore(h) *
+	return ageScore(h, now) *
 		collateralScore(cfg, *h.Settings, expectedRedundancy) *
 		interactionScore(h) *
 		storageRemainingScore(cfg, *h.Settings, storedData, expectedRedundancy) *
-		uptimeScore(h) *
-		versionScore(*h.Settings)
+		uptimeScore(h, now) *
+		versionScore(cfg, *h.Settings) *
+		externalScore(cfg, h, now)
 }
 
 func storageRemainingScore(cfg api.AutopilotConfig, h rhpv2.HostSettings, storedData uint64, expectedRedundancy float64) float64 {
@@ -70,7 +76,7 @@ func storageRemainingScore(cfg api.AutopilotConfig, h rhpv2.HostSettings, stored
 	return math.Pow(storageRatio, 2.0)
 }
 
-func ageScore(h hostdb.Host) float64 {
+func ageScore(h hostdb.Host, now time.Time) float64 {
 	// sanity check
 	if h.KnownSince.IsZero() {
 		return 0
@@ -91,7 +97,7 @@ func ageScore(h hostdb.Host) float64 {
 		{1 * day, 3},
 	}
 
-	age := time.Since(h.KnownSince)
+	age := now.Sub(h.KnownSince)
 	weight := 1.0
 	for _, w := range weights {
 		if age >= w.age {
@@ -148,7 +154,7 @@ func interactionScore(h hostdb.Host) float64 {
 	return math.Pow(success/(success+fail), 10)
 }
 
-func uptimeScore(h hostdb.Host) float64 {
+func uptimeScore(h hostdb.Host, now time.Time) float64 {
 	secondToLastScanSuccess := h.Interactions.SecondToLastScanSuccess
 	lastScanSuccess := h.Interactions.LastScanSuccess
 	uptime := h.Interactions.Uptime
@@ -177,7 +183,7 @@ func uptimeScore(h hostdb.Host) float64 {
 
 	// account for the interval between the most recent interaction and the
 	// current time
-	finalInterval := time.Since(h.Interactions.LastScan)
+	finalInterval := now.Sub(h.Interactions.LastScan)
 	if lastScanSuccess {
 		uptime += finalInterval
 	} else {
@@ -200,26 +206,53 @@ func uptimeScore(h hostdb.Host) float64 {
 	return math.Pow(ratio, 200*math.Min(1-ratio, 0.30))
 }
 
-func versionScore(settings rhpv2.HostSettings) float64 {
-	versions := []struct {
-		version string
-		penalty float64
-	}{
-		{"1.5.10", 1.0},
-		{"1.5.9", 0.99},
-		{"1.5.8", 0.99},
-		{"1.5.6", 0.90},
+// meetsHostRequirements returns whether the host runs at least the configured
+// minimum version and supports all required protocols, along with a reason if
+// it doesn't.
+func meetsHostRequirements(cfg api.AutopilotConfig, settings rhpv2.HostSettings) (bool, string) {
+	if cfg.Hosts.MinVersion != "" && build.VersionCmp(settings.Version, cfg.Hosts.MinVersion) < 0 {
+		return false, fmt.Sprintf("version too low, %v < %v", settings.Version, cfg.Hosts.MinVersion)
+	}
+	for _, p := range cfg.Hosts.RequiredProtocols {
+		switch p {
+		case api.HostProtocolRHP3:
+			if settings.SiaMuxPort == "" {
+				return false, "rhp3 not supported"
+			}
+		case api.HostProtocolAccounts:
+			if settings.MaxEphemeralAccountBalance.IsZero() {
+				return false, "ephemeral accounts not supported"
+			}
+		}
+	}
+	return true, ""
+}
+
+func versionScore(cfg api.AutopilotConfig, settings rhpv2.HostSettings) float64 {
+	penalties := cfg.Hosts.VersionPenalties
+	if penalties == nil {
+		penalties = api.DefaultVersionPenalties()
 	}
 	weight := 1.0
-	for _, v := range versions {
-		if build.VersionCmp(settings.Version, v.version) < 0 {
-			weight *= v.penalty
+	for _, p := range penalties {
+		if build.VersionCmp(settings.Version, p.Version) < 0 {
+			weight *= p.Penalty
 		}
 	}
 	return weight
 }
 
-func randSelectByWeight(weights []float64) int {
+// externalScore returns the score an external host-data provider reported for
+// the host raised to the configured weight. Hosts without recent external data
+// aren't penalized.
+func externalScore(cfg api.AutopilotConfig, h hostdb.Host, now time.Time) float64 {
+	if cfg.Hosts.ExternalScoreWeight == 0 || h.External == nil || now.Sub(h.External.Updated) > hostDataMaxAge {
+		return 1
+	}
+	return math.Pow(h.External.Score, cfg.Hosts.ExternalScoreWeight)
+}
+
+func randSelectByWeight(rng *frand.RNG, weights []float64) int {
 	// deep copy the input
 	weights = append([]float64{}, weights...)
 
@@ -233,7 +266,7 @@ func randSelectByWeight(weights []float64) int {
 	}
 
 	// select
-	r := frand.Float64()
+	r := rng.Float64()
 	var sum float64
 	for i, w := range weights {
 		sum += w
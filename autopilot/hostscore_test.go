@@ -1,20 +1,28 @@
 package autopilot
 
 import (
+	"context"
+	"encoding/json"
 	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	rhpv2 "go.sia.tech/core/rhp/v2"
+	rhpv3 "go.sia.tech/core/rhp/v3"
 	"go.sia.tech/core/types"
 	"go.sia.tech/renterd/api"
 	"go.sia.tech/renterd/hostdb"
+	"go.uber.org/zap"
 	"lukechampine.com/frand"
 )
 
 func TestHostScore(t *testing.T) {
 	cfg := api.DefaultAutopilotConfig()
 	day := 24 * time.Hour
+	now := time.Now()
 
 	newHost := func(s *rhpv2.HostSettings) hostdb.Host {
 		return newTestHost(randomHostKey(), newTestHostPriceTable(), s)
@@ -24,13 +32,13 @@ func TestHostScore(t *testing.T) {
 
 	// assert both hosts score equal
 	redundancy := 3.0
-	if hostScore(cfg, h1, 0, redundancy) != hostScore(cfg, h2, 0, redundancy) {
+	if hostScore(cfg, h1, 0, redundancy, now) != hostScore(cfg, h2, 0, redundancy, now) {
 		t.Fatal("unexpected")
 	}
 
 	// assert age affects the score
-	h1.KnownSince = time.Now().Add(-1 * day)
-	if hostScore(cfg, h1, 0, redundancy) <= hostScore(cfg, h2, 0, redundancy) {
+	h1.KnownSince = now.Add(-1 * day)
+	if hostScore(cfg, h1, 0, redundancy, now) <= hostScore(cfg, h2, 0, redundancy, now) {
 		t.Fatal("unexpected")
 	}
 
@@ -39,21 +47,21 @@ func TestHostScore(t *testing.T) {
 	settings.Collateral = types.NewCurrency64(1)
 	settings.MaxCollateral = types.NewCurrency64(10)
 	h1 = newHost(settings) // reset
-	if hostScore(cfg, h1, 0, redundancy) <= hostScore(cfg, h2, 0, redundancy) {
+	if hostScore(cfg, h1, 0, redundancy, now) <= hostScore(cfg, h2, 0, redundancy, now) {
 		t.Fatal("unexpected")
 	}
 
 	// assert interactions affect the score
 	h1 = newHost(newTestHostSettings()) // reset
 	h1.Interactions.SuccessfulInteractions++
-	if hostScore(cfg, h1, 0, redundancy) <= hostScore(cfg, h2, 0, redundancy) {
+	if hostScore(cfg, h1, 0, redundancy, now) <= hostScore(cfg, h2, 0, redundancy, now) {
 		t.Fatal("unexpected")
 	}
 
 	// assert uptime affects the score
 	h2 = newHost(newTestHostSettings()) // reset
 	h2.Interactions.SecondToLastScanSuccess = false
-	if hostScore(cfg, h1, 0, redundancy) <= hostScore(cfg, h2, 0, redundancy) || ageScore(h1) != ageScore(h2) {
+	if hostScore(cfg, h1, 0, redundancy, now) <= hostScore(cfg, h2, 0, redundancy, now) || ageScore(h1, now) != ageScore(h2, now) {
 		t.Fatal("unexpected")
 	}
 
@@ -61,31 +69,99 @@ func TestHostScore(t *testing.T) {
 	h2Settings := newTestHostSettings()
 	h2Settings.Version = "1.5.6" // lower
 	h2 = newHost(h2Settings)     // reset
-	if hostScore(cfg, h1, 0, redundancy) <= hostScore(cfg, h2, 0, redundancy) {
+	if hostScore(cfg, h1, 0, redundancy, now) <= hostScore(cfg, h2, 0, redundancy, now) {
 		t.Fatal("unexpected")
 	}
 
 	// asseret remaining storage affects the score.
 	h1 = newHost(newTestHostSettings()) // reset
 	h2.Settings.RemainingStorage = 100
-	if hostScore(cfg, h1, 0, redundancy) <= hostScore(cfg, h2, 0, redundancy) {
+	if hostScore(cfg, h1, 0, redundancy, now) <= hostScore(cfg, h2, 0, redundancy, now) {
 		t.Fatal("unexpected")
 	}
 
 	// assert MaxCollateral affects the score.
 	h2 = newHost(newTestHostSettings()) // reset
 	h2.Settings.MaxCollateral = types.ZeroCurrency
-	if hostScore(cfg, h1, 0, redundancy) <= hostScore(cfg, h2, 0, redundancy) {
+	if hostScore(cfg, h1, 0, redundancy, now) <= hostScore(cfg, h2, 0, redundancy, now) {
+		t.Fatal("unexpected")
+	}
+
+	// assert external scores only affect the score if they're weighted
+	h2 = newHost(newTestHostSettings()) // reset
+	h2.External = &hostdb.ExternalData{Provider: "foo", Score: 0.5, Updated: time.Now()}
+	if hostScore(cfg, h1, 0, redundancy, now) != hostScore(cfg, h2, 0, redundancy, now) {
+		t.Fatal("unexpected")
+	}
+	cfg.Hosts.ExternalScoreWeight = 2
+	if hostScore(cfg, h1, 0, redundancy, now) <= hostScore(cfg, h2, 0, redundancy, now) {
+		t.Fatal("unexpected")
+	} else if score := externalScore(cfg, h2, now); score != 0.25 {
+		t.Fatal("unexpected external score", score)
+	}
+
+	// assert stale external data is ignored
+	h2.External.Updated = time.Now().Add(-hostDataMaxAge - time.Hour)
+	if hostScore(cfg, h1, 0, redundancy, now) != hostScore(cfg, h2, 0, redundancy, now) {
 		t.Fatal("unexpected")
 	}
 }
 
+func TestHostRequirements(t *testing.T) {
+	cfg := api.DefaultAutopilotConfig()
+	h := newTestHost(randomHostKey(), newTestHostPriceTable(), newTestHostSettings())
+	if hostScore(cfg, h, 0, 3, time.Now()) == 0 {
+		t.Fatal("unexpected zero score")
+	}
+
+	// assert hosts below the minimum version score zero
+	cfg.Hosts.MinVersion = "1.5.11"
+	if hostScore(cfg, h, 0, 3, time.Now()) != 0 {
+		t.Fatal("expected zero score")
+	} else if _, bad, _ := hasBadSettings(cfg, h); !bad {
+		t.Fatal("expected bad settings")
+	}
+	cfg.Hosts.MinVersion = "1.5.10"
+	if hostScore(cfg, h, 0, 3, time.Now()) == 0 {
+		t.Fatal("unexpected zero score")
+	}
+
+	// assert hosts lacking a required protocol score zero
+	cfg.Hosts.RequiredProtocols = []string{api.HostProtocolRHP3}
+	h.Settings.SiaMuxPort = "9983"
+	if hostScore(cfg, h, 0, 3, time.Now()) == 0 {
+		t.Fatal("unexpected zero score")
+	}
+	h.Settings.SiaMuxPort = ""
+	if hostScore(cfg, h, 0, 3, time.Now()) != 0 {
+		t.Fatal("expected zero score")
+	}
+
+	// assert version penalties are configurable, an empty list disables
+	// them
+	cfg = api.DefaultAutopilotConfig()
+	h.Settings.Version = "1.5.6"
+	if versionScore(cfg, *h.Settings) == 1 {
+		t.Fatal("expected default penalty")
+	}
+	cfg.Hosts.VersionPenalties = []api.VersionPenalty{}
+	if versionScore(cfg, *h.Settings) != 1 {
+		t.Fatal("unexpected penalty")
+	}
+	cfg.Hosts.VersionPenalties = []api.VersionPenalty{{Version: "1.6.0", Penalty: 0.5}}
+	if versionScore(cfg, *h.Settings) != 0.5 {
+		t.Fatal("unexpected penalty")
+	}
+}
+
 func TestRandSelectByWeight(t *testing.T) {
+	rng := frand.New()
+
 	// assert min float is never selected
 	weights := []float64{.1, .2, math.SmallestNonzeroFloat64}
 	for i := 0; i < 100; i++ {
 		frand.Shuffle(len(weights), func(i, j int) { weights[i], weights[j] = weights[j], weights[i] })
-		if weights[randSelectByWeight(weights)] == math.SmallestNonzeroFloat64 {
+		if weights[randSelectByWeight(rng, weights)] == math.SmallestNonzeroFloat64 {
 			t.Fatal("unexpected")
 		}
 	}
@@ -94,7 +170,7 @@ func TestRandSelectByWeight(t *testing.T) {
 	counts := make([]int, 2)
 	weights = []float64{.1, .1}
 	for i := 0; i < 100; i++ {
-		counts[randSelectByWeight(weights)]++
+		counts[randSelectByWeight(rng, weights)]++
 	}
 	if diff := absDiffInt(counts[0], counts[1]); diff > 40 {
 		t.Fatal("unexpected", counts[0], counts[1], diff)
@@ -107,3 +183,80 @@ func absDiffInt(x, y int) int {
 	}
 	return x - y
 }
+
+func TestRankCandidateHosts(t *testing.T) {
+	c := &contractor{logger: zap.NewNop().Sugar()}
+	state := loopState{
+		cfg: api.DefaultAutopilotConfig(),
+		gs:  api.DefaultGougingSettings,
+		rs:  api.DefaultRedundancySettings,
+		now: time.Now(),
+	}
+
+	state.cfg.Hosts.IgnoreRedundantIPs = true
+
+	// prepare hosts with different ages, older hosts score higher
+	hosts := make([]hostdb.Host, 5)
+	for i := range hosts {
+		settings := newTestHostSettings()
+		pt := &rhpv3.HostPriceTable{
+			Validity:      time.Minute,
+			MaxCollateral: settings.MaxCollateral,
+			MaxDuration:   settings.MaxDuration,
+		}
+		hosts[i] = newTestHost(randomHostKey(), pt, settings)
+		hosts[i].KnownSince = time.Now().Add(-time.Duration(1<<i) * 24 * time.Hour)
+	}
+
+	// exclude the oldest host and assert the remaining hosts are ranked by
+	// score
+	exclude := map[types.PublicKey]struct{}{hosts[4].PublicKey: {}}
+	candidates := c.rankCandidateHosts(state, hosts, exclude, 3)
+	if len(candidates) != 3 {
+		t.Fatal("unexpected number of candidates", len(candidates))
+	}
+	for i, candidate := range candidates {
+		if candidate.HostKey != hosts[3-i].PublicKey {
+			t.Fatalf("unexpected candidate at index %d", i)
+		} else if i > 0 && candidate.Score > candidates[i-1].Score {
+			t.Fatal("candidates aren't sorted by score")
+		}
+	}
+}
+
+func TestHTTPHostDataProvider(t *testing.T) {
+	hk1, hk2 := randomHostKey(), randomHostKey()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var hks []types.PublicKey
+		if err := json.NewDecoder(req.Body).Decode(&hks); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		} else if len(hks) != 2 || hks[0] != hk1 || hks[1] != hk2 {
+			http.Error(w, "unexpected host keys", http.StatusBadRequest)
+			return
+		}
+		// only the first host is known to the provider
+		json.NewEncoder(w).Encode(map[types.PublicKey]interface{}{
+			hk1: map[string]interface{}{"score": 0.8, "benchmarks": map[string]float64{"upload": 100}},
+		})
+	}))
+	defer srv.Close()
+
+	if _, err := NewHTTPHostDataProvider("foo"); err == nil {
+		t.Fatal("expected invalid URL to be rejected")
+	}
+	p, err := NewHTTPHostDataProvider(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := p.HostData(context.Background(), []types.PublicKey{hk1, hk2})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(data) != 1 {
+		t.Fatal("unexpected data", data)
+	}
+	ed := data[hk1]
+	if ed.Provider != strings.TrimPrefix(srv.URL, "http://") || ed.Score != 0.8 || ed.Benchmarks["upload"] != 100 || ed.Updated.IsZero() {
+		t.Fatal("unexpected data", ed)
+	}
+}
@@ -0,0 +1,72 @@
+package autopilot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"go.sia.tech/renterd/api"
+)
+
+// A trackedJob is a job run by the autopilot, its progress is reported to the
+// bus so it can be followed and cancelled through the bus' /jobs API. The zero
+// trackedJob isn't tracked, its updates are no-ops.
+type trackedJob struct {
+	b  Bus
+	id uint
+}
+
+// startJob acquires a pending job of the given type, e.g. one that was created
+// through the bus' API, or adds and acquires a new one if there is none. Since
+// the autopilot is the only runner of its job types and runs one job per type
+// at a time, jobs of the type that are still running were interrupted by a
+// shutdown and are marked as failed.
+func startJob(ctx context.Context, b Bus, typ string) (trackedJob, error) {
+	running, err := b.Jobs(ctx, typ, api.JobStateRunning, 0, -1)
+	if err != nil {
+		return trackedJob{}, err
+	}
+	for _, job := range running {
+		if err := (trackedJob{b: b, id: job.ID}).finish(ctx, nil, errors.New("interrupted by shutdown")); err != nil && !errors.Is(err, api.ErrJobNotRunning) {
+			return trackedJob{}, err
+		}
+	}
+
+	job, err := b.AcquireJob(ctx, typ)
+	if errors.Is(err, api.ErrNoJobAvailable) {
+		if _, err = b.AddJob(ctx, typ, nil); err == nil {
+			job, err = b.AcquireJob(ctx, typ)
+		}
+	}
+	if err != nil {
+		return trackedJob{}, err
+	}
+	return trackedJob{b: b, id: job.ID}, nil
+}
+
+// update reports the job's progress, api.ErrJobNotRunning is returned if the
+// job was cancelled.
+func (j trackedJob) update(ctx context.Context, progress float64) error {
+	if j.id == 0 {
+		return nil
+	}
+	return j.b.UpdateJob(ctx, j.id, api.JobUpdate{State: api.JobStateRunning, Progress: progress})
+}
+
+// finish marks the job as done, or as failed if err is set.
+func (j trackedJob) finish(ctx context.Context, result interface{}, err error) error {
+	if j.id == 0 {
+		return nil
+	}
+	u := api.JobUpdate{State: api.JobStateDone}
+	if err != nil {
+		u.State, u.Error = api.JobStateFailed, err.Error()
+	} else if result != nil {
+		js, err := json.Marshal(result)
+		if err != nil {
+			panic(err) // should never happen
+		}
+		u.Result = js
+	}
+	return j.b.UpdateJob(ctx, j.id, u)
+}
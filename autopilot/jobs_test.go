@@ -0,0 +1,91 @@
+package autopilot
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.sia.tech/renterd/api"
+)
+
+// mockJobBus implements the job methods of the Bus, calling any other method
+// panics.
+type mockJobBus struct {
+	Bus
+	jobs []api.Job
+}
+
+func (b *mockJobBus) AcquireJob(ctx context.Context, types ...string) (api.Job, error) {
+	for i, job := range b.jobs {
+		if job.Type == types[0] && job.State == api.JobStatePending {
+			b.jobs[i].State = api.JobStateRunning
+			return b.jobs[i], nil
+		}
+	}
+	return api.Job{}, api.ErrNoJobAvailable
+}
+
+func (b *mockJobBus) AddJob(ctx context.Context, typ string, params interface{}) (api.Job, error) {
+	job := api.Job{ID: uint(len(b.jobs) + 1), Type: typ, State: api.JobStatePending}
+	b.jobs = append(b.jobs, job)
+	return job, nil
+}
+
+func (b *mockJobBus) Jobs(ctx context.Context, typ, state string, offset, limit int) (jobs []api.Job, _ error) {
+	for _, job := range b.jobs {
+		if job.Type == typ && job.State == state {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+func (b *mockJobBus) UpdateJob(ctx context.Context, id uint, u api.JobUpdate) error {
+	job := &b.jobs[id-1]
+	if job.State != api.JobStateRunning {
+		return api.ErrJobNotRunning
+	}
+	job.State, job.Progress, job.Error = u.State, u.Progress, u.Error
+	return nil
+}
+
+func TestStartJob(t *testing.T) {
+	ctx := context.Background()
+	b := &mockJobBus{}
+
+	// a job is added if there's none pending
+	job, err := startJob(ctx, b, api.JobTypeReshard)
+	if err != nil {
+		t.Fatal(err)
+	} else if job.id != 1 || b.jobs[0].State != api.JobStateRunning {
+		t.Fatal("unexpected job", job, b.jobs)
+	}
+	if err := job.update(ctx, 0.5); err != nil {
+		t.Fatal(err)
+	} else if b.jobs[0].Progress != 0.5 {
+		t.Fatal("unexpected progress", b.jobs[0].Progress)
+	}
+
+	// starting another job fails the interrupted one and picks up the
+	// pending job that was created through the API
+	pending, _ := b.AddJob(ctx, api.JobTypeReshard, nil)
+	job, err = startJob(ctx, b, api.JobTypeReshard)
+	if err != nil {
+		t.Fatal(err)
+	} else if job.id != pending.ID {
+		t.Fatal("unexpected job", job)
+	} else if b.jobs[0].State != api.JobStateFailed || b.jobs[0].Error == "" {
+		t.Fatal("interrupted job wasn't failed", b.jobs[0])
+	}
+
+	// cancelled jobs can't be updated
+	b.jobs[1].State = api.JobStateCancelled
+	if err := job.update(ctx, 0.5); !errors.Is(err, api.ErrJobNotRunning) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// the zero job isn't tracked
+	if err := (trackedJob{}).finish(ctx, nil, errors.New("failed")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -2,9 +2,12 @@ package autopilot
 
 import (
 	"context"
+	"errors"
 	"math"
 	"sync"
+	"time"
 
+	"go.sia.tech/core/types"
 	"go.sia.tech/renterd/api"
 	"go.sia.tech/renterd/internal/tracing"
 	"go.uber.org/zap"
@@ -12,6 +15,10 @@ import (
 
 const (
 	migratorBatchSize = math.MaxInt // TODO: change once we have a fix for the infinite loop
+
+	// migratorMaxHealthAge is the maximum age of the slab health computed by
+	// the bus for the migrator to rely on it.
+	migratorMaxHealthAge = time.Hour
 )
 
 type migrator struct {
@@ -33,7 +40,7 @@ func newMigrator(ap *Autopilot, healthCutoff float64) *migrator {
 
 func (m *migrator) tryPerformMigrations(ctx context.Context, w Worker) {
 	m.mu.Lock()
-	if m.running || m.ap.isStopped() {
+	if m.running || m.ap.isStopped() || !m.ap.state.cfg.Maintenance.Allowed(time.Now()) {
 		m.mu.Unlock()
 		return
 	}
@@ -56,32 +63,157 @@ func (m *migrator) performMigrations(w Worker, cfg api.AutopilotConfig) {
 	ctx, span := tracing.Tracer.Start(context.Background(), "migrator.performMigrations")
 	defer span.End()
 
-	// fetch slabs for migration
-	toMigrate, err := b.SlabsForMigration(ctx, m.healthCutoff, cfg.Contracts.Set, migratorBatchSize)
+	// resume the pass that was interrupted, if any, the queue was already
+	// filled when the pass started
+	cursor := m.ap.persistedState().MigrationCursor
+	resuming := !cursor.Started.IsZero()
+	var job trackedJob
+	if resuming {
+		m.logger.Infof("resuming migrations after slab %d, %d slabs were migrated since %v", cursor.SlabID, cursor.Migrated, cursor.Started)
+		job = trackedJob{b: b, id: cursor.JobID}
+	} else {
+		cursor = api.MigrationCursor{Started: time.Now()}
+		m.ap.updateState(func(s *api.AutopilotState) { s.MigrationCursor = cursor })
+
+		// enqueue the slabs that need to be repaired, unless the health
+		// computed by the bus is recent enough and indicates that there
+		// are none, slabs of passphrase protected objects aren't migrated
+		if summary, err := b.SlabHealthSummary(ctx, m.healthCutoff); err == nil && summary.Set == cfg.Contracts.Set && time.Since(summary.Refreshed) < migratorMaxHealthAge && summary.Unhealthy == summary.UnhealthyWrapped {
+			m.logger.Debugf("no slabs to enqueue, health was computed at %v", summary.Refreshed)
+		} else if n, err := b.EnqueueSlabsForRepair(ctx, cfg.Contracts.Set, m.healthCutoff); err != nil {
+			m.logger.Errorf("failed to enqueue slabs for repair, err: %v", err)
+		} else {
+			m.logger.Debugf("%d slabs enqueued for repair", n)
+		}
+	}
+
+	// fetch the slabs that are due for repair, highest priority first
+	toMigrate, err := b.RepairQueue(ctx, migratorBatchSize)
 	if err != nil {
 		m.logger.Errorf("failed to fetch slabs for migration, err: %v", err)
 		return
 	}
+	if resuming {
+		toMigrate = afterCursor(toMigrate, cursor)
+	}
 	m.logger.Debugf("%d slabs to migrate", len(toMigrate))
 
-	// return if there are no slabs to migrate
+	// finish the pass if there are no slabs to migrate
 	if len(toMigrate) == 0 {
+		m.finishPass(ctx, job, cursor)
 		return
 	}
+	total := cursor.Migrated + uint64(len(toMigrate))
+
+	// track new passes as a job, migrations aren't held up by the bus failing
+	// to track them
+	if !resuming {
+		if job, err = startJob(ctx, b, api.JobTypeMigration); err != nil {
+			m.logger.Errorf("failed to start migration job, err: %v", err)
+		}
+		cursor.JobID = job.id
+		m.ap.updateState(func(s *api.AutopilotState) { s.MigrationCursor = cursor })
+	}
+
+	// mark the slabs as pending
+	pending := make([]api.SlabMigrationUpdate, len(toMigrate))
+	for i, entry := range toMigrate {
+		pending[i] = api.SlabMigrationUpdate{SlabID: entry.SlabID, Status: api.SlabMigrationStatusPending}
+	}
+	if err := b.UpdateSlabMigrations(ctx, pending); err != nil {
+		m.logger.Errorf("failed to record pending migrations, err: %v", err)
+	}
+
+	// prewarm the sessions with the hosts storing the slabs so the first
+	// migration isn't penalized by cold connections
+	var hostKeys []types.PublicKey
+	seen := make(map[types.PublicKey]struct{})
+	for _, entry := range toMigrate {
+		for _, shard := range entry.Slab.Shards {
+			if _, ok := seen[shard.Host]; !ok {
+				seen[shard.Host] = struct{}{}
+				hostKeys = append(hostKeys, shard.Host)
+			}
+		}
+	}
+	if res, err := w.RHPPrewarm(ctx, hostKeys); err != nil {
+		m.logger.Errorf("failed to prewarm sessions, err: %v", err)
+	} else {
+		m.logger.Debugf("prewarmed %d sessions, %d failed", res.Warmed, res.Failed)
+	}
 
-	// migrate the slabs one by one
+	// migrate the slabs one by one, the result is recorded after every
+	// migration so failed slabs are backed off
 	//
 	// TODO: when we support parallel uploads we should parallelize this
-	for i, slab := range toMigrate {
+	for i, entry := range toMigrate {
 		if m.ap.isStopped() {
 			break
+		} else if !cfg.Maintenance.Allowed(time.Now()) {
+			m.logger.Infof("maintenance window closed, stopping migrations after %d/%d slabs", i, len(toMigrate))
+			break
+		}
+
+		update := api.SlabMigrationUpdate{SlabID: entry.SlabID, Status: api.SlabMigrationStatusInProgress}
+		if err := b.UpdateSlabMigrations(ctx, []api.SlabMigrationUpdate{update}); err != nil {
+			m.logger.Errorf("failed to record migration start, err: %v", err)
 		}
 
-		err := w.MigrateSlab(ctx, slab)
-		if err != nil {
+		res := api.RepairResult{SlabID: entry.SlabID}
+		update.Status = api.SlabMigrationStatusDone
+		if err := w.MigrateSlab(ctx, entry.Slab); err != nil {
 			m.logger.Errorf("failed to migrate slab %d/%d, err: %v", i+1, len(toMigrate), err)
-			continue
+			res.Error = err.Error()
+			update.Status, update.Error = api.SlabMigrationStatusFailed, err.Error()
+			cursor.Failed++
+		} else {
+			m.logger.Debugf("successfully migrated slab '%v' %d/%d", entry.Slab.Key, i+1, len(toMigrate))
+		}
+		if err := b.RecordRepairResults(ctx, []api.RepairResult{res}); err != nil {
+			m.logger.Errorf("failed to record repair result, err: %v", err)
+		}
+		if err := b.UpdateSlabMigrations(ctx, []api.SlabMigrationUpdate{update}); err != nil {
+			m.logger.Errorf("failed to record migration result, err: %v", err)
+		}
+
+		// move the cursor past the slab
+		cursor.Priority = entry.Priority
+		cursor.SlabID = entry.SlabID
+		cursor.Migrated++
+		m.ap.updateState(func(s *api.AutopilotState) { s.MigrationCursor = cursor })
+
+		if i == len(toMigrate)-1 {
+			m.finishPass(ctx, job, cursor)
+		} else if err := job.update(ctx, float64(cursor.Migrated)/float64(total)); errors.Is(err, api.ErrJobNotRunning) {
+			m.logger.Infof("migration job was cancelled, stopping migrations after %d/%d slabs", i+1, len(toMigrate))
+			m.finishPass(ctx, trackedJob{}, cursor)
+			break
+		} else if err != nil {
+			m.logger.Errorf("failed to update migration job, err: %v", err)
+		}
+	}
+}
+
+// finishPass finishes the pass's job and resets the migration cursor, the
+// next pass starts over by enqueueing the slabs that need to be repaired.
+func (m *migrator) finishPass(ctx context.Context, job trackedJob, cursor api.MigrationCursor) {
+	if err := job.finish(ctx, api.MigrationJobResult{Migrated: cursor.Migrated, Failed: cursor.Failed}, nil); err != nil {
+		m.logger.Errorf("failed to finish migration job, err: %v", err)
+	}
+	m.ap.updateState(func(s *api.AutopilotState) {
+		s.LastMigration = time.Now()
+		s.MigrationCursor = api.MigrationCursor{}
+	})
+}
+
+// afterCursor returns the entries of the repair queue that come after the
+// cursor, the queue is ordered by descending priority and ascending slab ID.
+func afterCursor(entries []api.RepairQueueEntry, cursor api.MigrationCursor) []api.RepairQueueEntry {
+	var after []api.RepairQueueEntry
+	for _, entry := range entries {
+		if entry.Priority < cursor.Priority || (entry.Priority == cursor.Priority && entry.SlabID > cursor.SlabID) {
+			after = append(after, entry)
 		}
-		m.logger.Debugf("successfully migrated slab '%v' %d/%d", slab.Key, i+1, len(toMigrate))
 	}
+	return after
 }
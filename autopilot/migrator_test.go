@@ -0,0 +1,95 @@
+package autopilot
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.sia.tech/renterd/api"
+	"go.uber.org/zap"
+)
+
+func TestMaintenanceWindows(t *testing.T) {
+	at := func(hour, min int) time.Time {
+		return time.Date(2023, 1, 1, hour, min, 0, 0, time.UTC)
+	}
+
+	// no windows means maintenance is always allowed
+	var mc api.MaintenanceConfig
+	if !mc.Allowed(at(12, 0)) {
+		t.Fatal("expected maintenance to be allowed")
+	}
+
+	// a window within a day
+	mc.Windows = []api.MaintenanceWindow{{Start: "01:00", End: "05:30"}}
+	for _, test := range []struct {
+		t       time.Time
+		allowed bool
+	}{
+		{at(0, 59), false},
+		{at(1, 0), true},
+		{at(5, 29), true},
+		{at(5, 30), false},
+	} {
+		if mc.Allowed(test.t) != test.allowed {
+			t.Fatalf("unexpected result for %v", test.t)
+		}
+	}
+
+	// a window that wraps around midnight
+	mc.Windows = []api.MaintenanceWindow{{Start: "22:00", End: "02:00"}}
+	if !mc.Allowed(at(23, 0)) || !mc.Allowed(at(1, 0)) || mc.Allowed(at(12, 0)) {
+		t.Fatal("unexpected result for window wrapping around midnight")
+	}
+
+	// assert the migrator doesn't start outside of the maintenance windows
+	cfg := api.DefaultAutopilotConfig()
+	now := time.Now().UTC()
+	cfg.Maintenance.Windows = []api.MaintenanceWindow{{
+		Start: now.Add(time.Hour).Format("15:04"),
+		End:   now.Add(2 * time.Hour).Format("15:04"),
+	}}
+	ap := &Autopilot{
+		logger:   zap.NewNop().Sugar(),
+		state:    loopState{cfg: cfg},
+		stopChan: make(chan struct{}),
+	}
+	m := newMigrator(ap, 0.75)
+	m.tryPerformMigrations(context.Background(), nil)
+	if m.running {
+		t.Fatal("migrations shouldn't run outside of the maintenance windows")
+	}
+}
+
+func TestAfterCursor(t *testing.T) {
+	entries := []api.RepairQueueEntry{
+		{SlabID: 3, Priority: 0.9},
+		{SlabID: 5, Priority: 0.9},
+		{SlabID: 1, Priority: 0.5},
+		{SlabID: 2, Priority: 0.5},
+		{SlabID: 4, Priority: 0.1},
+	}
+
+	ids := func(entries []api.RepairQueueEntry) (ids []api.SlabID) {
+		for _, e := range entries {
+			ids = append(ids, e.SlabID)
+		}
+		return
+	}
+
+	for _, test := range []struct {
+		cursor api.MigrationCursor
+		want   []api.SlabID
+	}{
+		{api.MigrationCursor{Priority: 1}, []api.SlabID{3, 5, 1, 2, 4}},
+		{api.MigrationCursor{Priority: 0.9, SlabID: 3}, []api.SlabID{5, 1, 2, 4}},
+		{api.MigrationCursor{Priority: 0.9, SlabID: 5}, []api.SlabID{1, 2, 4}},
+		{api.MigrationCursor{Priority: 0.5, SlabID: 1}, []api.SlabID{2, 4}},
+		{api.MigrationCursor{Priority: 0.1, SlabID: 4}, nil},
+	} {
+		if got := ids(afterCursor(entries, test.cursor)); !reflect.DeepEqual(got, test.want) {
+			t.Fatalf("unexpected slabs after cursor %+v: %v != %v", test.cursor, got, test.want)
+		}
+	}
+}
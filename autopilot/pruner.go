@@ -0,0 +1,99 @@
+package autopilot
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/internal/tracing"
+	"go.uber.org/zap"
+)
+
+const (
+	// pruneInterval is the minimum time between two pruning runs, pruning a
+	// contract requires downloading all of its sector roots.
+	pruneInterval = 24 * time.Hour
+
+	// pruneMinPrunableBytes is the minimum number of unreferenced bytes a
+	// contract has to store before it gets pruned.
+	pruneMinPrunableBytes = 1 << 30 // 1 GiB
+)
+
+// A pruner periodically deletes the sectors that are no longer referenced by
+// any object from the hosts, reclaiming the storage the renter pays for.
+type pruner struct {
+	ap     *Autopilot
+	logger *zap.SugaredLogger
+
+	mu      sync.Mutex
+	running bool
+	lastRun time.Time
+}
+
+func newPruner(ap *Autopilot) *pruner {
+	return &pruner{
+		ap:     ap,
+		logger: ap.logger.Named("pruner"),
+	}
+}
+
+func (p *pruner) tryPerformPruning(ctx context.Context, w Worker) {
+	p.mu.Lock()
+	if p.running || p.ap.isStopped() || time.Since(p.lastRun) < pruneInterval || !p.ap.state.cfg.Maintenance.Allowed(time.Now()) {
+		p.mu.Unlock()
+		return
+	}
+	p.running = true
+	p.lastRun = time.Now()
+	p.mu.Unlock()
+
+	p.ap.wg.Add(1)
+	go func(cfg api.AutopilotConfig) {
+		defer p.ap.wg.Done()
+		p.performPruning(w, cfg)
+		p.mu.Lock()
+		p.running = false
+		p.mu.Unlock()
+	}(p.ap.state.cfg)
+}
+
+func (p *pruner) performPruning(w Worker, cfg api.AutopilotConfig) {
+	ctx, span := tracing.Tracer.Start(context.Background(), "pruner.performPruning")
+	defer span.End()
+
+	contracts, err := p.ap.bus.Contracts(ctx, cfg.Contracts.Set)
+	if err != nil {
+		p.logger.Errorf("failed to fetch contracts for pruning, err: %v", err)
+		return
+	}
+
+	var pruned uint64
+	for _, c := range contracts {
+		if p.ap.isStopped() {
+			break
+		} else if !cfg.Maintenance.Allowed(time.Now()) {
+			p.logger.Info("maintenance window closed, stopping pruning")
+			break
+		}
+
+		prunable, err := w.RHPContractPrunable(ctx, c.ID)
+		if err != nil {
+			p.logger.Debugf("failed to fetch prunable data for contract %v, err: %v", c.ID, err)
+			continue
+		} else if prunable.Prunable < pruneMinPrunableBytes {
+			continue
+		}
+
+		res, err := w.RHPContractPrune(ctx, c.ID)
+		if err != nil {
+			p.logger.Errorf("failed to prune contract %v, err: %v", c.ID, err)
+			continue
+		}
+		p.logger.Debugf("pruned %d bytes from contract %v, %d bytes remaining", res.Pruned, c.ID, res.Remaining)
+		pruned += res.Pruned
+	}
+	if pruned > 0 {
+		p.logger.Infof("pruned %d bytes of unreferenced data from hosts", pruned)
+	}
+}
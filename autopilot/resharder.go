@@ -0,0 +1,109 @@
+package autopilot
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/internal/tracing"
+	"go.uber.org/zap"
+)
+
+const (
+	// resharderBatchSize is the max number of objects resharded per
+	// iteration, objects that fail to be resharded are retried in the next
+	// one.
+	resharderBatchSize = 10
+)
+
+// A resharder converts existing objects to the current redundancy settings
+// by having a worker download and re-upload their slabs.
+type resharder struct {
+	ap     *Autopilot
+	logger *zap.SugaredLogger
+
+	mu      sync.Mutex
+	running bool
+}
+
+func newResharder(ap *Autopilot) *resharder {
+	return &resharder{
+		ap:     ap,
+		logger: ap.logger.Named("resharder"),
+	}
+}
+
+func (r *resharder) tryPerformResharding(ctx context.Context, w Worker) {
+	r.mu.Lock()
+	if r.running || r.ap.isStopped() {
+		r.mu.Unlock()
+		return
+	}
+	r.running = true
+	r.mu.Unlock()
+
+	r.ap.wg.Add(1)
+	go func() {
+		defer r.ap.wg.Done()
+		r.performResharding(w)
+		r.mu.Lock()
+		r.running = false
+		r.mu.Unlock()
+	}()
+}
+
+func (r *resharder) performResharding(w Worker) {
+	b := r.ap.bus
+	ctx, span := tracing.Tracer.Start(context.Background(), "resharder.performResharding")
+	defer span.End()
+
+	keys, err := b.ObjectsForReshard(ctx, resharderBatchSize)
+	if err != nil {
+		r.logger.Errorf("failed to fetch objects for resharding, err: %v", err)
+		return
+	} else if len(keys) == 0 {
+		return
+	}
+
+	// track the batch as a job, resharding isn't held up by the bus failing
+	// to track it
+	job, err := startJob(ctx, b, api.JobTypeReshard)
+	if err != nil {
+		r.logger.Errorf("failed to start reshard job, err: %v", err)
+	}
+
+	var res api.ReshardJobResult
+	var jobErr error
+	for i, key := range keys {
+		if r.ap.isStopped() {
+			jobErr = errors.New("interrupted by shutdown")
+			break
+		}
+		if err := w.ReshardObject(ctx, key); err != nil {
+			r.logger.Errorf("failed to reshard object %d/%d, err: %v", i+1, len(keys), err)
+			res.Failed++
+		} else {
+			r.logger.Debugf("successfully resharded object '%v' %d/%d", key, i+1, len(keys))
+			res.Resharded++
+		}
+		if i == len(keys)-1 {
+			break
+		} else if err := job.update(ctx, float64(i+1)/float64(len(keys))); errors.Is(err, api.ErrJobNotRunning) {
+			r.logger.Infof("reshard job was cancelled, stopping after %d/%d objects", i+1, len(keys))
+			job = trackedJob{}
+			break
+		} else if err != nil {
+			r.logger.Errorf("failed to update reshard job, err: %v", err)
+		}
+	}
+	if err := job.finish(ctx, res, jobErr); err != nil {
+		r.logger.Errorf("failed to finish reshard job, err: %v", err)
+	}
+
+	if progress, err := b.ReshardProgress(ctx); err != nil {
+		r.logger.Errorf("failed to fetch reshard progress, err: %v", err)
+	} else {
+		r.logger.Infof("%d/%d objects left to reshard to %d-of-%d", progress.Remaining, progress.Objects, progress.MinShards, progress.TotalShards)
+	}
+}
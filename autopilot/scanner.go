@@ -20,7 +20,6 @@ const (
 	// a host must have before it is removed for exceeding the max downtime.
 	minRecentScanFailures = 10
 
-	// TODO: make these configurable
 	scannerTimeoutInterval   = 10 * time.Minute
 	scannerTimeoutMinTimeout = time.Second * 5
 
@@ -36,6 +35,7 @@ type (
 		// a bit, we currently use inline interfaces to avoid having to update the
 		// scanner tests with every interface change
 		bus interface {
+			Contracts(ctx context.Context, set string) ([]api.ContractMetadata, error)
 			Hosts(ctx context.Context, offset, limit int) ([]hostdb.Host, error)
 			HostsForScanning(ctx context.Context, maxLastScan time.Time, offset, limit int) ([]hostdb.HostAddress, error)
 			RemoveOfflineHosts(ctx context.Context, minRecentScanFailures uint64, maxDowntime time.Duration) (uint64, error)
@@ -55,6 +55,8 @@ type (
 		mu                sync.Mutex
 		scanning          bool
 		scanningLastStart time.Time
+		scanned           uint64
+		queued            uint64
 		timeout           time.Duration
 		timeoutLastUpdate time.Time
 	}
@@ -159,13 +161,23 @@ func (s *scanner) tryPerformHostScan(ctx context.Context, w scanWorker) {
 	s.logger.Info("host scan started")
 	s.scanningLastStart = time.Now()
 	s.scanning = true
+	s.scanned = 0
+	s.queued = 0
+	lastStart := s.scanningLastStart
 	s.mu.Unlock()
 
+	// persist the start of the scan after releasing the lock, the scanner's
+	// status shouldn't block on the bus
+	s.ap.updateState(func(state *api.AutopilotState) { state.LastScan = lastStart })
+
 	go func(cfg api.AutopilotConfig) {
-		for resp := range s.launchScanWorkers(ctx, w, s.launchHostScans()) {
+		for resp := range s.launchScanWorkers(ctx, w, cfg, s.launchHostScans(cfg)) {
 			if s.ap.isStopped() {
 				break
 			}
+			s.mu.Lock()
+			s.scanned++
+			s.mu.Unlock()
 			if resp.err != nil && !strings.Contains(resp.err.Error(), "connection refused") {
 				s.logger.Error(resp.err)
 			}
@@ -208,59 +220,95 @@ func (s *scanner) tryUpdateTimeout() {
 	s.timeoutLastUpdate = time.Now()
 }
 
-func (s *scanner) launchHostScans() chan scanReq {
+func (s *scanner) launchHostScans(cfg api.AutopilotConfig) chan scanReq {
 	reqChan := make(chan scanReq, s.scanBatchSize)
 
 	s.ap.wg.Add(1)
 	go func() {
 		defer s.ap.wg.Done()
+		defer close(reqChan)
+
+		// if both tiers are scanned at the same interval we don't need to
+		// distinguish between them
+		contractHostInterval, hostInterval := s.scanIntervals(cfg)
+		if contractHostInterval == hostInterval {
+			s.queueHostScans(reqChan, time.Now().Add(-hostInterval), nil)
+			return
+		}
 
-		var offset int
-		var exhausted bool
-		cutoff := time.Now().Add(-s.scanMinInterval)
-		for !s.ap.isStopped() && !exhausted {
-			// fetch next batch
-			hosts, err := s.bus.HostsForScanning(context.Background(), cutoff, offset, int(s.scanBatchSize))
-			if err != nil {
-				s.logger.Errorf("could not get hosts for scanning, err: %v", err)
-				break
-			}
-			if len(hosts) == 0 {
-				break
-			}
-			if len(hosts) < int(s.scanBatchSize) {
-				exhausted = true
-			}
-			s.logger.Debugf("scanning %d hosts in range %d-%d", len(hosts), offset, offset+int(s.scanBatchSize))
-
-			// add batch to scan queue
-			for _, h := range hosts {
-				reqChan <- scanReq{
-					hostKey: h.PublicKey,
-					hostIP:  h.NetAddress,
-				}
-			}
-
-			offset += int(s.scanBatchSize)
+		contracts, err := s.bus.Contracts(context.Background(), cfg.Contracts.Set)
+		if err != nil {
+			s.logger.Errorf("could not get contracts for scanning, err: %v", err)
+			return
+		}
+		contractHosts := make(map[types.PublicKey]bool)
+		for _, c := range contracts {
+			contractHosts[c.HostKey] = true
 		}
-		close(reqChan)
+
+		now := time.Now()
+		s.queueHostScans(reqChan, now.Add(-contractHostInterval), func(hk types.PublicKey) bool { return contractHosts[hk] })
+		s.queueHostScans(reqChan, now.Add(-hostInterval), func(hk types.PublicKey) bool { return !contractHosts[hk] })
 	}()
 
 	return reqChan
 }
 
-func (s *scanner) launchScanWorkers(ctx context.Context, w scanWorker, reqs chan scanReq) chan scanResp {
-	respChan := make(chan scanResp, s.scanThreads)
-	liveThreads := s.scanThreads
+// queueHostScans queues a scan for all hosts that weren't scanned since the
+// given cutoff, if a filter is passed only the hosts it returns true for are
+// queued.
+func (s *scanner) queueHostScans(reqChan chan scanReq, cutoff time.Time, filter func(types.PublicKey) bool) {
+	var offset int
+	var exhausted bool
+	for !s.ap.isStopped() && !exhausted {
+		// fetch next batch
+		hosts, err := s.bus.HostsForScanning(context.Background(), cutoff, offset, int(s.scanBatchSize))
+		if err != nil {
+			s.logger.Errorf("could not get hosts for scanning, err: %v", err)
+			break
+		}
+		if len(hosts) == 0 {
+			break
+		}
+		if len(hosts) < int(s.scanBatchSize) {
+			exhausted = true
+		}
+		s.logger.Debugf("scanning %d hosts in range %d-%d", len(hosts), offset, offset+int(s.scanBatchSize))
+
+		// add batch to scan queue
+		for _, h := range hosts {
+			if filter != nil && !filter(h.PublicKey) {
+				continue
+			}
+			s.mu.Lock()
+			s.queued++
+			s.mu.Unlock()
+			reqChan <- scanReq{
+				hostKey: h.PublicKey,
+				hostIP:  h.NetAddress,
+			}
+		}
+
+		offset += int(s.scanBatchSize)
+	}
+}
+
+func (s *scanner) launchScanWorkers(ctx context.Context, w scanWorker, cfg api.AutopilotConfig, reqs chan scanReq) chan scanResp {
+	threads := s.scanThreads
+	if cfg.Scanner.Threads > 0 {
+		threads = cfg.Scanner.Threads
+	}
+	respChan := make(chan scanResp, threads)
+	liveThreads := threads
 
-	for i := uint64(0); i < s.scanThreads; i++ {
+	for i := uint64(0); i < threads; i++ {
 		go func() {
 			for req := range reqs {
 				if s.ap.isStopped() {
 					break
 				}
 
-				scan, err := w.RHPScan(ctx, req.hostKey, req.hostIP, s.currentTimeout())
+				scan, err := w.RHPScan(ctx, req.hostKey, req.hostIP, s.currentTimeout(cfg))
 				respChan <- scanResp{req.hostKey, scan.Settings, err}
 				s.tracker.addDataPoint(time.Duration(scan.Ping))
 			}
@@ -275,15 +323,52 @@ func (s *scanner) launchScanWorkers(ctx context.Context, w scanWorker, reqs chan
 }
 
 func (s *scanner) isScanRequired() bool {
-	return s.scanningLastStart.IsZero() || time.Since(s.scanningLastStart) > s.scanMinInterval/20 // check 20 times per minInterval, so every 30 minutes
+	minInterval, hostInterval := s.scanIntervals(s.ap.state.cfg)
+	if hostInterval < minInterval {
+		minInterval = hostInterval
+	}
+	return s.scanningLastStart.IsZero() || time.Since(s.scanningLastStart) > minInterval/20 // check 20 times per minInterval, so every 30 minutes
+}
+
+// scanIntervals returns the intervals at which hosts in the contract set and
+// all other hosts are rescanned.
+func (s *scanner) scanIntervals(cfg api.AutopilotConfig) (contractHostInterval, hostInterval time.Duration) {
+	contractHostInterval, hostInterval = s.scanMinInterval, s.scanMinInterval
+	if cfg.Scanner.ContractHostInterval > 0 {
+		contractHostInterval = cfg.Scanner.ContractHostInterval
+	}
+	if cfg.Scanner.HostInterval > 0 {
+		hostInterval = cfg.Scanner.HostInterval
+	}
+	return
 }
 
 func (s *scanner) isTimeoutUpdateRequired() bool {
 	return s.timeoutLastUpdate.IsZero() || time.Since(s.timeoutLastUpdate) > s.timeoutMinInterval
 }
 
-func (s *scanner) currentTimeout() time.Duration {
+func (s *scanner) currentTimeout(cfg api.AutopilotConfig) time.Duration {
+	if cfg.Scanner.Timeout > 0 {
+		return cfg.Scanner.Timeout
+	}
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	return s.timeout
 }
+
+// status returns the progress of the current, or last, scan cycle.
+func (s *scanner) status(cfg api.AutopilotConfig) api.ScannerStatus {
+	timeout := s.currentTimeout(cfg)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := api.ScannerStatus{
+		Scanning:  s.scanning,
+		LastStart: s.scanningLastStart,
+		Scanned:   s.scanned,
+		Timeout:   timeout,
+	}
+	if s.queued > s.scanned {
+		status.Remaining = s.queued - s.scanned
+	}
+	return status
+}
@@ -17,8 +17,13 @@ import (
 )
 
 type mockBus struct {
-	hosts []hostdb.Host
-	reqs  []string
+	contracts []api.ContractMetadata
+	hosts     []hostdb.Host
+	reqs      []string
+}
+
+func (b *mockBus) Contracts(ctx context.Context, set string) ([]api.ContractMetadata, error) {
+	return b.contracts, nil
 }
 
 func (b *mockBus) Hosts(ctx context.Context, offset, limit int) ([]hostdb.Host, error) {
@@ -56,6 +61,38 @@ func (b *mockBus) RemoveOfflineHosts(ctx context.Context, minRecentScanFailures
 	return 0, nil
 }
 
+type mockStore struct {
+	mu    sync.Mutex
+	cfg   api.AutopilotConfig
+	state api.AutopilotState
+}
+
+func (s *mockStore) Config() api.AutopilotConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg
+}
+
+func (s *mockStore) SetConfig(c api.AutopilotConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cfg = c
+	return nil
+}
+
+func (s *mockStore) AutopilotState(ctx context.Context) (api.AutopilotState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state, nil
+}
+
+func (s *mockStore) UpdateAutopilotState(ctx context.Context, state api.AutopilotState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = state
+	return nil
+}
+
 type mockWorker struct {
 	blockChan chan struct{}
 
@@ -109,6 +146,13 @@ func TestScanner(t *testing.T) {
 		t.Fatal("unexpected")
 	}
 
+	// assert the start of the scan was persisted
+	if state, err := s.ap.stateStore.AutopilotState(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if !state.LastScan.Equal(s.scanningLastStart) {
+		t.Fatal("unexpected last scan", state.LastScan)
+	}
+
 	// assert the scanner made 3 batch reqs
 	if len(b.reqs) != 3 {
 		t.Fatalf("unexpected number of requests, %v != 3", len(b.reqs))
@@ -138,10 +182,66 @@ func TestScanner(t *testing.T) {
 	}
 }
 
+func TestScannerTiers(t *testing.T) {
+	// prepare 10 hosts, we have a contract with the first 3
+	hosts := newTestHosts(10)
+	b := &mockBus{hosts: hosts}
+	for _, h := range hosts[:3] {
+		b.contracts = append(b.contracts, api.ContractMetadata{HostKey: h.PublicKey})
+	}
+
+	// configure a different interval for hosts in the contract set
+	w := &mockWorker{}
+	s := newTestScanner(b, w)
+	s.ap.state.cfg.Scanner.ContractHostInterval = time.Second
+	s.ap.state.cfg.Scanner.Threads = 2
+
+	// assert every host is scanned exactly once, the mock bus doesn't
+	// filter by last scan so every pass returns all hosts
+	s.tryPerformHostScan(context.Background(), w)
+	for s.isScanning() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if w.scanCount != 10 {
+		t.Fatalf("unexpected number of scans, %v != 10", w.scanCount)
+	}
+
+	// assert the status reflects the scan cycle
+	if status := s.status(s.ap.state.cfg); status.Scanning || status.Scanned != 10 || status.Remaining != 0 {
+		t.Fatal("unexpected status", status)
+	}
+}
+
+func TestResumeState(t *testing.T) {
+	store := &mockStore{state: api.AutopilotState{
+		CurrentPeriod: 100,
+		LastScan:      time.Now().Add(-time.Hour),
+	}}
+	ap, err := New(store, nil, nil, zap.NewNop(), time.Minute, 24*time.Hour, 10, 1, 0.75, time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ap.stateStore = store
+
+	// assert the autopilot resumes from the persisted state
+	if err := ap.loadState(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if ap.c.currentPeriod() != 100 {
+		t.Fatal("unexpected current period", ap.c.currentPeriod())
+	} else if !ap.s.scanningLastStart.Equal(store.state.LastScan) {
+		t.Fatal("unexpected last scan", ap.s.scanningLastStart)
+	} else if ap.persistedState() != store.state {
+		t.Fatal("unexpected state", ap.persistedState())
+	}
+}
+
 func newTestScanner(b *mockBus, w *mockWorker) *scanner {
+	store := &mockStore{}
 	ap := &Autopilot{
-		state:    loopState{cfg: api.DefaultAutopilotConfig()},
-		stopChan: make(chan struct{}),
+		state:      loopState{cfg: api.DefaultAutopilotConfig()},
+		store:      store,
+		stateStore: store,
+		stopChan:   make(chan struct{}),
 	}
 	return &scanner{
 		ap:     ap,
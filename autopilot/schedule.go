@@ -0,0 +1,107 @@
+package autopilot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+// eventsResubscribeInterval is the time the autopilot waits before it
+// subscribes to the bus' events again after the stream ended.
+const eventsResubscribeInterval = 10 * time.Second
+
+// contractRenewalKey is the key of the event scheduled for the renewal of a
+// contract.
+func contractRenewalKey(id types.FileContractID) string {
+	return fmt.Sprintf("contract_renewal_%v", id)
+}
+
+// contractRenewalEvents returns the renewal events of the contracts that
+// didn't enter their renew window yet. The contracts that did are renewed by
+// the contract maintenance of the current iteration.
+func contractRenewalEvents(contracts []api.ContractMetadata, renewWindow, bh uint64) (events []api.ScheduledEvent) {
+	for _, c := range contracts {
+		if c.WindowStart <= renewWindow || c.WindowStart-renewWindow <= bh {
+			continue
+		}
+		data, err := json.Marshal(api.EventContractDueData{ContractID: c.ID})
+		if err != nil {
+			panic(err) // should never happen
+		}
+		events = append(events, api.ScheduledEvent{
+			Key:    contractRenewalKey(c.ID),
+			Height: c.WindowStart - renewWindow,
+			Type:   api.EventContractRenewalDue,
+			Data:   data,
+		})
+	}
+	return
+}
+
+// scheduleContractEvents schedules the revision broadcasts and renewals of the
+// active contracts with the bus, which notifies the autopilot once they are
+// due. Scheduling an event replaces the event that was scheduled for the
+// contract before, so changes to the renew window are picked up.
+func (ap *Autopilot) scheduleContractEvents(ctx context.Context) {
+	contracts, err := ap.bus.ActiveContracts(ctx)
+	if err != nil {
+		ap.logger.Errorf("failed to fetch active contracts, err: %v", err)
+		return
+	}
+	bh := ap.state.cs.BlockHeight
+	events := revisionBroadcastEvents(contracts, bh)
+	events = append(events, contractRenewalEvents(contracts, ap.state.cfg.Contracts.RenewWindow, bh)...)
+	if err := ap.bus.ScheduleEvents(ctx, events); err != nil {
+		ap.logger.Errorf("failed to schedule contract events, err: %v", err)
+	}
+}
+
+// handleScheduledEvents handles the events the autopilot scheduled with the
+// bus until the autopilot is stopped. Events that are due while the autopilot
+// isn't subscribed are missed, they are rescheduled by the next iteration.
+func (ap *Autopilot) handleScheduledEvents(stopChan chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stopChan
+		cancel()
+	}()
+
+	for {
+		events, err := ap.bus.Events(ctx, api.EventRevisionBroadcastDue, api.EventContractRenewalDue)
+		if err != nil && ctx.Err() == nil {
+			ap.logger.Errorf("failed to subscribe to scheduled events, err: %v", err)
+		} else if err == nil {
+			for e := range events {
+				ap.handleScheduledEvent(ctx, e)
+			}
+		}
+
+		select {
+		case <-stopChan:
+			return
+		case <-time.After(eventsResubscribeInterval):
+		}
+	}
+}
+
+func (ap *Autopilot) handleScheduledEvent(ctx context.Context, e api.Event) {
+	var data api.EventContractDueData
+	if err := json.Unmarshal(e.Data, &data); err != nil {
+		ap.logger.Errorw("failed to decode scheduled event", "type", e.Type, "err", err)
+		return
+	}
+	switch e.Type {
+	case api.EventRevisionBroadcastDue:
+		ap.workers.withWorker(func(w Worker) {
+			ap.b.broadcastRevision(ctx, w, data.ContractID)
+		})
+	case api.EventContractRenewalDue:
+		ap.logger.Debugw("contract entered its renew window", "fcid", data.ContractID)
+		ap.Trigger()
+	}
+}
@@ -0,0 +1,22 @@
+package autopilot
+
+import (
+	"testing"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+func TestContractRenewalEvents(t *testing.T) {
+	contracts := []api.ContractMetadata{
+		{ID: types.FileContractID{1}, WindowStart: 200}, // before the renew window
+		{ID: types.FileContractID{2}, WindowStart: 150}, // renew window opens at the current height
+		{ID: types.FileContractID{3}, WindowStart: 40},  // shorter than the renew window
+	}
+	events := contractRenewalEvents(contracts, 100, 50)
+	if len(events) != 1 {
+		t.Fatal("unexpected events", events)
+	} else if events[0].Key != contractRenewalKey(contracts[0].ID) || events[0].Height != 100 || events[0].Type != api.EventContractRenewalDue {
+		t.Fatal("unexpected event", events[0])
+	}
+}
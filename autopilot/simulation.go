@@ -0,0 +1,684 @@
+package autopilot
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	rhpv3 "go.sia.tech/core/rhp/v3"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/hostdb"
+	"go.sia.tech/renterd/wallet"
+	"go.uber.org/zap"
+	"lukechampine.com/frand"
+)
+
+const (
+	// simulationBlockTime is the time between two simulated blocks.
+	simulationBlockTime = 10 * time.Minute
+
+	// simulationStartHeight is the block height of the first iteration.
+	simulationStartHeight = 1
+
+	// simulationMaxHosts is the max number of hosts in a simulation, every
+	// host is given a net address in its own /24 subnet.
+	simulationMaxHosts = 1 << 16
+)
+
+const (
+	// SimulationEventFormed is recorded when a contract is formed.
+	SimulationEventFormed = "formed"
+	// SimulationEventRenewed is recorded when a contract is renewed.
+	SimulationEventRenewed = "renewed"
+	// SimulationEventRefreshed is recorded when a contract is refreshed.
+	SimulationEventRefreshed = "refreshed"
+	// SimulationEventDeleted is recorded when a contract is deleted.
+	SimulationEventDeleted = "deleted"
+)
+
+var (
+	errSimulatedContractNotFound = errors.New("simulated contract not found")
+	errSimulatedHostNotFound     = errors.New("simulated host not found")
+	errSimulatedHostUnreachable  = errors.New("simulated host is unreachable")
+)
+
+type (
+	// SimulationConfig configures a simulation of the autopilot's contract
+	// maintenance. Simulations with the same config produce the same result.
+	SimulationConfig struct {
+		// Seed seeds the RNG that generates the hosts, their uptime and the
+		// autopilot's host selection.
+		Seed uint64 `json:"seed"`
+
+		// Start is the time of the first iteration, every iteration advances
+		// the chain by BlocksPerIteration and the clock accordingly.
+		Start              time.Time `json:"start"`
+		Iterations         int       `json:"iterations"`
+		BlocksPerIteration uint64    `json:"blocksPerIteration"`
+
+		// Hosts is the number of hosts in the simulated hostdb, every host
+		// fails a scan with a probability that's drawn uniformly between zero
+		// and HostFailureRate.
+		Hosts           int     `json:"hosts"`
+		HostFailureRate float64 `json:"hostFailureRate"`
+
+		// UploadPerIteration is the amount of data, including redundancy,
+		// that's spread over the contract set in every iteration.
+		UploadPerIteration uint64 `json:"uploadPerIteration"`
+
+		Autopilot  api.AutopilotConfig    `json:"autopilot"`
+		Gouging    api.GougingSettings    `json:"gouging"`
+		Redundancy api.RedundancySettings `json:"redundancy"`
+		Fee        types.Currency         `json:"fee"`
+	}
+
+	// SimulationEvent is a decision the autopilot made during a simulation.
+	SimulationEvent struct {
+		Iteration   int                  `json:"iteration"`
+		BlockHeight uint64               `json:"blockHeight"`
+		Type        string               `json:"type"`
+		ContractID  types.FileContractID `json:"contractID"`
+		HostKey     types.PublicKey      `json:"hostKey"`
+		Funds       types.Currency       `json:"funds"`
+	}
+
+	// SimulationIteration describes the state after an iteration of a
+	// simulation.
+	SimulationIteration struct {
+		Time        time.Time              `json:"time"`
+		BlockHeight uint64                 `json:"blockHeight"`
+		ContractSet []types.FileContractID `json:"contractSet"`
+		StoredData  uint64                 `json:"storedData"`
+		Committed   types.Currency         `json:"committed"`
+		Remaining   types.Currency         `json:"remaining"`
+	}
+
+	// SimulationResult contains the decisions the autopilot made during a
+	// simulation and the state after every iteration.
+	SimulationResult struct {
+		Events     []SimulationEvent     `json:"events"`
+		Iterations []SimulationIteration `json:"iterations"`
+	}
+)
+
+// DefaultSimulationConfig returns a config that simulates two contract periods
+// with the default autopilot config and settings.
+func DefaultSimulationConfig() SimulationConfig {
+	cfg := api.DefaultAutopilotConfig()
+	cfg.Hosts.IgnoreRedundantIPs = false
+	return SimulationConfig{
+		Start:              time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		Iterations:         int(2 * cfg.Contracts.Period / 144),
+		BlocksPerIteration: 144,
+
+		Hosts:           300,
+		HostFailureRate: 0.1,
+
+		UploadPerIteration: 64 << 30,
+
+		Autopilot:  cfg,
+		Gouging:    api.DefaultGougingSettings,
+		Redundancy: api.DefaultRedundancySettings,
+		Fee:        types.Siacoins(1).Div64(1e8),
+	}
+}
+
+// Count returns the number of events of given type.
+func (r SimulationResult) Count(typ string) (n int) {
+	for _, e := range r.Events {
+		if e.Type == typ {
+			n++
+		}
+	}
+	return
+}
+
+// Simulate runs the autopilot's contract maintenance against a synthetic
+// hostdb, chain and wallet and records its decisions. The simulation uses a
+// fake clock and a seeded RNG, which makes it reproducible, so the effect of
+// changes to the host scoring or the contract maintenance can be compared by
+// running the same simulation before and after the change.
+func Simulate(ctx context.Context, cfg SimulationConfig, logger *zap.Logger) (SimulationResult, error) {
+	if cfg.Hosts <= 0 || cfg.Hosts > simulationMaxHosts {
+		return SimulationResult{}, fmt.Errorf("number of hosts must be between 1 and %d", simulationMaxHosts)
+	} else if cfg.Iterations <= 0 || cfg.BlocksPerIteration == 0 {
+		return SimulationResult{}, errors.New("simulation needs at least one iteration of at least one block")
+	} else if cfg.Autopilot.Contracts.Amount == 0 {
+		return SimulationResult{}, errors.New("autopilot config doesn't request any contracts")
+	} else if err := cfg.Redundancy.Validate(); err != nil {
+		return SimulationResult{}, err
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	// seed the rng
+	var seed [8]byte
+	binary.LittleEndian.PutUint64(seed[:], cfg.Seed)
+	hash := types.HashBytes(seed[:])
+	rng := frand.NewCustom(hash[:], 1024, 12)
+
+	s := &simulator{
+		cfg:       cfg,
+		rng:       rng,
+		now:       cfg.Start,
+		height:    simulationStartHeight,
+		renterKey: types.NewPrivateKeyFromSeed(hash[:]),
+
+		contracts: make(map[types.FileContractID]api.Contract),
+		archived:  make(map[types.FileContractID]api.Contract),
+		hostIndex: make(map[types.PublicKey]int),
+	}
+	s.address = wallet.StandardAddress(s.renterKey.PublicKey())
+	for i := 0; i < cfg.Hosts; i++ {
+		s.addHost(i)
+	}
+
+	b := &simBus{s: s}
+	ap := &Autopilot{
+		bus:        b,
+		logger:     logger.Sugar(),
+		store:      s,
+		stateStore: b,
+		workers:    newWorkerPool([]Worker{&simWorker{s: s}}),
+		stopChan:   make(chan struct{}),
+	}
+	ap.c = newContractor(ap)
+	ap.c.rng = rng
+
+	var res SimulationResult
+	for i := 0; i < cfg.Iterations; i++ {
+		s.iteration = i
+		s.now = cfg.Start.Add(time.Duration(uint64(i)*cfg.BlocksPerIteration) * simulationBlockTime)
+		s.height = simulationStartHeight + uint64(i)*cfg.BlocksPerIteration
+		s.scanHosts()
+
+		// NOTE: the loop state is fetched the same way the autopilot fetches
+		// it, but the current time is replaced by the simulated time
+		if err := ap.updateLoopState(ctx); err != nil {
+			return SimulationResult{}, err
+		}
+		ap.state.now = s.now
+
+		ap.c.updateCurrentPeriod()
+		var err error
+		ap.workers.withWorker(func(w Worker) {
+			err = ap.c.performContractMaintenance(ctx, w)
+		})
+		if err != nil {
+			return SimulationResult{}, fmt.Errorf("contract maintenance failed in iteration %d: %w", i, err)
+		}
+		s.upload()
+
+		committed, remaining := ap.c.allowanceStatus()
+		res.Iterations = append(res.Iterations, SimulationIteration{
+			Time:        s.now,
+			BlockHeight: s.height,
+			ContractSet: append([]types.FileContractID(nil), s.set...),
+			StoredData:  s.storedData(),
+			Committed:   committed,
+			Remaining:   remaining,
+		})
+	}
+	res.Events = s.events
+	return res, nil
+}
+
+type (
+	// simulator holds the synthetic state the autopilot operates on during a
+	// simulation. It implements the autopilot's Store, the Bus and Worker
+	// are implemented by simBus and simWorker.
+	simulator struct {
+		cfg SimulationConfig
+		rng *frand.RNG
+
+		iteration int
+		now       time.Time
+		height    uint64
+
+		renterKey types.PrivateKey
+		address   types.Address
+
+		hosts       []hostdb.Host
+		hostIndex   map[types.PublicKey]int
+		failureRate []float64
+
+		// contracts and set are kept in order so the autopilot's decisions
+		// don't depend on map iteration order
+		active    []types.FileContractID
+		contracts map[types.FileContractID]api.Contract
+		archived  map[types.FileContractID]api.Contract
+		set       []types.FileContractID
+
+		state  api.AutopilotState
+		events []SimulationEvent
+	}
+
+	// simBus implements the parts of the Bus the contract maintenance uses,
+	// calling any other method panics.
+	simBus struct {
+		Bus
+		s *simulator
+	}
+
+	// simWorker implements the parts of the Worker the contract maintenance
+	// uses, calling any other method panics.
+	simWorker struct {
+		Worker
+		s *simulator
+	}
+)
+
+func (s *simulator) Config() api.AutopilotConfig           { return s.cfg.Autopilot }
+func (s *simulator) SetConfig(c api.AutopilotConfig) error { s.cfg.Autopilot = c; return nil }
+func (s *simulator) scale(c types.Currency, min, max float64) types.Currency {
+	return c.Mul64(uint64((min + s.rng.Float64()*(max-min)) * 1e3)).Div64(1e3)
+}
+
+// addHost adds a host with randomized prices, age and reliability to the
+// hostdb.
+func (s *simulator) addHost(i int) {
+	var hk types.PublicKey
+	s.rng.Read(hk[:])
+
+	perTB := types.Siacoins(1).Div64(1e12)
+	perTBMonth := perTB.Div64(144 * 30)
+	storagePrice := s.scale(perTBMonth, 50, 400)
+	contractPrice := s.scale(types.Siacoins(1), 0.1, 1)
+	if s.rng.Float64() < 0.05 {
+		contractPrice = s.scale(types.Siacoins(1), 10, 30) // some hosts are too expensive
+	}
+	version := "1.6.0"
+	if s.rng.Float64() < 0.1 {
+		version = "1.5.9"
+	}
+
+	settings := rhpv2.HostSettings{
+		AcceptingContracts:         true,
+		BaseRPCPrice:               types.Siacoins(1).Div64(1e7),
+		Collateral:                 storagePrice.Mul64(2),
+		ContractPrice:              contractPrice,
+		DownloadBandwidthPrice:     s.scale(perTB, 10, 500),
+		MaxCollateral:              s.scale(types.Siacoins(1), 500, 5000),
+		MaxDownloadBatchSize:       1 << 26,
+		MaxDuration:                144 * 7 * 52,
+		MaxEphemeralAccountBalance: types.Siacoins(1),
+		MaxReviseBatchSize:         1 << 26,
+		NetAddress:                 fmt.Sprintf("10.%d.%d.1:9982", i/256, i%256),
+		RemainingStorage:           (1 + s.rng.Uint64n(16)) << 40,
+		SectorAccessPrice:          types.Siacoins(1).Div64(1e8),
+		SectorSize:                 rhpv2.SectorSize,
+		SiaMuxPort:                 "9983",
+		StoragePrice:               storagePrice,
+		UploadBandwidthPrice:       s.scale(perTB, 0, 50),
+		Version:                    version,
+		WindowSize:                 144,
+	}
+	settings.TotalStorage = settings.RemainingStorage
+
+	s.hostIndex[hk] = len(s.hosts)
+	s.failureRate = append(s.failureRate, s.rng.Float64()*s.cfg.HostFailureRate)
+	s.hosts = append(s.hosts, hostdb.Host{
+		KnownSince: s.now.Add(-time.Duration(s.rng.Intn(365*24)) * time.Hour),
+		NetAddress: settings.NetAddress,
+		PublicKey:  hk,
+		Settings:   &settings,
+		PriceTable: s.priceTable(settings),
+	})
+}
+
+// priceTable returns a price table that matches the given settings.
+func (s *simulator) priceTable(settings rhpv2.HostSettings) *rhpv3.HostPriceTable {
+	return &rhpv3.HostPriceTable{
+		Validity:              time.Hour,
+		HostBlockHeight:       s.height,
+		InitBaseCost:          settings.BaseRPCPrice,
+		ContractPrice:         settings.ContractPrice,
+		ReadBaseCost:          settings.SectorAccessPrice,
+		DownloadBandwidthCost: settings.DownloadBandwidthPrice,
+		UploadBandwidthCost:   settings.UploadBandwidthPrice,
+		WriteStoreCost:        settings.StoragePrice,
+		CollateralCost:        settings.Collateral,
+		MaxCollateral:         settings.MaxCollateral,
+		MaxDuration:           settings.MaxDuration,
+		WindowSize:            settings.WindowSize,
+	}
+}
+
+// scanHosts scans every host, the outcome depends on the host's failure rate.
+func (s *simulator) scanHosts() {
+	for i := range s.hosts {
+		h := &s.hosts[i]
+		success := s.rng.Float64() >= s.failureRate[i]
+
+		if !h.Interactions.LastScan.IsZero() {
+			if h.Interactions.LastScanSuccess {
+				h.Interactions.Uptime += s.now.Sub(h.Interactions.LastScan)
+			} else {
+				h.Interactions.Downtime += s.now.Sub(h.Interactions.LastScan)
+			}
+		}
+		h.Interactions.TotalScans++
+		h.Interactions.SecondToLastScanSuccess = h.Interactions.LastScanSuccess
+		h.Interactions.LastScanSuccess = success
+		h.Interactions.LastScan = s.now
+		if success {
+			h.Interactions.SuccessfulInteractions++
+		} else {
+			h.Interactions.FailedInteractions++
+		}
+		h.PriceTable.HostBlockHeight = s.height
+	}
+}
+
+// reachable returns the host with given key if it can be reached in the
+// current iteration.
+func (s *simulator) reachable(hk types.PublicKey) (hostdb.Host, error) {
+	i, ok := s.hostIndex[hk]
+	if !ok {
+		return hostdb.Host{}, errSimulatedHostNotFound
+	} else if !s.hosts[i].Interactions.LastScanSuccess {
+		return hostdb.Host{}, errSimulatedHostUnreachable
+	}
+	return s.hosts[i], nil
+}
+
+// upload spreads the data uploaded in an iteration evenly over the contracts
+// in the set that are good for upload, contracts that can't pay for their
+// share are skipped.
+func (s *simulator) upload() {
+	var usable []types.FileContractID
+	for _, fcid := range s.set {
+		if c, ok := s.contracts[fcid]; ok && c.GoodForUpload {
+			usable = append(usable, fcid)
+		}
+	}
+	if len(usable) == 0 || s.cfg.UploadPerIteration == 0 {
+		return
+	}
+
+	size := s.cfg.UploadPerIteration / uint64(len(usable))
+	size -= size % rhpv2.SectorSize
+	for _, fcid := range usable {
+		c := s.contracts[fcid]
+		settings := *s.hosts[s.hostIndex[c.HostKey()]].Settings
+		if c.EndHeight() <= s.height {
+			continue
+		}
+
+		cost := settings.UploadBandwidthPrice.Mul64(size).Add(settings.StoragePrice.Mul64(size).Mul64(c.EndHeight() - s.height))
+		if c.RenterFunds().Cmp(cost) < 0 {
+			continue
+		}
+		rev := c.Revision
+		rev.ValidProofOutputs = append([]types.SiacoinOutput(nil), rev.ValidProofOutputs...)
+		rev.MissedProofOutputs = append([]types.SiacoinOutput(nil), rev.MissedProofOutputs...)
+		rev.ValidProofOutputs[0].Value = rev.ValidProofOutputs[0].Value.Sub(cost)
+		rev.ValidProofOutputs[1].Value = rev.ValidProofOutputs[1].Value.Add(cost)
+		rev.MissedProofOutputs[0].Value = rev.MissedProofOutputs[0].Value.Sub(cost)
+		rev.MissedProofOutputs[2].Value = rev.MissedProofOutputs[2].Value.Add(cost)
+		rev.Filesize += size
+		rev.RevisionNumber++
+
+		c.Revision = rev
+		c.RevisionNumber = rev.RevisionNumber
+		c.LatestRevisionNumber = rev.RevisionNumber
+		c.RemainingFunds = rev.ValidRenterPayout()
+		c.Spending.Uploads = c.Spending.Uploads.Add(cost)
+		s.contracts[fcid] = c
+	}
+}
+
+func (s *simulator) storedData() (n uint64) {
+	for _, fcid := range s.set {
+		if c, ok := s.contracts[fcid]; ok {
+			n += c.FileSize()
+		}
+	}
+	return
+}
+
+// addContract adds a contract with given revision to the active contracts.
+func (s *simulator) addContract(rev rhpv2.ContractRevision, totalCost types.Currency, startHeight uint64, renewedFrom types.FileContractID) api.Contract {
+	hk := rev.HostKey()
+	c := api.Contract{
+		ContractMetadata: api.ContractMetadata{
+			ID:             rev.ID(),
+			HostIP:         s.hosts[s.hostIndex[hk]].NetAddress,
+			HostKey:        hk,
+			RevisionNumber: rev.Revision.RevisionNumber,
+			StartHeight:    startHeight,
+			WindowStart:    rev.Revision.WindowStart,
+			WindowEnd:      rev.Revision.WindowEnd,
+			RenewedFrom:    renewedFrom,
+			TotalCost:      totalCost,
+			RemainingFunds: rev.Revision.ValidRenterPayout(),
+
+			LatestRevisionNumber: rev.Revision.RevisionNumber,
+		},
+		Revision: rev.Revision,
+	}
+	s.contracts[c.ID] = c
+	s.active = append(s.active, c.ID)
+	return c
+}
+
+// archiveContract moves the contract with given id to the archive.
+func (s *simulator) archiveContract(fcid types.FileContractID) (api.Contract, bool) {
+	c, ok := s.contracts[fcid]
+	if !ok {
+		return api.Contract{}, false
+	}
+	delete(s.contracts, fcid)
+	for i, id := range s.active {
+		if id == fcid {
+			s.active = append(s.active[:i], s.active[i+1:]...)
+			break
+		}
+	}
+	s.archived[fcid] = c
+	return c, true
+}
+
+func (s *simulator) recordEvent(typ string, fcid types.FileContractID, hk types.PublicKey, funds types.Currency) {
+	s.events = append(s.events, SimulationEvent{
+		Iteration:   s.iteration,
+		BlockHeight: s.height,
+		Type:        typ,
+		ContractID:  fcid,
+		HostKey:     hk,
+		Funds:       funds,
+	})
+}
+
+// revision returns a revision of the given contract signed by the renter and
+// the host.
+func (s *simulator) revision(fc types.FileContract, hk types.PublicKey) rhpv2.ContractRevision {
+	var fcid types.FileContractID
+	s.rng.Read(fcid[:])
+	fc.RevisionNumber = 1
+	return rhpv2.ContractRevision{
+		Revision: types.FileContractRevision{
+			ParentID: fcid,
+			UnlockConditions: types.UnlockConditions{
+				PublicKeys: []types.UnlockKey{
+					s.renterKey.PublicKey().UnlockKey(),
+					hk.UnlockKey(),
+				},
+				SignaturesRequired: 2,
+			},
+			FileContract: fc,
+		},
+	}
+}
+
+func (b *simBus) WalletAddress(ctx context.Context) (types.Address, error) {
+	return b.s.address, nil
+}
+
+func (b *simBus) ConsensusState(ctx context.Context) (api.ConsensusState, error) {
+	return api.ConsensusState{BlockHeight: b.s.height, Synced: true}, nil
+}
+
+func (b *simBus) GougingSettings(ctx context.Context) (api.GougingSettings, error) {
+	return b.s.cfg.Gouging, nil
+}
+
+func (b *simBus) RedundancySettings(ctx context.Context) (api.RedundancySettings, error) {
+	return b.s.cfg.Redundancy, nil
+}
+
+func (b *simBus) RecommendedFee(ctx context.Context) (types.Currency, error) {
+	return b.s.cfg.Fee, nil
+}
+
+func (b *simBus) AutopilotState(ctx context.Context) (api.AutopilotState, error) {
+	return b.s.state, nil
+}
+
+func (b *simBus) UpdateAutopilotState(ctx context.Context, state api.AutopilotState) error {
+	b.s.state = state
+	return nil
+}
+
+func (b *simBus) RaiseAlert(ctx context.Context, id, severity, msg string) error { return nil }
+func (b *simBus) ResolveAlert(ctx context.Context, id string) error              { return nil }
+
+func (b *simBus) Host(ctx context.Context, hk types.PublicKey) (hostdb.HostInfo, error) {
+	i, ok := b.s.hostIndex[hk]
+	if !ok {
+		return hostdb.HostInfo{}, errSimulatedHostNotFound
+	}
+	return hostdb.HostInfo{Host: b.s.hosts[i]}, nil
+}
+
+func (b *simBus) Hosts(ctx context.Context, offset, limit int) ([]hostdb.Host, error) {
+	if offset >= len(b.s.hosts) {
+		return nil, nil
+	}
+	hosts := b.s.hosts[offset:]
+	if limit >= 0 && limit < len(hosts) {
+		hosts = hosts[:limit]
+	}
+	return append([]hostdb.Host(nil), hosts...), nil
+}
+
+func (b *simBus) AddContract(ctx context.Context, rev rhpv2.ContractRevision, totalCost types.Currency, startHeight uint64) (api.ContractMetadata, error) {
+	c := b.s.addContract(rev, totalCost, startHeight, types.FileContractID{})
+	b.s.recordEvent(SimulationEventFormed, c.ID, c.HostKey(), totalCost)
+	return c.ContractMetadata, nil
+}
+
+func (b *simBus) AddRenewedContract(ctx context.Context, rev rhpv2.ContractRevision, totalCost types.Currency, startHeight uint64, renewedFrom types.FileContractID) (api.ContractMetadata, error) {
+	old, ok := b.s.archiveContract(renewedFrom)
+	if !ok {
+		return api.ContractMetadata{}, errSimulatedContractNotFound
+	}
+	c := b.s.addContract(rev, totalCost, startHeight, renewedFrom)
+
+	typ := SimulationEventRenewed
+	if c.EndHeight() == old.EndHeight() {
+		typ = SimulationEventRefreshed
+	}
+	b.s.recordEvent(typ, c.ID, c.HostKey(), totalCost)
+	return c.ContractMetadata, nil
+}
+
+func (b *simBus) AncestorContracts(ctx context.Context, fcid types.FileContractID, minStartHeight uint64) (ancestors []api.ArchivedContract, _ error) {
+	c, ok := b.s.contracts[fcid]
+	if !ok {
+		return nil, errSimulatedContractNotFound
+	}
+	for id := c.RenewedFrom; id != (types.FileContractID{}); {
+		ancestor, ok := b.s.archived[id]
+		if !ok || ancestor.StartHeight < minStartHeight {
+			break
+		}
+		ancestors = append(ancestors, api.ArchivedContract{
+			ID:             ancestor.ID,
+			HostKey:        ancestor.HostKey(),
+			RenewedTo:      fcid,
+			Spending:       ancestor.Spending,
+			RevisionNumber: ancestor.RevisionNumber,
+			StartHeight:    ancestor.StartHeight,
+			WindowStart:    ancestor.WindowStart,
+			WindowEnd:      ancestor.WindowEnd,
+		})
+		fcid, id = id, ancestor.RenewedFrom
+	}
+	return ancestors, nil
+}
+
+func (b *simBus) DeleteContracts(ctx context.Context, ids []types.FileContractID) error {
+	for _, fcid := range ids {
+		if c, ok := b.s.archiveContract(fcid); ok {
+			b.s.recordEvent(SimulationEventDeleted, c.ID, c.HostKey(), types.ZeroCurrency)
+		}
+	}
+	return nil
+}
+
+func (b *simBus) SetContractSet(ctx context.Context, set string, contracts []types.FileContractID) error {
+	b.s.set = append([]types.FileContractID(nil), contracts...)
+	return nil
+}
+
+func (b *simBus) UpdateContractUsability(ctx context.Context, updates []api.ContractUsabilityUpdate) error {
+	for _, u := range updates {
+		if c, ok := b.s.contracts[u.ContractID]; ok {
+			c.ContractUsability = u.ContractUsability
+			b.s.contracts[u.ContractID] = c
+		}
+	}
+	return nil
+}
+
+func (w *simWorker) ActiveContracts(ctx context.Context, hostTimeout time.Duration) (api.ContractsResponse, error) {
+	contracts := make([]api.Contract, 0, len(w.s.active))
+	for _, fcid := range w.s.active {
+		contracts = append(contracts, w.s.contracts[fcid])
+	}
+	return api.ContractsResponse{Contracts: contracts}, nil
+}
+
+func (w *simWorker) RHPPriceTable(ctx context.Context, hk types.PublicKey, siamuxAddr string) (rhpv3.HostPriceTable, error) {
+	h, err := w.s.reachable(hk)
+	if err != nil {
+		return rhpv3.HostPriceTable{}, err
+	}
+	return *h.PriceTable, nil
+}
+
+func (w *simWorker) RHPScan(ctx context.Context, hk types.PublicKey, hostIP string, timeout time.Duration) (api.RHPScanResponse, error) {
+	h, err := w.s.reachable(hk)
+	if err != nil {
+		return api.RHPScanResponse{}, err
+	}
+	return api.RHPScanResponse{Settings: *h.Settings}, nil
+}
+
+func (w *simWorker) RHPForm(ctx context.Context, endHeight uint64, hk types.PublicKey, hostIP string, renterAddress types.Address, renterFunds, hostCollateral types.Currency) (rhpv2.ContractRevision, []types.Transaction, error) {
+	h, err := w.s.reachable(hk)
+	if err != nil {
+		return rhpv2.ContractRevision{}, nil, err
+	}
+	fc := rhpv2.PrepareContractFormation(w.s.renterKey, hk, renterFunds, hostCollateral, endHeight, *h.Settings, renterAddress)
+	return w.s.revision(fc, hk), nil, nil
+}
+
+func (w *simWorker) RHPRenew(ctx context.Context, fcid types.FileContractID, endHeight uint64, hk types.PublicKey, hostIP string, renterAddress types.Address, renterFunds, newCollateral types.Currency) (rhpv2.ContractRevision, []types.Transaction, error) {
+	h, err := w.s.reachable(hk)
+	if err != nil {
+		return rhpv2.ContractRevision{}, nil, err
+	}
+	c, ok := w.s.contracts[fcid]
+	if !ok {
+		return rhpv2.ContractRevision{}, nil, errSimulatedContractNotFound
+	}
+	fc, _ := rhpv2.PrepareContractRenewal(c.Revision, renterAddress, w.s.renterKey, renterFunds, newCollateral, hk, *h.Settings, endHeight)
+	return w.s.revision(fc, hk), nil, nil
+}
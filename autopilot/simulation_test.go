@@ -0,0 +1,58 @@
+package autopilot
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.sia.tech/core/types"
+)
+
+func TestSimulate(t *testing.T) {
+	cfg := DefaultSimulationConfig()
+	cfg.Hosts = 50
+	cfg.Autopilot.Contracts.Amount = 10
+	cfg.Autopilot.Contracts.Allowance = types.Siacoins(500)
+	cfg.Autopilot.Contracts.Period = 144 * 7
+	cfg.Autopilot.Contracts.RenewWindow = 144 * 2
+	cfg.Iterations = 2 * int(cfg.Autopilot.Contracts.Period) / 144
+	cfg.UploadPerIteration = 256 << 30
+
+	res, err := Simulate(context.Background(), cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(res.Iterations) != cfg.Iterations {
+		t.Fatalf("expected %d iterations, got %d", cfg.Iterations, len(res.Iterations))
+	}
+
+	// the autopilot should form the requested contracts right away and keep
+	// the set full by renewing them
+	if n := len(res.Iterations[0].ContractSet); n != int(cfg.Autopilot.Contracts.Amount) {
+		t.Fatal("unexpected number of contracts after first iteration", n)
+	} else if res.Count(SimulationEventFormed) < int(cfg.Autopilot.Contracts.Amount) {
+		t.Fatal("expected contracts to be formed", res.Count(SimulationEventFormed))
+	} else if res.Count(SimulationEventRenewed) == 0 {
+		t.Fatal("expected contracts to be renewed")
+	} else if res.Count(SimulationEventRefreshed) == 0 {
+		t.Fatal("expected contracts to be refreshed")
+	} else if last := res.Iterations[len(res.Iterations)-1]; last.StoredData == 0 {
+		t.Fatal("expected data to be stored")
+	}
+
+	// the same seed should yield the same decisions
+	res2, err := Simulate(context.Background(), cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(res, res2) {
+		t.Fatal("simulation isn't deterministic")
+	}
+
+	// a different seed shouldn't
+	cfg.Seed++
+	res3, err := Simulate(context.Background(), cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if reflect.DeepEqual(res.Events, res3.Events) {
+		t.Fatal("expected different decisions for a different seed")
+	}
+}
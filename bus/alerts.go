@@ -0,0 +1,334 @@
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.uber.org/zap"
+)
+
+const (
+	// alertWatchInterval is the interval at which the alert thresholds are
+	// evaluated.
+	alertWatchInterval = time.Minute
+
+	// alertWebhookTimeout is the timeout for pushing an alert event to the
+	// configured webhook.
+	alertWebhookTimeout = 30 * time.Second
+
+	// alertMaxUnhealthySlabs is the maximum number of unhealthy slabs that
+	// are fetched when checking the slab health threshold.
+	alertMaxUnhealthySlabs = 1000
+)
+
+const (
+	alertIDWalletBalance = "wallet_balance"
+	alertIDWalletNeed    = "wallet_need"
+	alertIDContracts     = "contracts"
+	alertIDSlabHealth    = "slab_health"
+	alertIDHostChurn     = "host_churn"
+
+	// alertIDWrappedSlabHealth is the ID of the alert raised when slabs of
+	// passphrase protected objects drop below the slab health threshold,
+	// they aren't migrated so their objects have to be re-uploaded.
+	alertIDWrappedSlabHealth = "slab_health_wrapped"
+
+	// alertIDSectorsLost is the ID of the notification pushed when sectors
+	// failed their audit.
+	alertIDSectorsLost = "sectors_lost"
+
+	// alertIDContractFundsPrefix is the prefix of the per-contract alerts
+	// raised when a contract runs low on funds.
+	alertIDContractFundsPrefix = "contract_funds_"
+
+	// alertIDObjectCorruptPrefix is the prefix of the per-object alerts
+	// raised when an object's data doesn't match its ETag. They aren't
+	// resolved automatically since corrupt data can't be repaired.
+	alertIDObjectCorruptPrefix = "object_corrupt_"
+)
+
+// An alerter keeps track of the active alerts and pushes alert events to the
+// webhook configured in the alert settings.
+type alerter struct {
+	ss     SettingStore
+	events *eventBroadcaster
+	logger *zap.SugaredLogger
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+
+	mu     sync.Mutex
+	active map[string]api.Alert
+}
+
+func newAlerter(ss SettingStore, events *eventBroadcaster, l *zap.SugaredLogger) *alerter {
+	return &alerter{
+		ss:       ss,
+		events:   events,
+		logger:   l,
+		stopChan: make(chan struct{}),
+		active:   make(map[string]api.Alert),
+	}
+}
+
+// Alerts returns the active alerts, sorted by the time they were raised.
+func (a *alerter) Alerts() []api.Alert {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	alerts := make([]api.Alert, 0, len(a.active))
+	for _, alert := range a.active {
+		alerts = append(alerts, alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Raised.Equal(alerts[j].Raised) {
+			return alerts[i].ID < alerts[j].ID
+		}
+		return alerts[i].Raised.Before(alerts[j].Raised)
+	})
+	return alerts
+}
+
+// Raise raises the alert with given id. If it's already active only its
+// message is updated and no event is pushed.
+func (a *alerter) Raise(id, severity, msg string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if alert, ok := a.active[id]; ok {
+		alert.Severity = severity
+		alert.Message = msg
+		a.active[id] = alert
+		return
+	}
+	alert := api.Alert{
+		ID:       id,
+		Severity: severity,
+		Message:  msg,
+		Raised:   time.Now(),
+	}
+	a.active[id] = alert
+	a.logger.Warnw("alert raised", "id", id, "severity", severity, "message", msg)
+	a.events.Broadcast(api.EventAlertRaised, alert)
+	a.push(api.AlertEvent{Event: api.AlertEventRaised, Alert: alert})
+}
+
+// Resolve resolves the alert with given id, it's a no-op if the alert isn't
+// active.
+func (a *alerter) Resolve(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	alert, ok := a.active[id]
+	if !ok {
+		return
+	}
+	delete(a.active, id)
+	a.logger.Infow("alert resolved", "id", id)
+	a.push(api.AlertEvent{Event: api.AlertEventResolved, Alert: alert})
+}
+
+// Notify pushes a one-off event with given id, unlike raised alerts it doesn't
+// become active.
+func (a *alerter) Notify(id, severity, msg string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	alert := api.Alert{
+		ID:       id,
+		Severity: severity,
+		Message:  msg,
+		Raised:   time.Now(),
+	}
+	a.logger.Infow("notification", "id", id, "severity", severity, "message", msg)
+	a.push(api.AlertEvent{Event: api.AlertEventNotified, Alert: alert})
+}
+
+// push pushes the event to the webhook in the alert settings, if any, in a
+// separate goroutine.
+func (a *alerter) push(event api.AlertEvent) {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), alertWebhookTimeout)
+		defer cancel()
+		as, err := alertSettings(ctx, a.ss)
+		if err != nil {
+			a.logger.Errorw("failed to fetch alert settings", "error", err)
+			return
+		} else if as.WebhookURL == "" {
+			return
+		}
+		if err := postWebhook(ctx, as.WebhookURL, event); err != nil {
+			a.logger.Errorw("failed to push alert event", "id", event.Alert.ID, "error", err)
+		}
+	}()
+}
+
+// watch calls check at the given interval until the alerter is shut down.
+func (a *alerter) watch(interval time.Duration, check func(context.Context)) {
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-a.stopChan:
+				return
+			case <-t.C:
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			check(ctx)
+			cancel()
+		}
+	}()
+}
+
+// Shutdown stops watching the thresholds and waits for pending events to be
+// pushed.
+func (a *alerter) Shutdown() {
+	close(a.stopChan)
+	a.wg.Wait()
+}
+
+// alertSettings returns the alert settings, they're empty if not set.
+func alertSettings(ctx context.Context, ss SettingStore) (as api.AlertSettings, err error) {
+	setting, err := ss.Setting(ctx, SettingAlerts)
+	if errors.Is(err, api.ErrSettingNotFound) {
+		return api.AlertSettings{}, nil
+	} else if err != nil {
+		return api.AlertSettings{}, err
+	}
+	err = json.Unmarshal([]byte(setting), &as)
+	return
+}
+
+// checkAlertThresholds evaluates the thresholds in the alert settings and
+// raises or resolves the corresponding alerts.
+func (b *bus) checkAlertThresholds(ctx context.Context) {
+	as, err := alertSettings(ctx, b.ss)
+	if err != nil {
+		b.logger.Errorw("failed to fetch alert settings", "error", err)
+		return
+	}
+
+	// wallet balance
+	if balance := b.w.Balance(); !as.MinWalletBalance.IsZero() && balance.Cmp(as.MinWalletBalance) < 0 {
+		b.alerts.Raise(alertIDWalletBalance, api.AlertSeverityCritical, fmt.Sprintf("wallet balance %v is below %v", balance, as.MinWalletBalance))
+	} else {
+		b.alerts.Resolve(alertIDWalletBalance)
+	}
+
+	// host churn
+	if lost := b.reporter.report().HostsLost; as.MaxHostChurn > 0 && lost > as.MaxHostChurn {
+		b.alerts.Raise(alertIDHostChurn, api.AlertSeverityWarning, fmt.Sprintf("%v hosts were lost today, more than %v", lost, as.MaxHostChurn))
+	} else {
+		b.alerts.Resolve(alertIDHostChurn)
+	}
+
+	// contracts, wallet need and slab health, they depend on the contract set
+	set, err := b.ss.Setting(ctx, SettingContractSet)
+	if errors.Is(err, api.ErrSettingNotFound) {
+		b.alerts.Resolve(alertIDContracts)
+		b.alerts.Resolve(alertIDWalletNeed)
+		b.alerts.Resolve(alertIDSlabHealth)
+		b.alerts.Resolve(alertIDWrappedSlabHealth)
+		b.resolveContractFundsAlerts(nil)
+		return
+	} else if err != nil {
+		b.logger.Errorw("failed to fetch contract set", "error", err)
+		return
+	}
+
+	if as.MinContracts == 0 && as.MinWalletNeedRatio == 0 && as.MinContractFundsRatio == 0 {
+		b.alerts.Resolve(alertIDContracts)
+		b.alerts.Resolve(alertIDWalletNeed)
+		b.resolveContractFundsAlerts(nil)
+	} else if contracts, err := b.ms.Contracts(ctx, set); err != nil {
+		b.logger.Errorw("failed to fetch contracts", "error", err)
+	} else {
+		if as.MinContracts > 0 && uint64(len(contracts)) < as.MinContracts {
+			b.alerts.Raise(alertIDContracts, api.AlertSeverityCritical, fmt.Sprintf("contract set '%v' contains %v contracts, expected at least %v", set, len(contracts), as.MinContracts))
+		} else {
+			b.alerts.Resolve(alertIDContracts)
+		}
+
+		// the renewals are expected to cost about as much as the contracts
+		// they renew
+		var need types.Currency
+		for _, c := range contracts {
+			need = need.Add(c.TotalCost)
+		}
+		need = need.Mul64(uint64(as.MinWalletNeedRatio * 1000)).Div64(1000)
+		if balance := b.w.Balance(); !need.IsZero() && balance.Cmp(need) < 0 {
+			b.alerts.Raise(alertIDWalletNeed, api.AlertSeverityCritical, fmt.Sprintf("wallet balance %v is below the %v needed to renew contract set '%v'", balance, need, set))
+		} else {
+			b.alerts.Resolve(alertIDWalletNeed)
+		}
+
+		// contracts that are running low on funds
+		low := make(map[string]bool)
+		for _, c := range contracts {
+			if as.MinContractFundsRatio == 0 || c.TotalCost.IsZero() {
+				continue
+			}
+			min := c.TotalCost.Mul64(uint64(as.MinContractFundsRatio * 1000)).Div64(1000)
+			if c.RemainingFunds.Cmp(min) < 0 {
+				id := alertIDContractFundsPrefix + c.ID.String()
+				low[id] = true
+				b.alerts.Raise(id, api.AlertSeverityWarning, fmt.Sprintf("contract %v with host %v has %v of funds remaining, less than %v", c.ID, c.HostKey, c.RemainingFunds, min))
+			}
+		}
+		b.resolveContractFundsAlerts(low)
+	}
+
+	if as.MinSlabHealth == 0 {
+		b.alerts.Resolve(alertIDSlabHealth)
+		b.alerts.Resolve(alertIDWrappedSlabHealth)
+	} else if unhealthy, wrapped, err := b.unhealthySlabs(ctx, as.MinSlabHealth, set); err != nil {
+		b.logger.Errorw("failed to fetch unhealthy slabs", "error", err)
+	} else {
+		if unhealthy > 0 {
+			b.alerts.Raise(alertIDSlabHealth, api.AlertSeverityWarning, fmt.Sprintf("%v slabs have a health below %v", unhealthy, as.MinSlabHealth))
+		} else {
+			b.alerts.Resolve(alertIDSlabHealth)
+		}
+		if wrapped > 0 {
+			b.alerts.Raise(alertIDWrappedSlabHealth, api.AlertSeverityWarning, fmt.Sprintf("%v slabs of passphrase protected objects have a health below %v, they aren't migrated so their objects have to be re-uploaded", wrapped, as.MinSlabHealth))
+		} else {
+			b.alerts.Resolve(alertIDWrappedSlabHealth)
+		}
+	}
+}
+
+// resolveContractFundsAlerts resolves the contract funds alerts that aren't in
+// the given set of alert ids.
+func (b *bus) resolveContractFundsAlerts(keep map[string]bool) {
+	for _, alert := range b.alerts.Alerts() {
+		if strings.HasPrefix(alert.ID, alertIDContractFundsPrefix) && !keep[alert.ID] {
+			b.alerts.Resolve(alert.ID)
+		}
+	}
+}
+
+// unhealthySlabs returns the number of slabs with a health below the cutoff
+// and how many of them have wrapped keys. The persisted health is used if it
+// was computed for the given set, otherwise it's computed on the fly, in which
+// case the slabs with wrapped keys are unknown and not counted.
+func (b *bus) unhealthySlabs(ctx context.Context, healthCutoff float64, set string) (unhealthy, wrapped uint64, err error) {
+	if b.slabHealth != nil && b.slabHealth.Set() == set {
+		summary, err := b.ms.SlabHealthSummary(ctx, healthCutoff)
+		if err != nil {
+			return 0, 0, err
+		} else if !summary.Refreshed.IsZero() {
+			return summary.Unhealthy, summary.UnhealthyWrapped, nil
+		}
+	}
+	slabs, err := b.ms.UnhealthySlabs(ctx, healthCutoff, set, alertMaxUnhealthySlabs)
+	return uint64(len(slabs)), 0, err
+}
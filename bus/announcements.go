@@ -0,0 +1,75 @@
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/jape"
+	"go.sia.tech/renterd/api"
+)
+
+const (
+	// announcementCompactionInterval is the interval at which the host
+	// announcements are compacted.
+	announcementCompactionInterval = time.Hour
+
+	// defaultAnnouncementsPerHost is the number of announcements that are
+	// kept per host if the announcement settings weren't set.
+	defaultAnnouncementsPerHost = 10
+
+	// announcementReorgDepth is the number of blocks below the tip in which
+	// announcements are never compacted, since they could still be reverted.
+	announcementReorgDepth = 144
+)
+
+// announcementSettings returns the announcement settings, the defaults are
+// returned if they weren't set.
+func announcementSettings(ctx context.Context, ss SettingStore) (as api.AnnouncementSettings, err error) {
+	setting, err := ss.Setting(ctx, SettingAnnouncements)
+	if errors.Is(err, api.ErrSettingNotFound) {
+		return api.AnnouncementSettings{MaxPerHost: defaultAnnouncementsPerHost}, nil
+	} else if err != nil {
+		return api.AnnouncementSettings{}, err
+	}
+	err = json.Unmarshal([]byte(setting), &as)
+	return
+}
+
+// compactAnnouncements removes all but the latest announcements of every host,
+// announcements within the reorg depth are kept.
+func (b *bus) compactAnnouncements(ctx context.Context) {
+	as, err := announcementSettings(ctx, b.ss)
+	if err != nil {
+		b.logger.Errorw("failed to load announcement settings", "error", err)
+		return
+	} else if err := as.Validate(); err != nil {
+		b.logger.Warnw("invalid announcement settings, using the defaults", "error", err)
+		as.MaxPerHost = defaultAnnouncementsPerHost
+	}
+	var minHeight uint64
+	if height := b.cm.TipState(ctx).Index.Height; height > announcementReorgDepth {
+		minHeight = height - announcementReorgDepth
+	}
+	removed, err := b.hdb.CompactAnnouncements(ctx, as.MaxPerHost, minHeight)
+	if err != nil {
+		b.logger.Errorw("failed to compact announcements", "error", err)
+	} else if removed > 0 {
+		b.logger.Debugw("compacted announcements", "removed", removed)
+	}
+}
+
+func (b *bus) hostsPubkeyAnnouncementsHandlerGET(jc jape.Context) {
+	var hostKey types.PublicKey
+	offset := 0
+	limit := -1
+	if jc.DecodeParam("hostkey", &hostKey) != nil || jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+	announcements, err := b.hdb.HostAnnouncements(jc.Request.Context(), hostKey, offset, limit)
+	if jc.Check("couldn't load host announcements", err) == nil {
+		jc.Encode(announcements)
+	}
+}
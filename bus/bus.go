@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"strings"
 	"time"
@@ -17,6 +18,8 @@ import (
 	"go.sia.tech/jape"
 	"go.sia.tech/renterd/api"
 	"go.sia.tech/renterd/hostdb"
+	"go.sia.tech/renterd/internal/auth"
+	"go.sia.tech/renterd/internal/profiling"
 	"go.sia.tech/renterd/internal/tracing"
 	"go.sia.tech/renterd/object"
 	"go.sia.tech/renterd/wallet"
@@ -24,17 +27,49 @@ import (
 )
 
 const (
-	SettingContractSet = "contract_set"
-	SettingGouging     = "gouging"
-	SettingRedundancy  = "redundancy"
+	// defaultHealthMaxBlocksBehind is the default number of blocks the
+	// consensus is allowed to lag behind the expected height before the bus
+	// is considered unhealthy.
+	defaultHealthMaxBlocksBehind = 6
+
+	// healthMinFreeDiskSpace is the minimum amount of free disk space
+	// required for the bus to be considered healthy.
+	healthMinFreeDiskSpace = 1 << 30 // 1 GiB
+
+	// defaultConsensusChangesLimit and maxConsensusChangesLimit are the
+	// default and maximum number of consensus changes returned by the
+	// /consensus/changes endpoint.
+	defaultConsensusChangesLimit = 100
+	maxConsensusChangesLimit     = 1000
+)
+
+const (
+	SettingContractSet    = "contract_set"
+	SettingGouging        = "gouging"
+	SettingRedundancy     = "redundancy"
+	SettingTracing        = "tracing"
+	SettingReports        = "reports"
+	SettingAlerts         = "alerts"
+	SettingTrash          = "trash"
+	SettingAnnouncements  = "announcements"
+	SettingUploadPacking  = "uploadpacking"
+	SettingSpendingCaps   = "spendingcaps"
+	SettingPprof          = profiling.SettingKey
+	SettingFaultInjection = api.SettingFaultInjection
 )
 
 type (
 	// A ChainManager manages blockchain state.
 	ChainManager interface {
 		AcceptBlock(context.Context, types.Block) error
+		BlockAtHeight(ctx context.Context, height uint64) (types.Block, bool)
 		Synced(ctx context.Context) bool
 		TipState(ctx context.Context) consensus.State
+
+		// ConsensusChanges returns up to limit consensus changes following
+		// the change with the given id, the zero id refers to the beginning
+		// of the chain.
+		ConsensusChanges(ctx context.Context, after types.Hash256, limit int) (api.ConsensusChanges, error)
 	}
 
 	// A Syncer can connect to other peers and synchronize the blockchain.
@@ -56,13 +91,27 @@ type (
 	// A Wallet can spend and receive siacoins.
 	Wallet interface {
 		Address() types.Address
+		Addresses() []types.Address
 		Balance() types.Currency
+		NextAddress() (types.Address, error)
+		OwnsAddress(addr types.Address) bool
 		FundTransaction(cs consensus.State, txn *types.Transaction, amount types.Currency, pool []types.Transaction) ([]types.Hash256, error)
+		FundTransactionWithOutputs(cs consensus.State, txn *types.Transaction, amount types.Currency, outputs []types.Hash256, pool []types.Transaction) ([]types.Hash256, error)
 		Redistribute(cs consensus.State, outputs int, amount, feePerByte types.Currency, pool []types.Transaction) (types.Transaction, []types.Hash256, error)
 		ReleaseInputs(txn types.Transaction)
 		SignTransaction(cs consensus.State, txn *types.Transaction, toSign []types.Hash256, cf types.CoveredFields) error
+		SpendableOutputs(cs consensus.State, pool []types.Transaction) ([]wallet.SiacoinElement, error)
 		Transactions(since time.Time, max int) ([]wallet.Transaction, error)
 		UnspentOutputs() ([]wallet.SiacoinElement, error)
+
+		Lock() error
+		Locked() bool
+		Rescan(fromHeight uint64) error
+		Unlock(passphrase string) error
+
+		ExportSeed(passphrase, exportPassphrase string) ([]byte, error)
+		SetEncryptedSeed(encryptedSeed []byte)
+		WatchOnly() bool
 	}
 
 	// A HostDB stores information about hosts.
@@ -78,27 +127,74 @@ type (
 		HostBlocklist(ctx context.Context) ([]string, error)
 		UpdateHostAllowlistEntries(ctx context.Context, add, remove []types.PublicKey) error
 		UpdateHostBlocklistEntries(ctx context.Context, add, remove []string) error
+		UpdateHostGroups(ctx context.Context, groups map[types.PublicKey]string) error
+		UpdateHostExternalData(ctx context.Context, data map[types.PublicKey]hostdb.ExternalData) error
+
+		HostAnnouncements(ctx context.Context, hostKey types.PublicKey, offset, limit int) ([]hostdb.Announcement, error)
+		CompactAnnouncements(ctx context.Context, keep int, minHeight uint64) (int, error)
 	}
 
 	// A MetadataStore stores information about contracts and objects.
 	MetadataStore interface {
 		AddContract(ctx context.Context, c rhpv2.ContractRevision, totalCost types.Currency, startHeight uint64) (api.ContractMetadata, error)
 		AddRenewedContract(ctx context.Context, c rhpv2.ContractRevision, totalCost types.Currency, startHeight uint64, renewedFrom types.FileContractID) (api.ContractMetadata, error)
+		RecoverContract(ctx context.Context, c api.ContractMetadata, rev rhpv2.ContractRevision, roots []types.Hash256) (api.ContractMetadata, error)
+		RescanContract(ctx context.Context, c api.ContractMetadata, rev rhpv2.ContractRevision) (api.ContractMetadata, error)
+		RestoreContractRoots(ctx context.Context, id types.FileContractID, roots []types.Hash256) error
 		ActiveContracts(ctx context.Context) ([]api.ContractMetadata, error)
 		AncestorContracts(ctx context.Context, fcid types.FileContractID, minStartHeight uint64) ([]api.ArchivedContract, error)
 		Contract(ctx context.Context, id types.FileContractID) (api.ContractMetadata, error)
+		ContractObjects(ctx context.Context, id types.FileContractID) ([]api.ContractObject, error)
+		ContractRoots(ctx context.Context, id types.FileContractID) ([]types.Hash256, error)
 		Contracts(ctx context.Context, set string) ([]api.ContractMetadata, error)
 		ContractSets(ctx context.Context) ([]string, error)
+		ContractSetDiff(ctx context.Context, set string, since time.Time) (api.ContractSetDiff, error)
 		RecordContractSpending(ctx context.Context, records []api.ContractSpendingRecord) error
 		RemoveContract(ctx context.Context, id types.FileContractID) error
 		SetContractSet(ctx context.Context, set string, contracts []types.FileContractID) error
+		RecordContractBroadcast(ctx context.Context, id types.FileContractID, b api.ContractBroadcast) error
+		UpdateContractUsability(ctx context.Context, updates []api.ContractUsabilityUpdate) error
+		ContractSizes(ctx context.Context) (map[types.FileContractID]uint64, error)
 
 		Object(ctx context.Context, key string) (object.Object, error)
-		Objects(ctx context.Context, key, prefix string, offset, limit int) ([]string, error)
-		SearchObjects(ctx context.Context, key string, offset, limit int) ([]string, error)
-		UpdateObject(ctx context.Context, key string, o object.Object, usedContracts map[types.PublicKey]types.FileContractID) error
-		RemoveObject(ctx context.Context, key string) error
-
+		Objects(ctx context.Context, key, prefix string, minHealth, maxHealth float64, offset, limit int) ([]api.ObjectMetadata, error)
+		SearchObjects(ctx context.Context, key string, minHealth, maxHealth float64, offset, limit int) ([]string, error)
+		UpdateObject(ctx context.Context, key string, o object.Object, usedContracts map[types.PublicKey]types.FileContractID, rs *api.RedundancySettings, partial bool, ifMatch string) error
+		UpdateObjectImportance(ctx context.Context, key string, importance uint8) error
+		RemoveObject(ctx context.Context, key, ifMatch string) error
+		RenameObjects(ctx context.Context, from, to string) (int, error)
+
+		TrashObject(ctx context.Context, key, ifMatch string, retention time.Duration) error
+		TrashedObjects(ctx context.Context, offset, limit int) ([]api.TrashedObject, error)
+		RestoreTrashedObject(ctx context.Context, id uint) error
+		PurgeTrashedObject(ctx context.Context, id uint) error
+		PurgeTrash(ctx context.Context, expiredOnly bool) (int, error)
+
+		CheckConsistency(ctx context.Context, repair bool) (api.ConsistencyReport, error)
+		CollectGarbage(ctx context.Context) (api.GCResult, error)
+		HostAuditStats(ctx context.Context) ([]api.HostAuditStats, error)
+		ObjectsForAudit(ctx context.Context, limit int, maxSize uint64) ([]string, error)
+		RecordSectorAudits(ctx context.Context, set string, results []api.SectorAuditResult) (int, error)
+		SectorsForAudit(ctx context.Context, limit int) ([]api.SectorAudit, error)
+		ContractSectorDeletions(ctx context.Context, id types.FileContractID) ([]types.Hash256, error)
+		RemoveSectorDeletions(ctx context.Context, deletions []api.SectorDeletions) error
+		SectorDeletions(ctx context.Context, limit int) ([]api.SectorDeletions, error)
+
+		ObjectsForReshard(ctx context.Context, minShards, totalShards uint8, limit int) ([]string, error)
+		ReshardProgress(ctx context.Context, minShards, totalShards uint8) (api.ReshardProgress, error)
+
+		MarkPackedSlabsUploaded(ctx context.Context, slabs []api.UploadedPackedSlab) error
+		PackedSlabsForUpload(ctx context.Context, lockingDuration time.Duration, minShards, totalShards uint8, limit int) ([]api.PackedSlab, error)
+
+		EnqueueSlabsForRepair(ctx context.Context, set string, healthCutoff float64) (int, error)
+		RecordRepairResults(ctx context.Context, results []api.RepairResult) error
+		RefreshSlabHealth(ctx context.Context, set string, batchSize int) error
+		RepairQueue(ctx context.Context, limit int) ([]api.RepairQueueEntry, error)
+		RetrySlabMigration(ctx context.Context, id api.SlabID) error
+		SlabMigrations(ctx context.Context, status string, offset, limit int) ([]api.SlabMigration, error)
+		UpdateSlabMigrations(ctx context.Context, updates []api.SlabMigrationUpdate) error
+		SlabHealth(ctx context.Context, set string, limit int) ([]api.SlabHealth, error)
+		SlabHealthSummary(ctx context.Context, healthCutoff float64) (api.SlabHealthSummary, error)
 		UnhealthySlabs(ctx context.Context, healthCutoff float64, set string, limit int) ([]object.Slab, error)
 		UpdateSlab(ctx context.Context, s object.Slab, usedContracts map[types.PublicKey]types.FileContractID) error
 	}
@@ -109,6 +205,9 @@ type (
 		Settings(ctx context.Context) ([]string, error)
 		UpdateSetting(ctx context.Context, key, value string) error
 		UpdateSettings(ctx context.Context, settings map[string]string) error
+
+		SettingHistory(ctx context.Context, key string, offset, limit int) ([]api.SettingUpdate, error)
+		RollbackSetting(ctx context.Context, key string, id uint) error
 	}
 
 	// EphemeralAccountStore persists information about accounts. Since
@@ -118,6 +217,73 @@ type (
 		Accounts(context.Context) ([]api.Account, error)
 		SaveAccounts(context.Context, []api.Account) error
 	}
+
+	// An AuditStore persists a log of mutating API calls.
+	AuditStore interface {
+		AuditEntries(ctx context.Context, since time.Time, pathPrefix string, offset, limit int) ([]api.AuditEntry, error)
+		RecordAuditEntries(ctx context.Context, entries []api.AuditEntry) error
+	}
+
+	// A DiagnosticsStore exposes diagnostics about the underlying database.
+	DiagnosticsStore interface {
+		ConsensusProcessingStats() api.ConsensusProcessingStats
+		FreeDiskSpace() (uint64, error)
+		Ping(ctx context.Context) error
+		QueryStats() []api.QueryStats
+	}
+
+	// A ReportStore persists daily reports.
+	ReportStore interface {
+		DailyReports(ctx context.Context, since time.Time, limit int) ([]api.DailyReport, error)
+		UpdateDailyReport(ctx context.Context, r api.DailyReport) error
+	}
+
+	// A JobStore persists long-running operations and their progress.
+	JobStore interface {
+		AddJob(ctx context.Context, typ string, params []byte) (api.Job, error)
+		Job(ctx context.Context, id uint) (api.Job, error)
+		Jobs(ctx context.Context, typ, state string, offset, limit int) ([]api.Job, error)
+
+		AcquireJob(ctx context.Context, types []string) (api.Job, error)
+		CancelJob(ctx context.Context, id uint) error
+		ResetRunningJobs(ctx context.Context, types []string) (int, error)
+		RetryJob(ctx context.Context, id uint) error
+		UpdateJob(ctx context.Context, id uint, u api.JobUpdate) error
+	}
+
+	// A FeeStore persists the series of recorded fee estimates.
+	FeeStore interface {
+		FeeMetrics(ctx context.Context, start, end time.Time) ([]api.FeeMetric, error)
+		PruneFeeMetrics(ctx context.Context, before time.Time) (int, error)
+		RecordFeeMetric(ctx context.Context, m api.FeeMetric) error
+	}
+
+	// A SpendingStore persists the spending per spending period.
+	SpendingStore interface {
+		PeriodSpending(ctx context.Context, periodStart uint64) (api.PeriodSpending, error)
+		AddPeriodSpending(ctx context.Context, spending api.PeriodSpending) error
+	}
+
+	// An AutopilotStateStore persists the state of the autopilot, so it can
+	// resume where it left off after a restart.
+	AutopilotStateStore interface {
+		AutopilotState(ctx context.Context) (api.AutopilotState, error)
+		UpdateAutopilotState(ctx context.Context, state api.AutopilotState) error
+	}
+
+	// A SchedulerStore persists the events scheduled for specific block
+	// heights until they are broadcast.
+	SchedulerStore interface {
+		ScheduledEvents(ctx context.Context) ([]api.ScheduledEvent, error)
+		ScheduleEvents(ctx context.Context, events []api.ScheduledEvent) error
+		RemoveScheduledEvents(ctx context.Context, keys []string) error
+	}
+
+	// A SeedStore persists the encrypted wallet seed together with the
+	// number of addresses that were derived from it.
+	SeedStore interface {
+		SaveSeed(encryptedSeed []byte, addresses uint64) error
+	}
 )
 
 type bus struct {
@@ -130,10 +296,28 @@ type bus struct {
 	ss  SettingStore
 
 	eas EphemeralAccountStore
+	as  AuditStore
+	ds  DiagnosticsStore
+	rs  ReportStore
+	js  JobStore
+	fs  FeeStore
+	aps AutopilotStateStore
+	sds SeedStore
 
 	logger        *zap.SugaredLogger
 	accounts      *accounts
 	contractLocks *contractLocks
+	reporter      *reporter
+	alerts        *alerter
+	events        *eventBroadcaster
+	slabHealth    *slabHealthChecker
+	scheduler     *heightScheduler
+	fees          *feeEstimator
+	unsigned      *unsignedTransactions
+	spending      *spendingLedger
+	jobs          *jobRunner
+	workers       *workerRegistry
+	uploading     *uploadingSectors
 }
 
 func (b *bus) consensusAcceptBlock(jc jape.Context) {
@@ -172,9 +356,42 @@ func (b *bus) consensusStateHandler(jc jape.Context) {
 	})
 }
 
+func (b *bus) consensusChangesHandlerGET(jc jape.Context) {
+	var after types.Hash256
+	limit := defaultConsensusChangesLimit
+	if jc.DecodeForm("after", &after) != nil || jc.DecodeForm("limit", &limit) != nil {
+		return
+	} else if limit <= 0 || limit > maxConsensusChangesLimit {
+		jc.Error(fmt.Errorf("limit must be between 1 and %v", maxConsensusChangesLimit), http.StatusBadRequest)
+		return
+	}
+	changes, err := b.cm.ConsensusChanges(jc.Request.Context(), after, limit)
+	if errors.Is(err, api.ErrConsensusChangeNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't fetch consensus changes", err) != nil {
+		return
+	}
+	jc.Encode(changes)
+}
+
+func (b *bus) consensusProcessingHandlerGET(jc jape.Context) {
+	jc.Encode(b.consensusProcessingStats(jc.Request.Context()))
+}
+
+// consensusProcessingStats returns the stats of the store's processing of
+// consensus changes relative to the current tip.
+func (b *bus) consensusProcessingStats(ctx context.Context) api.ConsensusProcessingStats {
+	stats := b.ds.ConsensusProcessingStats()
+	stats.TipHeight = b.cm.TipState(ctx).Index.Height
+	if stats.TipHeight > stats.ProcessedHeight {
+		stats.BlocksBehind = stats.TipHeight - stats.ProcessedHeight
+	}
+	return stats
+}
+
 func (b *bus) txpoolFeeHandler(jc jape.Context) {
-	fee := b.tp.RecommendedFee()
-	jc.Encode(fee)
+	jc.Encode(b.fees.Estimate(jc.Request.Context()).FeePerByte)
 }
 
 func (b *bus) txpoolTransactionsHandler(jc jape.Context) {
@@ -196,6 +413,16 @@ func (b *bus) walletAddressHandler(jc jape.Context) {
 	jc.Encode(b.w.Address())
 }
 
+func (b *bus) walletAddressHandlerPOST(jc jape.Context) {
+	addr, err := b.w.NextAddress()
+	if errors.Is(err, wallet.ErrWalletLocked) {
+		jc.Error(err, http.StatusForbidden)
+		return
+	} else if jc.Check("couldn't derive new address", err) == nil {
+		jc.Encode(addr)
+	}
+}
+
 func (b *bus) walletTransactionsHandler(jc jape.Context) {
 	var since time.Time
 	max := -1
@@ -208,6 +435,10 @@ func (b *bus) walletTransactionsHandler(jc jape.Context) {
 	}
 }
 
+func (b *bus) walletFeeHandler(jc jape.Context) {
+	jc.Encode(b.fees.Estimate(jc.Request.Context()))
+}
+
 func (b *bus) walletOutputsHandler(jc jape.Context) {
 	utxos, err := b.w.UnspentOutputs()
 	if jc.Check("couldn't load outputs", err) == nil {
@@ -215,15 +446,47 @@ func (b *bus) walletOutputsHandler(jc jape.Context) {
 	}
 }
 
+func (b *bus) walletOutputsSpendableHandlerGET(jc jape.Context) {
+	cs := b.cm.TipState(jc.Request.Context())
+	utxos, err := b.w.SpendableOutputs(cs, b.tp.Transactions())
+	if jc.Check("couldn't load outputs", err) != nil {
+		return
+	}
+	outputs := make([]api.WalletOutput, len(utxos))
+	for i, sce := range utxos {
+		outputs[i] = api.WalletOutput{
+			ID:      sce.ID,
+			Address: sce.Address,
+			Value:   sce.Value,
+		}
+		if sce.ConfirmationHeight <= cs.Index.Height {
+			outputs[i].Confirmations = cs.Index.Height - sce.ConfirmationHeight + 1
+		}
+	}
+	jc.Encode(outputs)
+}
+
 func (b *bus) walletFundHandler(jc jape.Context) {
 	var wfr api.WalletFundRequest
 	if jc.Decode(&wfr) != nil {
 		return
 	}
 	txn := wfr.Transaction
-	fee := b.tp.RecommendedFee().Mul64(uint64(len(encoding.Marshal(txn))))
+	size := uint64(len(encoding.Marshal(txn)))
+	if len(wfr.Outputs) > 0 {
+		size += uint64(len(wfr.Outputs)) * wallet.BytesPerInput // inputs are known up front
+	}
+	fee := b.fees.Estimate(jc.Request.Context()).FeePerByte.Mul64(size)
 	txn.MinerFees = []types.Currency{fee}
-	toSign, err := b.w.FundTransaction(b.cm.TipState(jc.Request.Context()), &txn, wfr.Amount.Add(txn.MinerFees[0]), b.tp.Transactions())
+
+	var toSign []types.Hash256
+	var err error
+	cs := b.cm.TipState(jc.Request.Context())
+	if len(wfr.Outputs) > 0 {
+		toSign, err = b.w.FundTransactionWithOutputs(cs, &txn, wfr.Amount.Add(txn.MinerFees[0]), wfr.Outputs, b.tp.Transactions())
+	} else {
+		toSign, err = b.w.FundTransaction(cs, &txn, wfr.Amount.Add(txn.MinerFees[0]), b.tp.Transactions())
+	}
 	if jc.Check("couldn't fund transaction", err) != nil {
 		return
 	}
@@ -244,12 +507,157 @@ func (b *bus) walletSignHandler(jc jape.Context) {
 	if jc.Decode(&wsr) != nil {
 		return
 	}
+	if b.w.WatchOnly() {
+		parents, err := b.tp.UnconfirmedParents(wsr.Transaction)
+		if jc.Check("couldn't load transaction dependencies", err) != nil {
+			return
+		}
+		id := b.unsigned.Add(wsr.Transaction, wsr.ToSign, wsr.CoveredFields, parents)
+		jc.Error(fmt.Errorf("%w, transaction %v was queued for external signing", wallet.ErrWatchOnly, id), http.StatusForbidden)
+		return
+	}
 	err := b.w.SignTransaction(b.cm.TipState(jc.Request.Context()), &wsr.Transaction, wsr.ToSign, wsr.CoveredFields)
 	if jc.Check("couldn't sign transaction", err) == nil {
 		jc.Encode(wsr.Transaction)
 	}
 }
 
+func (b *bus) walletLockHandlerPOST(jc jape.Context) {
+	jc.Check("couldn't lock wallet", b.w.Lock())
+}
+
+func (b *bus) walletLockedHandlerGET(jc jape.Context) {
+	jc.Encode(b.w.Locked())
+}
+
+func (b *bus) walletUnlockHandlerPOST(jc jape.Context) {
+	var req api.WalletUnlockRequest
+	if jc.Decode(&req) != nil {
+		return
+	}
+	err := b.w.Unlock(req.Passphrase)
+	if errors.Is(err, wallet.ErrNoEncryptedSeed) || errors.Is(err, wallet.ErrWatchOnly) {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		jc.Error(err, http.StatusUnauthorized)
+		return
+	}
+}
+
+func (b *bus) walletSeedExportHandlerPOST(jc jape.Context) {
+	var req api.WalletSeedExportRequest
+	if jc.Decode(&req) != nil {
+		return
+	} else if req.ExportPassphrase == "" {
+		jc.Error(errors.New("no export passphrase provided"), http.StatusBadRequest)
+		return
+	}
+	encrypted, err := b.w.ExportSeed(req.Passphrase, req.ExportPassphrase)
+	if errors.Is(err, wallet.ErrUnknownSeedPhrase) || errors.Is(err, wallet.ErrWatchOnly) {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	} else if err != nil {
+		jc.Error(err, http.StatusUnauthorized)
+		return
+	}
+	jc.Encode(api.WalletSeedBackup{
+		Version:       api.WalletSeedVersion,
+		EncryptedSeed: encrypted,
+		Address:       b.w.Address(),
+		Addresses:     uint64(len(b.w.Addresses())),
+	})
+}
+
+// renterDataExists returns true if the bus has contracts, objects or trashed
+// objects.
+func (b *bus) renterDataExists(ctx context.Context) (bool, error) {
+	if contracts, err := b.ms.ActiveContracts(ctx); err != nil || len(contracts) > 0 {
+		return len(contracts) > 0, err
+	} else if objects, err := b.ms.SearchObjects(ctx, "", 0, 1, 0, 1); err != nil || len(objects) > 0 {
+		return len(objects) > 0, err
+	}
+	trashed, err := b.ms.TrashedObjects(ctx, 0, 1)
+	return len(trashed) > 0, err
+}
+
+func (b *bus) walletSeedImportHandlerPOST(jc jape.Context) {
+	var req api.WalletSeedImportRequest
+	if jc.Decode(&req) != nil {
+		return
+	} else if req.Backup.Version != api.WalletSeedVersion {
+		jc.Error(fmt.Errorf("unsupported seed version %v, expected %v", req.Backup.Version, api.WalletSeedVersion), http.StatusBadRequest)
+		return
+	} else if req.Passphrase == "" {
+		jc.Error(errors.New("no passphrase provided"), http.StatusBadRequest)
+		return
+	}
+
+	// decrypt the seed and make sure it belongs to the backed up wallet
+	phrase, err := wallet.DecryptSeedPhrase(req.Backup.EncryptedSeed, req.ExportPassphrase)
+	if err != nil {
+		jc.Error(err, http.StatusUnauthorized)
+		return
+	}
+	key, err := wallet.KeyFromPhrase(phrase)
+	if err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	addr := wallet.StandardAddress(key.PublicKey())
+	for i := range key {
+		key[i] = 0
+	}
+	if addr != req.Backup.Address {
+		jc.Error(errors.New("seed doesn't match the backup's address"), http.StatusBadRequest)
+		return
+	}
+
+	// the DB secret and the worker key are derived from the seed, so the
+	// seed of another wallet can only be imported before any contracts were
+	// formed or objects uploaded
+	if addr != b.w.Address() {
+		if inUse, err := b.renterDataExists(jc.Request.Context()); jc.Check("couldn't check for existing contracts and objects", err) != nil {
+			return
+		} else if inUse {
+			jc.Error(errors.New("can't import the seed of another wallet, the bus has contracts or objects whose keys are derived from the current seed"), http.StatusConflict)
+			return
+		}
+	}
+
+	// store the seed, if it belongs to the current wallet it's used to lock
+	// and unlock the wallet right away, otherwise once the node is restarted
+	encrypted := wallet.EncryptSeedPhrase(phrase, req.Passphrase)
+	if jc.Check("couldn't store seed", b.sds.SaveSeed(encrypted, req.Backup.Addresses)) != nil {
+		return
+	}
+	if addr != b.w.Address() {
+		jc.Encode(api.WalletSeedImportResponse{RestartRequired: true})
+		return
+	}
+	b.w.SetEncryptedSeed(encrypted)
+	if !b.w.WatchOnly() && !b.w.Locked() {
+		for uint64(len(b.w.Addresses())) < req.Backup.Addresses {
+			if _, err := b.w.NextAddress(); jc.Check("couldn't derive address", err) != nil {
+				return
+			}
+		}
+	}
+	jc.Encode(api.WalletSeedImportResponse{})
+}
+
+func (b *bus) walletRescanHandlerPOST(jc jape.Context) {
+	var fromHeight uint64
+	if jc.DecodeForm("fromHeight", (*api.ParamUint64)(&fromHeight)) != nil {
+		return
+	}
+	if err := b.w.Rescan(fromHeight); errors.Is(err, wallet.ErrRescanInProgress) {
+		jc.Error(err, http.StatusConflict)
+	} else {
+		jc.Check("couldn't rescan wallet", err)
+	}
+}
+
 func (b *bus) walletRedistributeHandler(jc jape.Context) {
 	var wfr api.WalletRedistributeRequest
 	if jc.Decode(&wfr) != nil {
@@ -261,11 +669,17 @@ func (b *bus) walletRedistributeHandler(jc jape.Context) {
 	}
 
 	cs := b.cm.TipState(jc.Request.Context())
-	txn, toSign, err := b.w.Redistribute(cs, wfr.Outputs, wfr.Amount, b.tp.RecommendedFee(), b.tp.Transactions())
+	txn, toSign, err := b.w.Redistribute(cs, wfr.Outputs, wfr.Amount, b.fees.Estimate(jc.Request.Context()).FeePerByte, b.tp.Transactions())
 	if jc.Check("couldn't redistribute money in the wallet into the desired outputs", err) != nil {
 		return
 	}
 
+	// queue the transaction for external signing if the wallet is watch-only
+	if b.w.WatchOnly() {
+		jc.Encode(b.unsigned.Add(txn, toSign, types.CoveredFields{WholeTransaction: true}, nil))
+		return
+	}
+
 	err = b.w.SignTransaction(cs, &txn, toSign, types.CoveredFields{WholeTransaction: true})
 	if jc.Check("couldn't sign the transaction", err) != nil {
 		return
@@ -286,6 +700,44 @@ func (b *bus) walletDiscardHandler(jc jape.Context) {
 	}
 }
 
+func (b *bus) walletUnsignedHandlerGET(jc jape.Context) {
+	jc.Encode(b.unsigned.List())
+}
+
+func (b *bus) walletUnsignedIDHandlerPOST(jc jape.Context) {
+	var id types.TransactionID
+	var txn types.Transaction
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&txn) != nil {
+		return
+	}
+	utxn, err := b.unsigned.Get(id)
+	if errors.Is(err, errUnsignedTxnNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if err := verifySigned(utxn, txn); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	if jc.Check("couldn't broadcast the transaction", b.tp.AddTransactionSet(append(utxn.DependsOn, txn))) != nil {
+		return
+	}
+	b.unsigned.Remove(id)
+}
+
+func (b *bus) walletUnsignedIDHandlerDELETE(jc jape.Context) {
+	var id types.TransactionID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	utxn, err := b.unsigned.Get(id)
+	if errors.Is(err, errUnsignedTxnNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	}
+	b.w.ReleaseInputs(utxn.Transaction)
+	b.unsigned.Remove(id)
+}
+
 func (b *bus) walletPrepareFormHandler(jc jape.Context) {
 	ctx := jc.Request.Context()
 	var wpfr api.WalletPrepareFormRequest
@@ -306,7 +758,11 @@ func (b *bus) walletPrepareFormHandler(jc jape.Context) {
 	txn := types.Transaction{
 		FileContracts: []types.FileContract{fc},
 	}
-	txn.MinerFees = []types.Currency{b.tp.RecommendedFee().Mul64(uint64(len(encoding.Marshal(txn))))}
+	txn.MinerFees = []types.Currency{b.fees.Estimate(ctx).FeePerByte.Mul64(uint64(len(encoding.Marshal(txn))))}
+	if err := b.spending.Authorize(ctx, b.cm.TipState(ctx).Index.Height, api.SpendingCategoryFormation, cost.Sub(fc.ValidRenterPayout()).Add(txn.MinerFees[0])); err != nil {
+		b.spendingError(jc, err)
+		return
+	}
 	toSign, err := b.w.FundTransaction(b.cm.TipState(ctx), &txn, cost.Add(txn.MinerFees[0]), b.tp.Transactions())
 	if jc.Check("couldn't fund transaction", err) != nil {
 		return
@@ -347,8 +803,12 @@ func (b *bus) walletPrepareRenewHandler(jc jape.Context) {
 	txn := types.Transaction{
 		FileContracts: []types.FileContract{fc},
 	}
-	txn.MinerFees = []types.Currency{b.tp.RecommendedFee().Mul64(uint64(len(encoding.Marshal(txn))))}
+	txn.MinerFees = []types.Currency{b.fees.Estimate(jc.Request.Context()).FeePerByte.Mul64(uint64(len(encoding.Marshal(txn))))}
 	cost := rhpv2.ContractRenewalCost(fc, wprr.HostSettings.ContractPrice, txn.MinerFees[0], basePrice)
+	if err := b.spending.Authorize(jc.Request.Context(), b.cm.TipState(jc.Request.Context()).Index.Height, api.SpendingCategoryFormation, cost.Sub(fc.ValidRenterPayout())); err != nil {
+		b.spendingError(jc, err)
+		return
+	}
 	toSign, err := b.w.FundTransaction(b.cm.TipState(jc.Request.Context()), &txn, cost, b.tp.Transactions())
 	if jc.Check("couldn't fund transaction", err) != nil {
 		return
@@ -372,14 +832,13 @@ func (b *bus) walletPrepareRenewHandler(jc jape.Context) {
 
 func (b *bus) walletPendingHandler(jc jape.Context) {
 	isRelevant := func(txn types.Transaction) bool {
-		addr := b.w.Address()
 		for _, sci := range txn.SiacoinInputs {
-			if sci.UnlockConditions.UnlockHash() == addr {
+			if b.w.OwnsAddress(sci.UnlockConditions.UnlockHash()) {
 				return true
 			}
 		}
 		for _, sco := range txn.SiacoinOutputs {
-			if sco.Address == addr {
+			if b.w.OwnsAddress(sco.Address) {
 				return true
 			}
 		}
@@ -434,6 +893,7 @@ func (b *bus) hostsRemoveHandlerPOST(jc jape.Context) {
 	if jc.Check("couldn't remove offline hosts", err) != nil {
 		return
 	}
+	b.reporter.update(func(r *api.DailyReport) { r.HostsLost += removed })
 	jc.Encode(removed)
 }
 
@@ -470,6 +930,25 @@ func (b *bus) hostsPubkeyHandlerPOST(jc jape.Context) {
 	if jc.Check("failed to record interactions", b.hdb.RecordInteractions(jc.Request.Context(), interactions)) != nil {
 		return
 	}
+
+	var uploaded, downloaded uint64
+	for _, hi := range interactions {
+		if !hi.Success || (hi.Type != hostdb.InteractionTypeUpload && hi.Type != hostdb.InteractionTypeDownload) {
+			continue
+		}
+		var tr hostdb.TransferResult
+		if err := json.Unmarshal(hi.Result, &tr); err != nil {
+			continue
+		} else if hi.Type == hostdb.InteractionTypeUpload {
+			uploaded += tr.Bytes
+		} else {
+			downloaded += tr.Bytes
+		}
+	}
+	b.reporter.update(func(r *api.DailyReport) {
+		r.Uploaded += uploaded
+		r.Downloaded += downloaded
+	})
 }
 
 func (b *bus) contractsSpendingHandlerPOST(jc jape.Context) {
@@ -480,6 +959,23 @@ func (b *bus) contractsSpendingHandlerPOST(jc jape.Context) {
 	if jc.Check("failed to record spending metrics for contract", b.ms.RecordContractSpending(jc.Request.Context(), records)) != nil {
 		return
 	}
+	var ps api.PeriodSpending
+	for _, r := range records {
+		ps = ps.Add(api.PeriodSpending{
+			Storage:     r.Storage,
+			Upload:      r.Uploads,
+			Download:    r.Downloads,
+			FundAccount: r.FundAccount,
+		})
+	}
+	b.recordSpending(jc.Request.Context(), ps)
+}
+
+func (b *bus) contractsUsabilityHandlerPOST(jc jape.Context) {
+	var updates []api.ContractUsabilityUpdate
+	if jc.Decode(&updates) == nil {
+		jc.Check("couldn't update contract usability", b.ms.UpdateContractUsability(jc.Request.Context(), updates))
+	}
 }
 
 func (b *bus) hostsAllowlistHandlerGET(jc jape.Context) {
@@ -499,6 +995,30 @@ func (b *bus) hostsAllowlistHandlerPUT(jc jape.Context) {
 	}
 }
 
+func (b *bus) hostsGroupsHandlerPUT(jc jape.Context) {
+	var groups map[types.PublicKey]string
+	if jc.Decode(&groups) == nil {
+		jc.Check("couldn't update host groups", b.hdb.UpdateHostGroups(jc.Request.Context(), groups))
+	}
+}
+
+func (b *bus) hostsExternalHandlerPUT(jc jape.Context) {
+	var data map[types.PublicKey]hostdb.ExternalData
+	if jc.Decode(&data) != nil {
+		return
+	}
+	for hk, ed := range data {
+		if ed.Provider == "" {
+			jc.Error(fmt.Errorf("external data for host %v has no provider", hk), http.StatusBadRequest)
+			return
+		} else if ed.Score < 0 || ed.Score > 1 {
+			jc.Error(fmt.Errorf("external score %v of host %v is not between 0 and 1", ed.Score, hk), http.StatusBadRequest)
+			return
+		}
+	}
+	jc.Check("couldn't update external host data", b.hdb.UpdateHostExternalData(jc.Request.Context(), data))
+}
+
 func (b *bus) hostsBlocklistHandlerGET(jc jape.Context) {
 	blocklist, err := b.hdb.HostBlocklist(jc.Request.Context())
 	if jc.Check("couldn't load blocklist", err) == nil {
@@ -513,6 +1033,9 @@ func (b *bus) hostsBlocklistHandlerPUT(jc jape.Context) {
 		if jc.Check("couldn't update blocklist entries", b.hdb.UpdateHostBlocklistEntries(ctx, req.Add, req.Remove)) != nil {
 			return
 		}
+		if len(req.Add) > 0 {
+			b.events.Broadcast(api.EventHostBlocked, api.EventHostBlockedData{Entries: req.Add})
+		}
 	}
 }
 
@@ -530,6 +1053,17 @@ func (b *bus) contractsSetHandlerGET(jc jape.Context) {
 	}
 }
 
+func (b *bus) contractsSetDiffHandlerGET(jc jape.Context) {
+	var since time.Time
+	if jc.DecodeForm("since", (*api.ParamTime)(&since)) != nil {
+		return
+	}
+	diff, err := b.ms.ContractSetDiff(jc.Request.Context(), jc.PathParam("set"), since)
+	if jc.Check("couldn't load contract set diff", err) == nil {
+		jc.Encode(diff)
+	}
+}
+
 func (b *bus) contractsSetsHandlerGET(jc jape.Context) {
 	sets, err := b.ms.ContractSets(jc.Request.Context())
 	if jc.Check("couldn't fetch contract sets", err) == nil {
@@ -579,6 +1113,89 @@ func (b *bus) contractReleaseHandlerPOST(jc jape.Context) {
 	}
 }
 
+func (b *bus) contractKeepaliveHandlerPOST(jc jape.Context) {
+	var id types.FileContractID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	var req api.ContractKeepaliveRequest
+	if jc.Decode(&req) != nil {
+		return
+	}
+	err := b.contractLocks.Keepalive(id, req.LockID, time.Duration(req.Duration))
+	if errors.Is(err, ErrContractLockNotHeld) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	}
+	jc.Check("failed to keep contract lock alive", err)
+}
+
+func (b *bus) contractsLocksHandlerGET(jc jape.Context) {
+	jc.Encode(b.contractLocks.Stats())
+}
+
+func (b *bus) contractIDObjectsHandlerGET(jc jape.Context) {
+	var id types.FileContractID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	objects, err := b.ms.ContractObjects(jc.Request.Context(), id)
+	if jc.Check("couldn't load contract objects", err) == nil {
+		jc.Encode(objects)
+	}
+}
+
+func (b *bus) contractIDBroadcastHandlerPOST(jc jape.Context) {
+	var id types.FileContractID
+	var cb api.ContractBroadcast
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&cb) != nil {
+		return
+	}
+	jc.Check("couldn't record contract broadcast", b.ms.RecordContractBroadcast(jc.Request.Context(), id, cb))
+}
+
+func (b *bus) contractIDRootsHandlerGET(jc jape.Context) {
+	var id types.FileContractID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	roots, err := b.ms.ContractRoots(jc.Request.Context(), id)
+	if jc.Check("couldn't load contract roots", err) != nil {
+		return
+	}
+
+	// add the roots of sectors that are still being uploaded, they aren't
+	// referenced by an object yet but shouldn't be pruned either
+	seen := make(map[types.Hash256]struct{}, len(roots))
+	for _, root := range roots {
+		seen[root] = struct{}{}
+	}
+	for _, root := range b.uploading.Roots(id) {
+		if _, ok := seen[root]; !ok {
+			roots = append(roots, root)
+		}
+	}
+	jc.Encode(roots)
+}
+
+func (b *bus) contractIDRootsHandlerPUT(jc jape.Context) {
+	var id types.FileContractID
+	var roots []types.Hash256
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&roots) != nil {
+		return
+	}
+	jc.Check("couldn't restore contract roots", b.ms.RestoreContractRoots(jc.Request.Context(), id, roots))
+}
+
+func (b *bus) contractIDUploadingHandlerPOST(jc jape.Context) {
+	var id types.FileContractID
+	var roots []types.Hash256
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&roots) != nil {
+		return
+	}
+	b.uploading.Add(id, roots)
+}
+
 func (b *bus) contractIDHandlerGET(jc jape.Context) {
 	var id types.FileContractID
 	if jc.DecodeParam("id", &id) != nil {
@@ -602,9 +1219,17 @@ func (b *bus) contractIDHandlerPOST(jc jape.Context) {
 	}
 
 	a, err := b.ms.AddContract(jc.Request.Context(), req.Contract, req.TotalCost, req.StartHeight)
-	if jc.Check("couldn't store contract", err) == nil {
-		jc.Encode(a)
+	if jc.Check("couldn't store contract", err) != nil {
+		return
 	}
+	b.reporter.update(func(r *api.DailyReport) {
+		r.Spending = r.Spending.Add(req.TotalCost)
+		r.ContractsFormed++
+	})
+	b.recordSpending(jc.Request.Context(), api.PeriodSpending{Formation: formationFees(req.TotalCost, req.Contract)})
+	b.scheduleContractExpiry(jc.Request.Context(), a)
+	b.events.Broadcast(api.EventContractAdded, a)
+	jc.Encode(a)
 }
 
 func (b *bus) contractIDRenewedHandlerPOST(jc jape.Context) {
@@ -619,9 +1244,19 @@ func (b *bus) contractIDRenewedHandlerPOST(jc jape.Context) {
 	}
 
 	r, err := b.ms.AddRenewedContract(jc.Request.Context(), req.Contract, req.TotalCost, req.StartHeight, req.RenewedFrom)
-	if jc.Check("couldn't store contract", err) == nil {
-		jc.Encode(r)
+	if jc.Check("couldn't store contract", err) != nil {
+		return
 	}
+	b.reporter.update(func(dr *api.DailyReport) {
+		dr.Spending = dr.Spending.Add(req.TotalCost)
+		dr.ContractsRenewed++
+	})
+	b.recordSpending(jc.Request.Context(), api.PeriodSpending{Formation: formationFees(req.TotalCost, req.Contract)})
+	b.cancelContractExpiry(jc.Request.Context(), req.RenewedFrom)
+	b.scheduleContractExpiry(jc.Request.Context(), r)
+	b.events.Broadcast(api.EventContractArchived, api.EventContractArchivedData{ContractID: req.RenewedFrom, Reason: api.ContractArchivalReasonRenewed})
+	b.events.Broadcast(api.EventContractAdded, r)
+	jc.Encode(r)
 }
 
 func (b *bus) contractIDHandlerDELETE(jc jape.Context) {
@@ -629,7 +1264,26 @@ func (b *bus) contractIDHandlerDELETE(jc jape.Context) {
 	if jc.DecodeParam("id", &id) != nil {
 		return
 	}
-	jc.Check("couldn't remove contract", b.ms.RemoveContract(jc.Request.Context(), id))
+	if jc.Check("couldn't remove contract", b.ms.RemoveContract(jc.Request.Context(), id)) != nil {
+		return
+	}
+	b.cancelContractExpiry(jc.Request.Context(), id)
+	b.events.Broadcast(api.EventContractArchived, api.EventContractArchivedData{ContractID: id, Reason: api.ContractArchivalReasonRemoved})
+}
+
+// decodeHealthRange decodes the optional minHealth and maxHealth query
+// params, which default to an unbounded range.
+func decodeHealthRange(jc jape.Context) (minHealth, maxHealth float64, err error) {
+	minHealth, maxHealth = -math.MaxFloat64, math.MaxFloat64
+	if err = jc.DecodeForm("minHealth", (*api.ParamFloat64)(&minHealth)); err != nil {
+		return
+	} else if err = jc.DecodeForm("maxHealth", (*api.ParamFloat64)(&maxHealth)); err != nil {
+		return
+	} else if minHealth > maxHealth {
+		err = fmt.Errorf("minHealth %v exceeds maxHealth %v", minHealth, maxHealth)
+		jc.Error(err, http.StatusBadRequest)
+	}
+	return
 }
 
 func (b *bus) searchObjectsHandlerGET(jc jape.Context) {
@@ -639,7 +1293,11 @@ func (b *bus) searchObjectsHandlerGET(jc jape.Context) {
 	if jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil || jc.DecodeForm("key", &key) != nil {
 		return
 	}
-	keys, err := b.ms.SearchObjects(jc.Request.Context(), key, offset, limit)
+	minHealth, maxHealth, err := decodeHealthRange(jc)
+	if err != nil {
+		return
+	}
+	keys, err := b.ms.SearchObjects(jc.Request.Context(), key, minHealth, maxHealth, offset, limit)
 	if jc.Check("couldn't list objects", err) != nil {
 		return
 	}
@@ -655,9 +1313,13 @@ func (b *bus) objectsKeyHandlerGET(jc jape.Context) {
 		if jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil || jc.DecodeForm("prefix", &prefix) != nil {
 			return
 		}
-		keys, err := b.ms.Objects(ctx, jc.PathParam("key"), prefix, offset, limit)
+		minHealth, maxHealth, err := decodeHealthRange(jc)
+		if err != nil {
+			return
+		}
+		entries, err := b.ms.Objects(ctx, jc.PathParam("key"), prefix, minHealth, maxHealth, offset, limit)
 		if jc.Check("couldn't list objects", err) == nil {
-			jc.Encode(api.ObjectsResponse{Entries: keys})
+			jc.Encode(api.ObjectsResponse{Entries: entries})
 		}
 		return
 	}
@@ -669,20 +1331,325 @@ func (b *bus) objectsKeyHandlerGET(jc jape.Context) {
 
 func (b *bus) objectsKeyHandlerPUT(jc jape.Context) {
 	var aor api.AddObjectRequest
-	if jc.Decode(&aor) == nil {
-		jc.Check("couldn't store object", b.ms.UpdateObject(jc.Request.Context(), jc.PathParam("key"), aor.Object, aor.UsedContracts))
+	var partial bool
+	var ifMatch string
+	if jc.DecodeForm("partial", &partial) != nil || jc.DecodeForm("ifMatch", &ifMatch) != nil || jc.Decode(&aor) != nil {
+		return
+	} else if aor.Redundancy != nil {
+		if jc.Check("invalid redundancy settings", aor.Redundancy.Validate()) != nil {
+			return
+		}
+	}
+	err := b.ms.UpdateObject(jc.Request.Context(), jc.PathParam("key"), aor.Object, aor.UsedContracts, aor.Redundancy, partial, ifMatch)
+	var uce *api.UsedContractsError
+	if errors.As(err, &uce) {
+		jc.ResponseWriter.WriteHeader(http.StatusBadRequest)
+		jc.Encode(uce)
+		return
+	} else if errors.Is(err, api.ErrPreconditionFailed) {
+		jc.Error(err, http.StatusPreconditionFailed)
+		return
+	} else if jc.Check("couldn't store object", err) != nil {
+		return
 	}
+	b.events.Broadcast(api.EventObjectUploaded, api.EventObjectUploadedData{Key: jc.PathParam("key"), Size: aor.Object.Size()})
 }
 
 func (b *bus) objectsKeyHandlerDELETE(jc jape.Context) {
-	jc.Check("couldn't delete object", b.ms.RemoveObject(jc.Request.Context(), jc.PathParam("key")))
-}
-
+	var ifMatch string
+	if jc.DecodeForm("ifMatch", &ifMatch) != nil {
+		return
+	}
+	ctx := jc.Request.Context()
+	ts, err := trashSettings(ctx, b.ss)
+	if jc.Check("couldn't load trash settings", err) != nil {
+		return
+	} else if ts.Enabled {
+		err = b.ms.TrashObject(ctx, jc.PathParam("key"), ifMatch, ts.Retention)
+	} else {
+		err = b.ms.RemoveObject(ctx, jc.PathParam("key"), ifMatch)
+	}
+	if errors.Is(err, api.ErrPreconditionFailed) {
+		jc.Error(err, http.StatusPreconditionFailed)
+		return
+	}
+	jc.Check("couldn't delete object", err)
+}
+
+func (b *bus) objectsRenameHandlerPOST(jc jape.Context) {
+	var orr api.ObjectsRenameRequest
+	if jc.Decode(&orr) != nil {
+		return
+	}
+	for _, prefix := range []string{orr.From, orr.To} {
+		if !strings.HasPrefix(prefix, "/") || !strings.HasSuffix(prefix, "/") {
+			jc.Error(fmt.Errorf("prefix %q must start and end in a slash", prefix), http.StatusBadRequest)
+			return
+		}
+	}
+	if strings.HasPrefix(orr.To, orr.From) {
+		jc.Error(fmt.Errorf("can't rename %q to %q, a directory can't be moved into itself", orr.From, orr.To), http.StatusBadRequest)
+		return
+	}
+	renamed, err := b.ms.RenameObjects(jc.Request.Context(), orr.From, orr.To)
+	if errors.Is(err, api.ErrObjectExists) {
+		jc.Error(err, http.StatusConflict)
+		return
+	} else if jc.Check("couldn't rename objects", err) != nil {
+		return
+	}
+	jc.Encode(renamed)
+}
+
+func (b *bus) importanceKeyHandlerPUT(jc jape.Context) {
+	var importance uint8
+	if jc.Decode(&importance) == nil {
+		jc.Check("couldn't update object importance", b.ms.UpdateObjectImportance(jc.Request.Context(), jc.PathParam("key"), importance))
+	}
+}
+
+func (b *bus) slabsRepairHandlerGET(jc jape.Context) {
+	limit := -1
+	if jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+	entries, err := b.ms.RepairQueue(jc.Request.Context(), limit)
+	if jc.Check("couldn't load repair queue", err) == nil {
+		jc.Encode(entries)
+	}
+}
+
+func (b *bus) slabsRepairEnqueueHandlerPOST(jc jape.Context) {
+	var req api.RepairEnqueueRequest
+	if jc.Decode(&req) != nil {
+		return
+	}
+	n, err := b.ms.EnqueueSlabsForRepair(jc.Request.Context(), req.ContractSet, req.HealthCutoff)
+	if jc.Check("couldn't enqueue slabs for repair", err) == nil {
+		jc.Encode(n)
+	}
+}
+
+func (b *bus) slabsRepairResultsHandlerPOST(jc jape.Context) {
+	var results []api.RepairResult
+	if jc.Decode(&results) == nil {
+		jc.Check("couldn't record repair results", b.ms.RecordRepairResults(jc.Request.Context(), results))
+	}
+}
+
+func (b *bus) slabsMigrationsHandlerGET(jc jape.Context) {
+	var status string
+	offset := 0
+	limit := -1
+	if jc.DecodeForm("status", &status) != nil || jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+	migrations, err := b.ms.SlabMigrations(jc.Request.Context(), status, offset, limit)
+	if jc.Check("couldn't load slab migrations", err) == nil {
+		jc.Encode(migrations)
+	}
+}
+
+func (b *bus) slabsMigrationsHandlerPOST(jc jape.Context) {
+	var updates []api.SlabMigrationUpdate
+	if jc.Decode(&updates) != nil {
+		return
+	}
+	for _, u := range updates {
+		switch u.Status {
+		case api.SlabMigrationStatusPending, api.SlabMigrationStatusInProgress, api.SlabMigrationStatusDone, api.SlabMigrationStatusFailed:
+		default:
+			jc.Error(fmt.Errorf("invalid migration status %q for slab %v", u.Status, u.SlabID), http.StatusBadRequest)
+			return
+		}
+	}
+	jc.Check("couldn't update slab migrations", b.ms.UpdateSlabMigrations(jc.Request.Context(), updates))
+}
+
+func (b *bus) slabsMigrationsIDRetryHandlerPOST(jc jape.Context) {
+	var id api.SlabID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	err := b.ms.RetrySlabMigration(jc.Request.Context(), id)
+	if errors.Is(err, api.ErrSlabNotQueued) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	}
+	jc.Check("couldn't retry slab migration", err)
+}
+
+func (b *bus) slabsPackedHandlerPOST(jc jape.Context) {
+	var psr api.PackedSlabsRequest
+	if jc.Decode(&psr) != nil {
+		return
+	}
+	packed, err := b.ms.PackedSlabsForUpload(jc.Request.Context(), time.Duration(psr.LockingDuration), psr.MinShards, psr.TotalShards, psr.Limit)
+	if jc.Check("couldn't fetch packed slabs", err) == nil {
+		jc.Encode(packed)
+	}
+}
+
+func (b *bus) slabsPackedDoneHandlerPOST(jc jape.Context) {
+	var slabs []api.UploadedPackedSlab
+	if jc.Decode(&slabs) == nil {
+		jc.Check("couldn't mark packed slabs uploaded", b.ms.MarkPackedSlabsUploaded(jc.Request.Context(), slabs))
+	}
+}
+
+func (b *bus) reshardObjectsHandlerGET(jc jape.Context) {
+	limit := -1
+	if jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+	rs, err := b.redundancySettings(jc.Request.Context())
+	if jc.Check("couldn't fetch redundancy settings", err) != nil {
+		return
+	}
+	keys, err := b.ms.ObjectsForReshard(jc.Request.Context(), uint8(rs.MinShards), uint8(rs.TotalShards), limit)
+	if jc.Check("couldn't fetch objects for reshard", err) == nil {
+		jc.Encode(keys)
+	}
+}
+
+func (b *bus) reshardProgressHandlerGET(jc jape.Context) {
+	rs, err := b.redundancySettings(jc.Request.Context())
+	if jc.Check("couldn't fetch redundancy settings", err) != nil {
+		return
+	}
+	progress, err := b.ms.ReshardProgress(jc.Request.Context(), uint8(rs.MinShards), uint8(rs.TotalShards))
+	if jc.Check("couldn't fetch reshard progress", err) == nil {
+		jc.Encode(progress)
+	}
+}
+
+func (b *bus) sectorsAuditsHandlerGET(jc jape.Context) {
+	limit := 10
+	if jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+	audits, err := b.ms.SectorsForAudit(jc.Request.Context(), limit)
+	if jc.Check("couldn't sample sectors for audit", err) == nil {
+		jc.Encode(audits)
+	}
+}
+
+func (b *bus) sectorsAuditsHandlerPOST(jc jape.Context) {
+	var req api.RecordSectorAuditsRequest
+	if jc.Decode(&req) != nil {
+		return
+	}
+	lost, err := b.ms.RecordSectorAudits(jc.Request.Context(), req.ContractSet, req.Results)
+	if jc.Check("couldn't record sector audits", err) != nil {
+		return
+	}
+	if lost > 0 {
+		b.alerts.Notify(alertIDSectorsLost, api.AlertSeverityWarning, fmt.Sprintf("%d of %d audited sectors were lost, the affected slabs were queued for repair", lost, len(req.Results)))
+	}
+	jc.Encode(lost)
+}
+
+func (b *bus) auditsHostsHandlerGET(jc jape.Context) {
+	stats, err := b.ms.HostAuditStats(jc.Request.Context())
+	if jc.Check("couldn't load host audit stats", err) == nil {
+		jc.Encode(stats)
+	}
+}
+
+func (b *bus) auditsObjectsHandlerGET(jc jape.Context) {
+	limit := 1
+	var maxSize uint64
+	if jc.DecodeForm("limit", &limit) != nil || jc.DecodeForm("maxSize", (*api.ParamUint64)(&maxSize)) != nil {
+		return
+	}
+	paths, err := b.ms.ObjectsForAudit(jc.Request.Context(), limit, maxSize)
+	if jc.Check("couldn't sample objects for audit", err) == nil {
+		jc.Encode(paths)
+	}
+}
+
+func (b *bus) auditsObjectsHandlerPOST(jc jape.Context) {
+	var results []api.ObjectAuditResult
+	if jc.Decode(&results) != nil {
+		return
+	}
+	for _, res := range results {
+		if res.Corrupt {
+			b.alerts.Raise(alertIDObjectCorruptPrefix+res.Path, api.AlertSeverityCritical, fmt.Sprintf("object '%v' failed its audit: %v", res.Path, res.Error))
+		} else if res.Error != "" {
+			b.logger.Debugw("object audit failed", "path", res.Path, "error", res.Error)
+		}
+	}
+}
+
+func (b *bus) gcHandlerPOST(jc jape.Context) {
+	res, err := b.ms.CollectGarbage(jc.Request.Context())
+	if jc.Check("couldn't collect garbage", err) != nil {
+		return
+	}
+	if res.Slabs > 0 || res.Sectors > 0 {
+		b.logger.Infow("collected garbage", "slabs", res.Slabs, "sectors", res.Sectors, "reclaimed", res.ReclaimedBytes)
+	}
+	jc.Encode(res)
+}
+
+func (b *bus) consistencyHandlerGET(jc jape.Context) {
+	report, err := b.ms.CheckConsistency(jc.Request.Context(), false)
+	if jc.Check("couldn't check consistency", err) == nil {
+		jc.Encode(report)
+	}
+}
+
+func (b *bus) consistencyRepairHandlerPOST(jc jape.Context) {
+	report, err := b.ms.CheckConsistency(jc.Request.Context(), true)
+	if jc.Check("couldn't repair inconsistencies", err) != nil {
+		return
+	}
+	for _, c := range report.Checks {
+		if c.Repaired > 0 {
+			b.logger.Infow("repaired inconsistencies", "check", c.Name, "repaired", c.Repaired)
+		}
+	}
+	jc.Encode(report)
+}
+
+func (b *bus) gcSectorsHandlerGET(jc jape.Context) {
+	limit := -1
+	if jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+	deletions, err := b.ms.SectorDeletions(jc.Request.Context(), limit)
+	if jc.Check("couldn't load sector deletions", err) == nil {
+		jc.Encode(deletions)
+	}
+}
+
+func (b *bus) gcSectorsIDHandlerGET(jc jape.Context) {
+	var id types.FileContractID
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	roots, err := b.ms.ContractSectorDeletions(jc.Request.Context(), id)
+	if jc.Check("couldn't load sector deletions", err) == nil {
+		jc.Encode(roots)
+	}
+}
+
+func (b *bus) gcSectorsDeletedHandlerPOST(jc jape.Context) {
+	var deletions []api.SectorDeletions
+	if jc.Decode(&deletions) == nil {
+		jc.Check("couldn't remove sector deletions", b.ms.RemoveSectorDeletions(jc.Request.Context(), deletions))
+	}
+}
+
 func (b *bus) slabHandlerPUT(jc jape.Context) {
 	var usr api.UpdateSlabRequest
-	if jc.Decode(&usr) == nil {
-		jc.Check("couldn't update slab", b.ms.UpdateSlab(jc.Request.Context(), usr.Slab, usr.UsedContracts))
+	if jc.Decode(&usr) != nil {
+		return
+	} else if jc.Check("couldn't update slab", b.ms.UpdateSlab(jc.Request.Context(), usr.Slab, usr.UsedContracts)) != nil {
+		return
 	}
+	b.reporter.update(func(r *api.DailyReport) { r.Migrations++ })
 }
 
 func (b *bus) slabsMigrationHandlerPOST(jc jape.Context) {
@@ -694,6 +1661,34 @@ func (b *bus) slabsMigrationHandlerPOST(jc jape.Context) {
 	}
 }
 
+func (b *bus) slabsHealthHandlerGET(jc jape.Context) {
+	var set string
+	limit := -1
+	if jc.DecodeForm("set", &set) != nil || jc.DecodeForm("limit", &limit) != nil {
+		return
+	} else if set == "" {
+		jc.Error(errors.New("param 'set' can not be empty"), http.StatusBadRequest)
+		return
+	}
+	health, err := b.ms.SlabHealth(jc.Request.Context(), set, limit)
+	if jc.Check("couldn't compute slab health", err) == nil {
+		jc.Encode(health)
+	}
+}
+
+func (b *bus) slabsHealthSummaryHandlerGET(jc jape.Context) {
+	var cutoff float64
+	if jc.DecodeForm("cutoff", (*api.ParamFloat64)(&cutoff)) != nil {
+		return
+	}
+	summary, err := b.ms.SlabHealthSummary(jc.Request.Context(), cutoff)
+	if jc.Check("couldn't summarize slab health", err) != nil {
+		return
+	}
+	summary.Set = b.slabHealth.Set()
+	jc.Encode(summary)
+}
+
 func (b *bus) settingsHandlerGET(jc jape.Context) {
 	if settings, err := b.ss.Settings(jc.Request.Context()); jc.Check("couldn't load settings", err) == nil {
 		jc.Encode(settings)
@@ -703,7 +1698,12 @@ func (b *bus) settingsHandlerGET(jc jape.Context) {
 func (b *bus) settingsHandlerPUT(jc jape.Context) {
 	var settings map[string]string
 	if jc.Decode(&settings) == nil {
-		jc.Check("couldn't update settings", b.ss.UpdateSettings(jc.Request.Context(), settings))
+		if jc.Check("couldn't update settings", b.ss.UpdateSettings(jc.Request.Context(), settings)) != nil {
+			return
+		}
+		for key := range settings {
+			b.events.Broadcast(api.EventSettingChanged, api.EventSettingChangedData{Key: key})
+		}
 	}
 }
 
@@ -721,13 +1721,158 @@ func (b *bus) settingKeyHandlerGET(jc jape.Context) {
 
 func (b *bus) settingKeyHandlerPUT(jc jape.Context) {
 	var value string
-	if key := jc.PathParam("key"); key == "" {
+	var force bool
+	key := jc.PathParam("key")
+	if key == "" {
 		jc.Error(errors.New("param 'key' can not be empty"), http.StatusBadRequest)
-	} else if jc.Decode(&value) == nil {
-		jc.Check("could not update setting", b.ss.UpdateSetting(jc.Request.Context(), key, value))
+		return
+	} else if jc.DecodeForm("force", &force) != nil || jc.Decode(&value) != nil {
+		return
+	}
+
+	// validate the gouging settings, misconfigured limits are hard to
+	// diagnose once they're in use
+	if key == SettingGouging {
+		var gs api.GougingSettings
+		if err := json.Unmarshal([]byte(value), &gs); err != nil {
+			jc.Error(fmt.Errorf("couldn't unmarshal gouging settings: %w", err), http.StatusBadRequest)
+			return
+		} else if err := gs.Validate(); err != nil {
+			jc.Error(err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// validate the announcement settings, keeping a single announcement per
+	// host would lose the host's address if it's reverted
+	if key == SettingAnnouncements {
+		var as api.AnnouncementSettings
+		if err := json.Unmarshal([]byte(value), &as); err != nil {
+			jc.Error(fmt.Errorf("couldn't unmarshal announcement settings: %w", err), http.StatusBadRequest)
+			return
+		} else if err := as.Validate(); err != nil {
+			jc.Error(err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// validate the fault injection settings, invalid rates would silently
+	// be ignored by the worker
+	if key == SettingFaultInjection {
+		var fs api.FaultInjectionSettings
+		if err := json.Unmarshal([]byte(value), &fs); err != nil {
+			jc.Error(fmt.Errorf("couldn't unmarshal fault injection settings: %w", err), http.StatusBadRequest)
+			return
+		} else if err := fs.Validate(); err != nil {
+			jc.Error(err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// validate the tracing settings, the sampling rate is applied right away
+	// like when they're updated through the tracing endpoint
+	var ts api.TracingSettings
+	if key == SettingTracing {
+		if err := json.Unmarshal([]byte(value), &ts); err != nil {
+			jc.Error(fmt.Errorf("couldn't unmarshal tracing settings: %w", err), http.StatusBadRequest)
+			return
+		} else if err := ts.Validate(); err != nil {
+			jc.Error(err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// validate the redundancy settings, uploads fail if there aren't enough
+	// contracts to upload all shards of a slab so unless the update is forced
+	// it's rejected in that case
+	if key == SettingRedundancy {
+		var rs api.RedundancySettings
+		if err := json.Unmarshal([]byte(value), &rs); err != nil {
+			jc.Error(fmt.Errorf("couldn't unmarshal redundancy settings: %w", err), http.StatusBadRequest)
+			return
+		} else if err := rs.Validate(); err != nil {
+			jc.Error(err, http.StatusBadRequest)
+			return
+		}
+		if err := b.checkContractCapacity(jc.Request.Context(), rs); err != nil && !force {
+			jc.Error(err, http.StatusBadRequest)
+			return
+		} else if err != nil {
+			b.logger.Warnw("redundancy settings exceed the contract capacity", "error", err)
+		}
+	}
+	if jc.Check("could not update setting", b.updateSetting(jc.Request.Context(), key, value)) != nil {
+		return
+	}
+	if key == SettingTracing {
+		jc.Check("could not update sampling rate", tracing.SetSamplingRate(ts.SamplingRate))
 	}
 }
 
+// checkContractCapacity returns an error if the current contract set doesn't
+// contain enough contracts to upload slabs using the given redundancy
+// settings. Empty contract sets are ignored since nothing can be uploaded
+// before contracts were formed.
+func (b *bus) checkContractCapacity(ctx context.Context, rs api.RedundancySettings) error {
+	set, err := b.ss.Setting(ctx, SettingContractSet)
+	if errors.Is(err, api.ErrSettingNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	contracts, err := b.ms.Contracts(ctx, set)
+	if errors.Is(err, api.ErrContractSetNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if len(contracts) > 0 && len(contracts) < rs.TotalShards {
+		return fmt.Errorf("%w: contract set '%v' contains %v contracts but slabs are uploaded to %v hosts", api.ErrInsufficientContracts, set, len(contracts), rs.TotalShards)
+	}
+	return nil
+}
+
+func (b *bus) autopilotStateHandlerGET(jc jape.Context) {
+	state, err := b.aps.AutopilotState(jc.Request.Context())
+	if jc.Check("couldn't load autopilot state", err) == nil {
+		jc.Encode(state)
+	}
+}
+
+func (b *bus) autopilotStateHandlerPUT(jc jape.Context) {
+	var state api.AutopilotState
+	if jc.Decode(&state) != nil {
+		return
+	}
+	jc.Check("couldn't update autopilot state", b.aps.UpdateAutopilotState(jc.Request.Context(), state))
+}
+
+func (b *bus) settingKeyHistoryHandlerGET(jc jape.Context) {
+	offset := 0
+	limit := -1
+	if jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+	history, err := b.ss.SettingHistory(jc.Request.Context(), jc.PathParam("key"), offset, limit)
+	if jc.Check("couldn't fetch setting history", err) == nil {
+		jc.Encode(history)
+	}
+}
+
+func (b *bus) settingKeyRollbackHandlerPOST(jc jape.Context) {
+	var req api.SettingRollbackRequest
+	if jc.Decode(&req) != nil {
+		return
+	}
+	err := b.ss.RollbackSetting(jc.Request.Context(), jc.PathParam("key"), req.UpdateID)
+	if errors.Is(err, api.ErrSettingUpdateNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if jc.Check("couldn't roll back setting", err) != nil {
+		return
+	}
+	b.events.Broadcast(api.EventSettingChanged, api.EventSettingChangedData{Key: jc.PathParam("key")})
+}
+
 func (b *bus) setGougingSettings(ctx context.Context, gs api.GougingSettings) error {
 	if js, err := json.Marshal(gs); err != nil {
 		panic(err)
@@ -746,6 +1891,37 @@ func (b *bus) setRedundancySettings(ctx context.Context, rs api.RedundancySettin
 	}
 }
 
+func (b *bus) tracingHandlerGET(jc jape.Context) {
+	var ts api.TracingSettings
+	if tss, err := b.ss.Setting(jc.Request.Context(), SettingTracing); errors.Is(err, api.ErrSettingNotFound) {
+		jc.Error(err, http.StatusNotFound)
+	} else if err != nil {
+		jc.Error(err, http.StatusInternalServerError)
+	} else if err := json.Unmarshal([]byte(tss), &ts); err != nil {
+		b.logger.Panicf("failed to unmarshal tracing settings '%s': %v", tss, err)
+	} else {
+		jc.Encode(ts)
+	}
+}
+
+func (b *bus) tracingHandlerPUT(jc jape.Context) {
+	var ts api.TracingSettings
+	if jc.Decode(&ts) != nil {
+		return
+	} else if err := ts.Validate(); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	js, err := json.Marshal(ts)
+	if err != nil {
+		panic(err)
+	}
+	if jc.Check("could not update tracing settings", b.updateSetting(jc.Request.Context(), SettingTracing, string(js))) != nil {
+		return
+	}
+	jc.Check("could not update sampling rate", tracing.SetSamplingRate(ts.SamplingRate))
+}
+
 func (b *bus) contractIDAncestorsHandler(jc jape.Context) {
 	var fcid types.FileContractID
 	if jc.DecodeParam("id", &fcid) != nil {
@@ -790,9 +1966,18 @@ func (b *bus) paramsHandlerUploadGET(jc jape.Context) {
 		return
 	}
 
+	var ups api.UploadPackingSettings
+	if setting, err := b.ss.Setting(jc.Request.Context(), SettingUploadPacking); err != nil && !errors.Is(err, api.ErrSettingNotFound) {
+		jc.Error(fmt.Errorf("could not get upload packing setting: %w", err), http.StatusInternalServerError)
+		return
+	} else if err == nil && jc.Check("could not unmarshal upload packing setting", json.Unmarshal([]byte(setting), &ups)) != nil {
+		return
+	}
+
 	jc.Encode(api.UploadParams{
 		ContractSet:   cs,
 		CurrentHeight: b.cm.TipState(jc.Request.Context()).Index.Height,
+		UploadPacking: ups.Enabled,
 		GougingParams: gp,
 	})
 }
@@ -813,11 +1998,9 @@ func (b *bus) gougingParams(ctx context.Context) (api.GougingParams, error) {
 		b.logger.Panicf("failed to unmarshal gouging settings '%s': %v", gss, err)
 	}
 
-	var rs api.RedundancySettings
-	if rss, err := b.ss.Setting(ctx, SettingRedundancy); err != nil {
+	rs, err := b.redundancySettings(ctx)
+	if err != nil {
 		return api.GougingParams{}, err
-	} else if err := json.Unmarshal([]byte(rss), &rs); err != nil {
-		b.logger.Panicf("failed to unmarshal redundancy settings '%s': %v", rss, err)
 	}
 
 	cs := api.ConsensusState{
@@ -829,10 +2012,19 @@ func (b *bus) gougingParams(ctx context.Context) (api.GougingParams, error) {
 		ConsensusState:     cs,
 		GougingSettings:    gs,
 		RedundancySettings: rs,
-		TransactionFee:     b.tp.RecommendedFee(),
+		TransactionFee:     b.fees.Estimate(ctx).FeePerByte,
 	}, nil
 }
 
+func (b *bus) redundancySettings(ctx context.Context) (rs api.RedundancySettings, err error) {
+	if rss, err := b.ss.Setting(ctx, SettingRedundancy); err != nil {
+		return api.RedundancySettings{}, err
+	} else if err := json.Unmarshal([]byte(rss), &rs); err != nil {
+		b.logger.Panicf("failed to unmarshal redundancy settings '%s': %v", rss, err)
+	}
+	return
+}
+
 func (b *bus) accountsOwnerHandlerGET(jc jape.Context) {
 	var owner api.ParamString
 	if jc.DecodeParam("owner", &owner) != nil {
@@ -900,7 +2092,7 @@ func (b *bus) accountsUpdateHandlerPOST(jc jape.Context) {
 }
 
 // New returns a new Bus.
-func New(s Syncer, cm ChainManager, tp TransactionPool, w Wallet, hdb HostDB, ms MetadataStore, ss SettingStore, eas EphemeralAccountStore, l *zap.Logger) (*bus, error) {
+func New(s Syncer, cm ChainManager, tp TransactionPool, w Wallet, hdb HostDB, ms MetadataStore, ss SettingStore, eas EphemeralAccountStore, as AuditStore, ds DiagnosticsStore, rs ReportStore, js JobStore, fs FeeStore, sps SpendingStore, aps AutopilotStateStore, scs SchedulerStore, sds SeedStore, slabHealthInterval time.Duration, slabHealthBatchSize int, l *zap.Logger) (*bus, error) {
 	b := &bus{
 		s:             s,
 		cm:            cm,
@@ -910,7 +2102,19 @@ func New(s Syncer, cm ChainManager, tp TransactionPool, w Wallet, hdb HostDB, ms
 		ms:            ms,
 		ss:            ss,
 		eas:           eas,
+		as:            as,
+		ds:            ds,
+		rs:            rs,
+		js:            js,
+		fs:            fs,
+		aps:           aps,
+		sds:           sds,
 		contractLocks: newContractLocks(),
+		fees:          newFeeEstimator(cm, tp),
+		unsigned:      newUnsignedTransactions(),
+		spending:      newSpendingLedger(ss, sps),
+		workers:       newWorkerRegistry(),
+		uploading:     newUploadingSectors(),
 		logger:        l.Sugar().Named("bus"),
 	}
 	ctx, span := tracing.Tracer.Start(context.Background(), "bus.New")
@@ -936,9 +2140,300 @@ func New(s Syncer, cm ChainManager, tp TransactionPool, w Wallet, hdb HostDB, ms
 		return nil, err
 	}
 	b.accounts = newAccounts(accounts)
+
+	// Start aggregating the daily report.
+	b.reporter, err = newReporter(ctx, rs, ss, b.logger.Named("reports"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Start watching the alert thresholds.
+	b.events = newEventBroadcaster(b.logger.Named("events"))
+	b.alerts = newAlerter(ss, b.events, b.logger.Named("alerts"))
+	b.alerts.watch(alertWatchInterval, b.checkAlertThresholds)
+
+	// Start watching the wallet for deposits and contract payouts.
+	b.alerts.watch(alertWatchInterval, newWalletWatcher(w, cm, b.alerts, b.logger.Named("walletwatcher")).check)
+
+	// Start purging the objects whose retention period in the trash passed.
+	b.alerts.watch(trashPurgeInterval, b.purgeExpiredTrash)
+
+	// Start compacting the host announcements.
+	b.alerts.watch(announcementCompactionInterval, b.compactAnnouncements)
+
+	// Start recording the fee estimate.
+	b.alerts.watch(feeMetricInterval, b.recordFeeMetric)
+
+	// Start broadcasting the events scheduled for specific block heights,
+	// the expiry of active contracts that were added before the events were
+	// persisted is scheduled right away.
+	b.scheduler, err = newHeightScheduler(ctx, cm.TipState(ctx).Index.Height, scs, b.events, b.logger.Named("scheduler"))
+	if err != nil {
+		return nil, err
+	}
+	contracts, err := ms.ActiveContracts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range contracts {
+		if _, ok := b.scheduler.Scheduled(contractExpiryKey(c.ID)); !ok && c.WindowEnd > cm.TipState(ctx).Index.Height {
+			b.scheduleContractExpiry(ctx, c)
+		}
+	}
+
+	// Start refreshing the slab health, the alerts are checked after every
+	// refresh.
+	b.slabHealth = newSlabHealthChecker(ms, ss, slabHealthBatchSize, b.checkAlertThresholds, b.logger.Named("slabhealth"))
+	if slabHealthInterval > 0 {
+		b.slabHealth.run(slabHealthInterval)
+	}
+
+	// Start running the jobs that are handled by the bus itself, resuming the
+	// ones that were interrupted by a shutdown.
+	b.jobs = newJobRunner(js, map[string]jobFunc{
+		api.JobTypeGC:     b.runGCJob,
+		api.JobTypePrune:  b.runPruneJob,
+		api.JobTypeRescan: b.runRescanJob,
+	}, b.logger.Named("jobs"))
+	if err := b.jobs.run(ctx, jobPollInterval); err != nil {
+		return nil, err
+	}
 	return b, nil
 }
 
+func (b *bus) healthHandlerGET(jc jape.Context) {
+	maxBlocksBehind := uint64(defaultHealthMaxBlocksBehind)
+	if jc.DecodeForm("maxBlocksBehind", (*api.ParamUint64)(&maxBlocksBehind)) != nil {
+		return
+	}
+	ctx := jc.Request.Context()
+
+	results := make(map[string]error)
+	results["database"] = b.ds.Ping(ctx)
+	results["consensus"] = func() error {
+		cs := b.cm.TipState(ctx)
+		if !b.cm.Synced(ctx) {
+			return errors.New("consensus is not synced")
+		} else if behind := uint64(time.Since(cs.PrevTimestamps[0]) / cs.BlockInterval()); behind > maxBlocksBehind {
+			return fmt.Errorf("consensus is about %v blocks behind", behind)
+		} else if stats := b.consensusProcessingStats(ctx); stats.BlocksBehind > maxBlocksBehind {
+			return fmt.Errorf("processing of consensus changes is %v blocks behind", stats.BlocksBehind)
+		}
+		return nil
+	}()
+	results["wallet"] = func() error {
+		if b.w.Locked() {
+			return errors.New("wallet is locked")
+		}
+		return nil
+	}()
+	results["contracts"] = func() error {
+		set, err := b.ss.Setting(ctx, SettingContractSet)
+		if errors.Is(err, api.ErrSettingNotFound) {
+			return errors.New("no contract set configured")
+		} else if err != nil {
+			return err
+		}
+		contracts, err := b.ms.Contracts(ctx, set)
+		if err != nil {
+			return err
+		} else if len(contracts) == 0 {
+			return fmt.Errorf("contract set '%v' is empty", set)
+		}
+		return nil
+	}()
+	results["disk"] = func() error {
+		free, err := b.ds.FreeDiskSpace()
+		if err != nil {
+			return err
+		} else if free < healthMinFreeDiskSpace {
+			return fmt.Errorf("only %v bytes of free disk space left", free)
+		}
+		return nil
+	}()
+
+	resp := api.NewHealthResponse(results)
+	if !resp.OK {
+		jc.ResponseWriter.Header().Set("Content-Type", "application/json")
+		jc.ResponseWriter.WriteHeader(http.StatusServiceUnavailable)
+	}
+	jc.Encode(resp)
+}
+
+func (b *bus) debugQueryStatsHandlerGET(jc jape.Context) {
+	jc.Encode(b.ds.QueryStats())
+}
+
+func (b *bus) reportsDailyHandlerGET(jc jape.Context) {
+	var since time.Time
+	limit := -1
+	if jc.DecodeForm("since", (*api.ParamTime)(&since)) != nil || jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+	reports, err := b.rs.DailyReports(jc.Request.Context(), since, limit)
+	if jc.Check("couldn't load daily reports", err) != nil {
+		return
+	}
+
+	// The persisted report of the current day might be outdated or missing.
+	current := b.reporter.report()
+	if len(reports) > 0 && reports[0].Date.Equal(current.Date) {
+		reports[0] = current
+	} else if !current.Date.Before(reportDate(since)) && limit != 0 {
+		reports = append([]api.DailyReport{current}, reports...)
+		if limit > 0 && len(reports) > limit {
+			reports = reports[:limit]
+		}
+	}
+	jc.Encode(reports)
+}
+
+func (b *bus) reportsContractsHandlerGET(jc jape.Context) {
+	contracts, err := b.ms.ActiveContracts(jc.Request.Context())
+	if jc.Check("couldn't load contracts", err) != nil {
+		return
+	}
+	sizes, err := b.ms.ContractSizes(jc.Request.Context())
+	if jc.Check("couldn't load contract sizes", err) != nil {
+		return
+	}
+	jc.Encode(utilizationReport(contracts, sizes))
+}
+
+func (b *bus) alertsHandlerGET(jc jape.Context) {
+	jc.Encode(b.alerts.Alerts())
+}
+
+func (b *bus) alertsHandlerPOST(jc jape.Context) {
+	var alert api.Alert
+	if jc.Decode(&alert) != nil {
+		return
+	} else if err := alert.Validate(); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	b.alerts.Raise(alert.ID, alert.Severity, alert.Message)
+}
+
+func (b *bus) alertsHandlerDELETE(jc jape.Context) {
+	b.alerts.Resolve(jc.PathParam("id"))
+}
+
+func (b *bus) alertsSettingsHandlerGET(jc jape.Context) {
+	as, err := alertSettings(jc.Request.Context(), b.ss)
+	if jc.Check("could not load alert settings", err) == nil {
+		jc.Encode(as)
+	}
+}
+
+func (b *bus) alertsSettingsHandlerPUT(jc jape.Context) {
+	var as api.AlertSettings
+	if jc.Decode(&as) != nil {
+		return
+	} else if err := as.Validate(); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	js, err := json.Marshal(as)
+	if err != nil {
+		panic(err)
+	}
+	if jc.Check("could not update alert settings", b.updateSetting(jc.Request.Context(), SettingAlerts, string(js))) != nil {
+		return
+	}
+	b.checkAlertThresholds(jc.Request.Context())
+}
+
+func (b *bus) spendingHandlerGET(jc jape.Context) {
+	ctx := jc.Request.Context()
+	ps, err := b.spending.Spending(ctx, b.cm.TipState(ctx).Index.Height)
+	if jc.Check("could not load spending", err) == nil {
+		jc.Encode(ps)
+	}
+}
+
+func (b *bus) spendingAuthorizeHandlerPOST(jc jape.Context) {
+	ctx := jc.Request.Context()
+	var sar api.SpendingAuthorizeRequest
+	if jc.Decode(&sar) != nil {
+		return
+	}
+	if err := b.spending.Authorize(ctx, b.cm.TipState(ctx).Index.Height, sar.Category, sar.Amount); err != nil {
+		b.spendingError(jc, err)
+	}
+}
+
+func (b *bus) spendingCapsHandlerGET(jc jape.Context) {
+	sc, err := spendingCaps(jc.Request.Context(), b.ss)
+	if jc.Check("could not load spending caps", err) == nil {
+		jc.Encode(sc)
+	}
+}
+
+func (b *bus) spendingCapsHandlerPUT(jc jape.Context) {
+	var sc api.SpendingCaps
+	if jc.Decode(&sc) != nil {
+		return
+	} else if err := sc.Validate(); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	js, err := json.Marshal(sc)
+	if err != nil {
+		panic(err)
+	}
+	jc.Check("could not update spending caps", b.updateSetting(jc.Request.Context(), SettingSpendingCaps, string(js)))
+}
+
+// spendingError writes the error returned when authorizing spending, requests
+// exceeding a cap are forbidden.
+func (b *bus) spendingError(jc jape.Context, err error) {
+	if errors.Is(err, api.ErrSpendingCapExceeded) {
+		jc.Error(err, http.StatusForbidden)
+	} else {
+		jc.Check("could not authorize spending", err)
+	}
+}
+
+// recordSpending adds spending to the current spending period, errors are
+// logged since the spending already happened.
+func (b *bus) recordSpending(ctx context.Context, ps api.PeriodSpending) {
+	if err := b.spending.Record(ctx, b.cm.TipState(ctx).Index.Height, ps); err != nil {
+		b.logger.Errorw("failed to record spending", "error", err)
+	}
+}
+
+func (b *bus) auditHandlerGET(jc jape.Context) {
+	var since time.Time
+	var prefix string
+	offset := 0
+	limit := -1
+	if jc.DecodeForm("since", (*api.ParamTime)(&since)) != nil ||
+		jc.DecodeForm("prefix", &prefix) != nil ||
+		jc.DecodeForm("offset", &offset) != nil ||
+		jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+	entries, err := b.as.AuditEntries(jc.Request.Context(), since, prefix, offset, limit)
+	if jc.Check("couldn't load audit entries", err) == nil {
+		jc.Encode(entries)
+	}
+}
+
+func (b *bus) auditHandlerPOST(jc jape.Context) {
+	// only renterd's own components, which authenticate using the API
+	// password, record entries, callers with an identity could otherwise
+	// forge entries of other callers
+	if identity, _ := auth.Identity(jc.Request.Context()); identity != "" {
+		jc.Error(errors.New("audit entries can only be recorded using the API password"), http.StatusForbidden)
+		return
+	}
+	var entries []api.AuditEntry
+	if jc.Decode(&entries) == nil {
+		jc.Check("couldn't record audit entries", b.as.RecordAuditEntries(jc.Request.Context(), entries))
+	}
+}
+
 // Handler returns an HTTP handler that serves the bus API.
 func (b *bus) Handler() http.Handler {
 	return jape.Mux(tracing.TracedRoutes("bus", map[string]jape.Handler{
@@ -953,68 +2448,196 @@ func (b *bus) Handler() http.Handler {
 
 		"POST   /consensus/acceptblock": b.consensusAcceptBlock,
 		"GET    /consensus/state":       b.consensusStateHandler,
+		"GET    /consensus/changes":     b.consensusChangesHandlerGET,
+		"GET    /consensus/processing":  b.consensusProcessingHandlerGET,
 
 		"GET    /txpool/recommendedfee": b.txpoolFeeHandler,
 		"GET    /txpool/transactions":   b.txpoolTransactionsHandler,
 		"POST   /txpool/broadcast":      b.txpoolBroadcastHandler,
 
-		"GET    /wallet/balance":       b.walletBalanceHandler,
-		"GET    /wallet/address":       b.walletAddressHandler,
-		"GET    /wallet/transactions":  b.walletTransactionsHandler,
-		"GET    /wallet/outputs":       b.walletOutputsHandler,
-		"POST   /wallet/fund":          b.walletFundHandler,
-		"POST   /wallet/sign":          b.walletSignHandler,
-		"POST   /wallet/redistribute":  b.walletRedistributeHandler,
-		"POST   /wallet/discard":       b.walletDiscardHandler,
-		"POST   /wallet/prepare/form":  b.walletPrepareFormHandler,
-		"POST   /wallet/prepare/renew": b.walletPrepareRenewHandler,
-		"GET    /wallet/pending":       b.walletPendingHandler,
-
-		"GET    /hosts":              b.hostsHandlerGET,
-		"GET    /host/:hostkey":      b.hostsPubkeyHandlerGET,
-		"POST   /hosts/interactions": b.hostsPubkeyHandlerPOST,
-		"POST   /hosts/remove":       b.hostsRemoveHandlerPOST,
-		"GET    /hosts/allowlist":    b.hostsAllowlistHandlerGET,
-		"PUT    /hosts/allowlist":    b.hostsAllowlistHandlerPUT,
-		"GET    /hosts/blocklist":    b.hostsBlocklistHandlerGET,
-		"PUT    /hosts/blocklist":    b.hostsBlocklistHandlerPUT,
-		"GET    /hosts/scanning":     b.hostsScanningHandlerGET,
-
-		"GET    /contracts/active":       b.contractsActiveHandlerGET,
-		"GET    /contracts/sets":         b.contractsSetsHandlerGET,
-		"GET    /contracts/set/:set":     b.contractsSetHandlerGET,
-		"PUT    /contracts/set/:set":     b.contractsSetHandlerPUT,
-		"POST   /contracts/spending":     b.contractsSpendingHandlerPOST,
-		"GET    /contract/:id":           b.contractIDHandlerGET,
-		"POST   /contract/:id":           b.contractIDHandlerPOST,
-		"GET    /contract/:id/ancestors": b.contractIDAncestorsHandler,
-		"POST   /contract/:id/renewed":   b.contractIDRenewedHandlerPOST,
-		"DELETE /contract/:id":           b.contractIDHandlerDELETE,
-		"POST   /contract/:id/acquire":   b.contractAcquireHandlerPOST,
-		"POST   /contract/:id/release":   b.contractReleaseHandlerPOST,
+		"GET    /wallet/balance":           b.walletBalanceHandler,
+		"GET    /wallet/address":           b.walletAddressHandler,
+		"POST   /wallet/address":           b.walletAddressHandlerPOST,
+		"GET    /wallet/transactions":      b.walletTransactionsHandler,
+		"GET    /wallet/outputs":           b.walletOutputsHandler,
+		"GET    /wallet/outputs/spendable": b.walletOutputsSpendableHandlerGET,
+		"GET    /wallet/fee":               b.walletFeeHandler,
+		"POST   /wallet/fund":              b.walletFundHandler,
+		"POST   /wallet/sign":              b.walletSignHandler,
+		"POST   /wallet/redistribute":      b.walletRedistributeHandler,
+		"POST   /wallet/rescan":            b.walletRescanHandlerPOST,
+		"POST   /wallet/discard":           b.walletDiscardHandler,
+		"POST   /wallet/prepare/form":      b.walletPrepareFormHandler,
+		"POST   /wallet/prepare/renew":     b.walletPrepareRenewHandler,
+		"GET    /wallet/pending":           b.walletPendingHandler,
+		"POST   /wallet/lock":              b.walletLockHandlerPOST,
+		"GET    /wallet/locked":            b.walletLockedHandlerGET,
+		"POST   /wallet/unlock":            b.walletUnlockHandlerPOST,
+		"POST   /wallet/seed/export":       b.walletSeedExportHandlerPOST,
+		"POST   /wallet/seed/import":       b.walletSeedImportHandlerPOST,
+		"GET    /wallet/unsigned":          b.walletUnsignedHandlerGET,
+		"POST   /wallet/unsigned/:id":      b.walletUnsignedIDHandlerPOST,
+		"DELETE /wallet/unsigned/:id":      b.walletUnsignedIDHandlerDELETE,
+
+		"GET    /hosts":                       b.hostsHandlerGET,
+		"GET    /host/:hostkey":               b.hostsPubkeyHandlerGET,
+		"GET    /host/:hostkey/announcements": b.hostsPubkeyAnnouncementsHandlerGET,
+		"POST   /hosts/interactions":          b.hostsPubkeyHandlerPOST,
+		"POST   /hosts/remove":                b.hostsRemoveHandlerPOST,
+
+		"GET    /hosts/allowlist": b.hostsAllowlistHandlerGET,
+		"PUT    /hosts/allowlist": b.hostsAllowlistHandlerPUT,
+		"GET    /hosts/blocklist": b.hostsBlocklistHandlerGET,
+		"PUT    /hosts/blocklist": b.hostsBlocklistHandlerPUT,
+		"PUT    /hosts/groups":    b.hostsGroupsHandlerPUT,
+		"PUT    /hosts/external":  b.hostsExternalHandlerPUT,
+		"GET    /hosts/scanning":  b.hostsScanningHandlerGET,
+
+		"GET    /contracts/active":        b.contractsActiveHandlerGET,
+		"GET    /contracts/locks":         b.contractsLocksHandlerGET,
+		"GET    /contracts/sets":          b.contractsSetsHandlerGET,
+		"GET    /contracts/set/:set":      b.contractsSetHandlerGET,
+		"PUT    /contracts/set/:set":      b.contractsSetHandlerPUT,
+		"GET    /contracts/set/:set/diff": b.contractsSetDiffHandlerGET,
+		"POST   /contracts/spending":      b.contractsSpendingHandlerPOST,
+		"POST   /contracts/usability":     b.contractsUsabilityHandlerPOST,
+		"GET    /contract/:id":            b.contractIDHandlerGET,
+		"POST   /contract/:id":            b.contractIDHandlerPOST,
+		"GET    /contract/:id/ancestors":  b.contractIDAncestorsHandler,
+		"GET    /contract/:id/objects":    b.contractIDObjectsHandlerGET,
+		"GET    /contract/:id/roots":      b.contractIDRootsHandlerGET,
+		"PUT    /contract/:id/roots":      b.contractIDRootsHandlerPUT,
+		"POST   /contract/:id/uploading":  b.contractIDUploadingHandlerPOST,
+		"POST   /contract/:id/broadcast":  b.contractIDBroadcastHandlerPOST,
+		"POST   /contract/:id/renewed":    b.contractIDRenewedHandlerPOST,
+		"DELETE /contract/:id":            b.contractIDHandlerDELETE,
+		"POST   /contract/:id/acquire":    b.contractAcquireHandlerPOST,
+		"POST   /contract/:id/release":    b.contractReleaseHandlerPOST,
+		"POST   /contract/:id/keepalive":  b.contractKeepaliveHandlerPOST,
 
 		"POST /search/hosts":  b.searchHostsHandlerPOST,
 		"GET /search/objects": b.searchObjectsHandlerGET,
 
-		"GET    /objects/*key": b.objectsKeyHandlerGET,
-		"PUT    /objects/*key": b.objectsKeyHandlerPUT,
-		"DELETE /objects/*key": b.objectsKeyHandlerDELETE,
-
-		"POST   /slabs/migration": b.slabsMigrationHandlerPOST,
-		"PUT    /slab":            b.slabHandlerPUT,
-
-		"GET    /settings":     b.settingsHandlerGET,
-		"PUT    /settings":     b.settingsHandlerPUT,
-		"GET    /setting/:key": b.settingKeyHandlerGET,
-		"PUT    /setting/:key": b.settingKeyHandlerPUT,
+		"GET    /objects/*key":   b.objectsKeyHandlerGET,
+		"PUT    /objects/*key":   b.objectsKeyHandlerPUT,
+		"DELETE /objects/*key":   b.objectsKeyHandlerDELETE,
+		"POST   /objects/rename": b.objectsRenameHandlerPOST,
+
+		"PUT    /importance/*key": b.importanceKeyHandlerPUT,
+
+		"GET    /slabs/health":               b.slabsHealthHandlerGET,
+		"GET    /slabs/health/summary":       b.slabsHealthSummaryHandlerGET,
+		"POST   /slabs/migration":            b.slabsMigrationHandlerPOST,
+		"GET    /slabs/migrations":           b.slabsMigrationsHandlerGET,
+		"POST   /slabs/migrations":           b.slabsMigrationsHandlerPOST,
+		"POST   /slabs/migrations/:id/retry": b.slabsMigrationsIDRetryHandlerPOST,
+		"POST   /slabs/packed":               b.slabsPackedHandlerPOST,
+		"POST   /slabs/packed/done":          b.slabsPackedDoneHandlerPOST,
+		"GET    /slabs/repair":               b.slabsRepairHandlerGET,
+		"POST   /slabs/repair/enqueue":       b.slabsRepairEnqueueHandlerPOST,
+		"POST   /slabs/repair/results":       b.slabsRepairResultsHandlerPOST,
+		"PUT    /slab":                       b.slabHandlerPUT,
+
+		"GET    /reshard/objects":  b.reshardObjectsHandlerGET,
+		"GET    /reshard/progress": b.reshardProgressHandlerGET,
+
+		"GET    /audits/hosts":   b.auditsHostsHandlerGET,
+		"GET    /audits/objects": b.auditsObjectsHandlerGET,
+		"POST   /audits/objects": b.auditsObjectsHandlerPOST,
+		"GET    /sectors/audits": b.sectorsAuditsHandlerGET,
+		"POST   /sectors/audits": b.sectorsAuditsHandlerPOST,
+
+		"GET    /consistency":        b.consistencyHandlerGET,
+		"POST   /consistency/repair": b.consistencyRepairHandlerPOST,
+
+		"POST   /gc":                 b.gcHandlerPOST,
+		"GET    /gc/sectors":         b.gcSectorsHandlerGET,
+		"GET    /gc/sectors/:id":     b.gcSectorsIDHandlerGET,
+		"POST   /gc/sectors/deleted": b.gcSectorsDeletedHandlerPOST,
+
+		"GET    /settings":              b.settingsHandlerGET,
+		"PUT    /settings":              b.settingsHandlerPUT,
+		"GET    /setting/:key":          b.settingKeyHandlerGET,
+		"PUT    /setting/:key":          b.settingKeyHandlerPUT,
+		"GET    /setting/:key/history":  b.settingKeyHistoryHandlerGET,
+		"POST   /setting/:key/rollback": b.settingKeyRollbackHandlerPOST,
+
+		"GET    /autopilot/state": b.autopilotStateHandlerGET,
+		"PUT    /autopilot/state": b.autopilotStateHandlerPUT,
+
+		"GET    /tracing": b.tracingHandlerGET,
+		"PUT    /tracing": b.tracingHandlerPUT,
 
 		"GET    /params/download": b.paramsHandlerDownloadGET,
 		"GET    /params/upload":   b.paramsHandlerUploadGET,
 		"GET    /params/gouging":  b.paramsHandlerGougingGET,
+
+		"GET    /audit": b.auditHandlerGET,
+		"POST   /audit": b.auditHandlerPOST,
+
+		"GET    /health": b.healthHandlerGET,
+
+		"GET    /reports/daily":     b.reportsDailyHandlerGET,
+		"GET    /reports/contracts": b.reportsContractsHandlerGET,
+
+		"GET    /metrics/fees": b.metricsFeesHandlerGET,
+
+		"GET    /network/stats": b.networkStatsHandlerGET,
+
+		"GET    /events": b.eventsHandlerGET,
+
+		"GET    /schedule":      b.scheduleHandlerGET,
+		"POST   /schedule":      b.scheduleHandlerPOST,
+		"DELETE /schedule/:key": b.scheduleKeyHandlerDELETE,
+
+		"GET    /workers":          b.workersHandlerGET,
+		"POST   /workers/register": b.workersRegisterHandlerPOST,
+		"DELETE /workers/:id":      b.workerIDHandlerDELETE,
+
+		"GET    /route/objects/*key": b.routeObjectsKeyHandlerGET,
+		"PUT    /route/objects/*key": b.routeObjectsKeyHandlerPUT,
+
+		"GET    /jobs":           b.jobsHandlerGET,
+		"POST   /jobs":           b.jobsHandlerPOST,
+		"POST   /jobs/acquire":   b.jobsAcquireHandlerPOST,
+		"GET    /job/:id":        b.jobIDHandlerGET,
+		"PUT    /job/:id":        b.jobIDHandlerPUT,
+		"POST   /job/:id/cancel": b.jobIDCancelHandlerPOST,
+		"POST   /job/:id/retry":  b.jobIDRetryHandlerPOST,
+
+		"GET    /alerts":          b.alertsHandlerGET,
+		"POST   /alerts":          b.alertsHandlerPOST,
+		"DELETE /alerts/:id":      b.alertsHandlerDELETE,
+		"GET    /alerts/settings": b.alertsSettingsHandlerGET,
+		"PUT    /alerts/settings": b.alertsSettingsHandlerPUT,
+
+		"GET    /trash":             b.trashHandlerGET,
+		"DELETE /trash":             b.trashHandlerDELETE,
+		"GET    /trash/settings":    b.trashSettingsHandlerGET,
+		"PUT    /trash/settings":    b.trashSettingsHandlerPUT,
+		"POST   /trash/:id/restore": b.trashIDRestoreHandlerPOST,
+		"DELETE /trash/:id":         b.trashIDHandlerDELETE,
+
+		"GET    /spending":           b.spendingHandlerGET,
+		"POST   /spending/authorize": b.spendingAuthorizeHandlerPOST,
+		"GET    /spending/caps":      b.spendingCapsHandlerGET,
+		"PUT    /spending/caps":      b.spendingCapsHandlerPUT,
+
+		"GET    /debug/pprof/*profile": profiling.Handler(b.ss.Setting),
+		"GET    /debug/querystats":     b.debugQueryStatsHandlerGET,
 	}))
 }
 
 // Shutdown shuts down the bus.
 func (b *bus) Shutdown(ctx context.Context) error {
-	return b.eas.SaveAccounts(ctx, b.accounts.ToPersist())
+	b.slabHealth.Shutdown()
+	b.scheduler.Shutdown()
+	b.jobs.Shutdown()
+	b.alerts.Shutdown()
+	b.events.Shutdown()
+	err := b.reporter.Shutdown(ctx)
+	if err := b.eas.SaveAccounts(ctx, b.accounts.ToPersist()); err != nil {
+		return err
+	}
+	return err
 }
@@ -1,12 +1,16 @@
 package bus
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"math/big"
+	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	rhpv2 "go.sia.tech/core/rhp/v2"
@@ -55,6 +59,26 @@ func (c *Client) ConsensusState(ctx context.Context) (resp api.ConsensusState, e
 	return
 }
 
+// ConsensusChanges returns up to limit encoded consensus changes following the
+// change with the given id.
+func (c *Client) ConsensusChanges(ctx context.Context, after types.Hash256, limit int) (resp api.ConsensusChanges, err error) {
+	values := url.Values{}
+	values.Set("after", after.String())
+	values.Set("limit", fmt.Sprint(limit))
+	err = c.c.WithContext(ctx).GET("/consensus/changes?"+values.Encode(), &resp)
+	if err != nil && strings.Contains(err.Error(), api.ErrConsensusChangeNotFound.Error()) {
+		err = api.ErrConsensusChangeNotFound
+	}
+	return
+}
+
+// ConsensusProcessingStats returns how far the processing of consensus changes
+// is behind the tip and how long persisting host announcements takes.
+func (c *Client) ConsensusProcessingStats(ctx context.Context) (stats api.ConsensusProcessingStats, err error) {
+	err = c.c.WithContext(ctx).GET("/consensus/processing", &stats)
+	return
+}
+
 // TransactionPool returns the transactions currently in the pool.
 func (c *Client) TransactionPool(ctx context.Context) (txns []types.Transaction, err error) {
 	err = c.c.WithContext(ctx).GET("/txpool/transactions", &txns)
@@ -78,12 +102,31 @@ func (c *Client) WalletAddress(ctx context.Context) (resp types.Address, err err
 	return
 }
 
+// WalletNewAddress derives a fresh address controlled by the wallet.
+func (c *Client) WalletNewAddress(ctx context.Context) (resp types.Address, err error) {
+	err = c.c.WithContext(ctx).POST("/wallet/address", nil, &resp)
+	return
+}
+
+// WalletFee returns the recommended fee per byte for wallet transactions.
+func (c *Client) WalletFee(ctx context.Context) (resp api.FeeEstimate, err error) {
+	err = c.c.WithContext(ctx).GET("/wallet/fee", &resp)
+	return
+}
+
 // WalletOutputs returns the set of unspent outputs controlled by the wallet.
 func (c *Client) WalletOutputs(ctx context.Context) (resp []wallet.SiacoinElement, err error) {
 	err = c.c.WithContext(ctx).GET("/wallet/outputs", &resp)
 	return
 }
 
+// WalletSpendableOutputs returns the set of outputs controlled by the wallet
+// that aren't spent or locked, along with their number of confirmations.
+func (c *Client) WalletSpendableOutputs(ctx context.Context) (resp []api.WalletOutput, err error) {
+	err = c.c.WithContext(ctx).GET("/wallet/outputs/spendable", &resp)
+	return
+}
+
 // estimatedSiacoinTxnSize estimates the txn size of a siacoin txn without file
 // contract given its number of outputs.
 func estimatedSiacoinTxnSize(nOutputs uint64) uint64 {
@@ -130,9 +173,16 @@ func (c *Client) WalletTransactions(ctx context.Context, since time.Time, max in
 
 // WalletFund funds txn using inputs controlled by the wallet.
 func (c *Client) WalletFund(ctx context.Context, txn *types.Transaction, amount types.Currency) ([]types.Hash256, []types.Transaction, error) {
+	return c.WalletFundWithOutputs(ctx, txn, amount, nil)
+}
+
+// WalletFundWithOutputs funds txn by spending the given outputs controlled by
+// the wallet, if no outputs are given the wallet picks them itself.
+func (c *Client) WalletFundWithOutputs(ctx context.Context, txn *types.Transaction, amount types.Currency, outputs []types.Hash256) ([]types.Hash256, []types.Transaction, error) {
 	req := api.WalletFundRequest{
 		Transaction: *txn,
 		Amount:      amount,
+		Outputs:     outputs,
 	}
 	var resp api.WalletFundResponse
 	err := c.c.WithContext(ctx).POST("/wallet/fund", req, &resp)
@@ -204,6 +254,74 @@ func (c *Client) WalletPrepareRenew(ctx context.Context, contract types.FileCont
 	return resp.TransactionSet, resp.FinalPayment, err
 }
 
+// WalletLock locks the wallet, signing operations fail until it's unlocked.
+func (c *Client) WalletLock(ctx context.Context) (err error) {
+	err = c.c.WithContext(ctx).POST("/wallet/lock", nil, nil)
+	return
+}
+
+// WalletLocked returns whether the wallet is locked.
+func (c *Client) WalletLocked(ctx context.Context) (locked bool, err error) {
+	err = c.c.WithContext(ctx).GET("/wallet/locked", &locked)
+	return
+}
+
+// WalletUnlock unlocks the wallet using the passphrase its seed was encrypted
+// with.
+func (c *Client) WalletUnlock(ctx context.Context, passphrase string) (err error) {
+	err = c.c.WithContext(ctx).POST("/wallet/unlock", api.WalletUnlockRequest{Passphrase: passphrase}, nil)
+	return
+}
+
+// WalletSeedExport returns the wallet's seed encrypted with the export
+// passphrase, passphrase decrypts the seed stored on the node.
+func (c *Client) WalletSeedExport(ctx context.Context, passphrase, exportPassphrase string) (backup api.WalletSeedBackup, err error) {
+	err = c.c.WithContext(ctx).POST("/wallet/seed/export", api.WalletSeedExportRequest{
+		Passphrase:       passphrase,
+		ExportPassphrase: exportPassphrase,
+	}, &backup)
+	return
+}
+
+// WalletSeedImport imports a seed that was exported from another node, it's
+// stored encrypted with the given passphrase.
+func (c *Client) WalletSeedImport(ctx context.Context, backup api.WalletSeedBackup, exportPassphrase, passphrase string) (resp api.WalletSeedImportResponse, err error) {
+	err = c.c.WithContext(ctx).POST("/wallet/seed/import", api.WalletSeedImportRequest{
+		Backup:           backup,
+		ExportPassphrase: exportPassphrase,
+		Passphrase:       passphrase,
+	}, &resp)
+	return
+}
+
+// WalletUnsigned returns the transactions that are waiting to be signed
+// externally.
+func (c *Client) WalletUnsigned(ctx context.Context) (resp []api.UnsignedTransaction, err error) {
+	err = c.c.WithContext(ctx).GET("/wallet/unsigned", &resp)
+	return
+}
+
+// WalletSubmitSigned broadcasts the externally signed version of a queued
+// transaction.
+func (c *Client) WalletSubmitSigned(ctx context.Context, id types.TransactionID, txn types.Transaction) (err error) {
+	err = c.c.WithContext(ctx).POST(fmt.Sprintf("/wallet/unsigned/%s", id), txn, nil)
+	return
+}
+
+// WalletDiscardUnsigned discards a queued transaction, making its inputs
+// usable again.
+func (c *Client) WalletDiscardUnsigned(ctx context.Context, id types.TransactionID) (err error) {
+	err = c.c.WithContext(ctx).DELETE(fmt.Sprintf("/wallet/unsigned/%s", id))
+	return
+}
+
+// WalletRescan resets the wallet and rebuilds its outputs and transactions
+// from the blockchain in the background, ignoring blocks below fromHeight.
+func (c *Client) WalletRescan(ctx context.Context, fromHeight uint64) (err error) {
+	err = c.c.WithContext(ctx).POST(fmt.Sprintf("/wallet/rescan?fromHeight=%d", fromHeight), nil, nil)
+	return
+}
+
 // WalletPending returns the txpool transactions that are relevant to the
 // wallet.
 func (c *Client) WalletPending(ctx context.Context) (resp []types.Transaction, err error) {
@@ -217,6 +335,36 @@ func (c *Client) Host(ctx context.Context, hostKey types.PublicKey) (h hostdb.Ho
 	return
 }
 
+// HostAnnouncements returns the announcements of the host with the given key
+// that weren't compacted yet, latest first.
+func (c *Client) HostAnnouncements(ctx context.Context, hostKey types.PublicKey, offset, limit int) (announcements []hostdb.Announcement, err error) {
+	values := url.Values{}
+	values.Set("offset", fmt.Sprint(offset))
+	values.Set("limit", fmt.Sprint(limit))
+	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/host/%s/announcements?%s", hostKey, values.Encode()), &announcements)
+	return
+}
+
+// AnnouncementSettings returns the host announcement compaction settings.
+func (c *Client) AnnouncementSettings(ctx context.Context) (as api.AnnouncementSettings, err error) {
+	setting, err := c.Setting(ctx, SettingAnnouncements)
+	if err != nil {
+		return api.AnnouncementSettings{}, err
+	}
+	err = json.Unmarshal([]byte(setting), &as)
+	return
+}
+
+// UpdateAnnouncementSettings updates the host announcement compaction
+// settings.
+func (c *Client) UpdateAnnouncementSettings(ctx context.Context, as api.AnnouncementSettings) error {
+	b, err := json.Marshal(as)
+	if err != nil {
+		return err
+	}
+	return c.UpdateSetting(ctx, SettingAnnouncements, string(b))
+}
+
 // Hosts returns 'limit' hosts at given 'offset'.
 func (c *Client) Hosts(ctx context.Context, offset, limit int) (hosts []hostdb.Host, err error) {
 	values := url.Values{}
@@ -254,6 +402,30 @@ func (c *Client) UpdateHostAllowlist(ctx context.Context, add, remove []types.Pu
 	return
 }
 
+// UpdateHostGroups assigns the given hosts to the group of hosts suspected to
+// be run by the same operator, an empty group removes a host from its group.
+func (c *Client) UpdateHostGroups(ctx context.Context, groups map[types.PublicKey]string) (err error) {
+	err = c.c.WithContext(ctx).PUT("/hosts/groups", groups)
+	return
+}
+
+// NetworkStats returns a summary of the hosts in the hostdb and compares the
+// hosts of the given contract set to them, if the set is empty the contract
+// set setting is used.
+func (c *Client) NetworkStats(ctx context.Context, set string) (stats api.NetworkStats, err error) {
+	values := url.Values{}
+	values.Set("set", set)
+	err = c.c.WithContext(ctx).GET("/network/stats?"+values.Encode(), &stats)
+	return
+}
+
+// UpdateHostExternalData stores the data an external host-data provider
+// reported for the given hosts.
+func (c *Client) UpdateHostExternalData(ctx context.Context, data map[types.PublicKey]hostdb.ExternalData) (err error) {
+	err = c.c.WithContext(ctx).PUT("/hosts/external", data)
+	return
+}
+
 // HostBlocklist returns a host blocklist.
 func (c *Client) HostBlocklist(ctx context.Context) (blocklist []string, err error) {
 	err = c.c.WithContext(ctx).GET("/hosts/blocklist", &blocklist)
@@ -278,6 +450,12 @@ func (c *Client) RecordContractSpending(ctx context.Context, records []api.Contr
 	return
 }
 
+// UpdateContractUsability updates the usability flags of the given contracts.
+func (c *Client) UpdateContractUsability(ctx context.Context, updates []api.ContractUsabilityUpdate) (err error) {
+	err = c.c.WithContext(ctx).POST("/contracts/usability", updates, nil)
+	return
+}
+
 // ActiveContracts returns all active contracts in the metadata store.
 func (c *Client) ActiveContracts(ctx context.Context) (contracts []api.ContractMetadata, err error) {
 	err = c.c.WithContext(ctx).GET("/contracts/active", &contracts)
@@ -326,6 +504,42 @@ func (c *Client) AddRenewedContract(ctx context.Context, contract rhpv2.Contract
 	return
 }
 
+// ContractObjects returns the objects with slabs that have shards stored on
+// the given contract.
+func (c *Client) ContractObjects(ctx context.Context, fcid types.FileContractID) (objects []api.ContractObject, err error) {
+	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/contract/%s/objects", fcid), &objects)
+	return
+}
+
+// RecordContractBroadcast records that the latest revision of the contract was
+// broadcast.
+func (c *Client) RecordContractBroadcast(ctx context.Context, fcid types.FileContractID, cb api.ContractBroadcast) (err error) {
+	err = c.c.WithContext(ctx).POST(fmt.Sprintf("/contract/%s/broadcast", fcid), cb, nil)
+	return
+}
+
+// ContractRoots returns the roots of the sectors stored on the given contract
+// that are still referenced by an object or are still being uploaded.
+func (c *Client) ContractRoots(ctx context.Context, fcid types.FileContractID) (roots []types.Hash256, err error) {
+	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/contract/%s/roots", fcid), &roots)
+	return
+}
+
+// RestoreContractRoots restores the roots of a contract that was found on the
+// blockchain, until then the contract isn't pruned.
+func (c *Client) RestoreContractRoots(ctx context.Context, fcid types.FileContractID, roots []types.Hash256) (err error) {
+	err = c.c.WithContext(ctx).PUT(fmt.Sprintf("/contract/%s/roots", fcid), roots)
+	return
+}
+
+// AddUploadingSectors records that the sectors with the given roots were
+// uploaded to the contract, they aren't pruned while the upload is in
+// progress.
+func (c *Client) AddUploadingSectors(ctx context.Context, fcid types.FileContractID, roots []types.Hash256) (err error) {
+	err = c.c.WithContext(ctx).POST(fmt.Sprintf("/contract/%s/uploading", fcid), roots, nil)
+	return
+}
+
 // AncestorContracts returns any ancestors of a given active contract.
 func (c *Client) AncestorContracts(ctx context.Context, fcid types.FileContractID, minStartHeight uint64) (contracts []api.ArchivedContract, err error) {
 	values := url.Values{}
@@ -340,6 +554,13 @@ func (c *Client) SetContractSet(ctx context.Context, set string, contracts []typ
 	return
 }
 
+// ContractSetDiff returns the contracts that were added to and removed from
+// the given contract set since the given time.
+func (c *Client) ContractSetDiff(ctx context.Context, set string, since time.Time) (diff api.ContractSetDiff, err error) {
+	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/contracts/set/%s/diff?since=%s", set, api.ParamTime(since)), &diff)
+	return
+}
+
 // DeleteContracts deletes the contracts with the given IDs.
 func (c *Client) DeleteContracts(ctx context.Context, ids []types.FileContractID) error {
 	// TODO: batch delete
@@ -377,6 +598,23 @@ func (c *Client) ReleaseContract(ctx context.Context, fcid types.FileContractID,
 	return
 }
 
+// KeepaliveContract extends the lease of a contract lock by the given duration.
+// An error is returned if the lock expired or was released in the meantime, in
+// which case the contract must no longer be used.
+func (c *Client) KeepaliveContract(ctx context.Context, fcid types.FileContractID, lockID uint64, d time.Duration) (err error) {
+	err = c.c.WithContext(ctx).POST(fmt.Sprintf("/contract/%s/keepalive", fcid), api.ContractKeepaliveRequest{
+		LockID:   lockID,
+		Duration: api.ParamDuration(d),
+	}, nil)
+	return
+}
+
+// ContractLocks returns the contention metrics of the contract locks.
+func (c *Client) ContractLocks(ctx context.Context) (stats []api.ContractLockStats, err error) {
+	err = c.c.WithContext(ctx).GET("/contracts/locks", &stats)
+	return
+}
+
 // RecommendedFee returns the recommended fee for a txn.
 func (c *Client) RecommendedFee(ctx context.Context) (fee types.Currency, err error) {
 	err = c.c.WithContext(ctx).GET("/txpool/recommendedfee", &fee)
@@ -408,6 +646,18 @@ func (c *Client) ContractsForSlab(ctx context.Context, shards []object.Sector, c
 	return filtered, nil
 }
 
+// AutopilotState returns the state the autopilot persisted.
+func (c *Client) AutopilotState(ctx context.Context) (state api.AutopilotState, err error) {
+	err = c.c.WithContext(ctx).GET("/autopilot/state", &state)
+	return
+}
+
+// UpdateAutopilotState persists the state of the autopilot.
+func (c *Client) UpdateAutopilotState(ctx context.Context, state api.AutopilotState) (err error) {
+	err = c.c.WithContext(ctx).PUT("/autopilot/state", state)
+	return
+}
+
 // Setting returns the value for the setting with given key.
 func (c *Client) Setting(ctx context.Context, key string) (value string, err error) {
 	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/setting/%s", key), &value)
@@ -425,6 +675,22 @@ func (c *Client) UpdateSetting(ctx context.Context, key string, value string) er
 	return c.c.WithContext(ctx).PUT(fmt.Sprintf("/setting/%s", key), value)
 }
 
+// SettingHistory returns the updates of the setting with the given key, most
+// recent first.
+func (c *Client) SettingHistory(ctx context.Context, key string, offset, limit int) (history []api.SettingUpdate, err error) {
+	values := url.Values{}
+	values.Set("offset", fmt.Sprint(offset))
+	values.Set("limit", fmt.Sprint(limit))
+	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/setting/%s/history?%s", key, values.Encode()), &history)
+	return
+}
+
+// RollbackSetting resets the setting with the given key to the value it had
+// after the update with the given id.
+func (c *Client) RollbackSetting(ctx context.Context, key string, id uint) error {
+	return c.c.WithContext(ctx).POST(fmt.Sprintf("/setting/%s/rollback", key), api.SettingRollbackRequest{UpdateID: id}, nil)
+}
+
 // UpdateSettings will bulk update the given settings.
 func (c *Client) UpdateSettings(ctx context.Context, settings map[string]string) error {
 	return c.c.WithContext(ctx).PUT("/settings", settings)
@@ -449,6 +715,18 @@ func (c *Client) UpdateGougingSettings(ctx context.Context, gs api.GougingSettin
 	return c.UpdateSetting(ctx, SettingGouging, string(b))
 }
 
+// TracingSettings returns the tracing settings.
+func (c *Client) TracingSettings(ctx context.Context) (ts api.TracingSettings, err error) {
+	err = c.c.WithContext(ctx).GET("/tracing", &ts)
+	return
+}
+
+// UpdateTracingSettings updates the tracing settings, the sampling rate is
+// applied immediately.
+func (c *Client) UpdateTracingSettings(ctx context.Context, ts api.TracingSettings) error {
+	return c.c.WithContext(ctx).PUT("/tracing", ts)
+}
+
 // RedundancySettings returns the redundancy settings.
 func (c *Client) RedundancySettings(ctx context.Context) (rs api.RedundancySettings, err error) {
 	setting, err := c.Setting(ctx, SettingRedundancy)
@@ -468,6 +746,39 @@ func (c *Client) UpdateRedundancySettings(ctx context.Context, rs api.Redundancy
 	return c.UpdateSetting(ctx, SettingRedundancy, string(b))
 }
 
+// ForceUpdateRedundancySettings updates the redundancy settings even if the
+// current contract set doesn't contain enough contracts to upload all shards
+// of a slab.
+func (c *Client) ForceUpdateRedundancySettings(ctx context.Context, rs api.RedundancySettings) error {
+	b, err := json.Marshal(rs)
+	if err != nil {
+		return err
+	}
+	return c.c.WithContext(ctx).PUT(fmt.Sprintf("/setting/%s?force=true", SettingRedundancy), string(b))
+}
+
+// UploadPackingSettings returns the upload packing settings.
+func (c *Client) UploadPackingSettings(ctx context.Context) (ups api.UploadPackingSettings, err error) {
+	setting, err := c.Setting(ctx, SettingUploadPacking)
+	if errors.Is(err, api.ErrSettingNotFound) {
+		return api.UploadPackingSettings{}, nil
+	} else if err != nil {
+		return api.UploadPackingSettings{}, err
+	}
+	err = json.Unmarshal([]byte(setting), &ups)
+	return
+}
+
+// UpdateUploadPackingSettings enables or disables packing the tails of
+// uploaded objects.
+func (c *Client) UpdateUploadPackingSettings(ctx context.Context, ups api.UploadPackingSettings) error {
+	b, err := json.Marshal(ups)
+	if err != nil {
+		return err
+	}
+	return c.UpdateSetting(ctx, SettingUploadPacking, string(b))
+}
+
 // SearchHosts returns all hosts that match certain search criteria.
 func (c *Client) SearchHosts(ctx context.Context, offset, limit int, filterMode string, addressContains string, keyIn []types.PublicKey) (hosts []hostdb.Host, err error) {
 	err = c.c.WithContext(ctx).POST("/search/hosts", api.SearchHostsRequest{
@@ -490,9 +801,38 @@ func (c *Client) SearchObjects(ctx context.Context, offset, limit int, key strin
 	return
 }
 
+// SearchObjectsByHealth returns all objects that contain a sub-string in their
+// key and whose health lies within the given range. The health of an object
+// is the health of its least healthy slab.
+func (c *Client) SearchObjectsByHealth(ctx context.Context, offset, limit int, key string, minHealth, maxHealth float64) (entries []string, err error) {
+	values := url.Values{}
+	values.Set("offset", fmt.Sprint(offset))
+	values.Set("limit", fmt.Sprint(limit))
+	values.Set("key", key)
+	values.Set("minHealth", api.ParamFloat64(minHealth).String())
+	values.Set("maxHealth", api.ParamFloat64(maxHealth).String())
+	err = c.c.WithContext(ctx).GET("/search/objects?"+values.Encode(), &entries)
+	return
+}
+
+// ObjectEntriesByHealth returns the entries at the given path, which must end
+// in /, whose health lies within the given range. The health of a directory
+// is the health of the least healthy slab beneath it.
+func (c *Client) ObjectEntriesByHealth(ctx context.Context, path string, minHealth, maxHealth float64, offset, limit int) (entries []api.ObjectMetadata, err error) {
+	values := url.Values{}
+	values.Set("offset", fmt.Sprint(offset))
+	values.Set("limit", fmt.Sprint(limit))
+	values.Set("minHealth", api.ParamFloat64(minHealth).String())
+	values.Set("maxHealth", api.ParamFloat64(maxHealth).String())
+	var or api.ObjectsResponse
+	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/objects/%s?%s", path, values.Encode()), &or)
+	entries = or.Entries
+	return
+}
+
 // Object returns the object at the given path, or, if path ends in '/', the
 // entries under that path.
-func (c *Client) Object(ctx context.Context, path string) (o object.Object, entries []string, err error) {
+func (c *Client) Object(ctx context.Context, path string) (o object.Object, entries []api.ObjectMetadata, err error) {
 	var or api.ObjectsResponse
 	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/objects/%s", path), &or)
 	if or.Object != nil {
@@ -503,13 +843,53 @@ func (c *Client) Object(ctx context.Context, path string) (o object.Object, entr
 	return
 }
 
-// AddObject stores the provided object under the given name.
-func (c *Client) AddObject(ctx context.Context, name string, o object.Object, usedContract map[types.PublicKey]types.FileContractID) (err error) {
-	err = c.c.WithContext(ctx).PUT(fmt.Sprintf("/objects/%s", name), api.AddObjectRequest{
+// AddObject stores the provided object under the given name. If rs is not
+// nil, the object's redundancy overrides the redundancy settings of the bus.
+func (c *Client) AddObject(ctx context.Context, name string, o object.Object, usedContract map[types.PublicKey]types.FileContractID, rs *api.RedundancySettings) (err error) {
+	return c.addObject(ctx, name, o, usedContract, rs, false, "")
+}
+
+// AddObjectIfMatch is like AddObject, but the object is only replaced if the
+// ETag of the stored object matches ifMatch, the value of an If-Match header.
+// Otherwise an error wrapping api.ErrPreconditionFailed is returned.
+func (c *Client) AddObjectIfMatch(ctx context.Context, name, ifMatch string, o object.Object, usedContract map[types.PublicKey]types.FileContractID, rs *api.RedundancySettings) (err error) {
+	return c.addObject(ctx, name, o, usedContract, rs, false, ifMatch)
+}
+
+// AddObjectPartial is like AddObject, but rather than rejecting the object if
+// some of its shards can't be linked to a known contract, these shards are
+// stored without a contract, which reduces the object's health.
+func (c *Client) AddObjectPartial(ctx context.Context, name string, o object.Object, usedContract map[types.PublicKey]types.FileContractID, rs *api.RedundancySettings) (err error) {
+	return c.addObject(ctx, name, o, usedContract, rs, true, "")
+}
+
+func (c *Client) addObject(ctx context.Context, name string, o object.Object, usedContract map[types.PublicKey]types.FileContractID, rs *api.RedundancySettings, partial bool, ifMatch string) error {
+	values := url.Values{}
+	values.Set("partial", fmt.Sprint(partial))
+	if ifMatch != "" {
+		values.Set("ifMatch", ifMatch)
+	}
+	err := c.c.WithContext(ctx).PUT(fmt.Sprintf("/objects/%s?%s", name, values.Encode()), api.AddObjectRequest{
 		Object:        o,
 		UsedContracts: usedContract,
+		Redundancy:    rs,
 	})
-	return
+
+	// the rejected shards are encoded in the response
+	var uce api.UsedContractsError
+	if err != nil && json.Unmarshal([]byte(err.Error()), &uce) == nil && len(uce.Rejected) > 0 {
+		return &uce
+	}
+	return preconditionError(err)
+}
+
+// preconditionError wraps api.ErrPreconditionFailed around errors returned by
+// conditional requests that failed their precondition.
+func preconditionError(err error) error {
+	if err != nil && strings.Contains(err.Error(), api.ErrPreconditionFailed.Error()) {
+		return fmt.Errorf("%w: %v", api.ErrPreconditionFailed, err)
+	}
+	return err
 }
 
 // DeleteObject deletes the object with the given name.
@@ -518,6 +898,377 @@ func (c *Client) DeleteObject(ctx context.Context, name string) (err error) {
 	return
 }
 
+// DeleteObjectIfMatch deletes the object with the given name if its ETag
+// matches ifMatch, the value of an If-Match header. Otherwise an error
+// wrapping api.ErrPreconditionFailed is returned.
+func (c *Client) DeleteObjectIfMatch(ctx context.Context, name, ifMatch string) error {
+	values := url.Values{}
+	values.Set("ifMatch", ifMatch)
+	return preconditionError(c.c.WithContext(ctx).DELETE(fmt.Sprintf("/objects/%s?%s", name, values.Encode())))
+}
+
+// RenameObjects atomically moves all objects beneath the directory 'from' to
+// the directory 'to', both must start and end in a slash. It fails if an
+// object already exists beneath 'to'. It returns the number of renamed
+// objects.
+func (c *Client) RenameObjects(ctx context.Context, from, to string) (renamed int, err error) {
+	err = c.c.WithContext(ctx).POST("/objects/rename", api.ObjectsRenameRequest{From: from, To: to}, &renamed)
+	return
+}
+
+// SlabHealth returns the health of up to 'limit' slabs with regard to the given
+// contract set, least healthy first.
+func (c *Client) SlabHealth(ctx context.Context, set string, limit int) (health []api.SlabHealth, err error) {
+	values := url.Values{}
+	values.Set("set", set)
+	values.Set("limit", fmt.Sprint(limit))
+	err = c.c.WithContext(ctx).GET("/slabs/health?"+values.Encode(), &health)
+	return
+}
+
+// SlabHealthSummary summarizes the periodically computed health of all slabs,
+// slabs with a health at or below the cutoff are counted as unhealthy.
+func (c *Client) SlabHealthSummary(ctx context.Context, healthCutoff float64) (summary api.SlabHealthSummary, err error) {
+	values := url.Values{}
+	values.Set("cutoff", fmt.Sprint(healthCutoff))
+	err = c.c.WithContext(ctx).GET("/slabs/health/summary?"+values.Encode(), &summary)
+	return
+}
+
+// EnqueueSlabsForRepair adds all slabs with a health at or below the cutoff to
+// the repair queue and returns the number of enqueued slabs.
+func (c *Client) EnqueueSlabsForRepair(ctx context.Context, set string, healthCutoff float64) (n int, err error) {
+	err = c.c.WithContext(ctx).POST("/slabs/repair/enqueue", api.RepairEnqueueRequest{ContractSet: set, HealthCutoff: healthCutoff}, &n)
+	return
+}
+
+// RepairQueue returns up to 'limit' slabs that are due for repair, highest
+// priority first.
+func (c *Client) RepairQueue(ctx context.Context, limit int) (entries []api.RepairQueueEntry, err error) {
+	values := url.Values{}
+	values.Set("limit", fmt.Sprint(limit))
+	err = c.c.WithContext(ctx).GET("/slabs/repair?"+values.Encode(), &entries)
+	return
+}
+
+// SlabMigrations returns the migration state of the slabs, most recently
+// updated first. Only the slabs with the given status are returned if status
+// is not empty.
+func (c *Client) SlabMigrations(ctx context.Context, status string, offset, limit int) (migrations []api.SlabMigration, err error) {
+	values := url.Values{}
+	values.Set("status", status)
+	values.Set("offset", fmt.Sprint(offset))
+	values.Set("limit", fmt.Sprint(limit))
+	err = c.c.WithContext(ctx).GET("/slabs/migrations?"+values.Encode(), &migrations)
+	return
+}
+
+// UpdateSlabMigrations records the migration state of the given slabs.
+func (c *Client) UpdateSlabMigrations(ctx context.Context, updates []api.SlabMigrationUpdate) (err error) {
+	err = c.c.WithContext(ctx).POST("/slabs/migrations", updates, nil)
+	return
+}
+
+// RetrySlabMigration makes the slab with the given id due for repair right
+// away, it's migrated the next time the migrator runs.
+func (c *Client) RetrySlabMigration(ctx context.Context, id api.SlabID) (err error) {
+	err = c.c.WithContext(ctx).POST(fmt.Sprintf("/slabs/migrations/%v/retry", id), nil, nil)
+	return
+}
+
+// RegisterWorker registers a worker with the bus or renews its registration,
+// the bus routes object requests to the workers that are registered.
+func (c *Client) RegisterWorker(ctx context.Context, req api.WorkerRegisterRequest) (err error) {
+	err = c.c.WithContext(ctx).POST("/workers/register", req, nil)
+	return
+}
+
+// Workers returns the workers that registered with the bus.
+func (c *Client) Workers(ctx context.Context) (workers []api.WorkerInfo, err error) {
+	err = c.c.WithContext(ctx).GET("/workers", &workers)
+	return
+}
+
+// RemoveWorker removes the registration of the worker with the given id.
+func (c *Client) RemoveWorker(ctx context.Context, id string) (err error) {
+	err = c.c.WithContext(ctx).DELETE(fmt.Sprintf("/workers/%s", id))
+	return
+}
+
+// UploadObject uploads the data in r to one of the registered workers, which
+// stores it as the object at the given path. The bus redirects the upload to
+// the worker, which is authenticated with the given password.
+func (c *Client) UploadObject(ctx context.Context, r io.Reader, path, workerPassword string) (err error) {
+	c.c.Custom("PUT", fmt.Sprintf("/route/objects/%s", path), []byte{}, nil)
+	location, err := c.routeObjectRequest(ctx, "PUT", path)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "PUT", location, r)
+	if err != nil {
+		panic(err)
+	}
+	req.SetBasicAuth("", workerPassword)
+	return doWorkerRequest(req, nil)
+}
+
+// DownloadObject downloads the object at the given path from one of the
+// registered workers, writing its data to w. The bus redirects the download to
+// a URL presigned by the worker, so no worker credentials are needed.
+func (c *Client) DownloadObject(ctx context.Context, w io.Writer, path string) (err error) {
+	c.c.Custom("GET", fmt.Sprintf("/route/objects/%s", path), nil, (*[]byte)(nil))
+	location, err := c.routeObjectRequest(ctx, "GET", path)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", location, nil)
+	if err != nil {
+		panic(err)
+	}
+	return doWorkerRequest(req, w)
+}
+
+// routeObjectRequest asks the bus which worker to send the object request to,
+// returning the URL it redirects to. The request is sent without its body so
+// the data isn't sent to the bus.
+func (c *Client) routeObjectRequest(ctx context.Context, method, path string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%v/route/objects/%v", c.c.BaseURL, path), nil)
+	if err != nil {
+		panic(err)
+	}
+	req.SetBasicAuth("", c.c.WithContext(ctx).Password)
+	hc := http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer io.Copy(io.Discard, resp.Body)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusTemporaryRedirect {
+		err, _ := io.ReadAll(resp.Body)
+		return "", errors.New(strings.TrimSpace(string(err)))
+	}
+	return resp.Header.Get("Location"), nil
+}
+
+func doWorkerRequest(req *http.Request, w io.Writer) error {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer io.Copy(io.Discard, resp.Body)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err, _ := io.ReadAll(resp.Body)
+		return errors.New(strings.TrimSpace(string(err)))
+	}
+	if w != nil {
+		_, err = io.Copy(w, resp.Body)
+	}
+	return err
+}
+
+// AddJob creates a pending job of the given type, params are marshalled to
+// JSON unless they are nil.
+func (c *Client) AddJob(ctx context.Context, typ string, params interface{}) (job api.Job, err error) {
+	req := api.JobCreateRequest{Type: typ}
+	if params != nil {
+		if req.Params, err = json.Marshal(params); err != nil {
+			return api.Job{}, err
+		}
+	}
+	err = c.c.WithContext(ctx).POST("/jobs", req, &job)
+	return
+}
+
+// Job returns the job with the given id.
+func (c *Client) Job(ctx context.Context, id uint) (job api.Job, err error) {
+	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/job/%d", id), &job)
+	return
+}
+
+// Jobs returns the jobs, most recently created first. Only the jobs with the
+// given type and state are returned if they're not empty.
+func (c *Client) Jobs(ctx context.Context, typ, state string, offset, limit int) (jobs []api.Job, err error) {
+	values := url.Values{}
+	values.Set("type", typ)
+	values.Set("state", state)
+	values.Set("offset", fmt.Sprint(offset))
+	values.Set("limit", fmt.Sprint(limit))
+	err = c.c.WithContext(ctx).GET("/jobs?"+values.Encode(), &jobs)
+	return
+}
+
+// AcquireJob marks the oldest pending job of one of the given types as running
+// and returns it, api.ErrNoJobAvailable is returned if there is none.
+func (c *Client) AcquireJob(ctx context.Context, types ...string) (job api.Job, err error) {
+	err = c.c.WithContext(ctx).POST("/jobs/acquire", api.JobAcquireRequest{Types: types}, &job)
+	if err != nil && strings.Contains(err.Error(), api.ErrNoJobAvailable.Error()) {
+		err = api.ErrNoJobAvailable
+	}
+	return
+}
+
+// UpdateJob records the progress of a running job. An error is returned if
+// the job was cancelled in the meantime.
+func (c *Client) UpdateJob(ctx context.Context, id uint, u api.JobUpdate) (err error) {
+	err = c.c.WithContext(ctx).PUT(fmt.Sprintf("/job/%d", id), u)
+	if err != nil && strings.Contains(err.Error(), api.ErrJobNotRunning.Error()) {
+		err = api.ErrJobNotRunning
+	}
+	return
+}
+
+// CancelJob cancels a pending or running job.
+func (c *Client) CancelJob(ctx context.Context, id uint) (err error) {
+	err = c.c.WithContext(ctx).POST(fmt.Sprintf("/job/%d/cancel", id), nil, nil)
+	return
+}
+
+// RetryJob makes a failed or cancelled job pending again.
+func (c *Client) RetryJob(ctx context.Context, id uint) (err error) {
+	err = c.c.WithContext(ctx).POST(fmt.Sprintf("/job/%d/retry", id), nil, nil)
+	return
+}
+
+// RecordRepairResults records the results of repairing slabs from the repair
+// queue.
+func (c *Client) RecordRepairResults(ctx context.Context, results []api.RepairResult) (err error) {
+	err = c.c.WithContext(ctx).POST("/slabs/repair/results", results, nil)
+	return
+}
+
+// PackedSlabsForUpload returns up to limit slabs packed from the buffered
+// tails of objects with the given redundancy, the tails are locked for the
+// given duration.
+func (c *Client) PackedSlabsForUpload(ctx context.Context, lockingDuration time.Duration, minShards, totalShards uint8, limit int) (slabs []api.PackedSlab, err error) {
+	err = c.c.WithContext(ctx).POST("/slabs/packed", api.PackedSlabsRequest{
+		LockingDuration: api.ParamDuration(lockingDuration),
+		MinShards:       minShards,
+		TotalShards:     totalShards,
+		Limit:           limit,
+	}, &slabs)
+	return
+}
+
+// MarkPackedSlabsUploaded adds the uploaded packed slabs to the objects their
+// tails belong to.
+func (c *Client) MarkPackedSlabsUploaded(ctx context.Context, slabs []api.UploadedPackedSlab) (err error) {
+	err = c.c.WithContext(ctx).POST("/slabs/packed/done", slabs, nil)
+	return
+}
+
+// ObjectsForReshard returns the keys of up to limit objects that aren't
+// erasure coded with the current redundancy settings.
+func (c *Client) ObjectsForReshard(ctx context.Context, limit int) (keys []string, err error) {
+	values := url.Values{}
+	values.Set("limit", fmt.Sprint(limit))
+	err = c.c.WithContext(ctx).GET("/reshard/objects?"+values.Encode(), &keys)
+	return
+}
+
+// ReshardProgress returns how many objects still need to be converted to the
+// current redundancy settings.
+func (c *Client) ReshardProgress(ctx context.Context) (progress api.ReshardProgress, err error) {
+	err = c.c.WithContext(ctx).GET("/reshard/progress", &progress)
+	return
+}
+
+// SectorsForAudit returns up to limit randomly sampled sectors to audit.
+func (c *Client) SectorsForAudit(ctx context.Context, limit int) (audits []api.SectorAudit, err error) {
+	values := url.Values{}
+	values.Set("limit", fmt.Sprint(limit))
+	err = c.c.WithContext(ctx).GET("/sectors/audits?"+values.Encode(), &audits)
+	return
+}
+
+// RecordSectorAudits records the results of sector audits, lost sectors are
+// removed from their contracts and the affected slabs are queued for repair.
+// It returns the number of lost sectors.
+func (c *Client) RecordSectorAudits(ctx context.Context, set string, results []api.SectorAuditResult) (lost int, err error) {
+	err = c.c.WithContext(ctx).POST("/sectors/audits", api.RecordSectorAuditsRequest{
+		ContractSet: set,
+		Results:     results,
+	}, &lost)
+	return
+}
+
+// HostAuditStats returns the accumulated sector audit results of the audited
+// hosts.
+func (c *Client) HostAuditStats(ctx context.Context) (stats []api.HostAuditStats, err error) {
+	err = c.c.WithContext(ctx).GET("/audits/hosts", &stats)
+	return
+}
+
+// ObjectsForAudit returns the paths of up to limit randomly sampled objects
+// to audit, only objects of up to maxSize bytes are sampled if it's not zero.
+func (c *Client) ObjectsForAudit(ctx context.Context, limit int, maxSize uint64) (paths []string, err error) {
+	values := url.Values{}
+	values.Set("limit", fmt.Sprint(limit))
+	values.Set("maxSize", fmt.Sprint(maxSize))
+	err = c.c.WithContext(ctx).GET("/audits/objects?"+values.Encode(), &paths)
+	return
+}
+
+// RecordObjectAudits records the results of object audits, an alert is raised
+// for every corrupt object.
+func (c *Client) RecordObjectAudits(ctx context.Context, results []api.ObjectAuditResult) (err error) {
+	err = c.c.WithContext(ctx).POST("/audits/objects", results, nil)
+	return
+}
+
+// CheckConsistency checks the referential integrity of the bus' database.
+func (c *Client) CheckConsistency(ctx context.Context) (report api.ConsistencyReport, err error) {
+	err = c.c.WithContext(ctx).GET("/consistency", &report)
+	return
+}
+
+// RepairConsistency checks the referential integrity of the bus' database and
+// repairs the inconsistencies that can be repaired without losing data.
+func (c *Client) RepairConsistency(ctx context.Context) (report api.ConsistencyReport, err error) {
+	err = c.c.WithContext(ctx).POST("/consistency/repair", nil, &report)
+	return
+}
+
+// CollectGarbage prunes slabs and sectors that are no longer referenced and
+// schedules the pruned sectors for deletion from their hosts.
+func (c *Client) CollectGarbage(ctx context.Context) (res api.GCResult, err error) {
+	err = c.c.WithContext(ctx).POST("/gc", nil, &res)
+	return
+}
+
+// SectorDeletions returns up to limit sectors that are scheduled for deletion
+// from their hosts, grouped by contract.
+func (c *Client) SectorDeletions(ctx context.Context, limit int) (deletions []api.SectorDeletions, err error) {
+	values := url.Values{}
+	values.Set("limit", fmt.Sprint(limit))
+	err = c.c.WithContext(ctx).GET("/gc/sectors?"+values.Encode(), &deletions)
+	return
+}
+
+// ContractSectorDeletions returns the roots of the sectors that are scheduled
+// for deletion from the given contract.
+func (c *Client) ContractSectorDeletions(ctx context.Context, id types.FileContractID) (roots []types.Hash256, err error) {
+	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/gc/sectors/%s", id), &roots)
+	return
+}
+
+// RemoveSectorDeletions removes sectors that were deleted from their hosts
+// from the deletion schedule.
+func (c *Client) RemoveSectorDeletions(ctx context.Context, deletions []api.SectorDeletions) (err error) {
+	err = c.c.WithContext(ctx).POST("/gc/sectors/deleted", deletions, nil)
+	return
+}
+
+// UpdateObjectImportance sets the importance of the object with the given
+// key, slabs of more important objects are repaired first.
+func (c *Client) UpdateObjectImportance(ctx context.Context, key string, importance uint8) (err error) {
+	err = c.c.WithContext(ctx).PUT(fmt.Sprintf("/importance/%s", key), importance)
+	return
+}
+
 // SlabsForMigration returns up to 'limit' slabs which require migration. A slab
 // needs to be migrated if it has sectors on contracts that are not part of the
 // given 'set'.
@@ -586,6 +1337,243 @@ func (c *Client) ResetDrift(ctx context.Context, id rhpv3.Account) (err error) {
 	return
 }
 
+// AuditEntries returns the recorded audit entries since the given time,
+// optionally filtered by a path prefix.
+func (c *Client) AuditEntries(ctx context.Context, since time.Time, prefix string, offset, limit int) (entries []api.AuditEntry, err error) {
+	values := url.Values{}
+	values.Set("since", since.Format(time.RFC3339))
+	values.Set("prefix", prefix)
+	values.Set("offset", fmt.Sprint(offset))
+	values.Set("limit", fmt.Sprint(limit))
+	err = c.c.WithContext(ctx).GET("/audit?"+values.Encode(), &entries)
+	return
+}
+
+// RecordAuditEntries records the given audit entries.
+func (c *Client) RecordAuditEntries(ctx context.Context, entries []api.AuditEntry) (err error) {
+	err = c.c.WithContext(ctx).POST("/audit", entries, nil)
+	return
+}
+
+// ContractUtilizationReport returns the utilization report of all active
+// contracts.
+func (c *Client) ContractUtilizationReport(ctx context.Context) (report api.UtilizationReport, err error) {
+	err = c.c.WithContext(ctx).GET("/reports/contracts", &report)
+	return
+}
+
+// DailyReports returns the daily reports since the given time, most recent
+// first. The report of the current day is included while it's in progress.
+func (c *Client) DailyReports(ctx context.Context, since time.Time, limit int) (reports []api.DailyReport, err error) {
+	values := url.Values{}
+	values.Set("since", since.Format(time.RFC3339))
+	values.Set("limit", fmt.Sprint(limit))
+	err = c.c.WithContext(ctx).GET("/reports/daily?"+values.Encode(), &reports)
+	return
+}
+
+// FeeMetrics returns the fee estimates the bus recorded in the given time
+// range, oldest first.
+func (c *Client) FeeMetrics(ctx context.Context, start, end time.Time) (metrics []api.FeeMetric, err error) {
+	values := url.Values{}
+	values.Set("start", start.Format(time.RFC3339))
+	values.Set("end", end.Format(time.RFC3339))
+	err = c.c.WithContext(ctx).GET("/metrics/fees?"+values.Encode(), &metrics)
+	return
+}
+
+// ReportSettings returns the report settings.
+func (c *Client) ReportSettings(ctx context.Context) (rs api.ReportSettings, err error) {
+	setting, err := c.Setting(ctx, SettingReports)
+	if err != nil {
+		return api.ReportSettings{}, err
+	}
+	err = json.Unmarshal([]byte(setting), &rs)
+	return
+}
+
+// UpdateReportSettings updates the report settings.
+func (c *Client) UpdateReportSettings(ctx context.Context, rs api.ReportSettings) error {
+	b, err := json.Marshal(rs)
+	if err != nil {
+		return err
+	}
+	return c.UpdateSetting(ctx, SettingReports, string(b))
+}
+
+// Events subscribes to the bus events of the given types, or all events if no
+// types are given. The returned channel is closed when the stream ends, e.g.
+// because ctx was cancelled.
+func (c *Client) Events(ctx context.Context, types ...string) (<-chan api.Event, error) {
+	c.c.Custom("GET", "/events", nil, (*api.Event)(nil))
+
+	values := url.Values{}
+	values.Set("types", strings.Join(types, ","))
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%v/events?%v", c.c.BaseURL, values.Encode()), nil)
+	if err != nil {
+		panic(err)
+	}
+	req.SetBasicAuth("", c.c.Password)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	} else if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		err, _ := io.ReadAll(resp.Body)
+		return nil, errors.New(string(err))
+	}
+
+	events := make(chan api.Event)
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+		s := bufio.NewScanner(resp.Body)
+		for s.Scan() {
+			data := strings.TrimPrefix(s.Text(), "data: ")
+			if data == s.Text() {
+				continue // only the data lines contain the event
+			}
+			var event api.Event
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				return
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+// ScheduledEvents returns the events that are scheduled for specific block
+// heights, lowest height first.
+func (c *Client) ScheduledEvents(ctx context.Context) (events []api.ScheduledEvent, err error) {
+	err = c.c.WithContext(ctx).GET("/schedule", &events)
+	return
+}
+
+// ScheduleEvents schedules the events, they are broadcast once the chain
+// reaches their height. Events replace the events scheduled under the same key.
+func (c *Client) ScheduleEvents(ctx context.Context, events []api.ScheduledEvent) error {
+	return c.c.WithContext(ctx).POST("/schedule", events, nil)
+}
+
+// CancelScheduledEvent cancels the event scheduled under the given key.
+func (c *Client) CancelScheduledEvent(ctx context.Context, key string) error {
+	return c.c.WithContext(ctx).DELETE(fmt.Sprintf("/schedule/%s", url.PathEscape(key)))
+}
+
+// Alerts returns the active alerts.
+func (c *Client) Alerts(ctx context.Context) (alerts []api.Alert, err error) {
+	err = c.c.WithContext(ctx).GET("/alerts", &alerts)
+	return
+}
+
+// RaiseAlert raises the alert with given id, if it's already active only its
+// severity and message are updated.
+func (c *Client) RaiseAlert(ctx context.Context, id, severity, msg string) error {
+	return c.c.WithContext(ctx).POST("/alerts", api.Alert{ID: id, Severity: severity, Message: msg}, nil)
+}
+
+// ResolveAlert resolves the alert with given id.
+func (c *Client) ResolveAlert(ctx context.Context, id string) error {
+	return c.c.WithContext(ctx).DELETE(fmt.Sprintf("/alerts/%s", url.PathEscape(id)))
+}
+
+// AlertSettings returns the alert thresholds.
+func (c *Client) AlertSettings(ctx context.Context) (as api.AlertSettings, err error) {
+	err = c.c.WithContext(ctx).GET("/alerts/settings", &as)
+	return
+}
+
+// UpdateAlertSettings updates the alert thresholds, they're evaluated
+// immediately.
+func (c *Client) UpdateAlertSettings(ctx context.Context, as api.AlertSettings) error {
+	return c.c.WithContext(ctx).PUT("/alerts/settings", as)
+}
+
+// TrashSettings returns the trash settings.
+func (c *Client) TrashSettings(ctx context.Context) (ts api.TrashSettings, err error) {
+	err = c.c.WithContext(ctx).GET("/trash/settings", &ts)
+	return
+}
+
+// UpdateTrashSettings updates the trash settings, objects that are already in
+// the trash keep their expiry.
+func (c *Client) UpdateTrashSettings(ctx context.Context, ts api.TrashSettings) error {
+	return c.c.WithContext(ctx).PUT("/trash/settings", ts)
+}
+
+// TrashedObjects returns the objects in the trash, oldest first.
+func (c *Client) TrashedObjects(ctx context.Context, offset, limit int) (objects []api.TrashedObject, err error) {
+	values := url.Values{}
+	values.Set("offset", fmt.Sprint(offset))
+	values.Set("limit", fmt.Sprint(limit))
+	err = c.c.WithContext(ctx).GET("/trash?"+values.Encode(), &objects)
+	return
+}
+
+// RestoreTrashedObject moves the trashed object with the given id back to the
+// key it had before it was deleted.
+func (c *Client) RestoreTrashedObject(ctx context.Context, id uint) error {
+	return c.c.WithContext(ctx).POST(fmt.Sprintf("/trash/%d/restore", id), nil, nil)
+}
+
+// PurgeTrashedObject permanently deletes the trashed object with the given id.
+func (c *Client) PurgeTrashedObject(ctx context.Context, id uint) error {
+	return c.c.WithContext(ctx).DELETE(fmt.Sprintf("/trash/%d", id))
+}
+
+// PurgeTrash permanently deletes the objects in the trash, or only the ones
+// whose retention period passed if expiredOnly is set.
+func (c *Client) PurgeTrash(ctx context.Context, expiredOnly bool) error {
+	values := url.Values{}
+	values.Set("expired", fmt.Sprint(expiredOnly))
+	return c.c.WithContext(ctx).DELETE("/trash?" + values.Encode())
+}
+
+// Spending returns the spending within the current spending period.
+func (c *Client) Spending(ctx context.Context) (ps api.PeriodSpending, err error) {
+	err = c.c.WithContext(ctx).GET("/spending", &ps)
+	return
+}
+
+// AuthorizeSpending returns an error if spending the given amount in the
+// given category would exceed a spending cap.
+func (c *Client) AuthorizeSpending(ctx context.Context, category string, amount types.Currency) error {
+	return c.c.WithContext(ctx).POST("/spending/authorize", api.SpendingAuthorizeRequest{
+		Category: category,
+		Amount:   amount,
+	}, nil)
+}
+
+// SpendingCaps returns the spending caps.
+func (c *Client) SpendingCaps(ctx context.Context) (sc api.SpendingCaps, err error) {
+	err = c.c.WithContext(ctx).GET("/spending/caps", &sc)
+	return
+}
+
+// UpdateSpendingCaps updates the spending caps.
+func (c *Client) UpdateSpendingCaps(ctx context.Context, sc api.SpendingCaps) error {
+	return c.c.WithContext(ctx).PUT("/spending/caps", sc)
+}
+
+// Health runs the bus' health checks, an error is returned if any of them
+// fails.
+func (c *Client) Health(ctx context.Context) (resp api.HealthResponse, err error) {
+	err = c.c.WithContext(ctx).GET("/health", &resp)
+	return
+}
+
+// QueryStats returns statistics about the database queries executed by the
+// bus, grouped by query family.
+func (c *Client) QueryStats(ctx context.Context) (stats []api.QueryStats, err error) {
+	err = c.c.WithContext(ctx).GET("/debug/querystats", &stats)
+	return
+}
+
 // NewClient returns a client that communicates with a renterd store server
 // listening on the specified address.
 func NewClient(addr, password string) *Client {
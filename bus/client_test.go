@@ -1,9 +1,14 @@
 package bus_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -14,6 +19,8 @@ import (
 	"go.sia.tech/renterd/api"
 	"go.sia.tech/renterd/bus"
 	"go.sia.tech/renterd/internal/node"
+	"go.sia.tech/renterd/internal/tracing"
+	"go.sia.tech/renterd/wallet"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -56,9 +63,457 @@ func TestClient(t *testing.T) {
 	} else if rs.MinShards != api.DefaultRedundancySettings.MinShards || rs.TotalShards != api.DefaultRedundancySettings.TotalShards {
 		t.Fatal("unexpected redundancy settings", rs)
 	}
+
+	// assert invalid redundancy settings are rejected, even if forced
+	invalid := api.RedundancySettings{MinShards: 2, TotalShards: 1}
+	if err := c.UpdateRedundancySettings(ctx, invalid); err == nil || !strings.Contains(err.Error(), "TotalShards must be at least MinShards") {
+		t.Fatal("unexpected err", err)
+	} else if err := c.ForceUpdateRedundancySettings(ctx, invalid); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// assert redundancy settings can be updated without a contract set
+	if err := c.UpdateRedundancySettings(ctx, api.RedundancySettings{MinShards: 1, TotalShards: 3}); err != nil {
+		t.Fatal(err)
+	} else if err := c.UpdateRedundancySettings(ctx, api.DefaultRedundancySettings); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the bus is unhealthy since there's no contract set, the error
+	// contains the encoded health response
+	var hr api.HealthResponse
+	if _, err := c.Health(ctx); err == nil {
+		t.Fatal("expected error")
+	} else if err := json.Unmarshal([]byte(err.Error()), &hr); err != nil {
+		t.Fatal(err)
+	} else if hr.OK || len(hr.Checks) != 5 {
+		t.Fatal("unexpected health response", hr)
+	}
+	for _, check := range hr.Checks {
+		if check.Name == "contracts" && check.Error != "no contract set configured" {
+			t.Fatal("unexpected error", check.Error)
+		} else if (check.Name == "database" || check.Name == "wallet") && !check.OK {
+			t.Fatal("unexpected check failure", check)
+		}
+	}
+
+	// assert the seed can be exported without an encrypted seed
+	if backup, err := c.WalletSeedExport(ctx, "", "foo"); err != nil {
+		t.Fatal(err)
+	} else if phrase, err := wallet.DecryptSeedPhrase(backup.EncryptedSeed, "foo"); err != nil {
+		t.Fatal(err)
+	} else if key, err := wallet.KeyFromPhrase(phrase); err != nil {
+		t.Fatal(err)
+	} else if addr, err := c.WalletAddress(ctx); err != nil {
+		t.Fatal(err)
+	} else if addr != backup.Address || addr != wallet.StandardAddress(key.PublicKey()) {
+		t.Fatal("exported seed doesn't match the wallet", addr, backup.Address)
+	}
+
+	// assert the wallet can be rescanned
+	if err := c.WalletRescan(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert tracing settings are not found
+	if _, err := c.TracingSettings(ctx); err == nil || !strings.Contains(err.Error(), api.ErrSettingNotFound.Error()) {
+		t.Fatal("unexpected err", err)
+	}
+
+	// assert invalid tracing settings are rejected
+	if err := c.UpdateTracingSettings(ctx, api.TracingSettings{SamplingRate: 2}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// update the tracing settings and assert the sampling rate is applied
+	ts := api.TracingSettings{Endpoint: "http://localhost:4318", SamplingRate: 0.25}
+	if err := c.UpdateTracingSettings(ctx, ts); err != nil {
+		t.Fatal(err)
+	} else if got, err := c.TracingSettings(ctx); err != nil {
+		t.Fatal(err)
+	} else if got != ts {
+		t.Fatal("unexpected tracing settings", got)
+	} else if tracing.SamplingRate() != 0.25 {
+		t.Fatal("unexpected sampling rate", tracing.SamplingRate())
+	}
+
+	// assert the tracing settings are validated and applied when they're
+	// updated through the settings endpoint as well
+	if err := c.UpdateSetting(ctx, bus.SettingTracing, `{"samplingRate":2}`); err == nil || !strings.Contains(err.Error(), "SamplingRate must be between 0 and 1") {
+		t.Fatal("unexpected err", err)
+	} else if err := c.UpdateSetting(ctx, bus.SettingTracing, "foo"); err == nil {
+		t.Fatal("expected error")
+	} else if err := c.UpdateSetting(ctx, bus.SettingTracing, `{"samplingRate":0.5}`); err != nil {
+		t.Fatal(err)
+	} else if tracing.SamplingRate() != 0.5 {
+		t.Fatal("unexpected sampling rate", tracing.SamplingRate())
+	}
+
+	// assert invalid alert settings are rejected
+	if err := c.UpdateAlertSettings(ctx, api.AlertSettings{MinSlabHealth: 2}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// the wallet is empty, assert raising the minimum balance raises an alert
+	if err := c.UpdateAlertSettings(ctx, api.AlertSettings{MinWalletBalance: types.Siacoins(1), MinContracts: 1}); err != nil {
+		t.Fatal(err)
+	} else if alerts, err := c.Alerts(ctx); err != nil {
+		t.Fatal(err)
+	} else if len(alerts) != 1 || alerts[0].ID != "wallet_balance" || alerts[0].Severity != api.AlertSeverityCritical {
+		t.Fatal("unexpected alerts", alerts)
+	}
+
+	// disable the threshold and assert the alert is resolved
+	if err := c.UpdateAlertSettings(ctx, api.AlertSettings{}); err != nil {
+		t.Fatal(err)
+	} else if alerts, err := c.Alerts(ctx); err != nil {
+		t.Fatal(err)
+	} else if len(alerts) != 0 {
+		t.Fatal("unexpected alerts", alerts)
+	}
+
+	// assert no hosts were audited yet and there are no objects to audit
+	if stats, err := c.HostAuditStats(ctx); err != nil {
+		t.Fatal(err)
+	} else if len(stats) != 0 {
+		t.Fatal("unexpected stats", stats)
+	} else if paths, err := c.ObjectsForAudit(ctx, 1, 1<<20); err != nil {
+		t.Fatal(err)
+	} else if len(paths) != 0 {
+		t.Fatal("unexpected paths", paths)
+	}
+
+	// assert recording a corrupt object raises an alert, failed audits of
+	// objects that aren't corrupt don't
+	if err := c.RecordObjectAudits(ctx, []api.ObjectAuditResult{
+		{Path: "foo", Corrupt: true, Error: "ETag mismatch"},
+		{Path: "bar", Error: "download failed"},
+		{Path: "baz"},
+	}); err != nil {
+		t.Fatal(err)
+	} else if alerts, err := c.Alerts(ctx); err != nil {
+		t.Fatal(err)
+	} else if len(alerts) != 1 || alerts[0].ID != "object_corrupt_foo" || alerts[0].Severity != api.AlertSeverityCritical {
+		t.Fatal("unexpected alerts", alerts)
+	}
+
+	// assert the fresh database is consistent
+	if report, err := c.CheckConsistency(ctx); err != nil {
+		t.Fatal(err)
+	} else if !report.Consistent() || len(report.Checks) == 0 {
+		t.Fatal("unexpected report", report)
+	} else if report, err := c.RepairConsistency(ctx); err != nil {
+		t.Fatal(err)
+	} else if !report.Consistent() {
+		t.Fatal("unexpected report", report)
+	}
+}
+
+// TestEvents verifies the bus streams events to its subscribers.
+// TestWatchOnlyHealth verifies the wallet check of the health endpoint doesn't
+// fail for a watch-only wallet.
+func TestWatchOnlyHealth(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	pk := types.GeneratePrivateKey().PublicKey()
+	var secret [32]byte
+	c, serveFn, shutdownFn, err := newTestClientWithConfig(t.TempDir(), node.BusConfig{
+		DBSecret:        &secret,
+		WalletWatchOnly: true,
+		WalletPublicKey: &pk,
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := shutdownFn(ctx); err != nil {
+			t.Error(err)
+		}
+	}()
+	go serveFn()
+
+	if locked, err := c.WalletLocked(ctx); err != nil {
+		t.Fatal(err)
+	} else if locked {
+		t.Fatal("watch-only wallet shouldn't be locked")
+	}
+
+	// the bus is unhealthy since there's no contract set, but the wallet
+	// check passes
+	var hr api.HealthResponse
+	if _, err := c.Health(ctx); err == nil {
+		t.Fatal("expected error")
+	} else if err := json.Unmarshal([]byte(err.Error()), &hr); err != nil {
+		t.Fatal(err)
+	}
+	var found bool
+	for _, check := range hr.Checks {
+		if check.Name == "wallet" {
+			found = true
+			if !check.OK {
+				t.Fatal("unexpected check failure", check)
+			}
+		}
+	}
+	if !found {
+		t.Fatal("wallet check missing")
+	}
+}
+
+func TestEvents(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, serveFn, shutdownFn, err := newTestClient(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := shutdownFn(ctx); err != nil {
+			t.Error(err)
+		}
+	}()
+	go serveFn()
+
+	// subscribe to setting changes and raised alerts
+	subCtx, subCancel := context.WithCancel(ctx)
+	defer subCancel()
+	events, err := c.Events(subCtx, api.EventSettingChanged, api.EventAlertRaised)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// update a setting and the blocklist, only the setting change is streamed
+	if err := c.UpdateSetting(ctx, "foo", "bar"); err != nil {
+		t.Fatal(err)
+	} else if err := c.UpdateHostBlocklist(ctx, []string{"foo.com"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-events:
+		var data api.EventSettingChangedData
+		if event.Type != api.EventSettingChanged {
+			t.Fatal("unexpected event type", event.Type)
+		} else if err := json.Unmarshal(event.Data, &data); err != nil {
+			t.Fatal(err)
+		} else if data.Key != "foo" {
+			t.Fatal("unexpected key", data.Key)
+		}
+	case <-ctx.Done():
+		t.Fatal("no event received")
+	}
+
+	// raise an alert
+	alert := api.Alert{ID: "foo", Severity: api.AlertSeverityInfo, Message: "bar"}
+	if err := c.RaiseAlert(ctx, alert.ID, alert.Severity, alert.Message); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case event := <-events:
+		var got api.Alert
+		if event.Type != api.EventAlertRaised {
+			t.Fatal("unexpected event type", event.Type)
+		} else if err := json.Unmarshal(event.Data, &got); err != nil {
+			t.Fatal(err)
+		} else if got.ID != alert.ID || got.Message != alert.Message {
+			t.Fatal("unexpected alert", got)
+		}
+	case <-ctx.Done():
+		t.Fatal("no event received")
+	}
+
+	// assert the stream ends when the subscription is cancelled
+	subCancel()
+	for range events {
+	}
+}
+
+func TestJobs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, serveFn, shutdownFn, err := newTestClient(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := shutdownFn(ctx); err != nil {
+			t.Error(err)
+		}
+	}()
+	go serveFn()
+
+	// unknown job types are rejected
+	if _, err := c.AddJob(ctx, "foo", nil); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// gc jobs are run by the bus
+	gc, err := c.AddJob(ctx, api.JobTypeGC, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		job, err := c.Job(ctx, gc.ID)
+		if err != nil {
+			t.Fatal(err)
+		} else if job.State == api.JobStateDone {
+			var res api.GCResult
+			if err := json.Unmarshal(job.Result, &res); err != nil {
+				t.Fatal(err)
+			}
+			break
+		} else if job.State != api.JobStatePending && job.State != api.JobStateRunning {
+			t.Fatal("unexpected job", job)
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("job didn't finish")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if _, err := c.AcquireJob(ctx, api.JobTypeGC); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// migration jobs are acquired by other components
+	migration, err := c.AddJob(ctx, api.JobTypeMigration, map[string]int{"slab": 1})
+	if err != nil {
+		t.Fatal(err)
+	} else if job, err := c.AcquireJob(ctx, api.JobTypeMigration); err != nil {
+		t.Fatal(err)
+	} else if job.ID != migration.ID || job.State != api.JobStateRunning {
+		t.Fatal("unexpected job", job)
+	} else if _, err := c.AcquireJob(ctx, api.JobTypeMigration); !errors.Is(err, api.ErrNoJobAvailable) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// cancel it and assert the runner can't finish it
+	if err := c.CancelJob(ctx, migration.ID); err != nil {
+		t.Fatal(err)
+	} else if err := c.UpdateJob(ctx, migration.ID, api.JobUpdate{State: api.JobStateDone}); !errors.Is(err, api.ErrJobNotRunning) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// retry it
+	if err := c.RetryJob(ctx, migration.ID); err != nil {
+		t.Fatal(err)
+	} else if jobs, err := c.Jobs(ctx, api.JobTypeMigration, api.JobStatePending, 0, -1); err != nil {
+		t.Fatal(err)
+	} else if len(jobs) != 1 || jobs[0].ID != migration.ID {
+		t.Fatal("unexpected jobs", jobs)
+	}
+}
+
+func TestWorkerRouting(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, serveFn, shutdownFn, err := newTestClient(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := shutdownFn(ctx); err != nil {
+			t.Error(err)
+		}
+	}()
+	go serveFn()
+
+	// without workers requests can't be routed
+	if err := c.DownloadObject(ctx, io.Discard, "foo/bar"); err == nil || !strings.Contains(err.Error(), "no healthy worker available") {
+		t.Fatal("unexpected error", err)
+	}
+
+	// register a download-only worker, downloads are redirected to a
+	// presigned URL
+	w := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method == "GET" && req.URL.Query().Get("signature") == "sig" {
+			w.Write([]byte(req.Method + " " + req.URL.Path))
+			return
+		} else if _, password, _ := req.BasicAuth(); password != "worker" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		} else if req.Method == "POST" && req.URL.Path == "/api/worker/presign" {
+			var pr api.PresignRequest
+			if err := json.NewDecoder(req.Body).Decode(&pr); err != nil || pr.Path != "foo/bar" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(api.PresignResponse{URL: "/objects/" + pr.Path + "?signature=sig"})
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	if err := c.RegisterWorker(ctx, api.WorkerRegisterRequest{
+		ID:           "w1",
+		Address:      w.URL + "/api/worker",
+		Password:     "worker",
+		Capabilities: []string{api.WorkerCapabilityDownload},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := c.DownloadObject(ctx, &buf, "foo/bar"); err != nil {
+		t.Fatal(err)
+	} else if buf.String() != "GET /api/worker/objects/foo/bar" {
+		t.Fatal("unexpected response", buf.String())
+	} else if err := c.UploadObject(ctx, strings.NewReader("data"), "foo/bar", "worker"); err == nil || !strings.Contains(err.Error(), "no healthy worker available") {
+		t.Fatal("unexpected error", err)
+	}
+
+	// register an upload-only worker, uploads are redirected as is
+	var uploaded string
+	uw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if _, password, _ := req.BasicAuth(); password != "worker" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		data, _ := io.ReadAll(req.Body)
+		uploaded = req.Method + " " + req.URL.Path + " " + string(data)
+	}))
+	defer uw.Close()
+	if err := c.RegisterWorker(ctx, api.WorkerRegisterRequest{
+		ID:           "w2",
+		Address:      uw.URL + "/api/worker",
+		Password:     "worker",
+		Capabilities: []string{api.WorkerCapabilityUpload},
+	}); err != nil {
+		t.Fatal(err)
+	} else if err := c.UploadObject(ctx, strings.NewReader("data"), "foo/bar", "wrong"); err == nil {
+		t.Fatal("expected error")
+	} else if err := c.UploadObject(ctx, strings.NewReader("data"), "foo/bar", "worker"); err != nil {
+		t.Fatal(err)
+	} else if uploaded != "PUT /api/worker/objects/foo/bar data" {
+		t.Fatal("unexpected upload", uploaded)
+	} else if err := c.RemoveWorker(ctx, "w2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// workers that can't be reached are marked unhealthy
+	w.Close()
+	if err := c.DownloadObject(ctx, io.Discard, "foo/bar"); err == nil || !strings.Contains(err.Error(), "couldn't route request to worker w1") {
+		t.Fatal("unexpected error", err)
+	} else if workers, err := c.Workers(ctx); err != nil {
+		t.Fatal(err)
+	} else if len(workers) != 1 || workers[0].ID != "w1" || workers[0].Healthy {
+		t.Fatal("unexpected workers", workers)
+	}
+
+	// remove the worker
+	if err := c.RemoveWorker(ctx, "w1"); err != nil {
+		t.Fatal(err)
+	} else if err := c.RemoveWorker(ctx, "w1"); err == nil {
+		t.Fatal("expected error")
+	}
 }
 
 func newTestClient(dir string) (*bus.Client, func() error, func(context.Context) error, error) {
+	return newTestClientWithConfig(dir, node.BusConfig{}, wallet.NewSeedPhrase())
+}
+
+func newTestClientWithConfig(dir string, cfg node.BusConfig, walletPhrase string) (*bus.Client, func() error, func(context.Context) error, error) {
 	// create listener
 	l, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
@@ -68,11 +523,10 @@ func newTestClient(dir string) (*bus.Client, func() error, func(context.Context)
 	// create client
 	client := bus.NewClient("http://"+l.Addr().String(), "test")
 
-	b, cleanup, err := node.NewBus(node.BusConfig{
-		Bootstrap:   false,
-		GatewayAddr: "127.0.0.1:0",
-		Miner:       node.NewMiner(client),
-	}, filepath.Join(dir, "bus"), types.GeneratePrivateKey(), zap.New(zapcore.NewNopCore()))
+	cfg.Bootstrap = false
+	cfg.GatewayAddr = "127.0.0.1:0"
+	cfg.Miner = node.NewMiner(client)
+	b, cleanup, err := node.NewBus(cfg, filepath.Join(dir, "bus"), walletPhrase, zap.New(zapcore.NewNopCore()))
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -1,21 +1,30 @@
 package bus
 
 import (
+	"bytes"
 	"container/heap"
 	"context"
 	"errors"
 	"fmt"
 	"math"
+	"sort"
 	"sync"
 	"time"
 
 	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
 	"lukechampine.com/frand"
 )
 
-// ErrAcquireContractTimeout is returned when the context passed in to
-// contractLocks.Acquire is closed before the lock can be acquired.
-var ErrAcquireContractTimeout = errors.New("acquiring the lock timed out")
+var (
+	// ErrAcquireContractTimeout is returned when the context passed in to
+	// contractLocks.Acquire is closed before the lock can be acquired.
+	ErrAcquireContractTimeout = errors.New("acquiring the lock timed out")
+
+	// ErrContractLockNotHeld is returned when a lock is kept alive that
+	// expired or was released, the holder must stop using the contract.
+	ErrContractLockNotHeld = errors.New("contract lock is not held")
+)
 
 // lockCandidatePriorityHeap is a max-heap of lockCandidates.
 type lockCandidatePriorityHeap []*lockCandidate
@@ -55,6 +64,14 @@ type contractLock struct {
 	heldByID    uint64
 	wakeupTimer *time.Timer
 	queue       *lockCandidatePriorityHeap
+
+	// contention metrics
+	acquisitions uint64
+	contended    uint64
+	timeouts     uint64
+	expirations  uint64
+	waitTime     time.Duration
+	lastAcquired time.Time
 }
 
 type lockCandidate struct {
@@ -86,10 +103,21 @@ func (l *contractLocks) lockForContractID(id types.FileContractID, create bool)
 
 func (lock *contractLock) setTimer(l *contractLocks, lockID uint64, id types.FileContractID, d time.Duration) {
 	lock.wakeupTimer = time.AfterFunc(d, func() {
-		l.Release(id, lockID)
+		l.expire(id, lockID)
 	})
 }
 
+// acquired records that the lock was acquired after waiting for the given
+// duration.
+func (lock *contractLock) acquired(waited time.Duration, contended bool) {
+	lock.acquisitions++
+	lock.lastAcquired = time.Now()
+	if contended {
+		lock.contended++
+		lock.waitTime += waited
+	}
+}
+
 func (l *contractLock) stopTimer() {
 	if l.wakeupTimer == nil {
 		return
@@ -122,9 +150,11 @@ func (l *contractLocks) Acquire(ctx context.Context, priority int, id types.File
 	if lock.heldByID == 0 {
 		lock.heldByID = ourLockID
 		lock.setTimer(l, ourLockID, id, d)
+		lock.acquired(0, false)
 		lock.mu.Unlock()
 		return ourLockID, nil
 	}
+	start := time.Now()
 
 	// Someone is holding the lock. Add ourselves to the queue.
 	wakeChan := make(chan struct{})
@@ -144,6 +174,7 @@ func (l *contractLocks) Acquire(ctx context.Context, priority int, id types.File
 		select {
 		case <-wakeChan:
 		default:
+			lock.timeouts++
 			lock.mu.Unlock()
 			return 0, ErrAcquireContractTimeout
 		}
@@ -156,10 +187,78 @@ func (l *contractLocks) Acquire(ctx context.Context, priority int, id types.File
 	}
 	lock.heldByID = ourLockID
 	lock.setTimer(l, ourLockID, id, d)
+	lock.acquired(time.Since(start), true)
 	lock.mu.Unlock()
 	return ourLockID, nil
 }
 
+// Keepalive extends the lease of the lock with the given id by the provided
+// duration. ErrContractLockNotHeld is returned if the lock expired or was
+// released in the meantime.
+func (l *contractLocks) Keepalive(id types.FileContractID, lockID uint64, d time.Duration) error {
+	lock := l.lockForContractID(id, false)
+	if lock == nil {
+		return ErrContractLockNotHeld
+	}
+
+	lock.mu.Lock()
+	defer lock.mu.Unlock()
+	if lockID == 0 || lock.heldByID != lockID {
+		return ErrContractLockNotHeld
+	}
+	lock.stopTimer()
+	lock.setTimer(l, lockID, id, d)
+	return nil
+}
+
+// expire releases a lock whose lease wasn't extended in time, its holder is
+// assumed to be dead.
+func (l *contractLocks) expire(id types.FileContractID, lockID uint64) {
+	lock := l.lockForContractID(id, false)
+	if lock == nil {
+		return
+	}
+	lock.mu.Lock()
+	if lock.heldByID == lockID {
+		lock.expirations++
+	}
+	lock.mu.Unlock()
+	l.Release(id, lockID)
+}
+
+// Stats returns the contention metrics of all locks, sorted by contract id.
+func (l *contractLocks) Stats() []api.ContractLockStats {
+	l.mu.Lock()
+	ids := make([]types.FileContractID, 0, len(l.locks))
+	locks := make([]*contractLock, 0, len(l.locks))
+	for id, lock := range l.locks {
+		ids = append(ids, id)
+		locks = append(locks, lock)
+	}
+	l.mu.Unlock()
+
+	stats := make([]api.ContractLockStats, len(locks))
+	for i, lock := range locks {
+		lock.mu.Lock()
+		stats[i] = api.ContractLockStats{
+			ContractID:            ids[i],
+			Held:                  lock.heldByID != 0,
+			Queued:                lock.queue.Len(),
+			Acquisitions:          lock.acquisitions,
+			ContendedAcquisitions: lock.contended,
+			Timeouts:              lock.timeouts,
+			Expirations:           lock.expirations,
+			WaitTime:              api.ParamDuration(lock.waitTime),
+			LastAcquired:          lock.lastAcquired,
+		}
+		lock.mu.Unlock()
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return bytes.Compare(stats[i].ContractID[:], stats[j].ContractID[:]) < 0
+	})
+	return stats
+}
+
 // Release releases the contract lock for a given contract and lock id.
 func (l *contractLocks) Release(id types.FileContractID, lockID uint64) error {
 	if lockID == 0 {
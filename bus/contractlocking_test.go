@@ -165,3 +165,55 @@ func TestContractRelease(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// TestContractLockLease verifies locks that are kept alive don't expire, locks
+// of dead holders do, and contention is reflected in the lock stats.
+func TestContractLockLease(t *testing.T) {
+	locks := newContractLocks()
+	fcid := types.FileContractID{1}
+
+	// acquire a lock with a short lease and keep it alive
+	lockID, err := locks.Acquire(context.Background(), 0, fcid, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		time.Sleep(25 * time.Millisecond)
+		if err := locks.Keepalive(fcid, lockID, 50*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a second holder has to wait until the first one stops its heartbeats
+	// and its lease expires
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	lockID2, err := locks.Acquire(ctx, 0, fcid, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := locks.Keepalive(fcid, lockID, time.Minute); !errors.Is(err, ErrContractLockNotHeld) {
+		t.Fatal("unexpected error", err)
+	} else if err := locks.Keepalive(types.FileContractID{2}, lockID, time.Minute); !errors.Is(err, ErrContractLockNotHeld) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// a third one times out
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := locks.Acquire(ctx, 0, fcid, time.Minute); !errors.Is(err, ErrAcquireContractTimeout) {
+		t.Fatal("unexpected error", err)
+	}
+	if err := locks.Release(fcid, lockID2); err != nil {
+		t.Fatal(err)
+	}
+
+	stats := locks.Stats()
+	if len(stats) != 1 {
+		t.Fatal("unexpected stats", stats)
+	}
+	s := stats[0]
+	if s.ContractID != fcid || s.Held || s.Acquisitions != 2 || s.ContendedAcquisitions != 1 || s.Timeouts != 1 || s.Expirations != 1 || s.WaitTime == 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
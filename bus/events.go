@@ -0,0 +1,171 @@
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.sia.tech/jape"
+	"go.sia.tech/renterd/api"
+	"go.uber.org/zap"
+)
+
+const (
+	// eventSubscriberBuffer is the number of events that are buffered per
+	// subscriber, events are dropped for subscribers that fall behind.
+	eventSubscriberBuffer = 64
+
+	// eventKeepAliveInterval is the interval at which a comment is sent to
+	// idle event streams so proxies don't close the connection.
+	eventKeepAliveInterval = 30 * time.Second
+)
+
+// An eventBroadcaster broadcasts bus events to the subscribers of the /events
+// endpoint.
+type eventBroadcaster struct {
+	logger *zap.SugaredLogger
+
+	mu          sync.Mutex
+	closed      bool
+	nextID      uint64
+	subscribers map[chan api.Event]struct{}
+}
+
+func newEventBroadcaster(l *zap.SugaredLogger) *eventBroadcaster {
+	return &eventBroadcaster{
+		logger:      l,
+		subscribers: make(map[chan api.Event]struct{}),
+	}
+}
+
+// Broadcast sends an event with the given type and payload to all
+// subscribers. It never blocks, subscribers that can't keep up miss events.
+func (eb *eventBroadcaster) Broadcast(typ string, data interface{}) {
+	js, err := json.Marshal(data)
+	if err != nil {
+		panic(err) // developer error
+	}
+
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	if eb.closed {
+		return
+	}
+	eb.nextID++
+	event := api.Event{
+		ID:        eb.nextID,
+		Type:      typ,
+		Timestamp: time.Now(),
+		Data:      js,
+	}
+	for sub := range eb.subscribers {
+		select {
+		case sub <- event:
+		default:
+			eb.logger.Debugw("dropped event for slow subscriber", "id", event.ID, "type", typ)
+		}
+	}
+}
+
+// Subscribe returns a channel on which the broadcast events are received and a
+// function to unsubscribe. The channel is closed when the broadcaster is shut
+// down.
+func (eb *eventBroadcaster) Subscribe() (<-chan api.Event, func()) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	sub := make(chan api.Event, eventSubscriberBuffer)
+	if eb.closed {
+		close(sub)
+		return sub, func() {}
+	}
+	eb.subscribers[sub] = struct{}{}
+	return sub, func() {
+		eb.mu.Lock()
+		defer eb.mu.Unlock()
+		if _, ok := eb.subscribers[sub]; ok {
+			delete(eb.subscribers, sub)
+			close(sub)
+		}
+	}
+}
+
+// Shutdown closes the channels of all subscribers, which ends their streams.
+func (eb *eventBroadcaster) Shutdown() {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	eb.closed = true
+	for sub := range eb.subscribers {
+		delete(eb.subscribers, sub)
+		close(sub)
+	}
+}
+
+// eventsHandlerGET streams the bus events as server-sent events. The optional
+// 'types' param is a comma separated list of the event types to stream.
+func (b *bus) eventsHandlerGET(jc jape.Context) {
+	var types string
+	if jc.DecodeForm("types", &types) != nil {
+		return
+	}
+	filter := make(map[string]bool)
+	for _, typ := range strings.Split(types, ",") {
+		if typ = strings.TrimSpace(typ); typ != "" {
+			filter[typ] = true
+		}
+	}
+
+	flusher, ok := jc.ResponseWriter.(http.Flusher)
+	if !ok {
+		jc.Error(errors.New("streaming is not supported"), http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := b.events.Subscribe()
+	defer unsubscribe()
+
+	w := jc.ResponseWriter
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	t := time.NewTicker(eventKeepAliveInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-jc.Request.Context().Done():
+			return
+		case <-t.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			} else if len(filter) > 0 && !filter[event.Type] {
+				continue
+			}
+			js, _ := json.Marshal(event)
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, js); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// updateSetting updates the setting with the given key and broadcasts the
+// change.
+func (b *bus) updateSetting(ctx context.Context, key, value string) error {
+	if err := b.ss.UpdateSetting(ctx, key, value); err != nil {
+		return err
+	}
+	b.events.Broadcast(api.EventSettingChanged, api.EventSettingChangedData{Key: key})
+	return nil
+}
@@ -0,0 +1,152 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/NebulousLabs/encoding"
+	"go.sia.tech/core/types"
+	"go.sia.tech/jape"
+	"go.sia.tech/renterd/api"
+)
+
+const (
+	// feeEstimationBlocks is the number of recent blocks whose transactions
+	// are considered when estimating the fee.
+	feeEstimationBlocks = 6
+
+	// feeMetricInterval is the interval at which the fee estimate is
+	// recorded.
+	feeMetricInterval = 10 * time.Minute
+
+	// feeMetricRetention is the time after which recorded fee estimates are
+	// pruned.
+	feeMetricRetention = 90 * 24 * time.Hour
+
+	// defaultFeeMetricsPeriod is the period of fee estimates that is returned
+	// if no start time is given.
+	defaultFeeMetricsPeriod = 24 * time.Hour
+)
+
+// A feeEstimator recommends a transaction fee per byte based on the fee
+// recommended by the transaction pool and the fees paid by the transactions
+// in recent blocks.
+type feeEstimator struct {
+	cm ChainManager
+	tp TransactionPool
+
+	mu        sync.Mutex
+	tip       types.ChainIndex
+	blocksFee types.Currency
+}
+
+func newFeeEstimator(cm ChainManager, tp TransactionPool) *feeEstimator {
+	return &feeEstimator{
+		cm: cm,
+		tp: tp,
+	}
+}
+
+// Estimate returns the recommended fee per byte, which is the maximum of the
+// fee recommended by the pool and the median fee paid in recent blocks.
+func (fe *feeEstimator) Estimate(ctx context.Context) api.FeeEstimate {
+	estimate := api.FeeEstimate{
+		PoolFeePerByte:   fe.tp.RecommendedFee(),
+		BlocksFeePerByte: fe.recentBlocksFee(ctx),
+	}
+	estimate.FeePerByte = estimate.PoolFeePerByte
+	if estimate.BlocksFeePerByte.Cmp(estimate.FeePerByte) > 0 {
+		estimate.FeePerByte = estimate.BlocksFeePerByte
+	}
+	return estimate
+}
+
+// recentBlocksFee returns the median fee per byte paid by the transactions in
+// recent blocks, it's only recomputed when the tip changes.
+func (fe *feeEstimator) recentBlocksFee(ctx context.Context) types.Currency {
+	tip := fe.cm.TipState(ctx).Index
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	if tip == fe.tip {
+		return fe.blocksFee
+	}
+
+	var blocks []types.Block
+	for i := uint64(0); i < feeEstimationBlocks && i <= tip.Height; i++ {
+		if b, exists := fe.cm.BlockAtHeight(ctx, tip.Height-i); exists {
+			blocks = append(blocks, b)
+		}
+	}
+	fe.tip = tip
+	fe.blocksFee = medianFeePerByte(blocks)
+	return fe.blocksFee
+}
+
+// medianFeePerByte returns the median fee per byte paid by the transactions
+// with miner fees in the given blocks.
+func medianFeePerByte(blocks []types.Block) types.Currency {
+	var fees []types.Currency
+	for _, b := range blocks {
+		for _, txn := range b.Transactions {
+			var fee types.Currency
+			for _, mf := range txn.MinerFees {
+				fee = fee.Add(mf)
+			}
+			if fee.IsZero() {
+				continue
+			}
+			fees = append(fees, fee.Div64(uint64(len(encoding.Marshal(txn)))))
+		}
+	}
+	if len(fees) == 0 {
+		return types.ZeroCurrency
+	}
+	sort.Slice(fees, func(i, j int) bool {
+		return fees[i].Cmp(fees[j]) < 0
+	})
+	return fees[len(fees)/2]
+}
+
+// recordFeeMetric records the current fee estimate and prunes the estimates
+// that were recorded before the retention period. Nothing is recorded while
+// the chain isn't synced since the estimate doesn't reflect the current fees.
+func (b *bus) recordFeeMetric(ctx context.Context) {
+	if !b.cm.Synced(ctx) {
+		return
+	}
+	now := time.Now()
+	if err := b.fs.RecordFeeMetric(ctx, api.FeeMetric{
+		Timestamp:   now,
+		BlockHeight: b.cm.TipState(ctx).Index.Height,
+		FeeEstimate: b.fees.Estimate(ctx),
+	}); err != nil {
+		b.logger.Errorw("failed to record fee metric", "error", err)
+		return
+	}
+	if pruned, err := b.fs.PruneFeeMetrics(ctx, now.Add(-feeMetricRetention)); err != nil {
+		b.logger.Errorw("failed to prune fee metrics", "error", err)
+	} else if pruned > 0 {
+		b.logger.Debugw("pruned fee metrics", "metrics", pruned)
+	}
+}
+
+func (b *bus) metricsFeesHandlerGET(jc jape.Context) {
+	end := time.Now()
+	var start time.Time
+	if jc.DecodeForm("start", (*api.ParamTime)(&start)) != nil || jc.DecodeForm("end", (*api.ParamTime)(&end)) != nil {
+		return
+	} else if start.IsZero() {
+		start = end.Add(-defaultFeeMetricsPeriod)
+	} else if start.After(end) {
+		jc.Error(errors.New("start can't be after end"), http.StatusBadRequest)
+		return
+	}
+	metrics, err := b.fs.FeeMetrics(jc.Request.Context(), start, end)
+	if jc.Check("couldn't load fee metrics", err) == nil {
+		jc.Encode(metrics)
+	}
+}
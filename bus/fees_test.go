@@ -0,0 +1,31 @@
+package bus
+
+import (
+	"testing"
+
+	"gitlab.com/NebulousLabs/encoding"
+	"go.sia.tech/core/types"
+)
+
+// TestMedianFeePerByte is a unit test for medianFeePerByte.
+func TestMedianFeePerByte(t *testing.T) {
+	// no transactions means no fee
+	if fee := medianFeePerByte(nil); !fee.IsZero() {
+		t.Fatal("unexpected fee", fee)
+	}
+
+	// create transactions paying 1, 2 and 3 H/byte and one without fees
+	var txns []types.Transaction
+	for i := uint64(1); i <= 3; i++ {
+		txn := types.Transaction{ArbitraryData: [][]byte{make([]byte, 100)}, MinerFees: []types.Currency{types.ZeroCurrency}}
+		size := uint64(len(encoding.Marshal(txn)))
+		txn.MinerFees[0] = types.NewCurrency64(i * size)
+		txns = append(txns, txn)
+	}
+	txns = append(txns, types.Transaction{})
+
+	blocks := []types.Block{{Transactions: txns[:2]}, {Transactions: txns[2:]}}
+	if fee := medianFeePerByte(blocks); !fee.Equals(types.NewCurrency64(2)) {
+		t.Fatal("unexpected fee", fee)
+	}
+}
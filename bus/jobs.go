@@ -0,0 +1,320 @@
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.sia.tech/jape"
+	"go.sia.tech/renterd/api"
+	"go.uber.org/zap"
+)
+
+// jobPollInterval is the interval at which the bus checks for pending jobs it
+// runs itself, on top of checking whenever such a job is created.
+const jobPollInterval = time.Minute
+
+// A jobFunc runs a job and returns its result.
+type jobFunc func(ctx context.Context, job api.Job) (interface{}, error)
+
+// A jobRunner runs the pending jobs of the types that are handled by the bus,
+// one at a time. Jobs of other types are acquired and run by the autopilot or
+// the workers.
+type jobRunner struct {
+	js     JobStore
+	funcs  map[string]jobFunc
+	logger *zap.SugaredLogger
+
+	wakeChan chan struct{}
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+
+	mu      sync.Mutex
+	running map[uint]context.CancelFunc
+}
+
+func newJobRunner(js JobStore, funcs map[string]jobFunc, l *zap.SugaredLogger) *jobRunner {
+	return &jobRunner{
+		js:       js,
+		funcs:    funcs,
+		logger:   l,
+		wakeChan: make(chan struct{}, 1),
+		stopChan: make(chan struct{}),
+		running:  make(map[uint]context.CancelFunc),
+	}
+}
+
+// types returns the job types handled by the runner.
+func (r *jobRunner) types() []string {
+	types := make([]string, 0, len(r.funcs))
+	for typ := range r.funcs {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// handles returns true if jobs of the given type are run by the runner.
+func (r *jobRunner) handles(typ string) bool {
+	_, ok := r.funcs[typ]
+	return ok
+}
+
+// run resumes the jobs that were interrupted by a shutdown and starts running
+// pending jobs until the runner is shut down.
+func (r *jobRunner) run(ctx context.Context, interval time.Duration) error {
+	if n, err := r.js.ResetRunningJobs(ctx, r.types()); err != nil {
+		return err
+	} else if n > 0 {
+		r.logger.Infow("resuming interrupted jobs", "jobs", n)
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			r.runPending()
+			select {
+			case <-r.stopChan:
+				return
+			case <-r.wakeChan:
+			case <-t.C:
+			}
+		}
+	}()
+	return nil
+}
+
+// wake makes the runner check for pending jobs right away.
+func (r *jobRunner) wake() {
+	select {
+	case r.wakeChan <- struct{}{}:
+	default:
+	}
+}
+
+// runPending runs pending jobs until there are none left.
+func (r *jobRunner) runPending() {
+	for {
+		select {
+		case <-r.stopChan:
+			return
+		default:
+		}
+		job, err := r.js.AcquireJob(context.Background(), r.types())
+		if errors.Is(err, api.ErrNoJobAvailable) {
+			return
+		} else if err != nil {
+			r.logger.Errorw("failed to acquire job", "error", err)
+			return
+		}
+		r.execute(job)
+	}
+}
+
+// execute runs the given job and records its outcome.
+func (r *jobRunner) execute(job api.Job) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-r.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	r.mu.Lock()
+	r.running[job.ID] = cancel
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.running, job.ID)
+		r.mu.Unlock()
+	}()
+
+	start := time.Now()
+	res, err := r.funcs[job.Type](ctx, job)
+
+	var u api.JobUpdate
+	if err != nil {
+		select {
+		case <-r.stopChan:
+			return // the job is resumed on the next start
+		default:
+		}
+		u = api.JobUpdate{State: api.JobStateFailed, Error: err.Error()}
+	} else {
+		result, err := json.Marshal(res)
+		if err != nil {
+			panic(err) // should never happen
+		}
+		u = api.JobUpdate{State: api.JobStateDone, Result: result}
+	}
+	if err := r.js.UpdateJob(context.Background(), job.ID, u); errors.Is(err, api.ErrJobNotRunning) {
+		r.logger.Debugw("job was cancelled", "id", job.ID, "type", job.Type)
+	} else if err != nil {
+		r.logger.Errorw("failed to update job", "id", job.ID, "error", err)
+	} else {
+		r.logger.Debugw("job finished", "id", job.ID, "type", job.Type, "state", u.State, "elapsed", time.Since(start))
+	}
+}
+
+// cancel interrupts the job with the given id if it's running.
+func (r *jobRunner) cancel(id uint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cancel, ok := r.running[id]; ok {
+		cancel()
+	}
+}
+
+// Shutdown stops the runner, interrupting the running job.
+func (r *jobRunner) Shutdown() {
+	close(r.stopChan)
+	r.wg.Wait()
+}
+
+func (b *bus) runGCJob(ctx context.Context, _ api.Job) (interface{}, error) {
+	res, err := b.ms.CollectGarbage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if res.Slabs > 0 || res.Sectors > 0 {
+		b.logger.Infow("collected garbage", "slabs", res.Slabs, "sectors", res.Sectors, "reclaimed", res.ReclaimedBytes)
+	}
+	return res, nil
+}
+
+func (b *bus) runPruneJob(ctx context.Context, job api.Job) (interface{}, error) {
+	var params api.PruneJobParams
+	if len(job.Params) > 0 {
+		if err := json.Unmarshal(job.Params, &params); err != nil {
+			return nil, fmt.Errorf("invalid params: %w", err)
+		}
+	}
+	purged, err := b.ms.PurgeTrash(ctx, params.ExpiredOnly)
+	if err != nil {
+		return nil, err
+	}
+	return api.PruneJobResult{Purged: purged}, nil
+}
+
+// jobError writes the error of a job operation with a status code that
+// matches it.
+func jobError(jc jape.Context, msg string, err error) error {
+	switch {
+	case errors.Is(err, api.ErrJobNotFound), errors.Is(err, api.ErrNoJobAvailable):
+		jc.Error(err, http.StatusNotFound)
+		return err
+	case errors.Is(err, api.ErrJobNotActive), errors.Is(err, api.ErrJobNotRunning), errors.Is(err, api.ErrJobNotRetryable):
+		jc.Error(err, http.StatusConflict)
+		return err
+	}
+	return jc.Check(msg, err)
+}
+
+func (b *bus) jobsHandlerGET(jc jape.Context) {
+	var typ, state string
+	offset := 0
+	limit := -1
+	if jc.DecodeForm("type", &typ) != nil || jc.DecodeForm("state", &state) != nil || jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+	jobs, err := b.js.Jobs(jc.Request.Context(), typ, state, offset, limit)
+	if jc.Check("couldn't load jobs", err) == nil {
+		jc.Encode(jobs)
+	}
+}
+
+func (b *bus) jobsHandlerPOST(jc jape.Context) {
+	var req api.JobCreateRequest
+	if jc.Decode(&req) != nil {
+		return
+	} else if err := req.Validate(); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	job, err := b.js.AddJob(jc.Request.Context(), req.Type, req.Params)
+	if jc.Check("couldn't add job", err) != nil {
+		return
+	}
+	if b.jobs.handles(job.Type) {
+		b.jobs.wake()
+	}
+	jc.Encode(job)
+}
+
+func (b *bus) jobsAcquireHandlerPOST(jc jape.Context) {
+	var req api.JobAcquireRequest
+	if jc.Decode(&req) != nil {
+		return
+	} else if len(req.Types) == 0 {
+		jc.Error(errors.New("no job types given"), http.StatusBadRequest)
+		return
+	}
+	for _, typ := range req.Types {
+		if b.jobs.handles(typ) {
+			jc.Error(fmt.Errorf("jobs of type %q are run by the bus", typ), http.StatusBadRequest)
+			return
+		}
+	}
+	job, err := b.js.AcquireJob(jc.Request.Context(), req.Types)
+	if jobError(jc, "couldn't acquire job", err) == nil {
+		jc.Encode(job)
+	}
+}
+
+func (b *bus) jobIDHandlerGET(jc jape.Context) {
+	var id int
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	job, err := b.js.Job(jc.Request.Context(), uint(id))
+	if jobError(jc, "couldn't load job", err) == nil {
+		jc.Encode(job)
+	}
+}
+
+func (b *bus) jobIDHandlerPUT(jc jape.Context) {
+	var id int
+	var u api.JobUpdate
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&u) != nil {
+		return
+	} else if err := u.Validate(); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	jobError(jc, "couldn't update job", b.js.UpdateJob(jc.Request.Context(), uint(id), u))
+}
+
+func (b *bus) jobIDCancelHandlerPOST(jc jape.Context) {
+	var id int
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	if jobError(jc, "couldn't cancel job", b.js.CancelJob(jc.Request.Context(), uint(id))) == nil {
+		b.jobs.cancel(uint(id))
+	}
+}
+
+func (b *bus) jobIDRetryHandlerPOST(jc jape.Context) {
+	var id int
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	ctx := jc.Request.Context()
+	if jobError(jc, "couldn't retry job", b.js.RetryJob(ctx, uint(id))) != nil {
+		return
+	}
+	if job, err := b.js.Job(ctx, uint(id)); err == nil && b.jobs.handles(job.Type) {
+		b.jobs.wake()
+	}
+}
@@ -0,0 +1,131 @@
+package bus
+
+import (
+	"errors"
+	"sort"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/jape"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/hostdb"
+)
+
+// unknownVersion is the version hosts without settings are counted under.
+const unknownVersion = "unknown"
+
+// networkStats summarizes the given hosts and compares the prices of the
+// hosts of the given contracts to the network.
+func networkStats(hosts []hostdb.Host, set string, contracts []api.ContractMetadata) api.NetworkStats {
+	stats := api.NetworkStats{
+		Hosts:    uint64(len(hosts)),
+		Versions: make(map[string]uint64),
+	}
+
+	var active []rhpv2.HostSettings
+	settings := make(map[types.PublicKey]rhpv2.HostSettings)
+	for _, h := range hosts {
+		if h.Settings == nil {
+			stats.Versions[unknownVersion]++
+			continue
+		}
+		stats.Versions[h.Settings.Version]++
+		settings[h.PublicKey] = *h.Settings
+		if !h.IsOnline() || !h.Settings.AcceptingContracts {
+			continue
+		}
+		active = append(active, *h.Settings)
+		stats.TotalStorage += h.Settings.TotalStorage
+		stats.RemainingStorage += h.Settings.RemainingStorage
+	}
+	stats.ActiveHosts = uint64(len(active))
+	stats.MedianPrices = medianPrices(active)
+
+	var setHosts []rhpv2.HostSettings
+	for _, c := range contracts {
+		if s, ok := settings[c.HostKey]; ok {
+			setHosts = append(setHosts, s)
+		}
+	}
+	stats.ContractSet = api.ContractSetStats{
+		Name:         set,
+		Contracts:    uint64(len(contracts)),
+		MedianPrices: medianPrices(setHosts),
+	}
+	if len(setHosts) > 0 {
+		sp := stats.ContractSet.MedianPrices
+		stats.ContractSet.StoragePricePercentile = cheaperShare(active, sp.StoragePrice, func(s rhpv2.HostSettings) types.Currency { return s.StoragePrice })
+		stats.ContractSet.UploadPricePercentile = cheaperShare(active, sp.UploadPrice, func(s rhpv2.HostSettings) types.Currency { return s.UploadBandwidthPrice })
+		stats.ContractSet.DownloadPricePercentile = cheaperShare(active, sp.DownloadPrice, func(s rhpv2.HostSettings) types.Currency { return s.DownloadBandwidthPrice })
+	}
+	return stats
+}
+
+// medianPrices returns the median of every price the given hosts advertise.
+func medianPrices(settings []rhpv2.HostSettings) api.HostPrices {
+	median := func(price func(rhpv2.HostSettings) types.Currency) types.Currency {
+		if len(settings) == 0 {
+			return types.ZeroCurrency
+		}
+		prices := make([]types.Currency, len(settings))
+		for i, s := range settings {
+			prices[i] = price(s)
+		}
+		sort.Slice(prices, func(i, j int) bool {
+			return prices[i].Cmp(prices[j]) < 0
+		})
+		return prices[len(prices)/2]
+	}
+	return api.HostPrices{
+		ContractPrice: median(func(s rhpv2.HostSettings) types.Currency { return s.ContractPrice }),
+		StoragePrice:  median(func(s rhpv2.HostSettings) types.Currency { return s.StoragePrice }),
+		Collateral:    median(func(s rhpv2.HostSettings) types.Currency { return s.Collateral }),
+		UploadPrice:   median(func(s rhpv2.HostSettings) types.Currency { return s.UploadBandwidthPrice }),
+		DownloadPrice: median(func(s rhpv2.HostSettings) types.Currency { return s.DownloadBandwidthPrice }),
+	}
+}
+
+// cheaperShare returns the share of the given hosts whose price is lower than
+// the given one.
+func cheaperShare(settings []rhpv2.HostSettings, p types.Currency, price func(rhpv2.HostSettings) types.Currency) float64 {
+	if len(settings) == 0 {
+		return 0
+	}
+	var cheaper int
+	for _, s := range settings {
+		if price(s).Cmp(p) < 0 {
+			cheaper++
+		}
+	}
+	return float64(cheaper) / float64(len(settings))
+}
+
+func (b *bus) networkStatsHandlerGET(jc jape.Context) {
+	ctx := jc.Request.Context()
+	var set string
+	if jc.DecodeForm("set", &set) != nil {
+		return
+	} else if set == "" {
+		var err error
+		set, err = b.ss.Setting(ctx, SettingContractSet)
+		if err != nil && !errors.Is(err, api.ErrSettingNotFound) {
+			jc.Check("couldn't load contract set setting", err)
+			return
+		}
+	}
+
+	hosts, err := b.hdb.Hosts(ctx, 0, -1)
+	if jc.Check("couldn't load hosts", err) != nil {
+		return
+	}
+	var contracts []api.ContractMetadata
+	if set != "" {
+		contracts, err = b.ms.Contracts(ctx, set)
+		if errors.Is(err, api.ErrContractSetNotFound) {
+			contracts = nil
+		} else if jc.Check("couldn't load contracts", err) != nil {
+			return
+		}
+	}
+	jc.Encode(networkStats(hosts, set, contracts))
+}
@@ -0,0 +1,68 @@
+package bus
+
+import (
+	"testing"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/hostdb"
+)
+
+// TestNetworkStats is a unit test for networkStats.
+func TestNetworkStats(t *testing.T) {
+	newHost := func(b byte, online, accepting bool, price uint64, version string) hostdb.Host {
+		return hostdb.Host{
+			PublicKey: types.PublicKey{b},
+			Settings: &rhpv2.HostSettings{
+				AcceptingContracts:     accepting,
+				StoragePrice:           types.NewCurrency64(price),
+				UploadBandwidthPrice:   types.NewCurrency64(price),
+				DownloadBandwidthPrice: types.NewCurrency64(price),
+				TotalStorage:           100,
+				RemainingStorage:       50,
+				Version:                version,
+			},
+			Interactions: hostdb.Interactions{TotalScans: 1, LastScanSuccess: online},
+		}
+	}
+	hosts := []hostdb.Host{
+		newHost(1, true, true, 1, "1.6.0"),
+		newHost(2, true, true, 2, "1.6.0"),
+		newHost(3, true, true, 3, "1.5.9"),
+		newHost(4, true, true, 4, "1.5.9"),
+		newHost(5, false, true, 100, "1.5.9"), // offline
+		newHost(6, true, false, 100, "1.5.9"), // not accepting contracts
+		{PublicKey: types.PublicKey{7}},       // never scanned
+	}
+	contracts := []api.ContractMetadata{
+		{HostKey: types.PublicKey{3}},
+		{HostKey: types.PublicKey{4}},
+	}
+
+	stats := networkStats(hosts, "autopilot", contracts)
+	if stats.Hosts != 7 || stats.ActiveHosts != 4 {
+		t.Fatal("unexpected host counts", stats.Hosts, stats.ActiveHosts)
+	} else if stats.TotalStorage != 400 || stats.RemainingStorage != 200 {
+		t.Fatal("unexpected storage", stats.TotalStorage, stats.RemainingStorage)
+	} else if !stats.MedianPrices.StoragePrice.Equals(types.NewCurrency64(3)) {
+		t.Fatal("unexpected median storage price", stats.MedianPrices.StoragePrice)
+	} else if len(stats.Versions) != 3 || stats.Versions["1.6.0"] != 2 || stats.Versions["1.5.9"] != 4 || stats.Versions[unknownVersion] != 1 {
+		t.Fatal("unexpected versions", stats.Versions)
+	}
+
+	// the median host of the set is more expensive than half the network
+	set := stats.ContractSet
+	if set.Name != "autopilot" || set.Contracts != 2 {
+		t.Fatal("unexpected contract set", set.Name, set.Contracts)
+	} else if !set.MedianPrices.UploadPrice.Equals(types.NewCurrency64(4)) {
+		t.Fatal("unexpected median upload price", set.MedianPrices.UploadPrice)
+	} else if set.StoragePricePercentile != 0.75 || set.UploadPricePercentile != 0.75 || set.DownloadPricePercentile != 0.75 {
+		t.Fatal("unexpected percentiles", set.StoragePricePercentile, set.UploadPricePercentile, set.DownloadPricePercentile)
+	}
+
+	// no contracts means no comparison
+	if stats := networkStats(hosts, "", nil); stats.ContractSet != (api.ContractSetStats{}) {
+		t.Fatal("unexpected contract set stats", stats.ContractSet)
+	}
+}
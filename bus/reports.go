@@ -0,0 +1,213 @@
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.uber.org/zap"
+)
+
+const (
+	// reportPersistInterval is the interval at which the report of the
+	// current day is persisted.
+	reportPersistInterval = 5 * time.Minute
+
+	// reportWebhookTimeout is the timeout for pushing a report to the
+	// configured webhook.
+	reportWebhookTimeout = 30 * time.Second
+)
+
+// A reporter aggregates the activity of the current day into a daily report.
+// The report is persisted periodically so it survives restarts, once the day
+// is over it's pushed to the webhook configured in the report settings.
+type reporter struct {
+	rs     ReportStore
+	ss     SettingStore
+	logger *zap.SugaredLogger
+
+	finishedChan chan struct{}
+	stopChan     chan struct{}
+	wg           sync.WaitGroup
+
+	mu       sync.Mutex
+	current  api.DailyReport
+	finished []api.DailyReport
+}
+
+func newReporter(ctx context.Context, rs ReportStore, ss SettingStore, l *zap.SugaredLogger) (*reporter, error) {
+	r := &reporter{
+		rs:           rs,
+		ss:           ss,
+		logger:       l,
+		finishedChan: make(chan struct{}, 1),
+		stopChan:     make(chan struct{}),
+	}
+
+	// Continue where we left off if the bus was restarted today.
+	today := reportDate(time.Now())
+	reports, err := rs.DailyReports(ctx, today, 1)
+	if err != nil {
+		return nil, err
+	} else if len(reports) > 0 {
+		r.current = reports[0]
+	} else {
+		r.current = api.DailyReport{Date: today}
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		t := time.NewTicker(reportPersistInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-r.stopChan:
+				return
+			case <-r.finishedChan:
+				r.finalizeFinished()
+			case <-t.C:
+				if err := r.persist(context.Background()); err != nil {
+					r.logger.Errorw("failed to persist daily report", "error", err)
+				}
+			}
+		}
+	}()
+	return r, nil
+}
+
+// reportDate returns the start of the day of the given time in UTC.
+func reportDate(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+// update applies fn to the report of the current day. If the day is over, its
+// report is queued to be finalized by the reporter's goroutine first.
+func (r *reporter) update(fn func(*api.DailyReport)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if today := reportDate(time.Now()); today.After(r.current.Date) {
+		r.finished = append(r.finished, r.current)
+		r.current = api.DailyReport{Date: today}
+		select {
+		case r.finishedChan <- struct{}{}:
+		default:
+		}
+	}
+	fn(&r.current)
+}
+
+// report returns a copy of the report of the current day.
+func (r *reporter) report() api.DailyReport {
+	r.update(func(*api.DailyReport) {})
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+func (r *reporter) persist(ctx context.Context) error {
+	return r.rs.UpdateDailyReport(ctx, r.report())
+}
+
+// finalize persists the report of a day that's over and pushes it to the
+// webhook.
+func (r *reporter) finalize(dr api.DailyReport) {
+	ctx, cancel := context.WithTimeout(context.Background(), reportWebhookTimeout)
+	defer cancel()
+	if err := r.rs.UpdateDailyReport(ctx, dr); err != nil {
+		r.logger.Errorw("failed to persist daily report", "date", dr.Date, "error", err)
+	}
+	if err := r.push(ctx, dr); err != nil {
+		r.logger.Errorw("failed to push daily report", "date", dr.Date, "error", err)
+	}
+}
+
+// finalizeFinished finalizes the reports of the days that are over.
+func (r *reporter) finalizeFinished() {
+	r.mu.Lock()
+	finished := r.finished
+	r.finished = nil
+	r.mu.Unlock()
+	for _, dr := range finished {
+		r.finalize(dr)
+	}
+}
+
+// push POSTs the report to the webhook in the report settings, if any.
+func (r *reporter) push(ctx context.Context, dr api.DailyReport) error {
+	var rs api.ReportSettings
+	if setting, err := r.ss.Setting(ctx, SettingReports); errors.Is(err, api.ErrSettingNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	} else if err := json.Unmarshal([]byte(setting), &rs); err != nil {
+		return err
+	} else if rs.WebhookURL == "" {
+		return nil
+	}
+	return postWebhook(ctx, rs.WebhookURL, dr)
+}
+
+// Shutdown stops the reporter and persists the report of the current day.
+func (r *reporter) Shutdown(ctx context.Context) error {
+	close(r.stopChan)
+	r.wg.Wait()
+	err := r.persist(ctx)
+	r.finalizeFinished() // persisting might have finished the previous day
+	return err
+}
+
+// utilizationReport computes the utilization of the given contracts, the
+// hosts in the report are sorted by their effective price per TB, most
+// expensive first.
+func utilizationReport(contracts []api.ContractMetadata, sizes map[types.FileContractID]uint64) api.UtilizationReport {
+	report := api.UtilizationReport{
+		Contracts: make([]api.ContractUtilization, 0, len(contracts)),
+		Hosts:     make([]api.HostUtilization, 0),
+	}
+	hosts := make(map[types.PublicKey]int)
+	for _, c := range contracts {
+		cu := api.ContractUtilization{
+			ContractID: c.ID,
+			HostKey:    c.HostKey,
+			Size:       sizes[c.ID],
+			Spending:   c.Spending,
+		}
+		if c.TotalCost.Cmp(c.RemainingFunds) > 0 {
+			cu.Spent = c.TotalCost.Sub(c.RemainingFunds)
+		}
+		cu.PricePerTB = pricePerTB(cu.Spent, cu.Size)
+		report.Contracts = append(report.Contracts, cu)
+
+		i, ok := hosts[c.HostKey]
+		if !ok {
+			i = len(report.Hosts)
+			hosts[c.HostKey] = i
+			report.Hosts = append(report.Hosts, api.HostUtilization{HostKey: c.HostKey})
+		}
+		report.Hosts[i].Contracts++
+		report.Hosts[i].Size += cu.Size
+		report.Hosts[i].Spent = report.Hosts[i].Spent.Add(cu.Spent)
+	}
+	for i := range report.Hosts {
+		report.Hosts[i].PricePerTB = pricePerTB(report.Hosts[i].Spent, report.Hosts[i].Size)
+	}
+	sort.SliceStable(report.Hosts, func(i, j int) bool {
+		return report.Hosts[i].PricePerTB.Cmp(report.Hosts[j].PricePerTB) > 0
+	})
+	return report
+}
+
+// pricePerTB returns the price per TB paid for storing size bytes, it's zero
+// if size is zero.
+func pricePerTB(spent types.Currency, size uint64) types.Currency {
+	if size == 0 {
+		return types.ZeroCurrency
+	}
+	return spent.Mul64(1e12).Div64(size)
+}
@@ -0,0 +1,190 @@
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.uber.org/zap"
+)
+
+type mockReportStore struct {
+	mu      sync.Mutex
+	reports map[time.Time]api.DailyReport
+}
+
+func (s *mockReportStore) DailyReports(ctx context.Context, since time.Time, limit int) ([]api.DailyReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var reports []api.DailyReport
+	for date, r := range s.reports {
+		if !date.Before(since) {
+			reports = append(reports, r)
+		}
+	}
+	return reports, nil
+}
+
+func (s *mockReportStore) UpdateDailyReport(ctx context.Context, r api.DailyReport) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reports[r.Date] = r
+	return nil
+}
+
+type mockSettingStore map[string]string
+
+func (s mockSettingStore) Setting(ctx context.Context, key string) (string, error) {
+	if v, ok := s[key]; ok {
+		return v, nil
+	}
+	return "", api.ErrSettingNotFound
+}
+func (s mockSettingStore) Settings(ctx context.Context) ([]string, error) { return nil, nil }
+func (s mockSettingStore) UpdateSetting(ctx context.Context, key, value string) error {
+	s[key] = value
+	return nil
+}
+func (s mockSettingStore) UpdateSettings(ctx context.Context, settings map[string]string) error {
+	return nil
+}
+func (s mockSettingStore) SettingHistory(ctx context.Context, key string, offset, limit int) ([]api.SettingUpdate, error) {
+	return nil, nil
+}
+func (s mockSettingStore) RollbackSetting(ctx context.Context, key string, id uint) error {
+	return nil
+}
+
+// TestReporter is a unit test for the reporter.
+func TestReporter(t *testing.T) {
+	pushed := make(chan api.DailyReport, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var dr api.DailyReport
+		if err := json.NewDecoder(req.Body).Decode(&dr); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		pushed <- dr
+	}))
+	defer srv.Close()
+	settings, _ := json.Marshal(api.ReportSettings{WebhookURL: srv.URL})
+
+	// Assume the bus was restarted today.
+	today := reportDate(time.Now())
+	rs := &mockReportStore{reports: map[time.Time]api.DailyReport{
+		today: {Date: today, ContractsFormed: 1},
+	}}
+	r, err := newReporter(context.Background(), rs, mockSettingStore{SettingReports: string(settings)}, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.update(func(dr *api.DailyReport) { dr.ContractsFormed++ })
+	r.update(func(dr *api.DailyReport) { dr.Spending = dr.Spending.Add(types.Siacoins(1)) })
+	if report := r.report(); report.ContractsFormed != 2 || !report.Spending.Equals(types.Siacoins(1)) {
+		t.Fatal("unexpected report", report)
+	}
+
+	// Pretend the report is from yesterday, the next update should finalize
+	// it and push it to the webhook.
+	yesterday := today.Add(-24 * time.Hour)
+	r.mu.Lock()
+	r.current.Date = yesterday
+	r.mu.Unlock()
+	r.update(func(dr *api.DailyReport) { dr.Migrations++ })
+
+	select {
+	case dr := <-pushed:
+		if !dr.Date.Equal(yesterday) || dr.ContractsFormed != 2 || dr.Migrations != 0 {
+			t.Fatal("unexpected pushed report", dr)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("report wasn't pushed")
+	}
+	if report := r.report(); !report.Date.Equal(today) || report.Migrations != 1 || report.ContractsFormed != 0 {
+		t.Fatal("unexpected report", report)
+	}
+
+	// Shutting down should persist both reports.
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if rs.reports[yesterday].ContractsFormed != 2 || rs.reports[today].Migrations != 1 {
+		t.Fatal("unexpected persisted reports", rs.reports)
+	}
+}
+
+// TestReporterShutdownRace asserts that finishing days while the reporter is
+// shut down doesn't race, run it with -race.
+func TestReporterShutdownRace(t *testing.T) {
+	today := reportDate(time.Now())
+	rs := &mockReportStore{reports: make(map[time.Time]api.DailyReport)}
+	r, err := newReporter(context.Background(), rs, mockSettingStore{}, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// every update finishes a day, bound the number of updates so
+			// the finished reports don't pile up
+			for j := 0; j < 1000; j++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				r.mu.Lock()
+				r.current.Date = today.Add(-24 * time.Hour)
+				r.mu.Unlock()
+				r.update(func(dr *api.DailyReport) { dr.Migrations++ })
+			}
+		}()
+	}
+	if err := r.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestUtilizationReport(t *testing.T) {
+	hk1, hk2 := types.PublicKey{1}, types.PublicKey{2}
+	fcid1, fcid2, fcid3 := types.FileContractID{1}, types.FileContractID{2}, types.FileContractID{3}
+	contracts := []api.ContractMetadata{
+		{ID: fcid1, HostKey: hk1, TotalCost: types.Siacoins(10), RemainingFunds: types.Siacoins(8)},
+		{ID: fcid2, HostKey: hk2, TotalCost: types.Siacoins(10), RemainingFunds: types.Siacoins(4)},
+		{ID: fcid3, HostKey: hk1, TotalCost: types.Siacoins(10), RemainingFunds: types.Siacoins(10)},
+	}
+	sizes := map[types.FileContractID]uint64{
+		fcid1: 1e12,
+		fcid2: 2e12,
+	}
+
+	report := utilizationReport(contracts, sizes)
+	if len(report.Contracts) != 3 {
+		t.Fatal("unexpected number of contracts", len(report.Contracts))
+	} else if cu := report.Contracts[0]; cu.Size != 1e12 || !cu.Spent.Equals(types.Siacoins(2)) || !cu.PricePerTB.Equals(types.Siacoins(2)) {
+		t.Fatal("unexpected utilization", cu)
+	} else if cu := report.Contracts[2]; cu.Size != 0 || !cu.Spent.IsZero() || !cu.PricePerTB.IsZero() {
+		t.Fatal("unexpected utilization", cu)
+	}
+
+	// hosts are sorted by their price per TB, most expensive first
+	if len(report.Hosts) != 2 {
+		t.Fatal("unexpected number of hosts", len(report.Hosts))
+	} else if hu := report.Hosts[0]; hu.HostKey != hk2 || hu.Contracts != 1 || !hu.PricePerTB.Equals(types.Siacoins(3)) {
+		t.Fatal("unexpected host utilization", hu)
+	} else if hu := report.Hosts[1]; hu.HostKey != hk1 || hu.Contracts != 2 || hu.Size != 1e12 || !hu.PricePerTB.Equals(types.Siacoins(2)) {
+		t.Fatal("unexpected host utilization", hu)
+	}
+}
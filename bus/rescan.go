@@ -0,0 +1,154 @@
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+// rescanProgressInterval is the number of blocks after which the progress of a
+// rescan job is updated.
+const rescanProgressInterval = 1000
+
+// A rescannedContract is a contract of the renter that was found on chain.
+type rescannedContract struct {
+	rev         rhpv2.ContractRevision
+	startHeight uint64 // height of the block the contract was confirmed in
+	resolved    bool
+}
+
+// revisable returns true if the contract can still be revised by its host at
+// the given height.
+func (c *rescannedContract) revisable(height uint64) bool {
+	return !c.resolved &&
+		c.rev.Revision.RevisionNumber != math.MaxUint64 && // renewed
+		height < c.rev.Revision.WindowStart
+}
+
+// contractUnlockConditions returns the unlock conditions of the contracts
+// formed with the given keys.
+func contractUnlockConditions(keys api.ContractKeys) types.UnlockConditions {
+	return types.UnlockConditions{
+		PublicKeys: []types.UnlockKey{
+			keys.RenterKey.UnlockKey(),
+			keys.HostKey.UnlockKey(),
+		},
+		SignaturesRequired: 2,
+	}
+}
+
+// rescanContracts scans the blocks up to the given height for contracts formed
+// with one of the given key pairs and tracks their latest revision. Contracts
+// only reveal the hash of their unlock conditions when they are formed, which
+// is why the key pairs have to be known upfront.
+func rescanContracts(ctx context.Context, cm ChainManager, keys []api.ContractKeys, height uint64, progress func(uint64)) (map[types.FileContractID]*rescannedContract, error) {
+	ucs := make(map[types.Address]types.UnlockConditions, len(keys))
+	for _, k := range keys {
+		uc := contractUnlockConditions(k)
+		ucs[uc.UnlockHash()] = uc
+	}
+
+	contracts := make(map[types.FileContractID]*rescannedContract)
+	for h := uint64(0); h <= height; h++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		} else if h > 0 && h%rescanProgressInterval == 0 {
+			progress(h)
+		}
+
+		b, ok := cm.BlockAtHeight(ctx, h)
+		if !ok {
+			return nil, fmt.Errorf("block at height %d not found", h)
+		}
+		for _, txn := range b.Transactions {
+			for i, fc := range txn.FileContracts {
+				uc, ok := ucs[types.Address(fc.UnlockHash)]
+				if !ok {
+					continue
+				}
+				fcid := txn.FileContractID(i)
+				contracts[fcid] = &rescannedContract{
+					rev: rhpv2.ContractRevision{
+						Revision: types.FileContractRevision{
+							ParentID:         fcid,
+							UnlockConditions: uc,
+							FileContract:     fc,
+						},
+					},
+					startHeight: h,
+				}
+			}
+			for _, rev := range txn.FileContractRevisions {
+				if c, ok := contracts[rev.ParentID]; ok && rev.RevisionNumber > c.rev.Revision.RevisionNumber {
+					c.rev.Revision.FileContract = rev.FileContract
+				}
+			}
+			for _, sp := range txn.StorageProofs {
+				if c, ok := contracts[sp.ParentID]; ok {
+					c.resolved = true
+				}
+			}
+		}
+	}
+	return contracts, nil
+}
+
+func (b *bus) runRescanJob(ctx context.Context, job api.Job) (interface{}, error) {
+	var params api.RescanJobParams
+	if err := json.Unmarshal(job.Params, &params); err != nil {
+		return nil, fmt.Errorf("invalid params: %w", err)
+	} else if len(params.Keys) == 0 {
+		return nil, errors.New("no keys to rescan for")
+	}
+
+	// scan the chain up to the current tip
+	height := b.cm.TipState(ctx).Index.Height
+	contracts, err := rescanContracts(ctx, b.cm, params.Keys, height, func(h uint64) {
+		u := api.JobUpdate{State: api.JobStateRunning, Progress: float64(h) / float64(height+1)}
+		if err := b.js.UpdateJob(ctx, job.ID, u); err != nil {
+			b.logger.Debugw("failed to update rescan progress", "id", job.ID, "error", err)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// add the contracts that can still be revised in the order they were
+	// formed
+	var revisable []*rescannedContract
+	for _, c := range contracts {
+		if c.revisable(height) {
+			revisable = append(revisable, c)
+		}
+	}
+	sort.Slice(revisable, func(i, j int) bool {
+		if revisable[i].startHeight != revisable[j].startHeight {
+			return revisable[i].startHeight < revisable[j].startHeight
+		}
+		fcidI, fcidJ := revisable[i].rev.ID(), revisable[j].rev.ID()
+		return string(fcidI[:]) < string(fcidJ[:])
+	})
+
+	res := api.RescanJobResult{Height: height, Found: len(revisable)}
+	for _, c := range revisable {
+		cm := api.ContractMetadata{ID: c.rev.ID(), StartHeight: c.startHeight}
+		res.Contracts = append(res.Contracts, cm.ID)
+		if _, err := b.ms.RescanContract(ctx, cm, c.rev); errors.Is(err, api.ErrContractExists) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to add contract %v: %w", cm.ID, err)
+		}
+		res.Added++
+	}
+	if res.Added > 0 {
+		b.logger.Infow("recovered contracts from the blockchain", "found", res.Found, "added", res.Added)
+	}
+	return res, nil
+}
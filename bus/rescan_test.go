@@ -0,0 +1,92 @@
+package bus
+
+import (
+	"context"
+	"math"
+	"testing"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"lukechampine.com/frand"
+)
+
+// TestRescanContracts is a unit test for rescanContracts.
+func TestRescanContracts(t *testing.T) {
+	randomKeys := func() api.ContractKeys {
+		return api.ContractKeys{
+			HostKey:   types.GeneratePrivateKey().PublicKey(),
+			RenterKey: types.GeneratePrivateKey().PublicKey(),
+		}
+	}
+	ours := []api.ContractKeys{randomKeys(), randomKeys()}
+	theirs := randomKeys()
+
+	// formContract returns a transaction forming a contract with the given
+	// keys
+	formContract := func(keys api.ContractKeys, windowStart uint64) (types.Transaction, types.FileContractID) {
+		txn := types.Transaction{
+			ArbitraryData: [][]byte{frand.Bytes(16)},
+			FileContracts: []types.FileContract{{
+				WindowStart: windowStart,
+				WindowEnd:   windowStart + 10,
+				UnlockHash:  types.Hash256(contractUnlockConditions(keys).UnlockHash()),
+			}},
+		}
+		return txn, txn.FileContractID(0)
+	}
+	revise := func(fcid types.FileContractID, revisionNumber uint64) types.Transaction {
+		return types.Transaction{FileContractRevisions: []types.FileContractRevision{{
+			ParentID:     fcid,
+			FileContract: types.FileContract{RevisionNumber: revisionNumber, WindowStart: 100},
+		}}}
+	}
+
+	// form a contract that is revised, one that is renewed, one that is
+	// proven, one that expired and one with keys that aren't ours
+	revisedTxn, revised := formContract(ours[0], 100)
+	renewedTxn, renewed := formContract(ours[1], 100)
+	provenTxn, proven := formContract(ours[0], 100)
+	expiredTxn, expired := formContract(ours[1], 3)
+	otherTxn, other := formContract(theirs, 100)
+	cm := mockChainManager{blocks: []types.Block{
+		{Transactions: []types.Transaction{revisedTxn, renewedTxn, otherTxn}},
+		{Transactions: []types.Transaction{revise(revised, 5), provenTxn, expiredTxn}},
+		{Transactions: []types.Transaction{revise(renewed, math.MaxUint64), revise(revised, 3), revise(other, 5)}},
+		{Transactions: []types.Transaction{{StorageProofs: []types.StorageProof{{ParentID: proven}}}}},
+	}}
+
+	contracts, err := rescanContracts(context.Background(), cm, ours, 3, func(uint64) {})
+	if err != nil {
+		t.Fatal(err)
+	} else if len(contracts) != 4 {
+		t.Fatal("unexpected number of contracts", len(contracts))
+	} else if _, ok := contracts[other]; ok {
+		t.Fatal("found contract that isn't ours")
+	}
+
+	// assert the revised contract has its latest revision, older revisions
+	// are ignored
+	c := contracts[revised]
+	if c.startHeight != 0 || c.rev.Revision.RevisionNumber != 5 || c.rev.ID() != revised || c.rev.HostKey() != ours[0].HostKey {
+		t.Fatal("unexpected contract", c)
+	} else if !c.revisable(3) {
+		t.Fatal("contract should be revisable")
+	} else if c.revisable(100) {
+		t.Fatal("contract shouldn't be revisable once its proof window started")
+	}
+
+	// assert the other contracts aren't revisable
+	for _, fcid := range []types.FileContractID{renewed, proven, expired} {
+		if contracts[fcid].revisable(3) {
+			t.Fatal("contract shouldn't be revisable", fcid)
+		}
+	}
+	if contracts[proven].startHeight != 1 {
+		t.Fatal("unexpected start height", contracts[proven].startHeight)
+	}
+
+	// a missing block is an error
+	if _, err := rescanContracts(context.Background(), cm, ours, 4, func(uint64) {}); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,272 @@
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/jape"
+	"go.sia.tech/renterd/api"
+	"go.uber.org/zap"
+)
+
+// schedulerStoreTimeout is the timeout for removing the events that were
+// broadcast from the store.
+const schedulerStoreTimeout = time.Minute
+
+// errScheduledEventNotFound is returned if an event that isn't scheduled is
+// cancelled.
+var errScheduledEventNotFound = errors.New("scheduled event not found")
+
+// A heightScheduler broadcasts the events subsystems scheduled for specific
+// block heights, e.g. the autopilot schedules revision broadcasts and renewals
+// instead of polling the current height. It's driven by the consensus changes
+// the bus is notified about, the events are persisted until they are broadcast
+// and they are broadcast in the order of their heights.
+type heightScheduler struct {
+	events *eventBroadcaster
+	logger *zap.SugaredLogger
+	store  SchedulerStore
+
+	wakeChan chan struct{}
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+
+	// mu is held while the store is updated, so the persisted events
+	// always match the events in memory.
+	mu        sync.Mutex
+	height    uint64
+	scheduled map[string]api.ScheduledEvent
+}
+
+func newHeightScheduler(ctx context.Context, height uint64, store SchedulerStore, events *eventBroadcaster, l *zap.SugaredLogger) (*heightScheduler, error) {
+	persisted, err := store.ScheduledEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s := &heightScheduler{
+		events:    events,
+		logger:    l,
+		store:     store,
+		wakeChan:  make(chan struct{}, 1),
+		stopChan:  make(chan struct{}),
+		height:    height,
+		scheduled: make(map[string]api.ScheduledEvent),
+	}
+	for _, e := range persisted {
+		s.scheduled[e.Key] = e
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			s.runDue()
+			select {
+			case <-s.stopChan:
+				return
+			case <-s.wakeChan:
+			}
+		}
+	}()
+	return s, nil
+}
+
+// Schedule schedules the events, replacing the events that were scheduled
+// under the same keys. Events for heights that were already reached are
+// broadcast right away.
+func (s *heightScheduler) Schedule(ctx context.Context, events ...api.ScheduledEvent) error {
+	s.mu.Lock()
+	if err := s.store.ScheduleEvents(ctx, events); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	var due bool
+	for _, e := range events {
+		s.scheduled[e.Key] = e
+		due = due || e.Height <= s.height
+	}
+	s.mu.Unlock()
+	if due {
+		s.wake()
+	}
+	return nil
+}
+
+// Cancel removes the events scheduled under the given keys.
+func (s *heightScheduler) Cancel(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.store.RemoveScheduledEvents(ctx, keys); err != nil {
+		return err
+	}
+	for _, key := range keys {
+		delete(s.scheduled, key)
+	}
+	return nil
+}
+
+// Scheduled returns the event scheduled under the given key.
+func (s *heightScheduler) Scheduled(key string) (api.ScheduledEvent, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.scheduled[key]
+	return e, ok
+}
+
+// Events returns the scheduled events, lowest height first.
+func (s *heightScheduler) Events() []api.ScheduledEvent {
+	s.mu.Lock()
+	events := make([]api.ScheduledEvent, 0, len(s.scheduled))
+	for _, e := range s.scheduled {
+		events = append(events, e)
+	}
+	s.mu.Unlock()
+	sortScheduledEvents(events)
+	return events
+}
+
+// ProcessHeight records that the chain reached the given height, broadcasting
+// the events that became due.
+func (s *heightScheduler) ProcessHeight(height uint64) {
+	s.mu.Lock()
+	s.height = height
+	s.mu.Unlock()
+	s.wake()
+}
+
+func (s *heightScheduler) wake() {
+	select {
+	case s.wakeChan <- struct{}{}:
+	default:
+	}
+}
+
+// runDue broadcasts the events that are due, lowest height first. The events
+// are only removed once they were removed from the store, events that can't be
+// removed are tried again on the next height.
+func (s *heightScheduler) runDue() {
+	s.mu.Lock()
+	height := s.height
+	var due []api.ScheduledEvent
+	var keys []string
+	for _, e := range s.scheduled {
+		if e.Height <= height {
+			due = append(due, e)
+			keys = append(keys, e.Key)
+		}
+	}
+	if len(due) == 0 {
+		s.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), schedulerStoreTimeout)
+	err := s.store.RemoveScheduledEvents(ctx, keys)
+	cancel()
+	if err != nil {
+		s.mu.Unlock()
+		s.logger.Errorw("failed to remove due events", "height", height, "error", err)
+		return
+	}
+	for _, key := range keys {
+		delete(s.scheduled, key)
+	}
+	s.mu.Unlock()
+
+	sortScheduledEvents(due)
+	for _, e := range due {
+		s.logger.Debugw("broadcasting scheduled event", "key", e.Key, "type", e.Type, "height", e.Height, "current", height)
+		s.events.Broadcast(e.Type, e.Data)
+	}
+}
+
+// Shutdown stops the scheduler.
+func (s *heightScheduler) Shutdown() {
+	close(s.stopChan)
+	s.wg.Wait()
+}
+
+func sortScheduledEvents(events []api.ScheduledEvent) {
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Height != events[j].Height {
+			return events[i].Height < events[j].Height
+		}
+		return events[i].Key < events[j].Key
+	})
+}
+
+// ProcessHeight notifies the bus that the chain reached the given height, it's
+// called for every consensus change.
+func (b *bus) ProcessHeight(height uint64) {
+	b.scheduler.ProcessHeight(height)
+}
+
+func (b *bus) scheduleHandlerGET(jc jape.Context) {
+	jc.Encode(b.scheduler.Events())
+}
+
+func (b *bus) scheduleHandlerPOST(jc jape.Context) {
+	var events []api.ScheduledEvent
+	if jc.Decode(&events) != nil {
+		return
+	}
+	for _, e := range events {
+		if e.Key == "" || e.Type == "" {
+			jc.Error(errors.New("scheduled events need a key and a type"), http.StatusBadRequest)
+			return
+		} else if len(e.Data) > 0 && !json.Valid(e.Data) {
+			jc.Error(fmt.Errorf("data of scheduled event %q isn't valid JSON", e.Key), http.StatusBadRequest)
+			return
+		}
+	}
+	jc.Check("couldn't schedule events", b.scheduler.Schedule(jc.Request.Context(), events...))
+}
+
+func (b *bus) scheduleKeyHandlerDELETE(jc jape.Context) {
+	key := jc.PathParam("key")
+	if _, ok := b.scheduler.Scheduled(key); !ok {
+		jc.Error(errScheduledEventNotFound, http.StatusNotFound)
+		return
+	}
+	jc.Check("couldn't cancel scheduled event", b.scheduler.Cancel(jc.Request.Context(), key))
+}
+
+// contractExpiryKey is the key of the event scheduled for a contract's expiry.
+func contractExpiryKey(id types.FileContractID) string {
+	return fmt.Sprintf("contract_expiry_%v", id)
+}
+
+// scheduleContractExpiry schedules broadcasting EventContractExpired once the
+// contract's proof window closed.
+func (b *bus) scheduleContractExpiry(ctx context.Context, c api.ContractMetadata) {
+	data, err := json.Marshal(api.EventContractExpiredData{
+		ContractID: c.ID,
+		WindowEnd:  c.WindowEnd,
+	})
+	if err != nil {
+		panic(err) // should never happen
+	}
+	err = b.scheduler.Schedule(ctx, api.ScheduledEvent{
+		Key:    contractExpiryKey(c.ID),
+		Height: c.WindowEnd,
+		Type:   api.EventContractExpired,
+		Data:   data,
+	})
+	if err != nil {
+		b.logger.Errorw("failed to schedule contract expiry", "fcid", c.ID, "error", err)
+	}
+}
+
+// cancelContractExpiry cancels the expiry event of a contract that was
+// archived.
+func (b *bus) cancelContractExpiry(ctx context.Context, id types.FileContractID) {
+	if err := b.scheduler.Cancel(ctx, contractExpiryKey(id)); err != nil {
+		b.logger.Errorw("failed to cancel contract expiry", "fcid", id, "error", err)
+	}
+}
@@ -0,0 +1,120 @@
+package bus
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.sia.tech/renterd/api"
+	"go.uber.org/zap"
+)
+
+// memorySchedulerStore is an in-memory SchedulerStore.
+type memorySchedulerStore struct {
+	mu     sync.Mutex
+	events map[string]api.ScheduledEvent
+}
+
+func (s *memorySchedulerStore) ScheduledEvents(ctx context.Context) (events []api.ScheduledEvent, _ error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.events {
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func (s *memorySchedulerStore) ScheduleEvents(ctx context.Context, events []api.ScheduledEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range events {
+		s.events[e.Key] = e
+	}
+	return nil
+}
+
+func (s *memorySchedulerStore) RemoveScheduledEvents(ctx context.Context, keys []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range keys {
+		delete(s.events, key)
+	}
+	return nil
+}
+
+func TestHeightScheduler(t *testing.T) {
+	ctx := context.Background()
+	store := &memorySchedulerStore{events: map[string]api.ScheduledEvent{
+		"persisted": {Key: "persisted", Height: 11, Type: "persisted"},
+	}}
+	events := newEventBroadcaster(zap.NewNop().Sugar())
+	defer events.Shutdown()
+	sub, unsubscribe := events.Subscribe()
+	defer unsubscribe()
+
+	s, err := newHeightScheduler(ctx, 10, store, events, zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Shutdown()
+
+	schedule := func(key string, height uint64) {
+		t.Helper()
+		if err := s.Schedule(ctx, api.ScheduledEvent{Key: key, Height: height, Type: key}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := func(types ...string) {
+		t.Helper()
+		for _, typ := range types {
+			select {
+			case e := <-sub:
+				if e.Type != typ {
+					t.Fatalf("expected event %v, got %v", typ, e.Type)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("event %v wasn't broadcast", typ)
+			}
+		}
+		select {
+		case e := <-sub:
+			t.Fatal("unexpected event", e.Type)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	// events for heights that were already reached are broadcast right away
+	schedule("past", 5)
+	expect("past")
+
+	// schedule some future events, replace one of them and cancel another
+	schedule("b", 13)
+	schedule("a", 12)
+	schedule("c", 20)
+	schedule("d", 11)
+	schedule("d", 14)
+	if err := s.Cancel(ctx, "c"); err != nil {
+		t.Fatal(err)
+	} else if _, ok := s.Scheduled("c"); ok {
+		t.Fatal("expected event to be cancelled")
+	} else if e, ok := s.Scheduled("d"); !ok || e.Height != 14 {
+		t.Fatal("unexpected event", e, ok)
+	} else if events := s.Events(); len(events) != 4 || events[0].Key != "persisted" || events[3].Key != "d" {
+		t.Fatal("unexpected events", events)
+	} else if len(store.events) != 4 {
+		t.Fatal("events weren't persisted", store.events)
+	}
+
+	// only the persisted event is broadcast at height 11
+	s.ProcessHeight(11)
+	expect("persisted")
+
+	// jumping to height 15 broadcasts the remaining events in order and
+	// removes them from the store
+	s.ProcessHeight(15)
+	expect("a", "b", "d")
+	if len(s.Events()) != 0 || len(store.events) != 0 {
+		t.Fatal("expected events to be removed", s.Events(), store.events)
+	}
+}
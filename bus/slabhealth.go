@@ -0,0 +1,105 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.sia.tech/renterd/api"
+	"go.uber.org/zap"
+)
+
+// A slabHealthChecker periodically recomputes the health of all slabs with
+// regard to the configured contract set and persists it.
+type slabHealthChecker struct {
+	ms        MetadataStore
+	ss        SettingStore
+	logger    *zap.SugaredLogger
+	batchSize int
+
+	// onRefresh is called after every successful refresh.
+	onRefresh func(context.Context)
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+
+	mu  sync.Mutex
+	set string
+}
+
+func newSlabHealthChecker(ms MetadataStore, ss SettingStore, batchSize int, onRefresh func(context.Context), l *zap.SugaredLogger) *slabHealthChecker {
+	return &slabHealthChecker{
+		ms:        ms,
+		ss:        ss,
+		logger:    l,
+		batchSize: batchSize,
+		onRefresh: onRefresh,
+		stopChan:  make(chan struct{}),
+	}
+}
+
+// run refreshes the slab health at the given interval until the checker is
+// shut down.
+func (c *slabHealthChecker) run(interval time.Duration) {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-c.stopChan:
+				return
+			case <-t.C:
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				select {
+				case <-c.stopChan:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+			if err := c.refresh(ctx); err != nil {
+				c.logger.Errorw("failed to refresh slab health", "error", err)
+			}
+			cancel()
+		}
+	}()
+}
+
+// refresh recomputes the health of all slabs.
+func (c *slabHealthChecker) refresh(ctx context.Context) error {
+	set, err := c.ss.Setting(ctx, SettingContractSet)
+	if errors.Is(err, api.ErrSettingNotFound) {
+		return nil // nothing to do
+	} else if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	if err := c.ms.RefreshSlabHealth(ctx, set, c.batchSize); err != nil {
+		return err
+	}
+	c.logger.Debugw("refreshed slab health", "set", set, "elapsed", time.Since(start))
+
+	c.mu.Lock()
+	c.set = set
+	c.mu.Unlock()
+	c.onRefresh(ctx)
+	return nil
+}
+
+// Set returns the contract set of the last refresh.
+func (c *slabHealthChecker) Set() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.set
+}
+
+// Shutdown stops the checker, interrupting an ongoing refresh.
+func (c *slabHealthChecker) Shutdown() {
+	close(c.stopChan)
+	c.wg.Wait()
+}
@@ -0,0 +1,193 @@
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+// spendingReservationTimeout is the time after which an authorized amount that
+// wasn't recorded as spent no longer counts towards the caps.
+const spendingReservationTimeout = time.Hour
+
+// A spendingLedger tracks the spending within the current spending period and
+// enforces the spending caps. Authorized amounts are reserved until they're
+// recorded as spent, so concurrent requests can't exceed a cap together.
+type spendingLedger struct {
+	ss  SettingStore
+	sps SpendingStore
+
+	mu           sync.Mutex
+	reservations []spendingReservation
+}
+
+// A spendingReservation is an amount that was authorized but not yet recorded
+// as spent.
+type spendingReservation struct {
+	category string
+	amount   types.Currency
+	expiry   time.Time
+}
+
+func newSpendingLedger(ss SettingStore, sps SpendingStore) *spendingLedger {
+	return &spendingLedger{ss: ss, sps: sps}
+}
+
+// spendingCaps returns the spending caps, they're empty if not set.
+func spendingCaps(ctx context.Context, ss SettingStore) (sc api.SpendingCaps, err error) {
+	setting, err := ss.Setting(ctx, SettingSpendingCaps)
+	if errors.Is(err, api.ErrSettingNotFound) {
+		return api.SpendingCaps{}, nil
+	} else if err != nil {
+		return api.SpendingCaps{}, err
+	}
+	err = json.Unmarshal([]byte(setting), &sc)
+	return
+}
+
+// periodStart returns the start of the spending period that contains the given
+// height.
+func periodStart(height, period uint64) uint64 {
+	if period == 0 {
+		return 0
+	}
+	return height - height%period
+}
+
+// load returns the spending caps and the spending within the period that
+// contains the given height.
+func (l *spendingLedger) load(ctx context.Context, height uint64) (api.SpendingCaps, api.PeriodSpending, error) {
+	caps, err := spendingCaps(ctx, l.ss)
+	if err != nil {
+		return api.SpendingCaps{}, api.PeriodSpending{}, err
+	}
+	ps, err := l.sps.PeriodSpending(ctx, periodStart(height, caps.Period))
+	if err != nil {
+		return api.SpendingCaps{}, api.PeriodSpending{}, err
+	}
+	return caps, ps, nil
+}
+
+// reserved returns the amount reserved for the given category, expired
+// reservations are dropped.
+func (l *spendingLedger) reserved(category string) (sum types.Currency) {
+	reservations := l.reservations[:0]
+	for _, r := range l.reservations {
+		if time.Now().Before(r.expiry) {
+			reservations = append(reservations, r)
+		}
+	}
+	l.reservations = reservations
+	for _, r := range l.reservations {
+		if r.category == category {
+			sum = sum.Add(r.amount)
+		}
+	}
+	return
+}
+
+// release releases up to the given amount of the reservations for the given
+// category, oldest first.
+func (l *spendingLedger) release(category string, amount types.Currency) {
+	reservations := l.reservations[:0]
+	for _, r := range l.reservations {
+		if r.category == category && !amount.IsZero() {
+			if r.amount.Cmp(amount) <= 0 {
+				amount = amount.Sub(r.amount)
+				continue
+			}
+			r.amount = r.amount.Sub(amount)
+			amount = types.ZeroCurrency
+		}
+		reservations = append(reservations, r)
+	}
+	l.reservations = reservations
+}
+
+// Spending returns the spending within the period that contains the given
+// height.
+func (l *spendingLedger) Spending(ctx context.Context, height uint64) (api.PeriodSpending, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, ps, err := l.load(ctx, height)
+	return ps, err
+}
+
+// Authorize returns an error wrapping api.ErrSpendingCapExceeded if spending
+// the given amount in the given category would exceed the category's cap or
+// the total cap, taking the reserved amounts into account. Once a cap is
+// reached even a zero amount is rejected. The authorized amount is reserved
+// until it's recorded or the reservation expires.
+func (l *spendingLedger) Authorize(ctx context.Context, height uint64, category string, amount types.Currency) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	caps, ps, err := l.load(ctx, height)
+	if err != nil {
+		return err
+	}
+	spent, ok := ps.Category(category)
+	if !ok {
+		return fmt.Errorf("unknown spending category '%v'", category)
+	}
+	spent = spent.Add(l.reserved(category))
+	total := ps.Total()
+	for _, c := range []string{api.SpendingCategoryFormation, api.SpendingCategoryStorage, api.SpendingCategoryUpload, api.SpendingCategoryDownload, api.SpendingCategoryFundAccount} {
+		total = total.Add(l.reserved(c))
+	}
+	if limit := caps.Category(category); exceedsCap(spent, amount, limit) {
+		return fmt.Errorf("%w: spending %v on %v would exceed its cap of %v, %v were spent or reserved this period", api.ErrSpendingCapExceeded, amount, category, limit, spent)
+	} else if exceedsCap(total, amount, caps.Total) {
+		return fmt.Errorf("%w: spending %v would exceed the total cap of %v, %v were spent or reserved this period", api.ErrSpendingCapExceeded, amount, caps.Total, total)
+	}
+	if !amount.IsZero() {
+		l.reservations = append(l.reservations, spendingReservation{
+			category: category,
+			amount:   amount,
+			expiry:   time.Now().Add(spendingReservationTimeout),
+		})
+	}
+	return nil
+}
+
+// Record adds the given spending to the spending within the period that
+// contains the given height and releases the reservations it covers.
+func (l *spendingLedger) Record(ctx context.Context, height uint64, spending api.PeriodSpending) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	caps, err := spendingCaps(ctx, l.ss)
+	if err != nil {
+		return err
+	}
+	spending.PeriodStart = periodStart(height, caps.Period)
+	if err := l.sps.AddPeriodSpending(ctx, spending); err != nil {
+		return err
+	}
+	l.release(api.SpendingCategoryFormation, spending.Formation)
+	l.release(api.SpendingCategoryStorage, spending.Storage)
+	l.release(api.SpendingCategoryUpload, spending.Upload)
+	l.release(api.SpendingCategoryDownload, spending.Download)
+	l.release(api.SpendingCategoryFundAccount, spending.FundAccount)
+	return nil
+}
+
+// exceedsCap returns true if the limit is set and spending the given amount on
+// top of what was spent already would exceed it.
+func exceedsCap(spent, amount, limit types.Currency) bool {
+	return !limit.IsZero() && (spent.Cmp(limit) >= 0 || spent.Add(amount).Cmp(limit) > 0)
+}
+
+// formationFees returns the part of a contract's total cost that isn't locked
+// in the contract as renter funds, i.e. the fees paid to form or renew it.
+func formationFees(totalCost types.Currency, rev rhpv2.ContractRevision) types.Currency {
+	if funds := rev.Revision.ValidRenterPayout(); totalCost.Cmp(funds) > 0 {
+		return totalCost.Sub(funds)
+	}
+	return types.ZeroCurrency
+}
@@ -0,0 +1,103 @@
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+type mockSpendingStore map[uint64]api.PeriodSpending
+
+func (s mockSpendingStore) PeriodSpending(ctx context.Context, periodStart uint64) (api.PeriodSpending, error) {
+	ps := s[periodStart]
+	ps.PeriodStart = periodStart
+	return ps, nil
+}
+
+func (s mockSpendingStore) AddPeriodSpending(ctx context.Context, spending api.PeriodSpending) error {
+	s[spending.PeriodStart] = s[spending.PeriodStart].Add(spending)
+	return nil
+}
+
+func TestSpendingLedger(t *testing.T) {
+	ctx := context.Background()
+	js, _ := json.Marshal(api.SpendingCaps{
+		Period:      10,
+		Total:       types.Siacoins(10),
+		FundAccount: types.Siacoins(4),
+	})
+	ss := mockSettingStore{SettingSpendingCaps: string(js)}
+	l := newSpendingLedger(ss, make(mockSpendingStore))
+
+	// spending within the caps is authorized
+	if err := l.Authorize(ctx, 5, api.SpendingCategoryFundAccount, types.Siacoins(3)); err != nil {
+		t.Fatal(err)
+	} else if err := l.Authorize(ctx, 5, "unknown", types.ZeroCurrency); err == nil {
+		t.Fatal("expected error for unknown category")
+	}
+
+	// the authorized amount is reserved, so a concurrent request can't
+	// exceed the cap
+	if err := l.Authorize(ctx, 5, api.SpendingCategoryFundAccount, types.Siacoins(2)); !errors.Is(err, api.ErrSpendingCapExceeded) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// recording the spending releases the reservation, the cap is still
+	// exceeded
+	if err := l.Record(ctx, 5, api.PeriodSpending{FundAccount: types.Siacoins(3)}); err != nil {
+		t.Fatal(err)
+	} else if len(l.reservations) != 0 {
+		t.Fatal("expected reservation to be released", l.reservations)
+	} else if err := l.Authorize(ctx, 5, api.SpendingCategoryFundAccount, types.Siacoins(2)); !errors.Is(err, api.ErrSpendingCapExceeded) {
+		t.Fatal("unexpected error", err)
+	} else if err := l.Authorize(ctx, 5, api.SpendingCategoryFundAccount, types.Siacoins(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// reservations count towards the total cap as well
+	if err := l.Record(ctx, 5, api.PeriodSpending{Formation: types.Siacoins(3), Storage: types.Siacoins(2)}); err != nil {
+		t.Fatal(err)
+	} else if err := l.Authorize(ctx, 5, api.SpendingCategoryUpload, types.Siacoins(2)); !errors.Is(err, api.ErrSpendingCapExceeded) {
+		t.Fatal("unexpected error", err)
+	} else if err := l.Authorize(ctx, 5, api.SpendingCategoryUpload, types.Siacoins(1)); err != nil {
+		t.Fatal(err)
+	} else if err := l.Authorize(ctx, 5, api.SpendingCategoryDownload, types.ZeroCurrency); !errors.Is(err, api.ErrSpendingCapExceeded) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// expired reservations no longer count
+	for i := range l.reservations {
+		l.reservations[i].expiry = l.reservations[i].expiry.Add(-2 * spendingReservationTimeout)
+	}
+	if err := l.Authorize(ctx, 5, api.SpendingCategoryDownload, types.Siacoins(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the spending is reset in the next period
+	if ps, err := l.Spending(ctx, 5); err != nil {
+		t.Fatal(err)
+	} else if !ps.Total().Equals(types.Siacoins(8)) {
+		t.Fatal("unexpected spending", ps.Total())
+	} else if ps, err := l.Spending(ctx, 10); err != nil {
+		t.Fatal(err)
+	} else if ps.PeriodStart != 10 || !ps.Total().IsZero() {
+		t.Fatal("unexpected spending", ps)
+	}
+}
+
+// TestFormationFees verifies only the fees of a contract count as formation
+// spending, not the funds locked in the contract.
+func TestFormationFees(t *testing.T) {
+	var rev rhpv2.ContractRevision
+	rev.Revision.ValidProofOutputs = []types.SiacoinOutput{{Value: types.Siacoins(10)}, {}}
+	if fees := formationFees(types.Siacoins(12), rev); !fees.Equals(types.Siacoins(2)) {
+		t.Fatal("unexpected fees", fees)
+	} else if fees := formationFees(types.Siacoins(8), rev); !fees.IsZero() {
+		t.Fatal("unexpected fees", fees)
+	}
+}
@@ -0,0 +1,113 @@
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.sia.tech/jape"
+	"go.sia.tech/renterd/api"
+)
+
+// trashPurgeInterval is the interval at which objects whose retention period
+// in the trash passed are purged.
+const trashPurgeInterval = time.Hour
+
+// trashSettings returns the trash settings, the trash is disabled if they
+// weren't set.
+func trashSettings(ctx context.Context, ss SettingStore) (ts api.TrashSettings, err error) {
+	setting, err := ss.Setting(ctx, SettingTrash)
+	if errors.Is(err, api.ErrSettingNotFound) {
+		return api.TrashSettings{}, nil
+	} else if err != nil {
+		return api.TrashSettings{}, err
+	}
+	err = json.Unmarshal([]byte(setting), &ts)
+	return
+}
+
+// purgeExpiredTrash purges the objects whose retention period in the trash
+// passed. Objects remain in the trash until they expire even if the trash was
+// disabled in the meantime.
+func (b *bus) purgeExpiredTrash(ctx context.Context) {
+	purged, err := b.ms.PurgeTrash(ctx, true)
+	if err != nil {
+		b.logger.Errorw("failed to purge expired trash", "error", err)
+	} else if purged > 0 {
+		b.logger.Debugw("purged expired trash", "objects", purged)
+	}
+}
+
+func (b *bus) trashHandlerGET(jc jape.Context) {
+	offset := 0
+	limit := -1
+	if jc.DecodeForm("offset", &offset) != nil || jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+	objects, err := b.ms.TrashedObjects(jc.Request.Context(), offset, limit)
+	if jc.Check("couldn't fetch trashed objects", err) == nil {
+		jc.Encode(objects)
+	}
+}
+
+func (b *bus) trashHandlerDELETE(jc jape.Context) {
+	var expired bool
+	if jc.DecodeForm("expired", &expired) != nil {
+		return
+	}
+	_, err := b.ms.PurgeTrash(jc.Request.Context(), expired)
+	jc.Check("couldn't purge trash", err)
+}
+
+func (b *bus) trashSettingsHandlerGET(jc jape.Context) {
+	ts, err := trashSettings(jc.Request.Context(), b.ss)
+	if jc.Check("could not load trash settings", err) == nil {
+		jc.Encode(ts)
+	}
+}
+
+func (b *bus) trashSettingsHandlerPUT(jc jape.Context) {
+	var ts api.TrashSettings
+	if jc.Decode(&ts) != nil {
+		return
+	} else if err := ts.Validate(); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+		return
+	}
+	js, err := json.Marshal(ts)
+	if err != nil {
+		panic(err)
+	}
+	jc.Check("could not update trash settings", b.updateSetting(jc.Request.Context(), SettingTrash, string(js)))
+}
+
+func (b *bus) trashIDRestoreHandlerPOST(jc jape.Context) {
+	var id int
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	err := b.ms.RestoreTrashedObject(jc.Request.Context(), uint(id))
+	if errors.Is(err, api.ErrTrashedObjectNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	} else if errors.Is(err, api.ErrObjectExists) {
+		jc.Error(err, http.StatusConflict)
+		return
+	}
+	jc.Check("couldn't restore trashed object", err)
+}
+
+func (b *bus) trashIDHandlerDELETE(jc jape.Context) {
+	var id int
+	if jc.DecodeParam("id", &id) != nil {
+		return
+	}
+	err := b.ms.PurgeTrashedObject(jc.Request.Context(), uint(id))
+	if errors.Is(err, api.ErrTrashedObjectNotFound) {
+		jc.Error(err, http.StatusNotFound)
+		return
+	}
+	jc.Check("couldn't purge trashed object", err)
+}
@@ -0,0 +1,94 @@
+package bus
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+// errUnsignedTxnNotFound is returned when an unsigned transaction isn't queued.
+var errUnsignedTxnNotFound = errors.New("unsigned transaction not found")
+
+// unsignedTransactions keeps track of the transactions funded by a watch-only
+// wallet that are waiting to be signed externally.
+type unsignedTransactions struct {
+	mu   sync.Mutex
+	txns map[types.TransactionID]api.UnsignedTransaction
+}
+
+func newUnsignedTransactions() *unsignedTransactions {
+	return &unsignedTransactions{
+		txns: make(map[types.TransactionID]api.UnsignedTransaction),
+	}
+}
+
+// Add queues the given transaction for external signing and returns its id.
+func (u *unsignedTransactions) Add(txn types.Transaction, toSign []types.Hash256, cf types.CoveredFields, dependsOn []types.Transaction) types.TransactionID {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	id := txn.ID()
+	u.txns[id] = api.UnsignedTransaction{
+		ID:            id,
+		Transaction:   txn,
+		ToSign:        toSign,
+		CoveredFields: cf,
+		DependsOn:     dependsOn,
+		Created:       time.Now(),
+	}
+	return id
+}
+
+// Get returns the queued transaction with the given id.
+func (u *unsignedTransactions) Get(id types.TransactionID) (api.UnsignedTransaction, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	utxn, exists := u.txns[id]
+	if !exists {
+		return api.UnsignedTransaction{}, errUnsignedTxnNotFound
+	}
+	return utxn, nil
+}
+
+// List returns all queued transactions, oldest first.
+func (u *unsignedTransactions) List() []api.UnsignedTransaction {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	txns := make([]api.UnsignedTransaction, 0, len(u.txns))
+	for _, utxn := range u.txns {
+		txns = append(txns, utxn)
+	}
+	sort.Slice(txns, func(i, j int) bool {
+		return txns[i].Created.Before(txns[j].Created)
+	})
+	return txns
+}
+
+// Remove removes the transaction with the given id from the queue.
+func (u *unsignedTransactions) Remove(id types.TransactionID) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.txns, id)
+}
+
+// verifySigned checks that the signed transaction matches the queued one and
+// that all of its inputs were signed.
+func verifySigned(utxn api.UnsignedTransaction, txn types.Transaction) error {
+	if txn.ID() != utxn.ID {
+		return fmt.Errorf("signed transaction %v doesn't match unsigned transaction %v", txn.ID(), utxn.ID)
+	}
+	signed := make(map[types.Hash256]bool)
+	for _, sig := range txn.Signatures {
+		signed[sig.ParentID] = true
+	}
+	for _, id := range utxn.ToSign {
+		if !signed[id] {
+			return fmt.Errorf("input %v wasn't signed", id)
+		}
+	}
+	return nil
+}
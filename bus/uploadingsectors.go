@@ -0,0 +1,82 @@
+package bus
+
+import (
+	"sync"
+	"time"
+
+	"go.sia.tech/core/types"
+)
+
+// uploadingSectorsTimeout is the time after which the root of a sector that
+// was uploaded to a contract is no longer protected from pruning. By then, the
+// upload has either finished and the sector is referenced by an object, or it
+// failed and the sector can be pruned.
+const uploadingSectorsTimeout = 24 * time.Hour
+
+// uploadingSectorsPruneInterval is the minimum time between two passes over
+// the tracked roots that remove the expired ones.
+const uploadingSectorsPruneInterval = time.Minute
+
+// An uploadingSectors keeps track of the sectors that were uploaded to a
+// contract but aren't referenced by an object yet because the upload is still
+// in progress. Their roots are returned together with the contract's roots to
+// prevent the pruner from deleting them.
+type uploadingSectors struct {
+	mu        sync.Mutex
+	contracts map[types.FileContractID]map[types.Hash256]time.Time
+	lastPrune time.Time
+}
+
+func newUploadingSectors() *uploadingSectors {
+	return &uploadingSectors{
+		contracts: make(map[types.FileContractID]map[types.Hash256]time.Time),
+	}
+}
+
+// Add tracks the roots of sectors that were uploaded to the given contract.
+func (us *uploadingSectors) Add(fcid types.FileContractID, roots []types.Hash256) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	us.pruneExpired()
+	if len(roots) == 0 {
+		return
+	}
+	if _, ok := us.contracts[fcid]; !ok {
+		us.contracts[fcid] = make(map[types.Hash256]time.Time)
+	}
+	for _, root := range roots {
+		us.contracts[fcid][root] = time.Now()
+	}
+}
+
+// Roots returns the roots of the sectors that are being uploaded to the given
+// contract.
+func (us *uploadingSectors) Roots(fcid types.FileContractID) []types.Hash256 {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+	us.pruneExpired()
+	roots := make([]types.Hash256, 0, len(us.contracts[fcid]))
+	for root := range us.contracts[fcid] {
+		roots = append(roots, root)
+	}
+	return roots
+}
+
+// pruneExpired removes the roots that were added more than
+// uploadingSectorsTimeout ago, the caller must hold the lock.
+func (us *uploadingSectors) pruneExpired() {
+	if time.Since(us.lastPrune) < uploadingSectorsPruneInterval {
+		return
+	}
+	us.lastPrune = time.Now()
+	for fcid, roots := range us.contracts {
+		for root, added := range roots {
+			if time.Since(added) > uploadingSectorsTimeout {
+				delete(roots, root)
+			}
+		}
+		if len(roots) == 0 {
+			delete(us.contracts, fcid)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package bus
+
+import (
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"lukechampine.com/frand"
+)
+
+func TestUploadingSectors(t *testing.T) {
+	us := newUploadingSectors()
+
+	var fcid1, fcid2 types.FileContractID
+	frand.Read(fcid1[:])
+	frand.Read(fcid2[:])
+	root1, root2 := types.Hash256(frand.Entropy256()), types.Hash256(frand.Entropy256())
+
+	// add roots to both contracts and assert they are tracked per contract
+	us.Add(fcid1, []types.Hash256{root1, root2})
+	us.Add(fcid2, []types.Hash256{root1})
+	if roots := us.Roots(fcid1); len(roots) != 2 {
+		t.Fatal("unexpected roots", roots)
+	} else if roots := us.Roots(fcid2); len(roots) != 1 || roots[0] != root1 {
+		t.Fatal("unexpected roots", roots)
+	}
+
+	// adding a root again shouldn't duplicate it
+	us.Add(fcid2, []types.Hash256{root1})
+	if roots := us.Roots(fcid2); len(roots) != 1 {
+		t.Fatal("unexpected roots", roots)
+	}
+
+	// expire the roots of the first contract
+	us.mu.Lock()
+	for root := range us.contracts[fcid1] {
+		us.contracts[fcid1][root] = time.Now().Add(-uploadingSectorsTimeout - time.Second)
+	}
+	us.lastPrune = time.Time{}
+	us.mu.Unlock()
+	if roots := us.Roots(fcid1); len(roots) != 0 {
+		t.Fatal("expected expired roots to be removed", roots)
+	} else if roots := us.Roots(fcid2); len(roots) != 1 {
+		t.Fatal("unexpected roots", roots)
+	}
+}
@@ -0,0 +1,102 @@
+package bus
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/wallet"
+	"go.uber.org/zap"
+)
+
+const (
+	notificationIDWalletDeposit  = "wallet_deposit"
+	notificationIDContractPayout = "contract_payout"
+)
+
+// A walletWatcher notifies about incoming deposits and contract payouts by
+// comparing the wallet's outputs against the outputs it has seen before.
+type walletWatcher struct {
+	w      Wallet
+	cm     ChainManager
+	alerts *alerter
+	logger *zap.SugaredLogger
+
+	// seen is nil until the watcher was initialized with the wallet's
+	// outputs, the existing outputs don't trigger notifications.
+	seen map[types.Hash256]bool
+}
+
+func newWalletWatcher(w Wallet, cm ChainManager, alerts *alerter, l *zap.SugaredLogger) *walletWatcher {
+	return &walletWatcher{
+		w:      w,
+		cm:     cm,
+		alerts: alerts,
+		logger: l,
+	}
+}
+
+// check notifies about the outputs that were added to the wallet since the
+// last check. Outputs received while the chain isn't synced are considered
+// seen.
+func (ww *walletWatcher) check(ctx context.Context) {
+	outputs, err := ww.w.UnspentOutputs()
+	if err != nil {
+		ww.logger.Errorw("failed to fetch wallet outputs", "error", err)
+		return
+	}
+
+	var received []wallet.SiacoinElement
+	seen := make(map[types.Hash256]bool, len(outputs))
+	for _, sce := range outputs {
+		seen[sce.ID] = true
+		if ww.seen != nil && !ww.seen[sce.ID] {
+			received = append(received, sce)
+		}
+	}
+	ww.seen = seen
+	if len(received) == 0 || !ww.cm.Synced(ctx) {
+		return
+	}
+
+	// map the outputs created by the wallet's transactions to their
+	// transaction
+	txns, err := ww.w.Transactions(time.Time{}, -1)
+	if err != nil {
+		ww.logger.Errorw("failed to fetch wallet transactions", "error", err)
+		return
+	}
+	created := make(map[types.Hash256]wallet.Transaction)
+	for _, txn := range txns {
+		for i := range txn.Raw.SiacoinOutputs {
+			created[types.Hash256(txn.Raw.SiacoinOutputID(i))] = txn
+		}
+	}
+
+	// outputs that weren't created by a transaction are contract payouts,
+	// outputs created by a transaction that doesn't spend any of the wallet's
+	// outputs are deposits
+	deposits := make(map[types.TransactionID]types.Currency)
+	for _, sce := range received {
+		txn, ok := created[sce.ID]
+		if !ok {
+			ww.alerts.Notify(notificationIDContractPayout, api.AlertSeverityInfo, fmt.Sprintf("received contract payout of %v in output %v", sce.Value, sce.ID))
+		} else if !ww.spendsOwnedOutputs(txn.Raw) {
+			deposits[txn.ID] = deposits[txn.ID].Add(sce.Value)
+		}
+	}
+	for id, value := range deposits {
+		ww.alerts.Notify(notificationIDWalletDeposit, api.AlertSeverityInfo, fmt.Sprintf("received deposit of %v in transaction %v", value, id))
+	}
+}
+
+func (ww *walletWatcher) spendsOwnedOutputs(txn types.Transaction) bool {
+	for _, sci := range txn.SiacoinInputs {
+		if ww.w.OwnsAddress(sci.UnlockConditions.UnlockHash()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package bus
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/wallet"
+	"go.uber.org/zap"
+)
+
+type mockChainManager struct {
+	ChainManager
+	blocks []types.Block
+}
+
+func (cm mockChainManager) Synced(ctx context.Context) bool { return true }
+func (cm mockChainManager) BlockAtHeight(ctx context.Context, height uint64) (types.Block, bool) {
+	if height >= uint64(len(cm.blocks)) {
+		return types.Block{}, false
+	}
+	return cm.blocks[height], true
+}
+
+type mockWallet struct {
+	Wallet
+	addr    types.Address
+	outputs []wallet.SiacoinElement
+	txns    []wallet.Transaction
+}
+
+func (w *mockWallet) OwnsAddress(addr types.Address) bool { return addr == w.addr }
+func (w *mockWallet) Transactions(since time.Time, max int) ([]wallet.Transaction, error) {
+	return w.txns, nil
+}
+func (w *mockWallet) UnspentOutputs() ([]wallet.SiacoinElement, error) { return w.outputs, nil }
+
+func TestWalletWatcher(t *testing.T) {
+	// collect the events pushed to the webhook
+	var mu sync.Mutex
+	var events []api.AlertEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event api.AlertEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+	js, _ := json.Marshal(api.AlertSettings{WebhookURL: srv.URL})
+	alerts := newAlerter(mockSettingStore{SettingAlerts: string(js)}, newEventBroadcaster(zap.NewNop().Sugar()), zap.NewNop().Sugar())
+
+	uc := types.UnlockConditions{SignaturesRequired: 1}
+	w := &mockWallet{addr: uc.UnlockHash()}
+	ww := newWalletWatcher(w, mockChainManager{}, alerts, zap.NewNop().Sugar())
+	addOutput := func(id types.Hash256, value types.Currency) {
+		sco := types.SiacoinOutput{Address: w.addr, Value: value}
+		w.outputs = append(w.outputs, wallet.SiacoinElement{SiacoinOutput: sco, ID: id})
+	}
+	addTxnOutputs := func(txn types.Transaction) {
+		for i, sco := range txn.SiacoinOutputs {
+			addOutput(types.Hash256(txn.SiacoinOutputID(i)), sco.Value)
+		}
+	}
+
+	// existing outputs don't trigger notifications
+	addOutput(types.Hash256{1}, types.Siacoins(1))
+	ww.check(context.Background())
+
+	// add a deposit, a payout and a change output
+	deposit := types.Transaction{
+		SiacoinInputs: []types.SiacoinInput{{ParentID: types.SiacoinOutputID{1}}},
+		SiacoinOutputs: []types.SiacoinOutput{
+			{Address: w.addr, Value: types.Siacoins(2)},
+			{Address: w.addr, Value: types.Siacoins(3)},
+		},
+	}
+	spend := types.Transaction{
+		SiacoinInputs:  []types.SiacoinInput{{UnlockConditions: uc}},
+		SiacoinOutputs: []types.SiacoinOutput{{Address: w.addr, Value: types.Siacoins(6)}},
+	}
+	addTxnOutputs(deposit)
+	addTxnOutputs(spend)
+	addOutput(types.Hash256(types.FileContractID{1}.ValidOutputID(0)), types.Siacoins(4))
+	w.txns = []wallet.Transaction{{Raw: deposit, ID: deposit.ID()}, {Raw: spend, ID: spend.ID()}}
+	ww.check(context.Background())
+	alerts.Shutdown()
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %v", len(events))
+	}
+	var payout, dep int
+	for _, e := range events {
+		if e.Event != api.AlertEventNotified {
+			t.Fatalf("unexpected event %v", e.Event)
+		}
+		switch e.Alert.ID {
+		case notificationIDContractPayout:
+			payout++
+			if !strings.Contains(e.Alert.Message, types.Siacoins(4).String()) {
+				t.Fatalf("unexpected payout message %v", e.Alert.Message)
+			}
+		case notificationIDWalletDeposit:
+			dep++
+			if !strings.Contains(e.Alert.Message, types.Siacoins(5).String()) {
+				t.Fatalf("unexpected deposit message %v", e.Alert.Message)
+			}
+		}
+	}
+	if payout != 1 || dep != 1 {
+		t.Fatalf("unexpected events %v", events)
+	}
+}
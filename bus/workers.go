@@ -0,0 +1,217 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.sia.tech/jape"
+	"go.sia.tech/renterd/api"
+)
+
+const (
+	// workerHeartbeatTimeout is the time after which a worker that didn't
+	// register again is considered unhealthy.
+	workerHeartbeatTimeout = 3 * time.Minute
+
+	// routePresignValidity is the validity of the presigned URLs downloads
+	// are redirected to.
+	routePresignValidity = 10 * time.Minute
+
+	// routePresignTimeout is the timeout for presigning a download with the
+	// worker it's routed to.
+	routePresignTimeout = 10 * time.Second
+)
+
+var (
+	// errWorkerNotFound is returned if an unknown worker is removed.
+	errWorkerNotFound = errors.New("worker not found")
+
+	// errNoHealthyWorker is returned if a request can't be routed because
+	// no healthy worker with the required capability is registered.
+	errNoHealthyWorker = errors.New("no healthy worker available")
+)
+
+type registeredWorker struct {
+	api.WorkerInfo
+
+	password   string
+	failed     bool // set if the worker couldn't be reached when routing a request
+	lastRouted time.Time
+}
+
+func (rw *registeredWorker) healthy() bool {
+	return !rw.failed && time.Since(rw.LastHeartbeat) < workerHeartbeatTimeout
+}
+
+func (rw *registeredWorker) can(capability string) bool {
+	for _, c := range rw.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// A workerRegistry keeps track of the workers that registered with the bus and
+// picks the worker requests are routed to. Registrations are kept in memory,
+// workers register again periodically.
+type workerRegistry struct {
+	mu      sync.Mutex
+	workers map[string]*registeredWorker
+}
+
+func newWorkerRegistry() *workerRegistry {
+	return &workerRegistry{
+		workers: make(map[string]*registeredWorker),
+	}
+}
+
+// Register adds the worker or refreshes its registration, marking it healthy
+// again.
+func (wr *workerRegistry) Register(req api.WorkerRegisterRequest) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	now := time.Now()
+	rw, ok := wr.workers[req.ID]
+	if !ok || rw.Address != req.Address {
+		rw = &registeredWorker{WorkerInfo: api.WorkerInfo{ID: req.ID, Registered: now}}
+		wr.workers[req.ID] = rw
+	}
+	rw.Address = req.Address
+	rw.Capabilities = append([]string(nil), req.Capabilities...)
+	rw.LastHeartbeat = now
+	rw.password = req.Password
+	rw.failed = false
+}
+
+// Remove removes the worker with the given id.
+func (wr *workerRegistry) Remove(id string) bool {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	_, ok := wr.workers[id]
+	delete(wr.workers, id)
+	return ok
+}
+
+// Workers returns the registered workers sorted by id.
+func (wr *workerRegistry) Workers() []api.WorkerInfo {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	workers := make([]api.WorkerInfo, 0, len(wr.workers))
+	for _, rw := range wr.workers {
+		info := rw.WorkerInfo
+		info.Capabilities = append([]string(nil), rw.Capabilities...)
+		info.Healthy = rw.healthy()
+		workers = append(workers, info)
+	}
+	sort.Slice(workers, func(i, j int) bool {
+		return workers[i].ID < workers[j].ID
+	})
+	return workers
+}
+
+// pick picks the healthy worker with the given capability that was picked
+// least recently. Since requests are redirected to the worker, the bus doesn't
+// know when they are done, so the requests are spread evenly instead.
+func (wr *workerRegistry) pick(capability string) (id, address, password string, ok bool) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	var picked *registeredWorker
+	for _, rw := range wr.workers {
+		if !rw.healthy() || !rw.can(capability) {
+			continue
+		}
+		if picked == nil || rw.lastRouted.Before(picked.lastRouted) {
+			picked = rw
+		}
+	}
+	if picked == nil {
+		return "", "", "", false
+	}
+	picked.lastRouted = time.Now()
+	return picked.ID, picked.Address, picked.password, true
+}
+
+// markFailed marks the worker as unhealthy until it registers again.
+func (wr *workerRegistry) markFailed(id string) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	if rw, ok := wr.workers[id]; ok {
+		rw.failed = true
+	}
+}
+
+func (b *bus) workersHandlerGET(jc jape.Context) {
+	jc.Encode(b.workers.Workers())
+}
+
+func (b *bus) workersRegisterHandlerPOST(jc jape.Context) {
+	var req api.WorkerRegisterRequest
+	if jc.Decode(&req) != nil {
+		return
+	} else if req.ID == "" {
+		jc.Error(errors.New("worker id can not be empty"), http.StatusBadRequest)
+		return
+	} else if u, err := url.Parse(req.Address); err != nil || u.Scheme == "" || u.Host == "" {
+		jc.Error(fmt.Errorf("invalid worker address %q", req.Address), http.StatusBadRequest)
+		return
+	}
+	b.workers.Register(req)
+}
+
+func (b *bus) workerIDHandlerDELETE(jc jape.Context) {
+	if !b.workers.Remove(jc.PathParam("id")) {
+		jc.Error(errWorkerNotFound, http.StatusNotFound)
+	}
+}
+
+func (b *bus) routeObjectsKeyHandlerGET(jc jape.Context) {
+	b.routeObjectRequest(jc, api.WorkerCapabilityDownload)
+}
+
+func (b *bus) routeObjectsKeyHandlerPUT(jc jape.Context) {
+	b.routeObjectRequest(jc, api.WorkerCapabilityUpload)
+}
+
+// routeObjectRequest redirects an object request to one of the healthy workers
+// with the given capability, the object's data doesn't pass through the bus.
+// Downloads are redirected to a URL presigned by the worker, so the client
+// doesn't need the worker's credentials. Uploads are redirected as is, the
+// client has to authenticate with the worker.
+func (b *bus) routeObjectRequest(jc jape.Context, capability string) {
+	id, address, password, ok := b.workers.pick(capability)
+	if !ok {
+		jc.Error(errNoHealthyWorker, http.StatusServiceUnavailable)
+		return
+	}
+	address = strings.TrimSuffix(address, "/")
+	key := strings.TrimPrefix(jc.PathParam("key"), "/")
+
+	var location string
+	if capability == api.WorkerCapabilityDownload {
+		ctx, cancel := context.WithTimeout(jc.Request.Context(), routePresignTimeout)
+		defer cancel()
+		var resp api.PresignResponse
+		wc := jape.Client{BaseURL: address, Password: password}
+		if err := wc.WithContext(ctx).POST("/presign", api.PresignRequest{Path: key, Validity: api.ParamDuration(routePresignValidity)}, &resp); err != nil {
+			if jc.Request.Context().Err() == nil {
+				b.workers.markFailed(id)
+			}
+			b.logger.Warnw("failed to route request to worker", "worker", id, "key", key, "error", err)
+			jc.Error(fmt.Errorf("couldn't route request to worker %v: %w", id, err), http.StatusBadGateway)
+			return
+		}
+		location = address + resp.URL
+	} else {
+		u := url.URL{Path: "/objects/" + key, RawQuery: jc.Request.URL.RawQuery}
+		location = address + u.String()
+	}
+	http.Redirect(jc.ResponseWriter, jc.Request, location, http.StatusTemporaryRedirect)
+}
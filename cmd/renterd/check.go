@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/bus"
+	"go.sia.tech/renterd/internal/node"
+)
+
+// runCheck runs 'renterd check', it checks the consistency of a running bus'
+// database and optionally repairs the inconsistencies that are safe to repair.
+func runCheck(args []string) {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	busAddr := fs.String("bus", "http://"+node.Network().HTTPAddr+"/api/bus", "URL of the bus' API")
+	repair := fs.Bool("repair", false, "repair the inconsistencies that can be repaired without losing data")
+	fs.Parse(args)
+
+	c := bus.NewClient(*busAddr, getAPIPassword())
+	var report api.ConsistencyReport
+	var err error
+	if *repair {
+		report, err = c.RepairConsistency(context.Background())
+	} else {
+		report, err = c.CheckConsistency(context.Background())
+	}
+	check("Consistency check failed:", err)
+
+	for _, c := range report.Checks {
+		switch {
+		case c.Inconsistencies == 0:
+			log.Printf("OK      %v", c.Name)
+		case c.Repaired > 0:
+			log.Printf("REPAIRED %v: %d of %d %v", c.Name, c.Repaired, c.Inconsistencies, c.Description)
+		case c.Repairable:
+			log.Printf("FAILED  %v: %d %v (repairable)", c.Name, c.Inconsistencies, c.Description)
+		default:
+			log.Printf("FAILED  %v: %d %v", c.Name, c.Inconsistencies, c.Description)
+		}
+	}
+	if !report.Consistent() {
+		os.Exit(1)
+	}
+}
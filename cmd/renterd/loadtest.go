@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"go.sia.tech/renterd/bus"
+	"go.sia.tech/renterd/internal/loadtest"
+	"go.sia.tech/renterd/internal/node"
+	"go.sia.tech/renterd/worker"
+)
+
+// runLoadTest runs 'renterd loadtest', it generates load against a running
+// worker and prints a report of the observed performance and spending.
+func runLoadTest(args []string) {
+	fs := flag.NewFlagSet("loadtest", flag.ExitOnError)
+	workerAddr := fs.String("worker", "http://"+node.Network().HTTPAddr+"/api/worker", "URL of the worker's API")
+	busAddr := fs.String("bus", "http://"+node.Network().HTTPAddr+"/api/bus", "URL of the bus' API the spending is fetched from, empty to skip reporting the spending")
+	sizes := fs.String("sizes", "4MiB:3,40MiB:1", "comma separated distribution of object sizes, every size is optionally followed by its relative weight")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	var cfg loadtest.Config
+	fs.DurationVar(&cfg.Duration, "duration", time.Minute, "duration of the test, 0 to only limit the number of operations")
+	fs.IntVar(&cfg.Operations, "operations", 0, "maximum number of operations, 0 for no limit")
+	fs.IntVar(&cfg.Concurrency, "concurrency", 4, "number of concurrent operations")
+	fs.Float64Var(&cfg.Rate, "rate", 0, "maximum number of operations started per second, 0 for no limit")
+	fs.Float64Var(&cfg.DownloadRatio, "downloadRatio", 0.5, "fraction of operations that download a previously uploaded object")
+	fs.StringVar(&cfg.Prefix, "prefix", fmt.Sprintf("loadtest/%d/", time.Now().Unix()), "path prefix of the uploaded objects")
+	fs.BoolVar(&cfg.Keep, "keep", false, "keep the uploaded objects after the test")
+	fs.Parse(args)
+
+	var err error
+	cfg.Sizes, err = loadtest.ParseSizes(*sizes)
+	check("Invalid sizes:", err)
+	check("Invalid config:", cfg.Validate())
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	pw := getAPIPassword()
+	var b loadtest.Bus
+	if *busAddr != "" {
+		b = bus.NewClient(*busAddr, pw)
+	}
+	log.Printf("Running load test against %v", *workerAddr)
+	report, err := loadtest.Run(ctx, cfg, worker.NewClient(*workerAddr, pw), b)
+	check("Load test failed:", err)
+
+	if *asJSON {
+		js, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(js))
+		return
+	}
+	log.Printf("Duration: %v", report.Duration.Round(time.Millisecond))
+	printOpStats := func(name string, s loadtest.OpStats) {
+		log.Printf("%v: %d ok, %d failed, %.2f MiB/s, p50 %v, p90 %v, p99 %v, max %v", name, s.Count-s.Failed, s.Failed, s.Throughput/(1<<20), s.P50.Round(time.Millisecond), s.P90.Round(time.Millisecond), s.P99.Round(time.Millisecond), s.Max.Round(time.Millisecond))
+	}
+	printOpStats("Uploads", report.Uploads)
+	printOpStats("Downloads", report.Downloads)
+	if s := report.Spending; s != nil {
+		log.Printf("Spending: upload %v, download %v, fund account %v", s.Upload, s.Download, s.FundAccount)
+	}
+	for _, err := range report.Errors {
+		log.Println("Error:", err)
+	}
+}
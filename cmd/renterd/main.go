@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -15,9 +18,10 @@ import (
 	"time"
 
 	"go.sia.tech/core/types"
-	"go.sia.tech/jape"
 	"go.sia.tech/renterd/autopilot"
 	"go.sia.tech/renterd/bus"
+	"go.sia.tech/renterd/internal/audit"
+	"go.sia.tech/renterd/internal/auth"
 	"go.sia.tech/renterd/internal/node"
 	"go.sia.tech/renterd/internal/stores"
 	"go.sia.tech/renterd/internal/tracing"
@@ -37,6 +41,10 @@ const (
 	// minutes.  That's why we assume 30 seconds to be more than frequent enough
 	// to refill an account when it's due for another refill.
 	defaultAccountRefillInterval = 30 * time.Second
+
+	// tracingSettingsRefreshInterval is the interval at which the sampling
+	// rate is refetched from the bus' tracing settings.
+	tracingSettingsRefreshInterval = 10 * time.Second
 )
 
 var (
@@ -46,7 +54,6 @@ var (
 
 	// fetched once, then cached
 	apiPassword *string
-	walletKey   *types.PrivateKey
 )
 
 func check(context string, err error) {
@@ -75,25 +82,85 @@ func getAPIPassword() string {
 	return *apiPassword
 }
 
-func getWalletKey() types.PrivateKey {
-	if walletKey == nil {
-		phrase := os.Getenv("RENTERD_WALLET_SEED")
-		if phrase != "" {
-			fmt.Println("Using RENTERD_WALLET_SEED environment variable")
-		} else {
-			fmt.Print("Enter wallet seed: ")
-			pw, err := term.ReadPassword(int(os.Stdin.Fd()))
-			check("Could not read seed phrase:", err)
-			fmt.Println()
-			phrase = string(pw)
-		}
-		key, err := wallet.KeyFromPhrase(phrase)
-		if err != nil {
-			log.Fatal(err)
-		}
-		walletKey = &key
+func getSeedPhrase() string {
+	phrase := os.Getenv("RENTERD_WALLET_SEED")
+	if phrase != "" {
+		fmt.Println("Using RENTERD_WALLET_SEED environment variable")
+	} else {
+		fmt.Print("Enter wallet seed: ")
+		pw, err := term.ReadPassword(int(os.Stdin.Fd()))
+		check("Could not read seed phrase:", err)
+		fmt.Println()
+		phrase = string(pw)
+	}
+	return phrase
+}
+
+func getWalletPassphrase() string {
+	passphrase := os.Getenv("RENTERD_WALLET_PASSPHRASE")
+	if passphrase != "" {
+		fmt.Println("Using RENTERD_WALLET_PASSPHRASE environment variable")
+	} else {
+		fmt.Print("Enter wallet passphrase: ")
+		pw, err := term.ReadPassword(int(os.Stdin.Fd()))
+		check("Could not read passphrase:", err)
+		fmt.Println()
+		passphrase = string(pw)
+	}
+	return passphrase
+}
+
+// encryptedSeedPath returns the path of the encrypted wallet seed.
+func encryptedSeedPath(dir string) string {
+	return filepath.Join(dir, "wallet", node.EncryptedSeedFile)
+}
+
+// getWalletPhrase reads the wallet's seed phrase, decrypting it if it's stored
+// encrypted. Unlike the API password it isn't cached since the caller drops it
+// once the bus and worker derived what they need from it.
+func getWalletPhrase(dir string) string {
+	var phrase string
+	if encrypted, err := os.ReadFile(encryptedSeedPath(dir)); err == nil {
+		phrase, err = wallet.DecryptSeedPhrase(encrypted, getWalletPassphrase())
+		check("Could not decrypt seed phrase:", err)
+	} else if os.IsNotExist(err) {
+		phrase = getSeedPhrase()
+	} else {
+		check("Could not read encrypted seed:", err)
 	}
-	return *walletKey
+	return phrase
+}
+
+// getSecretFromEnv returns the hex encoded 32 byte secret in the given
+// environment variable, or nil if it's not set.
+func getSecretFromEnv(env string) *[32]byte {
+	s := os.Getenv(env)
+	if s == "" {
+		return nil
+	}
+	fmt.Printf("Using %s environment variable\n", env)
+	b, err := hex.DecodeString(s)
+	if err == nil && len(b) != 32 {
+		err = errors.New("expected 32 bytes")
+	}
+	check("Invalid "+env+":", err)
+	var secret [32]byte
+	copy(secret[:], b)
+	return &secret
+}
+
+// parseWalletAddress parses the address or public key of a wallet whose seed
+// the bus doesn't hold.
+func parseWalletAddress(s string) (*types.PublicKey, *types.Address, error) {
+	var pk types.PublicKey
+	if err := pk.UnmarshalText([]byte(s)); err == nil {
+		return &pk, nil, nil
+	}
+	addr, err := types.ParseAddress(s)
+	if err != nil {
+		return nil, nil, fmt.Errorf("expected an address or public key, got %q", s)
+	}
+	return nil, &addr, nil
 }
 
 type currencyVar types.Currency
@@ -158,23 +225,57 @@ func main() {
 		enabled bool
 		node.AutopilotConfig
 	}
-
-	apiAddr := flag.String("http", "localhost:9980", "address to serve API on")
+	var jwtCfg auth.JWTConfig
+	var loggerCfg node.LoggerConfig
+
+	network := flag.String("network", node.Network().Name, "network to run on, either 'mainnet' or 'zen', renterd has to be built with -tags='testnet' to run on the Zen testnet - can be overwritten using the RENTERD_NETWORK environment variable")
+	apiAddr := flag.String("http", node.Network().HTTPAddr, "address to serve API on")
+	tlsCertFile := flag.String("http.tlsCert", "", "path to the TLS certificate used to serve the API over HTTPS")
+	tlsKeyFile := flag.String("http.tlsKey", "", "path to the TLS key used to serve the API over HTTPS")
+	acmeDomains := flag.String("http.acmeDomains", "", "comma separated list of domains to automatically provision TLS certificates for using ACME, the API needs to be reachable on port 443 for the TLS-ALPN challenge")
+	acmeEmail := flag.String("http.acmeEmail", "", "contact email passed to the ACME provider")
+	flag.StringVar(&jwtCfg.JWKSURL, "http.jwksURL", "", "URL of the JSON Web Key Set used to validate bearer tokens, e.g. the jwks_uri of an OIDC provider - HS256 tokens can be validated by setting RENTERD_JWT_SECRET instead")
+	flag.StringVar(&jwtCfg.Issuer, "http.jwtIssuer", "", "if set, bearer tokens are required to be issued by this issuer")
+	flag.StringVar(&jwtCfg.Audience, "http.jwtAudience", "", "if set, bearer tokens are required to contain this audience")
+	flag.StringVar(&jwtCfg.IdentityClaim, "http.jwtIdentityClaim", "sub", "claim of the bearer token used as the caller's identity in the audit log")
 	tracingEnabled := flag.Bool("tracing-enabled", false, "Enables tracing through OpenTelemetry. If RENTERD_TRACING_ENABLED is set, it overwrites the CLI flag's value. Tracing can be configured using the standard OpenTelemetry environment variables. https://github.com/open-telemetry/opentelemetry-specification/blob/v1.8.0/specification/protocol/exporter.md")
+	var tracingCfg tracing.Config
+	flag.StringVar(&tracingCfg.Endpoint, "tracing.endpoint", "", "URL of the OTLP endpoint traces are exported to - can be overwritten using the RENTERD_TRACING_ENDPOINT environment variable or the bus' tracing settings")
+	flag.StringVar(&tracingCfg.ServiceName, "tracing.serviceName", "renterd", "service name traces are attributed to - can be overwritten using the RENTERD_TRACING_SERVICE_NAME environment variable or the bus' tracing settings")
+	flag.Float64Var(&tracingCfg.SamplingRate, "tracing.samplingRate", 1, "fraction of traces that are sampled - can be overwritten using the RENTERD_TRACING_SAMPLING_RATE environment variable or the bus' tracing settings")
 	dir := flag.String("dir", ".", "directory to store node state in")
+	flag.StringVar(&loggerCfg.Format, "log.format", node.LogFormatHuman, "format of the console log output, either 'human' or 'json' - can be overwritten using the RENTERD_LOG_FORMAT environment variable")
+	logLevel := flag.String("log.level", "debug", "initial log level of all modules, the level of individual modules can be changed at runtime through the /api/logging/levels endpoint - can be overwritten using the RENTERD_LOG_LEVEL environment variable")
 	flag.StringVar(&busCfg.remoteAddr, "bus.remoteAddr", "", "URL of remote bus service - can be overwritten using RENTERD_BUS_REMOTE_ADDR environment variable")
 	flag.StringVar(&busCfg.apiPassword, "bus.apiPassword", "", "API password for remote bus service - can be overwritten using RENTERD_BUS_API_PASSWORD environment variable")
 	flag.BoolVar(&busCfg.Bootstrap, "bus.bootstrap", true, "bootstrap the gateway and consensus modules")
-	flag.StringVar(&busCfg.GatewayAddr, "bus.gatewayAddr", ":9981", "address to listen on for Sia peer connections")
+	flag.StringVar(&busCfg.GatewayAddr, "bus.gatewayAddr", node.Network().GatewayAddr, "address to listen on for Sia peer connections")
+	flag.StringVar(&busCfg.ConsensusSource, "bus.consensusSource", "", "URL of another bus' API the bus follows the chain through instead of running its own gateway and consensus set, its API password is read from the RENTERD_BUS_CONSENSUS_SOURCE_PASSWORD environment variable - can be overwritten using the RENTERD_BUS_CONSENSUS_SOURCE environment variable")
+	flag.DurationVar(&busCfg.SlowQueryThreshold, "bus.slowQueryThreshold", 200*time.Millisecond, "duration after which a database query is logged as slow")
+	flag.DurationVar(&busCfg.SlabHealthInterval, "bus.slabHealthInterval", 10*time.Minute, "interval at which the health of all slabs is recomputed, 0 disables it")
+	flag.IntVar(&busCfg.SlabHealthBatchSize, "bus.slabHealthBatchSize", 1000, "number of slabs whose health is recomputed per batch")
+	flag.BoolVar(&busCfg.WalletWatchOnly, "bus.walletWatchOnly", false, "only track the wallet's address, transactions are queued for external signing - requires bus.walletAddress")
+	flag.StringVar(&busCfg.WalletSigner, "bus.walletSigner", "", "URL or unix socket (unix://path) of an external signer that signs the wallet's transactions - requires bus.walletAddress to be the wallet's public key")
+	walletAddr := flag.String("bus.walletAddress", "", "address or public key (ed25519:<hex>) of the wallet if the bus is watch-only or uses an external signer, the bus then doesn't need the wallet seed but the DB secret has to be set using the RENTERD_DB_SECRET environment variable")
 	flag.BoolVar(&workerCfg.enabled, "worker.enabled", true, "enable/disable creating a worker - can be overwritten using the RENTERD_WORKER_ENABLED environment variable")
 	flag.DurationVar(&workerCfg.BusFlushInterval, "worker.busFlushInterval", 5*time.Second, "time after which the worker flushes buffered data to bus for persisting")
-	flag.StringVar(&workerCfg.WorkerConfig.ID, "worker.id", "worker", "unique identifier of worker used internally - can be overwritten using the RENTERD_WORKER_ID environment variable")
+	flag.StringVar(&workerCfg.ID, "worker.id", "worker", "unique identifier of worker used internally - can be overwritten using the RENTERD_WORKER_ID environment variable")
 	flag.StringVar(&workerCfg.remoteAddrs, "worker.remoteAddrs", "", "URL of remote worker service(s). Multiple addresses can be provided by separating them with a semicolon. Can be overwritten using RENTERD_WORKER_REMOTE_ADDRS environment variable")
 	flag.StringVar(&workerCfg.apiPassword, "worker.apiPassword", "", "API password for remote worker service")
 	flag.DurationVar(&workerCfg.SessionReconnectTimeout, "worker.sessionReconnectTimeout", 10*time.Second, "the maximum of time reconnecting a session is allowed to take")
 	flag.DurationVar(&workerCfg.SessionTTL, "worker.sessionTTL", 2*time.Minute, "the time a host session is valid for before reconnecting")
-	flag.DurationVar(&workerCfg.DownloadSectorTimeout, "worker.downloadSectorTimeout", 3*time.Second, "timeout applied to sector downloads when downloading a slab")
-	flag.DurationVar(&workerCfg.UploadSectorTimeout, "worker.uploadSectorTimeout", 5*time.Second, "timeout applied to sector uploads when uploading a slab")
+	flag.DurationVar(&workerCfg.SessionIdleTimeout, "worker.sessionIdleTimeout", 10*time.Minute, "the time a host session may stay unused before it is closed, idle sessions are health checked every session TTL")
+	flag.DurationVar(&workerCfg.DownloadSectorTimeout, "worker.downloadSectorTimeout", 3*time.Second, "timeout applied to sector downloads when downloading a slab, once enough downloads from a host were observed its timeout is derived from its latencies and capped by this value")
+	flag.DurationVar(&workerCfg.UploadSectorTimeout, "worker.uploadSectorTimeout", 5*time.Second, "timeout applied to sector uploads when uploading a slab, once enough uploads to a host were observed its timeout is derived from its latencies and capped by this value")
+	flag.Uint64Var(&workerCfg.DownloadOverdrive, "worker.downloadOverdrive", 0, "number of sectors requested on top of the minimum required to recover a slab, the slowest requests are cancelled once enough sectors were downloaded")
+	flag.IntVar(&workerCfg.DownloadPrefetchSlabs, "worker.downloadPrefetchSlabs", 2, "number of slabs that are downloaded ahead of the slab being streamed to the client, 0 disables prefetching")
+	flag.Uint64Var(&workerCfg.DownloadPrefetchMemory, "worker.downloadPrefetchMemory", 1<<28, "maximum amount of memory in bytes reserved for prefetching the slabs of a single download")
+	flag.Uint64Var(&workerCfg.UploadMemoryBudget, "worker.uploadMemoryBudget", 0, "maximum amount of memory in bytes used to buffer the slabs of uploads, slabs exceeding the budget are spilled to disk, 0 means no limit")
+	flag.StringVar(&workerCfg.UploadSpillDir, "worker.uploadSpillDir", "", "directory that uploads are spilled to once the upload memory budget is exhausted, defaults to the system's temporary directory")
+	flag.StringVar(&workerCfg.DownloadExportDir, "worker.downloadExportDir", "", "directory download jobs write objects to, paths of download jobs are relative to it - writing to the worker's filesystem is disabled if it's not set")
+	flag.Uint64Var(&workerCfg.UploadOverdrive, "worker.uploadOverdrive", 5, "number of slow sector uploads per slab that are raced against another host, whichever upload finishes last is cancelled and cleaned up")
+	flag.StringVar(&workerCfg.ExternalAddr, "worker.externalAddr", "", "URL the bus reaches the worker's API at, the worker registers with the bus under this address so requests to the bus' /route endpoints can be redirected to it - it has to be reachable by the clients - defaults to the worker's local API address - can be overwritten using the RENTERD_WORKER_EXTERNAL_ADDR environment variable")
+	flag.BoolVar(&workerCfg.RandomObjectKeys, "worker.randomObjectKeys", false, "use random object encryption keys instead of deriving them from the worker key and a nonce stored with the object")
 	flag.DurationVar(&autopilotCfg.AccountsRefillInterval, "autopilot.accountRefillInterval", defaultAccountRefillInterval, "interval at which the autopilot checks the workers' accounts balance and refills them if necessary")
 	flag.BoolVar(&autopilotCfg.enabled, "autopilot.enabled", true, "enable/disable the autopilot - can be overwritten using the RENTERD_AUTOPILOT_ENABLED environment variable")
 	flag.DurationVar(&autopilotCfg.Heartbeat, "autopilot.heartbeat", 10*time.Minute, "interval at which autopilot loop runs")
@@ -182,11 +283,12 @@ func main() {
 	flag.DurationVar(&autopilotCfg.ScannerInterval, "autopilot.scannerInterval", 24*time.Hour, "interval at which hosts are scanned")
 	flag.Uint64Var(&autopilotCfg.ScannerBatchSize, "autopilot.scannerBatchSize", 1000, "size of the batch with which hosts are scanned")
 	flag.Uint64Var(&autopilotCfg.ScannerNumThreads, "autopilot.scannerNumThreads", 100, "number of threads that scan hosts")
+	flag.StringVar(&autopilotCfg.HostDataProvider, "autopilot.hostDataProvider", "", "URL of an external host-data API the autopilot pulls benchmark and score data about hosts from, the scores are only factored into host scoring if the autopilot config's externalScoreWeight is set - can be overwritten using the RENTERD_AUTOPILOT_HOST_DATA_PROVIDER environment variable")
 	flag.DurationVar(&nodeCfg.shutdownTimeout, "node.shutdownTimeout", 5*time.Minute, "the timeout applied to the node shutdown")
 
 	flag.Parse()
 
-	log.Println("renterd v0.1.0")
+	log.Printf("renterd v0.1.0 (%v)", node.Network().Name)
 	if flag.Arg(0) == "version" {
 		log.Println("Commit:", githash)
 		log.Println("Build Date:", builddate)
@@ -194,30 +296,68 @@ func main() {
 	} else if flag.Arg(0) == "seed" {
 		log.Println("Seed phrase:", wallet.NewSeedPhrase())
 		return
+	} else if flag.Arg(0) == "check" {
+		runCheck(flag.Args()[1:])
+		return
+	} else if flag.Arg(0) == "loadtest" {
+		runLoadTest(flag.Args()[1:])
+		return
+	} else if flag.Arg(0) == "recover" {
+		runRecover(flag.Args()[1:])
+		return
+	} else if flag.Arg(0) == "rescan" {
+		runRescan(flag.Args()[1:])
+		return
+	} else if flag.Arg(0) == "encryptseed" {
+		phrase := getSeedPhrase()
+		_, err := wallet.KeyFromPhrase(phrase)
+		check("Invalid seed phrase:", err)
+		check("Could not create wallet dir:", os.MkdirAll(filepath.Dir(encryptedSeedPath(*dir)), 0700))
+		check("Could not write encrypted seed:", os.WriteFile(encryptedSeedPath(*dir), wallet.EncryptSeedPhrase(phrase, getWalletPassphrase()), 0600))
+		log.Println("Encrypted seed written to", encryptedSeedPath(*dir))
+		return
 	}
 
 	// Overwrite flags from environment if set.
+	parseEnvVar("RENTERD_NETWORK", network)
+	if err := node.CheckNetwork(*network); err != nil {
+		log.Fatal(err)
+	}
 	parseEnvVar("RENTERD_BUS_REMOTE_ADDR", &busCfg.remoteAddr)
 	parseEnvVar("RENTERD_BUS_API_PASSWORD", &busCfg.apiPassword)
+	parseEnvVar("RENTERD_BUS_CONSENSUS_SOURCE", &busCfg.ConsensusSource)
+	parseEnvVar("RENTERD_BUS_CONSENSUS_SOURCE_PASSWORD", &busCfg.ConsensusSourcePassword)
+	parseEnvVar("RENTERD_AUTOPILOT_HOST_DATA_PROVIDER", &autopilotCfg.HostDataProvider)
 	parseEnvVar("RENTERD_WORKER_REMOTE_ADDRS", &workerCfg.remoteAddrs)
 	parseEnvVar("RENTERD_WORKER_API_PASSWORD", &workerCfg.apiPassword)
 	parseEnvVar("RENTERD_WORKER_ENABLED", &workerCfg.enabled)
 	parseEnvVar("RENTERD_WORKER_ID", &workerCfg.ID)
+	parseEnvVar("RENTERD_WORKER_EXTERNAL_ADDR", &workerCfg.ExternalAddr)
 	parseEnvVar("RENTERD_AUTOPILOT_ENABLED", &autopilotCfg.enabled)
 	parseEnvVar("RENTERD_TRACING_ENABLED", &tracingEnabled)
+	parseEnvVar("RENTERD_LOG_FORMAT", &loggerCfg.Format)
+	parseEnvVar("RENTERD_LOG_LEVEL", logLevel)
+	if err := loggerCfg.Level.UnmarshalText([]byte(*logLevel)); err != nil {
+		log.Fatal("invalid log level", err)
+	}
+	parseEnvVar("RENTERD_TRACING_ENDPOINT", &tracingCfg.Endpoint)
+	parseEnvVar("RENTERD_TRACING_SERVICE_NAME", &tracingCfg.ServiceName)
+	parseEnvVar("RENTERD_TRACING_SAMPLING_RATE", &tracingCfg.SamplingRate)
+	busCfg.DBSecret = getSecretFromEnv("RENTERD_DB_SECRET")
+	if *walletAddr != "" {
+		pk, addr, err := parseWalletAddress(*walletAddr)
+		check("Invalid wallet address:", err)
+		busCfg.WalletPublicKey, busCfg.WalletAddress = pk, addr
+	}
+	workerKey := getSecretFromEnv("RENTERD_WORKER_KEY")
+	if secret := os.Getenv("RENTERD_JWT_SECRET"); secret != "" {
+		fmt.Println("Using RENTERD_JWT_SECRET environment variable")
+		jwtCfg.Secret = []byte(secret)
+	}
 
 	var autopilotShutdownFn func(context.Context) error
 	var shutdownFns []func(context.Context) error
 
-	// Init tracing.
-	if *tracingEnabled {
-		shutdownFn, err := tracing.Init(workerCfg.ID)
-		if err != nil {
-			log.Fatal("failed to init tracing", err)
-		}
-		shutdownFns = append(shutdownFns, shutdownFn)
-	}
-
 	if busCfg.remoteAddr != "" && workerCfg.remoteAddrs != "" && !autopilotCfg.enabled {
 		log.Fatal("remote bus, remote worker, and no autopilot -- nothing to do!")
 	}
@@ -234,31 +374,78 @@ func main() {
 	shutdownFns = append(shutdownFns, func(_ context.Context) error { return l.Close() })
 	*apiAddr = "http://" + l.Addr().String()
 
-	auth := jape.BasicAuth(getAPIPassword())
+	// serve the API over TLS if configured, in which case the in-process
+	// clients talk to the API over a separate loopback listener since the
+	// certificate is unlikely to be valid for the listener's address
+	var internalListener net.Listener
+	tlsCfg, err := tlsConfig(*tlsCertFile, *tlsKeyFile, *acmeDomains, *acmeEmail, *dir)
+	if err != nil {
+		log.Fatal("failed to load TLS config", err)
+	} else if tlsCfg != nil {
+		l = tls.NewListener(l, tlsCfg)
+		internalListener, err = net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			log.Fatal("failed to create internal listener", err)
+		}
+		shutdownFns = append(shutdownFns, func(_ context.Context) error { return internalListener.Close() })
+		*apiAddr = "http://" + internalListener.Addr().String()
+	}
+
+	// the API password is always accepted since the in-process clients rely
+	// on it, bearer tokens are accepted in addition if configured
+	authenticator := auth.Password(getAPIPassword())
+	if jwtCfg.JWKSURL != "" || len(jwtCfg.Secret) > 0 {
+		jwt, err := auth.NewJWT(jwtCfg)
+		if err != nil {
+			log.Fatal("failed to create JWT authenticator", err)
+		}
+		authenticator = auth.Any(authenticator, jwt)
+	}
+	apiAuth := auth.Middleware(authenticator)
 	mux := treeMux{
 		h:   createUIHandler(),
 		sub: make(map[string]treeMux),
 	}
 
 	// Create logger.
-	renterdLog := filepath.Join(*dir, "renterd.log")
-	logger, closeFn, err := node.NewLogger(renterdLog)
+	loggerCfg.Path = filepath.Join(*dir, "renterd.log")
+	logger, logLevels, closeFn, err := node.NewLogger(loggerCfg)
 	if err != nil {
 		log.Fatal("failed to create logger", err)
 	}
 	shutdownFns = append(shutdownFns, closeFn)
+	mux.sub["/api/logging"] = treeMux{h: apiAuth(logLevels.Handler())}
+
+	// the wallet's seed phrase is read at most once, the bus and worker
+	// derive what they need from it when they're created and it's dropped
+	// afterwards
+	var walletPhrase string
+	loadWalletPhrase := func() string {
+		if walletPhrase == "" {
+			walletPhrase = getWalletPhrase(*dir)
+		}
+		return walletPhrase
+	}
 
 	busAddr, busPassword := busCfg.remoteAddr, busCfg.apiPassword
 	if busAddr == "" {
-		b, shutdownFn, err := node.NewBus(busCfg.BusConfig, *dir, getWalletKey(), logger)
+		// the seed phrase is only required if the bus signs the wallet's
+		// transactions itself
+		var phrase string
+		if !busCfg.WalletWatchOnly && busCfg.WalletSigner == "" {
+			phrase = loadWalletPhrase()
+		} else if busCfg.DBSecret == nil {
+			log.Fatal("the DB secret has to be set using RENTERD_DB_SECRET if the wallet is watch-only or uses an external signer")
+		}
+		b, shutdownFn, err := node.NewBus(busCfg.BusConfig, *dir, phrase, logger)
 		if err != nil {
 			log.Fatal("failed to create bus, err: ", err)
 		}
 		shutdownFns = append(shutdownFns, shutdownFn)
 
-		mux.sub["/api/bus"] = treeMux{h: auth(b)}
 		busAddr = *apiAddr + "/api/bus"
 		busPassword = getAPIPassword()
+		mux.sub["/api/bus"] = treeMux{h: apiAuth(audit.Handler("bus", bus.NewClient(busAddr, busPassword), logger, b))}
 	} else {
 		fmt.Println("connecting to remote bus at", busAddr)
 	}
@@ -268,15 +455,32 @@ func main() {
 	workerAddrs, workerPassword := workerCfg.remoteAddrs, workerCfg.apiPassword
 	if workerAddrs == "" {
 		if workerCfg.enabled {
-			w, shutdownFn, err := node.NewWorker(workerCfg.WorkerConfig, bc, getWalletKey(), logger)
+			workerAddr := *apiAddr + "/api/worker"
+			workerPassword = getAPIPassword()
+			if workerCfg.ExternalAddr == "" {
+				workerCfg.ExternalAddr = workerAddr
+			}
+			workerCfg.ExternalPassword = workerPassword
+
+			if workerKey == nil {
+				walletKey, err := wallet.KeyFromPhrase(loadWalletPhrase())
+				if err != nil {
+					log.Fatal(err)
+				}
+				key := node.WorkerKey(walletKey)
+				for i := range walletKey {
+					walletKey[i] = 0
+				}
+				workerKey = &key
+			}
+			w, shutdownFn, err := node.NewWorker(workerCfg.WorkerConfig, bc, *workerKey, logger)
 			if err != nil {
 				log.Fatal("failed to create worker", err)
 			}
 			shutdownFns = append(shutdownFns, shutdownFn)
 
-			mux.sub["/api/worker"] = treeMux{h: auth(w)}
-			workerAddr := *apiAddr + "/api/worker"
-			workerPassword = getAPIPassword()
+			workerAuth := node.WorkerAuth(*workerKey, apiAuth)
+			mux.sub["/api/worker"] = treeMux{h: workerAuth(audit.Handler("worker", bc, logger, w))}
 			workers = append(workers, worker.NewClient(workerAddr, workerPassword))
 		}
 	} else {
@@ -289,6 +493,10 @@ func main() {
 		}
 	}
 
+	// the bus' wallet keeps its own copy of the seed phrase, which is cleared
+	// when the wallet is locked, the worker only keeps the key derived from it
+	walletPhrase = ""
+
 	autopilotErr := make(chan error, 1)
 	if autopilotCfg.enabled {
 		autopilotDir := filepath.Join(*dir, "autopilot")
@@ -310,12 +518,45 @@ func main() {
 		autopilotShutdownFn = shutdownFn
 
 		go func() { autopilotErr <- runFn() }()
-		mux.sub["/api/autopilot"] = treeMux{h: auth(ap)}
+		mux.sub["/api/autopilot"] = treeMux{h: apiAuth(audit.Handler("autopilot", bc, logger, ap))}
 	}
 
-	srv := &http.Server{Handler: mux}
+	// cancel the context of all requests on shutdown, otherwise long-lived
+	// requests like event streams would block the shutdown
+	srvCtx, srvCancel := context.WithCancel(context.Background())
+	srv := &http.Server{Handler: mux, BaseContext: func(net.Listener) context.Context { return srvCtx }}
+	srv.RegisterOnShutdown(srvCancel)
 	go srv.Serve(l)
-	log.Println("api: Listening on", l.Addr())
+	if internalListener != nil {
+		go srv.Serve(internalListener)
+		log.Println("api: Listening on", l.Addr(), "(TLS)")
+	} else {
+		log.Println("api: Listening on", l.Addr())
+	}
+
+	// Init tracing once the API is served, the bus' tracing settings take
+	// precedence over the CLI flags and environment variables if they were
+	// set.
+	if *tracingEnabled {
+		if ts, err := bc.TracingSettings(context.Background()); err == nil {
+			tracingCfg = tracing.Config{
+				Endpoint:     ts.Endpoint,
+				ServiceName:  ts.ServiceName,
+				SamplingRate: ts.SamplingRate,
+			}
+		}
+		shutdownFn, err := tracing.Init(tracingCfg, workerCfg.ID)
+		if err != nil {
+			log.Fatal("failed to init tracing", err)
+		}
+		shutdownFns = append(shutdownFns, shutdownFn)
+
+		// keep the sampling rate in sync with the bus, it might be remote
+		shutdownFns = append(shutdownFns, tracing.WatchSamplingRate(tracingSettingsRefreshInterval, func(ctx context.Context) (float64, error) {
+			ts, err := bc.TracingSettings(ctx)
+			return ts.SamplingRate, err
+		}))
+	}
 
 	syncerAddress, err := bc.SyncerAddress(context.Background())
 	if err != nil {
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/internal/node"
+	"go.sia.tech/renterd/internal/recovery"
+	"go.sia.tech/renterd/internal/stores"
+	"go.sia.tech/renterd/worker"
+	glogger "gorm.io/gorm/logger"
+)
+
+// runRecover runs 'renterd recover', it recovers the given contracts and the
+// roots of their sectors from the hosts into a new database. The worker has to
+// run with the seed of the renter the contracts belong to.
+func runRecover(args []string) {
+	fs := flag.NewFlagSet("recover", flag.ExitOnError)
+	workerAddr := fs.String("worker", "http://"+node.Network().HTTPAddr+"/api/worker", "URL of the worker's API")
+	contractsPath := fs.String("contracts", "", "path to a JSON file with the contracts to recover, in the format returned by the bus' /contracts endpoints")
+	dbPath := fs.String("db", "", "path of the SQLite database to recover the contracts into, it must not exist yet")
+	concurrency := fs.Int("concurrency", 10, "number of contracts recovered at a time")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Parse(args)
+
+	if *contractsPath == "" || *dbPath == "" {
+		log.Fatal("Both -contracts and -db are required")
+	} else if _, err := os.Stat(*dbPath); err == nil {
+		log.Fatalf("Database %v already exists", *dbPath)
+	}
+
+	b, err := os.ReadFile(*contractsPath)
+	check("Could not read contracts:", err)
+	var contracts []api.ContractMetadata
+	check("Could not decode contracts:", json.Unmarshal(b, &contracts))
+
+	// keys are never stored in the recovered database, so it doesn't need
+	// a secret
+	db, _, err := stores.NewSQLStore(stores.NewSQLiteConnection(*dbPath), true, 0, nil, glogger.Discard)
+	check("Could not create database:", err)
+	defer db.Close()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	log.Printf("Recovering %d contracts using %v", len(contracts), *workerAddr)
+	report, err := recovery.Recover(ctx, worker.NewClient(*workerAddr, getAPIPassword()), db, contracts, *concurrency)
+	check("Recovery failed:", err)
+
+	if *asJSON {
+		js, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(js))
+		return
+	}
+	for _, res := range report.Contracts {
+		if res.Error != "" {
+			log.Printf("FAILED    %v: %v", res.ContractID, res.Error)
+		} else {
+			log.Printf("RECOVERED %v: %d sectors", res.ContractID, res.Sectors)
+		}
+	}
+	log.Printf("Recovered %d of %d contracts with %d sectors into %v", report.Recovered, len(report.Contracts), report.Sectors, *dbPath)
+}
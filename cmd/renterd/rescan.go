@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/bus"
+	"go.sia.tech/renterd/internal/node"
+	"go.sia.tech/renterd/worker"
+)
+
+// rescanHostsBatchSize is the number of hosts fetched from the bus at a time.
+const rescanHostsBatchSize = 1000
+
+// runRescan runs 'renterd rescan', it rescans the blockchain for the contracts
+// formed with the renter keys of a running worker and adds the ones that can
+// still be revised to the bus. The worker has to run with the seed of the
+// renter the contracts belong to.
+func runRescan(args []string) {
+	fs := flag.NewFlagSet("rescan", flag.ExitOnError)
+	busAddr := fs.String("bus", "http://"+node.Network().HTTPAddr+"/api/bus", "URL of the bus' API")
+	workerAddr := fs.String("worker", "http://"+node.Network().HTTPAddr+"/api/worker", "URL of the worker's API")
+	fs.Parse(args)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	pw := getAPIPassword()
+	b := bus.NewClient(*busAddr, pw)
+	w := worker.NewClient(*workerAddr, pw)
+
+	// contracts only reveal the hash of the renter and host keys, so the
+	// renter keys of all known hosts are derived upfront
+	var hostKeys []types.PublicKey
+	for offset := 0; ; offset += rescanHostsBatchSize {
+		hosts, err := b.Hosts(ctx, offset, rescanHostsBatchSize)
+		check("Could not fetch hosts:", err)
+		for _, h := range hosts {
+			hostKeys = append(hostKeys, h.PublicKey)
+		}
+		if len(hosts) < rescanHostsBatchSize {
+			break
+		}
+	}
+	keys, err := w.ContractKeys(ctx, hostKeys)
+	check("Could not derive renter keys:", err)
+
+	job, err := b.AddJob(ctx, api.JobTypeRescan, api.RescanJobParams{Keys: keys})
+	check("Could not start rescan:", err)
+	log.Printf("Rescanning the blockchain for contracts with %d hosts", len(hostKeys))
+
+	for job.State == api.JobStatePending || job.State == api.JobStateRunning {
+		select {
+		case <-ctx.Done():
+			check("Could not cancel rescan:", b.CancelJob(context.Background(), job.ID))
+			log.Fatal("Rescan cancelled")
+		case <-time.After(time.Second):
+		}
+		job, err = b.Job(ctx, job.ID)
+		check("Could not fetch rescan progress:", err)
+		log.Printf("Progress: %.1f%%", job.Progress*100)
+	}
+	if job.State != api.JobStateDone {
+		log.Fatalf("Rescan %v: %v", job.State, job.Error)
+	}
+
+	var res api.RescanJobResult
+	check("Could not decode rescan result:", json.Unmarshal(job.Result, &res))
+	log.Printf("Found %d contracts up to height %d, %d of them were added", res.Found, res.Height, res.Added)
+
+	// the contracts aren't pruned until the roots of their sectors are
+	// restored from their hosts, this includes contracts added by previous
+	// rescans whose hosts were offline
+	var restored, failed int
+	for _, fcid := range res.Contracts {
+		if _, err := b.ContractRoots(ctx, fcid); err == nil || !strings.Contains(err.Error(), api.ErrContractRootsUnknown.Error()) {
+			continue
+		}
+		if err := restoreContractRoots(ctx, b, w, fcid); err != nil {
+			log.Printf("Could not restore the roots of contract %v: %v", fcid, err)
+			failed++
+			continue
+		}
+		restored++
+	}
+	log.Printf("Restored the roots of %d contracts", restored)
+	if failed > 0 {
+		log.Fatalf("Could not restore the roots of %d contracts, they aren't pruned until 'renterd rescan' succeeds for them", failed)
+	}
+}
+
+// restoreContractRoots fetches the roots of the sectors stored in a rescanned
+// contract from its host and stores them in the bus.
+func restoreContractRoots(ctx context.Context, b *bus.Client, w *worker.Client, fcid types.FileContractID) error {
+	c, err := b.Contract(ctx, fcid)
+	if err != nil {
+		return err
+	}
+	resp, err := w.RHPContractRoots(ctx, c.ID, c.HostKey, c.HostIP)
+	if err != nil {
+		return err
+	}
+	return b.RestoreContractRoots(ctx, fcid, resp.Roots)
+}
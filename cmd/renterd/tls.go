@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// tlsConfig returns the TLS config used to serve the API. If neither a
+// certificate nor ACME domains are configured, nil is returned and the API is
+// served over plain HTTP.
+func tlsConfig(certFile, keyFile, acmeDomains, acmeEmail, dir string) (*tls.Config, error) {
+	if acmeDomains != "" {
+		if certFile != "" || keyFile != "" {
+			return nil, errors.New("ACME can't be combined with a TLS certificate")
+		}
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(strings.Split(acmeDomains, ",")...),
+			Cache:      autocert.DirCache(filepath.Join(dir, "acme")),
+			Email:      acmeEmail,
+		}
+		return m.TLSConfig(), nil
+	}
+
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	} else if certFile == "" || keyFile == "" {
+		return nil, errors.New("both a TLS certificate and key need to be provided")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
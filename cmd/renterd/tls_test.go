@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestCert returns a PEM encoded self-signed certificate for the given
+// domain and its PEM encoded key.
+func newTestCert(t *testing.T, domain string) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return
+}
+
+func TestTLSConfigCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certPEM, keyPEM := newTestCert(t, "example.com")
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	} else if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the API is served over plain HTTP without a certificate
+	if cfg, err := tlsConfig("", "", "", "", dir); err != nil {
+		t.Fatal(err)
+	} else if cfg != nil {
+		t.Fatal("expected no TLS config")
+	}
+
+	// assert the certificate and key are loaded
+	cfg, err := tlsConfig(certFile, keyFile, "", "", dir)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(cfg.Certificates) != 1 || cfg.MinVersion != tls.VersionTLS12 {
+		t.Fatal("unexpected TLS config", cfg)
+	}
+	leaf, err := x509.ParseCertificate(cfg.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	} else if leaf.VerifyHostname("example.com") != nil {
+		t.Fatal("unexpected certificate", leaf.DNSNames)
+	}
+
+	// assert the certificate requires its key
+	if _, err := tlsConfig(certFile, "", "", "", dir); err == nil || !strings.Contains(err.Error(), "both a TLS certificate and key") {
+		t.Fatal("unexpected error", err)
+	} else if _, err := tlsConfig("", keyFile, "", "", dir); err == nil || !strings.Contains(err.Error(), "both a TLS certificate and key") {
+		t.Fatal("unexpected error", err)
+	}
+
+	// assert a key that doesn't match the certificate is rejected
+	_, otherKeyPEM := newTestCert(t, "example.com")
+	otherKeyFile := filepath.Join(dir, "other.pem")
+	if err := os.WriteFile(otherKeyFile, otherKeyPEM, 0600); err != nil {
+		t.Fatal(err)
+	} else if _, err := tlsConfig(certFile, otherKeyFile, "", "", dir); err == nil {
+		t.Fatal("expected error")
+	} else if _, err := tlsConfig(filepath.Join(dir, "missing.pem"), keyFile, "", "", dir); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// assert ACME can't be combined with a certificate
+	for _, files := range [][2]string{{certFile, keyFile}, {certFile, ""}, {"", keyFile}} {
+		if _, err := tlsConfig(files[0], files[1], "example.com", "", dir); err == nil || !strings.Contains(err.Error(), "ACME can't be combined") {
+			t.Fatal("unexpected error", err)
+		}
+	}
+}
+
+func TestTLSConfigACME(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := tlsConfig("", "", "example.com,sia.tech", "foo@example.com", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// seed the certificate cache in the node's directory, certificates are
+	// served from the cache without contacting the CA
+	certPEM, keyPEM := newTestCert(t, "example.com")
+	if err := os.MkdirAll(filepath.Join(dir, "acme"), 0700); err != nil {
+		t.Fatal(err)
+	} else if err := os.WriteFile(filepath.Join(dir, "acme", "example.com"), append(keyPEM, certPEM...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	hello := func(name string) *tls.ClientHelloInfo {
+		return &tls.ClientHelloInfo{
+			ServerName:   name,
+			CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		}
+	}
+	cert, err := cfg.GetCertificate(hello("example.com"))
+	if err != nil {
+		t.Fatal(err)
+	} else if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		t.Fatal(err)
+	} else if leaf.VerifyHostname("example.com") != nil {
+		t.Fatal("unexpected certificate", leaf.DNSNames)
+	}
+
+	// assert certificates are only requested for the configured domains
+	if _, err := cfg.GetCertificate(hello("evil.com")); err == nil || !strings.Contains(err.Error(), "not configured") {
+		t.Fatal("unexpected error", err)
+	}
+}
@@ -30,7 +30,40 @@ type ScanResult struct {
 	Settings   rhpv2.HostSettings   `json:"settings,omitempty"`
 }
 
-const InteractionTypeScan = "scan"
+const (
+	InteractionTypeScan = "scan"
+
+	// InteractionTypeUpload and InteractionTypeDownload are the types of
+	// interactions that transferred a sector to or from a host, their result
+	// is a TransferResult.
+	InteractionTypeUpload   = "upload"
+	InteractionTypeDownload = "download"
+)
+
+// TransferResult is the result of an interaction that transferred sector data
+// to or from a host.
+type TransferResult struct {
+	Error      string        `json:"error,omitempty"`
+	Bytes      uint64        `json:"bytes"`
+	Elapsed    time.Duration `json:"elapsed"`
+	Throughput float64       `json:"throughput"` // bytes per second
+}
+
+// NewTransferResult creates the result of a transfer of the given number of
+// bytes that took the given amount of time.
+func NewTransferResult(bytes uint64, elapsed time.Duration, err error) TransferResult {
+	tr := TransferResult{
+		Bytes:   bytes,
+		Elapsed: elapsed,
+	}
+	if err != nil {
+		tr.Error = err.Error()
+	}
+	if elapsed > 0 {
+		tr.Throughput = float64(bytes) / elapsed.Seconds()
+	}
+	return tr
+}
 
 // ForEachAnnouncement calls fn on each host announcement in a block.
 func ForEachAnnouncement(b types.Block, height uint64, fn func(types.PublicKey, Announcement)) {
@@ -74,6 +107,31 @@ type Interactions struct {
 
 	SuccessfulInteractions float64
 	FailedInteractions     float64
+
+	// measured transfer performance of successful sector transfers
+	Uploaded         uint64
+	UploadDuration   time.Duration
+	Downloaded       uint64
+	DownloadDuration time.Duration
+}
+
+// UploadThroughput returns the host's average measured upload throughput in
+// bytes per second, it's zero if no sectors were uploaded to the host yet.
+func (i Interactions) UploadThroughput() float64 {
+	if i.UploadDuration <= 0 {
+		return 0
+	}
+	return float64(i.Uploaded) / i.UploadDuration.Seconds()
+}
+
+// DownloadThroughput returns the host's average measured download throughput
+// in bytes per second, it's zero if no sectors were downloaded from the host
+// yet.
+func (i Interactions) DownloadThroughput() float64 {
+	if i.DownloadDuration <= 0 {
+		return 0
+	}
+	return float64(i.Downloaded) / i.DownloadDuration.Seconds()
 }
 
 type Interaction struct {
@@ -99,6 +157,24 @@ type Host struct {
 	PriceTable   *rhpv3.HostPriceTable `json:"priceTable"`
 	Settings     *rhpv2.HostSettings   `json:"settings"`
 	Interactions Interactions          `json:"interactions"`
+
+	// Group identifies the operator of the host, hosts in the same group
+	// are suspected to be run by the same operator.
+	Group string `json:"group"`
+
+	// External is the data an external host-data provider reported for the
+	// host, it's nil if no provider reported data for it.
+	External *ExternalData `json:"external,omitempty"`
+}
+
+// ExternalData contains the benchmark and score data an external host-data
+// provider reported for a host. Score is normalized to the range [0, 1], higher
+// is better.
+type ExternalData struct {
+	Provider   string             `json:"provider"`
+	Score      float64            `json:"score"`
+	Benchmarks map[string]float64 `json:"benchmarks,omitempty"`
+	Updated    time.Time          `json:"updated"`
 }
 
 // HostInfo extends the host type with a field indicating whether it is blocked or not.
@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"time"
+
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/internal/auth"
+	"go.uber.org/zap"
+)
+
+// recordTimeout is the timeout applied when recording an audit entry.
+const recordTimeout = 10 * time.Second
+
+// ignoredRoutes contains patterns of mutating routes that are not recorded per
+// module. These are high-frequency bookkeeping calls between renterd's own
+// components which would otherwise flood the audit log, e.g. the autopilot's
+// scans, account refills, migrations and audits, which are served by the
+// worker. The autopilot's own mutating routes are rare and always recorded.
+var ignoredRoutes = map[string][]string{
+	"bus": {
+		"/audit",
+		"/accounts/*/add",
+		"/accounts/*/update",
+		"/contract/*/acquire",
+		"/contract/*/release",
+		"/contracts/spending",
+		"/hosts/interactions",
+	},
+	"worker": {
+		"/rhp/scan",
+		"/rhp/fund",
+		"/rhp/pricetable",
+		"/rhp/prewarm",
+		"/rhp/registry/read",
+		"/rhp/contract/*/roots",
+		"/slab/migrate",
+		"/objects/audit",
+		"/sectors/audit",
+	},
+}
+
+// isIgnored returns true if calls to the given path aren't recorded.
+func isIgnored(module, p string) bool {
+	for _, pattern := range ignoredRoutes[module] {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// A Recorder persists audit entries.
+type Recorder interface {
+	RecordAuditEntries(ctx context.Context, entries []api.AuditEntry) error
+}
+
+// statusRecorder wraps a http.ResponseWriter to capture the response's status
+// code.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(b)
+}
+
+// isMutating returns true if the request might modify state.
+func isMutating(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	default:
+		return true
+	}
+}
+
+// Handler wraps h and records all mutating calls to the given recorder. The
+// entries are recorded asynchronously so they don't slow down the request.
+func Handler(module string, r Recorder, l *zap.Logger, h http.Handler) http.Handler {
+	logger := l.Sugar().Named("audit")
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !isMutating(req) || isIgnored(module, req.URL.Path) {
+			h.ServeHTTP(w, req)
+			return
+		}
+
+		// grab everything we need before serving the request since the handler
+		// might modify it, the identity is only ever taken from the
+		// authenticator and never from headers the caller controls
+		identity, _ := auth.Identity(req.Context())
+		entry := api.AuditEntry{
+			Timestamp: time.Now(),
+			Module:    module,
+			Method:    req.Method,
+			Path:      req.URL.Path,
+			Identity:  identity,
+			Params:    req.URL.RawQuery,
+		}
+
+		sr := &statusRecorder{ResponseWriter: w}
+		h.ServeHTTP(sr, req)
+		entry.Status = sr.status
+		if entry.Status == 0 {
+			entry.Status = http.StatusOK
+		}
+
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+			defer cancel()
+			if err := r.RecordAuditEntries(ctx, []api.AuditEntry{entry}); err != nil {
+				logger.Errorw("failed to record audit entry", "path", entry.Path, "err", err)
+			}
+		}()
+	})
+}
@@ -0,0 +1,95 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.sia.tech/renterd/api"
+	"go.uber.org/zap"
+)
+
+type mockRecorder struct {
+	mu      sync.Mutex
+	entries []api.AuditEntry
+}
+
+func (r *mockRecorder) RecordAuditEntries(_ context.Context, entries []api.AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries = append(r.entries, entries...)
+	return nil
+}
+
+func (r *mockRecorder) recorded() []api.AuditEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]api.AuditEntry(nil), r.entries...)
+}
+
+func TestHandler(t *testing.T) {
+	r := &mockRecorder{}
+	h := Handler("bus", r, zap.NewNop(), http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	serve := func(method, target string) {
+		req := httptest.NewRequest(method, target, nil)
+		req.SetBasicAuth("mallory", "password") // the username isn't an identity
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	serve(http.MethodGet, "/objects/foo")
+	serve(http.MethodPost, "/contract/abc/acquire")
+	serve(http.MethodDelete, "/objects/foo?bar=baz")
+
+	// wait for the entry to be recorded
+	var entries []api.AuditEntry
+	for i := 0; i < 100 && len(entries) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		entries = r.recorded()
+	}
+
+	// only the DELETE should have been recorded
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %v", len(entries))
+	}
+	e := entries[0]
+	if e.Module != "bus" || e.Method != http.MethodDelete || e.Path != "/objects/foo" || e.Params != "bar=baz" || e.Status != http.StatusTeapot || e.Identity != "" {
+		t.Fatalf("unexpected entry %+v", e)
+	}
+}
+
+func TestIsIgnored(t *testing.T) {
+	tests := []struct {
+		module  string
+		path    string
+		ignored bool
+	}{
+		{"bus", "/contract/abc/acquire", true},
+		{"bus", "/contract/abc/renewed", false},
+		{"bus", "/objects/foo", false},
+		{"worker", "/rhp/scan", true},
+		{"worker", "/rhp/fund", true},
+		{"worker", "/rhp/contract/abc/roots", true},
+		{"worker", "/slab/migrate", true},
+		{"worker", "/sectors/audit", true},
+		{"worker", "/rhp/form", false},
+		{"worker", "/rhp/contract/abc/prune", false},
+		{"worker", "/tokens", false},
+		{"worker", "/objects/foo", false},
+		{"autopilot", "/config", false},
+		{"autopilot", "/debug/trigger", false},
+
+		// routes are ignored per module
+		{"autopilot", "/rhp/scan", false},
+		{"worker", "/contract/abc/acquire", false},
+	}
+	for _, test := range tests {
+		if ignored := isIgnored(test.module, test.path); ignored != test.ignored {
+			t.Errorf("%v %v: expected ignored to be %v", test.module, test.path, test.ignored)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+)
+
+// ErrUnauthenticated is returned by an Authenticator if the request doesn't
+// carry any credentials it recognizes.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+type identityKey struct{}
+
+// An Authenticator authenticates API requests. It's the extension point used
+// to put external identity providers, e.g. OIDC or JWT validation, in front of
+// the bus and worker APIs.
+type Authenticator interface {
+	// Authenticate returns the identity of the caller or an error if the
+	// request isn't authenticated.
+	Authenticate(req *http.Request) (identity string, err error)
+}
+
+// AuthenticatorFunc is an adapter to allow the use of ordinary functions as
+// authenticators.
+type AuthenticatorFunc func(req *http.Request) (string, error)
+
+// Authenticate implements Authenticator.
+func (fn AuthenticatorFunc) Authenticate(req *http.Request) (string, error) {
+	return fn(req)
+}
+
+// Password returns an Authenticator that accepts requests carrying the given
+// password using HTTP basic auth. The identity is always empty, the basic auth
+// username is chosen by the caller and therefore can't identify them.
+func Password(password string) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) (string, error) {
+		_, p, ok := req.BasicAuth()
+		if !ok {
+			return "", ErrUnauthenticated
+		} else if subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+			return "", errors.New("invalid password")
+		}
+		return "", nil
+	})
+}
+
+// Any returns an Authenticator that accepts a request if any of the given
+// authenticators accepts it. They are tried in order.
+func Any(as ...Authenticator) Authenticator {
+	return AuthenticatorFunc(func(req *http.Request) (string, error) {
+		err := ErrUnauthenticated
+		for _, a := range as {
+			identity, aErr := a.Authenticate(req)
+			if aErr == nil {
+				return identity, nil
+			} else if !errors.Is(aErr, ErrUnauthenticated) {
+				err = aErr
+			}
+		}
+		return "", err
+	})
+}
+
+// Middleware returns a middleware that rejects requests which aren't
+// authenticated by a. The caller's identity is attached to the request's
+// context and can be retrieved using Identity.
+func Middleware(a Authenticator) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			identity, err := a.Authenticate(req)
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+			h.ServeHTTP(w, req.WithContext(WithIdentity(req.Context(), identity)))
+		})
+	}
+}
+
+// WithIdentity returns a copy of ctx carrying the given identity.
+func WithIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// Identity returns the identity attached to the context by Middleware.
+func Identity(ctx context.Context) (string, bool) {
+	identity, ok := ctx.Value(identityKey{}).(string)
+	return identity, ok
+}
@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func encodeSegment(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func TestMiddleware(t *testing.T) {
+	secret := []byte("secret")
+	jwt, err := NewJWT(JWTConfig{Secret: secret, Issuer: "issuer", Audience: "renterd"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs256 := func(claims map[string]interface{}) string {
+		signed := encodeSegment(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encodeSegment(claims)
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+	}
+
+	var identity string
+	h := Middleware(Any(Password("password"), jwt))(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		identity, _ = Identity(req.Context())
+	}))
+	serve := func(setAuth func(req *http.Request)) int {
+		t.Helper()
+		identity = ""
+		req := httptest.NewRequest(http.MethodPost, "/objects/foo", nil)
+		setAuth(req)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	bearer := func(token string) func(req *http.Request) {
+		return func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token) }
+	}
+
+	// no credentials
+	if code := serve(func(*http.Request) {}); code != http.StatusUnauthorized {
+		t.Fatal("unexpected status", code)
+	}
+
+	// password
+	if code := serve(func(req *http.Request) { req.SetBasicAuth("alice", "password") }); code != http.StatusOK || identity != "" {
+		t.Fatal("unexpected result", code, identity)
+	} else if code := serve(func(req *http.Request) { req.SetBasicAuth("alice", "wrong") }); code != http.StatusUnauthorized {
+		t.Fatal("unexpected status", code)
+	}
+
+	// valid token
+	claims := map[string]interface{}{
+		"sub": "bob",
+		"iss": "issuer",
+		"aud": []string{"renterd"},
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	if code := serve(bearer(hs256(claims))); code != http.StatusOK || identity != "bob" {
+		t.Fatal("unexpected result", code, identity)
+	}
+
+	// tampered token
+	token := hs256(claims)
+	if code := serve(bearer(token[:len(token)-2] + "AA")); code != http.StatusUnauthorized {
+		t.Fatal("unexpected status", code)
+	}
+
+	// expired token
+	claims["exp"] = time.Now().Add(-time.Minute).Unix()
+	if code := serve(bearer(hs256(claims))); code != http.StatusUnauthorized {
+		t.Fatal("unexpected status", code)
+	}
+
+	// token without expiry
+	delete(claims, "exp")
+	if code := serve(bearer(hs256(claims))); code != http.StatusUnauthorized {
+		t.Fatal("unexpected status", code)
+	}
+
+	// wrong audience
+	claims["exp"] = time.Now().Add(time.Hour).Unix()
+	claims["aud"] = "other"
+	if code := serve(bearer(hs256(claims))); code != http.StatusUnauthorized {
+		t.Fatal("unexpected status", code)
+	}
+
+	// unsigned token
+	unsigned := encodeSegment(map[string]string{"alg": "none"}) + "." + encodeSegment(claims) + "."
+	if code := serve(bearer(unsigned)); code != http.StatusUnauthorized {
+		t.Fatal("unexpected status", code)
+	}
+}
+
+func TestJWTJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "key1",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	}))
+	defer srv.Close()
+
+	a, err := NewJWT(JWTConfig{JWKSURL: srv.URL, IdentityClaim: "email"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs256 := func(kid string) string {
+		signed := encodeSegment(map[string]string{"alg": "RS256", "kid": kid}) + "." + encodeSegment(map[string]interface{}{"email": "carol@example.com", "exp": time.Now().Add(time.Hour).Unix()})
+		hash := sha256.Sum256([]byte(signed))
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+	}
+	authenticate := func(token string) (string, error) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return a.Authenticate(req)
+	}
+
+	if identity, err := authenticate(rs256("key1")); err != nil {
+		t.Fatal(err)
+	} else if identity != "carol@example.com" {
+		t.Fatal("unexpected identity", identity)
+	}
+	if _, err := authenticate(rs256("key2")); err == nil {
+		t.Fatal("expected error for unknown key")
+	}
+}
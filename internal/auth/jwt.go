@@ -0,0 +1,297 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// jwksFetchTimeout is the timeout applied when fetching the JSON Web Key
+	// Set.
+	jwksFetchTimeout = 10 * time.Second
+
+	// jwksMinRefreshInterval is the minimum amount of time between two
+	// fetches of the JSON Web Key Set. The set is refetched when a token is
+	// signed by an unknown key to pick up rotated keys.
+	jwksMinRefreshInterval = time.Minute
+)
+
+var errInvalidJWT = errors.New("invalid JWT")
+
+// JWTConfig configures the validation of JSON Web Tokens passed as bearer
+// tokens.
+type JWTConfig struct {
+	// Secret is the shared secret used to verify HS256 signed tokens.
+	Secret []byte
+
+	// JWKSURL is the URL of the JSON Web Key Set used to verify RS256 and
+	// ES256 signed tokens, usually the OIDC provider's jwks_uri.
+	JWKSURL string
+
+	// Issuer and Audience, if set, have to match the token's iss and aud
+	// claims.
+	Issuer   string
+	Audience string
+
+	// IdentityClaim is the claim used as the caller's identity, it defaults
+	// to "sub".
+	IdentityClaim string
+}
+
+type jwtAuthenticator struct {
+	cfg    JWTConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	lastFetch time.Time
+}
+
+// NewJWT returns an Authenticator that accepts requests carrying a valid JSON
+// Web Token in the Authorization header. Tokens without an exp claim are
+// rejected.
+func NewJWT(cfg JWTConfig) (Authenticator, error) {
+	if len(cfg.Secret) == 0 && cfg.JWKSURL == "" {
+		return nil, errors.New("either a secret or a JWKS URL is required")
+	}
+	if cfg.IdentityClaim == "" {
+		cfg.IdentityClaim = "sub"
+	}
+	return &jwtAuthenticator{
+		cfg:    cfg,
+		client: &http.Client{Timeout: jwksFetchTimeout},
+	}, nil
+}
+
+// Authenticate implements Authenticator.
+func (a *jwtAuthenticator) Authenticate(req *http.Request) (string, error) {
+	token, ok := bearerToken(req)
+	if !ok {
+		return "", ErrUnauthenticated
+	}
+	claims, err := a.verify(req.Context(), token)
+	if err != nil {
+		return "", err
+	}
+	identity, ok := claims[a.cfg.IdentityClaim].(string)
+	if !ok || identity == "" {
+		return "", fmt.Errorf("%w: missing %q claim", errInvalidJWT, a.cfg.IdentityClaim)
+	}
+	return identity, nil
+}
+
+// verify verifies the token's signature and claims and returns the claims.
+func (a *jwtAuthenticator) verify(ctx context.Context, token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errInvalidJWT
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errInvalidJWT
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	hash := sha256.Sum256(signed)
+
+	switch header.Alg {
+	case "HS256":
+		if len(a.cfg.Secret) == 0 {
+			return nil, fmt.Errorf("%w: unsupported algorithm %v", errInvalidJWT, header.Alg)
+		}
+		mac := hmac.New(sha256.New, a.cfg.Secret)
+		mac.Write(signed)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return nil, fmt.Errorf("%w: invalid signature", errInvalidJWT)
+		}
+	case "RS256", "ES256":
+		key, err := a.key(ctx, header.Kid)
+		if err != nil {
+			return nil, err
+		}
+		switch key := key.(type) {
+		case *rsa.PublicKey:
+			if header.Alg != "RS256" || rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], sig) != nil {
+				return nil, fmt.Errorf("%w: invalid signature", errInvalidJWT)
+			}
+		case *ecdsa.PublicKey:
+			if header.Alg != "ES256" || len(sig) != 64 {
+				return nil, fmt.Errorf("%w: invalid signature", errInvalidJWT)
+			}
+			r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+			if !ecdsa.Verify(key, hash[:], r, s) {
+				return nil, fmt.Errorf("%w: invalid signature", errInvalidJWT)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported algorithm %v", errInvalidJWT, header.Alg)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	now := float64(time.Now().Unix())
+	if exp, ok := claims["exp"].(float64); !ok {
+		return nil, fmt.Errorf("%w: missing \"exp\" claim", errInvalidJWT)
+	} else if now >= exp {
+		return nil, fmt.Errorf("%w: token expired", errInvalidJWT)
+	} else if nbf, ok := claims["nbf"].(float64); ok && now < nbf {
+		return nil, fmt.Errorf("%w: token not valid yet", errInvalidJWT)
+	} else if a.cfg.Issuer != "" && claims["iss"] != a.cfg.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer", errInvalidJWT)
+	} else if a.cfg.Audience != "" && !hasAudience(claims["aud"], a.cfg.Audience) {
+		return nil, fmt.Errorf("%w: unexpected audience", errInvalidJWT)
+	}
+	return claims, nil
+}
+
+// key returns the key with the given id from the JSON Web Key Set, the set is
+// refetched if the key is unknown.
+func (a *jwtAuthenticator) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	if a.cfg.JWKSURL == "" {
+		return nil, fmt.Errorf("%w: no JWKS configured", errInvalidJWT)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if key, ok := a.keys[kid]; ok {
+		return key, nil
+	} else if time.Since(a.lastFetch) < jwksMinRefreshInterval {
+		return nil, fmt.Errorf("%w: unknown key %q", errInvalidJWT, kid)
+	}
+
+	keys, err := a.fetchKeys(ctx)
+	a.lastFetch = time.Now()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	a.keys = keys
+	if key, ok := a.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown key %q", errInvalidJWT, kid)
+}
+
+// fetchKeys fetches the JSON Web Key Set and returns the supported keys by
+// their id.
+func (a *jwtAuthenticator) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.cfg.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %v", resp.StatusCode)
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Crv string `json:"crv"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range jwks.Keys {
+		switch {
+		case k.Kty == "RSA":
+			n, nErr := base64.RawURLEncoding.DecodeString(k.N)
+			e, eErr := base64.RawURLEncoding.DecodeString(k.E)
+			if nErr != nil || eErr != nil || len(e) > 4 {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case k.Kty == "EC" && k.Crv == "P-256":
+			x, xErr := base64.RawURLEncoding.DecodeString(k.X)
+			y, yErr := base64.RawURLEncoding.DecodeString(k.Y)
+			if xErr != nil || yErr != nil {
+				continue
+			}
+			pk := &ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}
+			if !pk.Curve.IsOnCurve(pk.X, pk.Y) {
+				continue
+			}
+			keys[k.Kid] = pk
+		}
+	}
+	return keys, nil
+}
+
+// bearerToken returns the bearer token from the request's Authorization
+// header.
+func bearerToken(req *http.Request) (string, bool) {
+	h := req.Header.Get("Authorization")
+	if len(h) < 7 || !strings.EqualFold(h[:7], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(h[7:]), true
+}
+
+// decodeSegment decodes a base64url encoded JSON segment of a token.
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return errInvalidJWT
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return errInvalidJWT
+	}
+	return nil
+}
+
+// hasAudience returns true if the aud claim, which is either a string or an
+// array of strings, contains the given audience.
+func hasAudience(aud interface{}, audience string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,423 @@
+// Package loadtest generates load against a running worker by uploading and
+// downloading synthetic objects, it reports the observed throughput, latencies
+// and spending to help with capacity planning and catching performance
+// regressions.
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"lukechampine.com/frand"
+)
+
+type (
+	// A Worker uploads and downloads objects.
+	Worker interface {
+		UploadObject(ctx context.Context, r io.Reader, name string) error
+		DownloadObject(ctx context.Context, w io.Writer, path string) error
+		DeleteObject(ctx context.Context, name string) error
+	}
+
+	// A Bus reports the renter's spending.
+	Bus interface {
+		Spending(ctx context.Context) (api.PeriodSpending, error)
+	}
+)
+
+// A Size is an object size and the relative weight with which it's picked.
+type Size struct {
+	Bytes  uint64
+	Weight uint64
+}
+
+// Config configures a load test.
+type Config struct {
+	// Duration is the duration of the test, Operations is the maximum number
+	// of operations. The test stops once either is reached, at least one
+	// of them has to be set.
+	Duration   time.Duration
+	Operations int
+
+	// Concurrency is the number of operations in flight at a time, Rate
+	// limits the number of operations started per second if it's set.
+	Concurrency int
+	Rate        float64
+
+	// Sizes is the distribution of the sizes of the uploaded objects.
+	Sizes []Size
+
+	// DownloadRatio is the fraction of the operations that download one of
+	// the objects uploaded during the test.
+	DownloadRatio float64
+
+	// Prefix is the path prefix of the uploaded objects, unless Keep is set
+	// they are deleted after the test.
+	Prefix string
+	Keep   bool
+}
+
+// Validate returns an error if the config is not considered valid.
+func (cfg Config) Validate() error {
+	if cfg.Duration <= 0 && cfg.Operations <= 0 {
+		return errors.New("either Duration or Operations must be set")
+	} else if cfg.Concurrency < 1 {
+		return errors.New("Concurrency must be at least 1")
+	} else if cfg.Rate < 0 {
+		return errors.New("Rate can't be negative")
+	} else if cfg.DownloadRatio < 0 || cfg.DownloadRatio > 1 {
+		return errors.New("DownloadRatio must be between 0 and 1")
+	} else if len(cfg.Sizes) == 0 {
+		return errors.New("at least one size is required")
+	}
+	for _, s := range cfg.Sizes {
+		if s.Bytes == 0 || s.Weight == 0 {
+			return errors.New("sizes must have a positive size and weight")
+		}
+	}
+	return nil
+}
+
+type (
+	// OpStats contains the statistics of one type of operation.
+	OpStats struct {
+		Count  int           `json:"count"`
+		Failed int           `json:"failed"`
+		Bytes  uint64        `json:"bytes"`
+		P50    time.Duration `json:"p50"`
+		P90    time.Duration `json:"p90"`
+		P99    time.Duration `json:"p99"`
+		Max    time.Duration `json:"max"`
+
+		// Throughput is the number of bytes transferred per second by
+		// the successful operations.
+		Throughput float64 `json:"throughput"`
+	}
+
+	// Report is the outcome of a load test. Spending is the change of the
+	// renter's spending during the test, it's only set if a bus was used.
+	Report struct {
+		Duration  time.Duration       `json:"duration"`
+		Uploads   OpStats             `json:"uploads"`
+		Downloads OpStats             `json:"downloads"`
+		Spending  *api.PeriodSpending `json:"spending,omitempty"`
+		Errors    []string            `json:"errors,omitempty"`
+	}
+)
+
+// maxReportedErrors is the maximum number of distinct errors in a report.
+const maxReportedErrors = 10
+
+// ErrCorruptDownload is recorded when a downloaded object doesn't match the
+// uploaded data.
+var ErrCorruptDownload = errors.New("downloaded data doesn't match uploaded data")
+
+type uploadedObject struct {
+	path string
+	size uint64
+	hash [32]byte
+}
+
+type result struct {
+	download bool
+	size     uint64
+	latency  time.Duration
+	err      error
+}
+
+type tester struct {
+	cfg Config
+	w   Worker
+
+	mu      sync.Mutex
+	seq     int
+	objects []uploadedObject
+	results []result
+}
+
+// Run runs a load test against the given worker, b can be nil in which case
+// the spending is not reported.
+func Run(ctx context.Context, cfg Config, w Worker, b Bus) (Report, error) {
+	if err := cfg.Validate(); err != nil {
+		return Report{}, err
+	}
+	t := &tester{cfg: cfg, w: w}
+
+	var before api.PeriodSpending
+	if b != nil {
+		var err error
+		if before, err = b.Spending(ctx); err != nil {
+			return Report{}, fmt.Errorf("failed to fetch spending: %w", err)
+		}
+	}
+
+	runCtx := ctx
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+
+	// start the operations, limited by the rate and the number of operations
+	start := time.Now()
+	ops := make(chan struct{})
+	go func() {
+		defer close(ops)
+		var tick <-chan time.Time
+		if cfg.Rate > 0 {
+			ticker := time.NewTicker(time.Duration(float64(time.Second) / cfg.Rate))
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for i := 0; cfg.Operations == 0 || i < cfg.Operations; i++ {
+			if tick != nil {
+				select {
+				case <-runCtx.Done():
+					return
+				case <-tick:
+				}
+			}
+			select {
+			case <-runCtx.Done():
+				return
+			case ops <- struct{}{}:
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range ops {
+				t.runOp(runCtx)
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	report := t.report(elapsed)
+	if b != nil {
+		after, err := b.Spending(ctx)
+		if err != nil {
+			return Report{}, fmt.Errorf("failed to fetch spending: %w", err)
+		}
+		spending := spendingDiff(before, after)
+		report.Spending = &spending
+	}
+
+	// clean up the uploaded objects
+	if !cfg.Keep {
+		for _, o := range t.objects {
+			if err := w.DeleteObject(ctx, o.path); err != nil {
+				return report, fmt.Errorf("failed to delete object %v: %w", o.path, err)
+			}
+		}
+	}
+	return report, nil
+}
+
+func (t *tester) runOp(ctx context.Context) {
+	t.mu.Lock()
+	download := len(t.objects) > 0 && frand.Float64() < t.cfg.DownloadRatio
+	var o uploadedObject
+	if download {
+		o = t.objects[frand.Intn(len(t.objects))]
+	} else {
+		o.path = fmt.Sprintf("%s%d", t.cfg.Prefix, t.seq)
+		o.size = pickSize(t.cfg.Sizes)
+		t.seq++
+	}
+	t.mu.Unlock()
+
+	var err error
+	start := time.Now()
+	if download {
+		h := sha256.New()
+		err = t.w.DownloadObject(ctx, h, o.path)
+		if err == nil && !bytes.Equal(h.Sum(nil), o.hash[:]) {
+			err = ErrCorruptDownload
+		}
+	} else {
+		h := sha256.New()
+		r := io.TeeReader(io.LimitReader(frand.Reader, int64(o.size)), h)
+		err = t.w.UploadObject(ctx, r, o.path)
+		copy(o.hash[:], h.Sum(nil))
+	}
+	latency := time.Since(start)
+
+	// operations that were interrupted by the end of the test are ignored
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !download && err == nil {
+		t.objects = append(t.objects, o)
+	}
+	t.results = append(t.results, result{download, o.size, latency, err})
+}
+
+func (t *tester) report(elapsed time.Duration) Report {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var uploads, downloads []result
+	errs := make(map[string]struct{})
+	r := Report{Duration: elapsed}
+	for _, res := range t.results {
+		if res.err != nil {
+			if _, ok := errs[res.err.Error()]; !ok && len(errs) < maxReportedErrors {
+				errs[res.err.Error()] = struct{}{}
+				r.Errors = append(r.Errors, res.err.Error())
+			}
+		}
+		if res.download {
+			downloads = append(downloads, res)
+		} else {
+			uploads = append(uploads, res)
+		}
+	}
+	r.Uploads = opStats(uploads, elapsed)
+	r.Downloads = opStats(downloads, elapsed)
+	return r
+}
+
+func opStats(results []result, elapsed time.Duration) (s OpStats) {
+	var latencies []time.Duration
+	for _, r := range results {
+		s.Count++
+		if r.err != nil {
+			s.Failed++
+			continue
+		}
+		s.Bytes += r.size
+		latencies = append(latencies, r.latency)
+	}
+	if len(latencies) == 0 {
+		return
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	s.P50 = percentile(latencies, 0.5)
+	s.P90 = percentile(latencies, 0.9)
+	s.P99 = percentile(latencies, 0.99)
+	s.Max = latencies[len(latencies)-1]
+	if elapsed > 0 {
+		s.Throughput = float64(s.Bytes) / elapsed.Seconds()
+	}
+	return
+}
+
+// percentile returns the p-th percentile of the given sorted latencies using
+// the nearest-rank method.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+func pickSize(sizes []Size) uint64 {
+	var total uint64
+	for _, s := range sizes {
+		total += s.Weight
+	}
+	n := frand.Uint64n(total)
+	for _, s := range sizes {
+		if n < s.Weight {
+			return s.Bytes
+		}
+		n -= s.Weight
+	}
+	panic("unreachable")
+}
+
+// spendingDiff returns the spending between before and after, if the spending
+// period changed in between the spending of the new period is returned.
+func spendingDiff(before, after api.PeriodSpending) api.PeriodSpending {
+	if before.PeriodStart != after.PeriodStart {
+		return after
+	}
+	sub := func(a, b types.Currency) types.Currency {
+		if a.Cmp(b) < 0 {
+			return types.ZeroCurrency
+		}
+		return a.Sub(b)
+	}
+	return api.PeriodSpending{
+		PeriodStart: after.PeriodStart,
+		Formation:   sub(after.Formation, before.Formation),
+		Upload:      sub(after.Upload, before.Upload),
+		Download:    sub(after.Download, before.Download),
+		FundAccount: sub(after.FundAccount, before.FundAccount),
+	}
+}
+
+// ParseSizes parses a size distribution of the form '4MiB:3,40MiB:1', the
+// weight is optional and defaults to 1.
+func ParseSizes(s string) ([]Size, error) {
+	var sizes []Size
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		size := Size{Weight: 1}
+		if i := strings.LastIndexByte(part, ':'); i != -1 {
+			w, err := strconv.ParseUint(part[i+1:], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid weight in '%v': %w", part, err)
+			}
+			size.Weight = w
+			part = part[:i]
+		}
+		b, err := ParseBytes(part)
+		if err != nil {
+			return nil, err
+		}
+		size.Bytes = b
+		sizes = append(sizes, size)
+	}
+	return sizes, nil
+}
+
+// ParseBytes parses a number of bytes with an optional unit, e.g. '4MiB' or
+// '1.5GB'.
+func ParseBytes(s string) (uint64, error) {
+	units := []struct {
+		suffix string
+		factor float64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+		{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+		{"B", 1},
+	}
+	s = strings.TrimSpace(s)
+	factor := 1.0
+	for _, u := range units {
+		if strings.HasSuffix(s, u.suffix) {
+			s, factor = strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), u.factor
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid size '%v'", s)
+	}
+	return uint64(f * factor), nil
+}
@@ -0,0 +1,148 @@
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+type mockWorker struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	corrupt bool
+}
+
+func (w *mockWorker) UploadObject(ctx context.Context, r io.Reader, name string) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.objects[name] = data
+	return nil
+}
+
+func (w *mockWorker) DownloadObject(ctx context.Context, dst io.Writer, path string) error {
+	w.mu.Lock()
+	data, ok := w.objects[path]
+	corrupt := w.corrupt
+	w.mu.Unlock()
+	if !ok {
+		return errors.New("object not found")
+	} else if corrupt {
+		data = append([]byte{1}, data...)
+	}
+	_, err := dst.Write(data)
+	return err
+}
+
+func (w *mockWorker) DeleteObject(ctx context.Context, name string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.objects, name)
+	return nil
+}
+
+type mockBus struct {
+	calls int
+}
+
+func (b *mockBus) Spending(ctx context.Context) (api.PeriodSpending, error) {
+	b.calls++
+	return api.PeriodSpending{Upload: types.Siacoins(uint32(b.calls))}, nil
+}
+
+func TestRun(t *testing.T) {
+	w := &mockWorker{objects: make(map[string][]byte)}
+	b := &mockBus{}
+	cfg := Config{
+		Operations:    100,
+		Concurrency:   4,
+		Sizes:         []Size{{Bytes: 100, Weight: 1}, {Bytes: 1000, Weight: 1}},
+		DownloadRatio: 0.5,
+		Prefix:        "loadtest/",
+	}
+	r, err := Run(context.Background(), cfg, w, b)
+	if err != nil {
+		t.Fatal(err)
+	} else if r.Uploads.Count+r.Downloads.Count != cfg.Operations {
+		t.Fatal("unexpected number of operations", r.Uploads.Count, r.Downloads.Count)
+	} else if r.Uploads.Count == 0 || r.Downloads.Count == 0 {
+		t.Fatal("expected both uploads and downloads")
+	} else if r.Uploads.Failed != 0 || r.Downloads.Failed != 0 || len(r.Errors) != 0 {
+		t.Fatal("unexpected failures", r.Errors)
+	} else if r.Uploads.Bytes < uint64(r.Uploads.Count)*100 {
+		t.Fatal("unexpected number of bytes", r.Uploads.Bytes)
+	} else if r.Uploads.P50 > r.Uploads.P99 || r.Uploads.P99 > r.Uploads.Max {
+		t.Fatal("unexpected percentiles", r.Uploads)
+	} else if r.Spending == nil || !r.Spending.Upload.Equals(types.Siacoins(1)) {
+		t.Fatal("unexpected spending", r.Spending)
+	} else if len(w.objects) != 0 {
+		t.Fatal("objects weren't deleted", len(w.objects))
+	}
+
+	// corrupt downloads should be reported
+	w.corrupt = true
+	cfg.Keep = true
+	r, err = Run(context.Background(), cfg, w, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if r.Downloads.Failed != r.Downloads.Count {
+		t.Fatal("expected all downloads to fail", r.Downloads)
+	} else if !reflect.DeepEqual(r.Errors, []string{ErrCorruptDownload.Error()}) {
+		t.Fatal("unexpected errors", r.Errors)
+	} else if r.Spending != nil {
+		t.Fatal("unexpected spending")
+	} else if len(w.objects) != r.Uploads.Count {
+		t.Fatal("objects should have been kept", len(w.objects))
+	}
+
+	// the duration should limit the test
+	cfg = Config{Duration: 100 * time.Millisecond, Concurrency: 1, Rate: 20, Sizes: cfg.Sizes}
+	start := time.Now()
+	if r, err := Run(context.Background(), cfg, w, nil); err != nil {
+		t.Fatal(err)
+	} else if time.Since(start) > time.Second {
+		t.Fatal("test took too long")
+	} else if n := r.Uploads.Count + r.Downloads.Count; n == 0 || n > 3 {
+		t.Fatal("unexpected number of operations", n)
+	}
+}
+
+func TestParseSizes(t *testing.T) {
+	sizes, err := ParseSizes("4MiB:3, 40MiB:1,1.5KB,100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []Size{{4 << 20, 3}, {40 << 20, 1}, {1500, 1}, {100, 1}}
+	if !reflect.DeepEqual(sizes, exp) {
+		t.Fatal("unexpected sizes", sizes)
+	}
+	for _, s := range []string{"4XB", "-1", "4MiB:x"} {
+		if _, err := ParseSizes(s); err == nil {
+			t.Fatal("expected error for", s)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, time.Duration(i))
+	}
+	if p := percentile(latencies, 0.5); p != 50 {
+		t.Fatal("unexpected p50", p)
+	} else if p := percentile(latencies, 0.99); p != 99 {
+		t.Fatal("unexpected p99", p)
+	} else if p := percentile(latencies[:1], 0.5); p != 1 {
+		t.Fatal("unexpected p50", p)
+	}
+}
@@ -0,0 +1,393 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"gitlab.com/NebulousLabs/encoding"
+	"go.sia.tech/core/consensus"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/bus"
+	"go.sia.tech/siad/modules"
+	siasync "go.sia.tech/siad/sync"
+	stypes "go.sia.tech/siad/types"
+	"go.uber.org/zap"
+)
+
+const (
+	// remoteConsensusPollInterval is the interval at which a bus in external
+	// consensus mode polls its chain source for new consensus changes.
+	remoteConsensusPollInterval = 5 * time.Second
+
+	// remoteConsensusBatchSize is the number of consensus changes that are
+	// fetched from the chain source per request.
+	remoteConsensusBatchSize = 100
+
+	// remoteBlockCacheSize is the number of recent blocks a bus in external
+	// consensus mode keeps in memory, they're used to estimate fees.
+	remoteBlockCacheSize = 144
+)
+
+// encodedConsensusChange is the encoding of a consensus change that is sent to
+// buses in external consensus mode, it omits the fields of a consensus change
+// that can't be encoded.
+type encodedConsensusChange struct {
+	ID                         modules.ConsensusChangeID
+	BlockHeight                stypes.BlockHeight
+	RevertedBlocks             []stypes.Block
+	AppliedBlocks              []stypes.Block
+	RevertedDiffs              []modules.ConsensusChangeDiffs
+	AppliedDiffs               []modules.ConsensusChangeDiffs
+	Diffs                      modules.ConsensusChangeDiffs
+	ChildTarget                stypes.Target
+	MinimumValidChildTimestamp stypes.Timestamp
+	Synced                     bool
+}
+
+func encodeConsensusChange(cc modules.ConsensusChange) []byte {
+	return encoding.Marshal(encodedConsensusChange{
+		ID:                         cc.ID,
+		BlockHeight:                cc.BlockHeight,
+		RevertedBlocks:             cc.RevertedBlocks,
+		AppliedBlocks:              cc.AppliedBlocks,
+		RevertedDiffs:              cc.RevertedDiffs,
+		AppliedDiffs:               cc.AppliedDiffs,
+		Diffs:                      cc.ConsensusChangeDiffs,
+		ChildTarget:                cc.ChildTarget,
+		MinimumValidChildTimestamp: cc.MinimumValidChildTimestamp,
+		Synced:                     cc.Synced,
+	})
+}
+
+func decodeConsensusChange(b []byte) (modules.ConsensusChange, error) {
+	var ecc encodedConsensusChange
+	if err := encoding.Unmarshal(b, &ecc); err != nil {
+		return modules.ConsensusChange{}, err
+	}
+	return modules.ConsensusChange{
+		ID:                         ecc.ID,
+		BlockHeight:                ecc.BlockHeight,
+		RevertedBlocks:             ecc.RevertedBlocks,
+		AppliedBlocks:              ecc.AppliedBlocks,
+		RevertedDiffs:              ecc.RevertedDiffs,
+		AppliedDiffs:               ecc.AppliedDiffs,
+		ConsensusChangeDiffs:       ecc.Diffs,
+		ChildTarget:                ecc.ChildTarget,
+		MinimumValidChildTimestamp: ecc.MinimumValidChildTimestamp,
+		Synced:                     ecc.Synced,
+	}, nil
+}
+
+// changeCollector is a temporary subscriber of the consensus set that collects
+// a limited number of encoded consensus changes.
+type changeCollector struct {
+	mu      sync.Mutex
+	limit   int
+	changes [][]byte
+	cancel  chan struct{}
+}
+
+// ProcessConsensusChange implements modules.ConsensusSetSubscriber.
+func (c *changeCollector) ProcessConsensusChange(cc modules.ConsensusChange) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.changes) == c.limit {
+		return
+	}
+	c.changes = append(c.changes, encodeConsensusChange(cc))
+	if len(c.changes) == c.limit {
+		close(c.cancel)
+	}
+}
+
+// ConsensusChanges implements bus.ChainManager.
+func (cm chainManager) ConsensusChanges(ctx context.Context, after types.Hash256, limit int) (api.ConsensusChanges, error) {
+	// collect one more change than requested to find out whether there
+	// are more changes
+	c := &changeCollector{limit: limit + 1, cancel: make(chan struct{})}
+	err := cm.cs.ConsensusSetSubscribe(c, modules.ConsensusChangeID(after), c.cancel)
+	cm.cs.Unsubscribe(c)
+	if errors.Is(err, modules.ErrInvalidConsensusChangeID) {
+		return api.ConsensusChanges{}, api.ErrConsensusChangeNotFound
+	} else if err != nil && !errors.Is(err, siasync.ErrStopped) {
+		return api.ConsensusChanges{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	resp := api.ConsensusChanges{Changes: c.changes}
+	if len(resp.Changes) > limit {
+		resp.Changes = resp.Changes[:limit]
+		resp.More = true
+	}
+	return resp, nil
+}
+
+type remoteSubscriber struct {
+	s    modules.ConsensusSetSubscriber
+	ccid modules.ConsensusChangeID
+}
+
+// A remoteChainManager follows the chain through the bus it uses as its chain
+// source instead of running its own consensus set. It feeds the consensus
+// changes it fetches from the chain source to its subscribers and tracks the
+// tip of the chain.
+type remoteChainManager struct {
+	c      *bus.Client
+	logger *zap.SugaredLogger
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+
+	// subMu serializes the delivery of consensus changes.
+	subMu       sync.Mutex
+	subscribers []*remoteSubscriber
+
+	mu      sync.Mutex
+	tip     consensus.State
+	tipCCID modules.ConsensusChangeID
+	synced  bool
+	blocks  map[uint64]types.Block
+}
+
+func newRemoteChainManager(c *bus.Client, l *zap.SugaredLogger) *remoteChainManager {
+	return &remoteChainManager{
+		c:        c,
+		logger:   l,
+		stopChan: make(chan struct{}),
+		blocks:   make(map[uint64]types.Block),
+	}
+}
+
+// run starts polling the chain source for new consensus changes until the
+// chain manager is closed.
+func (cm *remoteChainManager) run(interval time.Duration) {
+	cm.wg.Add(1)
+	go func() {
+		defer cm.wg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-cm.stopChan:
+				return
+			case <-t.C:
+			}
+			cm.subMu.Lock()
+			for _, sub := range cm.subscribers {
+				if err := cm.sync(sub, nil); err != nil {
+					cm.logger.Errorw("failed to sync with chain source", "error", err)
+					break
+				}
+			}
+			cm.subMu.Unlock()
+		}
+	}()
+}
+
+// Close stops polling the chain source.
+func (cm *remoteChainManager) Close() error {
+	close(cm.stopChan)
+	cm.wg.Wait()
+	return nil
+}
+
+// sync feeds the consensus changes following the subscriber's last change to
+// the subscriber.
+func (cm *remoteChainManager) sync(sub *remoteSubscriber, cancel <-chan struct{}) error {
+	for {
+		select {
+		case <-cancel:
+			return siasync.ErrStopped
+		case <-cm.stopChan:
+			return siasync.ErrStopped
+		default:
+		}
+
+		ctx, cancelCtx := context.WithTimeout(context.Background(), time.Minute)
+		resp, err := cm.c.ConsensusChanges(ctx, types.Hash256(sub.ccid), remoteConsensusBatchSize)
+		cancelCtx()
+		if errors.Is(err, api.ErrConsensusChangeNotFound) {
+			return modules.ErrInvalidConsensusChangeID
+		} else if err != nil {
+			return err
+		}
+
+		changes := make([]modules.ConsensusChange, len(resp.Changes))
+		for i, b := range resp.Changes {
+			if changes[i], err = decodeConsensusChange(b); err != nil {
+				return fmt.Errorf("failed to decode consensus change: %w", err)
+			}
+		}
+		for _, cc := range changes {
+			sub.s.ProcessConsensusChange(cc)
+			sub.ccid = cc.ID
+		}
+
+		// the last batch ends at the tip of the chain source, so its
+		// changes can be applied to the tip
+		if !resp.More {
+			for _, cc := range changes {
+				cm.applyTip(cc)
+			}
+			return nil
+		}
+	}
+}
+
+// applyTip updates the tip and the cache of recent blocks with a consensus
+// change that's part of the chain source's current chain.
+func (cm *remoteChainManager) applyTip(cc modules.ConsensusChange) {
+	if len(cc.AppliedBlocks) == 0 {
+		return
+	}
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	tip := uint64(cc.BlockHeight)
+	start := tip + 1 - uint64(len(cc.AppliedBlocks))
+	for height := range cm.blocks {
+		if height >= start || height+remoteBlockCacheSize <= tip {
+			delete(cm.blocks, height)
+		}
+	}
+	for i, sb := range cc.AppliedBlocks {
+		var b types.Block
+		convertToCore(sb, &b)
+		cm.blocks[start+uint64(i)] = b
+	}
+
+	last := cc.AppliedBlocks[len(cc.AppliedBlocks)-1]
+	cm.tip = consensus.State{
+		Index: types.ChainIndex{
+			Height: tip,
+			ID:     types.BlockID(last.ID()),
+		},
+	}
+	cm.tip.PrevTimestamps[0] = time.Unix(int64(last.Timestamp), 0)
+	cm.tipCCID = cc.ID
+	cm.synced = cc.Synced
+}
+
+// ConsensusSetSubscribe feeds the consensus changes following the given change
+// to the subscriber and subscribes it to future changes. Subscribers that
+// subscribe from modules.ConsensusChangeRecent only receive future changes.
+func (cm *remoteChainManager) ConsensusSetSubscribe(s modules.ConsensusSetSubscriber, ccid modules.ConsensusChangeID, cancel <-chan struct{}) error {
+	cm.subMu.Lock()
+	defer cm.subMu.Unlock()
+	if ccid == modules.ConsensusChangeRecent {
+		cm.mu.Lock()
+		ccid = cm.tipCCID
+		cm.mu.Unlock()
+	}
+	sub := &remoteSubscriber{s: s, ccid: ccid}
+	if err := cm.sync(sub, cancel); err != nil {
+		return err
+	}
+	cm.subscribers = append(cm.subscribers, sub)
+	return nil
+}
+
+// Unsubscribe stops feeding consensus changes to the subscriber.
+func (cm *remoteChainManager) Unsubscribe(s modules.ConsensusSetSubscriber) {
+	cm.subMu.Lock()
+	defer cm.subMu.Unlock()
+	for i, sub := range cm.subscribers {
+		if sub.s == s {
+			cm.subscribers = append(cm.subscribers[:i], cm.subscribers[i+1:]...)
+			return
+		}
+	}
+}
+
+func (cm *remoteChainManager) AcceptBlock(ctx context.Context, b types.Block) error {
+	return cm.c.AcceptBlock(ctx, b)
+}
+
+// BlockAtHeight returns the block at the given height if it's one of the
+// recent blocks kept in memory.
+func (cm *remoteChainManager) BlockAtHeight(ctx context.Context, height uint64) (types.Block, bool) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	b, ok := cm.blocks[height]
+	return b, ok
+}
+
+func (cm *remoteChainManager) Synced(ctx context.Context) bool {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.synced
+}
+
+func (cm *remoteChainManager) TipState(ctx context.Context) consensus.State {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.tip
+}
+
+func (cm *remoteChainManager) ConsensusChanges(ctx context.Context, after types.Hash256, limit int) (api.ConsensusChanges, error) {
+	return cm.c.ConsensusChanges(ctx, after, limit)
+}
+
+// remoteSyncer relays transactions and peer management to the chain source.
+type remoteSyncer struct {
+	c      *bus.Client
+	logger *zap.SugaredLogger
+}
+
+func (s remoteSyncer) SyncerAddress(ctx context.Context) (string, error) {
+	return s.c.SyncerAddress(ctx)
+}
+
+func (s remoteSyncer) Peers() []string {
+	peers, err := s.c.SyncerPeers(context.Background())
+	if err != nil {
+		s.logger.Warnw("failed to fetch peers of chain source", "error", err)
+	}
+	return peers
+}
+
+func (s remoteSyncer) Connect(addr string) error {
+	return s.c.SyncerConnect(context.Background(), addr)
+}
+
+func (s remoteSyncer) BroadcastTransaction(txn types.Transaction, dependsOn []types.Transaction) {
+	txnSet := append(append([]types.Transaction(nil), dependsOn...), txn)
+	if err := s.c.BroadcastTransaction(context.Background(), txnSet); err != nil {
+		s.logger.Warnw("failed to broadcast transaction through chain source", "txn", txn.ID(), "error", err)
+	}
+}
+
+// remoteTxpool uses the transaction pool of the chain source.
+type remoteTxpool struct {
+	c      *bus.Client
+	logger *zap.SugaredLogger
+}
+
+func (tp remoteTxpool) RecommendedFee() types.Currency {
+	fee, err := tp.c.RecommendedFee(context.Background())
+	if err != nil {
+		tp.logger.Warnw("failed to fetch recommended fee from chain source", "error", err)
+	}
+	return fee
+}
+
+func (tp remoteTxpool) Transactions() []types.Transaction {
+	txns, err := tp.c.TransactionPool(context.Background())
+	if err != nil {
+		tp.logger.Warnw("failed to fetch transaction pool of chain source", "error", err)
+	}
+	return txns
+}
+
+func (tp remoteTxpool) AddTransactionSet(txns []types.Transaction) error {
+	return tp.c.BroadcastTransaction(context.Background(), txns)
+}
+
+func (tp remoteTxpool) UnconfirmedParents(txn types.Transaction) ([]types.Transaction, error) {
+	return unconfirmedParents(tp.Transactions(), txn), nil
+}
@@ -0,0 +1,152 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/bus"
+	"go.sia.tech/siad/modules"
+	stypes "go.sia.tech/siad/types"
+	"go.uber.org/zap"
+)
+
+type recordingSubscriber struct {
+	changes []modules.ConsensusChangeID
+}
+
+func (s *recordingSubscriber) ProcessConsensusChange(cc modules.ConsensusChange) {
+	s.changes = append(s.changes, cc.ID)
+}
+
+func TestEncodeConsensusChange(t *testing.T) {
+	cc := modules.ConsensusChange{
+		ID:            modules.ConsensusChangeID{1},
+		BlockHeight:   10,
+		AppliedBlocks: []stypes.Block{{Timestamp: 100}},
+		ConsensusChangeDiffs: modules.ConsensusChangeDiffs{
+			SiacoinOutputDiffs: []modules.SiacoinOutputDiff{{
+				Direction:     modules.DiffApply,
+				ID:            stypes.SiacoinOutputID{2},
+				SiacoinOutput: stypes.SiacoinOutput{Value: stypes.NewCurrency64(3)},
+			}},
+		},
+		Synced: true,
+	}
+	decoded, err := decodeConsensusChange(encodeConsensusChange(cc))
+	if err != nil {
+		t.Fatal(err)
+	} else if decoded.ID != cc.ID || decoded.BlockHeight != cc.BlockHeight || !decoded.Synced {
+		t.Fatal("unexpected change", decoded)
+	} else if len(decoded.AppliedBlocks) != 1 || decoded.AppliedBlocks[0].ID() != cc.AppliedBlocks[0].ID() {
+		t.Fatal("unexpected applied blocks", decoded.AppliedBlocks)
+	} else if len(decoded.SiacoinOutputDiffs) != 1 || decoded.SiacoinOutputDiffs[0].ID != cc.SiacoinOutputDiffs[0].ID || !decoded.SiacoinOutputDiffs[0].SiacoinOutput.Value.Equals64(3) {
+		t.Fatal("unexpected diffs", decoded.SiacoinOutputDiffs)
+	}
+	if decoded.InitialHeight() != cc.InitialHeight() {
+		t.Fatal("unexpected initial height", decoded.InitialHeight())
+	}
+}
+
+func TestRemoteChainManager(t *testing.T) {
+	// prepare a chain source that returns at most 2 changes per request
+	var changes []modules.ConsensusChange
+	for i := 0; i < 3; i++ {
+		changes = append(changes, modules.ConsensusChange{
+			ID:            modules.ConsensusChangeID{byte(i + 1)},
+			BlockHeight:   stypes.BlockHeight(i),
+			AppliedBlocks: []stypes.Block{{Timestamp: stypes.Timestamp(i)}},
+			Synced:        true,
+		})
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var after types.Hash256
+		if err := after.UnmarshalText([]byte(req.FormValue("after"))); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		start := -1
+		for i, cc := range changes {
+			if types.Hash256(cc.ID) == after {
+				start = i
+			}
+		}
+		if start == -1 && after != (types.Hash256{}) {
+			http.Error(w, api.ErrConsensusChangeNotFound.Error(), http.StatusNotFound)
+			return
+		}
+		var resp api.ConsensusChanges
+		for _, cc := range changes[start+1:] {
+			if len(resp.Changes) == 2 {
+				resp.More = true
+				break
+			}
+			resp.Changes = append(resp.Changes, encodeConsensusChange(cc))
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	cm := newRemoteChainManager(bus.NewClient(srv.URL, ""), zap.NewNop().Sugar())
+	defer cm.Close()
+
+	// subscribing from the beginning should feed all changes
+	s := &recordingSubscriber{}
+	if err := cm.ConsensusSetSubscribe(s, modules.ConsensusChangeBeginning, nil); err != nil {
+		t.Fatal(err)
+	} else if len(s.changes) != 3 || s.changes[2] != changes[2].ID {
+		t.Fatal("unexpected changes", s.changes)
+	}
+	tip := cm.TipState(context.Background())
+	if tip.Index.Height != 2 || tip.Index.ID != types.BlockID(changes[2].AppliedBlocks[0].ID()) {
+		t.Fatal("unexpected tip", tip.Index)
+	} else if !cm.Synced(context.Background()) {
+		t.Fatal("expected chain manager to be synced")
+	}
+
+	// only the blocks of the last batch are known
+	if _, ok := cm.BlockAtHeight(context.Background(), 1); ok {
+		t.Fatal("expected block 1 to be unknown")
+	} else if b, ok := cm.BlockAtHeight(context.Background(), 2); !ok || b.ID() != tip.Index.ID {
+		t.Fatal("unexpected block at height 2")
+	}
+
+	// reorg the last block
+	reorg := []stypes.Block{{Timestamp: 10}, {Timestamp: 11}}
+	changes = append(changes, modules.ConsensusChange{
+		ID:             modules.ConsensusChangeID{4},
+		BlockHeight:    3,
+		RevertedBlocks: changes[2].AppliedBlocks,
+		AppliedBlocks:  reorg,
+	})
+	cm.subMu.Lock()
+	err := cm.sync(cm.subscribers[0], nil)
+	cm.subMu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(s.changes) != 4 {
+		t.Fatal("unexpected changes", s.changes)
+	}
+	if b, ok := cm.BlockAtHeight(context.Background(), 2); !ok || b.ID() != types.BlockID(reorg[0].ID()) {
+		t.Fatal("expected reverted block to be replaced")
+	} else if tip := cm.TipState(context.Background()); tip.Index.Height != 3 || tip.Index.ID != types.BlockID(reorg[1].ID()) {
+		t.Fatal("unexpected tip", tip.Index)
+	} else if cm.Synced(context.Background()) {
+		t.Fatal("expected chain manager to not be synced")
+	}
+
+	// subscribing from an unknown change should fail
+	if err := cm.ConsensusSetSubscribe(&recordingSubscriber{}, modules.ConsensusChangeID{5}, nil); err != modules.ErrInvalidConsensusChangeID {
+		t.Fatal("unexpected error", err)
+	}
+
+	// unsubscribing should remove the subscriber
+	cm.Unsubscribe(s)
+	if len(cm.subscribers) != 0 {
+		t.Fatal("expected no subscribers")
+	}
+}
@@ -0,0 +1,217 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"go.sia.tech/jape"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// LogFormatHuman is the human-readable console log format.
+	LogFormatHuman = "human"
+
+	// LogFormatJSON is the structured JSON console log format.
+	LogFormatJSON = "json"
+
+	// logModuleDefault is the module of loggers that don't belong to any of
+	// the logModules.
+	logModuleDefault = "default"
+)
+
+// logModules are the modules whose log level can be configured separately,
+// a logger belongs to the module it's named after.
+var logModules = []string{"autopilot", "bus", "stores", "worker"}
+
+// LoggerConfig contains the configuration of the logger.
+type LoggerConfig struct {
+	// Path is the path of the log file.
+	Path string
+
+	// Format is the format of the console output, either LogFormatHuman or
+	// LogFormatJSON. The log file is always written as JSON.
+	Format string
+
+	// Level is the initial log level of all modules.
+	Level zapcore.Level
+}
+
+// LogLevels contains the log levels of all modules, they can be updated at
+// runtime.
+type LogLevels struct {
+	levels map[string]zap.AtomicLevel
+}
+
+func newLogLevels(level zapcore.Level) *LogLevels {
+	ll := &LogLevels{levels: make(map[string]zap.AtomicLevel)}
+	for _, module := range append(logModules, logModuleDefault) {
+		ll.levels[module] = zap.NewAtomicLevelAt(level)
+	}
+	return ll
+}
+
+// Levels returns the log level of every module.
+func (ll *LogLevels) Levels() map[string]string {
+	levels := make(map[string]string)
+	for module, level := range ll.levels {
+		levels[module] = level.String()
+	}
+	return levels
+}
+
+// SetLevels updates the log level of the given modules. Either all levels are
+// updated or none.
+func (ll *LogLevels) SetLevels(levels map[string]string) error {
+	parsed := make(map[string]zapcore.Level)
+	for module, s := range levels {
+		if _, ok := ll.levels[module]; !ok {
+			return fmt.Errorf("unknown module %q, valid modules are %v", module, ll.modules())
+		}
+		var level zapcore.Level
+		if err := level.UnmarshalText([]byte(s)); err != nil {
+			return err
+		}
+		parsed[module] = level
+	}
+	for module, level := range parsed {
+		ll.levels[module].SetLevel(level)
+	}
+	return nil
+}
+
+// Handler returns an HTTP handler that serves the module log levels.
+func (ll *LogLevels) Handler() http.Handler {
+	return jape.Mux(map[string]jape.Handler{
+		"GET    /levels": ll.levelsHandlerGET,
+		"PUT    /levels": ll.levelsHandlerPUT,
+	})
+}
+
+func (ll *LogLevels) levelsHandlerGET(jc jape.Context) {
+	jc.Encode(ll.Levels())
+}
+
+func (ll *LogLevels) levelsHandlerPUT(jc jape.Context) {
+	var levels map[string]string
+	if jc.Decode(&levels) != nil {
+		return
+	} else if err := ll.SetLevels(levels); err != nil {
+		jc.Error(err, http.StatusBadRequest)
+	}
+}
+
+// level returns the level of the module the logger with given name belongs
+// to.
+func (ll *LogLevels) level(name string) zap.AtomicLevel {
+	if level, ok := ll.levels[strings.SplitN(name, ".", 2)[0]]; ok {
+		return level
+	}
+	return ll.levels[logModuleDefault]
+}
+
+func (ll *LogLevels) modules() []string {
+	modules := make([]string, 0, len(ll.levels))
+	for module := range ll.levels {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	return modules
+}
+
+// levelCore is a zapcore.Core that drops entries below the level of the
+// module the entry's logger belongs to.
+type levelCore struct {
+	zapcore.Core
+	levels *LogLevels
+}
+
+// Enabled implements zapcore.Core. It returns true if the level is enabled
+// for any module since the logger's name isn't known yet.
+func (c *levelCore) Enabled(lvl zapcore.Level) bool {
+	for _, level := range c.levels.levels {
+		if level.Enabled(lvl) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check implements zapcore.Core.
+func (c *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.levels.level(ent.LoggerName).Enabled(ent.Level) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// With implements zapcore.Core.
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), levels: c.levels}
+}
+
+// NewLogger creates a logger that writes to stdout and to the log file at
+// the configured path. The log level of every module can be updated at
+// runtime through the returned LogLevels.
+func NewLogger(cfg LoggerConfig) (*zap.Logger, *LogLevels, func(context.Context) error, error) {
+	writer, closeFn, err := zap.Open(cfg.Path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// console
+	var consoleEncoder zapcore.Encoder
+	switch cfg.Format {
+	case LogFormatHuman, "":
+		config := zap.NewProductionEncoderConfig()
+		config.EncodeTime = zapcore.RFC3339TimeEncoder
+		config.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		config.StacktraceKey = ""
+		consoleEncoder = zapcore.NewConsoleEncoder(config)
+	case LogFormatJSON:
+		config := zap.NewProductionEncoderConfig()
+		config.EncodeTime = zapcore.RFC3339TimeEncoder
+		config.StacktraceKey = ""
+		config.NameKey = "component"
+		consoleEncoder = zapcore.NewJSONEncoder(config)
+	default:
+		closeFn()
+		return nil, nil, nil, errors.New("unknown log format " + cfg.Format)
+	}
+
+	// file
+	config := zap.NewProductionEncoderConfig()
+	config.EncodeTime = zapcore.RFC3339TimeEncoder
+	config.CallerKey = ""     // hide
+	config.StacktraceKey = "" // hide
+	config.NameKey = "component"
+	config.TimeKey = "date"
+	fileEncoder := zapcore.NewJSONEncoder(config)
+
+	levels := newLogLevels(cfg.Level)
+	core := &levelCore{
+		Core: zapcore.NewTee(
+			zapcore.NewCore(fileEncoder, writer, zapcore.DebugLevel),
+			zapcore.NewCore(consoleEncoder, zapcore.AddSync(os.Stdout), zapcore.DebugLevel),
+		),
+		levels: levels,
+	}
+
+	logger := zap.New(
+		core,
+		zap.AddCaller(),
+		zap.AddStacktrace(zapcore.ErrorLevel),
+	)
+
+	return logger, levels, func(_ context.Context) error {
+		_ = logger.Sync() // ignore Error
+		closeFn()
+		return nil
+	}, nil
+}
@@ -0,0 +1,55 @@
+package node
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogLevels(t *testing.T) {
+	obs, logs := observer.New(zapcore.DebugLevel)
+	levels := newLogLevels(zapcore.InfoLevel)
+	l := zap.New(&levelCore{Core: obs, levels: levels})
+
+	// log a debug message for every module, none should be logged
+	bus, worker := l.Named("bus"), l.Named("worker").Named("worker1").With(zap.String("foo", "bar"))
+	bus.Debug("foo")
+	worker.Debug("foo")
+	l.Named("audit").Debug("foo")
+	if logs.Len() != 0 {
+		t.Fatal("unexpected number of logs", logs.Len())
+	}
+
+	// enable debug logging for the worker
+	if err := levels.SetLevels(map[string]string{"worker": "debug"}); err != nil {
+		t.Fatal(err)
+	} else if levels.Levels()["worker"] != "debug" || levels.Levels()["bus"] != "info" {
+		t.Fatal("unexpected levels", levels.Levels())
+	}
+	bus.Debug("foo")
+	worker.Debug("foo")
+	if logs.Len() != 1 || logs.All()[0].LoggerName != "worker.worker1" {
+		t.Fatal("unexpected logs", logs.All())
+	}
+
+	// assert invalid updates are rejected as a whole
+	if err := levels.SetLevels(map[string]string{"bus": "debug", "foo": "debug"}); err == nil {
+		t.Fatal("expected error for unknown module")
+	} else if err := levels.SetLevels(map[string]string{"bus": "debug", "worker": "foo"}); err == nil {
+		t.Fatal("expected error for unknown level")
+	} else if levels.Levels()["bus"] != "info" {
+		t.Fatal("unexpected level", levels.Levels()["bus"])
+	}
+
+	// loggers outside of the modules use the default level
+	if err := levels.SetLevels(map[string]string{"default": "error"}); err != nil {
+		t.Fatal(err)
+	}
+	l.Named("audit").Warn("foo")
+	bus.Warn("foo")
+	if logs.Len() != 2 || logs.All()[1].LoggerName != "bus" {
+		t.Fatal("unexpected logs", logs.All())
+	}
+}
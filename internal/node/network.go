@@ -0,0 +1,53 @@
+package node
+
+import "fmt"
+
+// The networks renterd can run on. siad selects the genesis block, consensus
+// parameters and bootstrap peers at build time, so the network is picked by
+// building renterd with or without the 'testnet' build tag.
+const (
+	NetworkMainnet = "mainnet"
+	NetworkZen     = "zen"
+)
+
+// A NetworkConfig contains the defaults that differ between networks.
+type NetworkConfig struct {
+	Name        string
+	HTTPAddr    string
+	GatewayAddr string
+
+	// BuildTags are the tags renterd has to be built with to run on the
+	// network.
+	BuildTags string
+}
+
+var networks = map[string]NetworkConfig{
+	NetworkMainnet: {
+		Name:        NetworkMainnet,
+		HTTPAddr:    "localhost:9980",
+		GatewayAddr: ":9981",
+	},
+	NetworkZen: {
+		Name:        NetworkZen,
+		HTTPAddr:    "localhost:9880",
+		GatewayAddr: ":9881",
+		BuildTags:   "testnet",
+	},
+}
+
+// Network returns the config of the network renterd was built for.
+func Network() NetworkConfig {
+	return networks[network]
+}
+
+// CheckNetwork returns an error if renterd wasn't built for the network with
+// the given name.
+func CheckNetwork(name string) error {
+	n, ok := networks[name]
+	if !ok {
+		return fmt.Errorf("unknown network '%v'", name)
+	} else if n.Name != network {
+		return fmt.Errorf("renterd was built for %v, build it with -tags='%v' to run on %v", network, n.BuildTags, n.Name)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"go.sia.tech/core/consensus"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/wallet"
+	stypes "go.sia.tech/siad/types"
+	"lukechampine.com/frand"
+)
+
+func TestCheckNetwork(t *testing.T) {
+	if err := CheckNetwork(Network().Name); err != nil {
+		t.Fatal(err)
+	} else if err := CheckNetwork("foo"); err == nil {
+		t.Fatal("expected unknown network to be rejected")
+	}
+
+	other := NetworkZen
+	if Network().Name == NetworkZen {
+		other = NetworkMainnet
+	}
+	if err := CheckNetwork(other); err == nil {
+		t.Fatal("expected network renterd wasn't built for to be rejected")
+	}
+}
+
+// TestReplayProtection verifies the wallet signs transactions with the replay
+// protection prefix siad expects on the network renterd was built for.
+func TestReplayProtection(t *testing.T) {
+	asic, foundation := stypes.BlockHeight(179000), stypes.BlockHeight(298000)
+	if Network().Name == NetworkZen {
+		asic, foundation = 20, 30
+	}
+	if stypes.ASICHardforkHeight != asic || stypes.FoundationHardforkHeight != foundation {
+		t.Fatalf("unexpected hardfork heights %v and %v", stypes.ASICHardforkHeight, stypes.FoundationHardforkHeight)
+	}
+
+	seed := frand.Entropy256()
+	priv := wallet.KeyFromSeed(&seed, 0)
+	addr := wallet.StandardAddress(priv.PublicKey())
+	w := wallet.NewSingleAddressWallet(&seed, &signingStore{
+		addr: addr,
+		utxo: wallet.SiacoinElement{
+			SiacoinOutput: types.SiacoinOutput{Value: types.Siacoins(1), Address: addr},
+			ID:            types.Hash256{1},
+		},
+	})
+
+	for _, height := range []stypes.BlockHeight{1, asic - 1, asic, foundation - 1, foundation, foundation + 1000} {
+		cs := consensus.State{Index: types.ChainIndex{Height: uint64(height)}}
+		txn := types.Transaction{SiacoinOutputs: []types.SiacoinOutput{{Value: types.Siacoins(1), Address: addr}}}
+		toSign, err := w.FundTransaction(cs, &txn, types.Siacoins(1), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, cf := range []types.CoveredFields{{WholeTransaction: true}, {SiacoinInputs: []uint64{0}, SiacoinOutputs: []uint64{0}}} {
+			signed := txn
+			signed.Signatures = nil
+			if err := w.SignTransaction(cs, &signed, toSign, cf); err != nil {
+				t.Fatal(err)
+			}
+
+			// verify the signature the way siad does
+			var stxn stypes.Transaction
+			convertToSiad(signed, &stxn)
+			var sig types.Signature
+			copy(sig[:], signed.Signatures[0].Signature)
+			if !priv.PublicKey().VerifyHash(types.Hash256(stxn.SigHash(0, height)), sig) {
+				t.Fatalf("invalid signature at height %v", height)
+			}
+		}
+		w.ReleaseInputs(txn)
+	}
+}
+
+// signingStore is a wallet.SingleAddressStore with a single output.
+type signingStore struct {
+	addr types.Address
+	utxo wallet.SiacoinElement
+}
+
+func (s *signingStore) Balance() types.Currency { return s.utxo.Value }
+func (s *signingStore) UnspentSiacoinElements() ([]wallet.SiacoinElement, error) {
+	return []wallet.SiacoinElement{s.utxo}, nil
+}
+func (s *signingStore) Transactions(since time.Time, max int) ([]wallet.Transaction, error) {
+	return nil, nil
+}
+func (s *signingStore) Addresses() []types.Address          { return []types.Address{s.addr} }
+func (s *signingStore) AddAddress(addr types.Address) error { return nil }
+func (s *signingStore) Rescan(fromHeight uint64) error      { return nil }
@@ -0,0 +1,7 @@
+//go:build testnet
+// +build testnet
+
+package node
+
+// network is the network renterd was built for.
+const network = NetworkZen
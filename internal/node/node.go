@@ -3,6 +3,7 @@ package node
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"log"
 	"net/http"
@@ -25,20 +26,30 @@ import (
 	"go.sia.tech/siad/modules/transactionpool"
 	stypes "go.sia.tech/siad/types"
 	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 	"golang.org/x/crypto/blake2b"
 	"gorm.io/gorm"
+	glogger "gorm.io/gorm/logger"
 )
 
 type WorkerConfig struct {
-	ID                      string
-	BusFlushInterval        time.Duration
-	SessionReconnectTimeout time.Duration
-	SessionTTL              time.Duration
-	DownloadSectorTimeout   time.Duration
-	UploadSectorTimeout     time.Duration
+	worker.Config
+
+	// ExternalAddr is the address the bus reaches the worker's API at, the
+	// worker registers with the bus under that address if it's set.
+	ExternalAddr     string
+	ExternalPassword string
 }
 
+const (
+	// EncryptedSeedFile is the name of the file in the bus' wallet directory
+	// containing the encrypted wallet seed.
+	EncryptedSeedFile = "seed.enc"
+
+	// SeedMetadataFile is the name of the file in the bus' wallet directory
+	// containing the metadata of an imported seed.
+	SeedMetadataFile = "seed.json"
+)
+
 type BusConfig struct {
 	Bootstrap       bool
 	GatewayAddr     string
@@ -46,6 +57,45 @@ type BusConfig struct {
 	PersistInterval time.Duration
 
 	DBDialector gorm.Dialector
+
+	// SlowQueryThreshold is the duration after which a database query is
+	// logged as slow, it defaults to 200ms.
+	SlowQueryThreshold time.Duration
+
+	// SlabHealthInterval is the interval at which the health of all slabs is
+	// recomputed, it's never recomputed if zero. SlabHealthBatchSize is the
+	// number of slabs whose health is recomputed per query.
+	SlabHealthInterval  time.Duration
+	SlabHealthBatchSize int
+
+	// DBSecret is used to encrypt sensitive columns in the database, it
+	// allows integrating with a KMS. If not set, the secret is derived from
+	// the wallet seed, it has to be set if the bus doesn't hold the seed.
+	DBSecret *[32]byte
+
+	// WalletWatchOnly configures the bus' wallet to only track the wallet's
+	// address, its transactions are queued for external signing.
+	WalletWatchOnly bool
+
+	// WalletPublicKey and WalletAddress identify the wallet if the bus
+	// doesn't hold its seed. A watch-only wallet needs either of them but
+	// can only fund transactions if it knows the public key, a wallet using
+	// an external signer needs the public key.
+	WalletPublicKey *types.PublicKey
+	WalletAddress   *types.Address
+
+	// WalletSigner is the address of an external signer that signs the
+	// wallet's transactions, either an HTTP URL or a unix socket prefixed
+	// with "unix://". If set, the bus' wallet doesn't hold the wallet's
+	// private key.
+	WalletSigner string
+
+	// ConsensusSource is the address of another bus the bus follows the
+	// chain through. If set, the bus doesn't run its own gateway, consensus
+	// set and transaction pool but fetches blocks from the chain source and
+	// relays transactions to it.
+	ConsensusSource         string
+	ConsensusSourcePassword string
 }
 
 type AutopilotConfig struct {
@@ -55,6 +105,11 @@ type AutopilotConfig struct {
 	ScannerInterval        time.Duration
 	ScannerBatchSize       uint64
 	ScannerNumThreads      uint64
+
+	// HostDataProvider is the URL of an external host-data API the autopilot
+	// pulls benchmark and score data about hosts from, it's not used if
+	// empty.
+	HostDataProvider string
 }
 
 type ShutdownFn = func(context.Context) error
@@ -89,17 +144,30 @@ func (cm chainManager) AcceptBlock(ctx context.Context, b types.Block) error {
 	return cm.cs.AcceptBlock(sb)
 }
 
+func (cm chainManager) BlockAtHeight(ctx context.Context, height uint64) (types.Block, bool) {
+	sb, exists := cm.cs.BlockAtHeight(stypes.BlockHeight(height))
+	if !exists {
+		return types.Block{}, false
+	}
+	var b types.Block
+	convertToCore(sb, &b)
+	return b, true
+}
+
 func (cm chainManager) Synced(ctx context.Context) bool {
 	return cm.cs.Synced()
 }
 
 func (cm chainManager) TipState(ctx context.Context) consensus.State {
-	return consensus.State{
+	b := cm.cs.CurrentBlock()
+	cs := consensus.State{
 		Index: types.ChainIndex{
 			Height: uint64(cm.cs.Height()),
-			ID:     types.BlockID(cm.cs.CurrentBlock().ID()),
+			ID:     types.BlockID(b.ID()),
 		},
 	}
+	cs.PrevTimestamps[0] = time.Unix(int64(b.Timestamp), 0)
+	return cs
 }
 
 type syncer struct {
@@ -164,7 +232,12 @@ func (tp txpool) AddTransactionSet(txns []types.Transaction) error {
 }
 
 func (tp txpool) UnconfirmedParents(txn types.Transaction) ([]types.Transaction, error) {
-	pool := tp.Transactions()
+	return unconfirmedParents(tp.Transactions(), txn), nil
+}
+
+// unconfirmedParents returns the transactions in the pool that create outputs
+// spent by the given transaction.
+func unconfirmedParents(pool []types.Transaction, txn types.Transaction) []types.Transaction {
 	outputToParent := make(map[types.SiacoinOutputID]*types.Transaction)
 	for i, txn := range pool {
 		for j := range txn.SiacoinOutputs {
@@ -181,27 +254,119 @@ func (tp txpool) UnconfirmedParents(txn types.Transaction) ([]types.Transaction,
 			}
 		}
 	}
-	return parents, nil
+	return parents
+}
+
+// heightSubscriber passes the height of every consensus change to the bus.
+type heightSubscriber struct {
+	processHeight func(height uint64)
+}
+
+func (hs *heightSubscriber) ProcessConsensusChange(cc modules.ConsensusChange) {
+	hs.processHeight(uint64(cc.BlockHeight))
+}
+
+// diagnosticsStore adds disk space diagnostics of the bus' directory to the
+// SQL store.
+type diagnosticsStore struct {
+	*stores.SQLStore
+	dir string
+}
+
+func (ds diagnosticsStore) FreeDiskSpace() (uint64, error) {
+	return freeDiskSpace(ds.dir)
+}
+
+// seedMetadata is the metadata of an imported seed.
+type seedMetadata struct {
+	Addresses uint64 `json:"addresses"`
+}
+
+// seedStore stores imported seeds in the bus' wallet directory, they're used
+// once the node is restarted.
+type seedStore struct {
+	dir string
+}
+
+func (ss seedStore) SaveSeed(encryptedSeed []byte, addresses uint64) error {
+	js, err := json.Marshal(seedMetadata{Addresses: addresses})
+	if err != nil {
+		return err
+	} else if err := writeFileAtomic(filepath.Join(ss.dir, SeedMetadataFile), js); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(ss.dir, EncryptedSeedFile), encryptedSeed)
+}
+
+// writeFileAtomic replaces the file at the given path by writing to a
+// temporary file first.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.WriteFile(path+"_tmp", data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+"_tmp", path)
+}
+
+// deriveSeedAddresses makes the store track the addresses that were derived
+// from an imported seed, the addresses are added before the store is
+// subscribed to the consensus set to make sure no outputs are missed.
+func deriveSeedAddresses(dir string, walletSeed *[32]byte, ws *stores.JSONWalletStore) error {
+	js, err := os.ReadFile(filepath.Join(dir, SeedMetadataFile))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var md seedMetadata
+	if err := json.Unmarshal(js, &md); err != nil {
+		return err
+	}
+	for i := uint64(len(ws.Addresses())); i < md.Addresses; i++ {
+		key := wallet.KeyFromSeed(walletSeed, i)
+		addr := wallet.StandardAddress(key.PublicKey())
+		memclr(key)
+		if err := ws.AddAddress(addr); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func NewBus(cfg BusConfig, dir string, walletKey types.PrivateKey, l *zap.Logger) (http.Handler, ShutdownFn, error) {
+// chain holds the modules the bus uses to follow the chain, either its own
+// consensus modules or a remote chain source.
+type chain struct {
+	cs stores.ConsensusSet
+	cm bus.ChainManager
+	s  bus.Syncer
+	tp bus.TransactionPool
+
+	// mcs and mtp are only set if the bus runs its own consensus modules.
+	mcs modules.ConsensusSet
+	mtp modules.TransactionPool
+
+	close func() error
+}
+
+// newLocalChain creates the gateway, consensus set and transaction pool of the
+// bus.
+func newLocalChain(cfg BusConfig, dir string) (*chain, error) {
 	gatewayDir := filepath.Join(dir, "gateway")
 	if err := os.MkdirAll(gatewayDir, 0700); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	g, err := gateway.New(cfg.GatewayAddr, cfg.Bootstrap, gatewayDir)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	consensusDir := filepath.Join(dir, "consensus")
 	if err := os.MkdirAll(consensusDir, 0700); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	cs, errCh := mconsensus.New(g, cfg.Bootstrap, consensusDir)
 	select {
 	case err := <-errCh:
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
 	default:
 		go func() {
@@ -212,25 +377,135 @@ func NewBus(cfg BusConfig, dir string, walletKey types.PrivateKey, l *zap.Logger
 	}
 	tpoolDir := filepath.Join(dir, "transactionpool")
 	if err := os.MkdirAll(tpoolDir, 0700); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	tp, err := transactionpool.New(cs, g, tpoolDir)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+	return &chain{
+		cs:  cs,
+		cm:  chainManager{cs: cs},
+		s:   syncer{g, tp},
+		tp:  txpool{tp},
+		mcs: cs,
+		mtp: tp,
+		close: func() error {
+			return joinErrors([]error{
+				g.Close(),
+				cs.Close(),
+				tp.Close(),
+			})
+		},
+	}, nil
+}
+
+// newRemoteChain creates a chain that follows the chain through the bus at the
+// given address.
+func newRemoteChain(addr, password string, l *zap.Logger) *chain {
+	c := bus.NewClient(addr, password)
+	logger := l.Named("chain").Sugar()
+	cm := newRemoteChainManager(c, logger)
+	cm.run(remoteConsensusPollInterval)
+	return &chain{
+		cs:    cm,
+		cm:    cm,
+		s:     remoteSyncer{c, logger},
+		tp:    remoteTxpool{c, logger},
+		close: cm.Close,
+	}
+}
+
+// NewBus creates a bus. The wallet's seed phrase may be empty if the bus'
+// wallet is watch-only or uses an external signer, the wallet is then
+// identified by the config's WalletPublicKey or WalletAddress.
+func NewBus(cfg BusConfig, dir string, walletPhrase string, l *zap.Logger) (http.Handler, ShutdownFn, error) {
+	var walletSeed *[32]byte
+	var walletKey types.PrivateKey
+	if walletPhrase != "" {
+		seed, err := wallet.SeedFromPhrase(walletPhrase)
+		if err != nil {
+			return nil, nil, err
+		}
+		walletSeed = seed
+		defer memclr(walletSeed[:])
+		walletKey = wallet.KeyFromSeed(walletSeed, 0)
+		defer memclr(walletKey)
+	}
+	var pub *types.PublicKey
+	if walletKey != nil {
+		pk := walletKey.PublicKey()
+		pub = &pk
+	} else if cfg.WalletPublicKey != nil {
+		pub = cfg.WalletPublicKey
+	}
+	var walletAddr types.Address
+	switch {
+	case cfg.WalletWatchOnly && cfg.WalletSigner != "":
+		return nil, nil, errors.New("a watch-only wallet can't use an external signer")
+	case cfg.WalletWatchOnly && pub == nil && cfg.WalletAddress == nil:
+		return nil, nil, errors.New("a watch-only wallet requires the wallet's address or public key")
+	case cfg.WalletSigner != "" && pub == nil:
+		return nil, nil, errors.New("a wallet using an external signer requires the wallet's public key")
+	case !cfg.WalletWatchOnly && cfg.WalletSigner == "" && walletKey == nil:
+		return nil, nil, errors.New("the wallet seed is required unless the wallet is watch-only or uses an external signer")
+	case walletKey == nil && cfg.DBSecret == nil:
+		return nil, nil, errors.New("a DB secret is required if the bus doesn't hold the wallet seed")
+	case pub != nil:
+		walletAddr = wallet.StandardAddress(*pub)
+	default:
+		walletAddr = *cfg.WalletAddress
+	}
+	if pub != nil && cfg.WalletAddress != nil && *cfg.WalletAddress != walletAddr {
+		return nil, nil, errors.New("wallet address doesn't match the wallet's public key")
+	}
+
+	var c *chain
+	if cfg.ConsensusSource != "" {
+		if cfg.Miner != nil {
+			return nil, nil, errors.New("a bus that follows a chain source can't run a miner")
+		}
+		c = newRemoteChain(cfg.ConsensusSource, cfg.ConsensusSourcePassword, l)
+	} else {
+		var err error
+		if c, err = newLocalChain(cfg, dir); err != nil {
+			return nil, nil, err
+		}
 	}
 
 	walletDir := filepath.Join(dir, "wallet")
 	if err := os.MkdirAll(walletDir, 0700); err != nil {
 		return nil, nil, err
 	}
-	walletAddr := wallet.StandardAddress(walletKey.PublicKey())
-	ws, ccid, err := stores.NewJSONWalletStore(walletDir, walletAddr)
+	ws, ccid, err := stores.NewJSONWalletStore(walletDir, walletAddr, l)
 	if err != nil {
 		return nil, nil, err
-	} else if err := cs.ConsensusSetSubscribe(ws, ccid, nil); err != nil {
+	}
+	if walletKey != nil {
+		if err := deriveSeedAddresses(walletDir, walletSeed, ws); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := ws.Subscribe(c.cs, ccid); err != nil {
+		return nil, nil, err
+	}
+	var w *wallet.SingleAddressWallet
+	if cfg.WalletWatchOnly && pub != nil {
+		w = wallet.NewWatchOnlyWallet(*pub, ws)
+	} else if cfg.WalletWatchOnly {
+		w = wallet.NewWatchOnlyAddressWallet(walletAddr, ws)
+	} else if cfg.WalletSigner != "" {
+		w = wallet.NewExternalSignerWallet(*pub, ws, wallet.NewHTTPSigner(cfg.WalletSigner))
+	} else if w, err = wallet.NewSeedPhraseWallet(walletPhrase, ws); err != nil {
+		return nil, nil, err
+	}
+
+	// Load the encrypted seed, if there is one, to allow locking the wallet.
+	if encryptedSeed, err := os.ReadFile(filepath.Join(walletDir, EncryptedSeedFile)); err == nil {
+		w.SetEncryptedSeed(encryptedSeed)
+	} else if !os.IsNotExist(err) {
 		return nil, nil, err
 	}
-	w := wallet.NewSingleAddressWallet(walletKey, ws)
 
 	dbDir := filepath.Join(dir, "db")
 	if err := os.MkdirAll(dbDir, 0700); err != nil {
@@ -243,31 +518,48 @@ func NewBus(cfg BusConfig, dir string, walletKey types.PrivateKey, l *zap.Logger
 		dbConn = stores.NewSQLiteConnection(filepath.Join(dbDir, "db.sqlite"))
 	}
 
-	sqlLogger := stores.NewSQLLogger(l.Named("db"), nil)
-	sqlStore, ccid, err := stores.NewSQLStore(dbConn, true, cfg.PersistInterval, sqlLogger)
+	var sqlLoggerCfg *stores.LoggerConfig
+	if cfg.SlowQueryThreshold > 0 {
+		sqlLoggerCfg = &stores.LoggerConfig{
+			IgnoreRecordNotFoundError: true,
+			LogLevel:                  glogger.Warn,
+			SlowThreshold:             cfg.SlowQueryThreshold,
+		}
+	}
+	sqlLogger := stores.NewSQLLogger(l.Named("stores"), sqlLoggerCfg)
+	// Derive the secret used to encrypt keys in the database from the wallet
+	// key unless one was provided.
+	dbSecret := cfg.DBSecret
+	if dbSecret == nil {
+		buf := append([]byte("db"), walletKey...)
+		secret := blake2b.Sum256(buf)
+		memclr(buf)
+		dbSecret = &secret
+	}
+	sqlStore, ccid, err := stores.NewSQLStore(dbConn, true, cfg.PersistInterval, dbSecret, sqlLogger)
 	if err != nil {
 		return nil, nil, err
-	} else if err := cs.ConsensusSetSubscribe(sqlStore, ccid, nil); err != nil {
+	} else if ccid, err = sqlStore.Subscribe(c.cs, ccid); err != nil {
 		return nil, nil, err
 	}
 
 	if m := cfg.Miner; m != nil {
-		if err := cs.ConsensusSetSubscribe(m, ccid, nil); err != nil {
+		if err := c.mcs.ConsensusSetSubscribe(m, ccid, nil); err != nil {
 			return nil, nil, err
 		}
-		tp.TransactionPoolSubscribe(m)
+		c.mtp.TransactionPoolSubscribe(m)
 	}
 
-	b, err := bus.New(syncer{g, tp}, chainManager{cs: cs}, txpool{tp}, w, sqlStore, sqlStore, sqlStore, sqlStore, l)
+	b, err := bus.New(c.s, c.cm, c.tp, w, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, diagnosticsStore{sqlStore, dbDir}, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, sqlStore, seedStore{walletDir}, cfg.SlabHealthInterval, cfg.SlabHealthBatchSize, l)
 	if err != nil {
 		return nil, nil, err
+	} else if err := c.cs.ConsensusSetSubscribe(&heightSubscriber{b.ProcessHeight}, modules.ConsensusChangeRecent, nil); err != nil {
+		return nil, nil, err
 	}
 
 	shutdownFn := func(ctx context.Context) error {
 		return joinErrors([]error{
-			g.Close(),
-			cs.Close(),
-			tp.Close(),
+			c.close(),
 			b.Shutdown(ctx),
 			sqlStore.Close(),
 		})
@@ -275,60 +567,51 @@ func NewBus(cfg BusConfig, dir string, walletKey types.PrivateKey, l *zap.Logger
 	return b.Handler(), shutdownFn, nil
 }
 
-func NewWorker(cfg WorkerConfig, b worker.Bus, walletKey types.PrivateKey, l *zap.Logger) (http.Handler, ShutdownFn, error) {
-	workerKey := blake2b.Sum256(append([]byte("worker"), walletKey...))
-	w := worker.New(workerKey, cfg.ID, b, cfg.SessionReconnectTimeout, cfg.SessionTTL, cfg.BusFlushInterval, cfg.DownloadSectorTimeout, cfg.UploadSectorTimeout, l)
+// WorkerKey derives the worker's default masterkey from the wallet key.
+func WorkerKey(walletKey types.PrivateKey) [32]byte {
+	buf := append([]byte("worker"), walletKey...)
+	defer memclr(buf)
+	return blake2b.Sum256(buf)
+}
+
+// memclr zeroes the given buffer, it's used to clear copies of the wallet key.
+func memclr(p []byte) {
+	for i := range p {
+		p[i] = 0
+	}
+}
+
+// WorkerAuth returns the authentication middleware for the worker API, which
+// applies the given middleware unless a download request carries a valid
+// presigned URL or read-only token.
+func WorkerAuth(masterKey [32]byte, auth func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return worker.Auth(masterKey, auth)
+}
+
+func NewWorker(cfg WorkerConfig, b worker.Bus, masterKey [32]byte, l *zap.Logger) (http.Handler, ShutdownFn, error) {
+	w := worker.New(cfg.Config, masterKey, b, l)
+	if cfg.ExternalAddr != "" {
+		w.RegisterWithBus(cfg.ExternalAddr, cfg.ExternalPassword)
+	}
 	return w.Handler(), w.Shutdown, nil
 }
 
 func NewAutopilot(cfg AutopilotConfig, s autopilot.Store, b autopilot.Bus, workers []autopilot.Worker, l *zap.Logger) (http.Handler, func() error, ShutdownFn, error) {
-	ap, err := autopilot.New(s, b, workers, l, cfg.Heartbeat, cfg.ScannerInterval, cfg.ScannerBatchSize, cfg.ScannerNumThreads, cfg.MigrationHealthCutoff, cfg.AccountsRefillInterval)
+	var provider autopilot.HostDataProvider
+	if cfg.HostDataProvider != "" {
+		var err error
+		provider, err = autopilot.NewHTTPHostDataProvider(cfg.HostDataProvider)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	ap, err := autopilot.New(s, b, workers, l, cfg.Heartbeat, cfg.ScannerInterval, cfg.ScannerBatchSize, cfg.ScannerNumThreads, cfg.MigrationHealthCutoff, cfg.AccountsRefillInterval, provider)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 	return ap.Handler(), ap.Run, ap.Shutdown, nil
 }
 
-func NewLogger(path string) (*zap.Logger, func(context.Context) error, error) {
-	writer, closeFn, err := zap.Open(path)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	// console
-	config := zap.NewProductionEncoderConfig()
-	config.EncodeTime = zapcore.RFC3339TimeEncoder
-	config.EncodeLevel = zapcore.CapitalColorLevelEncoder
-	config.StacktraceKey = ""
-	consoleEncoder := zapcore.NewConsoleEncoder(config)
-
-	// file
-	config = zap.NewProductionEncoderConfig()
-	config.EncodeTime = zapcore.RFC3339TimeEncoder
-	config.CallerKey = ""     // hide
-	config.StacktraceKey = "" // hide
-	config.NameKey = "component"
-	config.TimeKey = "date"
-	fileEncoder := zapcore.NewJSONEncoder(config)
-
-	core := zapcore.NewTee(
-		zapcore.NewCore(fileEncoder, writer, zapcore.DebugLevel),
-		zapcore.NewCore(consoleEncoder, zapcore.AddSync(os.Stdout), zapcore.DebugLevel),
-	)
-
-	logger := zap.New(
-		core,
-		zap.AddCaller(),
-		zap.AddStacktrace(zapcore.ErrorLevel),
-	)
-
-	return logger, func(_ context.Context) error {
-		_ = logger.Sync() // ignore Error
-		closeFn()
-		return nil
-	}, nil
-}
-
 func joinErrors(errs []error) error {
 	filtered := errs[:0]
 	for _, err := range errs {
@@ -0,0 +1,51 @@
+package profiling
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"strings"
+
+	"go.sia.tech/jape"
+	"go.sia.tech/renterd/api"
+)
+
+// SettingKey is the key of the bus setting that toggles the pprof endpoints,
+// they are disabled unless it's set to true.
+const SettingKey = "pprof"
+
+// ErrDisabled is returned when the pprof endpoints are requested while they
+// are disabled.
+var ErrDisabled = errors.New("pprof endpoints are disabled, set the '" + SettingKey + "' setting to true to enable them")
+
+// Handler returns a handler that serves the net/http/pprof endpoints under
+// the catch-all route param 'profile' if they are enabled through the setting
+// returned by setting.
+func Handler(setting func(ctx context.Context, key string) (string, error)) jape.Handler {
+	return func(jc jape.Context) {
+		value, err := setting(jc.Request.Context(), SettingKey)
+		if err != nil && !strings.Contains(err.Error(), api.ErrSettingNotFound.Error()) {
+			jc.Error(err, http.StatusInternalServerError)
+			return
+		} else if enabled, _ := strconv.ParseBool(value); !enabled {
+			jc.Error(ErrDisabled, http.StatusForbidden)
+			return
+		}
+
+		switch strings.TrimPrefix(jc.PathParam("profile"), "/") {
+		case "cmdline":
+			pprof.Cmdline(jc.ResponseWriter, jc.Request)
+		case "profile":
+			pprof.Profile(jc.ResponseWriter, jc.Request)
+		case "symbol":
+			pprof.Symbol(jc.ResponseWriter, jc.Request)
+		case "trace":
+			pprof.Trace(jc.ResponseWriter, jc.Request)
+		default:
+			// the index serves the named profiles
+			pprof.Index(jc.ResponseWriter, jc.Request)
+		}
+	}
+}
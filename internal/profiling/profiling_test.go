@@ -0,0 +1,50 @@
+package profiling
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.sia.tech/jape"
+	"go.sia.tech/renterd/api"
+)
+
+func TestHandler(t *testing.T) {
+	var value string
+	h := jape.Mux(map[string]jape.Handler{
+		"GET /debug/pprof/*profile": Handler(func(_ context.Context, key string) (string, error) {
+			if value == "" {
+				return "", fmt.Errorf("key '%s' err: %w", key, api.ErrSettingNotFound)
+			}
+			return value, nil
+		}),
+	})
+	get := func(path string) int {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	// assert the endpoints are disabled by default
+	if code := get("/debug/pprof/heap"); code != http.StatusForbidden {
+		t.Fatal("unexpected status", code)
+	}
+	value = "false"
+	if code := get("/debug/pprof/heap"); code != http.StatusForbidden {
+		t.Fatal("unexpected status", code)
+	}
+
+	// enable them
+	value = "true"
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/pprof/cmdline"} {
+		if code := get(path); code != http.StatusOK {
+			t.Fatal("unexpected status", path, code)
+		}
+	}
+	if code := get("/debug/pprof/foo"); code != http.StatusNotFound {
+		t.Fatal("unexpected status", code)
+	}
+}
@@ -0,0 +1,104 @@
+// Package recovery rebuilds as much metadata as possible after the metadata
+// database was lost. The renter keys are derived from the seed, which allows
+// fetching the latest revision of every contract and the roots of the sectors
+// stored in it from the hosts. The objects and slabs can't be recovered since
+// the hosts don't know which sectors belong to which slab. The object keys
+// can be re-derived from the worker key, but only together with the nonce
+// stored with each object. The recovered contracts can be used and renewed
+// though, and their sectors are protected from being pruned in case the
+// objects are restored from a backup of the metadata later.
+package recovery
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+type (
+	// A Worker fetches the latest revision and sector roots of a contract
+	// from its host.
+	Worker interface {
+		RHPContractRoots(ctx context.Context, fcid types.FileContractID, hostKey types.PublicKey, hostIP string) (api.RHPContractRootsResponse, error)
+	}
+
+	// A Store stores the recovered contracts.
+	Store interface {
+		RecoverContract(ctx context.Context, c api.ContractMetadata, rev rhpv2.ContractRevision, roots []types.Hash256) (api.ContractMetadata, error)
+	}
+)
+
+// A Result is the outcome of recovering a single contract.
+type Result struct {
+	ContractID types.FileContractID `json:"contractID"`
+	HostKey    types.PublicKey      `json:"hostKey"`
+	Sectors    int                  `json:"sectors"`
+	Error      string               `json:"error,omitempty"`
+}
+
+// A Report summarizes a recovery.
+type Report struct {
+	Contracts []Result `json:"contracts"`
+	Recovered int      `json:"recovered"`
+	Sectors   uint64   `json:"sectors"`
+}
+
+// Recover fetches the latest revision and sector roots of the given contracts
+// from their hosts and adds them to the store, the contracts only need their
+// ID, host key and host IP to be set. It recovers up to concurrency contracts
+// at a time, a contract that can't be recovered doesn't stop the recovery of
+// the others.
+func Recover(ctx context.Context, w Worker, s Store, contracts []api.ContractMetadata, concurrency int) (Report, error) {
+	if concurrency < 1 {
+		return Report{}, errors.New("concurrency must be at least 1")
+	}
+
+	results := make([]Result, len(contracts))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, c := range contracts {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return Report{}, ctx.Err()
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(i int, c api.ContractMetadata) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = recoverContract(ctx, w, s, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := Report{Contracts: results}
+	for _, res := range results {
+		if res.Error == "" {
+			report.Recovered++
+			report.Sectors += uint64(res.Sectors)
+		}
+	}
+	return report, nil
+}
+
+func recoverContract(ctx context.Context, w Worker, s Store, c api.ContractMetadata) Result {
+	res := Result{ContractID: c.ID, HostKey: c.HostKey}
+	resp, err := w.RHPContractRoots(ctx, c.ID, c.HostKey, c.HostIP)
+	if err == nil {
+		_, err = s.RecoverContract(ctx, c, resp.Revision, resp.Roots)
+	}
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.Sectors = len(resp.Roots)
+	return res
+}
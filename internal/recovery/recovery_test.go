@@ -0,0 +1,85 @@
+package recovery
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+type mockWorker struct {
+	roots map[types.FileContractID][]types.Hash256
+}
+
+func (w *mockWorker) RHPContractRoots(ctx context.Context, fcid types.FileContractID, hostKey types.PublicKey, hostIP string) (api.RHPContractRootsResponse, error) {
+	roots, ok := w.roots[fcid]
+	if !ok {
+		return api.RHPContractRootsResponse{}, errors.New("host is offline")
+	}
+	return api.RHPContractRootsResponse{
+		Revision: rhpv2.ContractRevision{Revision: types.FileContractRevision{ParentID: fcid}},
+		Roots:    roots,
+	}, nil
+}
+
+type mockStore struct {
+	mu        sync.Mutex
+	contracts map[types.FileContractID][]types.Hash256
+}
+
+func (s *mockStore) RecoverContract(ctx context.Context, c api.ContractMetadata, rev rhpv2.ContractRevision, roots []types.Hash256) (api.ContractMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if rev.ID() != c.ID {
+		return api.ContractMetadata{}, errors.New("revision doesn't match contract")
+	} else if _, ok := s.contracts[c.ID]; ok {
+		return api.ContractMetadata{}, errors.New("contract already exists")
+	}
+	s.contracts[c.ID] = roots
+	return c, nil
+}
+
+// TestRecover verifies contracts that can't be recovered don't stop the
+// recovery of the others.
+func TestRecover(t *testing.T) {
+	w := &mockWorker{roots: map[types.FileContractID][]types.Hash256{
+		{1}: {{1}, {2}},
+		{2}: nil,
+		{3}: {{3}},
+	}}
+	s := &mockStore{contracts: map[types.FileContractID][]types.Hash256{
+		{3}: nil,
+	}}
+
+	var contracts []api.ContractMetadata
+	for i := byte(1); i <= 4; i++ {
+		contracts = append(contracts, api.ContractMetadata{ID: types.FileContractID{i}, HostKey: types.PublicKey{i}})
+	}
+	report, err := Recover(context.Background(), w, s, contracts, 2)
+	if err != nil {
+		t.Fatal(err)
+	} else if report.Recovered != 2 || report.Sectors != 2 || len(report.Contracts) != len(contracts) {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	// contract 3 already exists and contract 4's host is offline
+	for i, res := range report.Contracts {
+		if res.ContractID != contracts[i].ID || res.HostKey != contracts[i].HostKey {
+			t.Fatal("unexpected result", res)
+		} else if failed := res.Error != ""; failed != (i >= 2) {
+			t.Fatal("unexpected result", res)
+		}
+	}
+	if len(s.contracts) != 3 || len(s.contracts[types.FileContractID{1}]) != 2 {
+		t.Fatal("unexpected contracts", s.contracts)
+	}
+
+	// a concurrency of zero is invalid
+	if _, err := Recover(context.Background(), w, s, contracts, 0); err == nil {
+		t.Fatal("expected error")
+	}
+}
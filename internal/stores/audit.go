@@ -0,0 +1,86 @@
+package stores
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.sia.tech/renterd/api"
+)
+
+type (
+	dbAuditEntry struct {
+		Model
+
+		Timestamp time.Time `gorm:"index;NOT NULL"`
+		Module    string    `gorm:"NOT NULL"`
+		Method    string    `gorm:"NOT NULL"`
+		Path      string    `gorm:"index;NOT NULL"`
+		Identity  string
+		Params    string
+		Status    int
+	}
+)
+
+// TableName implements the gorm.Tabler interface.
+func (dbAuditEntry) TableName() string { return "audit_entries" }
+
+// convert turns a dbAuditEntry into an api.AuditEntry.
+func (e dbAuditEntry) convert() api.AuditEntry {
+	return api.AuditEntry{
+		Timestamp: e.Timestamp.UTC(),
+		Module:    e.Module,
+		Method:    e.Method,
+		Path:      e.Path,
+		Identity:  e.Identity,
+		Params:    e.Params,
+		Status:    e.Status,
+	}
+}
+
+// AuditEntries implements the bus.AuditStore interface.
+func (s *SQLStore) AuditEntries(ctx context.Context, since time.Time, pathPrefix string, offset, limit int) ([]api.AuditEntry, error) {
+	if limit == 0 {
+		limit = -1
+	}
+
+	var entries []dbAuditEntry
+	tx := s.db.Where("timestamp >= ?", since.UTC())
+	if pathPrefix != "" {
+		tx = tx.Where("SUBSTR(path, 1, ?) = ?", len(pathPrefix), pathPrefix)
+	}
+	err := tx.Order("timestamp DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&entries).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]api.AuditEntry, len(entries))
+	for i, e := range entries {
+		out[i] = e.convert()
+	}
+	return out, nil
+}
+
+// RecordAuditEntries implements the bus.AuditStore interface.
+func (s *SQLStore) RecordAuditEntries(ctx context.Context, entries []api.AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	dbEntries := make([]dbAuditEntry, len(entries))
+	for i, e := range entries {
+		dbEntries[i] = dbAuditEntry{
+			Timestamp: e.Timestamp.UTC(),
+			Module:    e.Module,
+			Method:    strings.ToUpper(e.Method),
+			Path:      e.Path,
+			Identity:  e.Identity,
+			Params:    e.Params,
+			Status:    e.Status,
+		}
+	}
+	return s.db.Create(&dbEntries).Error
+}
@@ -1,7 +1,9 @@
 package stores
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"sync"
@@ -9,6 +11,8 @@ import (
 
 	"go.sia.tech/renterd/api"
 	"go.sia.tech/siad/modules"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // EphemeralAutopilotStore implements autopilot.Store in memory.
@@ -115,3 +119,102 @@ func NewJSONAutopilotStore(dir string) (*JSONAutopilotStore, error) {
 	}
 	return s, nil
 }
+
+const (
+	// autopilotStateID defines the primary key of the entry in the
+	// autopilot_states table.
+	autopilotStateID = 1
+)
+
+// dbAutopilotState is the state the autopilot persists in the bus, the table
+// contains a single entry with the autopilotStateID primary key.
+type dbAutopilotState struct {
+	Model
+
+	CurrentPeriod   uint64 `gorm:"NOT NULL;default:0"`
+	LastMaintenance time.Time
+	LastScan        time.Time
+	LastMigration   time.Time
+
+	// migration cursor
+	MigrationStarted  time.Time
+	MigrationPriority float64 `gorm:"NOT NULL;default:0"`
+	MigrationSlabID   uint    `gorm:"NOT NULL;default:0"`
+	MigrationMigrated uint64  `gorm:"NOT NULL;default:0"`
+	MigrationFailed   uint64  `gorm:"NOT NULL;default:0"`
+	MigrationJobID    uint    `gorm:"NOT NULL;default:0"`
+}
+
+// TableName implements the gorm.Tabler interface.
+func (dbAutopilotState) TableName() string { return "autopilot_states" }
+
+// convert turns a dbAutopilotState into an api.AutopilotState.
+func (s dbAutopilotState) convert() api.AutopilotState {
+	return api.AutopilotState{
+		CurrentPeriod:   s.CurrentPeriod,
+		LastMaintenance: s.LastMaintenance.UTC(),
+		LastScan:        s.LastScan.UTC(),
+		LastMigration:   s.LastMigration.UTC(),
+		MigrationCursor: api.MigrationCursor{
+			Started:  s.MigrationStarted.UTC(),
+			Priority: s.MigrationPriority,
+			SlabID:   api.SlabID(s.MigrationSlabID),
+			Migrated: s.MigrationMigrated,
+			Failed:   s.MigrationFailed,
+			JobID:    s.MigrationJobID,
+		},
+	}
+}
+
+// AutopilotState implements the bus.AutopilotStateStore interface. It returns
+// the zero state if the autopilot didn't persist its state yet.
+func (s *SQLStore) AutopilotState(ctx context.Context) (api.AutopilotState, error) {
+	var state dbAutopilotState
+	err := s.db.
+		WithContext(ctx).
+		Where(&dbAutopilotState{Model: Model{ID: autopilotStateID}}).
+		Take(&state).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return api.AutopilotState{}, nil
+	} else if err != nil {
+		return api.AutopilotState{}, err
+	}
+	return state.convert(), nil
+}
+
+// UpdateAutopilotState implements the bus.AutopilotStateStore interface.
+func (s *SQLStore) UpdateAutopilotState(ctx context.Context, state api.AutopilotState) error {
+	return s.db.
+		WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "id"}},
+			DoUpdates: clause.AssignmentColumns([]string{
+				"current_period",
+				"last_maintenance",
+				"last_scan",
+				"last_migration",
+				"migration_started",
+				"migration_priority",
+				"migration_slab_id",
+				"migration_migrated",
+				"migration_failed",
+				"migration_job_id",
+			}),
+		}).
+		Create(&dbAutopilotState{
+			Model:           Model{ID: autopilotStateID},
+			CurrentPeriod:   state.CurrentPeriod,
+			LastMaintenance: state.LastMaintenance.UTC(),
+			LastScan:        state.LastScan.UTC(),
+			LastMigration:   state.LastMigration.UTC(),
+
+			MigrationStarted:  state.MigrationCursor.Started.UTC(),
+			MigrationPriority: state.MigrationCursor.Priority,
+			MigrationSlabID:   uint(state.MigrationCursor.SlabID),
+			MigrationMigrated: state.MigrationCursor.Migrated,
+			MigrationFailed:   state.MigrationCursor.Failed,
+			MigrationJobID:    state.MigrationCursor.JobID,
+		}).
+		Error
+}
@@ -0,0 +1,55 @@
+package stores
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.sia.tech/renterd/api"
+)
+
+// TestAutopilotState verifies the autopilot state is persisted and updated.
+func TestAutopilotState(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// no state was persisted yet
+	if state, err := db.AutopilotState(ctx); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(state, api.AutopilotState{}) {
+		t.Fatal("unexpected state", state)
+	}
+
+	// persist a state and update it, the latest state is returned
+	now := time.Now().UTC().Round(time.Second)
+	state := api.AutopilotState{
+		CurrentPeriod:   100,
+		LastMaintenance: now,
+		LastScan:        now.Add(-time.Minute),
+		MigrationCursor: api.MigrationCursor{
+			Started:  now.Add(-time.Hour),
+			Priority: 0.5,
+			SlabID:   3,
+			Migrated: 2,
+			Failed:   1,
+			JobID:    7,
+		},
+	}
+	for i := 0; i < 2; i++ {
+		state.CurrentPeriod += uint64(i)
+		if err := db.UpdateAutopilotState(ctx, state); err != nil {
+			t.Fatal(err)
+		}
+		got, err := db.AutopilotState(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, state) {
+			t.Fatalf("unexpected state %+v != %+v", got, state)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/siad/modules"
+	"gorm.io/gorm"
+)
+
+const (
+	// consensusCheckpointInterval is the number of blocks that are processed
+	// between two consensus checkpoints.
+	consensusCheckpointInterval = 144
+
+	// maxConsensusCheckpoints is the number of consensus checkpoints that are
+	// kept, older ones are pruned.
+	maxConsensusCheckpoints = 10
+)
+
+// dbConsensusCheckpoint records a consensus change the store processed along
+// with the height of the first block that wasn't processed at that point. The
+// store resubscribes from its most recent checkpoint if the consensus set
+// doesn't know its latest consensus change, e.g. after a crash.
+type dbConsensusCheckpoint struct {
+	Model
+
+	CCID   []byte `gorm:"NOT NULL"`
+	Height uint64 `gorm:"index;NOT NULL"`
+}
+
+// TableName implements the gorm.Tabler interface.
+func (dbConsensusCheckpoint) TableName() string { return "consensus_checkpoints" }
+
+// Subscribe subscribes the store to the given consensus set, starting at the
+// given consensus change. If the consensus set doesn't know that change, the
+// store resubscribes from its most recent checkpoint the consensus set knows,
+// reverting the state it recorded since, and only replays all consensus
+// changes if there is none. It returns the consensus change the store was
+// subscribed from.
+func (ss *SQLStore) Subscribe(cs ConsensusSet, ccid modules.ConsensusChangeID) (modules.ConsensusChangeID, error) {
+	err := cs.ConsensusSetSubscribe(ss, ccid, nil)
+	if !errors.Is(err, modules.ErrInvalidConsensusChangeID) {
+		return ccid, err
+	}
+
+	var checkpoints []dbConsensusCheckpoint
+	if err := ss.db.
+		Order("height DESC").
+		Order("id DESC").
+		Find(&checkpoints).
+		Error; err != nil {
+		return modules.ConsensusChangeID{}, err
+	}
+	for _, cp := range checkpoints {
+		var cpID modules.ConsensusChangeID
+		copy(cpID[:], cp.CCID)
+		if cpID == ccid {
+			continue
+		}
+		ss.logger.Warn(context.Background(), fmt.Sprintf("consensus change %v is unknown, resubscribing from checkpoint at height %v", ccid, cp.Height))
+		if err := ss.resetToCheckpoint(cpID, cp.Height); err != nil {
+			return modules.ConsensusChangeID{}, err
+		}
+		err := cs.ConsensusSetSubscribe(ss, cpID, nil)
+		if err == nil {
+			return cpID, nil
+		} else if !errors.Is(err, modules.ErrInvalidConsensusChangeID) {
+			return modules.ConsensusChangeID{}, err
+		}
+	}
+
+	ss.logger.Warn(context.Background(), fmt.Sprintf("consensus change %v is unknown and no checkpoint is usable, replaying all consensus changes", ccid))
+	if err := ss.resetToCheckpoint(modules.ConsensusChangeBeginning, 0); err != nil {
+		return modules.ConsensusChangeID{}, err
+	}
+	return modules.ConsensusChangeBeginning, cs.ConsensusSetSubscribe(ss, modules.ConsensusChangeBeginning, nil)
+}
+
+// resetToCheckpoint reverts the state that was recorded from blocks at or
+// above the given height and sets the store's consensus change to the given
+// one.
+func (ss *SQLStore) resetToCheckpoint(ccid modules.ConsensusChangeID, height uint64) error {
+	err := ss.retryTransaction(func(tx *gorm.DB) error {
+		if err := revertChainState(tx, height); err != nil {
+			return err
+		}
+		return updateCCID(tx, ccid)
+	})
+	if err != nil {
+		return err
+	}
+	ss.unappliedAnnouncements = ss.unappliedAnnouncements[:0]
+	ss.unappliedRevisions = make(map[types.FileContractID]revisionUpdate)
+	ss.unappliedProofs = make(map[types.FileContractID]uint64)
+	ss.unappliedRevertHeight = nil
+	ss.unappliedCCID = ccid
+	ss.processedHeight = height
+	ss.lastCheckpointHeight = height
+	return nil
+}
+
+// addConsensusCheckpoint records a checkpoint and prunes the oldest ones.
+func addConsensusCheckpoint(tx *gorm.DB, ccid modules.ConsensusChangeID, height uint64) error {
+	if err := tx.Create(&dbConsensusCheckpoint{CCID: ccid[:], Height: height}).Error; err != nil {
+		return err
+	}
+	var ids []uint
+	if err := tx.
+		Model(&dbConsensusCheckpoint{}).
+		Order("id DESC").
+		Offset(maxConsensusCheckpoints).
+		Limit(1).
+		Pluck("id", &ids).
+		Error; err != nil {
+		return err
+	} else if len(ids) == 0 {
+		return nil
+	}
+	return tx.Where("id <= ?", ids[0]).Delete(&dbConsensusCheckpoint{}).Error
+}
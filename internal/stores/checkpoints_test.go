@@ -0,0 +1,113 @@
+package stores
+
+import (
+	"bytes"
+	"testing"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/hostdb"
+	"go.sia.tech/siad/modules"
+)
+
+// mockConsensusSet is a consensus set that only knows some consensus changes.
+type mockConsensusSet struct {
+	known      map[modules.ConsensusChangeID]bool
+	subscribed []modules.ConsensusChangeID
+}
+
+func (cs *mockConsensusSet) ConsensusSetSubscribe(s modules.ConsensusSetSubscriber, ccid modules.ConsensusChangeID, _ <-chan struct{}) error {
+	cs.subscribed = append(cs.subscribed, ccid)
+	if ccid != modules.ConsensusChangeBeginning && !cs.known[ccid] {
+		return modules.ErrInvalidConsensusChangeID
+	}
+	return nil
+}
+
+func (cs *mockConsensusSet) Unsubscribe(modules.ConsensusSetSubscriber) {}
+
+func TestConsensusCheckpoints(t *testing.T) {
+	ss, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add two checkpoints and announcements after each of them
+	cp1, cp2 := modules.ConsensusChangeID{1}, modules.ConsensusChangeID{2}
+	if err := addConsensusCheckpoint(ss.db, cp1, 144); err != nil {
+		t.Fatal(err)
+	} else if err := addConsensusCheckpoint(ss.db, cp2, 288); err != nil {
+		t.Fatal(err)
+	}
+	hk := types.GeneratePrivateKey().PublicKey()
+	for _, height := range []uint64{100, 200, 300} {
+		if err := ss.insertTestAnnouncement(hk, hostdb.Announcement{Index: types.ChainIndex{Height: height}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// subscribing from a known change doesn't touch the checkpoints
+	cs := &mockConsensusSet{known: map[modules.ConsensusChangeID]bool{cp1: true, {3}: true}}
+	if ccid, err := ss.Subscribe(cs, modules.ConsensusChangeID{3}); err != nil {
+		t.Fatal(err)
+	} else if ccid != (modules.ConsensusChangeID{3}) {
+		t.Fatal("unexpected ccid", ccid)
+	}
+
+	// subscribing from an unknown change should fall back to the most recent
+	// checkpoint the consensus set knows
+	cs.known[modules.ConsensusChangeID{3}] = false
+	cs.subscribed = nil
+	if ccid, err := ss.Subscribe(cs, modules.ConsensusChangeID{3}); err != nil {
+		t.Fatal(err)
+	} else if ccid != cp1 {
+		t.Fatal("unexpected ccid", ccid)
+	} else if len(cs.subscribed) != 3 || cs.subscribed[1] != cp2 || cs.subscribed[2] != cp1 {
+		t.Fatal("unexpected subscriptions", cs.subscribed)
+	}
+
+	// the announcements after the checkpoint should be reverted and the
+	// newer checkpoint should be gone
+	var announcements []dbAnnouncement
+	if err := ss.db.Find(&announcements).Error; err != nil {
+		t.Fatal(err)
+	} else if len(announcements) != 1 || announcements[0].BlockHeight != 100 {
+		t.Fatal("unexpected announcements", announcements)
+	}
+	var checkpoints []dbConsensusCheckpoint
+	if err := ss.db.Find(&checkpoints).Error; err != nil {
+		t.Fatal(err)
+	} else if len(checkpoints) != 1 || !bytes.Equal(checkpoints[0].CCID, cp1[:]) {
+		t.Fatal("unexpected checkpoints", checkpoints)
+	}
+	var ci dbConsensusInfo
+	if err := ss.db.Take(&ci).Error; err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(ci.CCID, cp1[:]) {
+		t.Fatal("unexpected ccid", ci.CCID)
+	}
+
+	// without a usable checkpoint all changes are replayed
+	cs.known = nil
+	if ccid, err := ss.Subscribe(cs, cp2); err != nil {
+		t.Fatal(err)
+	} else if ccid != modules.ConsensusChangeBeginning {
+		t.Fatal("unexpected ccid", ccid)
+	}
+	if err := ss.db.Find(&announcements).Error; err != nil {
+		t.Fatal(err)
+	} else if len(announcements) != 0 {
+		t.Fatal("unexpected announcements", announcements)
+	}
+
+	// only the most recent checkpoints are kept
+	for i := 0; i < maxConsensusCheckpoints+2; i++ {
+		if err := addConsensusCheckpoint(ss.db, modules.ConsensusChangeID{byte(i)}, uint64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ss.db.Order("id ASC").Find(&checkpoints).Error; err != nil {
+		t.Fatal(err)
+	} else if len(checkpoints) != maxConsensusCheckpoints || checkpoints[0].Height != 2 {
+		t.Fatal("unexpected checkpoints", len(checkpoints))
+	}
+}
@@ -0,0 +1,187 @@
+package stores
+
+import (
+	"context"
+	"fmt"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/renterd/api"
+	"gorm.io/gorm"
+)
+
+// consistencyCheck is a check of the database's referential integrity. It
+// counts the rows of table that match the where clause. Rows of repairable
+// checks can be deleted without losing data, unless the check has a custom
+// repair.
+type consistencyCheck struct {
+	name        string
+	description string
+	table       string
+	where       string
+	repairable  bool
+	repair      func(ctx context.Context) (int64, error)
+}
+
+// consistencyChecks returns the checks run by CheckConsistency. They are run
+// in order, which makes sure repairs cascade, e.g. the shards of orphaned slabs
+// are pruned before the sectors without shards.
+func (s *SQLStore) consistencyChecks() []consistencyCheck {
+	return []consistencyCheck{
+		{
+			name:        "slices_dangling_object",
+			description: "slices that reference an object that doesn't exist",
+			table:       "slices",
+			where:       "NOT EXISTS (SELECT 1 FROM objects o WHERE o.id = slices.db_object_id)",
+			repairable:  true,
+		},
+		{
+			name:        "slices_dangling_slab",
+			description: "slices that reference a slab that doesn't exist, the object's data is lost",
+			table:       "slices",
+			where:       "NOT EXISTS (SELECT 1 FROM slabs sla WHERE sla.id = slices.db_slab_id)",
+		},
+		{
+			name:        "slices_out_of_bounds",
+			description: "slices that exceed the data of the slab they reference",
+			table:       "slices",
+			where:       fmt.Sprintf("EXISTS (SELECT 1 FROM slabs sla WHERE sla.id = slices.db_slab_id AND slices.offset + slices.length > sla.min_shards * %d)", rhpv2.SectorSize),
+		},
+		{
+			name:        "partial_slabs_dangling_object",
+			description: "partial slabs that reference an object that doesn't exist",
+			table:       "partial_slabs",
+			where:       "NOT EXISTS (SELECT 1 FROM objects o WHERE o.id = partial_slabs.db_object_id)",
+			repairable:  true,
+		},
+		{
+			name:        "slabs_orphaned",
+			description: "slabs that aren't referenced by any object",
+			table:       "slabs",
+			where: `NOT EXISTS (
+				SELECT 1 FROM slices sli
+				INNER JOIN objects o ON o.id = sli.db_object_id
+				WHERE sli.db_slab_id = slabs.id
+			)`,
+			repairable: true,
+		},
+		{
+			name:        "slabs_shard_count_mismatch",
+			description: "slabs whose number of shards doesn't match their total number of shards",
+			table:       "slabs",
+			where:       "slabs.total_shards <> (SELECT COUNT(*) FROM shards sh WHERE sh.db_slab_id = slabs.id)",
+		},
+		{
+			name:        "shards_dangling_slab",
+			description: "shards that reference a slab that doesn't exist",
+			table:       "shards",
+			where:       "NOT EXISTS (SELECT 1 FROM slabs sla WHERE sla.id = shards.db_slab_id)",
+			repairable:  true,
+		},
+		{
+			name:        "shards_dangling_sector",
+			description: "shards that reference a sector that doesn't exist, the shard's data is lost",
+			table:       "shards",
+			where:       "NOT EXISTS (SELECT 1 FROM sectors sec WHERE sec.id = shards.db_sector_id)",
+		},
+		{
+			name:        "contract_sectors_dangling",
+			description: "contract sectors that reference a contract or sector that doesn't exist",
+			table:       "contract_sectors",
+			where: `NOT EXISTS (SELECT 1 FROM contracts c WHERE c.id = contract_sectors.db_contract_id)
+				OR NOT EXISTS (SELECT 1 FROM sectors sec WHERE sec.id = contract_sectors.db_sector_id)`,
+			repairable: true,
+		},
+		{
+			name:        "host_sectors_dangling",
+			description: "host sectors that reference a host or sector that doesn't exist",
+			table:       "host_sectors",
+			where: `NOT EXISTS (SELECT 1 FROM hosts h WHERE h.id = host_sectors.db_host_id)
+				OR NOT EXISTS (SELECT 1 FROM sectors sec WHERE sec.id = host_sectors.db_sector_id)`,
+			repairable: true,
+		},
+		{
+			name:        "sectors_orphaned",
+			description: "sectors that aren't referenced by any shard",
+			table:       "sectors",
+			where:       "NOT EXISTS (SELECT 1 FROM shards sh WHERE sh.db_sector_id = sectors.id)",
+			repairable:  true,
+			repair:      s.pruneAllOrphanedSectors,
+		},
+		{
+			name:        "contracts_dangling_host",
+			description: "contracts that reference a host that doesn't exist",
+			table:       "contracts",
+			where:       "NOT EXISTS (SELECT 1 FROM hosts h WHERE h.id = contracts.host_id)",
+		},
+		{
+			name:        "contract_set_contracts_dangling",
+			description: "contract set entries that reference a contract or contract set that doesn't exist",
+			table:       "contract_set_contracts",
+			where: `NOT EXISTS (SELECT 1 FROM contracts c WHERE c.id = contract_set_contracts.db_contract_id)
+				OR NOT EXISTS (SELECT 1 FROM contract_sets cs WHERE cs.id = contract_set_contracts.db_contract_set_id)`,
+			repairable: true,
+		},
+	}
+}
+
+// CheckConsistency checks the referential integrity of the hosts, contracts,
+// sectors, slabs and objects. If repair is true, the inconsistencies that can
+// be repaired safely are repaired. Orphaned sectors are scheduled for deletion
+// from their hosts, like they are by the garbage collector.
+func (s *SQLStore) CheckConsistency(ctx context.Context, repair bool) (api.ConsistencyReport, error) {
+	var report api.ConsistencyReport
+	for _, c := range s.consistencyChecks() {
+		var n int64
+		if err := s.db.WithContext(ctx).Table(c.table).Where(c.where).Count(&n).Error; err != nil {
+			return api.ConsistencyReport{}, fmt.Errorf("check '%v' failed: %w", c.name, err)
+		}
+		res := api.ConsistencyCheck{
+			Name:            c.name,
+			Description:     c.description,
+			Inconsistencies: n,
+			Repairable:      c.repairable,
+		}
+		if repair && n > 0 && c.repairable {
+			repairFn := c.repair
+			if repairFn == nil {
+				repairFn = s.deleteInconsistentRows(c.table, c.where)
+			}
+			repaired, err := repairFn(ctx)
+			if err != nil {
+				return api.ConsistencyReport{}, fmt.Errorf("repair of '%v' failed: %w", c.name, err)
+			}
+			res.Repaired = repaired
+		}
+		report.Checks = append(report.Checks, res)
+	}
+	return report, nil
+}
+
+// deleteInconsistentRows returns a repair that deletes the rows of table that
+// match the where clause.
+func (s *SQLStore) deleteInconsistentRows(table, where string) func(context.Context) (int64, error) {
+	return func(ctx context.Context) (n int64, err error) {
+		err = s.retryTransaction(func(tx *gorm.DB) error {
+			res := tx.WithContext(ctx).Exec(fmt.Sprintf("DELETE FROM %s WHERE %s", table, where))
+			n = res.RowsAffected
+			return res.Error
+		})
+		return
+	}
+}
+
+// pruneAllOrphanedSectors prunes all sectors that aren't referenced by any
+// slab.
+func (s *SQLStore) pruneAllOrphanedSectors(ctx context.Context) (int64, error) {
+	var pruned int64
+	for {
+		n, err := s.pruneOrphanedSectors(ctx, gcBatchSize)
+		if err != nil {
+			return pruned, err
+		}
+		pruned += int64(n)
+		if n < gcBatchSize {
+			return pruned, nil
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package stores
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/object"
+	"gorm.io/gorm"
+)
+
+// TestCheckConsistency verifies the consistency checker finds inconsistencies
+// and only repairs the ones that can be repaired safely.
+func TestCheckConsistency(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	hks, err := db.addTestHosts(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcids, _, err := db.addTestContracts(hks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usedContracts := map[types.PublicKey]types.FileContractID{hks[0]: fcids[0], hks[1]: fcids[1]}
+
+	// add two objects
+	for key, shards := range map[string][]object.Sector{
+		"foo": {{Host: hks[0], Root: types.Hash256{1}}, {Host: hks[1], Root: types.Hash256{2}}},
+		"bar": {{Host: hks[0], Root: types.Hash256{3}}},
+	} {
+		obj := object.Object{
+			Key: object.GenerateEncryptionKey(),
+			Slabs: []object.SlabSlice{{
+				Slab:   object.Slab{Key: object.GenerateEncryptionKey(), MinShards: 1, Shards: shards},
+				Length: 1,
+			}},
+		}
+		if err := db.UpdateObject(ctx, key, obj, usedContracts, nil, false, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	counts := func(report api.ConsistencyReport) map[string]int64 {
+		t.Helper()
+		if len(report.Checks) != len(db.consistencyChecks()) {
+			t.Fatal("unexpected number of checks", len(report.Checks))
+		}
+		m := make(map[string]int64)
+		for _, c := range report.Checks {
+			if c.Inconsistencies > 0 {
+				m[c.Name] = c.Inconsistencies
+			}
+		}
+		return m
+	}
+
+	// the database should be consistent
+	report, err := db.CheckConsistency(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	} else if !report.Consistent() || len(counts(report)) != 0 {
+		t.Fatal("unexpected inconsistencies", counts(report))
+	}
+
+	// orphan the slab of 'bar' by removing its slices
+	if err := db.db.Exec("DELETE FROM slices WHERE db_object_id = (SELECT id FROM objects WHERE object_id = ?)", "bar").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// corrupt the slab and slice of 'foo'
+	var slice dbSlice
+	if err := db.db.Joins("INNER JOIN objects o ON o.id = slices.db_object_id").Where("o.object_id", "foo").Take(&slice).Error; err != nil {
+		t.Fatal(err)
+	} else if err := db.db.Model(&dbSlab{}).Where("id", slice.DBSlabID).Update("total_shards", 3).Error; err != nil {
+		t.Fatal(err)
+	} else if err := db.db.Model(&slice).Update("length", rhpv2.SectorSize+1).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// add dangling references
+	err = db.db.Connection(func(tx *gorm.DB) error {
+		if err := tx.Exec("PRAGMA foreign_keys = OFF").Error; err != nil {
+			return err
+		}
+		defer tx.Exec("PRAGMA foreign_keys = ON")
+		if err := tx.Exec("INSERT INTO slices (created_at, db_object_id, db_slab_id, offset, length) VALUES (CURRENT_TIMESTAMP, 999, ?, 0, 1)", slice.DBSlabID).Error; err != nil {
+			return err
+		} else if err := tx.Exec("INSERT INTO contract_sectors (db_contract_id, db_sector_id) SELECT 999, id FROM sectors LIMIT 1").Error; err != nil {
+			return err
+		}
+		return tx.Exec("INSERT INTO contract_set_contracts (db_contract_set_id, db_contract_id) SELECT 999, id FROM contracts LIMIT 1").Error
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]int64{
+		"slices_dangling_object":          1,
+		"slices_out_of_bounds":            1,
+		"slabs_orphaned":                  1,
+		"slabs_shard_count_mismatch":      1,
+		"contract_sectors_dangling":       1,
+		"contract_set_contracts_dangling": 1,
+	}
+	report, err = db.CheckConsistency(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	} else if report.Consistent() {
+		t.Fatal("expected inconsistencies")
+	} else if got := counts(report); !reflect.DeepEqual(got, expected) {
+		t.Fatal("unexpected inconsistencies", got)
+	}
+
+	// repair them, pruning the orphaned slab orphans its sector which
+	// should be pruned as well
+	report, err = db.CheckConsistency(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected["sectors_orphaned"] = 1
+	if got := counts(report); !reflect.DeepEqual(got, expected) {
+		t.Fatal("unexpected inconsistencies", got)
+	}
+	for _, c := range report.Checks {
+		if c.Repairable && c.Repaired != c.Inconsistencies {
+			t.Fatalf("check %v wasn't repaired, %d/%d", c.Name, c.Repaired, c.Inconsistencies)
+		} else if !c.Repairable && c.Repaired != 0 {
+			t.Fatalf("check %v shouldn't be repaired", c.Name)
+		}
+	}
+
+	// the pruned sector should be scheduled for deletion
+	if deletions, err := db.SectorDeletions(ctx, -1); err != nil {
+		t.Fatal(err)
+	} else if len(deletions) != 1 || len(deletions[0].Roots) != 1 || deletions[0].Roots[0] != (types.Hash256{3}) {
+		t.Fatal("unexpected deletions", deletions)
+	}
+
+	// only the inconsistencies that can't be repaired safely remain
+	report, err = db.CheckConsistency(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	} else if got := counts(report); !reflect.DeepEqual(got, map[string]int64{
+		"slices_out_of_bounds":       1,
+		"slabs_shard_count_mismatch": 1,
+	}) {
+		t.Fatal("unexpected inconsistencies", got)
+	}
+}
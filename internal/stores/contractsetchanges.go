@@ -0,0 +1,94 @@
+package stores
+
+import (
+	"context"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"gorm.io/gorm"
+)
+
+type (
+	// dbContractSetChange records a contract being added to or removed from
+	// a contract set.
+	dbContractSetChange struct {
+		Model
+
+		Name  string         `gorm:"index;NOT NULL"`
+		FCID  fileContractID `gorm:"NOT NULL;column:fcid;size:32"`
+		Added bool           `gorm:"NOT NULL"`
+	}
+)
+
+// TableName implements the gorm.Tabler interface.
+func (dbContractSetChange) TableName() string { return "contract_set_changes" }
+
+// ContractSetDiff returns the contracts that were added to and removed from
+// the given contract set since the given time, in the order they changed.
+func (s *SQLStore) ContractSetDiff(ctx context.Context, name string, since time.Time) (api.ContractSetDiff, error) {
+	var changes []dbContractSetChange
+	err := s.db.
+		WithContext(ctx).
+		Where("name = ? AND created_at >= ?", name, since).
+		Order("id ASC").
+		Find(&changes).
+		Error
+	if err != nil {
+		return api.ContractSetDiff{}, err
+	}
+
+	diff := api.ContractSetDiff{
+		Added:   []api.ContractSetChange{},
+		Removed: []api.ContractSetChange{},
+	}
+	for _, c := range changes {
+		change := api.ContractSetChange{
+			ContractID: types.FileContractID(c.FCID),
+			Time:       c.CreatedAt.UTC(),
+		}
+		if c.Added {
+			diff.Added = append(diff.Added, change)
+		} else {
+			diff.Removed = append(diff.Removed, change)
+		}
+	}
+	return diff, nil
+}
+
+// recordContractSetChanges records the contracts that are added to and
+// removed from the set when its contracts are replaced by the given ones.
+func recordContractSetChanges(tx *gorm.DB, set dbContractSet, contracts []dbContract) error {
+	var current []fileContractID
+	if err := tx.
+		Model(&dbContract{}).
+		Joins("INNER JOIN contract_set_contracts csc ON csc.db_contract_id = contracts.id").
+		Where("csc.db_contract_set_id = ?", set.ID).
+		Pluck("contracts.fcid", &current).
+		Error; err != nil {
+		return err
+	}
+
+	inSet := make(map[fileContractID]bool, len(current))
+	for _, fcid := range current {
+		inSet[fcid] = true
+	}
+
+	var changes []dbContractSetChange
+	for _, c := range contracts {
+		if inSet[c.FCID] {
+			delete(inSet, c.FCID)
+			continue
+		}
+		changes = append(changes, dbContractSetChange{Name: set.Name, FCID: c.FCID, Added: true})
+	}
+	for _, fcid := range current {
+		if inSet[fcid] {
+			changes = append(changes, dbContractSetChange{Name: set.Name, FCID: fcid, Added: false})
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return tx.CreateInBatches(&changes, 100).Error
+}
@@ -0,0 +1,72 @@
+package stores
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestContractSetDiff verifies the changes to a contract set are recorded.
+func TestContractSetDiff(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	hks, err := db.addTestHosts(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcids, _, err := db.addTestContracts(hks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add the first two contracts to the set
+	start := time.Now().Add(-time.Second)
+	if err := db.SetContractSet(ctx, "foo", fcids[:2]); err != nil {
+		t.Fatal(err)
+	}
+	diff, err := db.ContractSetDiff(ctx, "foo", start)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(diff.Added) != 2 || len(diff.Removed) != 0 {
+		t.Fatal("unexpected diff", diff)
+	}
+
+	// replace the first contract with the third one
+	if err := db.SetContractSet(ctx, "foo", fcids[1:]); err != nil {
+		t.Fatal(err)
+	}
+	diff, err = db.ContractSetDiff(ctx, "foo", start)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(diff.Added) != 3 || len(diff.Removed) != 1 {
+		t.Fatal("unexpected diff", diff)
+	} else if diff.Added[2].ContractID != fcids[2] || diff.Removed[0].ContractID != fcids[0] {
+		t.Fatal("unexpected diff", diff)
+	}
+
+	// setting the same contracts again doesn't record any changes
+	if err := db.SetContractSet(ctx, "foo", fcids[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if diff, err := db.ContractSetDiff(ctx, "foo", start); err != nil {
+		t.Fatal(err)
+	} else if len(diff.Added) != 3 || len(diff.Removed) != 1 {
+		t.Fatal("unexpected diff", diff)
+	}
+
+	// changes before the given time and to other sets are ignored
+	if diff, err := db.ContractSetDiff(ctx, "foo", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	} else if len(diff.Added) != 0 || len(diff.Removed) != 0 {
+		t.Fatal("unexpected diff", diff)
+	}
+	if diff, err := db.ContractSetDiff(ctx, "bar", start); err != nil {
+		t.Fatal(err)
+	} else if len(diff.Added) != 0 || len(diff.Removed) != 0 {
+		t.Fatal("unexpected diff", diff)
+	}
+}
@@ -0,0 +1,100 @@
+package stores
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"go.sia.tech/renterd/object"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20"
+)
+
+var (
+	// encryptedKeyPrefix is the prefix of encrypted keys, plaintext keys are
+	// prefixed with "key:".
+	encryptedKeyPrefix = []byte("enc:")
+)
+
+// keyCipher encrypts the object and slab encryption keys stored in the
+// database. The encryption is deterministic, which is safe since the encrypted
+// keys are random, so encrypted keys can still be used in lookups. A nil
+// keyCipher stores keys in plaintext.
+type keyCipher struct {
+	encKey [32]byte
+	macKey [32]byte
+}
+
+// newKeyCipher derives a keyCipher from the given secret, it returns nil if no
+// secret is provided.
+func newKeyCipher(secret *[32]byte) *keyCipher {
+	if secret == nil {
+		return nil
+	}
+	return &keyCipher{
+		encKey: blake2b.Sum256(append(secret[:], []byte("keyencryption")...)),
+		macKey: blake2b.Sum256(append(secret[:], []byte("keymac")...)),
+	}
+}
+
+// marshalKey marshals the given key, encrypting it if necessary.
+func (kc *keyCipher) marshalKey(k object.EncryptionKey) ([]byte, error) {
+	text, err := k.MarshalText()
+	if err != nil || kc == nil {
+		return text, err
+	}
+
+	// extract the raw key
+	raw := make([]byte, 32)
+	if _, err := hex.Decode(raw, bytes.TrimPrefix(text, []byte("key:"))); err != nil {
+		return nil, err
+	}
+
+	// derive the nonce from the key to make the encryption deterministic
+	h, _ := blake2b.New256(kc.macKey[:])
+	h.Write(raw)
+	nonce := h.Sum(nil)[:chacha20.NonceSizeX]
+
+	c, err := chacha20.NewUnauthenticatedCipher(kc.encKey[:], nonce)
+	if err != nil {
+		return nil, err
+	}
+	c.XORKeyStream(raw, raw)
+
+	buf := append(nonce, raw...)
+	return []byte(string(encryptedKeyPrefix) + hex.EncodeToString(buf)), nil
+}
+
+// unmarshalKey unmarshals the given key, decrypting it if necessary. Plaintext
+// keys are always accepted so databases written before encryption was enabled
+// remain readable.
+func (kc *keyCipher) unmarshalKey(b []byte, k *object.EncryptionKey) error {
+	if !bytes.HasPrefix(b, encryptedKeyPrefix) {
+		return k.UnmarshalText(b)
+	} else if kc == nil {
+		return errors.New("can't decrypt key without a database secret")
+	}
+
+	buf, err := hex.DecodeString(string(bytes.TrimPrefix(b, encryptedKeyPrefix)))
+	if err != nil {
+		return err
+	} else if len(buf) != chacha20.NonceSizeX+32 {
+		return fmt.Errorf("invalid encrypted key length %d", len(buf))
+	}
+	nonce, raw := buf[:chacha20.NonceSizeX], buf[chacha20.NonceSizeX:]
+
+	c, err := chacha20.NewUnauthenticatedCipher(kc.encKey[:], nonce)
+	if err != nil {
+		return err
+	}
+	c.XORKeyStream(raw, raw)
+
+	// verify the nonce to catch decrypting with the wrong secret
+	h, _ := blake2b.New256(kc.macKey[:])
+	h.Write(raw)
+	if !bytes.Equal(h.Sum(nil)[:chacha20.NonceSizeX], nonce) {
+		return errors.New("failed to decrypt key, wrong database secret")
+	}
+	return k.UnmarshalText([]byte("key:" + hex.EncodeToString(raw)))
+}
@@ -0,0 +1,52 @@
+package stores
+
+import (
+	"bytes"
+	"testing"
+
+	"go.sia.tech/renterd/object"
+	"lukechampine.com/frand"
+)
+
+func TestKeyCipher(t *testing.T) {
+	var secret [32]byte
+	frand.Read(secret[:])
+	kc := newKeyCipher(&secret)
+
+	key := object.GenerateEncryptionKey()
+	plain, _ := key.MarshalText()
+
+	// encrypted keys shouldn't contain the plaintext key and be deterministic
+	enc, err := kc.marshalKey(key)
+	if err != nil {
+		t.Fatal(err)
+	} else if bytes.Contains(enc, plain[4:]) {
+		t.Fatal("key wasn't encrypted")
+	} else if enc2, _ := kc.marshalKey(key); !bytes.Equal(enc, enc2) {
+		t.Fatal("encryption isn't deterministic")
+	}
+
+	// decrypt the key
+	var dec object.EncryptionKey
+	if err := kc.unmarshalKey(enc, &dec); err != nil {
+		t.Fatal(err)
+	} else if dec.String() != key.String() {
+		t.Fatal("unexpected key")
+	}
+
+	// plaintext keys are still accepted
+	if err := kc.unmarshalKey(plain, &dec); err != nil {
+		t.Fatal(err)
+	} else if dec.String() != key.String() {
+		t.Fatal("unexpected key")
+	}
+
+	// decrypting with the wrong secret or without a secret fails
+	if err := newKeyCipher(&[32]byte{}).unmarshalKey(enc, &dec); err == nil {
+		t.Fatal("expected error")
+	}
+	var nilCipher *keyCipher
+	if err := nilCipher.unmarshalKey(enc, &dec); err == nil {
+		t.Fatal("expected error")
+	}
+}
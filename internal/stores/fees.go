@@ -0,0 +1,76 @@
+package stores
+
+import (
+	"context"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+type (
+	dbFeeMetric struct {
+		Model
+
+		Timestamp        time.Time `gorm:"index;NOT NULL"`
+		BlockHeight      uint64
+		FeePerByte       currency
+		PoolFeePerByte   currency
+		BlocksFeePerByte currency
+	}
+)
+
+// TableName implements the gorm.Tabler interface.
+func (dbFeeMetric) TableName() string { return "fee_metrics" }
+
+// convert turns a dbFeeMetric into an api.FeeMetric.
+func (m dbFeeMetric) convert() api.FeeMetric {
+	return api.FeeMetric{
+		Timestamp:   m.Timestamp.UTC(),
+		BlockHeight: m.BlockHeight,
+		FeeEstimate: api.FeeEstimate{
+			FeePerByte:       types.Currency(m.FeePerByte),
+			PoolFeePerByte:   types.Currency(m.PoolFeePerByte),
+			BlocksFeePerByte: types.Currency(m.BlocksFeePerByte),
+		},
+	}
+}
+
+// FeeMetrics implements the bus.FeeStore interface. It returns the fee
+// metrics recorded in the given time range, oldest first.
+func (s *SQLStore) FeeMetrics(ctx context.Context, start, end time.Time) ([]api.FeeMetric, error) {
+	var metrics []dbFeeMetric
+	err := s.db.
+		Where("timestamp >= ? AND timestamp <= ?", start.UTC(), end.UTC()).
+		Order("timestamp ASC").
+		Order("id ASC").
+		Find(&metrics).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]api.FeeMetric, len(metrics))
+	for i, m := range metrics {
+		out[i] = m.convert()
+	}
+	return out, nil
+}
+
+// PruneFeeMetrics implements the bus.FeeStore interface. It removes the fee
+// metrics that were recorded before the given time.
+func (s *SQLStore) PruneFeeMetrics(ctx context.Context, before time.Time) (int, error) {
+	res := s.db.Where("timestamp < ?", before.UTC()).Delete(&dbFeeMetric{})
+	return int(res.RowsAffected), res.Error
+}
+
+// RecordFeeMetric implements the bus.FeeStore interface.
+func (s *SQLStore) RecordFeeMetric(ctx context.Context, m api.FeeMetric) error {
+	return s.db.Create(&dbFeeMetric{
+		Timestamp:        m.Timestamp.UTC(),
+		BlockHeight:      m.BlockHeight,
+		FeePerByte:       currency(m.FeePerByte),
+		PoolFeePerByte:   currency(m.PoolFeePerByte),
+		BlocksFeePerByte: currency(m.BlocksFeePerByte),
+	}).Error
+}
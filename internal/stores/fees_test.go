@@ -0,0 +1,74 @@
+package stores
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+// TestFeeMetrics verifies fee metrics are returned in the requested time range
+// in chronological order and can be pruned.
+func TestFeeMetrics(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// record three metrics, one hour apart
+	start := time.Now().Add(-3 * time.Hour).Round(time.Second)
+	for i := 0; i < 3; i++ {
+		if err := db.RecordFeeMetric(ctx, api.FeeMetric{
+			Timestamp:   start.Add(time.Duration(i) * time.Hour),
+			BlockHeight: uint64(i),
+			FeeEstimate: api.FeeEstimate{
+				FeePerByte:       types.NewCurrency64(uint64(i + 1)),
+				PoolFeePerByte:   types.NewCurrency64(uint64(i + 2)),
+				BlocksFeePerByte: types.NewCurrency64(uint64(i + 3)),
+			},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// fetch all of them
+	metrics, err := db.FeeMetrics(ctx, start, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	} else if len(metrics) != 3 {
+		t.Fatalf("expected 3 metrics, got %v", len(metrics))
+	}
+	for i, m := range metrics {
+		if !m.Timestamp.Equal(start.Add(time.Duration(i) * time.Hour)) {
+			t.Fatal("unexpected timestamp", i, m.Timestamp)
+		} else if m.BlockHeight != uint64(i) {
+			t.Fatal("unexpected block height", i, m.BlockHeight)
+		} else if !m.FeePerByte.Equals(types.NewCurrency64(uint64(i+1))) || !m.PoolFeePerByte.Equals(types.NewCurrency64(uint64(i+2))) || !m.BlocksFeePerByte.Equals(types.NewCurrency64(uint64(i+3))) {
+			t.Fatal("unexpected fees", i, m.FeeEstimate)
+		}
+	}
+
+	// fetch a range
+	metrics, err = db.FeeMetrics(ctx, start.Add(time.Hour), start.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	} else if len(metrics) != 1 || metrics[0].BlockHeight != 1 {
+		t.Fatal("unexpected metrics", metrics)
+	}
+
+	// prune the oldest two
+	if pruned, err := db.PruneFeeMetrics(ctx, start.Add(90*time.Minute)); err != nil {
+		t.Fatal(err)
+	} else if pruned != 2 {
+		t.Fatalf("expected 2 pruned metrics, got %v", pruned)
+	}
+	metrics, err = db.FeeMetrics(ctx, start, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	} else if len(metrics) != 1 || metrics[0].BlockHeight != 2 {
+		t.Fatal("unexpected metrics", metrics)
+	}
+}
@@ -0,0 +1,258 @@
+package stores
+
+import (
+	"context"
+	"fmt"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"gorm.io/gorm"
+)
+
+const (
+	// gcBatchSize is the number of orphaned sectors pruned per transaction.
+	gcBatchSize = 1000
+)
+
+type (
+	// dbSectorDeletion is a sector that was pruned from the metadata and
+	// still needs to be deleted from the host of the contract it was stored
+	// on.
+	dbSectorDeletion struct {
+		Model
+
+		FCID fileContractID `gorm:"index;NOT NULL;column:fcid;size:32"`
+		Root []byte         `gorm:"index;NOT NULL;size:32"`
+	}
+)
+
+// TableName implements the gorm.Tabler interface.
+func (dbSectorDeletion) TableName() string { return "sector_deletions" }
+
+// CollectGarbage prunes slabs that are not referenced by any object and
+// sectors that are not referenced by any slab. The pruned sectors are
+// scheduled for deletion from the hosts they are stored on.
+func (s *SQLStore) CollectGarbage(ctx context.Context) (res api.GCResult, err error) {
+	// prune slabs that aren't referenced by any object, this cascades to the
+	// shards
+	err = s.retryTransaction(func(tx *gorm.DB) error {
+		prune := tx.
+			WithContext(ctx).
+			Where(`NOT EXISTS (
+				SELECT 1 FROM slices sli
+				INNER JOIN objects o ON o.id = sli.db_object_id
+				WHERE sli.db_slab_id = slabs.id
+			)`).
+			Delete(&dbSlab{})
+		res.Slabs = int(prune.RowsAffected)
+		return prune.Error
+	})
+	if err != nil {
+		return api.GCResult{}, err
+	}
+
+	// prune sectors without shards in batches
+	for {
+		n, err := s.pruneOrphanedSectors(ctx, gcBatchSize)
+		if err != nil {
+			return api.GCResult{}, err
+		}
+		res.Sectors += n
+		if n < gcBatchSize {
+			break
+		}
+	}
+	res.ReclaimedBytes = uint64(res.Sectors) * rhpv2.SectorSize
+
+	// drop deletions for contracts that no longer exist, the host isn't
+	// storing the data for us anymore
+	err = s.db.
+		WithContext(ctx).
+		Where("NOT EXISTS (SELECT 1 FROM contracts c WHERE c.fcid = sector_deletions.fcid)").
+		Delete(&dbSectorDeletion{}).
+		Error
+	return res, err
+}
+
+// pruneOrphanedSectors removes up to limit sectors that aren't referenced by
+// any slab and schedules their deletion from every contract they are stored
+// on. It returns the number of pruned sectors.
+func (s *SQLStore) pruneOrphanedSectors(ctx context.Context, limit int) (n int, err error) {
+	err = s.retryTransaction(func(tx *gorm.DB) error {
+		var sectors []dbSector
+		if err := tx.
+			WithContext(ctx).
+			Where("NOT EXISTS (SELECT 1 FROM shards sh WHERE sh.db_sector_id = sectors.id)").
+			Limit(limit).
+			Preload("Contracts").
+			Find(&sectors).
+			Error; err != nil {
+			return err
+		}
+		n = len(sectors)
+		if n == 0 {
+			return nil
+		}
+
+		ids := make([]uint, 0, len(sectors))
+		var deletions []dbSectorDeletion
+		for _, sector := range sectors {
+			ids = append(ids, sector.ID)
+			for _, c := range sector.Contracts {
+				deletions = append(deletions, dbSectorDeletion{
+					FCID: c.FCID,
+					Root: sector.Root,
+				})
+			}
+		}
+		if len(deletions) > 0 {
+			if err := tx.CreateInBatches(&deletions, 100).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Where("id IN ?", ids).Delete(&dbSector{}).Error
+	})
+	return
+}
+
+// SectorDeletions returns up to limit sectors that are scheduled for deletion,
+// grouped by contract. Sectors that were uploaded again since they got pruned
+// are skipped.
+func (s *SQLStore) SectorDeletions(ctx context.Context, limit int) ([]api.SectorDeletions, error) {
+	if limit == 0 {
+		limit = -1
+	}
+
+	var rows []struct {
+		FCID       fileContractID `gorm:"column:fcid"`
+		Root       []byte
+		PublicKey  publicKey
+		NetAddress string
+	}
+	err := s.db.
+		WithContext(ctx).
+		Select("sector_deletions.fcid, sector_deletions.root, h.public_key, h.net_address").
+		Model(&dbSectorDeletion{}).
+		Joins("INNER JOIN contracts c ON c.fcid = sector_deletions.fcid").
+		Joins("INNER JOIN hosts h ON h.id = c.host_id").
+		Where("NOT EXISTS (SELECT 1 FROM sectors sec WHERE sec.root = sector_deletions.root)").
+		Order("sector_deletions.fcid ASC").
+		Order("sector_deletions.id ASC").
+		Limit(limit).
+		Find(&rows).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	var deletions []api.SectorDeletions
+	for _, row := range rows {
+		fcid := types.FileContractID(row.FCID)
+		if len(deletions) == 0 || deletions[len(deletions)-1].ContractID != fcid {
+			deletions = append(deletions, api.SectorDeletions{
+				ContractID: fcid,
+				HostKey:    types.PublicKey(row.PublicKey),
+				HostIP:     row.NetAddress,
+			})
+		}
+		var root types.Hash256
+		copy(root[:], row.Root)
+		d := &deletions[len(deletions)-1]
+		d.Roots = append(d.Roots, root)
+	}
+	return deletions, nil
+}
+
+// ContractSectorDeletions returns the roots of the sectors that are scheduled
+// for deletion from the given contract and weren't uploaded again since they
+// got pruned.
+func (s *SQLStore) ContractSectorDeletions(ctx context.Context, id types.FileContractID) ([]types.Hash256, error) {
+	var rows [][]byte
+	err := s.db.
+		WithContext(ctx).
+		Model(&dbSectorDeletion{}).
+		Where("fcid = ?", fileContractID(id)).
+		Where("NOT EXISTS (SELECT 1 FROM sectors sec WHERE sec.root = sector_deletions.root)").
+		Order("id ASC").
+		Pluck("root", &rows).
+		Error
+	if err != nil {
+		return nil, err
+	}
+	roots := make([]types.Hash256, len(rows))
+	for i, root := range rows {
+		copy(roots[i][:], root)
+	}
+	return roots, nil
+}
+
+// RemoveSectorDeletions removes the given sectors from the deletion schedule,
+// usually after they were deleted from the host.
+func (s *SQLStore) RemoveSectorDeletions(ctx context.Context, deletions []api.SectorDeletions) error {
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		for _, d := range deletions {
+			if len(d.Roots) == 0 {
+				continue
+			}
+			roots := make([][]byte, len(d.Roots))
+			for i := range d.Roots {
+				roots[i] = d.Roots[i][:]
+			}
+			if err := tx.
+				WithContext(ctx).
+				Where("fcid = ? AND root IN ?", fileContractID(d.ContractID), roots).
+				Delete(&dbSectorDeletion{}).
+				Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// ContractRoots returns the roots of the sectors that are stored on the given
+// contract and still referenced by the metadata or were recovered from the
+// host. Any other sector the host stores for the contract can be pruned.
+func (s *SQLStore) ContractRoots(ctx context.Context, id types.FileContractID) ([]types.Hash256, error) {
+	contract, err := s.contract(ctx, fileContractID(id))
+	if err != nil {
+		return nil, err
+	} else if contract.RootsUnknown {
+		return nil, fmt.Errorf("%w: %v", api.ErrContractRootsUnknown, id)
+	}
+
+	var rows [][]byte
+	err = s.db.
+		WithContext(ctx).
+		Model(&dbSector{}).
+		Joins("INNER JOIN contract_sectors se ON se.db_sector_id = sectors.id").
+		Where("se.db_contract_id = ?", contract.ID).
+		Order("sectors.id ASC").
+		Pluck("sectors.root", &rows).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	roots := make([]types.Hash256, len(rows))
+	seen := make(map[types.Hash256]struct{}, len(rows))
+	for i, root := range rows {
+		copy(roots[i][:], root)
+		seen[roots[i]] = struct{}{}
+	}
+
+	// add the roots that were recovered from the host, they aren't
+	// referenced by any slab but shouldn't be pruned either
+	recovered, err := recoveredRoots(s.db.WithContext(ctx), contract.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, root := range recovered {
+		if _, ok := seen[root]; !ok {
+			seen[root] = struct{}{}
+			roots = append(roots, root)
+		}
+	}
+	return roots, nil
+}
@@ -0,0 +1,146 @@
+package stores
+
+import (
+	"context"
+	"testing"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/object"
+)
+
+// TestCollectGarbage verifies sectors that are no longer referenced are
+// pruned and scheduled for deletion from their hosts.
+func TestCollectGarbage(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	hks, err := db.addTestHosts(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcids, _, err := db.addTestContracts(hks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usedContracts := map[types.PublicKey]types.FileContractID{hks[0]: fcids[0], hks[1]: fcids[1]}
+
+	// add two objects
+	for key, shards := range map[string][]object.Sector{
+		"foo": {{Host: hks[0], Root: types.Hash256{1}}, {Host: hks[1], Root: types.Hash256{2}}},
+		"bar": {{Host: hks[0], Root: types.Hash256{3}}},
+	} {
+		obj := object.Object{
+			Key: object.GenerateEncryptionKey(),
+			Slabs: []object.SlabSlice{{
+				Slab: object.Slab{Key: object.GenerateEncryptionKey(), MinShards: 1, Shards: shards},
+			}},
+		}
+		if err := db.UpdateObject(ctx, key, obj, usedContracts, nil, false, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the first contract stores a sector of both objects
+	if roots, err := db.ContractRoots(ctx, fcids[0]); err != nil {
+		t.Fatal(err)
+	} else if len(roots) != 2 {
+		t.Fatal("unexpected roots", roots)
+	}
+	if sizes, err := db.ContractSizes(ctx); err != nil {
+		t.Fatal(err)
+	} else if len(sizes) != 2 || sizes[fcids[0]] != 2*rhpv2.SectorSize || sizes[fcids[1]] != rhpv2.SectorSize {
+		t.Fatal("unexpected sizes", sizes)
+	}
+
+	// nothing to collect yet
+	if res, err := db.CollectGarbage(ctx); err != nil {
+		t.Fatal(err)
+	} else if res.Slabs != 0 || res.Sectors != 0 {
+		t.Fatal("unexpected result", res)
+	}
+
+	// remove 'foo', its sectors are orphaned
+	if err := db.RemoveObject(ctx, "foo", ""); err != nil {
+		t.Fatal(err)
+	}
+	res, err := db.CollectGarbage(ctx)
+	if err != nil {
+		t.Fatal(err)
+	} else if res.Sectors != 2 || res.ReclaimedBytes != 2*rhpv2.SectorSize {
+		t.Fatal("unexpected result", res)
+	}
+	var count int64
+	if err := db.db.Model(&dbSector{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	} else if count != 1 {
+		t.Fatal("unexpected number of sectors", count)
+	}
+
+	// only the sector of 'bar' is still referenced by the first contract
+	if roots, err := db.ContractRoots(ctx, fcids[0]); err != nil {
+		t.Fatal(err)
+	} else if len(roots) != 1 || roots[0] != (types.Hash256{3}) {
+		t.Fatal("unexpected roots", roots)
+	}
+	if roots, err := db.ContractRoots(ctx, fcids[1]); err != nil {
+		t.Fatal(err)
+	} else if len(roots) != 0 {
+		t.Fatal("unexpected roots", roots)
+	}
+
+	// the sectors are scheduled for deletion on their contracts
+	deletions, err := db.SectorDeletions(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(deletions) != 2 {
+		t.Fatal("unexpected deletions", deletions)
+	}
+	for _, d := range deletions {
+		if len(d.Roots) != 1 || (d.ContractID == fcids[0] && d.Roots[0] != types.Hash256{1}) || (d.ContractID == fcids[1] && d.Roots[0] != types.Hash256{2}) {
+			t.Fatal("unexpected deletion", d)
+		}
+		if (d.ContractID == fcids[0] && d.HostKey != hks[0]) || (d.ContractID == fcids[1] && d.HostKey != hks[1]) {
+			t.Fatal("unexpected host", d.HostKey)
+		}
+	}
+
+	// a sector that is uploaded again isn't deleted
+	obj := object.Object{
+		Key: object.GenerateEncryptionKey(),
+		Slabs: []object.SlabSlice{{
+			Slab: object.Slab{Key: object.GenerateEncryptionKey(), MinShards: 1, Shards: []object.Sector{{Host: hks[1], Root: types.Hash256{2}}}},
+		}},
+	}
+	if err := db.UpdateObject(ctx, "baz", obj, usedContracts, nil, false, ""); err != nil {
+		t.Fatal(err)
+	}
+	if deletions, err := db.SectorDeletions(ctx, 0); err != nil {
+		t.Fatal(err)
+	} else if len(deletions) != 1 || deletions[0].ContractID != fcids[0] {
+		t.Fatal("unexpected deletions", deletions)
+	}
+	if roots, err := db.ContractSectorDeletions(ctx, fcids[0]); err != nil {
+		t.Fatal(err)
+	} else if len(roots) != 1 || roots[0] != (types.Hash256{1}) {
+		t.Fatal("unexpected roots", roots)
+	}
+	if roots, err := db.ContractSectorDeletions(ctx, fcids[1]); err != nil {
+		t.Fatal(err)
+	} else if len(roots) != 0 {
+		t.Fatal("unexpected roots", roots)
+	}
+
+	// remove the deletions
+	if err := db.RemoveSectorDeletions(ctx, deletions); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.db.Model(&dbSectorDeletion{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	} else if count != 0 {
+		t.Fatal("unexpected number of deletions", count)
+	}
+}
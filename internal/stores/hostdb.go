@@ -7,11 +7,13 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
 	rhpv2 "go.sia.tech/core/rhp/v2"
 	rhpv3 "go.sia.tech/core/rhp/v3"
 	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
 	"go.sia.tech/renterd/hostdb"
 	"go.sia.tech/siad/modules"
 	"gorm.io/gorm"
@@ -32,6 +34,10 @@ const (
 	// database per batch. Empirically tested to verify that this is a value
 	// that performs reasonably well.
 	hostRetrievalBatchSize = 10000
+
+	// slowAnnouncementBatchThreshold is the duration above which persisting a
+	// batch of announcements is considered slow and a warning is logged.
+	slowAnnouncementBatchThreshold = 10 * time.Second
 )
 
 var (
@@ -68,9 +74,25 @@ type (
 		SuccessfulInteractions float64
 		FailedInteractions     float64
 
+		// Uploaded, Downloaded and the corresponding durations are the sums
+		// of the bytes transferred in successful sector transfers and the
+		// time they took.
+		Uploaded         uint64
+		UploadDuration   time.Duration
+		Downloaded       uint64
+		DownloadDuration time.Duration
+
 		LastAnnouncement time.Time
 		NetAddress       string `gorm:"index"`
 
+		// OperatorGroup is the group of hosts suspected to be run by the
+		// same operator the host belongs to.
+		OperatorGroup string `gorm:"index"`
+
+		// ExternalData is the data an external host-data provider reported
+		// for the host.
+		ExternalData externalData
+
 		Allowlist []dbAllowlistEntry `gorm:"many2many:host_allowlist_entry_hosts;constraint:OnDelete:CASCADE"`
 		Blocklist []dbBlocklistEntry `gorm:"many2many:host_blocklist_entry_hosts;constraint:OnDelete:CASCADE"`
 	}
@@ -107,16 +129,28 @@ type (
 		CCID []byte
 	}
 
-	// dbAnnouncement is a table used for storing all announcements. It
-	// doesn't have any relations to dbHost which means it won't
-	// automatically prune when a host is deleted.
+	// dbAnnouncement is a table used for storing the announcements of hosts.
+	// It doesn't have any relations to dbHost which means it won't
+	// automatically prune when a host is deleted, instead it's compacted to
+	// the latest announcements of every host periodically.
 	dbAnnouncement struct {
 		Model
-		HostKey publicKey `gorm:"NOT NULL"`
+		HostKey publicKey `gorm:"index;NOT NULL"`
 
-		BlockHeight uint64
+		BlockHeight uint64 `gorm:"index"`
 		BlockID     string
 		NetAddress  string
+		Timestamp   time.Time
+	}
+
+	// dbContractRevisionHeight records the height at which a revision of one
+	// of our contracts was confirmed, it's used to restore the revision
+	// height of a contract when the block containing its latest revision is
+	// reverted.
+	dbContractRevisionHeight struct {
+		Model
+		FCID   fileContractID `gorm:"index;NOT NULL;column:fcid"`
+		Height uint64         `gorm:"index;NOT NULL"`
 	}
 
 	// announcement describes an announcement for a single host.
@@ -296,8 +330,17 @@ func (h dbHost) convert() hostdb.Host {
 			Downtime:                h.Downtime,
 			SuccessfulInteractions:  h.SuccessfulInteractions,
 			FailedInteractions:      h.FailedInteractions,
+			Uploaded:                h.Uploaded,
+			UploadDuration:          h.UploadDuration,
+			Downloaded:              h.Downloaded,
+			DownloadDuration:        h.DownloadDuration,
 		},
 		PublicKey: types.PublicKey(h.PublicKey),
+		Group:     h.OperatorGroup,
+	}
+	if h.ExternalData.Provider != "" {
+		ed := hostdb.ExternalData(h.ExternalData)
+		hdbHost.External = &ed
 	}
 	if h.Settings == (hostSettings{}) {
 		hdbHost.Settings = nil
@@ -406,6 +449,24 @@ func (e *dbBlocklistEntry) AfterCreate(tx *gorm.DB) error {
 		return nil
 	}
 
+	// public key entries only block the host with that key
+	if hk, ok := e.hostKey(); ok {
+		if isSQLite(tx) {
+			return tx.Exec(`INSERT OR IGNORE INTO host_blocklist_entry_hosts (db_blocklist_entry_id, db_host_id)
+SELECT @entry_id, id FROM (
+SELECT id
+FROM hosts
+WHERE public_key = @host_key
+)`, map[string]interface{}{"entry_id": e.ID, "host_key": publicKey(hk)}).Error
+		}
+		return tx.Exec(`INSERT IGNORE INTO host_blocklist_entry_hosts (db_blocklist_entry_id, db_host_id)
+SELECT @entry_id, id FROM (
+	SELECT id
+	FROM hosts
+	WHERE public_key=@host_key
+) AS _`, map[string]interface{}{"entry_id": e.ID, "host_key": publicKey(hk)}).Error
+	}
+
 	params := map[string]interface{}{
 		"entry_id":    e.ID,
 		"exact_entry": e.Entry,
@@ -444,7 +505,20 @@ func (e *dbBlocklistEntry) BeforeCreate(tx *gorm.DB) (err error) {
 	return nil
 }
 
+// hostKey returns the host's public key if the entry is a public key entry
+// rather than a net address entry.
+func (e *dbBlocklistEntry) hostKey() (hk types.PublicKey, ok bool) {
+	if !strings.HasPrefix(e.Entry, "ed25519:") {
+		return types.PublicKey{}, false
+	}
+	return hk, hk.UnmarshalText([]byte(e.Entry)) == nil
+}
+
 func (e *dbBlocklistEntry) blocks(h *dbHost) bool {
+	if hk, ok := e.hostKey(); ok {
+		return types.PublicKey(h.PublicKey) == hk
+	}
+
 	host, _, err := net.SplitHostPort(h.NetAddress)
 	if err != nil {
 		return false // do nothing
@@ -575,6 +649,66 @@ func (ss *SQLStore) Hosts(ctx context.Context, offset, limit int) ([]hostdb.Host
 	return ss.SearchHosts(ctx, offset, limit, hostFilterModeAllowed, "", nil)
 }
 
+// HostAnnouncements returns the announcements of the host with the given key
+// that weren't compacted yet, latest first.
+func (ss *SQLStore) HostAnnouncements(ctx context.Context, hostKey types.PublicKey, offset, limit int) ([]hostdb.Announcement, error) {
+	if offset < 0 {
+		return nil, ErrNegativeOffset
+	}
+
+	var announcements []dbAnnouncement
+	if err := ss.db.
+		Where("host_key = ?", publicKey(hostKey)).
+		Order("block_height DESC").
+		Order("id DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&announcements).
+		Error; err != nil {
+		return nil, err
+	}
+
+	out := make([]hostdb.Announcement, len(announcements))
+	for i, a := range announcements {
+		var id types.BlockID
+		if err := id.UnmarshalText([]byte(a.BlockID)); err != nil {
+			return nil, fmt.Errorf("failed to parse block id of announcement %v: %w", a.ID, err)
+		}
+		out[i] = hostdb.Announcement{
+			Index:      types.ChainIndex{Height: a.BlockHeight, ID: id},
+			Timestamp:  a.Timestamp.UTC(),
+			NetAddress: a.NetAddress,
+		}
+	}
+	return out, nil
+}
+
+// CompactAnnouncements removes all but the latest 'keep' announcements of
+// every host and returns the number of removed announcements. Announcements at
+// or above minHeight are always kept, since the net address of a host is
+// restored from its latest remaining announcement if a block is reverted. For
+// the same reason at least api.MinAnnouncementsPerHost have to be kept.
+func (ss *SQLStore) CompactAnnouncements(ctx context.Context, keep int, minHeight uint64) (removed int, err error) {
+	if keep < api.MinAnnouncementsPerHost {
+		return 0, fmt.Errorf("at least %v announcements per host have to be kept, got %v", api.MinAnnouncementsPerHost, keep)
+	}
+	err = ss.retryTransaction(func(tx *gorm.DB) error {
+		// the ids are selected through a derived table since MySQL doesn't
+		// allow referencing the table rows are deleted from in a subquery
+		res := tx.Exec(`DELETE FROM host_announcements WHERE id IN (
+SELECT id FROM (
+	SELECT a.id FROM host_announcements a
+	WHERE a.block_height < ? AND (
+		SELECT COUNT(*) FROM host_announcements newer
+		WHERE newer.host_key = a.host_key AND (newer.block_height > a.block_height OR (newer.block_height = a.block_height AND newer.id > a.id))
+	) >= ?
+) AS compacted)`, minHeight, keep)
+		removed = int(res.RowsAffected)
+		return res.Error
+	})
+	return
+}
+
 func (ss *SQLStore) RemoveOfflineHosts(ctx context.Context, minRecentFailures uint64, maxDowntime time.Duration) (removed uint64, err error) {
 	tx := ss.db.
 		Model(&dbHost{}).
@@ -643,6 +777,59 @@ func (ss *SQLStore) UpdateHostBlocklistEntries(ctx context.Context, add, remove
 	})
 }
 
+// UpdateHostGroups assigns the given hosts to their operator group, an empty
+// group removes a host from its group.
+func (ss *SQLStore) UpdateHostGroups(ctx context.Context, groups map[types.PublicKey]string) error {
+	if len(groups) == 0 {
+		return nil
+	}
+	return ss.retryTransaction(func(tx *gorm.DB) error {
+		for hk, group := range groups {
+			var count int64
+			if err := tx.Model(&dbHost{}).Where("public_key = ?", publicKey(hk)).Count(&count).Error; err != nil {
+				return err
+			} else if count == 0 {
+				return fmt.Errorf("%w: %v", ErrHostNotFound, hk)
+			}
+			err := tx.
+				Model(&dbHost{}).
+				Where("public_key = ?", publicKey(hk)).
+				Update("operator_group", group).
+				Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateHostExternalData stores the data an external host-data provider
+// reported for the given hosts, hosts that are unknown are skipped since they
+// might have been removed while the provider was queried.
+func (ss *SQLStore) UpdateHostExternalData(ctx context.Context, data map[types.PublicKey]hostdb.ExternalData) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return ss.retryTransaction(func(tx *gorm.DB) error {
+		for hk, ed := range data {
+			if ed.Provider == "" {
+				return fmt.Errorf("external data for host %v has no provider", hk)
+			}
+			ed.Updated = ed.Updated.UTC()
+			err := tx.
+				Model(&dbHost{}).
+				Where("public_key = ?", publicKey(hk)).
+				Update("external_data", externalData(ed)).
+				Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (ss *SQLStore) HostAllowlist(ctx context.Context) (allowlist []types.PublicKey, err error) {
 	var pubkeys []publicKey
 	err = ss.db.
@@ -745,6 +932,21 @@ func (ss *SQLStore) RecordInteractions(ctx context.Context, interactions []hostd
 					host.PriceTable = convertHostPriceTable(sr.PriceTable)
 				}
 			}
+			isUpload := interaction.Type == hostdb.InteractionTypeUpload
+			isDownload := interaction.Type == hostdb.InteractionTypeDownload
+			if interaction.Success && (isUpload || isDownload) {
+				var tr hostdb.TransferResult
+				if err := json.Unmarshal(interaction.Result, &tr); err != nil {
+					return err
+				}
+				if isUpload {
+					host.Uploaded += tr.Bytes
+					host.UploadDuration += tr.Elapsed
+				} else {
+					host.Downloaded += tr.Bytes
+					host.DownloadDuration += tr.Elapsed
+				}
+			}
 
 			// Save to map again.
 			hostMap[host.PublicKey] = host
@@ -770,6 +972,10 @@ func (ss *SQLStore) RecordInteractions(ctx context.Context, interactions []hostd
 					"price_table":                 h.PriceTable,
 					"successful_interactions":     h.SuccessfulInteractions,
 					"failed_interactions":         h.FailedInteractions,
+					"uploaded":                    h.Uploaded,
+					"upload_duration":             h.UploadDuration,
+					"downloaded":                  h.Downloaded,
+					"download_duration":           h.DownloadDuration,
 				}).Error
 			if err != nil {
 				return err
@@ -779,11 +985,75 @@ func (ss *SQLStore) RecordInteractions(ctx context.Context, interactions []hostd
 	})
 }
 
+// consensusStats keeps track of the processing of consensus changes.
+type consensusStats struct {
+	mu                   sync.Mutex
+	processedHeight      uint64
+	lastProcessed        time.Time
+	pendingAnnouncements int
+	batches              uint64
+	failedBatches        uint64
+	lastBatchSize        int
+	lastBatchDuration    time.Duration
+	maxBatchDuration     time.Duration
+	totalBatchDuration   time.Duration
+}
+
+func (cs *consensusStats) processed(height uint64, pending int) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.processedHeight = height
+	cs.lastProcessed = time.Now()
+	cs.pendingAnnouncements = pending
+}
+
+func (cs *consensusStats) persisted(size int, d time.Duration, failed bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.pendingAnnouncements = 0
+	cs.batches++
+	if failed {
+		cs.failedBatches++
+	}
+	cs.lastBatchSize = size
+	cs.lastBatchDuration = d
+	cs.totalBatchDuration += d
+	if d > cs.maxBatchDuration {
+		cs.maxBatchDuration = d
+	}
+}
+
+// ConsensusProcessingStats returns statistics about the processing of
+// consensus changes. The tip height and the number of blocks behind are left
+// for the caller to fill in since the store doesn't know the tip.
+func (ss *SQLStore) ConsensusProcessingStats() api.ConsensusProcessingStats {
+	cs := &ss.consensusStats
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	stats := api.ConsensusProcessingStats{
+		ProcessedHeight:           cs.processedHeight,
+		LastProcessed:             cs.lastProcessed,
+		PendingAnnouncements:      cs.pendingAnnouncements,
+		AnnouncementBatches:       cs.batches,
+		FailedAnnouncementBatches: cs.failedBatches,
+		LastBatchSize:             cs.lastBatchSize,
+		LastBatchDuration:         cs.lastBatchDuration,
+		MaxBatchDuration:          cs.maxBatchDuration,
+	}
+	if cs.batches > 0 {
+		stats.AvgBatchDuration = cs.totalBatchDuration / time.Duration(cs.batches)
+	}
+	return stats
+}
+
 // ProcessConsensusChange implements consensus.Subscriber.
 func (ss *SQLStore) ProcessConsensusChange(cc modules.ConsensusChange) {
+	// NOTE: the applied blocks replace the reverted ones, so the state that
+	// was recorded for the reverted blocks starts at the height of the first
+	// applied block.
 	height := uint64(cc.InitialHeight())
-	for range cc.RevertedBlocks {
-		height--
+	if len(cc.RevertedBlocks) > 0 {
+		ss.revertUnapplied(height)
 	}
 
 	var newAnnouncements []announcement
@@ -819,12 +1089,22 @@ func (ss *SQLStore) ProcessConsensusChange(cc modules.ConsensusChange) {
 
 	ss.unappliedAnnouncements = append(ss.unappliedAnnouncements, newAnnouncements...)
 	ss.unappliedCCID = cc.ID
+	ss.processedHeight = height
+	ss.consensusStats.processed(uint64(cc.BlockHeight), len(ss.unappliedAnnouncements))
 
 	// Apply updates.
 	if time.Since(ss.lastAnnouncementSave) > ss.persistInterval ||
 		len(ss.unappliedAnnouncements) >= announcementBatchSoftLimit ||
-		len(ss.unappliedRevisions) > 0 || len(ss.unappliedProofs) > 0 {
+		len(ss.unappliedRevisions) > 0 || len(ss.unappliedProofs) > 0 ||
+		ss.unappliedRevertHeight != nil {
+		start := time.Now()
 		err := ss.retryTransaction(func(tx *gorm.DB) error {
+			// Revert the state applied from reverted blocks first.
+			if ss.unappliedRevertHeight != nil {
+				if err := revertChainState(tx, *ss.unappliedRevertHeight); err != nil {
+					return err
+				}
+			}
 			// Apply announcements.
 			if len(ss.unappliedAnnouncements) > 0 {
 				if err := insertAnnouncements(tx, ss.unappliedAnnouncements); err != nil {
@@ -835,22 +1115,39 @@ func (ss *SQLStore) ProcessConsensusChange(cc modules.ConsensusChange) {
 				if err := updateRevisionNumberAndHeight(tx, types.FileContractID(fcid), rev.height, rev.number); err != nil {
 					return err
 				}
+				if err := tx.Create(&dbContractRevisionHeight{FCID: fileContractID(fcid), Height: rev.height}).Error; err != nil {
+					return err
+				}
 			}
 			for fcid, proofHeight := range ss.unappliedProofs {
 				if err := updateProofHeight(tx, types.FileContractID(fcid), proofHeight); err != nil {
 					return err
 				}
 			}
-			return updateCCID(tx, ss.unappliedCCID)
+			if err := updateCCID(tx, ss.unappliedCCID); err != nil {
+				return err
+			}
+			if ss.processedHeight >= ss.lastCheckpointHeight+consensusCheckpointInterval {
+				return addConsensusCheckpoint(tx, ss.unappliedCCID, ss.processedHeight)
+			}
+			return nil
 		})
+		elapsed := time.Since(start)
+		ss.consensusStats.persisted(len(ss.unappliedAnnouncements), elapsed, err != nil)
+		if err == nil && ss.processedHeight >= ss.lastCheckpointHeight+consensusCheckpointInterval {
+			ss.lastCheckpointHeight = ss.processedHeight
+		}
 		if err != nil {
 			// NOTE: print error. If we failed due to a temporary error
 			println(fmt.Sprintf("failed to apply %v announcements - should never happen", len(ss.unappliedAnnouncements)))
+		} else if elapsed > slowAnnouncementBatchThreshold {
+			ss.logger.Warn(context.Background(), "persisting %v announcements took %v, consensus processing might fall behind", len(ss.unappliedAnnouncements), elapsed)
 		}
 
 		ss.unappliedProofs = make(map[types.FileContractID]uint64)
 		ss.unappliedRevisions = make(map[types.FileContractID]revisionUpdate)
 		ss.unappliedAnnouncements = ss.unappliedAnnouncements[:0]
+		ss.unappliedRevertHeight = nil
 		ss.lastAnnouncementSave = time.Now()
 	}
 }
@@ -925,6 +1222,7 @@ func insertAnnouncements(tx *gorm.DB, as []announcement) error {
 			BlockHeight: a.announcement.Index.Height,
 			BlockID:     a.announcement.Index.ID.String(),
 			NetAddress:  a.announcement.NetAddress,
+			Timestamp:   a.announcement.Timestamp.UTC(),
 		})
 	}
 	if err := tx.Create(&announcements).Error; err != nil {
@@ -940,6 +1238,133 @@ func updateRevisionNumberAndHeight(db *gorm.DB, fcid types.FileContractID, revis
 	})
 }
 
+// revertUnapplied drops the unapplied state from blocks at or above the given
+// height and makes sure the persisted state from those blocks is reverted
+// with the next persist.
+func (ss *SQLStore) revertUnapplied(height uint64) {
+	announcements := ss.unappliedAnnouncements[:0]
+	for _, a := range ss.unappliedAnnouncements {
+		if a.announcement.Index.Height < height {
+			announcements = append(announcements, a)
+		}
+	}
+	ss.unappliedAnnouncements = announcements
+	for fcid, rev := range ss.unappliedRevisions {
+		if rev.height >= height {
+			delete(ss.unappliedRevisions, fcid)
+		}
+	}
+	for fcid, proofHeight := range ss.unappliedProofs {
+		if proofHeight >= height {
+			delete(ss.unappliedProofs, fcid)
+		}
+	}
+	if ss.unappliedRevertHeight == nil || height < *ss.unappliedRevertHeight {
+		ss.unappliedRevertHeight = &height
+	}
+	if ss.lastCheckpointHeight > height {
+		ss.lastCheckpointHeight = height
+	}
+}
+
+// revertChainState reverts the announcements, revision heights and proof
+// heights that were persisted from blocks at or above the given height.
+func revertChainState(tx *gorm.DB, height uint64) error {
+	// Remove the reverted announcements and restore the net address of the
+	// affected hosts from their latest remaining announcement.
+	var hks []publicKey
+	if err := tx.Model(&dbAnnouncement{}).
+		Where("block_height >= ?", height).
+		Distinct().
+		Pluck("host_key", &hks).
+		Error; err != nil {
+		return err
+	}
+	if err := tx.Where("block_height >= ?", height).Delete(&dbAnnouncement{}).Error; err != nil {
+		return err
+	}
+	for _, hk := range hks {
+		var a dbAnnouncement
+		err := tx.Where("host_key = ?", hk).
+			Order("block_height DESC").
+			Order("id DESC").
+			Take(&a).
+			Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			a = dbAnnouncement{} // the host was never announced on this chain
+		} else if err != nil {
+			return err
+		}
+		if err := tx.Model(&dbHost{}).
+			Where("public_key = ?", hk).
+			Updates(map[string]interface{}{
+				"net_address":       a.NetAddress,
+				"last_announcement": a.Timestamp,
+			}).
+			Error; err != nil {
+			return err
+		}
+	}
+
+	// Restore the revision height of the contracts whose latest revision was
+	// confirmed in a reverted block.
+	var fcids []fileContractID
+	for _, model := range []interface{}{&dbContractRevisionHeight{}, &dbContract{}, &dbArchivedContract{}} {
+		column := "revision_height"
+		if _, ok := model.(*dbContractRevisionHeight); ok {
+			column = "height"
+		}
+		var ids []fileContractID
+		if err := tx.Model(model).
+			Where(column+" >= ?", height).
+			Pluck("fcid", &ids).
+			Error; err != nil {
+			return err
+		}
+		fcids = append(fcids, ids...)
+	}
+	if err := tx.Where("height >= ?", height).Delete(&dbContractRevisionHeight{}).Error; err != nil {
+		return err
+	}
+	seen := make(map[fileContractID]struct{})
+	for _, fcid := range fcids {
+		if _, ok := seen[fcid]; ok {
+			continue
+		}
+		seen[fcid] = struct{}{}
+
+		var revisionHeight uint64
+		if err := tx.Model(&dbContractRevisionHeight{}).
+			Select("COALESCE(MAX(height), 0)").
+			Where("fcid = ?", fcid).
+			Scan(&revisionHeight).
+			Error; err != nil {
+			return err
+		}
+		if err := updateActiveAndArchivedContract(tx, types.FileContractID(fcid), map[string]interface{}{
+			"revision_height": revisionHeight,
+		}); err != nil {
+			return err
+		}
+	}
+
+	// Checkpoints taken after the reverted blocks were processed are dropped.
+	if err := tx.Where("height > ?", height).Delete(&dbConsensusCheckpoint{}).Error; err != nil {
+		return err
+	}
+
+	// Storage proofs from reverted blocks are no longer confirmed.
+	for _, model := range []interface{}{&dbContract{}, &dbArchivedContract{}} {
+		if err := tx.Model(model).
+			Where("proof_height >= ?", height).
+			Update("proof_height", 0).
+			Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func updateProofHeight(db *gorm.DB, fcid types.FileContractID, blockHeight uint64) error {
 	return updateActiveAndArchivedContract(db, fcid, map[string]interface{}{
 		"proof_height": blockHeight,
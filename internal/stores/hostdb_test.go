@@ -137,12 +137,20 @@ func TestSQLHostDB(t *testing.T) {
 	// Apply a consensus change.
 	ccid2 := modules.ConsensusChangeID{1, 2, 3}
 	hdb.ProcessConsensusChange(modules.ConsensusChange{
-		ID: ccid2,
+		ID:          ccid2,
+		BlockHeight: 5,
 	})
 
+	// Assert the processing was tracked.
+	if stats := hdb.ConsensusProcessingStats(); stats.ProcessedHeight != 5 || stats.AnnouncementBatches != 1 || stats.FailedAnnouncementBatches != 0 || stats.PendingAnnouncements != 0 {
+		t.Fatal("unexpected stats", stats)
+	} else if stats.LastProcessed.IsZero() || stats.AvgBatchDuration != stats.LastBatchDuration {
+		t.Fatal("unexpected stats", stats)
+	}
+
 	// Connect to the same DB again.
 	conn2 := NewEphemeralSQLiteConnection(dbName)
-	hdb2, ccid, err := NewSQLStore(conn2, false, time.Second, nil)
+	hdb2, ccid, err := NewSQLStore(conn2, false, time.Second, nil, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -245,6 +253,37 @@ func TestRecordInteractions(t *testing.T) {
 			t.Fatal("wrong host")
 		}
 	}
+
+	// Record some sector transfers, the failed one shouldn't count.
+	transfer := func(typ string, bytes uint64, elapsed time.Duration, err error) hostdb.Interaction {
+		result, _ := json.Marshal(hostdb.NewTransferResult(bytes, elapsed, err))
+		return hostdb.Interaction{
+			Host:      hk,
+			Result:    result,
+			Success:   err == nil,
+			Timestamp: time.Now(),
+			Type:      typ,
+		}
+	}
+	if err := hdb.RecordInteractions(ctx, []hostdb.Interaction{
+		transfer(hostdb.InteractionTypeUpload, 1<<22, time.Second, nil),
+		transfer(hostdb.InteractionTypeUpload, 1<<22, time.Second, errors.New("failed")),
+		transfer(hostdb.InteractionTypeUpload, 1<<22, 3*time.Second, nil),
+		transfer(hostdb.InteractionTypeDownload, 1<<20, time.Second/2, nil),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	host, err = hdb.Host(ctx, hk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host.Interactions.Uploaded != 1<<23 || host.Interactions.UploadDuration != 4*time.Second {
+		t.Fatal("unexpected upload stats", host.Interactions)
+	} else if host.Interactions.UploadThroughput() != float64(1<<21) {
+		t.Fatal("unexpected upload throughput", host.Interactions.UploadThroughput())
+	} else if host.Interactions.DownloadThroughput() != float64(1<<21) {
+		t.Fatal("unexpected download throughput", host.Interactions.DownloadThroughput())
+	}
 }
 
 func (s *SQLStore) addTestScan(hk types.PublicKey, t time.Time, err error, settings rhpv2.HostSettings) error {
@@ -650,6 +689,10 @@ func TestInsertAnnouncements(t *testing.T) {
 		t.Fatal(err)
 	}
 	ann.Model = Model{} // ignore
+	if !ann.Timestamp.Equal(ann1.announcement.Timestamp) {
+		t.Fatal("wrong timestamp", ann.Timestamp)
+	}
+	ann.Timestamp = time.Time{} // ignore
 	expectedAnn := dbAnnouncement{
 		HostKey:     ann1.hostKey,
 		BlockHeight: 1,
@@ -702,6 +745,98 @@ func TestInsertAnnouncements(t *testing.T) {
 	}
 }
 
+// TestRevertChainState is a test for revertChainState.
+func TestRevertChainState(t *testing.T) {
+	ss, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Announce a host at height 1 and again at height 3.
+	hk := types.GeneratePrivateKey().PublicKey()
+	ts1 := time.Now().Add(-time.Hour).Round(time.Second)
+	ts3 := time.Now().Round(time.Second)
+	if err := ss.insertTestAnnouncement(hk, hostdb.Announcement{
+		Index:      types.ChainIndex{Height: 1, ID: types.BlockID{1}},
+		Timestamp:  ts1,
+		NetAddress: "foo.bar:1000",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.insertTestAnnouncement(hk, hostdb.Announcement{
+		Index:      types.ChainIndex{Height: 3, ID: types.BlockID{3}},
+		Timestamp:  ts3,
+		NetAddress: "foo.bar:2000",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Announce another host only at height 4.
+	hk2 := types.GeneratePrivateKey().PublicKey()
+	if err := ss.insertTestAnnouncement(hk2, hostdb.Announcement{
+		Index:      types.ChainIndex{Height: 4, ID: types.BlockID{4}},
+		Timestamp:  ts3,
+		NetAddress: "baz.qux:1000",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Add a contract that was revised at height 2 and 4 and that has a proof
+	// at height 5.
+	fcids, _, err := ss.addTestContracts([]types.PublicKey{hk})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcid := fcids[0]
+	for _, height := range []uint64{2, 4} {
+		if err := ss.db.Create(&dbContractRevisionHeight{FCID: fileContractID(fcid), Height: height}).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := updateRevisionNumberAndHeight(ss.db, fcid, height, height); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := updateProofHeight(ss.db, fcid, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	// Revert everything from height 3 onwards.
+	if err := revertChainState(ss.db, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first host should be back at its first announcement.
+	var h dbHost
+	if err := ss.db.Where("public_key", publicKey(hk)).Take(&h).Error; err != nil {
+		t.Fatal(err)
+	} else if h.NetAddress != "foo.bar:1000" {
+		t.Fatal("wrong net address", h.NetAddress)
+	} else if !h.LastAnnouncement.Equal(ts1) {
+		t.Fatal("wrong last announcement", h.LastAnnouncement, ts1)
+	}
+
+	// The second host was never announced on this chain.
+	h = dbHost{}
+	if err := ss.db.Where("public_key", publicKey(hk2)).Take(&h).Error; err != nil {
+		t.Fatal(err)
+	} else if h.NetAddress != "" {
+		t.Fatal("wrong net address", h.NetAddress)
+	} else if !h.LastAnnouncement.IsZero() {
+		t.Fatal("wrong last announcement", h.LastAnnouncement)
+	}
+
+	// The contract's revision height should be restored and its proof should
+	// be unconfirmed.
+	var c dbContract
+	if err := ss.db.Where("fcid", fileContractID(fcid)).Take(&c).Error; err != nil {
+		t.Fatal(err)
+	} else if c.RevisionHeight != 2 {
+		t.Fatal("wrong revision height", c.RevisionHeight)
+	} else if c.ProofHeight != 0 {
+		t.Fatal("wrong proof height", c.ProofHeight)
+	}
+}
+
 func TestSQLHostAllowlist(t *testing.T) {
 	hdb, _, _, err := newTestSQLStore()
 	if err != nil {
@@ -1090,6 +1225,156 @@ func TestSQLHostBlocklist(t *testing.T) {
 	}
 }
 
+// TestUpdateHostGroups asserts hosts can be assigned to and removed from an
+// operator group.
+func TestUpdateHostGroups(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	hks, err := db.addTestHosts(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// assign both hosts to a group
+	if err := db.UpdateHostGroups(ctx, map[types.PublicKey]string{hks[0]: "foo", hks[1]: "foo"}); err != nil {
+		t.Fatal(err)
+	}
+	if h, err := db.Host(ctx, hks[0]); err != nil {
+		t.Fatal(err)
+	} else if h.Group != "foo" {
+		t.Fatal("unexpected group", h.Group)
+	}
+
+	// remove the second host from its group
+	if err := db.UpdateHostGroups(ctx, map[types.PublicKey]string{hks[1]: ""}); err != nil {
+		t.Fatal(err)
+	}
+	if h, err := db.Host(ctx, hks[1]); err != nil {
+		t.Fatal(err)
+	} else if h.Group != "" {
+		t.Fatal("unexpected group", h.Group)
+	}
+
+	// assert unknown hosts can't be assigned to a group
+	if err := db.UpdateHostGroups(ctx, map[types.PublicKey]string{{99}: "foo"}); !errors.Is(err, ErrHostNotFound) {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+// TestUpdateHostExternalData asserts the data of external host-data providers
+// is stored alongside the host.
+func TestUpdateHostExternalData(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	hks, err := db.addTestHosts(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// hosts have no external data by default
+	if h, err := db.Host(ctx, hks[0]); err != nil {
+		t.Fatal(err)
+	} else if h.External != nil {
+		t.Fatal("unexpected external data", h.External)
+	}
+
+	// update the first host and an unknown host, which is skipped
+	ed := hostdb.ExternalData{
+		Provider:   "foo",
+		Score:      0.5,
+		Benchmarks: map[string]float64{"upload": 1.5},
+		Updated:    time.Now().Round(time.Second).UTC(),
+	}
+	if err := db.UpdateHostExternalData(ctx, map[types.PublicKey]hostdb.ExternalData{hks[0]: ed, {99}: ed}); err != nil {
+		t.Fatal(err)
+	}
+	if h, err := db.Host(ctx, hks[0]); err != nil {
+		t.Fatal(err)
+	} else if h.External == nil || !reflect.DeepEqual(*h.External, ed) {
+		t.Fatal("unexpected external data", h.External)
+	}
+	hosts, err := db.Hosts(ctx, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range hosts {
+		if (h.PublicKey == hks[0]) != (h.External != nil) {
+			t.Fatal("unexpected external data", h.PublicKey, h.External)
+		}
+	}
+
+	// data without provider is rejected
+	if err := db.UpdateHostExternalData(ctx, map[types.PublicKey]hostdb.ExternalData{hks[1]: {Score: 1}}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+// TestSQLHostBlocklistPublicKey asserts blocklist entries containing a host's
+// public key block the host regardless of its address.
+func TestSQLHostBlocklistPublicKey(t *testing.T) {
+	hdb, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	isBlocked := func(hk types.PublicKey) bool {
+		t.Helper()
+		host, _ := hdb.Host(ctx, hk)
+		return host.Blocked
+	}
+
+	// add a host and block it by its public key
+	hk1 := types.GeneratePrivateKey().PublicKey()
+	if err := hdb.addCustomTestHost(hk1, "foo.net:4000"); err != nil {
+		t.Fatal(err)
+	} else if isBlocked(hk1) {
+		t.Fatal("expected host to be unblocked")
+	}
+	err = hdb.UpdateHostBlocklistEntries(ctx, []string{hk1.String()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isBlocked(hk1) {
+		t.Fatal("expected host to be blocked")
+	}
+
+	// assert the host remains blocked after rotating its address
+	if err := hdb.addCustomTestHost(hk1, "bar.org:4000"); err != nil {
+		t.Fatal(err)
+	} else if !isBlocked(hk1) {
+		t.Fatal("expected host to be blocked")
+	}
+
+	// assert other hosts are unaffected
+	hk3 := types.GeneratePrivateKey().PublicKey()
+	if err := hdb.addCustomTestHost(hk3, "bar.org:4000"); err != nil {
+		t.Fatal(err)
+	} else if isBlocked(hk3) {
+		t.Fatal("expected host to be unblocked")
+	}
+
+	// assert a host that announces after the entry was added is blocked too
+	hk2 := types.GeneratePrivateKey().PublicKey()
+	err = hdb.UpdateHostBlocklistEntries(ctx, []string{hk2.String()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hdb.addCustomTestHost(hk2, "baz.org:4000"); err != nil {
+		t.Fatal(err)
+	} else if !isBlocked(hk2) {
+		t.Fatal("expected host to be blocked")
+	}
+}
+
 // addTestHosts adds 'n' hosts to the db and returns their keys.
 func (s *SQLStore) addTestHosts(n int) (keys []types.PublicKey, err error) {
 	cnt, err := s.contractsCount()
@@ -1158,3 +1443,92 @@ func newTestScan(hk types.PublicKey, scanTime time.Time, settings rhpv2.HostSett
 		Type:      hostdb.InteractionTypeScan,
 	}
 }
+
+// TestCompactAnnouncements verifies only the latest announcements of every host
+// are kept when compacting announcements.
+func TestCompactAnnouncements(t *testing.T) {
+	hdb, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// announce two hosts, the first one 3 times and the second one once
+	hk1 := types.GeneratePrivateKey().PublicKey()
+	hk2 := types.GeneratePrivateKey().PublicKey()
+	var anns []announcement
+	for i := 0; i < 3; i++ {
+		anns = append(anns, announcement{
+			hostKey: publicKey(hk1),
+			announcement: hostdb.Announcement{
+				Index:      types.ChainIndex{Height: uint64(i + 1), ID: types.BlockID{byte(i + 1)}},
+				Timestamp:  time.Unix(int64(i+1), 0).UTC(),
+				NetAddress: fmt.Sprintf("foo.bar:%v", i),
+			},
+		})
+	}
+	anns = append(anns, announcement{
+		hostKey: publicKey(hk2),
+		announcement: hostdb.Announcement{
+			Index:      types.ChainIndex{Height: 1, ID: types.BlockID{1}},
+			Timestamp:  time.Unix(1, 0).UTC(),
+			NetAddress: "bar.baz:1000",
+		},
+	})
+	if err := insertAnnouncements(hdb.db, anns); err != nil {
+		t.Fatal(err)
+	}
+
+	// the announcements should be returned latest first
+	history, err := hdb.HostAnnouncements(ctx, hk1, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(history) != 3 {
+		t.Fatalf("expected 3 announcements, got %v", len(history))
+	} else if history[0] != anns[2].announcement || history[2] != anns[0].announcement {
+		t.Fatal("unexpected announcements", history)
+	}
+	if history, err := hdb.HostAnnouncements(ctx, hk1, 1, 1); err != nil {
+		t.Fatal(err)
+	} else if len(history) != 1 || history[0] != anns[1].announcement {
+		t.Fatal("unexpected announcements", history)
+	}
+
+	// keeping less than two announcements isn't allowed
+	if _, err := hdb.CompactAnnouncements(ctx, 0, 4); err == nil {
+		t.Fatal("expected error")
+	} else if _, err := hdb.CompactAnnouncements(ctx, 1, 4); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// announcements within the reorg depth are kept
+	if removed, err := hdb.CompactAnnouncements(ctx, 2, 1); err != nil {
+		t.Fatal(err)
+	} else if removed != 0 {
+		t.Fatalf("expected no removed announcements, got %v", removed)
+	}
+
+	// compact to 2 announcements per host
+	if removed, err := hdb.CompactAnnouncements(ctx, 2, 2); err != nil {
+		t.Fatal(err)
+	} else if removed != 1 {
+		t.Fatalf("expected 1 removed announcement, got %v", removed)
+	}
+	if history, err := hdb.HostAnnouncements(ctx, hk1, 0, -1); err != nil {
+		t.Fatal(err)
+	} else if len(history) != 2 || history[0] != anns[2].announcement || history[1] != anns[1].announcement {
+		t.Fatal("unexpected announcements", history)
+	}
+	if history, err := hdb.HostAnnouncements(ctx, hk2, 0, -1); err != nil {
+		t.Fatal(err)
+	} else if len(history) != 1 || history[0] != anns[3].announcement {
+		t.Fatal("unexpected announcements", history)
+	}
+
+	// compacting again shouldn't remove anything
+	if removed, err := hdb.CompactAnnouncements(ctx, 2, 4); err != nil {
+		t.Fatal(err)
+	} else if removed != 0 {
+		t.Fatalf("expected no removed announcements, got %v", removed)
+	}
+}
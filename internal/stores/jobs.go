@@ -0,0 +1,222 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.sia.tech/renterd/api"
+	"gorm.io/gorm"
+)
+
+// dbJob is a long-running operation tracked by the bus.
+type dbJob struct {
+	Model
+
+	Type     string `gorm:"index;NOT NULL"`
+	State    string `gorm:"index;NOT NULL"`
+	Params   []byte
+	Progress float64
+	Result   []byte
+	Error    string
+	Attempts uint64 `gorm:"NOT NULL;default:0"`
+
+	UpdatedAt time.Time
+}
+
+// TableName implements the gorm.Tabler interface.
+func (dbJob) TableName() string { return "jobs" }
+
+func (j dbJob) convert() api.Job {
+	return api.Job{
+		ID:        j.ID,
+		Type:      j.Type,
+		State:     j.State,
+		Params:    j.Params,
+		Progress:  j.Progress,
+		Result:    j.Result,
+		Error:     j.Error,
+		Attempts:  j.Attempts,
+		CreatedAt: j.CreatedAt.UTC(),
+		UpdatedAt: j.UpdatedAt.UTC(),
+	}
+}
+
+// AddJob adds a pending job of the given type.
+func (s *SQLStore) AddJob(ctx context.Context, typ string, params []byte) (api.Job, error) {
+	job := dbJob{
+		Type:   typ,
+		State:  api.JobStatePending,
+		Params: params,
+	}
+	if err := s.db.WithContext(ctx).Create(&job).Error; err != nil {
+		return api.Job{}, err
+	}
+	return job.convert(), nil
+}
+
+// Job returns the job with the given id.
+func (s *SQLStore) Job(ctx context.Context, id uint) (api.Job, error) {
+	job, err := fetchJob(s.db.WithContext(ctx), id)
+	if err != nil {
+		return api.Job{}, err
+	}
+	return job.convert(), nil
+}
+
+// Jobs returns the jobs, most recently created first. Only the jobs with the
+// given type and state are returned if they're not empty.
+func (s *SQLStore) Jobs(ctx context.Context, typ, state string, offset, limit int) ([]api.Job, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+
+	query := s.db.WithContext(ctx)
+	if typ != "" {
+		query = query.Where("type", typ)
+	}
+	if state != "" {
+		query = query.Where("state", state)
+	}
+	var jobs []dbJob
+	err := query.
+		Order("id DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&jobs).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]api.Job, len(jobs))
+	for i, job := range jobs {
+		res[i] = job.convert()
+	}
+	return res, nil
+}
+
+// AcquireJob marks the oldest pending job of one of the given types as running
+// and returns it.
+func (s *SQLStore) AcquireJob(ctx context.Context, types []string) (job api.Job, err error) {
+	err = s.retryTransaction(func(tx *gorm.DB) error {
+		var taken []uint
+		for {
+			query := tx.
+				Where("state", api.JobStatePending).
+				Where("type IN ?", types)
+			if len(taken) > 0 {
+				query = query.Where("id NOT IN ?", taken)
+			}
+			var j dbJob
+			err := query.
+				Order("id ASC").
+				Take(&j).
+				Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return api.ErrNoJobAvailable
+			} else if err != nil {
+				return err
+			}
+
+			// claim the job, it's only ours if it's still pending since
+			// another caller might have taken it after it was selected
+			res := tx.
+				Model(&dbJob{}).
+				Where("id = ? AND state = ?", j.ID, api.JobStatePending).
+				Updates(map[string]interface{}{
+					"state":    api.JobStateRunning,
+					"attempts": gorm.Expr("attempts + 1"),
+				})
+			if res.Error != nil {
+				return res.Error
+			} else if res.RowsAffected == 0 {
+				taken = append(taken, j.ID)
+				continue
+			}
+
+			j, err = fetchJob(tx, j.ID)
+			if err != nil {
+				return err
+			}
+			job = j.convert()
+			return nil
+		}
+	})
+	return
+}
+
+// UpdateJob records the progress of a running job.
+func (s *SQLStore) UpdateJob(ctx context.Context, id uint, u api.JobUpdate) error {
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		job, err := fetchJob(tx, id)
+		if err != nil {
+			return err
+		} else if job.State != api.JobStateRunning {
+			return api.ErrJobNotRunning
+		}
+		job.State = u.State
+		job.Progress = u.Progress
+		job.Result = u.Result
+		job.Error = u.Error
+		if u.State == api.JobStateDone {
+			job.Progress = 1
+		}
+		return tx.Save(&job).Error
+	})
+}
+
+// CancelJob marks a pending or running job as cancelled. It's up to the runner
+// of a running job to notice the cancellation.
+func (s *SQLStore) CancelJob(ctx context.Context, id uint) error {
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		job, err := fetchJob(tx, id)
+		if err != nil {
+			return err
+		} else if job.State != api.JobStatePending && job.State != api.JobStateRunning {
+			return api.ErrJobNotActive
+		}
+		job.State = api.JobStateCancelled
+		return tx.Save(&job).Error
+	})
+}
+
+// RetryJob marks a failed or cancelled job as pending again, dropping the
+// outcome of its previous attempt.
+func (s *SQLStore) RetryJob(ctx context.Context, id uint) error {
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		job, err := fetchJob(tx, id)
+		if err != nil {
+			return err
+		} else if job.State != api.JobStateFailed && job.State != api.JobStateCancelled {
+			return api.ErrJobNotRetryable
+		}
+		job.State = api.JobStatePending
+		job.Progress = 0
+		job.Result = nil
+		job.Error = ""
+		return tx.Save(&job).Error
+	})
+}
+
+// ResetRunningJobs marks the running jobs of the given types as pending again,
+// it's used to resume the jobs that were interrupted by a shutdown.
+func (s *SQLStore) ResetRunningJobs(ctx context.Context, types []string) (int, error) {
+	res := s.db.WithContext(ctx).
+		Model(&dbJob{}).
+		Where("state", api.JobStateRunning).
+		Where("type IN ?", types).
+		Updates(map[string]interface{}{
+			"state":    api.JobStatePending,
+			"progress": 0,
+		})
+	return int(res.RowsAffected), res.Error
+}
+
+func fetchJob(tx *gorm.DB, id uint) (job dbJob, err error) {
+	err = tx.Where("id", id).Take(&job).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = api.ErrJobNotFound
+	}
+	return
+}
@@ -0,0 +1,170 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"go.sia.tech/renterd/api"
+)
+
+// TestJobs tests the life cycle of a job.
+func TestJobs(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// add a gc job and a migration job
+	gc, err := db.AddJob(ctx, api.JobTypeGC, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migration, err := db.AddJob(ctx, api.JobTypeMigration, []byte(`{"slab":1}`))
+	if err != nil {
+		t.Fatal(err)
+	} else if migration.State != api.JobStatePending || string(migration.Params) != `{"slab":1}` {
+		t.Fatal("unexpected job", migration)
+	}
+	if jobs, err := db.Jobs(ctx, "", "", 0, -1); err != nil {
+		t.Fatal(err)
+	} else if len(jobs) != 2 || jobs[0].ID != migration.ID || jobs[1].ID != gc.ID {
+		t.Fatal("unexpected jobs", jobs)
+	}
+	if jobs, err := db.Jobs(ctx, api.JobTypeGC, api.JobStatePending, 0, -1); err != nil {
+		t.Fatal(err)
+	} else if len(jobs) != 1 || jobs[0].ID != gc.ID {
+		t.Fatal("unexpected jobs", jobs)
+	}
+
+	// only jobs of the requested types are acquired
+	if job, err := db.AcquireJob(ctx, []string{api.JobTypeMigration}); err != nil {
+		t.Fatal(err)
+	} else if job.ID != migration.ID || job.State != api.JobStateRunning || job.Attempts != 1 {
+		t.Fatal("unexpected job", job)
+	}
+	if _, err := db.AcquireJob(ctx, []string{api.JobTypeMigration}); !errors.Is(err, api.ErrNoJobAvailable) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// pending jobs can't be updated
+	if err := db.UpdateJob(ctx, gc.ID, api.JobUpdate{State: api.JobStateDone}); !errors.Is(err, api.ErrJobNotRunning) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// report progress and fail the migration
+	if err := db.UpdateJob(ctx, migration.ID, api.JobUpdate{State: api.JobStateRunning, Progress: .5}); err != nil {
+		t.Fatal(err)
+	} else if job, err := db.Job(ctx, migration.ID); err != nil {
+		t.Fatal(err)
+	} else if job.Progress != .5 {
+		t.Fatal("unexpected progress", job.Progress)
+	}
+	if err := db.UpdateJob(ctx, migration.ID, api.JobUpdate{State: api.JobStateFailed, Progress: .5, Error: "failed"}); err != nil {
+		t.Fatal(err)
+	} else if err := db.CancelJob(ctx, migration.ID); !errors.Is(err, api.ErrJobNotActive) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// retry it and have it succeed
+	if err := db.RetryJob(ctx, migration.ID); err != nil {
+		t.Fatal(err)
+	} else if job, err := db.AcquireJob(ctx, []string{api.JobTypeMigration}); err != nil {
+		t.Fatal(err)
+	} else if job.Attempts != 2 || job.Error != "" || job.Progress != 0 {
+		t.Fatal("unexpected job", job)
+	}
+	if err := db.UpdateJob(ctx, migration.ID, api.JobUpdate{State: api.JobStateDone, Result: []byte(`{"ok":true}`)}); err != nil {
+		t.Fatal(err)
+	} else if job, err := db.Job(ctx, migration.ID); err != nil {
+		t.Fatal(err)
+	} else if job.State != api.JobStateDone || job.Progress != 1 || string(job.Result) != `{"ok":true}` {
+		t.Fatal("unexpected job", job)
+	} else if err := db.RetryJob(ctx, migration.ID); !errors.Is(err, api.ErrJobNotRetryable) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// cancelled jobs can't be updated by their runner
+	if _, err := db.AcquireJob(ctx, []string{api.JobTypeGC}); err != nil {
+		t.Fatal(err)
+	} else if err := db.CancelJob(ctx, gc.ID); err != nil {
+		t.Fatal(err)
+	} else if err := db.UpdateJob(ctx, gc.ID, api.JobUpdate{State: api.JobStateDone}); !errors.Is(err, api.ErrJobNotRunning) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// running jobs interrupted by a shutdown are reset
+	if err := db.RetryJob(ctx, gc.ID); err != nil {
+		t.Fatal(err)
+	} else if _, err := db.AcquireJob(ctx, []string{api.JobTypeGC}); err != nil {
+		t.Fatal(err)
+	} else if n, err := db.ResetRunningJobs(ctx, []string{api.JobTypeGC}); err != nil || n != 1 {
+		t.Fatal("unexpected reset", n, err)
+	} else if job, err := db.Job(ctx, gc.ID); err != nil {
+		t.Fatal(err)
+	} else if job.State != api.JobStatePending {
+		t.Fatal("unexpected state", job.State)
+	}
+
+	if _, err := db.Job(ctx, 100); !errors.Is(err, api.ErrJobNotFound) {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+// TestAcquireJobConcurrently verifies that a job can't be acquired by more than
+// one caller.
+func TestAcquireJobConcurrently(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	const n = 20
+	for i := 0; i < n; i++ {
+		if _, err := db.AddJob(ctx, api.JobTypeMigration, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var mu sync.Mutex
+	acquired := make(map[uint]int)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, err := db.AcquireJob(ctx, []string{api.JobTypeMigration})
+				if errors.Is(err, api.ErrNoJobAvailable) {
+					return
+				} else if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				acquired[job.ID]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(acquired) != n {
+		t.Fatalf("expected %v jobs to be acquired, got %v", n, len(acquired))
+	}
+	for id, times := range acquired {
+		if times != 1 {
+			t.Fatalf("job %v was acquired %v times", id, times)
+		}
+	}
+	if jobs, err := db.Jobs(ctx, "", api.JobStateRunning, 0, -1); err != nil {
+		t.Fatal(err)
+	} else if len(jobs) != n {
+		t.Fatal("unexpected number of running jobs", len(jobs))
+	} else if jobs[0].Attempts != 1 {
+		t.Fatal("unexpected attempts", jobs[0].Attempts)
+	}
+}
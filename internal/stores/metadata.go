@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	rhpv2 "go.sia.tech/core/rhp/v2"
 	"go.sia.tech/core/types"
@@ -13,6 +15,23 @@ import (
 	"gorm.io/gorm"
 )
 
+// sqlSlabHealth computes the health of a slab from the number of distinct hosts
+// of the contracts that store its sectors, which are expected to be joined as
+// 'c'.
+const sqlSlabHealth = `CASE
+	WHEN (slabs.min_shards = slabs.total_shards)
+	THEN
+	  CASE
+	  WHEN (COUNT(DISTINCT(c.host_id)) < slabs.min_shards)
+	  THEN
+	    0
+	  ELSE
+	    1
+	  END
+	ELSE
+	CAST((COUNT(DISTINCT(c.host_id)) - slabs.min_shards) AS FLOAT) / Cast(slabs.total_shards - slabs.min_shards AS FLOAT)
+	END AS health`
+
 const (
 	// archivalReasonRenewed describes why a contract was archived
 	archivalReasonRenewed = "renewed"
@@ -39,7 +58,7 @@ var (
 
 	// ErrContractSetNotFound is returned when a contract can't be retrieved
 	// from the database.
-	ErrContractSetNotFound = errors.New("couldn't find contract set")
+	ErrContractSetNotFound = api.ErrContractSetNotFound
 )
 
 type (
@@ -60,6 +79,28 @@ type (
 
 		HostID uint `gorm:"index"`
 		Host   dbHost
+
+		// RemainingFunds are the renter funds left in the contract as of the
+		// latest revision reported by a worker.
+		RemainingFunds currency `gorm:"NOT NULL;default:'0'"`
+
+		// LatestRevisionNumber is the number of the latest revision reported
+		// by a worker, unlike RevisionNumber it's not necessarily on chain.
+		LatestRevisionNumber string `gorm:"NOT NULL;default:'0'"` // string since db can't store math.MaxUint64
+
+		// broadcast of the latest revision before the proof window opens
+		BroadcastHeight         uint64 `gorm:"NOT NULL;default:0"`
+		BroadcastRevisionNumber string `gorm:"NOT NULL;default:'0'"` // string since db can't store math.MaxUint64
+		BroadcastTxnID          []byte `gorm:"size:32"`
+
+		// usability flags
+		GoodForUpload bool `gorm:"index;NOT NULL;default:true"`
+		GoodForRenew  bool `gorm:"NOT NULL;default:true"`
+
+		// RootsUnknown is set for contracts that were found on the
+		// blockchain, the roots of their sectors aren't known until they
+		// are restored from the host so they can't be pruned.
+		RootsUnknown bool `gorm:"NOT NULL;default:false"`
 	}
 
 	ContractCommon struct {
@@ -76,6 +117,7 @@ type (
 
 		// spending fields
 		UploadSpending      currency
+		StorageSpending     currency
 		DownloadSpending    currency
 		FundAccountSpending currency
 	}
@@ -91,28 +133,56 @@ type (
 		Model
 
 		Key      []byte
+		KeyWrap  []byte    `gorm:"size:32"` // salt + checksum, only set for passphrase protected objects
+		KeyNonce []byte    `gorm:"size:32"` // only set if the key was derived from the worker's master key
 		ObjectID string    `gorm:"index;unique"`
 		Slabs    []dbSlice `gorm:"constraint:OnDelete:CASCADE"` // CASCADE to delete slices too
+
+		// Importance weighs the repair priority of the object's slabs.
+		Importance uint8 `gorm:"NOT NULL;default:1"`
+
+		// MinShards and TotalShards override the redundancy settings for
+		// the object, they are zero if the object uses the default
+		// redundancy.
+		MinShards   uint8 `gorm:"NOT NULL;default:0"`
+		TotalShards uint8 `gorm:"NOT NULL;default:0"`
+
+		// PartialSlab is the tail of the object that wasn't packed into a
+		// slab yet.
+		PartialSlab *dbPartialSlab `gorm:"constraint:OnDelete:CASCADE"` // CASCADE to delete the partial slab too
+
+		// ETag is the keyed hash of the object's data. The object's modification
+		// time is its creation time since objects are recreated when they
+		// are updated.
+		ETag string `gorm:"NOT NULL;default:''"`
 	}
 
 	dbSlice struct {
 		Model
 		DBObjectID uint `gorm:"index"`
 
-		// Slice related fields.
-		Slab   dbSlab `gorm:"constraint:OnDelete:CASCADE"` // CASCADE to delete slabs too
-		Offset uint32
-		Length uint32
+		// Slice related fields. Slabs can be shared between the slices of
+		// multiple objects if the tails of these objects were packed into
+		// a single slab.
+		DBSlabID uint `gorm:"index"`
+		DBSlab   dbSlab
+		Offset   uint32
+		Length   uint32
 	}
 
 	dbSlab struct {
 		Model
-		DBSliceID uint `gorm:"index"`
 
-		Key         []byte `gorm:"unique;NOT NULL;size:68"` // json string
+		Key         []byte `gorm:"unique;NOT NULL;size:116"`     // json string or encrypted key
+		KeyWrapped  bool   `gorm:"index;NOT NULL;default:false"` // wrapped slabs can't be migrated
 		MinShards   uint8
 		TotalShards uint8
 		Shards      []dbShard `gorm:"constraint:OnDelete:CASCADE"` // CASCADE to delete shards too
+
+		// PersistedHealth is the health of the slab as of HealthUpdatedAt,
+		// it's periodically recomputed by RefreshSlabHealth.
+		PersistedHealth float64   `gorm:"index;NOT NULL;default:1"`
+		HealthUpdatedAt time.Time `gorm:"index"`
 	}
 
 	dbSector struct {
@@ -185,6 +255,7 @@ func (c dbArchivedContract) convert() api.ArchivedContract {
 
 		Spending: api.ContractSpending{
 			Uploads:     types.Currency(c.UploadSpending),
+			Storage:     types.Currency(c.StorageSpending),
 			Downloads:   types.Currency(c.DownloadSpending),
 			FundAccount: types.Currency(c.FundAccountSpending),
 		},
@@ -193,8 +264,15 @@ func (c dbArchivedContract) convert() api.ArchivedContract {
 
 // convert converts a dbContract to a ContractMetadata.
 func (c dbContract) convert() api.ContractMetadata {
-	var revisionNumber uint64
+	var revisionNumber, latestRevisionNumber uint64
 	_, _ = fmt.Sscan(c.RevisionNumber, &revisionNumber)
+	_, _ = fmt.Sscan(c.LatestRevisionNumber, &latestRevisionNumber)
+	var broadcast *api.ContractBroadcast
+	if c.BroadcastHeight > 0 {
+		broadcast = &api.ContractBroadcast{Height: c.BroadcastHeight}
+		_, _ = fmt.Sscan(c.BroadcastRevisionNumber, &broadcast.RevisionNumber)
+		copy(broadcast.TransactionID[:], c.BroadcastTxnID)
+	}
 	return api.ContractMetadata{
 		ID:          types.FileContractID(c.FCID),
 		HostIP:      c.Host.NetAddress,
@@ -203,6 +281,7 @@ func (c dbContract) convert() api.ContractMetadata {
 		TotalCost:   types.Currency(c.TotalCost),
 		Spending: api.ContractSpending{
 			Uploads:     types.Currency(c.UploadSpending),
+			Storage:     types.Currency(c.StorageSpending),
 			Downloads:   types.Currency(c.DownloadSpending),
 			FundAccount: types.Currency(c.FundAccountSpending),
 		},
@@ -212,17 +291,27 @@ func (c dbContract) convert() api.ContractMetadata {
 		StartHeight:    c.StartHeight,
 		WindowStart:    c.WindowStart,
 		WindowEnd:      c.WindowEnd,
+		RemainingFunds: types.Currency(c.RemainingFunds),
+		Broadcast:      broadcast,
+
+		LatestRevisionNumber: latestRevisionNumber,
+		ContractUsability: api.ContractUsability{
+			GoodForUpload: c.GoodForUpload,
+			GoodForRenew:  c.GoodForRenew,
+		},
 	}
 }
 
 // convert turns a dbObject into a object.Slab.
-func (s dbSlab) convert() (slab object.Slab, err error) {
+func (s dbSlab) convert(kc *keyCipher) (slab object.Slab, err error) {
 	// unmarshal key
-	err = slab.Key.UnmarshalText(s.Key)
+	err = kc.unmarshalKey(s.Key, &slab.Key)
 	if err != nil {
 		return
 	}
 
+	slab.Wrapped = s.KeyWrapped
+
 	// set shards
 	slab.MinShards = s.MinShards
 	slab.Shards = make([]object.Sector, len(s.Shards))
@@ -241,17 +330,35 @@ func (s dbSlab) convert() (slab object.Slab, err error) {
 }
 
 // convert turns a dbObject into a object.Object.
-func (o dbObject) convert() (object.Object, error) {
+func (o dbObject) convert(kc *keyCipher) (object.Object, error) {
 	var objKey object.EncryptionKey
-	if err := objKey.UnmarshalText(o.Key); err != nil {
+	if err := kc.unmarshalKey(o.Key, &objKey); err != nil {
 		return object.Object{}, err
 	}
 	obj := object.Object{
-		Key:   objKey,
-		Slabs: make([]object.SlabSlice, len(o.Slabs)),
+		Key:     objKey,
+		Slabs:   make([]object.SlabSlice, len(o.Slabs)),
+		ModTime: o.CreatedAt.UTC(),
+		ETag:    o.ETag,
+	}
+	if len(o.KeyWrap) == 32 {
+		obj.Wrap = new(object.KeyWrap)
+		copy(obj.Wrap.Salt[:], o.KeyWrap[:16])
+		copy(obj.Wrap.Checksum[:], o.KeyWrap[16:])
+	}
+	if len(o.KeyNonce) == 32 {
+		obj.KeyNonce = new([32]byte)
+		copy(obj.KeyNonce[:], o.KeyNonce)
+	}
+	if ps := o.PartialSlab; ps != nil {
+		obj.PartialSlab = &object.PartialSlab{
+			MinShards:   ps.MinShards,
+			TotalShards: ps.TotalShards,
+			Data:        ps.Data,
+		}
 	}
 	for i, sl := range o.Slabs {
-		slab, err := sl.Slab.convert()
+		slab, err := sl.DBSlab.convert(kc)
 		if err != nil {
 			return object.Object{}, err
 		}
@@ -291,6 +398,32 @@ func (s *SQLStore) ActiveContracts(ctx context.Context) ([]api.ContractMetadata,
 	return contracts, nil
 }
 
+// ContractSizes returns the amount of data stored in every active contract
+// that contains at least one sector.
+func (s *SQLStore) ContractSizes(ctx context.Context) (map[types.FileContractID]uint64, error) {
+	var rows []struct {
+		FCID    fileContractID
+		Sectors uint64
+	}
+	err := s.db.
+		WithContext(ctx).
+		Table("contract_sectors cs").
+		Select("c.fcid as FCID, COUNT(*) as Sectors").
+		Joins("INNER JOIN contracts c ON c.id = cs.db_contract_id").
+		Group("c.fcid").
+		Scan(&rows).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[types.FileContractID]uint64, len(rows))
+	for _, row := range rows {
+		sizes[types.FileContractID(row.FCID)] = row.Sectors * rhpv2.SectorSize
+	}
+	return sizes, nil
+}
+
 // AddRenewedContract adds a new contract which was created as the result of a renewal to the store.
 // The old contract specified as 'renewedFrom' will be deleted from the active
 // contracts and moved to the archive. Both new and old contract will be linked
@@ -324,6 +457,7 @@ func (s *SQLStore) AddRenewedContract(ctx context.Context, c rhpv2.ContractRevis
 				WindowEnd:      oldContract.WindowEnd,
 
 				UploadSpending:      oldContract.UploadSpending,
+				StorageSpending:     oldContract.StorageSpending,
 				DownloadSpending:    oldContract.DownloadSpending,
 				FundAccountSpending: oldContract.FundAccountSpending,
 			},
@@ -337,6 +471,15 @@ func (s *SQLStore) AddRenewedContract(ctx context.Context, c rhpv2.ContractRevis
 		if err != nil {
 			return err
 		}
+
+		// The renewed contract stores the same sectors, if their roots
+		// aren't known yet it can't be pruned either.
+		if oldContract.RootsUnknown {
+			if err := tx.Model(&renewed).Update("roots_unknown", true).Error; err != nil {
+				return err
+			}
+			renewed.RootsUnknown = true
+		}
 		s.knownContracts[c.ID()] = struct{}{}
 
 		// Update the old contract in the contract set to the new one.
@@ -356,6 +499,14 @@ func (s *SQLStore) AddRenewedContract(ctx context.Context, c rhpv2.ContractRevis
 			return err
 		}
 
+		// Move the recovered sectors to the new contract as well.
+		err = tx.Model(&dbRecoveredSector{}).
+			Where("db_contract_id = ?", oldContract.ID).
+			Update("db_contract_id", renewed.ID).Error
+		if err != nil {
+			return err
+		}
+
 		// Finally delete the old contract.
 		return removeContract(tx, fileContractID(renewedFrom))
 	}); err != nil {
@@ -414,29 +565,37 @@ func (s *SQLStore) SetContractSet(ctx context.Context, name string, contractIds
 		fcids[i] = fileContractID(fcid)
 	}
 
-	// fetch contracts
-	var dbContracts []dbContract
-	err := s.db.
-		Model(&dbContract{}).
-		Where("fcid IN (?)", fcids).
-		Find(&dbContracts).
-		Error
-	if err != nil {
-		return err
-	}
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		// fetch contracts
+		var dbContracts []dbContract
+		err := tx.
+			WithContext(ctx).
+			Model(&dbContract{}).
+			Where("fcid IN (?)", fcids).
+			Find(&dbContracts).
+			Error
+		if err != nil {
+			return err
+		}
 
-	// create contract set
-	var contractset dbContractSet
-	err = s.db.
-		Where(dbContractSet{Name: name}).
-		FirstOrCreate(&contractset).
-		Error
-	if err != nil {
-		return err
-	}
+		// create contract set
+		var contractset dbContractSet
+		err = tx.
+			Where(dbContractSet{Name: name}).
+			FirstOrCreate(&contractset).
+			Error
+		if err != nil {
+			return err
+		}
 
-	// update contracts
-	return s.db.Model(&contractset).Association("Contracts").Replace(&dbContracts)
+		// record the changes to the set
+		if err := recordContractSetChanges(tx, contractset, dbContracts); err != nil {
+			return err
+		}
+
+		// update contracts
+		return tx.Model(&contractset).Association("Contracts").Replace(&dbContracts)
+	})
 }
 
 func (s *SQLStore) RemoveContract(ctx context.Context, id types.FileContractID) error {
@@ -448,18 +607,31 @@ func (s *SQLStore) RemoveContract(ctx context.Context, id types.FileContractID)
 	return nil
 }
 
-func (s *SQLStore) SearchObjects(ctx context.Context, substring string, offset, limit int) ([]string, error) {
+// SearchObjects returns the objects that contain the given substring in their
+// key and whose health lies within the given range. The health of an object
+// is the health of its least healthy slab, it's 1 if the object has no slabs.
+func (s *SQLStore) SearchObjects(ctx context.Context, substring string, minHealth, maxHealth float64, offset, limit int) ([]string, error) {
 	var ids []string
 	err := s.db.Model(&dbObject{}).
-		Select("object_id").
-		Where("object_id LIKE ?", "%"+substring+"%").
+		Select("objects.object_id").
+		Joins("LEFT JOIN slices sli ON sli.db_object_id = objects.id").
+		Joins("LEFT JOIN slabs sla ON sla.id = sli.db_slab_id").
+		Where("objects.object_id LIKE ?", "%"+substring+"%").
+		Where("objects.object_id NOT LIKE ?", trashKeyPrefix+"%").
+		Group("objects.id, objects.object_id").
+		Having("COALESCE(MIN(sla.persisted_health), 1) >= ? AND COALESCE(MIN(sla.persisted_health), 1) <= ?", minHealth, maxHealth).
+		Order("objects.id ASC").
 		Offset(offset).
 		Limit(limit).
 		Scan(&ids).Error
 	return ids, err
 }
 
-func (s *SQLStore) Objects(ctx context.Context, path, prefix string, offset, limit int) ([]string, error) {
+// Objects returns the entries directly beneath the given path, objects
+// further down are grouped into directories. The metadata of every entry is
+// aggregated over the objects it contains. Only entries whose health lies
+// within the given range are returned.
+func (s *SQLStore) Objects(ctx context.Context, path, prefix string, minHealth, maxHealth float64, offset, limit int) ([]api.ObjectMetadata, error) {
 	if !strings.HasSuffix(path, "/") {
 		panic("path must end in /")
 	}
@@ -471,30 +643,57 @@ func (s *SQLStore) Objects(ctx context.Context, path, prefix string, offset, lim
 		return fmt.Sprintf("CONCAT(%s, %s)", a, b)
 	}
 
-	// base query
-	query := s.db.Raw(fmt.Sprintf(`SELECT CASE slashindex WHEN 0 THEN %s ELSE %s END AS result
+	// base query, the size, number of slabs and health of every object are
+	// aggregated over its slices before the objects are grouped by entry
+	query := s.db.Raw(fmt.Sprintf(`SELECT CASE slashindex WHEN 0 THEN %s ELSE %s END AS result, SUM(size) AS size, MAX(created_at) AS mod_time, SUM(slabs) AS slabs, MIN(health) AS health
 	FROM (
-		SELECT trimmed, INSTR(trimmed, ?) AS slashindex
+		SELECT trimmed, INSTR(trimmed, ?) AS slashindex, size, created_at, slabs, health
 		FROM (
-			SELECT SUBSTR(object_id, ?) AS trimmed
-			FROM objects
-			WHERE object_id LIKE ?
+			SELECT SUBSTR(o.object_id, ?) AS trimmed, o.created_at, COALESCE(sli.size, 0) + COALESCE(LENGTH(ps.data), 0) AS size, COALESCE(sli.slabs, 0) AS slabs, COALESCE(sli.health, 1) AS health
+			FROM objects o
+			LEFT JOIN (
+				SELECT sli.db_object_id, SUM(sli.length) AS size, COUNT(*) AS slabs, MIN(sla.persisted_health) AS health
+				FROM slices sli
+				INNER JOIN slabs sla ON sla.id = sli.db_slab_id
+				INNER JOIN objects oo ON oo.id = sli.db_object_id
+				WHERE oo.object_id LIKE ?
+				GROUP BY sli.db_object_id
+			) sli ON sli.db_object_id = o.id
+			LEFT JOIN partial_slabs ps ON ps.db_object_id = o.id
+			WHERE o.object_id LIKE ?
 		) AS i
 	) AS m
 	GROUP BY result
-	LIMIT ? OFFSET ?`, concat("?", "trimmed"), concat("?", "substr(trimmed, 1, slashindex)")), path, path, "/", len(path)+1, path+"%", limit, offset)
+	HAVING MIN(health) >= ? AND MIN(health) <= ?
+	ORDER BY result ASC
+	LIMIT ? OFFSET ?`, concat("?", "trimmed"), concat("?", "substr(trimmed, 1, slashindex)")), path, path, "/", len(path)+1, path+"%", path+"%", minHealth, maxHealth, limit, offset)
 
 	// apply prefix
 	if prefix != "" {
-		query = s.db.Raw(fmt.Sprintf("SELECT * FROM (?) WHERE result LIKE %s", concat("?", "?")), query, path, prefix+"%")
+		query = s.db.Raw(fmt.Sprintf("SELECT * FROM (?) AS e WHERE result LIKE %s", concat("?", "?")), query, path, prefix+"%")
 	}
 
-	var ids []string
-	err := query.Scan(&ids).Error
-	if err != nil {
+	var rows []struct {
+		Result  string
+		Size    int64
+		ModTime datetime
+		Slabs   int
+		Health  float64
+	}
+	if err := query.WithContext(ctx).Scan(&rows).Error; err != nil {
 		return nil, err
 	}
-	return ids, nil
+	entries := make([]api.ObjectMetadata, len(rows))
+	for i, row := range rows {
+		entries[i] = api.ObjectMetadata{
+			Name:    row.Result,
+			Size:    row.Size,
+			ModTime: time.Time(row.ModTime).UTC(),
+			Slabs:   row.Slabs,
+			Health:  row.Health,
+		}
+	}
+	return entries, nil
 }
 
 func (s *SQLStore) Object(ctx context.Context, key string) (object.Object, error) {
@@ -502,13 +701,17 @@ func (s *SQLStore) Object(ctx context.Context, key string) (object.Object, error
 	if err != nil {
 		return object.Object{}, err
 	}
-	return obj.convert()
+	return obj.convert(s.keyCipher)
 }
 
 func (s *SQLStore) RecordContractSpending(ctx context.Context, records []api.ContractSpendingRecord) error {
 	squashedRecords := make(map[types.FileContractID]api.ContractSpending)
+	latestRecords := make(map[types.FileContractID]api.ContractSpendingRecord)
 	for _, r := range records {
 		squashedRecords[r.ContractID] = squashedRecords[r.ContractID].Add(r.ContractSpending)
+		if latest, ok := latestRecords[r.ContractID]; !ok || r.RevisionNumber > latest.RevisionNumber {
+			latestRecords[r.ContractID] = r
+		}
 	}
 	for fcid, newSpending := range squashedRecords {
 		err := s.retryTransaction(func(tx *gorm.DB) error {
@@ -525,12 +728,24 @@ func (s *SQLStore) RecordContractSpending(ctx context.Context, records []api.Con
 			if !newSpending.Uploads.IsZero() {
 				updates["upload_spending"] = currency(types.Currency(contract.UploadSpending).Add(newSpending.Uploads))
 			}
+			if !newSpending.Storage.IsZero() {
+				updates["storage_spending"] = currency(types.Currency(contract.StorageSpending).Add(newSpending.Storage))
+			}
 			if !newSpending.Downloads.IsZero() {
 				updates["download_spending"] = currency(types.Currency(contract.DownloadSpending).Add(newSpending.Downloads))
 			}
 			if !newSpending.FundAccount.IsZero() {
 				updates["fund_account_spending"] = currency(types.Currency(contract.FundAccountSpending).Add(newSpending.FundAccount))
 			}
+			if latest := latestRecords[fcid]; latest.RevisionNumber > 0 {
+				updates["remaining_funds"] = currency(latest.RemainingFunds)
+
+				var latestRevisionNumber uint64
+				_, _ = fmt.Sscan(contract.LatestRevisionNumber, &latestRevisionNumber)
+				if latest.RevisionNumber > latestRevisionNumber {
+					updates["latest_revision_number"] = fmt.Sprint(latest.RevisionNumber)
+				}
+			}
 			return tx.Model(&contract).Updates(updates).Error
 		})
 		if err != nil {
@@ -540,20 +755,95 @@ func (s *SQLStore) RecordContractSpending(ctx context.Context, records []api.Con
 	return nil
 }
 
-func (s *SQLStore) UpdateObject(ctx context.Context, key string, o object.Object, usedContracts map[types.PublicKey]types.FileContractID) error {
-	// Sanity check input.
-	for _, ss := range o.Slabs {
-		for _, shard := range ss.Shards {
-			// Verify that all hosts have a contract.
-			_, exists := usedContracts[shard.Host]
-			if !exists {
-				return fmt.Errorf("missing contract for host %v", shard.Host)
+// RecordContractBroadcast records that the given revision of the contract was
+// broadcast.
+func (s *SQLStore) RecordContractBroadcast(ctx context.Context, id types.FileContractID, b api.ContractBroadcast) error {
+	res := s.db.
+		WithContext(ctx).
+		Model(&dbContract{}).
+		Where("fcid = ?", fileContractID(id)).
+		Updates(map[string]interface{}{
+			"broadcast_height":          b.Height,
+			"broadcast_revision_number": fmt.Sprint(b.RevisionNumber),
+			"broadcast_txn_id":          b.TransactionID[:],
+		})
+	if res.Error != nil {
+		return res.Error
+	} else if res.RowsAffected == 0 {
+		return ErrContractNotFound
+	}
+	return nil
+}
+
+// UpdateContractUsability updates the usability flags of the given contracts,
+// updates for contracts that don't exist are ignored.
+func (s *SQLStore) UpdateContractUsability(ctx context.Context, updates []api.ContractUsabilityUpdate) error {
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		for _, u := range updates {
+			if err := tx.
+				WithContext(ctx).
+				Model(&dbContract{}).
+				Where("fcid = ?", fileContractID(u.ContractID)).
+				Updates(map[string]interface{}{
+					"good_for_upload": u.GoodForUpload,
+					"good_for_renew":  u.GoodForRenew,
+				}).
+				Error; err != nil {
+				return err
 			}
 		}
+		return nil
+	})
+}
+
+// UpdateObject stores the object with the given key, replacing the object
+// stored under that key before. If any of the object's shards can't be linked
+// to a known contract of its host, an *api.UsedContractsError listing the
+// rejected shards is returned, unless partial is set, in which case these
+// shards are stored without a contract and the object's health is reduced
+// accordingly. If ifMatch is not empty, the object is only replaced if its
+// ETag matches, see checkIfMatch.
+func (s *SQLStore) UpdateObject(ctx context.Context, key string, o object.Object, usedContracts map[types.PublicKey]types.FileContractID, rs *api.RedundancySettings, partial bool, ifMatch string) error {
+	// Sanity check input.
+	if rs != nil {
+		if err := rs.Validate(); err != nil {
+			return err
+		}
+	}
+	rejected, err := s.rejectedShards(ctx, o, usedContracts)
+	if err != nil {
+		return err
+	} else if len(rejected) > 0 && !partial {
+		return &api.UsedContractsError{Rejected: rejected}
+	} else if len(rejected) > 0 {
+		// make sure the rejected shards aren't linked to a contract
+		filtered := make(map[types.PublicKey]types.FileContractID, len(usedContracts))
+		for hk, fcid := range usedContracts {
+			filtered[hk] = fcid
+		}
+		for _, rs := range rejected {
+			filtered[rs.HostKey] = types.FileContractID{}
+		}
+		usedContracts = filtered
 	}
 
 	// UpdateObject is ACID.
 	return s.retryTransaction(func(tx *gorm.DB) error {
+		if err := checkIfMatch(tx, key, ifMatch); err != nil {
+			return err
+		}
+
+		// Keep the importance of the object if it exists.
+		importance := uint8(1)
+		if err := tx.Model(&dbObject{}).
+			Select("importance").
+			Where("object_id", key).
+			Limit(1).
+			Scan(&importance).
+			Error; err != nil {
+			return err
+		}
+
 		// Try to delete first. We want to get rid of the object and its
 		// slabs if it exists.
 		err := removeObject(tx, key)
@@ -562,13 +852,28 @@ func (s *SQLStore) UpdateObject(ctx context.Context, key string, o object.Object
 		}
 
 		// Insert a new object.
-		objKey, err := o.Key.MarshalText()
+		objKey, err := s.keyCipher.marshalKey(o.Key)
 		if err != nil {
 			return err
 		}
 		obj := dbObject{
-			ObjectID: key,
-			Key:      objKey,
+			ObjectID:   key,
+			Key:        objKey,
+			Importance: importance,
+			ETag:       o.ETag,
+		}
+		if !o.ModTime.IsZero() {
+			obj.CreatedAt = o.ModTime.UTC()
+		}
+		if o.Wrap != nil {
+			obj.KeyWrap = append(o.Wrap.Salt[:], o.Wrap.Checksum[:]...)
+		}
+		if o.KeyNonce != nil {
+			obj.KeyNonce = o.KeyNonce[:]
+		}
+		if rs != nil {
+			obj.MinShards = uint8(rs.MinShards)
+			obj.TotalShards = uint8(rs.TotalShards)
 		}
 		err = tx.Create(&obj).Error
 		if err != nil {
@@ -576,108 +881,265 @@ func (s *SQLStore) UpdateObject(ctx context.Context, key string, o object.Object
 		}
 
 		for _, ss := range o.Slabs {
+			// Create Slab.
+			slab, err := s.createSlab(tx, ss.Slab, usedContracts)
+			if err != nil {
+				return err
+			}
+
 			// Create Slice.
-			slice := dbSlice{
+			err = tx.Create(&dbSlice{
 				DBObjectID: obj.ID,
+				DBSlabID:   slab.ID,
 				Offset:     ss.Offset,
 				Length:     ss.Length,
-			}
-			err = tx.Create(&slice).Error
+			}).Error
 			if err != nil {
 				return err
 			}
+		}
 
-			// Create Slab.
-			slabKey, err := ss.Key.MarshalText()
-			if err != nil {
-				return err
-			}
-			slab := &dbSlab{
-				DBSliceID:   slice.ID,
-				Key:         slabKey,
-				MinShards:   ss.MinShards,
-				TotalShards: uint8(len(ss.Shards)),
-			}
-			err = tx.Create(&slab).Error
+		// Create the partial slab.
+		if ps := o.PartialSlab; ps != nil {
+			err = tx.Create(&dbPartialSlab{
+				DBObjectID:  obj.ID,
+				MinShards:   ps.MinShards,
+				TotalShards: ps.TotalShards,
+				Data:        ps.Data,
+			}).Error
 			if err != nil {
 				return err
 			}
+		}
+		return nil
+	})
+}
 
-			for _, shard := range ss.Shards {
-				// Translate pubkey to contract.
-				fcid := usedContracts[shard.Host]
-
-				// Create sector if it doesn't exist yet.
-				var sector dbSector
-				err := tx.
-					Where(dbSector{Root: shard.Root[:]}).
-					Assign(dbSector{LatestHost: publicKey(shard.Host)}).
-					FirstOrCreate(&sector).
-					Error
-				if err != nil {
-					return err
-				}
+// rejectedShards returns the shards of the object that can't be linked to a
+// known contract of their host using the given used contracts.
+func (s *SQLStore) rejectedShards(ctx context.Context, o object.Object, usedContracts map[types.PublicKey]types.FileContractID) ([]api.RejectedShard, error) {
+	if len(o.Slabs) == 0 {
+		return nil, nil
+	}
 
-				// Add the slab-sector link to the sector to the
-				// shards table.
-				err = tx.Create(&dbShard{
-					DBSlabID:   slab.ID,
-					DBSectorID: sector.ID,
-				}).Error
-				if err != nil {
-					return err
-				}
+	// fetch the hosts and contracts referenced by the object
+	hks := make([]publicKey, 0, len(usedContracts))
+	fcids := make([]fileContractID, 0, len(usedContracts))
+	for hk, fcid := range usedContracts {
+		hks = append(hks, publicKey(hk))
+		fcids = append(fcids, fileContractID(fcid))
+	}
+	var knownHosts []publicKey
+	if len(hks) > 0 {
+		if err := s.db.
+			WithContext(ctx).
+			Model(&dbHost{}).
+			Where("public_key IN ?", hks).
+			Pluck("public_key", &knownHosts).
+			Error; err != nil {
+			return nil, err
+		}
+	}
+	var contracts []struct {
+		FCID      fileContractID
+		PublicKey publicKey
+	}
+	var archived []fileContractID
+	if len(fcids) > 0 {
+		if err := s.db.
+			WithContext(ctx).
+			Model(&dbContract{}).
+			Select("contracts.fcid as FCID, h.public_key as PublicKey").
+			Joins("INNER JOIN hosts h ON h.id = contracts.host_id").
+			Where("contracts.fcid IN ?", fcids).
+			Scan(&contracts).
+			Error; err != nil {
+			return nil, err
+		}
+		if err := s.db.
+			WithContext(ctx).
+			Model(&dbArchivedContract{}).
+			Where("fcid IN ?", fcids).
+			Pluck("fcid", &archived).
+			Error; err != nil {
+			return nil, err
+		}
+	}
 
-				// Look for the contract referenced by the shard.
-				contractFound := true
-				var contract dbContract
-				err = tx.Model(&dbContract{}).
-					Where(&dbContract{ContractCommon: ContractCommon{FCID: fileContractID(fcid)}}).
-					Take(&contract).Error
-				if errors.Is(err, gorm.ErrRecordNotFound) {
-					contractFound = false
-				} else if err != nil {
-					return err
-				}
+	hosts := make(map[types.PublicKey]struct{})
+	for _, hk := range knownHosts {
+		hosts[types.PublicKey(hk)] = struct{}{}
+	}
+	contractHosts := make(map[types.FileContractID]types.PublicKey)
+	for _, c := range contracts {
+		contractHosts[types.FileContractID(c.FCID)] = types.PublicKey(c.PublicKey)
+	}
+	archivedContracts := make(map[types.FileContractID]struct{})
+	for _, fcid := range archived {
+		archivedContracts[types.FileContractID(fcid)] = struct{}{}
+	}
 
-				// Look for the host referenced by the shard.
-				hostFound := true
-				var host dbHost
-				err = tx.Model(&dbHost{}).
-					Where(&dbHost{PublicKey: publicKey(shard.Host)}).
-					Take(&host).Error
-				if errors.Is(err, gorm.ErrRecordNotFound) {
-					hostFound = false
-				} else if err != nil {
-					return err
+	var rejected []api.RejectedShard
+	for i, ss := range o.Slabs {
+		for j, shard := range ss.Shards {
+			fcid, exists := usedContracts[shard.Host]
+			var reason string
+			if !exists {
+				reason = api.RejectReasonNoContract
+			} else if _, known := hosts[shard.Host]; !known {
+				reason = api.RejectReasonUnknownHost
+			} else if hk, known := contractHosts[fcid]; !known {
+				if _, ok := archivedContracts[fcid]; ok {
+					reason = api.RejectReasonArchivedContract
+				} else {
+					reason = api.RejectReasonUnknownContract
 				}
+			} else if hk != shard.Host {
+				reason = api.RejectReasonHostMismatch
+			} else {
+				continue
+			}
+			rejected = append(rejected, api.RejectedShard{
+				Slab:       i,
+				Shard:      j,
+				Root:       shard.Root,
+				HostKey:    shard.Host,
+				ContractID: fcid,
+				Reason:     reason,
+			})
+		}
+	}
+	return rejected, nil
+}
 
-				// Add contract and host to join tables.
-				if contractFound {
-					err = tx.Model(&sector).Association("Contracts").Append(&contract)
-					if err != nil {
-						return err
-					}
-				}
-				if hostFound {
-					err = tx.Model(&sector).Association("Hosts").Append(&host)
-					if err != nil {
-						return err
-					}
-				}
+// createSlab adds a slab to the store. Slab keys are unique, adding a slab with
+// the key of an existing slab fails rather than linking the existing slab,
+// whose shards might hold different data.
+func (s *SQLStore) createSlab(tx *gorm.DB, ss object.Slab, usedContracts map[types.PublicKey]types.FileContractID) (dbSlab, error) {
+	slabKey, err := s.keyCipher.marshalKey(ss.Key)
+	if err != nil {
+		return dbSlab{}, err
+	}
+	slab := dbSlab{
+		Key:         slabKey,
+		KeyWrapped:  ss.Wrapped,
+		MinShards:   ss.MinShards,
+		TotalShards: uint8(len(ss.Shards)),
+	}
+	err = tx.Create(&slab).Error
+	if err != nil {
+		return dbSlab{}, err
+	}
+
+	for _, shard := range ss.Shards {
+		// Translate pubkey to contract.
+		fcid := usedContracts[shard.Host]
+
+		// Create sector if it doesn't exist yet.
+		var sector dbSector
+		err := tx.
+			Where(dbSector{Root: shard.Root[:]}).
+			Assign(dbSector{LatestHost: publicKey(shard.Host)}).
+			FirstOrCreate(&sector).
+			Error
+		if err != nil {
+			return dbSlab{}, err
+		}
+
+		// Add the slab-sector link to the sector to the
+		// shards table.
+		err = tx.Create(&dbShard{
+			DBSlabID:   slab.ID,
+			DBSectorID: sector.ID,
+		}).Error
+		if err != nil {
+			return dbSlab{}, err
+		}
+
+		// Look for the contract referenced by the shard.
+		contractFound := true
+		var contract dbContract
+		err = tx.Model(&dbContract{}).
+			Where("fcid = ?", fileContractID(fcid)).
+			Take(&contract).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			contractFound = false
+		} else if err != nil {
+			return dbSlab{}, err
+		}
+
+		// Look for the host referenced by the shard.
+		hostFound := true
+		var host dbHost
+		err = tx.Model(&dbHost{}).
+			Where(&dbHost{PublicKey: publicKey(shard.Host)}).
+			Take(&host).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			hostFound = false
+		} else if err != nil {
+			return dbSlab{}, err
+		}
+
+		// Add contract and host to join tables.
+		if contractFound {
+			err = tx.Model(&sector).Association("Contracts").Append(&contract)
+			if err != nil {
+				return dbSlab{}, err
 			}
 		}
-		return nil
+		if hostFound {
+			err = tx.Model(&sector).Association("Hosts").Append(&host)
+			if err != nil {
+				return dbSlab{}, err
+			}
+		}
+	}
+	return slab, nil
+}
+
+// RemoveObject removes the object with the given key. If ifMatch is not
+// empty, the object is only removed if its ETag matches, see checkIfMatch.
+func (s *SQLStore) RemoveObject(ctx context.Context, key, ifMatch string) error {
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		if err := checkIfMatch(tx, key, ifMatch); err != nil {
+			return err
+		}
+		return removeObject(tx, key)
 	})
 }
 
-func (s *SQLStore) RemoveObject(ctx context.Context, key string) error {
-	return removeObject(s.db, key)
+// RenameObjects moves all objects whose key starts with 'from' to the same key
+// beneath 'to' in a single transaction. If an object's key already starts with
+// 'to', no object is renamed and api.ErrObjectExists is returned.
+func (s *SQLStore) RenameObjects(ctx context.Context, from, to string) (renamed int, err error) {
+	// the prefixes are compared using SUBSTR rather than LIKE since the
+	// latter would treat '_' and '%' in keys as wildcards
+	hasPrefix := "SUBSTR(object_id, 1, ?) = ?"
+	newKey := "? || SUBSTR(object_id, ?)"
+	if !isSQLite(s.db) {
+		newKey = "CONCAT(?, SUBSTR(object_id, ?))"
+	}
+	fromLen, toLen := utf8.RuneCountInString(from), utf8.RuneCountInString(to)
+
+	err = s.retryTransaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&dbObject{}).Where(hasPrefix, toLen, to).Count(&count).Error; err != nil {
+			return err
+		} else if count > 0 {
+			return fmt.Errorf("%w: %v objects exist beneath %v", api.ErrObjectExists, count, to)
+		}
+		res := tx.Model(&dbObject{}).
+			Where(hasPrefix, fromLen, from).
+			Update("object_id", gorm.Expr(newKey, to, fromLen+1))
+		renamed = int(res.RowsAffected)
+		return res.Error
+	})
+	return
 }
 
 func (ss *SQLStore) UpdateSlab(ctx context.Context, s object.Slab, usedContracts map[types.PublicKey]types.FileContractID) error {
 	// extract the slab key
-	key, err := s.Key.MarshalText()
+	key, err := ss.keyCipher.marshalKey(s.Key)
 	if err != nil {
 		return err
 	}
@@ -728,12 +1190,21 @@ func (ss *SQLStore) UpdateSlab(ctx context.Context, s object.Slab, usedContracts
 
 	// find existing slab
 	var slab dbSlab
-	if err = ss.db.
-		Where(&dbSlab{Key: key}).
-		Assign(&dbSlab{TotalShards: uint8(len(slab.Shards))}).
-		Preload("Shards.DBSector").
-		Take(&slab).
-		Error; err == gorm.ErrRecordNotFound {
+	findSlab := func(key []byte) error {
+		return ss.db.
+			Where(&dbSlab{Key: key}).
+			Assign(&dbSlab{TotalShards: uint8(len(slab.Shards))}).
+			Preload("Shards.DBSector").
+			Take(&slab).
+			Error
+	}
+	err = findSlab(key)
+	if err == gorm.ErrRecordNotFound && ss.keyCipher != nil {
+		// the slab might have been stored before encryption was enabled
+		key, _ = s.Key.MarshalText()
+		err = findSlab(key)
+	}
+	if err == gorm.ErrRecordNotFound {
 		return fmt.Errorf("slab with key '%s' not found: %w", string(key), err)
 	} else if err != nil {
 		return err
@@ -741,6 +1212,12 @@ func (ss *SQLStore) UpdateSlab(ctx context.Context, s object.Slab, usedContracts
 
 	// Update slab.
 	return ss.retryTransaction(func(tx *gorm.DB) (err error) {
+		// the slab's repair queue entry is stale now, it's enqueued again if
+		// the slab still needs to be repaired
+		if err := tx.Where("db_slab_id", slab.ID).Delete(&dbRepair{}).Error; err != nil {
+			return err
+		}
+
 		// build map out of current shards
 		shards := make(map[uint]struct{})
 		for _, shard := range slab.Shards {
@@ -793,28 +1270,229 @@ func (ss *SQLStore) UpdateSlab(ctx context.Context, s object.Slab, usedContracts
 	})
 }
 
+// ContractObjects returns the objects with slabs that have shards stored on
+// the given contract, sorted by key.
+func (s *SQLStore) ContractObjects(ctx context.Context, id types.FileContractID) ([]api.ContractObject, error) {
+	contract, err := s.contract(ctx, fileContractID(id))
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		ObjectID string
+		SlabID   uint
+		Key      []byte
+		Shards   int
+	}
+	err = s.db.
+		WithContext(ctx).
+		Select("o.object_id, slabs.id AS slab_id, slabs.key, COUNT(*) AS shards").
+		Model(&dbSlab{}).
+		Joins("INNER JOIN slices sli ON sli.db_slab_id = slabs.id").
+		Joins("INNER JOIN objects o ON o.id = sli.db_object_id").
+		Joins("INNER JOIN shards sh ON sh.db_slab_id = slabs.id").
+		Joins("INNER JOIN contract_sectors se ON se.db_sector_id = sh.db_sector_id").
+		Where("se.db_contract_id = ?", contract.ID).
+		Group("o.object_id, slabs.id").
+		Order("o.object_id ASC").
+		Order("slabs.id ASC").
+		Find(&rows).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []api.ContractObject
+	for _, row := range rows {
+		if len(objects) == 0 || objects[len(objects)-1].Key != row.ObjectID {
+			objects = append(objects, api.ContractObject{Key: row.ObjectID})
+		}
+		slab := api.ContractSlab{
+			ID:     api.SlabID(row.SlabID),
+			Shards: row.Shards,
+		}
+		if err := s.keyCipher.unmarshalKey(row.Key, &slab.Key); err != nil {
+			return nil, err
+		}
+		obj := &objects[len(objects)-1]
+		obj.Slabs = append(obj.Slabs, slab)
+	}
+	return objects, nil
+}
+
+// SlabHealth returns the health of every slab with regard to the given contract
+// set, least healthy first. A slab's health is computed from the number of
+// distinct hosts in the set that store one of its sectors, slabs without any
+// sectors in the set are included with the lowest health.
+func (s *SQLStore) SlabHealth(ctx context.Context, set string, limit int) ([]api.SlabHealth, error) {
+	if limit == 0 {
+		limit = -1
+	}
+
+	var rows []struct {
+		ID          uint
+		Key         []byte
+		MinShards   uint8
+		TotalShards uint8
+		Hosts       int
+		Health      float64
+	}
+	err := s.db.
+		Select("slabs.id, slabs.key, slabs.min_shards, slabs.total_shards, COUNT(DISTINCT(c.host_id)) AS hosts, "+sqlSlabHealth).
+		Model(&dbSlab{}).
+		Joins("INNER JOIN shards sh ON sh.db_slab_id = slabs.id").
+		Joins("LEFT JOIN contract_sectors se ON se.db_sector_id = sh.db_sector_id").
+		Joins(`LEFT JOIN (
+			SELECT contracts.id, contracts.host_id FROM contracts
+			INNER JOIN contract_set_contracts csc ON csc.db_contract_id = contracts.id
+			INNER JOIN contract_sets cs ON cs.id = csc.db_contract_set_id
+			WHERE cs.name = ?
+		) c ON se.db_contract_id = c.id`, set).
+		Group("slabs.id").
+		Order("health ASC").
+		Limit(limit).
+		Find(&rows).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	health := make([]api.SlabHealth, len(rows))
+	for i, row := range rows {
+		health[i] = api.SlabHealth{
+			ID:          api.SlabID(row.ID),
+			Health:      row.Health,
+			MinShards:   row.MinShards,
+			TotalShards: row.TotalShards,
+			Hosts:       row.Hosts,
+		}
+		if err := s.keyCipher.unmarshalKey(row.Key, &health[i].Key); err != nil {
+			return nil, err
+		}
+	}
+	return health, nil
+}
+
+// RefreshSlabHealth recomputes the health of all slabs with regard to the given
+// contract set in batches of the given size and persists it.
+func (s *SQLStore) RefreshSlabHealth(ctx context.Context, set string, batchSize int) error {
+	if batchSize <= 0 {
+		batchSize = slabRetrievalBatchSize
+	}
+
+	var lastID uint
+	for {
+		var rows []struct {
+			ID     uint
+			Health float64
+		}
+		err := s.db.
+			WithContext(ctx).
+			Select("slabs.id, "+sqlSlabHealth).
+			Model(&dbSlab{}).
+			Joins("INNER JOIN shards sh ON sh.db_slab_id = slabs.id").
+			Joins("LEFT JOIN contract_sectors se ON se.db_sector_id = sh.db_sector_id").
+			Joins(`LEFT JOIN (
+				SELECT contracts.id, contracts.host_id FROM contracts
+				INNER JOIN contract_set_contracts csc ON csc.db_contract_id = contracts.id
+				INNER JOIN contract_sets cs ON cs.id = csc.db_contract_set_id
+				WHERE cs.name = ?
+			) c ON se.db_contract_id = c.id`, set).
+			Where("slabs.id > ?", lastID).
+			Group("slabs.id").
+			Order("slabs.id ASC").
+			Limit(batchSize).
+			Find(&rows).
+			Error
+		if err != nil {
+			return err
+		} else if len(rows) == 0 {
+			return nil
+		}
+
+		now := time.Now().UTC()
+		err = s.retryTransaction(func(tx *gorm.DB) error {
+			for _, row := range rows {
+				if err := tx.Model(&dbSlab{}).
+					Where("id", row.ID).
+					Updates(map[string]interface{}{
+						"persisted_health":  row.Health,
+						"health_updated_at": now,
+					}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		lastID = rows[len(rows)-1].ID
+	}
+}
+
+// SlabHealthSummary summarizes the persisted health of all slabs, slabs with a
+// health at or below the cutoff are considered unhealthy, like in
+// UnhealthySlabs.
+func (s *SQLStore) SlabHealthSummary(ctx context.Context, healthCutoff float64) (api.SlabHealthSummary, error) {
+	var summary struct {
+		Slabs            uint64
+		Unhealthy        uint64
+		UnhealthyWrapped uint64
+		MinHealth        float64
+		Refreshed        time.Time
+	}
+	if err := s.db.
+		WithContext(ctx).
+		Model(&dbSlab{}).
+		Select("COUNT(*) AS slabs, COALESCE(SUM(CASE WHEN persisted_health <= ? THEN 1 ELSE 0 END), 0) AS unhealthy, COALESCE(SUM(CASE WHEN persisted_health <= ? AND key_wrapped = ? THEN 1 ELSE 0 END), 0) AS unhealthy_wrapped, COALESCE(MIN(persisted_health), 1) AS min_health", healthCutoff, healthCutoff, true).
+		Scan(&summary).
+		Error; err != nil {
+		return api.SlabHealthSummary{}, err
+	}
+
+	// The summary is only as recent as the slab that was updated the longest
+	// time ago, it's never refreshed if any slab wasn't.
+	var stale int64
+	if err := s.db.
+		WithContext(ctx).
+		Model(&dbSlab{}).
+		Where("health_updated_at IS NULL OR health_updated_at = ?", time.Time{}).
+		Count(&stale).
+		Error; err != nil {
+		return api.SlabHealthSummary{}, err
+	} else if stale == 0 && summary.Slabs > 0 {
+		var oldest dbSlab
+		if err := s.db.
+			WithContext(ctx).
+			Select("health_updated_at").
+			Order("health_updated_at ASC").
+			Take(&oldest).
+			Error; err != nil {
+			return api.SlabHealthSummary{}, err
+		}
+		summary.Refreshed = oldest.HealthUpdatedAt.UTC()
+	}
+
+	return api.SlabHealthSummary{
+		Slabs:            summary.Slabs,
+		Unhealthy:        summary.Unhealthy,
+		UnhealthyWrapped: summary.UnhealthyWrapped,
+		MinHealth:        summary.MinHealth,
+		Refreshed:        summary.Refreshed,
+	}, nil
+}
+
 // UnhealthySlabs returns up to 'limit' slabs that do not reach full redundancy
 // in the given contract set. These slabs need to be migrated to good contracts
-// so they are restored to full health.
+// so they are restored to full health. Slabs with wrapped keys are skipped
+// since they can't be migrated without the passphrase of their object.
 func (s *SQLStore) UnhealthySlabs(ctx context.Context, healthCutoff float64, set string, limit int) ([]object.Slab, error) {
 	var dbBatch []dbSlab
 	var slabs []object.Slab
 
 	if err := s.db.
-		Select(`slabs.*,
-		        CASE
-				  WHEN (slabs.min_shards = slabs.total_shards)
-				  THEN
-				    CASE
-					WHEN (COUNT(DISTINCT(c.host_id)) < slabs.min_shards)
-					THEN
-					  0
-					ELSE
-					  1
-					END
-				  ELSE
-				  CAST((COUNT(DISTINCT(c.host_id)) - slabs.min_shards) AS FLOAT) / Cast(slabs.total_shards - slabs.min_shards AS FLOAT)
-				  END AS health`).
+		Select("slabs.*, "+sqlSlabHealth).
 		Model(&dbSlab{}).
 		Joins("INNER JOIN shards sh ON sh.db_slab_id = slabs.id").
 		Joins("INNER JOIN sectors s ON sh.db_sector_id = s.id").
@@ -822,7 +1500,7 @@ func (s *SQLStore) UnhealthySlabs(ctx context.Context, healthCutoff float64, set
 		Joins("LEFT JOIN contracts c ON se.db_contract_id = c.id").
 		Joins("INNER JOIN contract_set_contracts csc ON csc.db_contract_id = c.id").
 		Joins("INNER JOIN contract_sets cs ON cs.id = csc.db_contract_set_id").
-		Where("cs.name = ?", set).
+		Where("cs.name = ? AND slabs.key_wrapped = ?", set, false).
 		Group("slabs.id").
 		Having("health <= ?", healthCutoff).
 		Order("health ASC").
@@ -830,7 +1508,7 @@ func (s *SQLStore) UnhealthySlabs(ctx context.Context, healthCutoff float64, set
 		Preload("Shards.DBSector").
 		FindInBatches(&dbBatch, slabRetrievalBatchSize, func(tx *gorm.DB, batch int) error {
 			for _, dbSlab := range dbBatch {
-				if slab, err := dbSlab.convert(); err == nil {
+				if slab, err := dbSlab.convert(s.keyCipher); err == nil {
 					slabs = append(slabs, slab)
 				} else {
 					panic(err)
@@ -849,7 +1527,8 @@ func (s *SQLStore) UnhealthySlabs(ctx context.Context, healthCutoff float64, set
 func (s *SQLStore) object(ctx context.Context, key string) (dbObject, error) {
 	var obj dbObject
 	tx := s.db.Where(&dbObject{ObjectID: key}).
-		Preload("Slabs.Slab.Shards.DBSector.Contracts.Host").
+		Preload("Slabs.DBSlab.Shards.DBSector.Contracts.Host").
+		Preload("PartialSlab").
 		Take(&obj)
 	if errors.Is(tx.Error, gorm.ErrRecordNotFound) {
 		return dbObject{}, ErrObjectNotFound
@@ -910,6 +1589,12 @@ func addContract(tx *gorm.DB, c rhpv2.ContractRevision, totalCost types.Currency
 	contract := dbContract{
 		HostID: hostID,
 
+		RemainingFunds:          zeroCurrency,
+		LatestRevisionNumber:    fmt.Sprint(c.Revision.RevisionNumber),
+		BroadcastRevisionNumber: "0",
+		GoodForUpload:           true,
+		GoodForRenew:            true,
+
 		ContractCommon: ContractCommon{
 			FCID:        fileContractID(fcid),
 			RenewedFrom: fileContractID(renewedFrom),
@@ -921,11 +1606,16 @@ func addContract(tx *gorm.DB, c rhpv2.ContractRevision, totalCost types.Currency
 			WindowEnd:      c.Revision.WindowEnd,
 
 			UploadSpending:      zeroCurrency,
+			StorageSpending:     zeroCurrency,
 			DownloadSpending:    zeroCurrency,
 			FundAccountSpending: zeroCurrency,
 		},
 	}
 
+	if len(c.Revision.ValidProofOutputs) > 0 {
+		contract.RemainingFunds = currency(c.Revision.ValidRenterPayout())
+	}
+
 	// Insert contract.
 	err = tx.Create(&contract).Error
 	if err != nil {
@@ -934,9 +1624,61 @@ func addContract(tx *gorm.DB, c rhpv2.ContractRevision, totalCost types.Currency
 	return contract, nil
 }
 
+// checkIfMatch returns api.ErrPreconditionFailed if ifMatch, the value of an
+// If-Match header, is set and doesn't match the ETag of the object with the
+// given key as per RFC 7232. "*" matches any existing object, otherwise one of
+// the listed ETags has to be equal to the object's quoted ETag. Weak ETags
+// never match.
+func checkIfMatch(tx *gorm.DB, key, ifMatch string) error {
+	if ifMatch == "" {
+		return nil
+	}
+	var etags []string
+	if err := tx.Model(&dbObject{}).Where("object_id", key).Pluck("e_tag", &etags).Error; err != nil {
+		return err
+	} else if len(etags) == 0 {
+		return fmt.Errorf("%w: object %v doesn't exist", api.ErrPreconditionFailed, key)
+	}
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || (etags[0] != "" && tag == fmt.Sprintf("%q", etags[0])) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: ETag of object %v doesn't match", api.ErrPreconditionFailed, key)
+}
+
 // removeObject removes an object from the store.
 func removeObject(tx *gorm.DB, key string) error {
-	return tx.Where(&dbObject{ObjectID: key}).Delete(&dbObject{}).Error
+	// fetch the object's slabs, slabs that aren't shared with another object
+	// are removed together with the object
+	var slabIDs []uint
+	err := tx.
+		Model(&dbSlice{}).
+		Joins("INNER JOIN objects o ON o.id = slices.db_object_id").
+		Where("o.object_id = ?", key).
+		Pluck("slices.db_slab_id", &slabIDs).
+		Error
+	if err != nil {
+		return err
+	}
+	if err := tx.Where(&dbObject{ObjectID: key}).Delete(&dbObject{}).Error; err != nil {
+		return err
+	}
+	return pruneSlabs(tx, slabIDs)
+}
+
+// pruneSlabs removes the slabs with the given ids that aren't referenced by
+// any slice.
+func pruneSlabs(tx *gorm.DB, ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return tx.
+		Where("id IN ?", ids).
+		Where("NOT EXISTS (SELECT 1 FROM slices sli WHERE sli.db_slab_id = slabs.id)").
+		Delete(&dbSlab{}).
+		Error
 }
 
 // removeContract removes a contract from the store.
@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	rhpv2 "go.sia.tech/core/rhp/v2"
@@ -138,7 +140,13 @@ func TestSQLContractStore(t *testing.T) {
 			Downloads:   types.ZeroCurrency,
 			FundAccount: types.ZeroCurrency,
 		},
-		TotalCost: totalCost,
+		TotalCost:      totalCost,
+		RemainingFunds: types.NewCurrency64(121),
+		ContractUsability: api.ContractUsability{
+			GoodForUpload: true,
+			GoodForRenew:  true,
+		},
+		LatestRevisionNumber: 200,
 	}
 	if !reflect.DeepEqual(fetched, expected) {
 		t.Fatal("contract mismatch")
@@ -329,7 +337,7 @@ func TestRenewedContract(t *testing.T) {
 	if err := cs.UpdateObject(context.Background(), "foo", obj, map[types.PublicKey]types.FileContractID{
 		hk:  fcid1,
 		hk2: fcid2,
-	}); err != nil {
+	}, nil, false, ""); err != nil {
 		t.Fatal(err)
 	}
 
@@ -401,6 +409,10 @@ func TestRenewedContract(t *testing.T) {
 			FundAccount: types.ZeroCurrency,
 		},
 		TotalCost: newContractTotal,
+		ContractUsability: api.ContractUsability{
+			GoodForUpload: true,
+			GoodForRenew:  true,
+		},
 	}
 	if !reflect.DeepEqual(newContract, expected) {
 		t.Fatal("mismatch")
@@ -667,12 +679,12 @@ func TestSQLMetadataStore(t *testing.T) {
 	// Store it.
 	ctx := context.Background()
 	objID := "key1"
-	if err := db.UpdateObject(ctx, objID, obj1, usedHosts); err != nil {
+	if err := db.UpdateObject(ctx, objID, obj1, usedHosts, nil, false, ""); err != nil {
 		t.Fatal(err)
 	}
 
 	// Try to store it again. Should work.
-	if err := db.UpdateObject(ctx, objID, obj1, usedHosts); err != nil {
+	if err := db.UpdateObject(ctx, objID, obj1, usedHosts, nil, false, ""); err != nil {
 		t.Fatal(err)
 	}
 
@@ -701,24 +713,26 @@ func TestSQLMetadataStore(t *testing.T) {
 	obj.Model = Model{}
 	for i := range obj.Slabs {
 		obj.Slabs[i].Model = Model{}
-		obj.Slabs[i].Slab.Model = Model{}
-		obj.Slabs[i].Slab.Shards[0].ID = 0
-		obj.Slabs[i].Slab.Shards[0].DBSector.Model = Model{}
-		obj.Slabs[i].Slab.Shards[0].DBSector.Contracts[0].Model = Model{}
-		obj.Slabs[i].Slab.Shards[0].DBSector.Contracts[0].Host.Model = Model{}
+		obj.Slabs[i].DBSlab.Model = Model{}
+		obj.Slabs[i].DBSlab.Shards[0].ID = 0
+		obj.Slabs[i].DBSlab.Shards[0].DBSector.Model = Model{}
+		obj.Slabs[i].DBSlab.Shards[0].DBSector.Contracts[0].Model = Model{}
+		obj.Slabs[i].DBSlab.Shards[0].DBSector.Contracts[0].Host.Model = Model{}
 	}
 
 	expectedObj := dbObject{
-		ObjectID: objID,
-		Key:      obj1Key,
+		ObjectID:   objID,
+		Key:        obj1Key,
+		Importance: 1,
 		Slabs: []dbSlice{
 			{
 				DBObjectID: 1,
-				Slab: dbSlab{
-					DBSliceID:   1,
-					Key:         obj1Slab0Key,
-					MinShards:   1,
-					TotalShards: 1,
+				DBSlabID:   1,
+				DBSlab: dbSlab{
+					Key:             obj1Slab0Key,
+					MinShards:       1,
+					TotalShards:     1,
+					PersistedHealth: 1,
 					Shards: []dbShard{
 						{
 							DBSlabID:   1,
@@ -732,6 +746,11 @@ func TestSQLMetadataStore(t *testing.T) {
 										Host: dbHost{
 											PublicKey: publicKey(hk1),
 										},
+										RemainingFunds:          currency(types.NewCurrency64(121)),
+										LatestRevisionNumber:    "200",
+										BroadcastRevisionNumber: "0",
+										GoodForUpload:           true,
+										GoodForRenew:            true,
 
 										ContractCommon: ContractCommon{
 											FCID: fileContractID(fcid1),
@@ -757,11 +776,12 @@ func TestSQLMetadataStore(t *testing.T) {
 			},
 			{
 				DBObjectID: 1,
-				Slab: dbSlab{
-					DBSliceID:   2,
-					Key:         obj1Slab1Key,
-					MinShards:   2,
-					TotalShards: 1,
+				DBSlabID:   2,
+				DBSlab: dbSlab{
+					Key:             obj1Slab1Key,
+					MinShards:       2,
+					TotalShards:     1,
+					PersistedHealth: 1,
 					Shards: []dbShard{
 						{
 							DBSlabID:   2,
@@ -775,6 +795,11 @@ func TestSQLMetadataStore(t *testing.T) {
 										Host: dbHost{
 											PublicKey: publicKey(hk2),
 										},
+										RemainingFunds:          currency(types.NewCurrency64(121)),
+										LatestRevisionNumber:    "200",
+										BroadcastRevisionNumber: "0",
+										GoodForUpload:           true,
+										GoodForRenew:            true,
 										ContractCommon: ContractCommon{
 											FCID: fileContractID(fcid2),
 
@@ -808,6 +833,10 @@ func TestSQLMetadataStore(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	if fullObj.ModTime.IsZero() {
+		t.Fatal("modification time wasn't set")
+	}
+	fullObj.ModTime = time.Time{}
 	if !reflect.DeepEqual(fullObj, obj1) {
 		t.Fatal("object mismatch")
 	}
@@ -816,13 +845,17 @@ func TestSQLMetadataStore(t *testing.T) {
 	// second one.
 	obj1.Slabs = obj1.Slabs[1:]
 	obj1.Slabs[0].Slab.MinShards = 123
-	if err := db.UpdateObject(ctx, objID, obj1, usedHosts); err != nil {
+	if err := db.UpdateObject(ctx, objID, obj1, usedHosts, nil, false, ""); err != nil {
 		t.Fatal(err)
 	}
 	fullObj, err = db.Object(ctx, objID)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if fullObj.ModTime.IsZero() {
+		t.Fatal("modification time wasn't set")
+	}
+	fullObj.ModTime = time.Time{}
 	if !reflect.DeepEqual(fullObj, obj1) {
 		t.Fatal("object mismatch")
 	}
@@ -869,7 +902,7 @@ func TestSQLMetadataStore(t *testing.T) {
 
 	// Delete the object. Due to the cascade this should delete everything
 	// but the sectors.
-	if err := db.RemoveObject(ctx, objID); err != nil {
+	if err := db.RemoveObject(ctx, objID, ""); err != nil {
 		t.Fatal(err)
 	}
 	if err := countCheck(0, 0, 0, 0, 2, 0); err != nil {
@@ -891,9 +924,22 @@ func TestObjects(t *testing.T) {
 		"/gab/guub",
 	}
 	ctx := context.Background()
+	sizes := make(map[string]int64)
+	slabs := make(map[string]int)
 	for _, path := range paths {
 		obj, ucs := newTestObject(frand.Intn(10))
-		os.UpdateObject(ctx, path, obj, ucs)
+		os.UpdateObject(ctx, path, obj, ucs, nil, true, "")
+		for _, ss := range obj.Slabs {
+			sizes[path] += int64(ss.Length)
+		}
+		slabs[path] = len(obj.Slabs)
+	}
+	names := func(entries []api.ObjectMetadata) []string {
+		names := make([]string, len(entries))
+		for i, entry := range entries {
+			names[i] = entry.Name
+		}
+		return names
 	}
 	tests := []struct {
 		path   string
@@ -911,23 +957,92 @@ func TestObjects(t *testing.T) {
 		{"/gab/", "/guub", []string{}},
 	}
 	for _, test := range tests {
-		got, err := os.Objects(ctx, test.path, test.prefix, 0, -1)
+		entries, err := os.Objects(ctx, test.path, test.prefix, -math.MaxFloat64, math.MaxFloat64, 0, -1)
 		if err != nil {
 			t.Fatal(err)
 		}
+		got := names(entries)
 		if !(len(got) == 0 && len(test.want) == 0) && !reflect.DeepEqual(got, test.want) {
 			t.Errorf("\nlist: %v\nprefix: %v\ngot: %v\nwant: %v", test.path, test.prefix, got, test.want)
 		}
 		for offset := 0; offset < len(test.want); offset++ {
-			got, err := os.Objects(ctx, test.path, test.prefix, offset, 1)
+			entries, err := os.Objects(ctx, test.path, test.prefix, -math.MaxFloat64, math.MaxFloat64, offset, 1)
 			if err != nil {
 				t.Fatal(err)
 			}
+			got := names(entries)
 			if len(got) != 1 || got[0] != test.want[offset] {
 				t.Errorf("\nlist: %v\nprefix: %v\ngot: %v\nwant: %v", test.path, test.prefix, got, test.want[offset])
 			}
 		}
 	}
+
+	// lower the health of one of the slabs of /foo/bar, unless it has none
+	if slabs["/foo/bar"] > 0 {
+		var obj dbObject
+		if err := os.db.Where("object_id", "/foo/bar").Preload("Slabs").Take(&obj).Error; err != nil {
+			t.Fatal(err)
+		} else if err := os.db.Model(&dbSlab{}).Where("id", obj.Slabs[0].DBSlabID).Update("persisted_health", 0.5).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the metadata of the directories is aggregated over their objects
+	entries, err := os.Objects(ctx, "/", "", -math.MaxFloat64, math.MaxFloat64, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 2 {
+		t.Fatalf("unexpected number of entries, %v != 2", len(entries))
+	}
+	foo, gab := entries[0], entries[1]
+	if size := sizes["/foo/bar"] + sizes["/foo/bat"] + sizes["/foo/baz/quux"] + sizes["/foo/baz/quuz"]; foo.Size != size {
+		t.Errorf("unexpected size, %v != %v", foo.Size, size)
+	} else if n := slabs["/foo/bar"] + slabs["/foo/bat"] + slabs["/foo/baz/quux"] + slabs["/foo/baz/quuz"]; foo.Slabs != n {
+		t.Errorf("unexpected number of slabs, %v != %v", foo.Slabs, n)
+	} else if foo.ModTime.IsZero() || foo.ModTime.After(time.Now()) {
+		t.Errorf("unexpected mod time, %v", foo.ModTime)
+	} else if slabs["/foo/bar"] > 0 && foo.Health != 0.5 {
+		t.Errorf("unexpected health, %v != 0.5", foo.Health)
+	}
+	if gab.Size != sizes["/gab/guub"] || gab.Slabs != slabs["/gab/guub"] || gab.Health != 1 {
+		t.Errorf("unexpected metadata, %+v", gab)
+	}
+
+	// filter the entries by health
+	if slabs["/foo/bar"] > 0 {
+		for _, test := range []struct {
+			path      string
+			minHealth float64
+			maxHealth float64
+			want      []string
+		}{
+			{"/", 0, 0.9, []string{"/foo/"}},
+			{"/", 0.9, 1, []string{"/gab/"}},
+			{"/foo/", 0, 0.5, []string{"/foo/bar"}},
+			{"/foo/", 0.6, math.MaxFloat64, []string{"/foo/bat", "/foo/baz/"}},
+			{"/foo/baz/", 0, 0.9, nil},
+		} {
+			entries, err := os.Objects(ctx, test.path, "", test.minHealth, test.maxHealth, 0, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := names(entries); !(len(got) == 0 && len(test.want) == 0) && !reflect.DeepEqual(got, test.want) {
+				t.Errorf("\nlist: %v\nhealth: [%v, %v]\ngot: %v\nwant: %v", test.path, test.minHealth, test.maxHealth, got, test.want)
+			}
+		}
+
+		// the unhealthy object should be found by searching as well
+		if got, err := os.SearchObjects(ctx, "/", 0, 0.9, 0, -1); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(got, []string{"/foo/bar"}) {
+			t.Errorf("unexpected search result, %v", got)
+		}
+		if got, err := os.SearchObjects(ctx, "/foo/", 0.9, 1, 0, -1); err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(got, []string{"/foo/bat", "/foo/baz/quux", "/foo/baz/quuz"}) {
+			t.Errorf("unexpected search result, %v", got)
+		}
+	}
 }
 
 // TestSearchObjects is a test for the SearchObjects method.
@@ -946,7 +1061,7 @@ func TestSearchObjects(t *testing.T) {
 	ctx := context.Background()
 	for _, path := range paths {
 		obj, ucs := newTestObject(frand.Intn(10))
-		os.UpdateObject(ctx, path, obj, ucs)
+		os.UpdateObject(ctx, path, obj, ucs, nil, true, "")
 	}
 	tests := []struct {
 		key  string
@@ -958,7 +1073,7 @@ func TestSearchObjects(t *testing.T) {
 		{"uu", []string{"/foo/baz/quux", "/foo/baz/quuz", "/gab/guub"}},
 	}
 	for _, test := range tests {
-		got, err := os.SearchObjects(ctx, test.key, 0, -1)
+		got, err := os.SearchObjects(ctx, test.key, -math.MaxFloat64, math.MaxFloat64, 0, -1)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -966,7 +1081,7 @@ func TestSearchObjects(t *testing.T) {
 			t.Errorf("\nkey: %v\ngot: %v\nwant: %v", test.key, got, test.want)
 		}
 		for offset := 0; offset < len(test.want); offset++ {
-			got, err := os.SearchObjects(ctx, test.key, offset, 1)
+			got, err := os.SearchObjects(ctx, test.key, -math.MaxFloat64, math.MaxFloat64, offset, 1)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -1123,7 +1238,7 @@ func TestUnhealthySlabs(t *testing.T) {
 		hk3: fcid3,
 		hk4: fcid4,
 		{5}: {5}, // deleted host and contract
-	}); err != nil {
+	}, nil, true, ""); err != nil {
 		t.Fatal(err)
 	}
 
@@ -1160,6 +1275,50 @@ func TestUnhealthySlabs(t *testing.T) {
 	if reflect.DeepEqual(slabs, expected) {
 		t.Fatal("slabs are not returned in the correct order")
 	}
+
+	// assert the health of every slab is computed, least healthy first
+	health, err := db.SlabHealth(ctx, "autopilot", -1)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(health) != 5 {
+		t.Fatalf("unexpected amount of slabs, %v!=5", len(health))
+	}
+	for i, want := range []float64{0, 0, 0.5, 0.5, 1} {
+		if health[i].Health != want {
+			t.Fatalf("unexpected health of slab %v, %v!=%v", i, health[i].Health, want)
+		}
+	}
+	if health[4].Key.String() != obj.Slabs[0].Key.String() || health[4].Hosts != 3 || health[4].TotalShards != 3 {
+		t.Fatal("unexpected slab health", health[4])
+	}
+
+	// assert the limit is applied
+	health, err = db.SlabHealth(ctx, "autopilot", 2)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(health) != 2 || health[1].Health != 0 {
+		t.Fatal("unexpected slab health", health)
+	}
+
+	// assert the persisted health isn't considered refreshed before it was
+	// computed
+	summary, err := db.SlabHealthSummary(ctx, 0.49)
+	if err != nil {
+		t.Fatal(err)
+	} else if summary.Slabs != 5 || !summary.Refreshed.IsZero() {
+		t.Fatal("unexpected summary", summary)
+	}
+
+	// refresh the health in batches and assert it's persisted
+	if err := db.RefreshSlabHealth(ctx, "autopilot", 2); err != nil {
+		t.Fatal(err)
+	}
+	summary, err = db.SlabHealthSummary(ctx, 0.49)
+	if err != nil {
+		t.Fatal(err)
+	} else if summary.Slabs != 5 || summary.Unhealthy != 2 || summary.MinHealth != 0 || summary.Refreshed.IsZero() {
+		t.Fatal("unexpected summary", summary)
+	}
 }
 
 // TestUnhealthySlabs tests the functionality of UnhealthySlabs on slabs that
@@ -1232,7 +1391,7 @@ func TestUnhealthySlabsNoRedundancy(t *testing.T) {
 		hk1: fcid1,
 		hk2: fcid2,
 		hk3: fcid3,
-	}); err != nil {
+	}, nil, false, ""); err != nil {
 		t.Fatal(err)
 	}
 
@@ -1252,6 +1411,75 @@ func TestUnhealthySlabsNoRedundancy(t *testing.T) {
 	}
 }
 
+// TestUnhealthyWrappedSlabs asserts that slabs of passphrase protected objects
+// aren't migrated but are accounted for in the health summary.
+func TestUnhealthyWrappedSlabs(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hks, err := db.addTestHosts(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcids, _, err := db.addTestContracts(hks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := db.SetContractSet(ctx, "autopilot", fcids[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	// add two objects with a slab that lost a shard since its host isn't in
+	// the set, one of them is protected by a passphrase
+	newObject := func() object.Object {
+		return object.Object{
+			Key: object.GenerateEncryptionKey(),
+			Slabs: []object.SlabSlice{{
+				Slab: object.Slab{
+					Key:       object.GenerateEncryptionKey(),
+					MinShards: 1,
+					Shards: []object.Sector{
+						{Host: hks[0], Root: frand.Entropy256()},
+						{Host: hks[1], Root: frand.Entropy256()},
+					},
+				},
+			}},
+		}
+	}
+	wrapped := newObject()
+	wrapped.WrapKeys("foo")
+	usedContracts := map[types.PublicKey]types.FileContractID{hks[0]: fcids[0], hks[1]: fcids[1]}
+	if err := db.UpdateObject(ctx, "plain", newObject(), usedContracts, nil, false, ""); err != nil {
+		t.Fatal(err)
+	} else if err := db.UpdateObject(ctx, "wrapped", wrapped, usedContracts, nil, false, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert only the slab of the plain object is migrated
+	if slabs, err := db.UnhealthySlabs(ctx, 0.99, "autopilot", -1); err != nil {
+		t.Fatal(err)
+	} else if len(slabs) != 1 || slabs[0].Wrapped {
+		t.Fatal("unexpected slabs", slabs)
+	}
+	if n, err := db.EnqueueSlabsForRepair(ctx, "autopilot", 0.99); err != nil {
+		t.Fatal(err)
+	} else if n != 1 {
+		t.Fatalf("unexpected number of enqueued slabs, %v!=1", n)
+	}
+
+	// assert the summary counts both slabs but reports the wrapped one
+	if err := db.RefreshSlabHealth(ctx, "autopilot", 10); err != nil {
+		t.Fatal(err)
+	}
+	if summary, err := db.SlabHealthSummary(ctx, 0.99); err != nil {
+		t.Fatal(err)
+	} else if summary.Slabs != 2 || summary.Unhealthy != 2 || summary.UnhealthyWrapped != 1 {
+		t.Fatal("unexpected summary", summary)
+	}
+}
+
 // TestContractSectors is a test for the contract_sectors join table. It
 // verifies that deleting contracts or sectors also cleans up the join table.
 func TestContractSectors(t *testing.T) {
@@ -1298,7 +1526,7 @@ func TestContractSectors(t *testing.T) {
 		},
 	}
 	ctx := context.Background()
-	if err := db.UpdateObject(ctx, "foo", obj, usedContracts); err != nil {
+	if err := db.UpdateObject(ctx, "foo", obj, usedContracts, nil, false, ""); err != nil {
 		t.Fatal(err)
 	}
 
@@ -1324,12 +1552,12 @@ func TestContractSectors(t *testing.T) {
 	}
 
 	// Add the object again.
-	if err := db.UpdateObject(ctx, "foo", obj, usedContracts); err != nil {
+	if err := db.UpdateObject(ctx, "foo", obj, usedContracts, nil, false, ""); err != nil {
 		t.Fatal(err)
 	}
 
 	// Delete the object.
-	if err := db.RemoveObject(ctx, "foo"); err != nil {
+	if err := db.RemoveObject(ctx, "foo", ""); err != nil {
 		t.Fatal(err)
 	}
 
@@ -1392,7 +1620,7 @@ func TestPutSlab(t *testing.T) {
 	if err := db.UpdateObject(ctx, "foo", obj, map[types.PublicKey]types.FileContractID{
 		hk1: fcid1,
 		hk2: fcid2,
-	}); err != nil {
+	}, nil, false, ""); err != nil {
 		t.Fatal(err)
 	}
 
@@ -1555,6 +1783,92 @@ func newTestObject(slabs int) (object.Object, map[types.PublicKey]types.FileCont
 	return obj, usedContracts
 }
 
+// TestUpdateContractUsability tests UpdateContractUsability.
+func TestUpdateContractUsability(t *testing.T) {
+	cs, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	hks, err := cs.addTestHosts(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcids, _, err := cs.addTestContracts(hks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// new contracts are good for everything
+	if c, err := cs.Contract(ctx, fcids[0]); err != nil {
+		t.Fatal(err)
+	} else if !c.GoodForUpload || !c.GoodForRenew {
+		t.Fatal("unexpected usability", c.ContractUsability)
+	}
+
+	// mark the first contract as not good for upload, the update for the
+	// unknown contract is ignored
+	err = cs.UpdateContractUsability(ctx, []api.ContractUsabilityUpdate{
+		{ContractID: fcids[0], ContractUsability: api.ContractUsability{GoodForRenew: true}},
+		{ContractID: types.FileContractID{1, 2, 3}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err := cs.Contract(ctx, fcids[0]); err != nil {
+		t.Fatal(err)
+	} else if c.GoodForUpload || !c.GoodForRenew {
+		t.Fatal("unexpected usability", c.ContractUsability)
+	}
+	if c, err := cs.Contract(ctx, fcids[1]); err != nil {
+		t.Fatal(err)
+	} else if !c.GoodForUpload || !c.GoodForRenew {
+		t.Fatal("unexpected usability", c.ContractUsability)
+	}
+}
+
+// TestRecordContractBroadcast tests RecordContractBroadcast.
+func TestRecordContractBroadcast(t *testing.T) {
+	cs, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	hks, err := cs.addTestHosts(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcids, _, err := cs.addTestContracts(hks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the contract was never broadcast
+	if c, err := cs.Contract(ctx, fcids[0]); err != nil {
+		t.Fatal(err)
+	} else if c.Broadcast != nil {
+		t.Fatal("unexpected broadcast", c.Broadcast)
+	}
+
+	// record a broadcast
+	cb := api.ContractBroadcast{RevisionNumber: math.MaxUint64, Height: 10, TransactionID: types.TransactionID{1}}
+	if err := cs.RecordContractBroadcast(ctx, fcids[0], cb); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := cs.Contract(ctx, fcids[0]); err != nil {
+		t.Fatal(err)
+	} else if c.Broadcast == nil || *c.Broadcast != cb {
+		t.Fatal("unexpected broadcast", c.Broadcast)
+	}
+
+	// unknown contracts can't be broadcast
+	if err := cs.RecordContractBroadcast(ctx, types.FileContractID{1, 2, 3}, cb); !errors.Is(err, ErrContractNotFound) {
+		t.Fatal("unexpected error", err)
+	}
+}
+
 // TestRecordContractSpending tests RecordContractSpending.
 func TestRecordContractSpending(t *testing.T) {
 	cs, _, _, err := newTestSQLStore()
@@ -1630,4 +1944,380 @@ func TestRecordContractSpending(t *testing.T) {
 	if cm3.Spending != expectedSpending {
 		t.Fatal("invalid spending")
 	}
+
+	// Record spending with remaining funds, the latest revision wins.
+	err = cs.RecordContractSpending(context.Background(), []api.ContractSpendingRecord{
+		{
+			ContractID:     fcid,
+			RevisionNumber: 2,
+			RemainingFunds: types.Siacoins(5),
+		},
+		{
+			ContractID:     fcid,
+			RevisionNumber: 1,
+			RemainingFunds: types.Siacoins(6),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm4, err := cs.Contract(context.Background(), fcid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cm4.Spending != expectedSpending {
+		t.Fatal("invalid spending")
+	} else if !cm4.RemainingFunds.Equals(types.Siacoins(5)) {
+		t.Fatal("invalid remaining funds", cm4.RemainingFunds)
+	} else if cm4.LatestRevisionNumber != cm.LatestRevisionNumber {
+		t.Fatal("latest revision number shouldn't decrease", cm4.LatestRevisionNumber)
+	}
+
+	// Record spending for a newer revision, it updates the latest revision
+	// number.
+	err = cs.RecordContractSpending(context.Background(), []api.ContractSpendingRecord{
+		{
+			ContractID:     fcid,
+			RevisionNumber: cm.LatestRevisionNumber + 1,
+			RemainingFunds: types.Siacoins(4),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm5, err := cs.Contract(context.Background(), fcid)
+	if err != nil {
+		t.Fatal(err)
+	} else if cm5.LatestRevisionNumber != cm.LatestRevisionNumber+1 {
+		t.Fatal("invalid latest revision number", cm5.LatestRevisionNumber)
+	}
+
+	// Record storage spending and add the contract to a set together with a
+	// contract without storage spending.
+	err = cs.RecordContractSpending(context.Background(), []api.ContractSpendingRecord{
+		{
+			ContractID:       fcid,
+			ContractSpending: api.ContractSpending{Storage: types.Siacoins(1)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcid2 := types.FileContractID{2, 2, 2, 2, 2}
+	if _, err := cs.addTestContract(fcid2, hk); err != nil {
+		t.Fatal(err)
+	} else if err := cs.SetContractSet(context.Background(), "foo", []types.FileContractID{fcid, fcid2}); err != nil {
+		t.Fatal(err)
+	} else if contracts, err := cs.Contracts(context.Background(), "foo"); err != nil {
+		t.Fatal(err)
+	} else if len(contracts) != 2 {
+		t.Fatal("unexpected number of contracts", len(contracts))
+	}
+}
+
+// TestContractObjects tests listing the objects affected by a contract.
+func TestContractObjects(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	hks, err := db.addTestHosts(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcids, _, err := db.addTestContracts(hks)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// add two objects, 'foo' has two shards on the second contract, 'bar'
+	// has none
+	usedContracts := map[types.PublicKey]types.FileContractID{hks[0]: fcids[0], hks[1]: fcids[1]}
+	for key, shards := range map[string][]object.Sector{
+		"foo": {{Host: hks[0], Root: types.Hash256{1}}, {Host: hks[1], Root: types.Hash256{2}}, {Host: hks[1], Root: types.Hash256{3}}},
+		"bar": {{Host: hks[0], Root: types.Hash256{4}}},
+	} {
+		obj := object.Object{
+			Key: object.GenerateEncryptionKey(),
+			Slabs: []object.SlabSlice{{
+				Slab: object.Slab{Key: object.GenerateEncryptionKey(), MinShards: 1, Shards: shards},
+			}},
+		}
+		if err := db.UpdateObject(ctx, key, obj, usedContracts, nil, false, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if objects, err := db.ContractObjects(ctx, fcids[0]); err != nil {
+		t.Fatal(err)
+	} else if len(objects) != 2 || objects[0].Key != "bar" || objects[1].Key != "foo" {
+		t.Fatal("unexpected objects", objects)
+	}
+	if objects, err := db.ContractObjects(ctx, fcids[1]); err != nil {
+		t.Fatal(err)
+	} else if len(objects) != 1 || objects[0].Key != "foo" || len(objects[0].Slabs) != 1 || objects[0].Slabs[0].Shards != 2 {
+		t.Fatal("unexpected objects", objects)
+	}
+	if _, err := db.ContractObjects(ctx, types.FileContractID{9}); !errors.Is(err, ErrContractNotFound) {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+// TestRenameObjects tests RenameObjects.
+func TestRenameObjects(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for _, key := range []string{"/my_dir/a", "/my_dir/b/c", "/myXdir/d", "/other/e"} {
+		obj, ucs := newTestObject(0)
+		if err := db.UpdateObject(ctx, key, obj, ucs, nil, false, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys := func() []string {
+		t.Helper()
+		var keys []string
+		if err := db.db.Model(&dbObject{}).Order("object_id ASC").Pluck("object_id", &keys).Error; err != nil {
+			t.Fatal(err)
+		}
+		return keys
+	}
+
+	// the underscore isn't treated as a wildcard
+	if renamed, err := db.RenameObjects(ctx, "/my_dir/", "/new/"); err != nil {
+		t.Fatal(err)
+	} else if renamed != 2 {
+		t.Fatalf("unexpected number of renamed objects, %v != 2", renamed)
+	}
+	if got, want := keys(), []string{"/myXdir/d", "/new/a", "/new/b/c", "/other/e"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected keys, %v != %v", got, want)
+	}
+
+	// renaming onto an existing directory fails without renaming anything
+	if _, err := db.RenameObjects(ctx, "/new/", "/other/"); !errors.Is(err, api.ErrObjectExists) {
+		t.Fatal("unexpected error", err)
+	}
+	if got, want := keys(), []string{"/myXdir/d", "/new/a", "/new/b/c", "/other/e"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected keys, %v != %v", got, want)
+	}
+
+	// renaming a directory that doesn't exist is a no-op
+	if renamed, err := db.RenameObjects(ctx, "/missing/", "/foo/"); err != nil {
+		t.Fatal(err)
+	} else if renamed != 0 {
+		t.Fatalf("unexpected number of renamed objects, %v != 0", renamed)
+	}
+}
+
+// TestObjectModTimeAndETag verifies the modification time and ETag of an
+// object are persisted and that an explicit modification time is kept.
+func TestObjectModTimeAndETag(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// add an object without a modification time, it's set by the store
+	obj, ucs := newTestObject(0)
+	obj.ETag = "abcd"
+	before := time.Now().Add(-time.Second)
+	if err := db.UpdateObject(ctx, "/foo", obj, ucs, nil, false, ""); err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.Object(ctx, "/foo")
+	if err != nil {
+		t.Fatal(err)
+	} else if got.ETag != "abcd" {
+		t.Fatal("unexpected ETag", got.ETag)
+	} else if got.ModTime.Before(before) || got.ModTime.After(time.Now()) {
+		t.Fatal("unexpected modification time", got.ModTime)
+	}
+
+	// update the object with an explicit modification time
+	modTime := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	obj.ModTime = modTime
+	if err := db.UpdateObject(ctx, "/foo", obj, ucs, nil, false, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := db.Object(ctx, "/foo"); err != nil {
+		t.Fatal(err)
+	} else if !got.ModTime.Equal(modTime) {
+		t.Fatal("unexpected modification time", got.ModTime)
+	}
+}
+
+// TestObjectIfMatch verifies objects are only updated and removed if their
+// ETag matches the If-Match precondition.
+func TestObjectIfMatch(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// the precondition fails if the object doesn't exist, even for '*'
+	obj, ucs := newTestObject(0)
+	obj.ETag = "abcd"
+	if err := db.UpdateObject(ctx, "/foo", obj, ucs, nil, false, "*"); !errors.Is(err, api.ErrPreconditionFailed) {
+		t.Fatal("unexpected error", err)
+	}
+	if err := db.UpdateObject(ctx, "/foo", obj, ucs, nil, false, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// a mismatching or weak ETag fails the precondition
+	obj.ETag = "ef01"
+	for _, ifMatch := range []string{`"ef01"`, `W/"abcd"`, `abcd`} {
+		if err := db.UpdateObject(ctx, "/foo", obj, ucs, nil, false, ifMatch); !errors.Is(err, api.ErrPreconditionFailed) {
+			t.Fatalf("unexpected error for %v: %v", ifMatch, err)
+		}
+	}
+	if got, err := db.Object(ctx, "/foo"); err != nil {
+		t.Fatal(err)
+	} else if got.ETag != "abcd" {
+		t.Fatal("object shouldn't have been updated", got.ETag)
+	}
+
+	// a matching ETag in the list passes the precondition
+	if err := db.UpdateObject(ctx, "/foo", obj, ucs, nil, false, `"1234", "abcd"`); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := db.Object(ctx, "/foo"); err != nil {
+		t.Fatal(err)
+	} else if got.ETag != "ef01" {
+		t.Fatal("object should have been updated", got.ETag)
+	}
+
+	// the same applies to removing the object
+	if err := db.RemoveObject(ctx, "/foo", `"abcd"`); !errors.Is(err, api.ErrPreconditionFailed) {
+		t.Fatal("unexpected error", err)
+	}
+	if err := db.RemoveObject(ctx, "/foo", "*"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Object(ctx, "/foo"); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatal("unexpected error", err)
+	}
+	if err := db.RemoveObject(ctx, "/foo", "*"); !errors.Is(err, api.ErrPreconditionFailed) {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+// TestUpdateObjectRejectedShards verifies objects with shards that can't be
+// linked to a known contract are rejected, unless they're added partially.
+func TestUpdateObjectRejectedShards(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	hks, err := db.addTestHosts(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcids, _, err := db.addTestContracts(hks[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unknownHost := types.PublicKey{9}
+	missingHost := types.PublicKey{10}
+	obj := object.Object{
+		Key: object.GenerateEncryptionKey(),
+		Slabs: []object.SlabSlice{{
+			Slab: object.Slab{
+				Key:       object.GenerateEncryptionKey(),
+				MinShards: 1,
+				Shards: []object.Sector{
+					{Host: hks[0], Root: types.Hash256{1}},
+					{Host: hks[1], Root: types.Hash256{2}},
+					{Host: hks[2], Root: types.Hash256{3}},
+					{Host: unknownHost, Root: types.Hash256{4}},
+					{Host: missingHost, Root: types.Hash256{5}},
+				},
+			},
+		}},
+	}
+	usedContracts := map[types.PublicKey]types.FileContractID{
+		hks[0]:      fcids[0],
+		hks[1]:      fcids[0], // contract of another host
+		hks[2]:      {3},      // unknown contract
+		unknownHost: {4},
+	}
+
+	// the object is rejected
+	err = db.UpdateObject(ctx, "foo", obj, usedContracts, nil, false, "")
+	var uce *api.UsedContractsError
+	if !errors.As(err, &uce) {
+		t.Fatal("unexpected error", err)
+	}
+	expected := []api.RejectedShard{
+		{Slab: 0, Shard: 1, Root: types.Hash256{2}, HostKey: hks[1], ContractID: fcids[0], Reason: api.RejectReasonHostMismatch},
+		{Slab: 0, Shard: 2, Root: types.Hash256{3}, HostKey: hks[2], ContractID: types.FileContractID{3}, Reason: api.RejectReasonUnknownContract},
+		{Slab: 0, Shard: 3, Root: types.Hash256{4}, HostKey: unknownHost, ContractID: types.FileContractID{4}, Reason: api.RejectReasonUnknownHost},
+		{Slab: 0, Shard: 4, Root: types.Hash256{5}, HostKey: missingHost, Reason: api.RejectReasonNoContract},
+	}
+	if !reflect.DeepEqual(uce.Rejected, expected) {
+		t.Fatal("unexpected rejected shards", cmp.Diff(uce.Rejected, expected))
+	}
+	if _, err := db.Object(ctx, "foo"); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// add it partially, only the valid shard is linked to a contract
+	if err := db.UpdateObject(ctx, "foo", obj, usedContracts, nil, true, ""); err != nil {
+		t.Fatal(err)
+	}
+	if roots, err := db.ContractRoots(ctx, fcids[0]); err != nil {
+		t.Fatal(err)
+	} else if len(roots) != 1 || roots[0] != (types.Hash256{1}) {
+		t.Fatal("unexpected roots", roots)
+	}
+}
+
+// TestObjectKeyNonce verifies the nonce of an object whose key was derived from
+// the worker's master key is stored with the object, so the key can be
+// re-derived from the master key, even after the object was renamed.
+func TestObjectKeyNonce(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	masterKey := frand.Entropy256()
+	nonce := frand.Entropy256()
+	obj, ucs := newTestObject(0)
+	obj.Key, obj.KeyNonce = object.DeriveEncryptionKey(masterKey, nonce), &nonce
+	if err := db.UpdateObject(ctx, "/foo", obj, ucs, nil, false, ""); err != nil {
+		t.Fatal(err)
+	} else if _, err := db.RenameObjects(ctx, "/foo", "/bar"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := db.Object(ctx, "/bar")
+	if err != nil {
+		t.Fatal(err)
+	} else if got.KeyNonce == nil || *got.KeyNonce != nonce {
+		t.Fatal("unexpected nonce", got.KeyNonce)
+	} else if derived := object.DeriveEncryptionKey(masterKey, *got.KeyNonce); derived.String() != got.Key.String() {
+		t.Fatal("re-derived key doesn't match the stored key")
+	}
+
+	// objects with random keys don't have a nonce
+	obj, ucs = newTestObject(0)
+	if err := db.UpdateObject(ctx, "/baz", obj, ucs, nil, false, ""); err != nil {
+		t.Fatal(err)
+	} else if got, err := db.Object(ctx, "/baz"); err != nil {
+		t.Fatal(err)
+	} else if got.KeyNonce != nil {
+		t.Fatal("unexpected nonce", got.KeyNonce)
+	}
 }
@@ -0,0 +1,165 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/renterd/api"
+	"gorm.io/gorm"
+)
+
+type (
+	// dbPartialSlab is the tail of an object that is buffered until it can
+	// be packed into a slab together with the tails of other objects.
+	dbPartialSlab struct {
+		Model
+
+		DBObjectID  uint      `gorm:"unique;NOT NULL"`
+		MinShards   uint8     `gorm:"index:idx_partial_slabs_redundancy;NOT NULL"`
+		TotalShards uint8     `gorm:"index:idx_partial_slabs_redundancy;NOT NULL"`
+		Data        []byte    `gorm:"NOT NULL"`
+		LockedUntil time.Time `gorm:"index"`
+	}
+)
+
+// TableName implements the gorm.Tabler interface.
+func (dbPartialSlab) TableName() string { return "partial_slabs" }
+
+// PackedSlabsForUpload packs the buffered partial slabs with the given
+// redundancy into up to limit slabs. Only slabs that can't fit another
+// partial slab are returned, the partial slabs are locked for the given
+// duration so they aren't packed twice.
+func (s *SQLStore) PackedSlabsForUpload(ctx context.Context, lockingDuration time.Duration, minShards, totalShards uint8, limit int) (packed []api.PackedSlab, err error) {
+	if limit == 0 {
+		limit = -1
+	}
+	slabSize := uint64(minShards) * rhpv2.SectorSize
+
+	err = s.retryTransaction(func(tx *gorm.DB) error {
+		packed = nil
+
+		var rows []struct {
+			ID     uint
+			Length uint32
+		}
+		now := time.Now().UTC()
+		err := tx.
+			WithContext(ctx).
+			Model(&dbPartialSlab{}).
+			Select("id, LENGTH(data) AS length").
+			Where("min_shards = ? AND total_shards = ? AND locked_until < ?", minShards, totalShards, now).
+			Order("id ASC").
+			Find(&rows).
+			Error
+		if err != nil {
+			return err
+		}
+
+		// greedily pack the partial slabs in the order they were added, a
+		// slab is full once the next partial slab doesn't fit anymore
+		var packs [][]api.PackedPartialSlab
+		var current []api.PackedPartialSlab
+		var size uint64
+		for _, row := range rows {
+			if len(current) > 0 && size+uint64(row.Length) > slabSize {
+				packs = append(packs, current)
+				current, size = nil, 0
+				if len(packs) == limit {
+					break
+				}
+			}
+			current = append(current, api.PackedPartialSlab{
+				ID:     row.ID,
+				Offset: uint32(size),
+				Length: row.Length,
+			})
+			size += uint64(row.Length)
+		}
+
+		for _, partials := range packs {
+			ids := make([]uint, len(partials))
+			for i := range partials {
+				ids[i] = partials[i].ID
+			}
+			var slabs []dbPartialSlab
+			if err := tx.
+				Where("id IN ?", ids).
+				Order("id ASC").
+				Find(&slabs).
+				Error; err != nil {
+				return err
+			} else if len(slabs) != len(partials) {
+				return errors.New("partial slabs were removed while packing")
+			}
+
+			data := make([]byte, 0, slabSize)
+			for _, ps := range slabs {
+				data = append(data, ps.Data...)
+			}
+			if err := tx.
+				Model(&dbPartialSlab{}).
+				Where("id IN ?", ids).
+				Update("locked_until", now.Add(lockingDuration)).
+				Error; err != nil {
+				return err
+			}
+			packed = append(packed, api.PackedSlab{
+				Partials:    partials,
+				MinShards:   minShards,
+				TotalShards: totalShards,
+				Data:        data,
+			})
+		}
+		return nil
+	})
+	return
+}
+
+// MarkPackedSlabsUploaded adds the uploaded packed slabs to the objects their
+// partial slabs belong to and removes the partial slabs. Partial slabs of
+// objects that were removed or overwritten in the meantime are skipped.
+func (s *SQLStore) MarkPackedSlabsUploaded(ctx context.Context, slabs []api.UploadedPackedSlab) error {
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		for _, us := range slabs {
+			slab, err := s.createSlab(tx.WithContext(ctx), us.Slab, us.UsedContracts)
+			if err != nil {
+				return err
+			}
+
+			for _, p := range us.Partials {
+				var ps dbPartialSlab
+				err := tx.
+					Select("id, db_object_id").
+					Where("id = ?", p.ID).
+					Take(&ps).
+					Error
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					continue
+				} else if err != nil {
+					return err
+				}
+
+				err = tx.Create(&dbSlice{
+					DBObjectID: ps.DBObjectID,
+					DBSlabID:   slab.ID,
+					Offset:     p.Offset,
+					Length:     p.Length,
+				}).Error
+				if err != nil {
+					return err
+				}
+				if err := tx.Delete(&ps).Error; err != nil {
+					return err
+				}
+			}
+
+			// remove the slab again if all of its objects are gone
+			if err := pruneSlabs(tx, []uint{slab.ID}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
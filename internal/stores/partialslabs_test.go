@@ -0,0 +1,126 @@
+package stores
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/object"
+	"lukechampine.com/frand"
+)
+
+// TestPartialSlabs verifies the tails of objects are packed into a shared
+// slab.
+func TestPartialSlabs(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	hks, err := db.addTestHosts(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcids, _, err := db.addTestContracts(hks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usedContracts := map[types.PublicKey]types.FileContractID{hks[0]: fcids[0]}
+
+	// add three objects that only consist of a partial slab
+	tails := map[string][]byte{
+		"foo": frand.Bytes(rhpv2.SectorSize / 2),
+		"bar": frand.Bytes(rhpv2.SectorSize / 4),
+		"baz": frand.Bytes(rhpv2.SectorSize / 2),
+	}
+	for _, key := range []string{"foo", "bar", "baz"} {
+		obj := object.Object{
+			Key:         object.GenerateEncryptionKey(),
+			PartialSlab: &object.PartialSlab{MinShards: 1, TotalShards: 2, Data: tails[key]},
+		}
+		if err := db.UpdateObject(ctx, key, obj, usedContracts, nil, false, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if obj, err := db.Object(ctx, "bar"); err != nil {
+		t.Fatal(err)
+	} else if obj.PartialSlab == nil || !bytes.Equal(obj.PartialSlab.Data, tails["bar"]) || obj.Size() != int64(len(tails["bar"])) {
+		t.Fatal("unexpected partial slab")
+	}
+
+	// nothing to pack for a different redundancy
+	if packed, err := db.PackedSlabsForUpload(ctx, time.Minute, 2, 4, 0); err != nil {
+		t.Fatal(err)
+	} else if len(packed) != 0 {
+		t.Fatal("unexpected packed slabs", len(packed))
+	}
+
+	// 'foo' and 'bar' are packed, 'baz' doesn't fit
+	packed, err := db.PackedSlabsForUpload(ctx, time.Minute, 1, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(packed) != 1 || len(packed[0].Partials) != 2 {
+		t.Fatal("unexpected packed slabs", packed)
+	} else if !bytes.Equal(packed[0].Data, append(append([]byte(nil), tails["foo"]...), tails["bar"]...)) {
+		t.Fatal("unexpected packed data")
+	}
+
+	// the partial slabs are locked
+	if again, err := db.PackedSlabsForUpload(ctx, time.Minute, 1, 2, 0); err != nil {
+		t.Fatal(err)
+	} else if len(again) != 0 {
+		t.Fatal("unexpected packed slabs", len(again))
+	}
+
+	// mark the slab as uploaded
+	slab := object.Slab{
+		Key:       object.GenerateEncryptionKey(),
+		MinShards: 1,
+		Shards:    []object.Sector{{Host: hks[0], Root: types.Hash256{1}}},
+	}
+	err = db.MarkPackedSlabsUploaded(ctx, []api.UploadedPackedSlab{{
+		Partials:      packed[0].Partials,
+		Slab:          slab,
+		UsedContracts: usedContracts,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// both objects reference the slab
+	for i, key := range []string{"foo", "bar"} {
+		obj, err := db.Object(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		} else if obj.PartialSlab != nil || len(obj.Slabs) != 1 {
+			t.Fatal("unexpected object", obj)
+		}
+		ss := obj.Slabs[0]
+		if ss.Key.String() != slab.Key.String() || ss.Offset != packed[0].Partials[i].Offset || ss.Length != uint32(len(tails[key])) {
+			t.Fatal("unexpected slice", ss)
+		}
+	}
+
+	// the slab is removed with the last object that references it
+	slabCount := func() (n int64) {
+		if err := db.db.Model(&dbSlab{}).Count(&n).Error; err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	if err := db.RemoveObject(ctx, "foo", ""); err != nil {
+		t.Fatal(err)
+	} else if n := slabCount(); n != 1 {
+		t.Fatal("unexpected number of slabs", n)
+	}
+	if err := db.RemoveObject(ctx, "bar", ""); err != nil {
+		t.Fatal(err)
+	} else if n := slabCount(); n != 0 {
+		t.Fatal("unexpected number of slabs", n)
+	}
+}
@@ -0,0 +1,163 @@
+package stores
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.sia.tech/renterd/api"
+	"gorm.io/gorm"
+)
+
+const (
+	// queryStatsStartKey is the key under which the start time of a query is
+	// stored in the statement's instance.
+	queryStatsStartKey = "querystats:start"
+
+	// maxQueryFamilyLen is the maximum length of the family of a raw query.
+	maxQueryFamilyLen = 100
+)
+
+// queryStatsBuckets are the upper bounds of the buckets of the query duration
+// histogram, the last bucket contains all queries exceeding the last bound.
+var queryStatsBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// queryStats is a gorm plugin that keeps track of the number and duration of
+// queries per query family. A family groups queries by operation and table,
+// or by their SQL for raw queries.
+type queryStats struct {
+	mu       sync.Mutex
+	families map[string]*api.QueryStats
+}
+
+func newQueryStats() *queryStats {
+	return &queryStats{families: make(map[string]*api.QueryStats)}
+}
+
+// Name implements gorm.Plugin.
+func (qs *queryStats) Name() string {
+	return "renterd:querystats"
+}
+
+// Initialize implements gorm.Plugin.
+func (qs *queryStats) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("querystats:before_create", qs.before),
+		cb.Create().After("gorm:create").Register("querystats:after_create", qs.after("create")),
+		cb.Query().Before("gorm:query").Register("querystats:before_query", qs.before),
+		cb.Query().After("gorm:query").Register("querystats:after_query", qs.after("query")),
+		cb.Update().Before("gorm:update").Register("querystats:before_update", qs.before),
+		cb.Update().After("gorm:update").Register("querystats:after_update", qs.after("update")),
+		cb.Delete().Before("gorm:delete").Register("querystats:before_delete", qs.before),
+		cb.Delete().After("gorm:delete").Register("querystats:after_delete", qs.after("delete")),
+		cb.Row().Before("gorm:row").Register("querystats:before_row", qs.before),
+		cb.Row().After("gorm:row").Register("querystats:after_row", qs.after("row")),
+		cb.Raw().Before("gorm:raw").Register("querystats:before_raw", qs.before),
+		cb.Raw().After("gorm:raw").Register("querystats:after_raw", qs.after("raw")),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (qs *queryStats) before(db *gorm.DB) {
+	db.InstanceSet(queryStatsStartKey, time.Now())
+}
+
+func (qs *queryStats) after(op string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		v, ok := db.InstanceGet(queryStatsStartKey)
+		if !ok {
+			return
+		}
+		start, ok := v.(time.Time)
+		if !ok {
+			return
+		}
+		failed := db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound)
+		qs.record(queryFamily(op, db.Statement), time.Since(start), failed)
+	}
+}
+
+func (qs *queryStats) record(family string, d time.Duration, failed bool) {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+
+	stats, ok := qs.families[family]
+	if !ok {
+		stats = &api.QueryStats{
+			Family:    family,
+			Histogram: make([]api.QueryStatsBucket, len(queryStatsBuckets)+1),
+		}
+		for i, bound := range queryStatsBuckets {
+			stats.Histogram[i].UpperBound = bound
+		}
+		qs.families[family] = stats
+	}
+
+	stats.Count++
+	if failed {
+		stats.Errors++
+	}
+	stats.Total += d
+	if d > stats.Max {
+		stats.Max = d
+	}
+	i := sort.Search(len(queryStatsBuckets), func(i int) bool { return d <= queryStatsBuckets[i] })
+	stats.Histogram[i].Count++
+}
+
+// stats returns the stats of all query families, sorted by the total time
+// spent on them.
+func (qs *queryStats) stats() []api.QueryStats {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+
+	stats := make([]api.QueryStats, 0, len(qs.families))
+	for _, s := range qs.families {
+		cpy := *s
+		cpy.Histogram = append([]api.QueryStatsBucket(nil), s.Histogram...)
+		stats = append(stats, cpy)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Total == stats[j].Total {
+			return stats[i].Family < stats[j].Family
+		}
+		return stats[i].Total > stats[j].Total
+	})
+	return stats
+}
+
+// queryFamily returns the family of a query. Queries built by gorm are grouped
+// by operation and table, raw queries are grouped by their SQL, which
+// contains placeholders instead of the actual values.
+func queryFamily(op string, stmt *gorm.Statement) string {
+	if stmt.Table != "" {
+		return op + " " + stmt.Table
+	}
+	family := op + " " + strings.Join(strings.Fields(stmt.SQL.String()), " ")
+	if len(family) > maxQueryFamilyLen {
+		family = family[:maxQueryFamilyLen]
+	}
+	return family
+}
+
+// QueryStats returns statistics about the queries executed by the store,
+// grouped by query family.
+func (s *SQLStore) QueryStats() []api.QueryStats {
+	return s.queryStats.stats()
+}
@@ -0,0 +1,160 @@
+package stores
+
+import (
+	"context"
+	"fmt"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	// dbRecoveredSector is a sector that was found in a recovered contract.
+	// Recovered sectors aren't referenced by any slab since the slabs can't
+	// be recovered from the hosts, they are kept separate from the sectors
+	// table to make sure the garbage collector doesn't prune them and are
+	// included in the contract's roots to make sure they aren't pruned from
+	// the contract.
+	dbRecoveredSector struct {
+		ID           uint       `gorm:"primarykey"`
+		DBContractID uint       `gorm:"uniqueIndex:idx_recovered_sectors_contract_root;NOT NULL"`
+		DBContract   dbContract `gorm:"constraint:OnDelete:CASCADE"` // CASCADE to drop the sectors with the contract
+		Root         []byte     `gorm:"uniqueIndex:idx_recovered_sectors_contract_root;NOT NULL;size:32"`
+	}
+)
+
+// TableName implements the gorm.Tabler interface.
+func (dbRecoveredSector) TableName() string { return "recovered_sectors" }
+
+// RecoverContract adds a contract that was recovered from its host to the
+// store, together with its host and the roots of the sectors stored in it. The
+// host's net address, the contract's total cost and start height are taken
+// from c since the revision doesn't contain them.
+func (s *SQLStore) RecoverContract(ctx context.Context, c api.ContractMetadata, rev rhpv2.ContractRevision, roots []types.Hash256) (api.ContractMetadata, error) {
+	return s.recoverContract(ctx, c, rev, roots, false)
+}
+
+// RescanContract adds a contract that was found on the blockchain to the
+// store. The roots of its sectors are unknown, so the contract isn't pruned
+// until they are restored with RestoreContractRoots.
+func (s *SQLStore) RescanContract(ctx context.Context, c api.ContractMetadata, rev rhpv2.ContractRevision) (api.ContractMetadata, error) {
+	return s.recoverContract(ctx, c, rev, nil, true)
+}
+
+// RestoreContractRoots restores the roots of a contract that was found on the
+// blockchain, after which the sectors the host stores for it that aren't in
+// roots can be pruned again.
+func (s *SQLStore) RestoreContractRoots(ctx context.Context, id types.FileContractID, roots []types.Hash256) error {
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		tx = tx.WithContext(ctx)
+
+		c, err := contract(tx, fileContractID(id))
+		if err != nil {
+			return err
+		} else if !c.RootsUnknown {
+			return fmt.Errorf("roots of contract %v are already known", id)
+		}
+		if err := addRecoveredSectors(tx, c.ID, roots); err != nil {
+			return err
+		}
+		return tx.Model(&c).Update("roots_unknown", false).Error
+	})
+}
+
+func (s *SQLStore) recoverContract(ctx context.Context, c api.ContractMetadata, rev rhpv2.ContractRevision, roots []types.Hash256, rootsUnknown bool) (_ api.ContractMetadata, err error) {
+	fcid := rev.ID()
+	if fcid != c.ID {
+		return api.ContractMetadata{}, fmt.Errorf("revision of contract %v doesn't match contract %v", fcid, c.ID)
+	}
+
+	var recovered dbContract
+	err = s.retryTransaction(func(tx *gorm.DB) error {
+		tx = tx.WithContext(ctx)
+
+		// make sure the contract doesn't exist yet
+		var n int64
+		if err := tx.Model(&dbContract{}).Where("fcid", fileContractID(fcid)).Count(&n).Error; err != nil {
+			return err
+		} else if n > 0 {
+			return fmt.Errorf("%w: %v", api.ErrContractExists, fcid)
+		}
+
+		// make sure the host exists, the fresh store might not know it yet
+		var host dbHost
+		if err := tx.
+			Where(&dbHost{PublicKey: publicKey(rev.HostKey())}).
+			Attrs(dbHost{NetAddress: c.HostIP}).
+			FirstOrCreate(&host).
+			Error; err != nil {
+			return err
+		}
+
+		// add the contract
+		added, err := addContract(tx, rev, c.TotalCost, c.StartHeight, types.FileContractID{})
+		if err != nil {
+			return err
+		}
+		if err := tx.
+			Model(&added).
+			Updates(map[string]interface{}{
+				"revision_number": fmt.Sprint(rev.Revision.RevisionNumber),
+				"roots_unknown":   rootsUnknown,
+			}).
+			Error; err != nil {
+			return err
+		}
+		if err := addRecoveredSectors(tx, added.ID, roots); err != nil {
+			return err
+		}
+
+		recovered, err = contract(tx, fileContractID(fcid))
+		return err
+	})
+	if err != nil {
+		return api.ContractMetadata{}, err
+	}
+	s.knownContracts[fcid] = struct{}{}
+	return recovered.convert(), nil
+}
+
+// addRecoveredSectors adds the given roots to the recovered sectors of the
+// contract with the given id, a host might store the same sector more than
+// once.
+func addRecoveredSectors(tx *gorm.DB, contractID uint, roots []types.Hash256) error {
+	if len(roots) == 0 {
+		return nil
+	}
+	sectors := make([]dbRecoveredSector, len(roots))
+	for i := range roots {
+		sectors[i] = dbRecoveredSector{
+			DBContractID: contractID,
+			Root:         roots[i][:],
+		}
+	}
+	return tx.
+		Clauses(clause.OnConflict{DoNothing: true}).
+		CreateInBatches(&sectors, 100).
+		Error
+}
+
+// recoveredRoots returns the roots of the sectors recovered for the contract
+// with the given id.
+func recoveredRoots(tx *gorm.DB, contractID uint) ([]types.Hash256, error) {
+	var rows [][]byte
+	if err := tx.
+		Model(&dbRecoveredSector{}).
+		Where("db_contract_id", contractID).
+		Order("id ASC").
+		Pluck("root", &rows).
+		Error; err != nil {
+		return nil, err
+	}
+	roots := make([]types.Hash256, len(rows))
+	for i, root := range rows {
+		copy(roots[i][:], root)
+	}
+	return roots, nil
+}
@@ -0,0 +1,143 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+// TestRecoverContract verifies recovered contracts are added together with
+// their host and that their roots are kept when the contract is pruned or
+// renewed.
+func TestRecoverContract(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// recover a contract with a host the store doesn't know about, the host
+	// stores one of the sectors twice
+	hk := types.PublicKey{1}
+	fcid := types.FileContractID{1}
+	rev := testContractRevision(fcid, hk)
+	c := api.ContractMetadata{
+		ID:          fcid,
+		HostIP:      "host.com:9982",
+		StartHeight: 100,
+		TotalCost:   types.Siacoins(1),
+	}
+	roots := []types.Hash256{{1}, {2}, {2}, {3}}
+	recovered, err := db.RecoverContract(ctx, c, rev, roots)
+	if err != nil {
+		t.Fatal(err)
+	} else if recovered.ID != fcid || recovered.HostKey != hk || recovered.HostIP != c.HostIP {
+		t.Fatal("unexpected contract", recovered)
+	} else if recovered.StartHeight != 100 || !recovered.TotalCost.Equals(c.TotalCost) || recovered.RevisionNumber != rev.Revision.RevisionNumber {
+		t.Fatal("unexpected contract", recovered)
+	}
+
+	// assert the host was added
+	if h, err := db.Host(ctx, hk); err != nil {
+		t.Fatal(err)
+	} else if h.NetAddress != c.HostIP {
+		t.Fatal("unexpected net address", h.NetAddress)
+	}
+
+	// assert the recovered roots are part of the contract's roots
+	expected := []types.Hash256{{1}, {2}, {3}}
+	if got, err := db.ContractRoots(ctx, fcid); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, expected) {
+		t.Fatal("unexpected roots", got)
+	}
+
+	// assert the garbage collector doesn't prune them
+	if _, err := db.CollectGarbage(ctx); err != nil {
+		t.Fatal(err)
+	} else if got, err := db.ContractRoots(ctx, fcid); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, expected) {
+		t.Fatal("unexpected roots", got)
+	}
+
+	// recovering the contract again should fail
+	if _, err := db.RecoverContract(ctx, c, rev, roots); !errors.Is(err, api.ErrContractExists) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// recovering a contract with a revision of another contract should fail
+	if _, err := db.RecoverContract(ctx, api.ContractMetadata{ID: types.FileContractID{2}}, rev, roots); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// renew the contract and assert the roots are moved to the renewal
+	renewal := types.FileContractID{2}
+	if _, err := db.addTestRenewedContract(renewal, fcid, hk, 200); err != nil {
+		t.Fatal(err)
+	} else if got, err := db.ContractRoots(ctx, renewal); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, expected) {
+		t.Fatal("unexpected roots", got)
+	}
+}
+
+// TestRescanContract verifies the roots of rescanned contracts are unknown
+// until they are restored and that renewals keep them unknown.
+func TestRescanContract(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// add a contract that was found on the blockchain
+	hk := types.PublicKey{1}
+	fcid := types.FileContractID{1}
+	rev := testContractRevision(fcid, hk)
+	if _, err := db.RescanContract(ctx, api.ContractMetadata{ID: fcid, StartHeight: 100}, rev); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert its roots are unknown
+	if _, err := db.ContractRoots(ctx, fcid); !errors.Is(err, api.ErrContractRootsUnknown) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// renew the contract and assert the renewal's roots are unknown as well
+	renewal := types.FileContractID{2}
+	if _, err := db.addTestRenewedContract(renewal, fcid, hk, 200); err != nil {
+		t.Fatal(err)
+	} else if _, err := db.ContractRoots(ctx, renewal); !errors.Is(err, api.ErrContractRootsUnknown) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// restore the roots
+	roots := []types.Hash256{{1}, {2}, {2}}
+	if err := db.RestoreContractRoots(ctx, renewal, roots); err != nil {
+		t.Fatal(err)
+	} else if got, err := db.ContractRoots(ctx, renewal); err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(got, []types.Hash256{{1}, {2}}) {
+		t.Fatal("unexpected roots", got)
+	}
+
+	// restoring them again should fail
+	if err := db.RestoreContractRoots(ctx, renewal, roots); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// recovered contracts have known roots
+	fcid = types.FileContractID{3}
+	if _, err := db.RecoverContract(ctx, api.ContractMetadata{ID: fcid}, testContractRevision(fcid, hk), nil); err != nil {
+		t.Fatal(err)
+	} else if got, err := db.ContractRoots(ctx, fcid); err != nil {
+		t.Fatal(err)
+	} else if len(got) != 0 {
+		t.Fatal("unexpected roots", got)
+	}
+}
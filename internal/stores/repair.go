@@ -0,0 +1,354 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.sia.tech/renterd/api"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// repairBackoffBase and repairBackoffMax bound the exponential backoff
+	// after a failed repair.
+	repairBackoffBase = time.Minute
+	repairBackoffMax  = 24 * time.Hour
+)
+
+type (
+	// dbRepair is an entry in the repair queue.
+	dbRepair struct {
+		Model
+
+		DBSlabID uint   `gorm:"unique;NOT NULL"`
+		DBSlab   dbSlab `gorm:"constraint:OnDelete:CASCADE"` // CASCADE to drop the entry with the slab
+
+		Health      float64
+		Priority    float64   `gorm:"index;NOT NULL"`
+		Attempts    uint64    `gorm:"NOT NULL;default:0"`
+		NextAttempt time.Time `gorm:"index;NOT NULL"`
+		LastError   string
+	}
+
+	// dbSlabMigration is the state of the latest migration of a slab, it's
+	// kept after the slab was migrated successfully.
+	dbSlabMigration struct {
+		Model
+
+		DBSlabID uint   `gorm:"unique;NOT NULL"`
+		DBSlab   dbSlab `gorm:"constraint:OnDelete:CASCADE"` // CASCADE to drop the state with the slab
+
+		Status    string `gorm:"index;NOT NULL"`
+		Error     string
+		Attempts  uint64    `gorm:"NOT NULL;default:0"`
+		UpdatedAt time.Time `gorm:"index"`
+	}
+)
+
+// TableName implements the gorm.Tabler interface.
+func (dbRepair) TableName() string { return "repairs" }
+
+// TableName implements the gorm.Tabler interface.
+func (dbSlabMigration) TableName() string { return "slab_migrations" }
+
+// repairPriority returns the priority of repairing a slab with the given
+// health that belongs to an object with the given importance.
+func repairPriority(health float64, importance uint8) float64 {
+	return (1 - health) * float64(importance)
+}
+
+// repairBackoff returns the time to wait before retrying a repair that failed
+// the given number of times.
+func repairBackoff(attempts uint64) time.Duration {
+	if attempts > 20 {
+		return repairBackoffMax
+	}
+	backoff := repairBackoffBase << (attempts - 1)
+	if backoff > repairBackoffMax {
+		return repairBackoffMax
+	}
+	return backoff
+}
+
+// EnqueueSlabsForRepair adds all slabs with a health at or below the cutoff
+// with regard to the given contract set to the repair queue. The priority of
+// slabs that are already queued is updated, their backoff is kept. Queued slabs
+// that are no longer below the cutoff are dropped from the queue. Slabs with
+// wrapped keys are never queued, like in UnhealthySlabs.
+func (s *SQLStore) EnqueueSlabsForRepair(ctx context.Context, set string, healthCutoff float64) (int, error) {
+	return enqueueSlabsForRepair(s.db.WithContext(ctx), set, healthCutoff, nil)
+}
+
+// enqueueSlabsForRepair adds the slabs with a health at or below the cutoff
+// to the repair queue and drops the queued ones above it, only the slabs with
+// the given ids are considered if ids is not nil.
+func enqueueSlabsForRepair(tx *gorm.DB, set string, healthCutoff float64, ids []uint) (int, error) {
+	var rows []struct {
+		ID         uint
+		Health     float64
+		Importance uint8
+	}
+	query := tx.
+		Select("slabs.id, MAX(o.importance) AS importance, "+sqlSlabHealth).
+		Model(&dbSlab{}).
+		Joins("INNER JOIN slices sli ON sli.db_slab_id = slabs.id").
+		Joins("INNER JOIN objects o ON o.id = sli.db_object_id").
+		Joins("INNER JOIN shards sh ON sh.db_slab_id = slabs.id").
+		Joins("LEFT JOIN contract_sectors se ON se.db_sector_id = sh.db_sector_id").
+		Joins(`LEFT JOIN (
+			SELECT contracts.id, contracts.host_id FROM contracts
+			INNER JOIN contract_set_contracts csc ON csc.db_contract_id = contracts.id
+			INNER JOIN contract_sets cs ON cs.id = csc.db_contract_set_id
+			WHERE cs.name = ?
+		) c ON se.db_contract_id = c.id`, set).
+		Where("slabs.key_wrapped = ?", false)
+	if ids != nil {
+		query = query.Where("slabs.id IN ?", ids)
+	}
+	err := query.
+		Group("slabs.id").
+		Having("health <= ?", healthCutoff).
+		Find(&rows).
+		Error
+	if err != nil {
+		return 0, err
+	}
+
+	// drop the queued slabs that no longer need to be repaired
+	unhealthy := make(map[uint]struct{}, len(rows))
+	for _, row := range rows {
+		unhealthy[row.ID] = struct{}{}
+	}
+	queued := tx.Model(&dbRepair{})
+	if ids != nil {
+		queued = queued.Where("db_slab_id IN ?", ids)
+	}
+	var queuedIDs, staleIDs []uint
+	if err := queued.Pluck("db_slab_id", &queuedIDs).Error; err != nil {
+		return 0, err
+	}
+	for _, id := range queuedIDs {
+		if _, ok := unhealthy[id]; !ok {
+			staleIDs = append(staleIDs, id)
+		}
+	}
+	for len(staleIDs) > 0 {
+		batch := staleIDs
+		if len(batch) > slabRetrievalBatchSize {
+			batch = batch[:slabRetrievalBatchSize]
+		}
+		staleIDs = staleIDs[len(batch):]
+		if err := tx.Where("db_slab_id IN ?", batch).Delete(&dbRepair{}).Error; err != nil {
+			return 0, err
+		}
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	repairs := make([]dbRepair, len(rows))
+	for i, row := range rows {
+		repairs[i] = dbRepair{
+			DBSlabID:    row.ID,
+			Health:      row.Health,
+			Priority:    repairPriority(row.Health, row.Importance),
+			NextAttempt: time.Now().UTC(),
+		}
+	}
+	err = tx.
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "db_slab_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"health", "priority"}),
+		}).
+		CreateInBatches(&repairs, slabRetrievalBatchSize).
+		Error
+	return len(repairs), err
+}
+
+// RepairQueue returns up to limit slabs from the repair queue that are due
+// for repair, highest priority first. Slabs with the same priority are ordered
+// by ID.
+func (s *SQLStore) RepairQueue(ctx context.Context, limit int) ([]api.RepairQueueEntry, error) {
+	if limit == 0 {
+		limit = -1
+	}
+
+	var repairs []dbRepair
+	err := s.db.
+		WithContext(ctx).
+		Where("next_attempt <= ?", time.Now().UTC()).
+		Order("priority DESC").
+		Order("db_slab_id ASC").
+		Limit(limit).
+		Preload("DBSlab.Shards.DBSector").
+		Find(&repairs).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]api.RepairQueueEntry, len(repairs))
+	for i, r := range repairs {
+		slab, err := r.DBSlab.convert(s.keyCipher)
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = api.RepairQueueEntry{
+			SlabID:      api.SlabID(r.DBSlabID),
+			Slab:        slab,
+			Health:      r.Health,
+			Priority:    r.Priority,
+			Attempts:    r.Attempts,
+			NextAttempt: r.NextAttempt.UTC(),
+			LastError:   r.LastError,
+		}
+	}
+	return entries, nil
+}
+
+// RecordRepairResults removes successfully repaired slabs from the repair
+// queue and backs off the slabs whose repair failed. Only the last result of a
+// slab is recorded if it's reported more than once.
+func (s *SQLStore) RecordRepairResults(ctx context.Context, results []api.RepairResult) error {
+	latest := make(map[api.SlabID]int, len(results))
+	for i, res := range results {
+		latest[res.SlabID] = i
+	}
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		for i, res := range results {
+			if latest[res.SlabID] != i {
+				continue // superseded by a later result
+			}
+			if res.Error == "" {
+				if err := tx.Where("db_slab_id", uint(res.SlabID)).Delete(&dbRepair{}).Error; err != nil {
+					return err
+				}
+				continue
+			}
+
+			var r dbRepair
+			if err := tx.Where("db_slab_id", uint(res.SlabID)).Take(&r).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+				continue // slab was deleted
+			} else if err != nil {
+				return err
+			}
+			err := tx.Model(&r).Updates(map[string]interface{}{
+				"attempts":     r.Attempts + 1,
+				"next_attempt": time.Now().UTC().Add(repairBackoff(r.Attempts + 1)),
+				"last_error":   res.Error,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateSlabMigrations records the migration state of the given slabs. The
+// number of attempts is incremented every time a migration starts. Updates for
+// slabs that no longer exist are ignored.
+func (s *SQLStore) UpdateSlabMigrations(ctx context.Context, updates []api.SlabMigrationUpdate) error {
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		for _, u := range updates {
+			var count int64
+			if err := tx.Model(&dbSlab{}).Where("id", uint(u.SlabID)).Count(&count).Error; err != nil {
+				return err
+			} else if count == 0 {
+				continue // slab was deleted
+			}
+
+			var m dbSlabMigration
+			err := tx.Where("db_slab_id", uint(u.SlabID)).Take(&m).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				m = dbSlabMigration{DBSlabID: uint(u.SlabID)}
+			} else if err != nil {
+				return err
+			}
+			m.Status = u.Status
+			m.Error = u.Error
+			if u.Status == api.SlabMigrationStatusInProgress {
+				m.Attempts++
+			}
+			if err := tx.Save(&m).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SlabMigrations returns the migration state of the slabs, most recently
+// updated first. Only the slabs with the given status are returned if status
+// is not empty.
+func (s *SQLStore) SlabMigrations(ctx context.Context, status string, offset, limit int) ([]api.SlabMigration, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+
+	query := s.db.WithContext(ctx)
+	if status != "" {
+		query = query.Where("status", status)
+	}
+	var migrations []dbSlabMigration
+	err := query.
+		Order("updated_at DESC").
+		Order("id ASC").
+		Offset(offset).
+		Limit(limit).
+		Find(&migrations).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]api.SlabMigration, len(migrations))
+	for i, m := range migrations {
+		res[i] = api.SlabMigration{
+			SlabID:    api.SlabID(m.DBSlabID),
+			Status:    m.Status,
+			Error:     m.Error,
+			Attempts:  m.Attempts,
+			UpdatedAt: m.UpdatedAt.UTC(),
+		}
+	}
+	return res, nil
+}
+
+// RetrySlabMigration makes the slab with the given id due for repair right away,
+// dropping its backoff, and marks its migration as pending.
+func (s *SQLStore) RetrySlabMigration(ctx context.Context, id api.SlabID) error {
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		res := tx.Model(&dbRepair{}).
+			Where("db_slab_id", uint(id)).
+			Update("next_attempt", time.Now().UTC())
+		if res.Error != nil {
+			return res.Error
+		} else if res.RowsAffected == 0 {
+			return api.ErrSlabNotQueued
+		}
+		return tx.Model(&dbSlabMigration{}).
+			Where("db_slab_id", uint(id)).
+			Updates(map[string]interface{}{
+				"status": api.SlabMigrationStatusPending,
+				"error":  "",
+			}).
+			Error
+	})
+}
+
+// UpdateObjectImportance sets the importance of an object, slabs of more
+// important objects are repaired first.
+func (s *SQLStore) UpdateObjectImportance(ctx context.Context, key string, importance uint8) error {
+	obj, err := s.object(ctx, key)
+	if err != nil {
+		return err
+	}
+	return s.db.
+		WithContext(ctx).
+		Model(&obj).
+		Update("importance", importance).
+		Error
+}
@@ -0,0 +1,254 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/object"
+)
+
+// TestRepairQueue tests enqueueing unhealthy slabs and draining the repair
+// queue.
+func TestRepairQueue(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// add 2 hosts with a contract each, only the first one is good
+	hks, err := db.addTestHosts(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcids, _, err := db.addTestContracts(hks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetContractSet(ctx, "autopilot", fcids[:1]); err != nil {
+		t.Fatal(err)
+	}
+	usedContracts := map[types.PublicKey]types.FileContractID{hks[0]: fcids[0], hks[1]: fcids[1]}
+
+	// add two objects with a slab that has a shard on the bad host
+	addObject := func(key string, root byte) {
+		t.Helper()
+		obj := object.Object{
+			Key: object.GenerateEncryptionKey(),
+			Slabs: []object.SlabSlice{{
+				Slab: object.Slab{
+					Key:       object.GenerateEncryptionKey(),
+					MinShards: 1,
+					Shards: []object.Sector{
+						{Host: hks[0], Root: types.Hash256{root}},
+						{Host: hks[1], Root: types.Hash256{root + 1}},
+					},
+				},
+			}},
+		}
+		if err := db.UpdateObject(ctx, key, obj, usedContracts, nil, false, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	addObject("foo", 1)
+	addObject("bar", 3)
+
+	// make 'bar' more important and assert updating it keeps its importance
+	if err := db.UpdateObjectImportance(ctx, "bar", 5); err != nil {
+		t.Fatal(err)
+	} else if err := db.UpdateObjectImportance(ctx, "baz", 5); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatal("unexpected error", err)
+	}
+	addObject("bar", 3)
+
+	// enqueue the slabs, enqueueing them twice shouldn't add duplicates
+	for i := 0; i < 2; i++ {
+		if n, err := db.EnqueueSlabsForRepair(ctx, "autopilot", 0.99); err != nil {
+			t.Fatal(err)
+		} else if n != 2 {
+			t.Fatal("unexpected number of enqueued slabs", n)
+		}
+	}
+	queue, err := db.RepairQueue(ctx, -1)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(queue) != 2 {
+		t.Fatal("unexpected queue", queue)
+	} else if queue[0].Priority != 5 || queue[1].Priority != 1 || queue[0].Health != 0 {
+		t.Fatal("unexpected priorities", queue)
+	} else if queue[0].Slab.Shards[0].Root != (types.Hash256{3}) {
+		t.Fatal("slabs aren't ordered by priority")
+	}
+
+	// record a failure and a success, the failed slab should be backed off
+	if err := db.RecordRepairResults(ctx, []api.RepairResult{
+		{SlabID: queue[0].SlabID, Error: "failed"},
+		{SlabID: queue[1].SlabID},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if queue, err := db.RepairQueue(ctx, -1); err != nil {
+		t.Fatal(err)
+	} else if len(queue) != 0 {
+		t.Fatal("unexpected queue", queue)
+	}
+
+	// enqueueing again keeps the backoff of the failed slab
+	if _, err := db.EnqueueSlabsForRepair(ctx, "autopilot", 0.99); err != nil {
+		t.Fatal(err)
+	}
+	var repairs []dbRepair
+	if err := db.db.Order("priority DESC").Find(&repairs).Error; err != nil {
+		t.Fatal(err)
+	} else if len(repairs) != 2 || repairs[0].Attempts != 1 || repairs[0].LastError != "failed" || repairs[1].Attempts != 0 {
+		t.Fatal("unexpected repairs", repairs)
+	}
+
+	// record the migration state of both slabs, updates for unknown slabs are
+	// ignored
+	failed, migrated := queue[0].SlabID, queue[1].SlabID
+	for _, updates := range [][]api.SlabMigrationUpdate{
+		{{SlabID: failed, Status: api.SlabMigrationStatusPending}, {SlabID: migrated, Status: api.SlabMigrationStatusPending}, {SlabID: 100, Status: api.SlabMigrationStatusPending}},
+		{{SlabID: migrated, Status: api.SlabMigrationStatusInProgress}},
+		{{SlabID: migrated, Status: api.SlabMigrationStatusDone}},
+		{{SlabID: failed, Status: api.SlabMigrationStatusInProgress}},
+		{{SlabID: failed, Status: api.SlabMigrationStatusFailed, Error: "failed"}},
+	} {
+		if err := db.UpdateSlabMigrations(ctx, updates); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if migrations, err := db.SlabMigrations(ctx, "", 0, -1); err != nil {
+		t.Fatal(err)
+	} else if len(migrations) != 2 {
+		t.Fatal("unexpected migrations", migrations)
+	}
+	migrations, err := db.SlabMigrations(ctx, api.SlabMigrationStatusFailed, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(migrations) != 1 || migrations[0].SlabID != failed || migrations[0].Error != "failed" || migrations[0].Attempts != 1 || migrations[0].UpdatedAt.IsZero() {
+		t.Fatal("unexpected migrations", migrations)
+	}
+
+	// retry the failed migration, the slab is due for repair right away
+	// rather than being backed off
+	if err := db.RetrySlabMigration(ctx, failed); err != nil {
+		t.Fatal(err)
+	}
+	if queue, err := db.RepairQueue(ctx, -1); err != nil {
+		t.Fatal(err)
+	} else if len(queue) != 2 || queue[0].SlabID != failed {
+		t.Fatal("unexpected queue", queue)
+	}
+	if migrations, err := db.SlabMigrations(ctx, api.SlabMigrationStatusPending, 0, -1); err != nil {
+		t.Fatal(err)
+	} else if len(migrations) != 1 || migrations[0].SlabID != failed || migrations[0].Error != "" {
+		t.Fatal("unexpected migrations", migrations)
+	}
+	if err := db.RetrySlabMigration(ctx, 100); !errors.Is(err, api.ErrSlabNotQueued) {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+// TestRepairQueueInvalidation asserts that entries are dropped from the repair
+// queue once they are stale.
+func TestRepairQueueInvalidation(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// add 3 hosts with a contract each, only the first one is good
+	hks, err := db.addTestHosts(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcids, _, err := db.addTestContracts(hks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetContractSet(ctx, "autopilot", fcids[:1]); err != nil {
+		t.Fatal(err)
+	}
+	usedContracts := map[types.PublicKey]types.FileContractID{hks[0]: fcids[0], hks[1]: fcids[1], hks[2]: fcids[2]}
+
+	// add three objects with a slab that has a shard on a bad host
+	slabs := make(map[string]object.Slab)
+	for i, key := range []string{"foo", "bar", "baz"} {
+		slab := object.Slab{
+			Key:       object.GenerateEncryptionKey(),
+			MinShards: 1,
+			Shards: []object.Sector{
+				{Host: hks[0], Root: types.Hash256{byte(2 * i)}},
+				{Host: hks[1], Root: types.Hash256{byte(2*i + 1)}},
+			},
+		}
+		slabs[key] = slab
+		obj := object.Object{Key: object.GenerateEncryptionKey(), Slabs: []object.SlabSlice{{Slab: slab}}}
+		if err := db.UpdateObject(ctx, key, obj, usedContracts, nil, false, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n, err := db.EnqueueSlabsForRepair(ctx, "autopilot", 0.99); err != nil {
+		t.Fatal(err)
+	} else if n != 3 {
+		t.Fatal("unexpected number of enqueued slabs", n)
+	}
+
+	// reporting the same slab twice only records the last result
+	queue, err := db.RepairQueue(ctx, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RecordRepairResults(ctx, []api.RepairResult{
+		{SlabID: queue[0].SlabID, Error: "failed"},
+		{SlabID: queue[0].SlabID, Error: "failed again"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var r dbRepair
+	if err := db.db.Where("db_slab_id", uint(queue[0].SlabID)).Take(&r).Error; err != nil {
+		t.Fatal(err)
+	} else if r.Attempts != 1 || r.LastError != "failed again" {
+		t.Fatal("unexpected repair", r)
+	}
+
+	// removing an object drops its slab from the queue
+	if err := db.RemoveObject(ctx, "foo", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// updating a slab drops it from the queue
+	updated := slabs["bar"]
+	updated.Shards = []object.Sector{updated.Shards[0], {Host: hks[2], Root: types.Hash256{100}}}
+	if err := db.UpdateSlab(ctx, updated, usedContracts); err != nil {
+		t.Fatal(err)
+	}
+
+	assertQueued := func(n int) {
+		t.Helper()
+		var count int64
+		if err := db.db.Model(&dbRepair{}).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		} else if count != int64(n) {
+			t.Fatalf("expected %d queued slabs, got %d", n, count)
+		}
+	}
+	assertQueued(1)
+
+	// enqueueing the slabs again drops the ones that got healthy, because all
+	// contracts are in the set now
+	if err := db.SetContractSet(ctx, "autopilot", fcids); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := db.EnqueueSlabsForRepair(ctx, "autopilot", 0.99); err != nil {
+		t.Fatal(err)
+	} else if n != 0 {
+		t.Fatal("unexpected number of enqueued slabs", n)
+	}
+	assertQueued(0)
+}
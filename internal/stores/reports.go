@@ -0,0 +1,84 @@
+package stores
+
+import (
+	"context"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"gorm.io/gorm/clause"
+)
+
+type (
+	dbDailyReport struct {
+		Model
+
+		Date             time.Time `gorm:"uniqueIndex;NOT NULL"`
+		Spending         currency
+		Uploaded         uint64
+		Downloaded       uint64
+		ContractsFormed  uint64
+		ContractsRenewed uint64
+		HostsLost        uint64
+		Migrations       uint64
+	}
+)
+
+// TableName implements the gorm.Tabler interface.
+func (dbDailyReport) TableName() string { return "daily_reports" }
+
+// convert turns a dbDailyReport into an api.DailyReport.
+func (r dbDailyReport) convert() api.DailyReport {
+	return api.DailyReport{
+		Date:             r.Date.UTC(),
+		Spending:         types.Currency(r.Spending),
+		Uploaded:         r.Uploaded,
+		Downloaded:       r.Downloaded,
+		ContractsFormed:  r.ContractsFormed,
+		ContractsRenewed: r.ContractsRenewed,
+		HostsLost:        r.HostsLost,
+		Migrations:       r.Migrations,
+	}
+}
+
+// DailyReports implements the bus.ReportStore interface.
+func (s *SQLStore) DailyReports(ctx context.Context, since time.Time, limit int) ([]api.DailyReport, error) {
+	if limit == 0 {
+		limit = -1
+	}
+
+	var reports []dbDailyReport
+	err := s.db.
+		Where("date >= ?", since.UTC()).
+		Order("date DESC").
+		Limit(limit).
+		Find(&reports).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]api.DailyReport, len(reports))
+	for i, r := range reports {
+		out[i] = r.convert()
+	}
+	return out, nil
+}
+
+// UpdateDailyReport implements the bus.ReportStore interface. It overwrites
+// the report of the same date if it exists.
+func (s *SQLStore) UpdateDailyReport(ctx context.Context, r api.DailyReport) error {
+	return s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"spending", "uploaded", "downloaded", "contracts_formed", "contracts_renewed", "hosts_lost", "migrations"}),
+	}).Create(&dbDailyReport{
+		Date:             r.Date.UTC(),
+		Spending:         currency(r.Spending),
+		Uploaded:         r.Uploaded,
+		Downloaded:       r.Downloaded,
+		ContractsFormed:  r.ContractsFormed,
+		ContractsRenewed: r.ContractsRenewed,
+		HostsLost:        r.HostsLost,
+		Migrations:       r.Migrations,
+	}).Error
+}
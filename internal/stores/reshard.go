@@ -0,0 +1,66 @@
+package stores
+
+import (
+	"context"
+
+	"go.sia.tech/renterd/api"
+)
+
+// sqlReshardCondition matches objects with at least one slab that isn't
+// erasure coded with the redundancy passed as arguments. Objects that override
+// the redundancy settings or are protected by a passphrase are never
+// resharded, neither are objects without an ETag since the worker couldn't
+// tell whether they were overwritten while they were resharded.
+const sqlReshardCondition = `objects.min_shards = 0 AND objects.key_wrap IS NULL AND objects.e_tag <> '' AND EXISTS (
+	SELECT 1 FROM slices sli
+	INNER JOIN slabs sla ON sla.id = sli.db_slab_id
+	WHERE sli.db_object_id = objects.id AND (sla.min_shards <> ? OR sla.total_shards <> ?)
+)`
+
+// ObjectsForReshard returns the keys of up to limit objects that have slabs
+// with a redundancy other than the given one.
+func (s *SQLStore) ObjectsForReshard(ctx context.Context, minShards, totalShards uint8, limit int) ([]string, error) {
+	if limit == 0 {
+		limit = -1
+	}
+
+	var keys []string
+	err := s.db.
+		WithContext(ctx).
+		Model(&dbObject{}).
+		Where(sqlReshardCondition, minShards, totalShards).
+		Order("id ASC").
+		Limit(limit).
+		Pluck("object_id", &keys).
+		Error
+	return keys, err
+}
+
+// ReshardProgress returns how many objects still need to be converted to
+// the given redundancy.
+func (s *SQLStore) ReshardProgress(ctx context.Context, minShards, totalShards uint8) (api.ReshardProgress, error) {
+	progress := api.ReshardProgress{
+		MinShards:   int(minShards),
+		TotalShards: int(totalShards),
+	}
+	var objects, remaining int64
+	if err := s.db.
+		WithContext(ctx).
+		Model(&dbObject{}).
+		Where("min_shards = 0").
+		Count(&objects).
+		Error; err != nil {
+		return api.ReshardProgress{}, err
+	}
+	if err := s.db.
+		WithContext(ctx).
+		Model(&dbObject{}).
+		Where(sqlReshardCondition, minShards, totalShards).
+		Count(&remaining).
+		Error; err != nil {
+		return api.ReshardProgress{}, err
+	}
+	progress.Objects = uint64(objects)
+	progress.Remaining = uint64(remaining)
+	return progress, nil
+}
@@ -0,0 +1,75 @@
+package stores
+
+import (
+	"context"
+	"testing"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/object"
+)
+
+// TestObjectsForReshard verifies objects with slabs of a different
+// redundancy are returned for resharding.
+func TestObjectsForReshard(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	hks, err := db.addTestHosts(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcids, _, err := db.addTestContracts(hks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usedContracts := map[types.PublicKey]types.FileContractID{hks[0]: fcids[0], hks[1]: fcids[1]}
+
+	// 'foo' is stored with 1-of-2, 'bar' has a 1-of-1 and a 1-of-2 slab
+	for key, slabs := range map[string][]object.Slab{
+		"foo": {{Key: object.GenerateEncryptionKey(), MinShards: 1, Shards: []object.Sector{{Host: hks[0], Root: types.Hash256{1}}, {Host: hks[1], Root: types.Hash256{2}}}}},
+		"bar": {
+			{Key: object.GenerateEncryptionKey(), MinShards: 1, Shards: []object.Sector{{Host: hks[0], Root: types.Hash256{3}}}},
+			{Key: object.GenerateEncryptionKey(), MinShards: 1, Shards: []object.Sector{{Host: hks[0], Root: types.Hash256{4}}, {Host: hks[1], Root: types.Hash256{5}}}},
+		},
+	} {
+		obj := object.Object{Key: object.GenerateEncryptionKey(), ETag: key}
+		for _, slab := range slabs {
+			obj.Slabs = append(obj.Slabs, object.SlabSlice{Slab: slab, Length: 1})
+		}
+		if err := db.UpdateObject(ctx, key, obj, usedContracts, nil, false, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 'baz' overrides the redundancy and is never resharded
+	baz := object.Object{Key: object.GenerateEncryptionKey(), Slabs: []object.SlabSlice{{Slab: object.Slab{Key: object.GenerateEncryptionKey(), MinShards: 1, Shards: []object.Sector{{Host: hks[0], Root: types.Hash256{6}}}}, Length: 1}}}
+	if err := db.UpdateObject(ctx, "baz", baz, usedContracts, &api.RedundancySettings{MinShards: 1, TotalShards: 1}, false, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// 'qux' has no ETag and is never resharded either
+	qux := object.Object{Key: object.GenerateEncryptionKey(), Slabs: []object.SlabSlice{{Slab: object.Slab{Key: object.GenerateEncryptionKey(), MinShards: 1, Shards: []object.Sector{{Host: hks[0], Root: types.Hash256{7}}}}, Length: 1}}}
+	if err := db.UpdateObject(ctx, "qux", qux, usedContracts, nil, false, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys, err := db.ObjectsForReshard(ctx, 1, 2, 0); err != nil {
+		t.Fatal(err)
+	} else if len(keys) != 1 || keys[0] != "bar" {
+		t.Fatal("unexpected objects", keys)
+	}
+	if keys, err := db.ObjectsForReshard(ctx, 2, 4, 0); err != nil {
+		t.Fatal(err)
+	} else if len(keys) != 2 {
+		t.Fatal("unexpected objects", keys)
+	}
+	if progress, err := db.ReshardProgress(ctx, 1, 2); err != nil {
+		t.Fatal(err)
+	} else if progress.Objects != 3 || progress.Remaining != 1 {
+		t.Fatal("unexpected progress", progress)
+	}
+}
@@ -0,0 +1,81 @@
+package stores
+
+import (
+	"context"
+
+	"go.sia.tech/renterd/api"
+	"gorm.io/gorm/clause"
+)
+
+// dbScheduledEvent is an event the bus broadcasts once the chain reaches its
+// height.
+type dbScheduledEvent struct {
+	Model
+
+	Key    string `gorm:"unique;index;NOT NULL"`
+	Height uint64 `gorm:"index;NOT NULL"`
+	Type   string `gorm:"NOT NULL"`
+	Data   []byte
+}
+
+// TableName implements the gorm.Tabler interface.
+func (dbScheduledEvent) TableName() string { return "scheduled_events" }
+
+func (e dbScheduledEvent) convert() api.ScheduledEvent {
+	return api.ScheduledEvent{
+		Key:    e.Key,
+		Height: e.Height,
+		Type:   e.Type,
+		Data:   e.Data,
+	}
+}
+
+// ScheduledEvents implements the bus.SchedulerStore interface.
+func (s *SQLStore) ScheduledEvents(ctx context.Context) ([]api.ScheduledEvent, error) {
+	var events []dbScheduledEvent
+	if err := s.db.WithContext(ctx).Order("height ASC, `key` ASC").Find(&events).Error; err != nil {
+		return nil, err
+	}
+	res := make([]api.ScheduledEvent, len(events))
+	for i, e := range events {
+		res[i] = e.convert()
+	}
+	return res, nil
+}
+
+// ScheduleEvents implements the bus.SchedulerStore interface, events replace
+// the events scheduled under the same key.
+func (s *SQLStore) ScheduleEvents(ctx context.Context, events []api.ScheduledEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	dbEvents := make([]dbScheduledEvent, len(events))
+	for i, e := range events {
+		dbEvents[i] = dbScheduledEvent{
+			Key:    e.Key,
+			Height: e.Height,
+			Type:   e.Type,
+			Data:   e.Data,
+		}
+	}
+	return s.db.
+		WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "key"}},
+			DoUpdates: clause.AssignmentColumns([]string{"height", "type", "data"}),
+		}).
+		CreateInBatches(&dbEvents, 100).
+		Error
+}
+
+// RemoveScheduledEvents implements the bus.SchedulerStore interface.
+func (s *SQLStore) RemoveScheduledEvents(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	return s.db.
+		WithContext(ctx).
+		Where("`key` IN ?", keys).
+		Delete(&dbScheduledEvent{}).
+		Error
+}
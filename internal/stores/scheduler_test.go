@@ -0,0 +1,52 @@
+package stores
+
+import (
+	"context"
+	"testing"
+
+	"go.sia.tech/renterd/api"
+)
+
+// TestScheduledEvents tests scheduling, replacing and removing events.
+func TestScheduledEvents(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// schedule some events
+	err = db.ScheduleEvents(ctx, []api.ScheduledEvent{
+		{Key: "b", Height: 2, Type: "foo", Data: []byte(`{"b":1}`)},
+		{Key: "a", Height: 2, Type: "foo"},
+		{Key: "c", Height: 1, Type: "bar"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events, err := db.ScheduledEvents(ctx); err != nil {
+		t.Fatal(err)
+	} else if len(events) != 3 || events[0].Key != "c" || events[1].Key != "a" || events[2].Key != "b" {
+		t.Fatal("unexpected events", events)
+	} else if string(events[2].Data) != `{"b":1}` {
+		t.Fatal("unexpected data", string(events[2].Data))
+	}
+
+	// replace an event
+	if err := db.ScheduleEvents(ctx, []api.ScheduledEvent{{Key: "c", Height: 3, Type: "baz"}}); err != nil {
+		t.Fatal(err)
+	} else if events, err := db.ScheduledEvents(ctx); err != nil {
+		t.Fatal(err)
+	} else if len(events) != 3 || events[2].Key != "c" || events[2].Height != 3 || events[2].Type != "baz" {
+		t.Fatal("unexpected events", events)
+	}
+
+	// remove events
+	if err := db.RemoveScheduledEvents(ctx, []string{"a", "c", "d"}); err != nil {
+		t.Fatal(err)
+	} else if events, err := db.ScheduledEvents(ctx); err != nil {
+		t.Fatal(err)
+	} else if len(events) != 1 || events[0].Key != "b" {
+		t.Fatal("unexpected events", events)
+	}
+}
@@ -0,0 +1,383 @@
+package stores
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"gorm.io/gorm"
+	"lukechampine.com/frand"
+)
+
+const (
+	// sectorLostThreshold is the number of consecutive audits a host has to
+	// report a sector as missing for before it's considered lost.
+	sectorLostThreshold = 3
+)
+
+type (
+	// dbHostAudit holds the accumulated sector audit results of a host.
+	dbHostAudit struct {
+		Model
+
+		DBHostID uint   `gorm:"unique;NOT NULL"`
+		DBHost   dbHost `gorm:"constraint:OnDelete:CASCADE"` // CASCADE to drop the stats with the host
+
+		Successful uint64 `gorm:"NOT NULL;default:0"`
+		Failed     uint64 `gorm:"NOT NULL;default:0"`
+		Lost       uint64 `gorm:"NOT NULL;default:0"`
+		LastAudit  time.Time
+		LastLoss   time.Time
+	}
+
+	// dbSectorAuditFailure counts the consecutive audits in which the host of
+	// a contract reported the sector as missing.
+	dbSectorAuditFailure struct {
+		Model
+
+		DBContractID uint       `gorm:"uniqueIndex:idx_sector_audit_failures_contract_sector;NOT NULL"`
+		DBContract   dbContract `gorm:"constraint:OnDelete:CASCADE"` // CASCADE to drop the failures with the contract
+		DBSectorID   uint       `gorm:"uniqueIndex:idx_sector_audit_failures_contract_sector;NOT NULL"`
+		DBSector     dbSector   `gorm:"constraint:OnDelete:CASCADE"` // CASCADE to drop the failures with the sector
+
+		Missing uint64 `gorm:"NOT NULL;default:0"`
+	}
+)
+
+// TableName implements the gorm.Tabler interface.
+func (dbHostAudit) TableName() string { return "host_audits" }
+
+// TableName implements the gorm.Tabler interface.
+func (dbSectorAuditFailure) TableName() string { return "sector_audit_failures" }
+
+// sampleIDs samples up to limit distinct ids of the rows matched by query. It
+// picks random values between the smallest and largest id and takes the first
+// id at or after each of them, which unlike ordering by a random value doesn't
+// scan the whole table. Ids that follow a gap are more likely to be sampled.
+func sampleIDs(query func() *gorm.DB, column string, limit int) ([]uint, error) {
+	var bounds struct {
+		Min sql.NullInt64
+		Max sql.NullInt64
+	}
+	if err := query().
+		Select(fmt.Sprintf("MIN(%[1]s) AS min, MAX(%[1]s) AS max", column)).
+		Scan(&bounds).
+		Error; err != nil {
+		return nil, err
+	} else if !bounds.Min.Valid || !bounds.Max.Valid {
+		return nil, nil
+	}
+
+	seen := make(map[uint]struct{})
+	var ids []uint
+	for i := 0; i < 2*limit && len(ids) < limit; i++ {
+		start := bounds.Min.Int64 + int64(frand.Uint64n(uint64(bounds.Max.Int64-bounds.Min.Int64)+1))
+		var sampled []uint
+		if err := query().
+			Where(column+" >= ?", start).
+			Order(column+" ASC").
+			Limit(1).
+			Pluck(column, &sampled).
+			Error; err != nil {
+			return nil, err
+		} else if len(sampled) == 0 {
+			continue
+		} else if _, ok := seen[sampled[0]]; ok {
+			continue
+		}
+		seen[sampled[0]] = struct{}{}
+		ids = append(ids, sampled[0])
+	}
+	return ids, nil
+}
+
+// SectorsForAudit returns up to limit sectors together with the contract they
+// are supposed to be stored on. Sectors that were reported missing by their
+// host are audited again first, the remaining ones are sampled randomly.
+func (s *SQLStore) SectorsForAudit(ctx context.Context, limit int) ([]api.SectorAudit, error) {
+	var rows []struct {
+		FCID       fileContractID `gorm:"column:fcid"`
+		PublicKey  publicKey
+		NetAddress string
+		Root       []byte
+	}
+	sectorsQuery := func() *gorm.DB {
+		return s.db.
+			WithContext(ctx).
+			Select("c.fcid, h.public_key, h.net_address, sec.root").
+			Table("contract_sectors cs").
+			Joins("INNER JOIN contracts c ON c.id = cs.db_contract_id").
+			Joins("INNER JOIN hosts h ON h.id = c.host_id").
+			Joins("INNER JOIN sectors sec ON sec.id = cs.db_sector_id")
+	}
+
+	// audit the sectors that were reported missing again
+	err := sectorsQuery().
+		Joins("INNER JOIN sector_audit_failures saf ON saf.db_contract_id = cs.db_contract_id AND saf.db_sector_id = cs.db_sector_id").
+		Order("saf.id ASC").
+		Limit(limit).
+		Find(&rows).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	// sample the remaining sectors
+	if len(rows) < limit {
+		sectorIDs, err := sampleIDs(func() *gorm.DB {
+			return s.db.WithContext(ctx).Table("contract_sectors")
+		}, "db_sector_id", limit-len(rows))
+		if err != nil {
+			return nil, err
+		}
+		if len(sectorIDs) > 0 {
+			var sampled []struct {
+				FCID       fileContractID `gorm:"column:fcid"`
+				PublicKey  publicKey
+				NetAddress string
+				Root       []byte
+			}
+			if err := sectorsQuery().
+				Where("cs.db_sector_id IN ?", sectorIDs).
+				Find(&sampled).
+				Error; err != nil {
+				return nil, err
+			}
+			for _, row := range sampled {
+				if len(rows) == limit {
+					break
+				}
+				rows = append(rows, row)
+			}
+		}
+	}
+
+	audits := make([]api.SectorAudit, 0, len(rows))
+	seen := make(map[string]struct{})
+	for _, row := range rows {
+		audit := api.SectorAudit{
+			ContractID: types.FileContractID(row.FCID),
+			HostKey:    types.PublicKey(row.PublicKey),
+			HostIP:     row.NetAddress,
+		}
+		copy(audit.Root[:], row.Root)
+		if _, ok := seen[audit.ContractID.String()+audit.Root.String()]; ok {
+			continue // sampled after being reported missing
+		}
+		seen[audit.ContractID.String()+audit.Root.String()] = struct{}{}
+		audits = append(audits, audit)
+	}
+	return audits, nil
+}
+
+// RecordSectorAudits records the results of sector audits. A sector that its
+// host reported missing in sectorLostThreshold consecutive audits is marked as
+// lost by removing it from the contract and host it was audited on, the slabs
+// that lost a shard are added to the repair queue. Other errors, like the host
+// being offline, don't count towards the threshold and a successful audit
+// resets it. The results are added to the audit stats of the audited hosts.
+func (s *SQLStore) RecordSectorAudits(ctx context.Context, set string, results []api.SectorAuditResult) (lost int, err error) {
+	err = s.retryTransaction(func(tx *gorm.DB) error {
+		tx = tx.WithContext(ctx)
+		lost = 0
+
+		var sectorIDs []uint
+		isLost := make([]bool, len(results))
+		for i, res := range results {
+			if res.Error != "" && !res.Missing {
+				continue
+			}
+
+			var sector dbSector
+			if err := tx.Where("root = ?", res.Root[:]).Take(&sector).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+				continue // sector was pruned
+			} else if err != nil {
+				return err
+			}
+			c, err := contract(tx, fileContractID(res.ContractID))
+			if errors.Is(err, ErrContractNotFound) {
+				continue
+			} else if err != nil {
+				return err
+			}
+
+			// a successful audit resets the failures
+			failures := tx.Where("db_contract_id = ? AND db_sector_id = ?", c.ID, sector.ID)
+			if !res.Missing {
+				if err := failures.Delete(&dbSectorAuditFailure{}).Error; err != nil {
+					return err
+				}
+				continue
+			}
+
+			var f dbSectorAuditFailure
+			if err := failures.Take(&f).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+				f = dbSectorAuditFailure{DBContractID: c.ID, DBSectorID: sector.ID}
+			} else if err != nil {
+				return err
+			}
+			f.Missing++
+			if f.Missing < sectorLostThreshold {
+				if err := tx.Save(&f).Error; err != nil {
+					return err
+				}
+				continue
+			}
+
+			// the sector is lost
+			if err := tx.
+				Where("db_contract_id = ? AND db_sector_id = ?", c.ID, sector.ID).
+				Delete(&dbContractSector{}).
+				Error; err != nil {
+				return err
+			}
+			if err := tx.
+				Exec("DELETE FROM host_sectors WHERE db_host_id = ? AND db_sector_id = ?", c.HostID, sector.ID).
+				Error; err != nil {
+				return err
+			}
+			if f.ID != 0 {
+				if err := tx.Delete(&f).Error; err != nil {
+					return err
+				}
+			}
+			sectorIDs = append(sectorIDs, sector.ID)
+			isLost[i] = true
+			lost++
+		}
+
+		if err := recordHostAudits(tx, results, isLost); err != nil {
+			return err
+		}
+		if len(sectorIDs) == 0 {
+			return nil
+		}
+
+		// enqueue the slabs that lost a shard
+		var slabIDs []uint
+		if err := tx.
+			Model(&dbShard{}).
+			Where("db_sector_id IN ?", sectorIDs).
+			Distinct().
+			Pluck("db_slab_id", &slabIDs).
+			Error; err != nil {
+			return err
+		}
+		_, err := enqueueSlabsForRepair(tx, set, 1, slabIDs)
+		return err
+	})
+	return
+}
+
+// recordHostAudits adds the audit results to the audit stats of the audited
+// hosts, results of hosts that don't exist are ignored. Sectors that were
+// reported missing but aren't lost yet count as failed audits.
+func recordHostAudits(tx *gorm.DB, results []api.SectorAuditResult, isLost []bool) error {
+	now := time.Now().UTC()
+	stats := make(map[types.PublicKey]*dbHostAudit)
+	var hks []types.PublicKey
+	for i, res := range results {
+		ha, ok := stats[res.HostKey]
+		if !ok {
+			ha = &dbHostAudit{LastAudit: now}
+			stats[res.HostKey] = ha
+			hks = append(hks, res.HostKey)
+		}
+		if isLost[i] {
+			ha.Lost++
+			ha.LastLoss = now
+		} else if res.Error != "" || res.Missing {
+			ha.Failed++
+		} else {
+			ha.Successful++
+		}
+	}
+
+	for _, hk := range hks {
+		var h dbHost
+		if err := tx.Where("public_key", publicKey(hk)).Take(&h).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		update := stats[hk]
+		var ha dbHostAudit
+		if err := tx.Where("db_host_id", h.ID).Take(&ha).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			ha = dbHostAudit{DBHostID: h.ID}
+		} else if err != nil {
+			return err
+		}
+		ha.Successful += update.Successful
+		ha.Failed += update.Failed
+		ha.Lost += update.Lost
+		ha.LastAudit = update.LastAudit
+		if update.Lost > 0 {
+			ha.LastLoss = update.LastLoss
+		}
+		if err := tx.Save(&ha).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HostAuditStats returns the audit stats of all audited hosts, the hosts that
+// lost the most sectors first.
+func (s *SQLStore) HostAuditStats(ctx context.Context) ([]api.HostAuditStats, error) {
+	var audits []dbHostAudit
+	if err := s.db.
+		WithContext(ctx).
+		Preload("DBHost").
+		Order("lost DESC").
+		Order("id ASC").
+		Find(&audits).
+		Error; err != nil {
+		return nil, err
+	}
+
+	stats := make([]api.HostAuditStats, len(audits))
+	for i, ha := range audits {
+		stats[i] = api.HostAuditStats{
+			HostKey:    types.PublicKey(ha.DBHost.PublicKey),
+			Successful: ha.Successful,
+			Failed:     ha.Failed,
+			Lost:       ha.Lost,
+			LastAudit:  ha.LastAudit.UTC(),
+			LastLoss:   ha.LastLoss.UTC(),
+		}
+	}
+	return stats, nil
+}
+
+// ObjectsForAudit returns the paths of up to limit randomly sampled objects
+// that can be audited, i.e. objects with an ETag whose key isn't protected by
+// a passphrase. Only objects of up to maxSize bytes are sampled if maxSize
+// isn't zero.
+func (s *SQLStore) ObjectsForAudit(ctx context.Context, limit int, maxSize uint64) ([]string, error) {
+	ids, err := sampleIDs(func() *gorm.DB {
+		query := s.db.
+			WithContext(ctx).
+			Model(&dbObject{}).
+			Where("e_tag <> '' AND key_wrap IS NULL")
+		if maxSize > 0 {
+			query = query.Where("(SELECT COALESCE(SUM(sli.length), 0) FROM slices sli WHERE sli.db_object_id = objects.id) <= ?", maxSize)
+		}
+		return query
+	}, "id", limit)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	var paths []string
+	err = s.db.
+		WithContext(ctx).
+		Model(&dbObject{}).
+		Where("id IN ?", ids).
+		Pluck("object_id", &paths).
+		Error
+	return paths, err
+}
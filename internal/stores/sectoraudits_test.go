@@ -0,0 +1,195 @@
+package stores
+
+import (
+	"context"
+	"testing"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/object"
+)
+
+// TestSectorAudits verifies sectors that are reported missing repeatedly are
+// removed from their contract and the affected slab is queued for repair.
+func TestSectorAudits(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	hks, err := db.addTestHosts(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcids, _, err := db.addTestContracts(hks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetContractSet(ctx, "autopilot", fcids); err != nil {
+		t.Fatal(err)
+	}
+	usedContracts := map[types.PublicKey]types.FileContractID{hks[0]: fcids[0], hks[1]: fcids[1]}
+
+	obj := object.Object{
+		Key: object.GenerateEncryptionKey(),
+		Slabs: []object.SlabSlice{{
+			Slab: object.Slab{
+				Key:       object.GenerateEncryptionKey(),
+				MinShards: 1,
+				Shards:    []object.Sector{{Host: hks[0], Root: types.Hash256{1}}, {Host: hks[1], Root: types.Hash256{2}}},
+			},
+		}},
+	}
+	if err := db.UpdateObject(ctx, "foo", obj, usedContracts, nil, false, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	audits, err := db.SectorsForAudit(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(audits) != 2 {
+		t.Fatal("unexpected audits", audits)
+	}
+	for _, a := range audits {
+		if (a.Root == types.Hash256{1} && (a.ContractID != fcids[0] || a.HostKey != hks[0])) || (a.Root == types.Hash256{2} && (a.ContractID != fcids[1] || a.HostKey != hks[1])) {
+			t.Fatal("unexpected audit", a)
+		}
+	}
+
+	// the first sector passes its audits, the second one is reported missing
+	// but it's only lost once that happened in consecutive audits, a
+	// successful audit resets the count and other errors don't count
+	passed := api.SectorAuditResult{ContractID: fcids[0], HostKey: hks[0], Root: types.Hash256{1}}
+	missing := api.SectorAuditResult{ContractID: fcids[1], HostKey: hks[1], Root: types.Hash256{2}, Missing: true, Error: "sector not found"}
+	for i, res := range []api.SectorAuditResult{
+		missing,
+		{ContractID: fcids[1], HostKey: hks[1], Root: types.Hash256{2}},
+		missing,
+		{ContractID: fcids[1], HostKey: hks[1], Root: types.Hash256{2}, Error: "insufficient funds"},
+		missing,
+	} {
+		if lost, err := db.RecordSectorAudits(ctx, "autopilot", []api.SectorAuditResult{passed, res}); err != nil {
+			t.Fatal(err)
+		} else if lost != 0 {
+			t.Fatal("unexpected number of lost sectors", i, lost)
+		}
+	}
+
+	// sectors that were reported missing are audited again first
+	if audits, err := db.SectorsForAudit(ctx, 1); err != nil {
+		t.Fatal(err)
+	} else if len(audits) != 1 || audits[0].Root != (types.Hash256{2}) {
+		t.Fatal("unexpected audits", audits)
+	}
+
+	lost, err := db.RecordSectorAudits(ctx, "autopilot", []api.SectorAuditResult{missing})
+	if err != nil {
+		t.Fatal(err)
+	} else if lost != 1 {
+		t.Fatal("unexpected number of lost sectors", lost)
+	}
+	var count int64
+	if err := db.db.Model(&dbSectorAuditFailure{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	} else if count != 0 {
+		t.Fatal("unexpected number of audit failures", count)
+	}
+
+	if audits, err := db.SectorsForAudit(ctx, 10); err != nil {
+		t.Fatal(err)
+	} else if len(audits) != 1 || audits[0].Root != (types.Hash256{1}) {
+		t.Fatal("unexpected audits", audits)
+	}
+	if queue, err := db.RepairQueue(ctx, 0); err != nil {
+		t.Fatal(err)
+	} else if len(queue) != 1 || queue[0].Health != 0 {
+		t.Fatal("unexpected repair queue", queue)
+	}
+
+	// the results should be added to the hosts' audit stats
+	if _, err := db.RecordSectorAudits(ctx, "autopilot", []api.SectorAuditResult{
+		{ContractID: fcids[0], HostKey: hks[0], Root: types.Hash256{1}},
+		{ContractID: fcids[0], HostKey: hks[0], Root: types.Hash256{1}, Error: "host is offline"},
+		{ContractID: fcids[0], HostKey: types.PublicKey{99}, Root: types.Hash256{1}}, // unknown host
+	}); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := db.HostAuditStats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(stats) != 2 {
+		t.Fatal("unexpected stats", stats)
+	} else if s := stats[0]; s.HostKey != hks[1] || s.Successful != 1 || s.Failed != 4 || s.Lost != 1 || s.LastLoss.IsZero() || s.LastAudit.IsZero() {
+		t.Fatal("unexpected stats", s)
+	} else if s := stats[1]; s.HostKey != hks[0] || s.Successful != 6 || s.Failed != 1 || s.Lost != 0 || !s.LastLoss.IsZero() {
+		t.Fatal("unexpected stats", s)
+	} else if r := stats[1].Retrievability(); r <= 0 || r >= 2.0/3 {
+		t.Fatal("unexpected retrievability", r)
+	} else if r := stats[0].Retrievability(); r >= stats[1].Retrievability() {
+		t.Fatal("unexpected retrievability", r)
+	}
+}
+
+// TestObjectsForAudit verifies only objects that can be audited are sampled.
+func TestObjectsForAudit(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	hks, err := db.addTestHosts(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcids, _, err := db.addTestContracts(hks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usedContracts := map[types.PublicKey]types.FileContractID{hks[0]: fcids[0]}
+
+	// add objects of different sizes, one without an ETag and one protected
+	// by a passphrase
+	for i, o := range []struct {
+		path   string
+		length uint32
+		etag   string
+		wrap   bool
+	}{
+		{"small", 10, "a", false},
+		{"large", 1000, "b", false},
+		{"noetag", 10, "", false},
+		{"wrapped", 10, "c", true},
+	} {
+		obj := object.Object{
+			Key:  object.GenerateEncryptionKey(),
+			ETag: o.etag,
+			Slabs: []object.SlabSlice{{
+				Slab: object.Slab{
+					Key:       object.GenerateEncryptionKey(),
+					MinShards: 1,
+					Shards:    []object.Sector{{Host: hks[0], Root: types.Hash256{byte(i)}}},
+				},
+				Length: o.length,
+			}},
+		}
+		if o.wrap {
+			obj.Wrap = &object.KeyWrap{}
+		}
+		if err := db.UpdateObject(ctx, o.path, obj, usedContracts, nil, false, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if paths, err := db.ObjectsForAudit(ctx, 10, 0); err != nil {
+		t.Fatal(err)
+	} else if len(paths) != 2 {
+		t.Fatal("unexpected paths", paths)
+	}
+	if paths, err := db.ObjectsForAudit(ctx, 10, 100); err != nil {
+		t.Fatal(err)
+	} else if len(paths) != 1 || paths[0] != "small" {
+		t.Fatal("unexpected paths", paths)
+	}
+}
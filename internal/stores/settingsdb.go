@@ -6,10 +6,17 @@ import (
 	"fmt"
 
 	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/internal/auth"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
+const (
+	// settingHistoryRetention is the number of updates that are kept in the
+	// history of a setting, older updates are pruned.
+	settingHistoryRetention = 100
+)
+
 type (
 	dbSetting struct {
 		Model
@@ -17,11 +24,36 @@ type (
 		Key   string `gorm:"unique;index;NOT NULL"`
 		Value string `gorm:"NOT NULL"`
 	}
+
+	// dbSettingUpdate is an entry in the history of a setting.
+	dbSettingUpdate struct {
+		Model
+
+		Key      string `gorm:"index;NOT NULL"`
+		OldValue string `gorm:"NOT NULL"`
+		NewValue string `gorm:"NOT NULL"`
+		Actor    string `gorm:"NOT NULL"`
+	}
 )
 
 // TableName implements the gorm.Tabler interface.
 func (dbSetting) TableName() string { return "settings" }
 
+// TableName implements the gorm.Tabler interface.
+func (dbSettingUpdate) TableName() string { return "setting_updates" }
+
+// convert turns a dbSettingUpdate into an api.SettingUpdate.
+func (u dbSettingUpdate) convert() api.SettingUpdate {
+	return api.SettingUpdate{
+		ID:        u.ID,
+		Key:       u.Key,
+		OldValue:  u.OldValue,
+		NewValue:  u.NewValue,
+		Timestamp: u.CreatedAt.UTC(),
+		Actor:     u.Actor,
+	}
+}
+
 // Setting implements the bus.SettingStore interface.
 func (s *SQLStore) Setting(ctx context.Context, key string) (string, error) {
 	var entry dbSetting
@@ -45,27 +77,121 @@ func (s *SQLStore) Settings(ctx context.Context) ([]string, error) {
 
 // UpdateSetting implements the bus.SettingStore interface.
 func (s *SQLStore) UpdateSetting(ctx context.Context, key, value string) error {
-	return s.db.Clauses(clause.OnConflict{
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		return updateSetting(tx, key, value, actor(ctx))
+	})
+}
+
+// UpdateSettings implements the bus.SettingStore interface.
+func (s *SQLStore) UpdateSettings(ctx context.Context, settings map[string]string) error {
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		for key, value := range settings {
+			if err := updateSetting(tx, key, value, actor(ctx)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SettingHistory returns the updates of the setting with the given key, most
+// recent first.
+func (s *SQLStore) SettingHistory(ctx context.Context, key string, offset, limit int) ([]api.SettingUpdate, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+
+	var updates []dbSettingUpdate
+	err := s.db.
+		WithContext(ctx).
+		Where("`key` = ?", key).
+		Order("id DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&updates).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]api.SettingUpdate, len(updates))
+	for i, u := range updates {
+		history[i] = u.convert()
+	}
+	return history, nil
+}
+
+// RollbackSetting resets the setting with the given key to the value it had
+// after the update with the given id. The rollback is recorded in the
+// setting's history like any other update.
+func (s *SQLStore) RollbackSetting(ctx context.Context, key string, id uint) error {
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		var update dbSettingUpdate
+		err := tx.Where("id = ? AND `key` = ?", id, key).Take(&update).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: update %d of setting '%s'", api.ErrSettingUpdateNotFound, id, key)
+		} else if err != nil {
+			return err
+		}
+		return updateSetting(tx, key, update.NewValue, actor(ctx))
+	})
+}
+
+// actor returns the identity of the caller that triggered the update, it's
+// empty if the update wasn't triggered through the API.
+func actor(ctx context.Context) string {
+	identity, _ := auth.Identity(ctx)
+	return identity
+}
+
+// updateSetting updates the setting with the given key and records the update
+// in the setting's history. Updates that don't change the value are ignored and
+// only the last settingHistoryRetention updates of a setting are kept.
+func updateSetting(tx *gorm.DB, key, value, actor string) error {
+	var old []string
+	if err := tx.Model(&dbSetting{}).Where("`key` = ?", key).Pluck("value", &old).Error; err != nil {
+		return err
+	} else if len(old) > 0 && old[0] == value {
+		return nil
+	}
+
+	err := tx.Clauses(clause.OnConflict{
 		Columns:   []clause.Column{{Name: "key"}},
 		DoUpdates: clause.AssignmentColumns([]string{"value"}),
 	}).Create(&dbSetting{
 		Key:   key,
 		Value: value,
 	}).Error
-}
+	if err != nil {
+		return err
+	}
 
-// UpdateSettings implements the bus.SettingStore interface.
-func (s *SQLStore) UpdateSettings(ctx context.Context, settings map[string]string) error {
-	var dbSettings []dbSetting
-	for key, value := range settings {
-		dbSettings = append(dbSettings, dbSetting{
-			Key:   key,
-			Value: value,
-		})
+	update := dbSettingUpdate{
+		Key:      key,
+		NewValue: value,
+		Actor:    actor,
+	}
+	if len(old) > 0 {
+		update.OldValue = old[0]
+	}
+	if err := tx.Create(&update).Error; err != nil {
+		return err
 	}
 
-	return s.db.Clauses(clause.OnConflict{
-		Columns:   []clause.Column{{Name: "key"}},
-		DoUpdates: clause.AssignmentColumns([]string{"value"}),
-	}).Create(&dbSettings).Error
+	// prune the updates that exceed the retention, the cutoff is fetched
+	// separately since MySQL doesn't allow deleting from a table that's
+	// referenced in a subquery
+	var cutoff []uint
+	if err := tx.Model(&dbSettingUpdate{}).
+		Where("`key` = ?", key).
+		Order("id DESC").
+		Offset(settingHistoryRetention).
+		Limit(1).
+		Pluck("id", &cutoff).
+		Error; err != nil {
+		return err
+	} else if len(cutoff) == 0 {
+		return nil
+	}
+	return tx.Where("`key` = ? AND id <= ?", key, cutoff[0]).Delete(&dbSettingUpdate{}).Error
 }
@@ -2,7 +2,12 @@ package stores
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
+
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/internal/auth"
 )
 
 // TestSQLSettingStore tests the bus.SettingStore methods on the SQLSettingStore.
@@ -50,3 +55,108 @@ func TestSQLSettingStore(t *testing.T) {
 		t.Fatalf("unexpected value, %s != 'barbaz'", value)
 	}
 }
+
+// TestSettingHistory verifies setting updates are recorded and settings can be
+// rolled back to a previous value.
+func TestSettingHistory(t *testing.T) {
+	ss, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := auth.WithIdentity(context.Background(), "alice")
+
+	// update the setting a few times, updates that don't change the value
+	// aren't recorded
+	for _, value := range []string{"foo", "bar", "bar"} {
+		if err := ss.UpdateSetting(ctx, "key", value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ss.UpdateSettings(context.Background(), map[string]string{"key": "baz", "other": "foo"}); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := ss.SettingHistory(ctx, "key", 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(history) != 3 {
+		t.Fatalf("unexpected number of updates, %v != 3", len(history))
+	}
+	for i, expected := range []api.SettingUpdate{
+		{Key: "key", OldValue: "bar", NewValue: "baz", Actor: ""},
+		{Key: "key", OldValue: "foo", NewValue: "bar", Actor: "alice"},
+		{Key: "key", OldValue: "", NewValue: "foo", Actor: "alice"},
+	} {
+		u := history[i]
+		if u.Key != expected.Key || u.OldValue != expected.OldValue || u.NewValue != expected.NewValue || u.Actor != expected.Actor {
+			t.Fatalf("unexpected update %d: %+v", i, u)
+		} else if u.Timestamp.IsZero() {
+			t.Fatal("missing timestamp")
+		}
+	}
+	if history, err := ss.SettingHistory(ctx, "key", 1, 1); err != nil {
+		t.Fatal(err)
+	} else if len(history) != 1 || history[0].NewValue != "bar" {
+		t.Fatal("unexpected history", history)
+	}
+
+	// roll back to the first value, the rollback is recorded
+	if err := ss.RollbackSetting(ctx, "key", history[2].ID); err != nil {
+		t.Fatal(err)
+	} else if value, err := ss.Setting(ctx, "key"); err != nil {
+		t.Fatal(err)
+	} else if value != "foo" {
+		t.Fatalf("unexpected value, %s != 'foo'", value)
+	}
+	if history, err := ss.SettingHistory(ctx, "key", 0, 1); err != nil {
+		t.Fatal(err)
+	} else if len(history) != 1 || history[0].OldValue != "baz" || history[0].NewValue != "foo" {
+		t.Fatal("unexpected history", history)
+	}
+
+	// updates of other settings can't be used to roll back
+	if other, err := ss.SettingHistory(ctx, "other", 0, -1); err != nil {
+		t.Fatal(err)
+	} else if len(other) != 1 {
+		t.Fatal("unexpected history", other)
+	} else if err := ss.RollbackSetting(ctx, "key", other[0].ID); !errors.Is(err, api.ErrSettingUpdateNotFound) {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+func TestSettingHistoryRetention(t *testing.T) {
+	ss, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// update the setting more often than the history retains
+	for i := 0; i < settingHistoryRetention+10; i++ {
+		if err := ss.UpdateSetting(ctx, "key", fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ss.UpdateSetting(ctx, "other", "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the most recent updates should be kept
+	history, err := ss.SettingHistory(ctx, "key", 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(history) != settingHistoryRetention {
+		t.Fatalf("unexpected number of updates, %v != %v", len(history), settingHistoryRetention)
+	} else if history[0].NewValue != fmt.Sprint(settingHistoryRetention+9) {
+		t.Fatal("unexpected most recent update", history[0])
+	} else if history[len(history)-1].NewValue != "10" {
+		t.Fatal("unexpected oldest update", history[len(history)-1])
+	}
+
+	// the history of other settings is unaffected
+	if other, err := ss.SettingHistory(ctx, "other", 0, -1); err != nil {
+		t.Fatal(err)
+	} else if len(other) != 1 {
+		t.Fatal("unexpected history", other)
+	}
+}
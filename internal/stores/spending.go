@@ -0,0 +1,84 @@
+package stores
+
+import (
+	"context"
+	"errors"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"gorm.io/gorm"
+)
+
+type (
+	dbPeriodSpending struct {
+		Model
+
+		PeriodStart uint64 `gorm:"uniqueIndex;NOT NULL"`
+		Formation   currency
+		Storage     currency
+		Upload      currency
+		Download    currency
+		FundAccount currency
+	}
+)
+
+// TableName implements the gorm.Tabler interface.
+func (dbPeriodSpending) TableName() string { return "period_spendings" }
+
+// convert turns a dbPeriodSpending into an api.PeriodSpending.
+func (s dbPeriodSpending) convert() api.PeriodSpending {
+	return api.PeriodSpending{
+		PeriodStart: s.PeriodStart,
+		Formation:   types.Currency(s.Formation),
+		Storage:     types.Currency(s.Storage),
+		Upload:      types.Currency(s.Upload),
+		Download:    types.Currency(s.Download),
+		FundAccount: types.Currency(s.FundAccount),
+	}
+}
+
+// PeriodSpending implements the bus.SpendingStore interface. It returns zero
+// spending if nothing was recorded for the period.
+func (s *SQLStore) PeriodSpending(ctx context.Context, periodStart uint64) (api.PeriodSpending, error) {
+	var ps dbPeriodSpending
+	err := s.db.
+		Where("period_start = ?", periodStart).
+		Take(&ps).
+		Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return api.PeriodSpending{PeriodStart: periodStart}, nil
+	} else if err != nil {
+		return api.PeriodSpending{}, err
+	}
+	return ps.convert(), nil
+}
+
+// AddPeriodSpending implements the bus.SpendingStore interface. It adds the
+// given spending to the spending of the period it starts.
+func (s *SQLStore) AddPeriodSpending(ctx context.Context, spending api.PeriodSpending) error {
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		var ps dbPeriodSpending
+		err := tx.
+			Where("period_start = ?", spending.PeriodStart).
+			Take(&ps).
+			Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ps = dbPeriodSpending{
+				PeriodStart: spending.PeriodStart,
+				Formation:   zeroCurrency,
+				Storage:     zeroCurrency,
+				Upload:      zeroCurrency,
+				Download:    zeroCurrency,
+				FundAccount: zeroCurrency,
+			}
+		} else if err != nil {
+			return err
+		}
+		ps.Formation = currency(types.Currency(ps.Formation).Add(spending.Formation))
+		ps.Storage = currency(types.Currency(ps.Storage).Add(spending.Storage))
+		ps.Upload = currency(types.Currency(ps.Upload).Add(spending.Upload))
+		ps.Download = currency(types.Currency(ps.Download).Add(spending.Download))
+		ps.FundAccount = currency(types.Currency(ps.FundAccount).Add(spending.FundAccount))
+		return tx.Save(&ps).Error
+	})
+}
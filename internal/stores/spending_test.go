@@ -0,0 +1,46 @@
+package stores
+
+import (
+	"context"
+	"testing"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+// TestPeriodSpending verifies spending is added up per period.
+func TestPeriodSpending(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// no spending was recorded yet
+	if ps, err := db.PeriodSpending(ctx, 10); err != nil {
+		t.Fatal(err)
+	} else if ps.PeriodStart != 10 || !ps.Total().IsZero() {
+		t.Fatal("unexpected spending", ps)
+	}
+
+	// record spending twice in the same period and once in the next one
+	for _, ps := range []api.PeriodSpending{
+		{PeriodStart: 10, Formation: types.Siacoins(1), Storage: types.Siacoins(2)},
+		{PeriodStart: 10, Storage: types.Siacoins(3), FundAccount: types.Siacoins(4)},
+		{PeriodStart: 20, Upload: types.Siacoins(5), Download: types.Siacoins(6)},
+	} {
+		if err := db.AddPeriodSpending(ctx, ps); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if ps, err := db.PeriodSpending(ctx, 10); err != nil {
+		t.Fatal(err)
+	} else if !ps.Formation.Equals(types.Siacoins(1)) || !ps.Storage.Equals(types.Siacoins(5)) || !ps.FundAccount.Equals(types.Siacoins(4)) || !ps.Upload.IsZero() {
+		t.Fatal("unexpected spending", ps)
+	} else if ps, err := db.PeriodSpending(ctx, 20); err != nil {
+		t.Fatal(err)
+	} else if !ps.Total().Equals(types.Siacoins(11)) {
+		t.Fatal("unexpected spending", ps)
+	}
+}
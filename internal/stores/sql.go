@@ -3,12 +3,14 @@ package stores
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"sync"
 	"time"
 
 	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
 	"go.sia.tech/siad/modules"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/sqlite"
@@ -29,6 +31,13 @@ type (
 		db     *gorm.DB
 		logger glogger.Interface
 
+		// queryStats keeps track of the executed queries.
+		queryStats *queryStats
+
+		// keyCipher encrypts the object and slab keys at rest, it's nil if
+		// no database secret was provided.
+		keyCipher *keyCipher
+
 		// HostDB related fields.
 		lastAnnouncementSave   time.Time
 		persistInterval        time.Duration
@@ -36,6 +45,14 @@ type (
 		unappliedCCID          modules.ConsensusChangeID
 		unappliedRevisions     map[types.FileContractID]revisionUpdate
 		unappliedProofs        map[types.FileContractID]uint64
+		unappliedRevertHeight  *uint64
+		consensusStats         consensusStats
+
+		// processedHeight is the height of the first block that wasn't
+		// processed yet, lastCheckpointHeight is the processed height of the
+		// most recent consensus checkpoint.
+		processedHeight      uint64
+		lastCheckpointHeight uint64
 
 		mu           sync.Mutex
 		hasAllowlist bool
@@ -90,8 +107,9 @@ func DBConfigFromEnv() (uri, user, password, dbName string) {
 
 // NewSQLStore uses a given Dialector to connect to a SQL database.  NOTE: Only
 // pass migrate=true for the first instance of SQLHostDB if you connect via the
-// same Dialector multiple times.
-func NewSQLStore(conn gorm.Dialector, migrate bool, persistInterval time.Duration, logger glogger.Interface) (*SQLStore, modules.ConsensusChangeID, error) {
+// same Dialector multiple times. If a secret is provided, it is used to encrypt
+// the object and slab encryption keys stored in the database.
+func NewSQLStore(conn gorm.Dialector, migrate bool, persistInterval time.Duration, secret *[32]byte, logger glogger.Interface) (*SQLStore, modules.ConsensusChangeID, error) {
 	db, err := gorm.Open(conn, &gorm.Config{
 		DisableNestedTransaction: true,   // disable nesting transactions
 		PrepareStmt:              true,   // caches queries as prepared statements
@@ -100,6 +118,10 @@ func NewSQLStore(conn gorm.Dialector, migrate bool, persistInterval time.Duratio
 	if err != nil {
 		return nil, modules.ConsensusChangeID{}, err
 	}
+	qs := newQueryStats()
+	if err := db.Use(qs); err != nil {
+		return nil, modules.ConsensusChangeID{}, err
+	}
 
 	if migrate {
 		// Create the tables.
@@ -107,16 +129,21 @@ func NewSQLStore(conn gorm.Dialector, migrate bool, persistInterval time.Duratio
 			// bus.MetadataStore tables
 			&dbArchivedContract{},
 			&dbContract{},
+			&dbContractRevisionHeight{},
 			&dbContractSet{},
+			&dbContractSetChange{},
 			&dbObject{},
+			&dbPartialSlab{},
 			&dbSector{},
 			&dbShard{},
 			&dbSlab{},
 			&dbSlice{},
+			&dbTrashedObject{},
 
 			// bus.HostDB tables
 			&dbAnnouncement{},
 			&dbConsensusInfo{},
+			&dbConsensusCheckpoint{},
 			&dbHost{},
 			&dbInteraction{},
 			&dbAllowlistEntry{},
@@ -124,34 +151,77 @@ func NewSQLStore(conn gorm.Dialector, migrate bool, persistInterval time.Duratio
 
 			// bus.SettingStore tables
 			&dbSetting{},
+			&dbSettingUpdate{},
 
 			// bus.EphemeralAccountStore tables
 			&dbAccount{},
+
+			// bus.AuditStore tables
+			&dbAuditEntry{},
+
+			// repair queue
+			&dbRepair{},
+			&dbSlabMigration{},
+
+			// garbage collection
+			&dbSectorDeletion{},
+
+			// sector audits
+			&dbHostAudit{},
+			&dbSectorAuditFailure{},
+
+			// recovery
+			&dbRecoveredSector{},
+
+			// bus.ReportStore tables
+			&dbDailyReport{},
+
+			// bus.JobStore tables
+			&dbJob{},
+
+			// bus.FeeStore tables
+			&dbFeeMetric{},
+
+			// bus.SpendingStore tables
+			&dbPeriodSpending{},
+
+			// bus.AutopilotStateStore tables
+			&dbAutopilotState{},
+
+			// bus.SchedulerStore tables
+			&dbScheduledEvent{},
 		}
 		if err := db.AutoMigrate(tables...); err != nil {
 			return nil, modules.ConsensusChangeID{}, err
 		}
-	}
 
-	// Ensure the join table has an index on `db_host_id`.
-	switch conn.(type) {
-	case *sqlite.Dialector:
-		if err := db.Exec("CREATE INDEX IF NOT EXISTS idx_host_blocklist_entry_hosts ON host_blocklist_entry_hosts (db_host_id)").Error; err != nil {
-			return nil, modules.ConsensusChangeID{}, err
-		}
-	case *mysql.Dialector:
-		var found int
-		err := db.Raw("SELECT COUNT(1) IndexIsThere FROM INFORMATION_SCHEMA.STATISTICS WHERE table_schema=DATABASE() AND table_name='host_blocklist_entry_hosts' AND index_name='idx_host_blocklist_entry_hosts'").Scan(&found).Error
-		if err != nil {
-			return nil, modules.ConsensusChangeID{}, err
+		// Slabs used to reference the slice they belong to, now slices
+		// reference their slab so slabs can be shared between objects.
+		if db.Migrator().HasColumn(&dbSlab{}, "db_slice_id") {
+			if err := db.Exec("UPDATE slices SET db_slab_id = (SELECT slabs.id FROM slabs WHERE slabs.db_slice_id = slices.id) WHERE db_slab_id IS NULL").Error; err != nil {
+				return nil, modules.ConsensusChangeID{}, err
+			}
 		}
-		if found == 0 {
-			if err := db.Exec("CREATE INDEX idx_host_blocklist_entry_hosts ON host_blocklist_entry_hosts (db_host_id)").Error; err != nil {
+
+		// Contracts added before storage spending was tracked have no
+		// storage spending.
+		for _, table := range []string{"contracts", "archived_contracts"} {
+			if err := db.Exec(fmt.Sprintf("UPDATE %s SET storage_spending = '0' WHERE storage_spending IS NULL", table)).Error; err != nil {
 				return nil, modules.ConsensusChangeID{}, err
 			}
 		}
-	default:
-		panic("unknown dialector")
+	}
+
+	// Ensure the join tables are indexed on the columns that aren't covered
+	// by their primary key.
+	for _, idx := range []struct{ name, table, column string }{
+		{"idx_host_blocklist_entry_hosts", "host_blocklist_entry_hosts", "db_host_id"},
+		{"idx_contract_sectors_db_sector_id", "contract_sectors", "db_sector_id"},
+		{"idx_contract_set_contracts_db_contract_id", "contract_set_contracts", "db_contract_id"},
+	} {
+		if err := createIndexIfNotExists(db, conn, idx.name, idx.table, idx.column); err != nil {
+			return nil, modules.ConsensusChangeID{}, err
+		}
 	}
 
 	// Get latest consensus change ID or init db.
@@ -169,6 +239,16 @@ func NewSQLStore(conn gorm.Dialector, migrate bool, persistInterval time.Duratio
 	var ccid modules.ConsensusChangeID
 	copy(ccid[:], ci.CCID)
 
+	// Get the height of the most recent checkpoint.
+	var lastCheckpointHeight uint64
+	if err := db.
+		Model(&dbConsensusCheckpoint{}).
+		Select("COALESCE(MAX(height), 0)").
+		Scan(&lastCheckpointHeight).
+		Error; err != nil {
+		return nil, modules.ConsensusChangeID{}, err
+	}
+
 	// Check allowlist and blocklist counts
 	allowlistCnt, err := tableCount(db, &dbAllowlistEntry{})
 	if err != nil {
@@ -199,8 +279,11 @@ func NewSQLStore(conn gorm.Dialector, migrate bool, persistInterval time.Duratio
 	ss := &SQLStore{
 		db:                   db,
 		logger:               logger,
+		keyCipher:            newKeyCipher(secret),
+		queryStats:           qs,
 		knownContracts:       isOurContract,
 		lastAnnouncementSave: time.Now(),
+		lastCheckpointHeight: lastCheckpointHeight,
 		persistInterval:      persistInterval,
 		hasAllowlist:         allowlistCnt > 0,
 		hasBlocklist:         blocklistCnt > 0,
@@ -221,6 +304,26 @@ func isSQLite(db *gorm.DB) bool {
 	}
 }
 
+// createIndexIfNotExists creates an index on the given column of a table
+// unless an index with the same name exists.
+func createIndexIfNotExists(db *gorm.DB, conn gorm.Dialector, name, table, column string) error {
+	switch conn.(type) {
+	case *sqlite.Dialector:
+		return db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s (%s)", name, table, column)).Error
+	case *mysql.Dialector:
+		var found int
+		err := db.Raw("SELECT COUNT(1) IndexIsThere FROM INFORMATION_SCHEMA.STATISTICS WHERE table_schema=DATABASE() AND table_name=? AND index_name=?", table, name).Scan(&found).Error
+		if err != nil {
+			return err
+		} else if found == 0 {
+			return db.Exec(fmt.Sprintf("CREATE INDEX %s ON %s (%s)", name, table, column)).Error
+		}
+		return nil
+	default:
+		panic("unknown dialector")
+	}
+}
+
 func (ss *SQLStore) updateHasAllowlist(err *error) {
 	if *err != nil {
 		return
@@ -258,6 +361,15 @@ func tableCount(db *gorm.DB, model interface{}) (cnt int64, err error) {
 	return
 }
 
+// Ping verifies the connection to the database is still alive.
+func (s *SQLStore) Ping(ctx context.Context) error {
+	db, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return db.PingContext(ctx)
+}
+
 // Close closes the underlying database connection of the store.
 func (s *SQLStore) Close() error {
 	db, err := s.db.DB()
@@ -267,12 +379,36 @@ func (s *SQLStore) Close() error {
 	return db.Close()
 }
 
+// isFinalTxError returns true if the error returned by a transaction won't go
+// away by retrying the transaction.
+func isFinalTxError(err error) bool {
+	for _, final := range []error{
+		api.ErrJobNotActive,
+		api.ErrJobNotFound,
+		api.ErrJobNotRetryable,
+		api.ErrJobNotRunning,
+		api.ErrNoJobAvailable,
+		api.ErrObjectExists,
+		api.ErrPreconditionFailed,
+		api.ErrSettingUpdateNotFound,
+		api.ErrSlabNotQueued,
+		api.ErrTrashedObjectNotFound,
+	} {
+		if errors.Is(err, final) {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *SQLStore) retryTransaction(fc func(tx *gorm.DB) error, opts ...*sql.TxOptions) error {
 	var err error
 	for i := 0; i < 5; i++ {
 		err = s.db.Transaction(fc, opts...)
 		if err == nil {
 			return nil
+		} else if isFinalTxError(err) {
+			return err
 		}
 		s.logger.Warn(context.Background(), fmt.Sprintf("transaction attempt %d/%d failed, err: %v", i+1, 5, err))
 		time.Sleep(200 * time.Millisecond)
@@ -1,8 +1,10 @@
 package stores
 
 import (
+	"context"
 	"encoding/hex"
 	"os"
+	"testing"
 	"time"
 
 	"go.sia.tech/siad/modules"
@@ -18,7 +20,7 @@ const testPersistInterval = time.Second
 func newTestSQLStore() (*SQLStore, string, modules.ConsensusChangeID, error) {
 	dbName := hex.EncodeToString(frand.Bytes(32)) // random name for db
 	conn := NewEphemeralSQLiteConnection(dbName)
-	sqlStore, ccid, err := NewSQLStore(conn, true, time.Second, newTestLogger())
+	sqlStore, ccid, err := NewSQLStore(conn, true, time.Second, nil, newTestLogger())
 	if err != nil {
 		return nil, "", modules.ConsensusChangeID{}, err
 	}
@@ -44,3 +46,68 @@ func newTestLogger() logger.Interface {
 		SlowThreshold:             100 * time.Millisecond,
 	})
 }
+
+// TestQueryStats asserts the store keeps track of the executed queries.
+func TestQueryStats(t *testing.T) {
+	ss, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// fetch a missing setting twice
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		if _, err := ss.Setting(ctx, "foo"); err == nil {
+			t.Fatal("expected error")
+		}
+	}
+
+	// assert the queries were recorded without errors
+	var found bool
+	for _, stats := range ss.QueryStats() {
+		if stats.Family != "query settings" {
+			continue
+		}
+		found = true
+		if stats.Count != 2 || stats.Errors != 0 {
+			t.Fatal("unexpected stats", stats)
+		}
+		var total uint64
+		for _, b := range stats.Histogram {
+			total += b.Count
+		}
+		if total != stats.Count {
+			t.Fatal("histogram doesn't add up", total, stats.Count)
+		}
+	}
+	if !found {
+		t.Fatal("query family not found", ss.QueryStats())
+	}
+
+	// assert raw queries are grouped by their SQL
+	for i := 0; i < 3; i++ {
+		if err := ss.db.Exec("SELECT ?", i).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	found = false
+	for _, stats := range ss.QueryStats() {
+		if stats.Family == "raw SELECT ?" {
+			found = stats.Count == 3
+		}
+	}
+	if !found {
+		t.Fatal("raw query family not found", ss.QueryStats())
+	}
+
+	// assert durations are put in the right bucket
+	qs := newQueryStats()
+	qs.record("foo", 3*time.Millisecond, false)
+	qs.record("foo", time.Minute, true)
+	stats := qs.stats()
+	if len(stats) != 1 || stats[0].Errors != 1 || stats[0].Max != time.Minute {
+		t.Fatal("unexpected stats", stats)
+	} else if stats[0].Histogram[1].Count != 1 || stats[0].Histogram[len(queryStatsBuckets)].Count != 1 {
+		t.Fatal("unexpected histogram", stats[0].Histogram)
+	}
+}
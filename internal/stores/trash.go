@@ -0,0 +1,185 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.sia.tech/renterd/api"
+	"gorm.io/gorm"
+)
+
+// trashKeyPrefix is the prefix of the keys of trashed objects. Object keys
+// start with a '/', so trashed objects don't show up in listings.
+const trashKeyPrefix = "trash/"
+
+type (
+	// dbTrashedObject is an object that was moved to the trash, its slabs are
+	// kept until the object is purged.
+	dbTrashedObject struct {
+		Model
+
+		DBObjectID uint     `gorm:"unique;NOT NULL"`
+		DBObject   dbObject `gorm:"constraint:OnDelete:CASCADE"` // CASCADE to remove the entry when the object is deleted
+
+		// Key is the key the object had before it was trashed, it's
+		// restored to that key.
+		Key       string    `gorm:"index;NOT NULL"`
+		ExpiresAt time.Time `gorm:"index;NOT NULL"`
+	}
+)
+
+// TableName implements the gorm.Tabler interface.
+func (dbTrashedObject) TableName() string { return "trashed_objects" }
+
+// trashKey returns the key of the object with the given id and key while it's
+// in the trash.
+func trashKey(id uint, key string) string {
+	return fmt.Sprintf("%s%d%s", trashKeyPrefix, id, key)
+}
+
+// TrashObject moves the object with the given key to the trash, it's purged
+// once the retention period passed. If ifMatch is not empty, the object is
+// only trashed if its ETag matches, see checkIfMatch.
+func (s *SQLStore) TrashObject(ctx context.Context, key, ifMatch string, retention time.Duration) error {
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		if err := checkIfMatch(tx, key, ifMatch); err != nil {
+			return err
+		}
+
+		var obj dbObject
+		err := tx.Where(&dbObject{ObjectID: key}).Take(&obj).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil // nothing to trash
+		} else if err != nil {
+			return err
+		}
+		if err := tx.Model(&obj).Update("object_id", trashKey(obj.ID, key)).Error; err != nil {
+			return err
+		}
+		return tx.Create(&dbTrashedObject{
+			DBObjectID: obj.ID,
+			Key:        key,
+			ExpiresAt:  time.Now().Add(retention).UTC(),
+		}).Error
+	})
+}
+
+// TrashedObjects returns the objects in the trash, oldest first.
+func (s *SQLStore) TrashedObjects(ctx context.Context, offset, limit int) ([]api.TrashedObject, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+
+	var rows []struct {
+		ID        uint
+		Key       string
+		Size      int64
+		TrashedAt datetime
+		ExpiresAt datetime
+	}
+	err := s.db.
+		WithContext(ctx).
+		Model(&dbTrashedObject{}).
+		Select("trashed_objects.id as id, trashed_objects.key as `key`, trashed_objects.created_at as trashed_at, trashed_objects.expires_at as expires_at, COALESCE(SUM(sli.length), 0) + COALESCE(MAX(LENGTH(ps.data)), 0) as size").
+		Joins("LEFT JOIN slices sli ON sli.db_object_id = trashed_objects.db_object_id").
+		Joins("LEFT JOIN partial_slabs ps ON ps.db_object_id = trashed_objects.db_object_id").
+		Group("trashed_objects.id, trashed_objects.key, trashed_objects.created_at, trashed_objects.expires_at").
+		Order("trashed_objects.id ASC").
+		Offset(offset).
+		Limit(limit).
+		Scan(&rows).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]api.TrashedObject, len(rows))
+	for i, row := range rows {
+		objects[i] = api.TrashedObject{
+			ID:        row.ID,
+			Key:       row.Key,
+			Size:      row.Size,
+			TrashedAt: time.Time(row.TrashedAt).UTC(),
+			ExpiresAt: time.Time(row.ExpiresAt).UTC(),
+		}
+	}
+	return objects, nil
+}
+
+// RestoreTrashedObject moves the trashed object with the given id back to the
+// key it had before it was trashed.
+func (s *SQLStore) RestoreTrashedObject(ctx context.Context, id uint) error {
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		var to dbTrashedObject
+		err := tx.Take(&to, id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return api.ErrTrashedObjectNotFound
+		} else if err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&dbObject{}).Where(&dbObject{ObjectID: to.Key}).Count(&count).Error; err != nil {
+			return err
+		} else if count > 0 {
+			return fmt.Errorf("%w: %v", api.ErrObjectExists, to.Key)
+		}
+		if err := tx.Model(&dbObject{}).Where("id", to.DBObjectID).Update("object_id", to.Key).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&to).Error
+	})
+}
+
+// PurgeTrashedObject deletes the trashed object with the given id together with
+// the slabs that aren't referenced by any other object.
+func (s *SQLStore) PurgeTrashedObject(ctx context.Context, id uint) error {
+	return s.retryTransaction(func(tx *gorm.DB) error {
+		var to dbTrashedObject
+		err := tx.Take(&to, id).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return api.ErrTrashedObjectNotFound
+		} else if err != nil {
+			return err
+		}
+		return purgeObject(tx, to.DBObjectID)
+	})
+}
+
+// PurgeTrash deletes the objects in the trash, or only the ones whose retention
+// period passed if expiredOnly is set. It returns the number of purged objects.
+func (s *SQLStore) PurgeTrash(ctx context.Context, expiredOnly bool) (purged int, err error) {
+	err = s.retryTransaction(func(tx *gorm.DB) error {
+		query := tx.Model(&dbTrashedObject{})
+		if expiredOnly {
+			query = query.Where("expires_at <= ?", time.Now().UTC())
+		}
+		var ids []uint
+		if err := query.Pluck("db_object_id", &ids).Error; err != nil {
+			return err
+		}
+		for _, id := range ids {
+			if err := purgeObject(tx, id); err != nil {
+				return err
+			}
+		}
+		purged = len(ids)
+		return nil
+	})
+	return
+}
+
+// purgeObject deletes the object with the given id, its trash entry and the
+// slabs that aren't referenced by any other object.
+func purgeObject(tx *gorm.DB, id uint) error {
+	var slabIDs []uint
+	if err := tx.Model(&dbSlice{}).Where("db_object_id = ?", id).Pluck("db_slab_id", &slabIDs).Error; err != nil {
+		return err
+	}
+	if err := tx.Delete(&dbObject{}, id).Error; err != nil {
+		return err
+	}
+	return pruneSlabs(tx, slabIDs)
+}
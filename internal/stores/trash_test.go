@@ -0,0 +1,137 @@
+package stores
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/object"
+)
+
+// TestTrash verifies trashed objects are hidden from listings, can be restored
+// and keep their slabs until they're purged.
+func TestTrash(t *testing.T) {
+	db, _, _, err := newTestSQLStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	hks, err := db.addTestHosts(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fcids, _, err := db.addTestContracts(hks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	usedContracts := map[types.PublicKey]types.FileContractID{hks[0]: fcids[0]}
+
+	// add two objects
+	addObject := func(key string, root types.Hash256) {
+		t.Helper()
+		obj := object.Object{
+			Key: object.GenerateEncryptionKey(),
+			Slabs: []object.SlabSlice{{
+				Slab:   object.Slab{Key: object.GenerateEncryptionKey(), MinShards: 1, Shards: []object.Sector{{Host: hks[0], Root: root}}},
+				Length: 10,
+			}},
+		}
+		if err := db.UpdateObject(ctx, key, obj, usedContracts, nil, false, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	addObject("/foo", types.Hash256{1})
+	addObject("/bar", types.Hash256{2})
+	assertSlabs := func(n int64) {
+		t.Helper()
+		var count int64
+		if err := db.db.Model(&dbSlab{}).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		} else if count != n {
+			t.Fatalf("unexpected number of slabs, %v != %v", count, n)
+		}
+	}
+
+	// trash both objects, trashing an object that doesn't exist is a no-op
+	for _, key := range []string{"/foo", "/bar", "/baz"} {
+		if err := db.TrashObject(ctx, key, "", time.Hour); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Object(ctx, "/foo"); !errors.Is(err, ErrObjectNotFound) {
+		t.Fatal("unexpected error", err)
+	}
+	if entries, err := db.Objects(ctx, "/", "", -1, 1, 0, -1); err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 0 {
+		t.Fatal("trashed objects shouldn't be listed", entries)
+	}
+	if keys, err := db.SearchObjects(ctx, "foo", -1, 1, 0, -1); err != nil {
+		t.Fatal(err)
+	} else if len(keys) != 0 {
+		t.Fatal("trashed objects shouldn't be found", keys)
+	}
+	assertSlabs(2)
+
+	trashed, err := db.TrashedObjects(ctx, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(trashed) != 2 {
+		t.Fatal("unexpected number of trashed objects", len(trashed))
+	} else if trashed[0].Key != "/foo" || trashed[0].Size != 10 || trashed[1].Key != "/bar" {
+		t.Fatal("unexpected trashed objects", trashed)
+	} else if expiry := trashed[0].ExpiresAt.Sub(trashed[0].TrashedAt); expiry < time.Hour-time.Second || expiry > time.Hour+time.Second {
+		t.Fatal("unexpected expiry", expiry)
+	}
+
+	// restoring 'foo' fails while another object is stored under its key
+	addObject("/foo", types.Hash256{3})
+	if err := db.RestoreTrashedObject(ctx, trashed[0].ID); !errors.Is(err, api.ErrObjectExists) {
+		t.Fatal("unexpected error", err)
+	}
+	if err := db.RemoveObject(ctx, "/foo", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RestoreTrashedObject(ctx, trashed[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Object(ctx, "/foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.RestoreTrashedObject(ctx, trashed[0].ID); !errors.Is(err, api.ErrTrashedObjectNotFound) {
+		t.Fatal("unexpected error", err)
+	}
+
+	// nothing expired yet
+	if purged, err := db.PurgeTrash(ctx, true); err != nil {
+		t.Fatal(err)
+	} else if purged != 0 {
+		t.Fatal("unexpected number of purged objects", purged)
+	}
+
+	// purge 'bar', its slab is removed
+	if err := db.PurgeTrashedObject(ctx, trashed[1].ID); err != nil {
+		t.Fatal(err)
+	}
+	assertSlabs(1)
+	if trashed, err := db.TrashedObjects(ctx, 0, -1); err != nil {
+		t.Fatal(err)
+	} else if len(trashed) != 0 {
+		t.Fatal("unexpected number of trashed objects", len(trashed))
+	}
+
+	// trash 'foo' again without a retention period, it's purged right away
+	if err := db.TrashObject(ctx, "/foo", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	if purged, err := db.PurgeTrash(ctx, true); err != nil {
+		t.Fatal(err)
+	} else if purged != 1 {
+		t.Fatal("unexpected number of purged objects", purged)
+	}
+	assertSlabs(0)
+}
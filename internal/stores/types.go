@@ -6,10 +6,13 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"strings"
+	"time"
 
 	rhpv2 "go.sia.tech/core/rhp/v2"
 	rhpv3 "go.sia.tech/core/rhp/v3"
 	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/hostdb"
 )
 
 var zeroCurrency = currency(types.ZeroCurrency)
@@ -20,7 +23,9 @@ type (
 	publicKey      types.PublicKey
 	hostSettings   rhpv2.HostSettings
 	hostPriceTable rhpv3.HostPriceTable
+	externalData   hostdb.ExternalData
 	balance        big.Int
+	datetime       time.Time
 )
 
 // GormDataType implements gorm.GormDataTypeInterface.
@@ -114,6 +119,37 @@ func (hs hostSettings) Value() (driver.Value, error) {
 	return json.Marshal(hs)
 }
 
+func (externalData) GormDataType() string {
+	return "string"
+}
+
+// Scan scan value into externalData, implements sql.Scanner interface. Hosts
+// no provider reported data for have no external data.
+func (ed *externalData) Scan(value interface{}) error {
+	if value == nil {
+		*ed = externalData{}
+		return nil
+	}
+	var bytes []byte
+	switch value := value.(type) {
+	case []byte:
+		bytes = value
+	case string:
+		bytes = []byte(value)
+	default:
+		return errors.New(fmt.Sprint("failed to unmarshal externalData value:", value))
+	}
+	return json.Unmarshal(bytes, ed)
+}
+
+// Value returns an externalData value, implements driver.Valuer interface.
+func (ed externalData) Value() (driver.Value, error) {
+	if ed.Provider == "" {
+		return nil, nil
+	}
+	return json.Marshal(ed)
+}
+
 func (hs hostPriceTable) GormDataType() string {
 	return "string"
 }
@@ -157,3 +193,41 @@ func (hs *balance) Scan(value interface{}) error {
 func (hs balance) Value() (driver.Value, error) {
 	return (*big.Int)(&hs).String(), nil
 }
+
+// datetimeLayouts are the layouts SQLite uses to store times, aggregates
+// of time columns are returned as text rather than times.
+var datetimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// Scan scan value into datetime, implements sql.Scanner interface.
+func (dt *datetime) Scan(value interface{}) error {
+	var s string
+	switch value := value.(type) {
+	case time.Time:
+		*dt = datetime(value)
+		return nil
+	case nil:
+		*dt = datetime{}
+		return nil
+	case string:
+		s = value
+	case []byte:
+		s = string(value)
+	default:
+		return fmt.Errorf("failed to unmarshal datetime value: %v %T", value, value)
+	}
+	s = strings.TrimSuffix(s, "Z")
+	for _, layout := range datetimeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			*dt = datetime(t)
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to parse datetime value: %v", s)
+}
@@ -3,6 +3,7 @@ package stores
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"log"
 	"os"
 	"path/filepath"
@@ -13,16 +14,24 @@ import (
 	"go.sia.tech/core/types"
 	"go.sia.tech/renterd/wallet"
 	"go.sia.tech/siad/modules"
+	"go.uber.org/zap"
 )
 
 // EphemeralWalletStore implements wallet.SingleAddressStore in memory.
 type EphemeralWalletStore struct {
 	tip     types.ChainIndex
 	ccid    modules.ConsensusChangeID
-	addr    types.Address
+	addrs   []types.Address
+	owned   map[types.Address]bool
 	scElems []wallet.SiacoinElement
 	txns    []wallet.Transaction
 	mu      sync.Mutex
+
+	// scanHeight is the height below which blocks are ignored, it's set when
+	// the wallet is rescanned. The outputs created below that height are
+	// kept across the rescan.
+	scanHeight uint64
+	kept       map[types.Hash256]bool
 }
 
 // Balance implements wallet.SingleAddressStore.
@@ -49,6 +58,55 @@ func (s *EphemeralWalletStore) UnspentSiacoinElements() ([]wallet.SiacoinElement
 	return elems, nil
 }
 
+// Addresses implements wallet.SingleAddressStore.
+func (s *EphemeralWalletStore) Addresses() []types.Address {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]types.Address(nil), s.addrs...)
+}
+
+// AddAddress implements wallet.SingleAddressStore.
+func (s *EphemeralWalletStore) AddAddress(addr types.Address) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.owned[addr] {
+		s.addrs = append(s.addrs, addr)
+		s.owned[addr] = true
+	}
+	return nil
+}
+
+// Rescan implements wallet.SingleAddressStore. It resets the state of the
+// store, the caller is expected to replay the consensus changes. Outputs and
+// transactions in blocks below fromHeight are ignored by the replay, the ones
+// the store already knows about are kept.
+func (s *EphemeralWalletStore) Rescan(fromHeight uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tip = types.ChainIndex{}
+	s.ccid = modules.ConsensusChangeBeginning
+	s.scanHeight = fromHeight
+
+	var elems []wallet.SiacoinElement
+	s.kept = make(map[types.Hash256]bool)
+	for _, sce := range s.scElems {
+		if sce.ConfirmationHeight > 0 && sce.ConfirmationHeight < fromHeight {
+			elems = append(elems, sce)
+			s.kept[sce.ID] = true
+		}
+	}
+	s.scElems = elems
+
+	var txns []wallet.Transaction
+	for _, txn := range s.txns {
+		if txn.Index.Height < fromHeight {
+			txns = append(txns, txn)
+		}
+	}
+	s.txns = txns
+	return nil
+}
+
 // Transactions implements wallet.SingleAddressStore.
 func (s *EphemeralWalletStore) Transactions(since time.Time, max int) ([]wallet.Transaction, error) {
 	s.mu.Lock()
@@ -64,50 +122,50 @@ func (s *EphemeralWalletStore) Transactions(since time.Time, max int) ([]wallet.
 	return txns, nil
 }
 
-func transactionIsRelevant(txn types.Transaction, addr types.Address) bool {
+func transactionIsRelevant(txn types.Transaction, owned map[types.Address]bool) bool {
 	for i := range txn.SiacoinInputs {
-		if txn.SiacoinInputs[i].UnlockConditions.UnlockHash() == addr {
+		if owned[txn.SiacoinInputs[i].UnlockConditions.UnlockHash()] {
 			return true
 		}
 	}
 	for i := range txn.SiacoinOutputs {
-		if txn.SiacoinOutputs[i].Address == addr {
+		if owned[txn.SiacoinOutputs[i].Address] {
 			return true
 		}
 	}
 	for i := range txn.SiafundInputs {
-		if txn.SiafundInputs[i].UnlockConditions.UnlockHash() == addr {
+		if owned[txn.SiafundInputs[i].UnlockConditions.UnlockHash()] {
 			return true
 		}
-		if txn.SiafundInputs[i].ClaimAddress == addr {
+		if owned[txn.SiafundInputs[i].ClaimAddress] {
 			return true
 		}
 	}
 	for i := range txn.SiafundOutputs {
-		if txn.SiafundOutputs[i].Address == addr {
+		if owned[txn.SiafundOutputs[i].Address] {
 			return true
 		}
 	}
 	for i := range txn.FileContracts {
 		for _, sco := range txn.FileContracts[i].ValidProofOutputs {
-			if sco.Address == addr {
+			if owned[sco.Address] {
 				return true
 			}
 		}
 		for _, sco := range txn.FileContracts[i].MissedProofOutputs {
-			if sco.Address == addr {
+			if owned[sco.Address] {
 				return true
 			}
 		}
 	}
 	for i := range txn.FileContractRevisions {
 		for _, sco := range txn.FileContractRevisions[i].ValidProofOutputs {
-			if sco.Address == addr {
+			if owned[sco.Address] {
 				return true
 			}
 		}
 		for _, sco := range txn.FileContractRevisions[i].MissedProofOutputs {
-			if sco.Address == addr {
+			if owned[sco.Address] {
 				return true
 			}
 		}
@@ -130,17 +188,36 @@ func (s *EphemeralWalletStore) ProcessConsensusChange(cc modules.ConsensusChange
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	// map created outputs to the height of the block that created them
+	confirmed := make(map[types.Hash256]uint64)
+	for i, diffs := range cc.AppliedDiffs {
+		height := uint64(cc.BlockHeight) + uint64(i) + 1 - uint64(len(cc.AppliedDiffs))
+		for _, diff := range diffs.SiacoinOutputDiffs {
+			if diff.Direction == modules.DiffApply {
+				confirmed[types.Hash256(diff.ID)] = height
+			}
+		}
+	}
+
 	for _, diff := range cc.SiacoinOutputDiffs {
 		var sco types.SiacoinOutput
 		convertToCore(diff.SiacoinOutput, &sco)
-		if sco.Address != s.addr {
+		if !s.owned[sco.Address] {
 			continue
 		}
 		if diff.Direction == modules.DiffApply {
+			// ignore outputs created below the scan height and the ones
+			// kept across a rescan
+			if height, ok := confirmed[types.Hash256(diff.ID)]; ok && height < s.scanHeight {
+				continue
+			} else if s.kept[types.Hash256(diff.ID)] {
+				continue
+			}
 			// add
 			s.scElems = append(s.scElems, wallet.SiacoinElement{
-				SiacoinOutput: sco,
-				ID:            types.Hash256(diff.ID),
+				SiacoinOutput:      sco,
+				ID:                 types.Hash256(diff.ID),
+				ConfirmationHeight: confirmed[types.Hash256(diff.ID)],
 			})
 		} else {
 			// remove
@@ -154,29 +231,37 @@ func (s *EphemeralWalletStore) ProcessConsensusChange(cc modules.ConsensusChange
 		}
 	}
 
-	for _, block := range cc.RevertedBlocks {
+	for i, block := range cc.RevertedBlocks {
+		height := uint64(cc.BlockHeight) - uint64(len(cc.AppliedBlocks)) + uint64(len(cc.RevertedBlocks)-i)
+		if height < s.scanHeight {
+			continue
+		}
 		for _, stxn := range block.Transactions {
 			var txn types.Transaction
 			convertToCore(stxn, &txn)
-			if transactionIsRelevant(txn, s.addr) {
+			if transactionIsRelevant(txn, s.owned) && len(s.txns) > 0 {
 				s.txns = s.txns[:len(s.txns)-1]
 			}
 		}
 	}
 
-	for _, block := range cc.AppliedBlocks {
+	for i, block := range cc.AppliedBlocks {
+		height := uint64(cc.BlockHeight) + uint64(i) + 1 - uint64(len(cc.AppliedBlocks))
+		if height < s.scanHeight {
+			continue
+		}
 		for _, stxn := range block.Transactions {
 			var txn types.Transaction
 			convertToCore(stxn, &txn)
-			if transactionIsRelevant(txn, s.addr) {
+			if transactionIsRelevant(txn, s.owned) {
 				var inflow, outflow types.Currency
 				for _, out := range txn.SiacoinOutputs {
-					if out.Address == s.addr {
+					if s.owned[out.Address] {
 						inflow = inflow.Add(out.Value)
 					}
 				}
 				for _, in := range txn.SiacoinInputs {
-					if in.UnlockConditions.UnlockHash() == s.addr {
+					if s.owned[in.UnlockConditions.UnlockHash()] {
 						inputValue := types.ZeroCurrency // V2: use in.Parent.value
 						outflow = outflow.Add(inputValue)
 					}
@@ -184,7 +269,7 @@ func (s *EphemeralWalletStore) ProcessConsensusChange(cc modules.ConsensusChange
 
 				s.txns = append(s.txns, wallet.Transaction{
 					Raw:       txn,
-					Index:     s.tip,
+					Index:     types.ChainIndex{Height: height, ID: types.BlockID(block.ID())},
 					Inflow:    inflow,
 					Outflow:   outflow,
 					ID:        txn.ID(),
@@ -199,23 +284,41 @@ func (s *EphemeralWalletStore) ProcessConsensusChange(cc modules.ConsensusChange
 	s.ccid = cc.ID
 }
 
-// NewEphemeralWalletStore returns a new EphemeralWalletStore.
+// NewEphemeralWalletStore returns a new EphemeralWalletStore that tracks the
+// given primary address.
 func NewEphemeralWalletStore(addr types.Address) *EphemeralWalletStore {
 	return &EphemeralWalletStore{
-		addr: addr,
+		addrs: []types.Address{addr},
+		owned: map[types.Address]bool{addr: true},
 	}
 }
 
+// A ConsensusSet feeds consensus changes to its subscribers, it's implemented
+// by siad's consensus set and by consensus sets that follow a remote chain.
+type ConsensusSet interface {
+	ConsensusSetSubscribe(modules.ConsensusSetSubscriber, modules.ConsensusChangeID, <-chan struct{}) error
+	Unsubscribe(modules.ConsensusSetSubscriber)
+}
+
 // JSONWalletStore implements wallet.SingleAddressStore in memory, backed by a JSON file.
 type JSONWalletStore struct {
 	*EphemeralWalletStore
+	cs       ConsensusSet
 	dir      string
 	lastSave time.Time
+	logger   *zap.SugaredLogger
+
+	// rescanning is set while the store replays the consensus changes after
+	// a rescan, it's protected by the embedded store's mutex
+	rescanning bool
 }
 
 type jsonWalletPersistData struct {
 	Tip             types.ChainIndex
 	CCID            modules.ConsensusChangeID
+	ScanHeight      uint64
+	Kept            []types.Hash256
+	Addresses       []types.Address
 	SiacoinElements []wallet.SiacoinElement
 	Transactions    []wallet.Transaction
 }
@@ -223,9 +326,16 @@ type jsonWalletPersistData struct {
 func (s *JSONWalletStore) save() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	kept := make([]types.Hash256, 0, len(s.kept))
+	for id := range s.kept {
+		kept = append(kept, id)
+	}
 	js, _ := json.MarshalIndent(jsonWalletPersistData{
 		Tip:             s.tip,
 		CCID:            s.ccid,
+		ScanHeight:      s.scanHeight,
+		Kept:            kept,
+		Addresses:       s.addrs,
 		SiacoinElements: s.scElems,
 		Transactions:    s.txns,
 	}, "", "  ")
@@ -260,13 +370,91 @@ func (s *JSONWalletStore) load() (modules.ConsensusChangeID, error) {
 	} else if err := json.Unmarshal(js, &p); err != nil {
 		return modules.ConsensusChangeID{}, err
 	}
+
+	// start from scratch if the state belongs to another wallet, e.g. after
+	// a seed was imported
+	if len(p.Addresses) > 0 && p.Addresses[0] != s.addrs[0] {
+		s.ccid = modules.ConsensusChangeBeginning
+		return s.ccid, nil
+	}
 	s.tip = p.Tip
 	s.ccid = p.CCID
+	s.scanHeight = p.ScanHeight
+	if len(p.Kept) > 0 {
+		s.kept = make(map[types.Hash256]bool)
+		for _, id := range p.Kept {
+			s.kept[id] = true
+		}
+	}
+	for _, addr := range p.Addresses {
+		if !s.owned[addr] {
+			s.addrs = append(s.addrs, addr)
+			s.owned[addr] = true
+		}
+	}
 	s.scElems = p.SiacoinElements
 	s.txns = p.Transactions
 	return s.ccid, nil
 }
 
+// AddAddress implements wallet.SingleAddressStore. The address is persisted
+// right away to make sure outputs sent to it are never missed.
+func (s *JSONWalletStore) AddAddress(addr types.Address) error {
+	if err := s.EphemeralWalletStore.AddAddress(addr); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+// Subscribe subscribes the store to the given consensus set, starting at the
+// given consensus change.
+func (s *JSONWalletStore) Subscribe(cs ConsensusSet, ccid modules.ConsensusChangeID) error {
+	s.cs = cs
+	return cs.ConsensusSetSubscribe(s, ccid, nil)
+}
+
+// Rescan implements wallet.SingleAddressStore. It resets the state of the
+// store and replays all consensus changes in the background. Only one rescan
+// runs at a time, the store is unsubscribed before its state is reset so no
+// consensus change is processed concurrently.
+func (s *JSONWalletStore) Rescan(fromHeight uint64) error {
+	if s.cs == nil {
+		return errors.New("wallet store isn't subscribed to the consensus set")
+	}
+	s.mu.Lock()
+	if s.rescanning {
+		s.mu.Unlock()
+		return wallet.ErrRescanInProgress
+	}
+	s.rescanning = true
+	s.mu.Unlock()
+	done := func() {
+		s.mu.Lock()
+		s.rescanning = false
+		s.mu.Unlock()
+	}
+
+	// Unsubscribe blocks until the consensus change that's being processed,
+	// if any, was processed
+	s.cs.Unsubscribe(s)
+	if err := s.EphemeralWalletStore.Rescan(fromHeight); err != nil {
+		done()
+		return err
+	} else if err := s.save(); err != nil {
+		done()
+		return err
+	}
+	go func() {
+		defer done()
+		if err := s.cs.ConsensusSetSubscribe(s, modules.ConsensusChangeBeginning, nil); err != nil {
+			s.logger.Errorw("failed to resubscribe wallet store after rescan", "error", err)
+		} else if err := s.save(); err != nil {
+			s.logger.Errorw("failed to save wallet state after rescan", "error", err)
+		}
+	}()
+	return nil
+}
+
 // ProcessConsensusChange implements chain.Subscriber.
 func (s *JSONWalletStore) ProcessConsensusChange(cc modules.ConsensusChange) {
 	s.EphemeralWalletStore.ProcessConsensusChange(cc)
@@ -279,11 +467,12 @@ func (s *JSONWalletStore) ProcessConsensusChange(cc modules.ConsensusChange) {
 }
 
 // NewJSONWalletStore returns a new JSONWalletStore.
-func NewJSONWalletStore(dir string, addr types.Address) (*JSONWalletStore, modules.ConsensusChangeID, error) {
+func NewJSONWalletStore(dir string, addr types.Address, l *zap.Logger) (*JSONWalletStore, modules.ConsensusChangeID, error) {
 	s := &JSONWalletStore{
 		EphemeralWalletStore: NewEphemeralWalletStore(addr),
 		dir:                  dir,
 		lastSave:             time.Now(),
+		logger:               l.Named("walletstore").Sugar(),
 	}
 	ccid, err := s.load()
 	if err != nil {
@@ -0,0 +1,146 @@
+package stores
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/wallet"
+	"go.sia.tech/siad/modules"
+	stypes "go.sia.tech/siad/types"
+	"go.uber.org/zap"
+)
+
+// TestWalletStoreRescan verifies a rescanned wallet store keeps the outputs
+// created below the scan height and rebuilds the others.
+func TestWalletStoreRescan(t *testing.T) {
+	addr := types.Address{1}
+	s := NewEphemeralWalletStore(addr)
+
+	// build a consensus change that applies three blocks, each creating an
+	// output for the wallet
+	cc := modules.ConsensusChange{BlockHeight: 3}
+	for i := 1; i <= 3; i++ {
+		diff := modules.SiacoinOutputDiff{
+			Direction:     modules.DiffApply,
+			ID:            stypes.SiacoinOutputID{byte(i)},
+			SiacoinOutput: stypes.SiacoinOutput{Value: stypes.NewCurrency64(uint64(i)), UnlockHash: stypes.UnlockHash(addr)},
+		}
+		cc.AppliedBlocks = append(cc.AppliedBlocks, stypes.Block{Timestamp: stypes.Timestamp(i)})
+		cc.AppliedDiffs = append(cc.AppliedDiffs, modules.ConsensusChangeDiffs{SiacoinOutputDiffs: []modules.SiacoinOutputDiff{diff}})
+		cc.SiacoinOutputDiffs = append(cc.SiacoinOutputDiffs, diff)
+	}
+
+	s.ProcessConsensusChange(cc)
+	if elems, _ := s.UnspentSiacoinElements(); len(elems) != 3 {
+		t.Fatal("unexpected outputs", len(elems))
+	} else if elems[0].ConfirmationHeight != 1 || elems[2].ConfirmationHeight != 3 {
+		t.Fatal("unexpected confirmation heights", elems[0].ConfirmationHeight, elems[2].ConfirmationHeight)
+	}
+
+	// rescan from height 2, the first output is kept
+	if err := s.Rescan(2); err != nil {
+		t.Fatal(err)
+	} else if elems, _ := s.UnspentSiacoinElements(); len(elems) != 1 {
+		t.Fatal("expected state to be reset", len(elems))
+	} else if elems[0].ConfirmationHeight != 1 {
+		t.Fatal("unexpected confirmation height", elems[0].ConfirmationHeight)
+	}
+
+	// replaying the change restores the other outputs without duplicating
+	// the kept one
+	s.ProcessConsensusChange(cc)
+	if elems, _ := s.UnspentSiacoinElements(); len(elems) != 3 {
+		t.Fatal("unexpected outputs", len(elems))
+	} else if s.Balance().Cmp(types.NewCurrency64(6)) != 0 {
+		t.Fatal("unexpected balance", s.Balance())
+	}
+}
+
+// TestJSONWalletStoreOtherWallet verifies the persisted state is discarded if
+// it belongs to another wallet.
+func TestJSONWalletStoreOtherWallet(t *testing.T) {
+	dir := t.TempDir()
+	s, _, err := NewJSONWalletStore(dir, types.Address{1}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	} else if err := s.AddAddress(types.Address{2}); err != nil {
+		t.Fatal(err)
+	}
+
+	// reload the store for the same wallet
+	s, ccid, err := NewJSONWalletStore(dir, types.Address{1}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	} else if len(s.Addresses()) != 2 {
+		t.Fatal("unexpected addresses", s.Addresses())
+	}
+
+	// load the store for another wallet
+	s, ccid, err = NewJSONWalletStore(dir, types.Address{3}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	} else if addrs := s.Addresses(); len(addrs) != 1 || addrs[0] != (types.Address{3}) {
+		t.Fatal("unexpected addresses", addrs)
+	} else if ccid != modules.ConsensusChangeBeginning {
+		t.Fatal("expected the store to start from scratch")
+	}
+}
+
+// TestJSONWalletStoreRescanInProgress verifies a rescan is refused while the
+// previous rescan is still replaying the consensus changes.
+func TestJSONWalletStoreRescanInProgress(t *testing.T) {
+	s, _, err := NewJSONWalletStore(t.TempDir(), types.Address{1}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs := &blockingConsensusSet{subscribed: make(chan struct{}), unblock: make(chan struct{})}
+	s.cs = cs
+
+	if err := s.Rescan(0); err != nil {
+		t.Fatal(err)
+	}
+	<-cs.subscribed
+	if err := s.Rescan(0); err != wallet.ErrRescanInProgress {
+		t.Fatal("unexpected error", err)
+	}
+
+	// once the replay finished, the store can be rescanned again
+	close(cs.unblock)
+	for i := 0; ; i++ {
+		if err := s.Rescan(0); err == nil {
+			break
+		} else if err != wallet.ErrRescanInProgress || i == 100 {
+			t.Fatal("unexpected error", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// wait for the last rescan to finish before the store's dir is removed
+	for {
+		s.mu.Lock()
+		rescanning := s.rescanning
+		s.mu.Unlock()
+		if !rescanning {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// blockingConsensusSet is a consensus set whose subscriptions block until
+// they're unblocked.
+type blockingConsensusSet struct {
+	subscribed chan struct{}
+	unblock    chan struct{}
+	once       sync.Once
+}
+
+func (cs *blockingConsensusSet) ConsensusSetSubscribe(modules.ConsensusSetSubscriber, modules.ConsensusChangeID, <-chan struct{}) error {
+	cs.once.Do(func() { close(cs.subscribed) })
+	<-cs.unblock
+	return nil
+}
+
+func (cs *blockingConsensusSet) Unsubscribe(modules.ConsensusSetSubscriber) {}
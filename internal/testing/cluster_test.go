@@ -9,6 +9,7 @@ import (
 	"math/big"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -17,6 +18,7 @@ import (
 	"go.sia.tech/core/types"
 	"go.sia.tech/renterd/api"
 	"go.sia.tech/renterd/object"
+	"go.sia.tech/renterd/wallet"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"lukechampine.com/frand"
@@ -55,7 +57,7 @@ func TestNewTestCluster(t *testing.T) {
 				Length: 0,
 			},
 		},
-	}, map[types.PublicKey]types.FileContractID{})
+	}, map[types.PublicKey]types.FileContractID{}, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -237,7 +239,7 @@ func TestUploadDownload(t *testing.T) {
 			}
 			var found bool
 			for _, entry := range entries {
-				if entry == fmt.Sprintf("/%s", name) {
+				if entry.Name == fmt.Sprintf("/%s", name) {
 					found = true
 					break
 				}
@@ -339,6 +341,124 @@ func TestUploadDownload(t *testing.T) {
 	}
 }
 
+// TestUploadOverwrite verifies overwriting a path after its object was moved
+// to the trash or renamed stores the new data instead of linking the slabs of
+// the previous upload.
+func TestUploadOverwrite(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	cluster, err := newTestCluster(t.TempDir(), newTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := cluster.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	b := cluster.Bus
+	w := cluster.Worker
+	ctx := context.Background()
+
+	if _, err := cluster.AddHostsBlocking(int(testRedundancySettings.TotalShards)); err != nil {
+		t.Fatal(err)
+	} else if err := b.UpdateTrashSettings(ctx, api.TrashSettings{Enabled: true, Retention: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	upload := func(path string) []byte {
+		t.Helper()
+		data := frand.Bytes(rhpv2.SectorSize)
+		if err := w.UploadObject(ctx, bytes.NewReader(data), path); err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	assertData := func(path string, data []byte) {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := w.DownloadObject(ctx, &buf, path); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(buf.Bytes(), data) {
+			t.Fatalf("unexpected data for %v", path)
+		}
+	}
+
+	// move an object to the trash and upload to its path again
+	upload("dir/foo")
+	if err := w.DeleteObject(ctx, "dir/foo"); err != nil {
+		t.Fatal(err)
+	}
+	data := upload("dir/foo")
+	assertData("dir/foo", data)
+
+	// rename the object and upload to its path again
+	if _, err := b.RenameObjects(ctx, "/dir/", "/moved/"); err != nil {
+		t.Fatal(err)
+	}
+	overwritten := upload("dir/foo")
+	assertData("dir/foo", overwritten)
+	assertData("moved/foo", data)
+}
+
+// TestUploadPassphrase verifies the keys of an object uploaded with a
+// passphrase and the keys of its slabs are wrapped, and that the object can only
+// be downloaded with the passphrase.
+func TestUploadPassphrase(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	cluster, err := newTestCluster(t.TempDir(), newTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := cluster.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	w := cluster.Worker
+	ctx := context.Background()
+
+	if _, err := cluster.AddHostsBlocking(int(testRedundancySettings.TotalShards)); err != nil {
+		t.Fatal(err)
+	}
+	data := frand.Bytes(rhpv2.SectorSize * 2)
+	if err := w.UploadObjectWithPassphrase(ctx, bytes.NewReader(data), "foo", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	// assert the keys are wrapped
+	o, _, err := cluster.Bus.Object(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	} else if o.Wrap == nil || len(o.Slabs) == 0 {
+		t.Fatal("expected wrapped object with slabs")
+	}
+	for _, s := range o.Slabs {
+		if !s.Wrapped {
+			t.Fatal("expected slab key to be wrapped")
+		}
+	}
+
+	// assert the object can only be downloaded with the passphrase
+	var buf bytes.Buffer
+	if err := w.DownloadObject(ctx, &buf, "foo"); err == nil {
+		t.Fatal("expected error")
+	} else if err := w.DownloadObjectWithPassphrase(ctx, &buf, "foo", "wrong"); err == nil {
+		t.Fatal("expected error")
+	}
+	buf.Reset()
+	if err := w.DownloadObjectWithPassphrase(ctx, &buf, "foo", "secret"); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("unexpected data")
+	}
+}
+
 // TestEphemeralAccounts tests the use of ephemeral accounts.
 func TestEphemeralAccounts(t *testing.T) {
 	if testing.Short() {
@@ -507,3 +627,185 @@ func newTestLogger() *zap.Logger {
 		zap.AddStacktrace(zapcore.ErrorLevel),
 	)
 }
+
+// TestGarbageCollection verifies the sectors of a deleted object are deleted
+// from the hosts once the bus collected its garbage.
+func TestGarbageCollection(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	cluster, err := newTestCluster(t.TempDir(), newTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := cluster.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	b := cluster.Bus
+	w := cluster.Worker
+	ctx := context.Background()
+
+	if _, err := cluster.AddHostsBlocking(int(testRedundancySettings.TotalShards)); err != nil {
+		t.Fatal(err)
+	}
+
+	// upload an object and remember its roots
+	data := frand.Bytes(int(testRedundancySettings.MinShards) * rhpv2.SectorSize)
+	if err := w.UploadObject(ctx, bytes.NewReader(data), "foo"); err != nil {
+		t.Fatal(err)
+	}
+	obj, _, err := b.Object(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted := make(map[types.Hash256]struct{})
+	for _, slab := range obj.Slabs {
+		for _, shard := range slab.Shards {
+			deleted[shard.Root] = struct{}{}
+		}
+	}
+
+	// delete the object, collect the garbage and delete the orphaned sectors
+	// from the hosts, the autopilot might have done so already
+	if err := w.DeleteObject(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	} else if _, _, err := b.Object(ctx, "foo"); err == nil {
+		t.Fatal("expected object to be deleted")
+	} else if _, err := b.CollectGarbage(ctx); err != nil {
+		t.Fatal(err)
+	} else if resp, err := w.DeleteOrphanedSectors(ctx, 0); err != nil {
+		t.Fatal(err)
+	} else if len(resp.Errors) > 0 {
+		t.Fatal("unexpected errors", resp.Errors)
+	}
+
+	// assert the hosts no longer store the sectors
+	contracts, err := b.ActiveContracts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range contracts {
+		resp, err := w.RHPContractRoots(ctx, c.ID, c.HostKey, c.HostIP)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, root := range resp.Roots {
+			if _, ok := deleted[root]; ok {
+				t.Fatalf("sector %v wasn't deleted from host %v", root, c.HostKey)
+			}
+		}
+	}
+}
+
+// TestReshardObject verifies an object is converted to the current redundancy
+// settings and keeps its ETag.
+func TestReshardObject(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	cluster, err := newTestCluster(t.TempDir(), newTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := cluster.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	b := cluster.Bus
+	w := cluster.Worker
+	ctx := context.Background()
+
+	// add enough hosts for the new redundancy, its expansion factor has to be
+	// low enough to pass the gouging checks
+	rs := api.RedundancySettings{MinShards: 3, TotalShards: 5}
+	if _, err := cluster.AddHostsBlocking(rs.TotalShards); err != nil {
+		t.Fatal(err)
+	}
+
+	data := frand.Bytes(int(testRedundancySettings.MinShards) * rhpv2.SectorSize)
+	if err := w.UploadObject(ctx, bytes.NewReader(data), "foo"); err != nil {
+		t.Fatal(err)
+	}
+	before, _, err := b.Object(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// change the redundancy and reshard the object
+	if err := b.UpdateRedundancySettings(ctx, rs); err != nil {
+		t.Fatal(err)
+	} else if err := w.ReshardObject(ctx, "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	after, _, err := b.Object(ctx, "foo")
+	if err != nil {
+		t.Fatal(err)
+	} else if after.ETag != before.ETag {
+		t.Fatal("ETag changed", before.ETag, after.ETag)
+	}
+	for _, slab := range after.Slabs {
+		if int(slab.MinShards) != rs.MinShards || len(slab.Shards) != rs.TotalShards {
+			t.Fatal("unexpected redundancy", slab.MinShards, len(slab.Shards))
+		}
+	}
+	var buf bytes.Buffer
+	if err := w.DownloadObject(ctx, &buf, "foo"); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("unexpected data")
+	}
+}
+
+// TestWalletSeedImportConflict verifies the seed of another wallet can only be
+// imported as long as the bus has no contracts or objects, whose keys are
+// derived from the current seed.
+func TestWalletSeedImportConflict(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	cluster, err := newTestCluster(t.TempDir(), newTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := cluster.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	b := cluster.Bus
+	ctx := context.Background()
+
+	// back up the seed of another wallet
+	phrase := wallet.NewSeedPhrase()
+	key, err := wallet.KeyFromPhrase(phrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backup := api.WalletSeedBackup{
+		Version:       api.WalletSeedVersion,
+		EncryptedSeed: wallet.EncryptSeedPhrase(phrase, "export"),
+		Address:       wallet.StandardAddress(key.PublicKey()),
+		Addresses:     1,
+	}
+
+	// the bus has no contracts or objects yet, so the seed is imported
+	if resp, err := b.WalletSeedImport(ctx, backup, "export", "passphrase"); err != nil {
+		t.Fatal(err)
+	} else if !resp.RestartRequired {
+		t.Fatal("expected a restart to be required")
+	}
+
+	// once there's an object, importing the seed is refused
+	if err := b.AddObject(ctx, "foo", object.Object{Key: object.GenerateEncryptionKey()}, nil, nil); err != nil {
+		t.Fatal(err)
+	} else if _, err := b.WalletSeedImport(ctx, backup, "export", "passphrase"); err == nil || !strings.Contains(err.Error(), "can't import the seed of another wallet") {
+		t.Fatal("unexpected error", err)
+	}
+}
@@ -0,0 +1,197 @@
+package testing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/internal/recovery"
+	"go.sia.tech/renterd/internal/stores"
+	glogger "gorm.io/gorm/logger"
+	"lukechampine.com/frand"
+)
+
+// TestRecoverContracts verifies the contracts of a renter and the roots of
+// their sectors can be recovered from the hosts into a fresh database.
+func TestRecoverContracts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	cluster, err := newTestCluster(t.TempDir(), newTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := cluster.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	b := cluster.Bus
+	w := cluster.Worker
+	ctx := context.Background()
+
+	// add hosts and upload an object
+	if _, err := cluster.AddHostsBlocking(int(testRedundancySettings.TotalShards)); err != nil {
+		t.Fatal(err)
+	} else if err := w.UploadObject(ctx, bytes.NewReader(frand.Bytes(rhpv2.SectorSize)), "foo"); err != nil {
+		t.Fatal(err)
+	}
+
+	// recover the contracts into a fresh database
+	contracts, err := b.ActiveContracts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, _, err := stores.NewSQLStore(stores.NewEphemeralSQLiteConnection(t.Name()), true, 0, nil, glogger.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	report, err := recovery.Recover(ctx, w, db, contracts, 2)
+	if err != nil {
+		t.Fatal(err)
+	} else if report.Recovered != len(contracts) {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	// assert the recovered contracts and their roots match the original
+	// ones
+	for _, c := range contracts {
+		recovered, err := db.Contract(ctx, c.ID)
+		if err != nil {
+			t.Fatal(err)
+		} else if recovered.HostKey != c.HostKey || recovered.HostIP != c.HostIP || recovered.WindowStart != c.WindowStart || recovered.WindowEnd != c.WindowEnd {
+			t.Fatal("unexpected contract", recovered)
+		}
+
+		roots, err := b.ContractRoots(ctx, c.ID)
+		if err != nil {
+			t.Fatal(err)
+		} else if len(roots) == 0 {
+			t.Fatal("expected roots")
+		}
+		recoveredRoots, err := db.ContractRoots(ctx, c.ID)
+		if err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(recoveredRoots, roots) {
+			t.Fatal("unexpected roots", recoveredRoots)
+		}
+	}
+}
+
+// TestRescanContracts verifies contracts that were lost by the bus are found
+// again by rescanning the blockchain for the renter's keys.
+func TestRescanContracts(t *testing.T) {
+	if testing.Short() {
+		t.SkipNow()
+	}
+
+	cluster, err := newTestCluster(t.TempDir(), newTestLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := cluster.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	b := cluster.Bus
+	w := cluster.Worker
+	ctx := context.Background()
+
+	// add hosts, mine a block to confirm their contracts and delete the
+	// contracts from the bus
+	if _, err := cluster.AddHostsBlocking(2); err != nil {
+		t.Fatal(err)
+	} else if err := cluster.MineBlocks(1); err != nil {
+		t.Fatal(err)
+	}
+	contracts, err := b.ActiveContracts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(contracts) != 2 {
+		t.Fatal("unexpected number of contracts", len(contracts))
+	}
+	for _, c := range contracts {
+		if err := b.DeleteContract(ctx, c.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// rescan the blockchain for the contracts with all known hosts
+	hosts, err := b.Hosts(ctx, 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hostKeys []types.PublicKey
+	for _, h := range hosts {
+		hostKeys = append(hostKeys, h.PublicKey)
+	}
+	keys, err := w.ContractKeys(ctx, hostKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := b.AddJob(ctx, api.JobTypeRescan, api.RescanJobParams{Keys: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Retry(100, 100*time.Millisecond, func() error {
+		job, err = b.Job(ctx, job.ID)
+		if err != nil {
+			t.Fatal(err)
+		} else if job.State == api.JobStateFailed {
+			t.Fatal("rescan failed", job.Error)
+		} else if job.State != api.JobStateDone {
+			return errors.New("rescan isn't done")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res api.RescanJobResult
+	if err := json.Unmarshal(job.Result, &res); err != nil {
+		t.Fatal(err)
+	} else if res.Added < len(contracts) {
+		t.Fatalf("unexpected result %+v", res)
+	}
+
+	// assert the contracts were added again, their start height is the
+	// height at which they were confirmed
+	for _, c := range contracts {
+		rescanned, err := b.Contract(ctx, c.ID)
+		if err != nil {
+			t.Fatal(err)
+		} else if rescanned.HostKey != c.HostKey || rescanned.StartHeight < c.StartHeight || rescanned.WindowStart != c.WindowStart || rescanned.WindowEnd != c.WindowEnd {
+			t.Fatal("unexpected contract", rescanned)
+		}
+	}
+
+	// assert the contracts can't be pruned until their roots are restored
+	for _, c := range contracts {
+		if _, err := b.ContractRoots(ctx, c.ID); err == nil || !strings.Contains(err.Error(), api.ErrContractRootsUnknown.Error()) {
+			t.Fatal("unexpected error", err)
+		} else if _, err := w.RHPContractPrune(ctx, c.ID); err == nil || !strings.Contains(err.Error(), api.ErrContractRootsUnknown.Error()) {
+			t.Fatal("unexpected error", err)
+		}
+		resp, err := w.RHPContractRoots(ctx, c.ID, c.HostKey, c.HostIP)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := b.RestoreContractRoots(ctx, c.ID, resp.Roots); err != nil {
+			t.Fatal(err)
+		} else if _, err := b.ContractRoots(ctx, c.ID); err != nil {
+			t.Fatal(err)
+		} else if err := b.RestoreContractRoots(ctx, c.ID, resp.Roots); err == nil {
+			t.Fatal("expected roots to be restored only once")
+		}
+	}
+}
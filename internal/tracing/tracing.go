@@ -2,8 +2,12 @@ package tracing
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"sync"
+	"time"
 
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
@@ -24,24 +28,160 @@ const (
 
 var (
 	Tracer = trace.NewNoopTracerProvider().Tracer("noop")
+
+	// ErrInvalidSamplingRate is returned when trying to set a sampling rate
+	// outside of [0, 1].
+	ErrInvalidSamplingRate = errors.New("sampling rate must be between 0 and 1")
+
+	// sampler is the sampler of the tracer provider created by Init, it
+	// allows for changing the sampling rate at runtime.
+	sampler = newRateSampler(1)
 )
 
-// Init initialises a new OpenTelemetry Tracer using information from the
-// environment and process. For more information on available environment
-// variables for configuration, check out
+// Config contains the configuration of the OpenTelemetry exporter.
+type Config struct {
+	// Endpoint is the URL of the OTLP endpoint the traces are exported to,
+	// e.g. http://localhost:4318. If empty, the standard OpenTelemetry
+	// environment variables are used.
+	Endpoint string
+
+	// ServiceName is the name of the service the traces are attributed to,
+	// it defaults to "renterd".
+	ServiceName string
+
+	// SamplingRate is the fraction of traces that are sampled.
+	SamplingRate float64
+}
+
+// rateSampler is a sampler that samples a fraction of the traces that can be
+// updated at runtime. Spans with a sampled parent are always sampled.
+type rateSampler struct {
+	mu      sync.Mutex
+	rate    float64
+	sampler sdktrace.Sampler
+}
+
+func newRateSampler(rate float64) *rateSampler {
+	return &rateSampler{
+		rate:    rate,
+		sampler: sdktrace.ParentBased(sdktrace.TraceIDRatioBased(rate)),
+	}
+}
+
+// Description implements sdktrace.Sampler.
+func (s *rateSampler) Description() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sampler.Description()
+}
+
+// ShouldSample implements sdktrace.Sampler.
+func (s *rateSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	s.mu.Lock()
+	ss := s.sampler
+	s.mu.Unlock()
+	return ss.ShouldSample(p)
+}
+
+func (s *rateSampler) setRate(rate float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rate = rate
+	s.sampler = sdktrace.ParentBased(sdktrace.TraceIDRatioBased(rate))
+}
+
+func (s *rateSampler) currentRate() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rate
+}
+
+// SamplingRate returns the current sampling rate.
+func SamplingRate() float64 {
+	return sampler.currentRate()
+}
+
+// SetSamplingRate updates the sampling rate of the tracer at runtime.
+func SetSamplingRate(rate float64) error {
+	if rate < 0 || rate > 1 {
+		return ErrInvalidSamplingRate
+	}
+	sampler.setRate(rate)
+	return nil
+}
+
+// WatchSamplingRate fetches the sampling rate at the given interval and applies
+// it, this way processes that don't run the bus pick up changes to its tracing
+// settings. The current rate is kept if it can't be fetched. It returns a
+// function that stops watching.
+func WatchSamplingRate(interval time.Duration, fetch func(ctx context.Context) (float64, error)) func(ctx context.Context) error {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			if rate, err := fetch(ctx); err == nil {
+				SetSamplingRate(rate)
+			}
+			cancel()
+		}
+	}()
+	return func(ctx context.Context) error {
+		close(stop)
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Init initialises a new OpenTelemetry Tracer using the given config and
+// information from the environment and process. For more information on
+// available environment variables for configuration, check out
 // https://opentelemetry.io/docs/reference/specification/sdk-environment-variables/.
 // https://github.com/open-telemetry/opentelemetry-go/tree/main/exporters/otlp/otlptrace
-func Init(workerID string) (func(ctx context.Context) error, error) {
+func Init(cfg Config, instanceID string) (func(ctx context.Context) error, error) {
+	if cfg.ServiceName == "" {
+		cfg.ServiceName = service
+	}
+	if err := SetSamplingRate(cfg.SamplingRate); err != nil {
+		return nil, err
+	}
+
 	// Create resources.
 	resources := resource.NewWithAttributes(
 		semconv.SchemaURL,
-		semconv.ServiceNameKey.String(service),
+		semconv.ServiceNameKey.String(cfg.ServiceName),
 		semconv.ServiceVersionKey.String(serviceVersion),
-		semconv.ServiceInstanceIDKey.String(workerID),
+		semconv.ServiceInstanceIDKey.String(instanceID),
 	)
 
 	// Create exporter.
-	client := otlptracehttp.NewClient()
+	var opts []otlptracehttp.Option
+	if cfg.Endpoint != "" {
+		u, err := url.Parse(cfg.Endpoint)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint %q", cfg.Endpoint)
+		}
+		opts = append(opts, otlptracehttp.WithEndpoint(u.Host))
+		if u.Scheme == "http" {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if u.Path != "" && u.Path != "/" {
+			opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+		}
+	}
+	client := otlptracehttp.NewClient(opts...)
 	exporter, err := otlptrace.New(context.Background(), client)
 	if err != nil {
 		return nil, err
@@ -49,7 +189,7 @@ func Init(workerID string) (func(ctx context.Context) error, error) {
 
 	// Create provider
 	provider := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithSampler(sampler),
 		sdktrace.WithResource(resources),
 		sdktrace.WithBatcher(exporter),
 	)
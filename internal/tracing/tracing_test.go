@@ -0,0 +1,51 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchSamplingRate(t *testing.T) {
+	if err := SetSamplingRate(1); err != nil {
+		t.Fatal(err)
+	}
+
+	// fail the fetches until the bus is available, the rate should be kept
+	var fetches, available int32
+	stop := WatchSamplingRate(10*time.Millisecond, func(ctx context.Context) (float64, error) {
+		atomic.AddInt32(&fetches, 1)
+		if atomic.LoadInt32(&available) == 0 {
+			return 0, errors.New("bus unavailable")
+		}
+		return 0.5, nil
+	})
+	for atomic.LoadInt32(&fetches) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	if rate := SamplingRate(); rate != 1 {
+		t.Fatal("unexpected sampling rate", rate)
+	}
+
+	// assert the fetched rate is applied once the bus is available
+	atomic.StoreInt32(&available, 1)
+	deadline := time.Now().Add(5 * time.Second)
+	for SamplingRate() != 0.5 {
+		if time.Now().After(deadline) {
+			t.Fatal("sampling rate wasn't applied")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// assert the rate isn't fetched after the watcher was stopped
+	if err := stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	n := atomic.LoadInt32(&fetches)
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&fetches) != n {
+		t.Fatal("rate was fetched after the watcher was stopped")
+	}
+}
@@ -3,10 +3,15 @@ package object
 import (
 	"bytes"
 	"crypto/cipher"
+	"encoding/binary"
 	"encoding/hex"
 	"errors"
+	"hash"
 	"io"
+	"time"
 
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/blake2b"
 	"golang.org/x/crypto/chacha20"
 	"lukechampine.com/frand"
 )
@@ -60,10 +65,181 @@ func GenerateEncryptionKey() EncryptionKey {
 	return key
 }
 
+// DeriveEncryptionKey derives an object encryption key from the given master
+// key and nonce. The nonce has to be unique for every upload, otherwise
+// overwriting an object would reuse its keystream, and is stored with the
+// object so its key can be re-derived. The object's path isn't part of the
+// derivation since objects can be renamed.
+func DeriveEncryptionKey(masterKey [32]byte, nonce [32]byte) EncryptionKey {
+	h, _ := blake2b.New256(masterKey[:])
+	h.Write([]byte("objectkey"))
+	h.Write(nonce[:])
+	key := EncryptionKey{entropy: new([32]byte)}
+	h.Sum(key.entropy[:0])
+	return key
+}
+
+// DeriveSlabKey derives the encryption key for the slab at the given index
+// within an object encrypted with k.
+func (k EncryptionKey) DeriveSlabKey(index uint64) EncryptionKey {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], index)
+	h, _ := blake2b.New256(k.entropy[:])
+	h.Write([]byte("slabkey"))
+	h.Write(buf[:])
+	key := EncryptionKey{entropy: new([32]byte)}
+	h.Sum(key.entropy[:0])
+	return key
+}
+
+// ETagHasher returns a hash that computes the ETag of the data of an object
+// encrypted with k. The hash is keyed with k, so ETags don't reveal whether two
+// objects have the same content.
+func (k EncryptionKey) ETagHasher() hash.Hash {
+	h, _ := blake2b.New256(k.entropy[:])
+	h.Write([]byte("etag"))
+	return h
+}
+
+// ErrInvalidPassphrase is returned when unwrapping a key with the wrong
+// passphrase.
+var ErrInvalidPassphrase = errors.New("invalid passphrase")
+
+// A KeyWrap contains the information required to unwrap an encryption key that
+// was wrapped using a passphrase.
+type KeyWrap struct {
+	Salt     [16]byte
+	Checksum [16]byte
+}
+
+// wrappingKey derives the key used to wrap an encryption key from the given
+// passphrase and salt.
+func wrappingKey(passphrase string, salt [16]byte) (key [32]byte, checksum [16]byte) {
+	copy(key[:], argon2.IDKey([]byte(passphrase), salt[:], 1, 64*1024, 4, 32))
+	h := blake2b.Sum256(append([]byte("checksum"), key[:]...))
+	copy(checksum[:], h[:])
+	return
+}
+
+// slabWrappingKey derives the key used to wrap the key of the slab at the given
+// index of an object from the object's wrapping key, every slab key is wrapped
+// with a different key.
+func slabWrappingKey(wk [32]byte, index int) (key [32]byte) {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(index))
+	h, _ := blake2b.New256(wk[:])
+	h.Write([]byte("slabkey"))
+	h.Write(buf[:])
+	h.Sum(key[:0])
+	return
+}
+
+// xor returns k xored with the given key.
+func (k EncryptionKey) xor(key [32]byte) EncryptionKey {
+	xored := EncryptionKey{entropy: new([32]byte)}
+	for i := range xored.entropy {
+		xored.entropy[i] = k.entropy[i] ^ key[i]
+	}
+	return xored
+}
+
+// Wrap encrypts k using a key derived from the given passphrase. The returned
+// KeyWrap is required to unwrap the key again.
+func (k EncryptionKey) Wrap(passphrase string) (EncryptionKey, KeyWrap) {
+	var kw KeyWrap
+	frand.Read(kw.Salt[:])
+	wk, checksum := wrappingKey(passphrase, kw.Salt)
+	kw.Checksum = checksum
+	return k.xor(wk), kw
+}
+
+// Unwrap decrypts a key that was wrapped using Wrap.
+func (k EncryptionKey) Unwrap(passphrase string, kw KeyWrap) (EncryptionKey, error) {
+	wk, checksum := wrappingKey(passphrase, kw.Salt)
+	if checksum != kw.Checksum {
+		return EncryptionKey{}, ErrInvalidPassphrase
+	}
+	return k.xor(wk), nil
+}
+
 // An Object is a unit of data that has been stored on a host.
 type Object struct {
 	Key   EncryptionKey
 	Slabs []SlabSlice
+
+	// Wrap is set if the object's key was wrapped using a passphrase, in which
+	// case the same passphrase is required to decrypt the object. The keys of
+	// the object's slabs are wrapped as well, see WrapKeys.
+	Wrap *KeyWrap
+
+	// KeyNonce is set if the object's key was derived from the worker's
+	// master key, see DeriveEncryptionKey.
+	KeyNonce *[32]byte
+
+	// PartialSlab is set if the tail of the object wasn't uploaded yet, it
+	// follows the data of the object's slabs.
+	PartialSlab *PartialSlab
+
+	// ModTime is the time the object was last modified. It's set by the bus
+	// when the object is stored, unless it's set already.
+	ModTime time.Time
+
+	// ETag is the hex-encoded keyed hash of the object's data, see
+	// EncryptionKey.ETagHasher. It's empty for
+	// objects that were stored before the hash was recorded.
+	ETag string
+}
+
+// A PartialSlab is the tail of an object that's too small to fill a slab of
+// its own. It's buffered until it can be packed into a slab together with the
+// tails of other objects.
+type PartialSlab struct {
+	MinShards   uint8
+	TotalShards uint8
+
+	// Data is the tail of the object, encrypted with the object's key.
+	Data []byte
+}
+
+// WrapKeys wraps the keys of o and its slabs using a key derived from the given
+// passphrase and a random salt, the wrapping key is independent of the key the
+// object's key might have been derived from. Since the keys of wrapped slabs
+// are unknown without the passphrase, wrapped slabs can't be migrated.
+func (o *Object) WrapKeys(passphrase string) {
+	var kw KeyWrap
+	frand.Read(kw.Salt[:])
+	wk, checksum := wrappingKey(passphrase, kw.Salt)
+	kw.Checksum = checksum
+
+	o.Key = o.Key.xor(wk)
+	for i := range o.Slabs {
+		o.Slabs[i].Key = o.Slabs[i].Key.xor(slabWrappingKey(wk, i))
+		o.Slabs[i].Wrapped = true
+	}
+	o.Wrap = &kw
+}
+
+// UnwrapKeys unwraps the keys of an object that were wrapped using WrapKeys.
+// Slabs that were added to the object after it was wrapped, e.g. packed slabs,
+// aren't wrapped and are left untouched.
+func (o *Object) UnwrapKeys(passphrase string) error {
+	if o.Wrap == nil {
+		return nil
+	}
+	wk, checksum := wrappingKey(passphrase, o.Wrap.Salt)
+	if checksum != o.Wrap.Checksum {
+		return ErrInvalidPassphrase
+	}
+
+	o.Key = o.Key.xor(wk)
+	for i := range o.Slabs {
+		if o.Slabs[i].Wrapped {
+			o.Slabs[i].Key = o.Slabs[i].Key.xor(slabWrappingKey(wk, i))
+			o.Slabs[i].Wrapped = false
+		}
+	}
+	o.Wrap = nil
+	return nil
 }
 
 // Size returns the total size of the object.
@@ -72,6 +248,9 @@ func (o Object) Size() int64 {
 	for _, ss := range o.Slabs {
 		n += int64(ss.Length)
 	}
+	if o.PartialSlab != nil {
+		n += int64(len(o.PartialSlab.Data))
+	}
 	return n
 }
 
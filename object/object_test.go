@@ -0,0 +1,136 @@
+package object
+
+import (
+	"testing"
+
+	"lukechampine.com/frand"
+)
+
+func TestDeriveEncryptionKey(t *testing.T) {
+	var masterKey [32]byte
+	frand.Read(masterKey[:])
+	nonce := frand.Entropy256()
+
+	// keys should be deterministic
+	k1 := DeriveEncryptionKey(masterKey, nonce)
+	if k2 := DeriveEncryptionKey(masterKey, nonce); k1.String() != k2.String() {
+		t.Fatal("expected same key for same nonce")
+	}
+
+	// but unique per nonce, so overwriting a path doesn't reuse its key
+	if k2 := DeriveEncryptionKey(masterKey, frand.Entropy256()); k1.String() == k2.String() {
+		t.Fatal("expected different key for different nonce")
+	}
+
+	// and per master key
+	var otherKey [32]byte
+	frand.Read(otherKey[:])
+	if k2 := DeriveEncryptionKey(otherKey, nonce); k1.String() == k2.String() {
+		t.Fatal("expected different key for different master key")
+	}
+
+	// slab keys should be unique per index and differ from the object key
+	s0, s1 := k1.DeriveSlabKey(0), k1.DeriveSlabKey(1)
+	if s0.String() == s1.String() || s0.String() == k1.String() {
+		t.Fatal("expected unique slab keys")
+	}
+	if k1.DeriveSlabKey(0).String() != s0.String() {
+		t.Fatal("expected deterministic slab key")
+	}
+}
+
+func TestETagHasher(t *testing.T) {
+	data := frand.Bytes(100)
+	etag := func(k EncryptionKey) string {
+		h := k.ETagHasher()
+		h.Write(data)
+		return string(h.Sum(nil))
+	}
+
+	// ETags should be deterministic for the same key but shouldn't reveal
+	// whether objects with different keys have the same content
+	k1, k2 := GenerateEncryptionKey(), GenerateEncryptionKey()
+	if etag(k1) != etag(k1) {
+		t.Fatal("ETags should match")
+	} else if etag(k1) == etag(k2) {
+		t.Fatal("ETags of different keys shouldn't match")
+	}
+}
+
+func TestWrapEncryptionKey(t *testing.T) {
+	key := GenerateEncryptionKey()
+	wrapped, kw := key.Wrap("foo")
+	if wrapped.String() == key.String() {
+		t.Fatal("expected wrapped key to differ")
+	}
+
+	// unwrapping with the wrong passphrase should fail
+	if _, err := wrapped.Unwrap("bar", kw); err != ErrInvalidPassphrase {
+		t.Fatal("unexpected error", err)
+	}
+
+	// unwrapping with the right passphrase should return the original key
+	unwrapped, err := wrapped.Unwrap("foo", kw)
+	if err != nil {
+		t.Fatal(err)
+	} else if unwrapped.String() != key.String() {
+		t.Fatal("unexpected key")
+	}
+}
+
+func TestWrapObjectKeys(t *testing.T) {
+	o := Object{
+		Key: GenerateEncryptionKey(),
+		Slabs: []SlabSlice{
+			{Slab: Slab{Key: GenerateEncryptionKey()}},
+			{Slab: Slab{Key: GenerateEncryptionKey()}},
+		},
+	}
+	orig := Object{Key: o.Key, Slabs: append([]SlabSlice(nil), o.Slabs...)}
+
+	// wrap the keys and assert every key changed
+	o.WrapKeys("foo")
+	if o.Wrap == nil {
+		t.Fatal("expected key wrap")
+	} else if o.Key.String() == orig.Key.String() {
+		t.Fatal("expected object key to be wrapped")
+	}
+	for i, s := range o.Slabs {
+		if !s.Wrapped || s.Key.String() == orig.Slabs[i].Key.String() {
+			t.Fatal("expected slab key to be wrapped", i)
+		}
+	}
+
+	// the slab keys must not be wrapped with the same key as the object key
+	// or each other
+	if o.Slabs[0].Key.xor(*orig.Slabs[0].Key.entropy).String() == o.Key.xor(*orig.Key.entropy).String() {
+		t.Fatal("slab key wrapped with the object's wrapping key")
+	} else if o.Slabs[0].Key.xor(*orig.Slabs[0].Key.entropy).String() == o.Slabs[1].Key.xor(*orig.Slabs[1].Key.entropy).String() {
+		t.Fatal("slab keys wrapped with the same key")
+	}
+
+	// append an unwrapped slab, like a packed slab
+	packed := Slab{Key: GenerateEncryptionKey()}
+	o.Slabs = append(o.Slabs, SlabSlice{Slab: packed})
+
+	// unwrapping with the wrong passphrase should fail
+	wrapped := o
+	if err := wrapped.UnwrapKeys("bar"); err != ErrInvalidPassphrase {
+		t.Fatal("unexpected error", err)
+	}
+
+	// unwrapping with the right passphrase should restore the keys
+	if err := o.UnwrapKeys("foo"); err != nil {
+		t.Fatal(err)
+	} else if o.Wrap != nil || o.Key.String() != orig.Key.String() {
+		t.Fatal("unexpected object key")
+	}
+	for i, s := range orig.Slabs {
+		if o.Slabs[i].Wrapped || o.Slabs[i].Key.String() != s.Key.String() {
+			t.Fatal("unexpected slab key", i)
+		}
+	}
+	if o.Slabs[2].Key.String() != packed.Key.String() {
+		t.Fatal("packed slab key shouldn't change")
+	}
+}
@@ -1,8 +1,12 @@
 package object
 
 import (
-	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
 
 	"github.com/klauspost/reedsolomon"
 	rhpv2 "go.sia.tech/core/rhp/v2"
@@ -10,6 +14,68 @@ import (
 	"golang.org/x/crypto/chacha20"
 )
 
+// parallelMinShardSize is the minimum size of a shard for the shards to be
+// processed in parallel, smaller shards aren't worth the overhead.
+const parallelMinShardSize = 1 << 16
+
+// rsEncoders caches the Reed-Solomon encoders by their number of data and
+// parity shards since creating an encoder involves building its matrices.
+var rsEncoders sync.Map
+
+// rsEncoder returns a Reed-Solomon encoder for the given number of data and
+// parity shards. The encoder splits the work across the available CPU cores
+// and uses the SIMD instructions supported by the CPU.
+func rsEncoder(dataShards, parityShards int) (reedsolomon.Encoder, error) {
+	key := [2]int{dataShards, parityShards}
+	if rsc, ok := rsEncoders.Load(key); ok {
+		return rsc.(reedsolomon.Encoder), nil
+	}
+	rsc, err := reedsolomon.New(dataShards, parityShards, reedsolomon.WithAutoGoroutines(rhpv2.SectorSize))
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := rsEncoders.LoadOrStore(key, rsc)
+	return actual.(reedsolomon.Encoder), nil
+}
+
+// forEachShard calls fn for every shard, spreading the calls across the
+// available CPU cores if the shards are large enough.
+func forEachShard(shards [][]byte, fn func(i int)) {
+	var size int
+	for _, shard := range shards {
+		if len(shard) > size {
+			size = len(shard)
+		}
+	}
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(shards) {
+		workers = len(shards)
+	}
+	if workers < 2 || size < parallelMinShardSize {
+		for i := range shards {
+			fn(i)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	next := int64(-1)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+				if i >= len(shards) {
+					return
+				}
+				fn(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
 // A Sector uniquely identifies a sector stored on a particular host.
 type Sector struct {
 	Host types.PublicKey
@@ -24,6 +90,10 @@ type Slab struct {
 	Key       EncryptionKey
 	MinShards uint8
 	Shards    []Sector
+
+	// Wrapped is set if Key was wrapped together with the key of the object
+	// the slab belongs to, see Object.WrapKeys.
+	Wrapped bool
 }
 
 // Length returns the length of the raw data stored in s.
@@ -34,11 +104,48 @@ func (s Slab) Length() int {
 // Encrypt xors shards with the keystream derived from s.Key, using a
 // different nonce for each shard.
 func (s Slab) Encrypt(shards [][]byte) {
-	for i, shard := range shards {
+	forEachShard(shards, func(i int) {
 		nonce := [24]byte{1: byte(i)}
 		c, _ := chacha20.NewUnauthenticatedCipher(s.Key.entropy[:], nonce[:])
-		c.XORKeyStream(shard, shard)
+		c.XORKeyStream(shards[i], shards[i])
+	})
+}
+
+// EncryptAt is like Encrypt, but the shards are treated as regions that start
+// at the given offset within the slab's shards. The offset must be a multiple
+// of rhpv2.LeafSize.
+func (s Slab) EncryptAt(shards [][]byte, offset uint32) {
+	forEachShard(shards, func(i int) {
+		nonce := [24]byte{1: byte(i)}
+		c, _ := chacha20.NewUnauthenticatedCipher(s.Key.entropy[:], nonce[:])
+		c.SetCounter(offset / rhpv2.LeafSize)
+		c.XORKeyStream(shards[i], shards[i])
+	})
+}
+
+// EncodeChunk encodes a chunk of slab data into shard regions of equal length,
+// which must be a multiple of rhpv2.LeafSize. The data must be MinShards
+// times the length of a region. Encoding a slab chunk by chunk yields the same
+// shards as Encode, without requiring the whole slab to be held in memory.
+func (s Slab) EncodeChunk(buf []byte, shards [][]byte) error {
+	size := len(shards[0])
+	if size%rhpv2.LeafSize != 0 {
+		return fmt.Errorf("shard regions must be a multiple of %v bytes", rhpv2.LeafSize)
+	}
+	for _, shard := range shards {
+		if len(shard) != size {
+			return errors.New("shard regions must have the same length")
+		}
 	}
+	if len(buf) != size*int(s.MinShards) {
+		return fmt.Errorf("chunk must be %v bytes, got %v", size*int(s.MinShards), len(buf))
+	}
+	stripedSplit(buf, shards[:s.MinShards])
+	rsc, err := rsEncoder(int(s.MinShards), len(shards)-int(s.MinShards))
+	if err != nil {
+		return err
+	}
+	return rsc.Encode(shards)
 }
 
 // Encode encodes slab data into sector-sized shards. The supplied shards should
@@ -51,7 +158,10 @@ func (s Slab) Encode(buf []byte, shards [][]byte) {
 		shards[i] = shards[i][:rhpv2.SectorSize]
 	}
 	stripedSplit(buf, shards[:s.MinShards])
-	rsc, _ := reedsolomon.New(int(s.MinShards), len(shards)-int(s.MinShards))
+	rsc, err := rsEncoder(int(s.MinShards), len(shards)-int(s.MinShards))
+	if err != nil {
+		panic(err)
+	}
 	if err := rsc.Encode(shards); err != nil {
 		panic(err)
 	}
@@ -73,7 +183,10 @@ func (s Slab) Reconstruct(shards [][]byte) error {
 		}
 	}
 
-	rsc, _ := reedsolomon.New(int(s.MinShards), len(shards)-int(s.MinShards))
+	rsc, err := rsEncoder(int(s.MinShards), len(shards)-int(s.MinShards))
+	if err != nil {
+		return err
+	}
 	if err := rsc.Reconstruct(shards); err != nil {
 		return err
 	}
@@ -106,12 +219,12 @@ func (ss SlabSlice) SectorRegion() (offset, length uint32) {
 // slice offset), using a different nonce for each shard.
 func (ss SlabSlice) Decrypt(shards [][]byte) {
 	offset := ss.Offset / (rhpv2.LeafSize * uint32(ss.MinShards))
-	for i, shard := range shards {
+	forEachShard(shards, func(i int) {
 		nonce := [24]byte{1: byte(i)}
 		c, _ := chacha20.NewUnauthenticatedCipher(ss.Key.entropy[:], nonce[:])
 		c.SetCounter(offset)
-		c.XORKeyStream(shard, shard)
-	}
+		c.XORKeyStream(shards[i], shards[i])
+	})
 }
 
 // Recover recovers a slice of slab data from the supplied shards.
@@ -123,7 +236,10 @@ func (ss SlabSlice) Recover(w io.Writer, shards [][]byte) error {
 	if empty || len(shards) == 0 {
 		return nil
 	}
-	rsc, _ := reedsolomon.New(int(ss.MinShards), len(shards)-int(ss.MinShards))
+	rsc, err := rsEncoder(int(ss.MinShards), len(shards)-int(ss.MinShards))
+	if err != nil {
+		return err
+	}
 	if err := rsc.ReconstructData(shards); err != nil {
 		return err
 	}
@@ -132,14 +248,19 @@ func (ss SlabSlice) Recover(w io.Writer, shards [][]byte) error {
 }
 
 // stripedSplit splits data into striped data shards, which must have sufficient
-// capacity.
+// capacity. The shards are filled in parallel.
 func stripedSplit(data []byte, dataShards [][]byte) {
-	buf := bytes.NewBuffer(data)
-	for off := 0; buf.Len() > 0; off += rhpv2.LeafSize {
-		for _, shard := range dataShards {
-			copy(shard[off:], buf.Next(rhpv2.LeafSize))
+	stride := len(dataShards) * rhpv2.LeafSize
+	forEachShard(dataShards, func(i int) {
+		shard := dataShards[i]
+		for off, src := 0, i*rhpv2.LeafSize; src < len(data); off, src = off+rhpv2.LeafSize, src+stride {
+			end := src + rhpv2.LeafSize
+			if end > len(data) {
+				end = len(data)
+			}
+			copy(shard[off:], data[src:end])
 		}
-	}
+	})
 }
 
 // stripedJoin joins the striped data shards, writing them to dst. The first 'skip'
@@ -70,6 +70,45 @@ func TestReedSolomon(t *testing.T) {
 	}
 }
 
+func TestEncodeChunk(t *testing.T) {
+	// encode a 3-of-10 slab at once
+	s := Slab{Key: GenerateEncryptionKey(), MinShards: 3}
+	data := frand.Bytes(rhpv2.SectorSize*3 - 1000)
+	buf := make([]byte, rhpv2.SectorSize*3)
+	copy(buf, data)
+	shards := make([][]byte, 10)
+	s.Encode(buf, shards)
+	s.Encrypt(shards)
+
+	// encode it chunk by chunk
+	const chunkSize = 1 << 16
+	chunked := make([][]byte, len(shards))
+	for off := 0; off < rhpv2.SectorSize; off += chunkSize {
+		chunk := make([][]byte, len(shards))
+		for i := range chunk {
+			chunk[i] = make([]byte, chunkSize)
+		}
+		if err := s.EncodeChunk(buf[off*3:][:chunkSize*3], chunk); err != nil {
+			t.Fatal(err)
+		}
+		s.EncryptAt(chunk, uint32(off))
+		for i := range chunk {
+			chunked[i] = append(chunked[i], chunk[i]...)
+		}
+	}
+	for i := range shards {
+		if !bytes.Equal(shards[i], chunked[i]) {
+			t.Fatalf("shard %v doesn't match", i)
+		}
+	}
+
+	// chunks that aren't a multiple of the leaf size are rejected
+	chunk := [][]byte{make([]byte, 100), make([]byte, 100)}
+	if err := (Slab{MinShards: 1}).EncodeChunk(make([]byte, 100), chunk); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
 func BenchmarkReedSolomon(b *testing.B) {
 	makeSlab := func(m, n uint8) (Slab, []byte, [][]byte) {
 		return Slab{Key: GenerateEncryptionKey(), MinShards: m, Shards: make([]Sector, n)},
@@ -123,6 +162,18 @@ func BenchmarkReedSolomon(b *testing.B) {
 		}
 	}
 
+	benchEncrypt := func(m, n uint8) func(*testing.B) {
+		s, data, shards := makeSlab(m, n)
+		s.Encode(data, shards)
+		return func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(shards[0])) * int64(n))
+			for i := 0; i < b.N; i++ {
+				s.Encrypt(shards)
+			}
+		}
+	}
+
 	b.Run("encode-10-of-40", benchEncode(10, 40))
 	b.Run("encode-20-of-40", benchEncode(20, 40))
 	b.Run("encode-30-of-40", benchEncode(30, 40))
@@ -134,4 +185,6 @@ func BenchmarkReedSolomon(b *testing.B) {
 
 	b.Run("reconstruct-1-of-10-of-40", benchReconstruct(10, 40, 1))
 	b.Run("reconstruct-10-of-10-of-40", benchReconstruct(10, 40, 10))
+
+	b.Run("encrypt-10-of-40", benchEncrypt(10, 40))
 }
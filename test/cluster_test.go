@@ -0,0 +1,54 @@
+package test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.sia.tech/siad/build"
+)
+
+func TestNewCluster(t *testing.T) {
+	if build.Release != "testing" {
+		if _, err := NewCluster(t.TempDir(), ClusterOptions{}); err == nil {
+			t.Fatal("expected cluster to require the testing build tag")
+		}
+		t.Skip("requires -tags='testing'")
+	}
+
+	dir := t.TempDir()
+	cluster, err := NewCluster(dir, ClusterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := cluster.Shutdown(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	// the bus should be funded and store its data in memory
+	if balance, err := cluster.Bus.WalletBalance(context.Background()); err != nil {
+		t.Fatal(err)
+	} else if balance.IsZero() {
+		t.Fatal("expected bus to be funded")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bus", "db", "db.sqlite")); !os.IsNotExist(err) {
+		t.Fatal("expected no database on disk", err)
+	}
+
+	// add a host and wait for the autopilot to form a contract with it
+	hosts, err := cluster.AddHostsBlocking(1)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(cluster.Hosts()) != 1 {
+		t.Fatal("unexpected hosts", len(cluster.Hosts()))
+	}
+	contracts, err := cluster.WaitForContracts()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(contracts) != 1 || contracts[0].HostKey() != hosts[0].HostKey() {
+		t.Fatal("unexpected contracts", contracts)
+	}
+}
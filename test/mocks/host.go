@@ -0,0 +1,619 @@
+// Package mocks contains mock implementations of Sia components that allow
+// testing renterd's upload, download and migration code without real hosts or
+// network access.
+package mocks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/worker"
+	"lukechampine.com/frand"
+)
+
+var (
+	// ErrHostOffline is returned by all of the host's methods while it's
+	// marked as offline.
+	ErrHostOffline = errors.New("host is offline")
+
+	// ErrSectorNotFound is returned when downloading a sector the host doesn't
+	// store.
+	ErrSectorNotFound = errors.New("sector not found")
+)
+
+// maxWriteRequestSize is the maximum size of a Write RPC request the host
+// accepts, siad hosts accept the same amount.
+const maxWriteRequestSize = 20 << 20
+
+// A Host is an in-memory host. It implements worker.SectorStore, so it can be
+// passed to the worker's transfer code directly, and it serves the RHPv2 RPCs
+// the worker uses to form contracts with a host and to transfer sectors, so it
+// can be scanned and used as a host over the network. The host doesn't check
+// payments and collateral, it only checks the renter's signatures.
+type Host struct {
+	contractID types.FileContractID
+	privKey    types.PrivateKey
+
+	mu        sync.Mutex
+	offline   bool
+	contracts map[types.FileContractID]*hostContract
+	sectors   map[types.Hash256][]byte
+	settings  rhpv2.HostSettings
+}
+
+// A hostContract is a contract the host formed over RHPv2.
+type hostContract struct {
+	rev       rhpv2.ContractRevision
+	roots     []types.Hash256
+	renterKey types.PublicKey
+	locked    bool
+}
+
+var _ worker.SectorStore = (*Host)(nil)
+
+// NewHost returns a new host with a random key and contract ID.
+func NewHost() *Host {
+	var contractID types.FileContractID
+	frand.Read(contractID[:])
+	return &Host{
+		contractID: contractID,
+		privKey:    types.GeneratePrivateKey(),
+		contracts:  make(map[types.FileContractID]*hostContract),
+		sectors:    make(map[types.Hash256][]byte),
+		settings: rhpv2.HostSettings{
+			AcceptingContracts:   true,
+			MaxDownloadBatchSize: 1 << 26,
+			MaxDuration:          144 * 7 * 52,
+			MaxReviseBatchSize:   1 << 26,
+			RemainingStorage:     1 << 42,
+			SectorSize:           rhpv2.SectorSize,
+			TotalStorage:         1 << 42,
+			WindowSize:           144,
+			Version:              "1.6.0",
+		},
+	}
+}
+
+// Contract returns the ID of the host's contract.
+func (h *Host) Contract() types.FileContractID {
+	return h.contractID
+}
+
+// PublicKey returns the host's public key.
+func (h *Host) PublicKey() types.PublicKey {
+	return h.privKey.PublicKey()
+}
+
+// Settings returns the settings the host serves over RHPv2.
+func (h *Host) Settings() rhpv2.HostSettings {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.settings
+}
+
+// UpdateSettings updates the settings the host serves over RHPv2.
+func (h *Host) UpdateSettings(settings rhpv2.HostSettings) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.settings = settings
+}
+
+// SetOffline marks the host as offline, while offline all transfers fail with
+// ErrHostOffline and the host refuses RHP connections.
+func (h *Host) SetOffline(offline bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.offline = offline
+}
+
+// AddSector stores the given sector on the host and returns its root.
+func (h *Host) AddSector(sector *[rhpv2.SectorSize]byte) types.Hash256 {
+	root := rhpv2.SectorRoot(sector)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sectors[root] = append([]byte(nil), sector[:]...)
+	return root
+}
+
+// Sector returns the sector with given root.
+func (h *Host) Sector(root types.Hash256) ([]byte, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sector, ok := h.sectors[root]
+	return sector, ok
+}
+
+// Sectors returns the roots of all sectors stored on the host.
+func (h *Host) Sectors() []types.Hash256 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	roots := make([]types.Hash256, 0, len(h.sectors))
+	for root := range h.sectors {
+		roots = append(roots, root)
+	}
+	return roots
+}
+
+// UploadSector stores the given sector on the host.
+func (h *Host) UploadSector(_ context.Context, sector *[rhpv2.SectorSize]byte) (types.Hash256, error) {
+	if h.isOffline() {
+		return types.Hash256{}, ErrHostOffline
+	}
+	return h.AddSector(sector), nil
+}
+
+// DownloadSector writes length bytes of the sector with given root, starting
+// at offset, to w.
+func (h *Host) DownloadSector(_ context.Context, w io.Writer, root types.Hash256, offset, length uint32) error {
+	if h.isOffline() {
+		return ErrHostOffline
+	}
+	sector, ok := h.Sector(root)
+	if !ok {
+		return ErrSectorNotFound
+	} else if uint64(offset)+uint64(length) > rhpv2.SectorSize {
+		return errors.New("offset+length out of bounds")
+	}
+	_, err := w.Write(sector[offset:][:length])
+	return err
+}
+
+// UploadSectors stores the given sectors on the host.
+func (h *Host) UploadSectors(ctx context.Context, sectors []*[rhpv2.SectorSize]byte) ([]types.Hash256, error) {
+	roots := make([]types.Hash256, len(sectors))
+	for i, sector := range sectors {
+		root, err := h.UploadSector(ctx, sector)
+		if err != nil {
+			return nil, err
+		}
+		roots[i] = root
+	}
+	return roots, nil
+}
+
+// DownloadSectors downloads the same range of every given sector to w.
+func (h *Host) DownloadSectors(ctx context.Context, w io.Writer, roots []types.Hash256, offset, length uint32) error {
+	for _, root := range roots {
+		if err := h.DownloadSector(ctx, w, root, offset, length); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteSectors removes the sectors with given roots from the host.
+func (h *Host) DeleteSectors(_ context.Context, roots []types.Hash256) error {
+	if h.isOffline() {
+		return ErrHostOffline
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, root := range roots {
+		delete(h.sectors, root)
+	}
+	return nil
+}
+
+// ContractRoots returns the roots of the sectors stored in the contract with
+// given ID, the contract has to be formed over RHPv2.
+func (h *Host) ContractRoots(id types.FileContractID) ([]types.Hash256, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c, ok := h.contracts[id]
+	if !ok {
+		return nil, false
+	}
+	return append([]types.Hash256(nil), c.roots...), true
+}
+
+// Serve accepts RHPv2 connections on l until it is closed. The host supports
+// the Settings, FormContract, Lock, Unlock, Read, Write and SectorRoots RPCs,
+// if the settings don't contain a net address the listener's address is used.
+func (h *Host) Serve(l net.Listener) error {
+	h.mu.Lock()
+	if h.settings.NetAddress == "" {
+		h.settings.NetAddress = l.Addr().String()
+	}
+	h.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go h.handleConn(conn)
+	}
+}
+
+func (h *Host) handleConn(conn net.Conn) {
+	defer conn.Close()
+	if h.isOffline() {
+		return
+	}
+
+	t, err := rhpv2.NewHostTransport(conn, h.privKey)
+	if err != nil {
+		return
+	}
+	defer t.Close()
+
+	// the contract locked by the connection is unlocked once it's closed
+	var locked types.FileContractID
+	defer func() { h.unlock(locked) }()
+
+	for {
+		id, err := t.ReadID()
+		if err != nil {
+			return
+		}
+
+		switch id {
+		case rhpv2.RPCSettingsID:
+			err = h.rpcSettings(t)
+		case rhpv2.RPCFormContractID:
+			err = h.rpcFormContract(t)
+		case rhpv2.RPCLockID:
+			err = h.rpcLock(t, &locked)
+		case rhpv2.RPCUnlockID:
+			h.unlock(locked)
+			locked = types.FileContractID{}
+		case rhpv2.RPCReadID:
+			err = h.rpcRead(t, locked)
+		case rhpv2.RPCWriteID:
+			err = h.rpcWrite(t, locked)
+		case rhpv2.RPCSectorRootsID:
+			err = h.rpcSectorRoots(t, locked)
+		default:
+			err = fmt.Errorf("unsupported RPC %v", id)
+		}
+		if err != nil {
+			t.WriteResponseErr(err)
+			return
+		}
+	}
+}
+
+func (h *Host) rpcSettings(t *rhpv2.Transport) error {
+	js, err := json.Marshal(h.Settings())
+	if err != nil {
+		return err
+	}
+	return t.WriteResponse(&rhpv2.RPCSettingsResponse{Settings: js})
+}
+
+func (h *Host) rpcFormContract(t *rhpv2.Transport) error {
+	var req rhpv2.RPCFormContractRequest
+	if err := t.ReadRequest(&req, 65536); err != nil {
+		return err
+	} else if len(req.Transactions) == 0 || len(req.Transactions[len(req.Transactions)-1].FileContracts) != 1 {
+		return errors.New("transaction set doesn't contain a file contract")
+	} else if len(req.RenterKey.Key) != len(types.PublicKey{}) {
+		return errors.New("invalid renter key")
+	}
+	renterKey := *(*types.PublicKey)(req.RenterKey.Key)
+
+	// the host doesn't add any inputs or outputs
+	if err := t.WriteResponse(&rhpv2.RPCFormContractAdditions{}); err != nil {
+		return err
+	}
+	var renterSigs rhpv2.RPCFormContractSignatures
+	if err := t.ReadResponse(&renterSigs, 4096); err != nil {
+		return err
+	}
+
+	// create the initial revision and sign it
+	txn := req.Transactions[len(req.Transactions)-1]
+	fc := txn.FileContracts[0]
+	rev := types.FileContractRevision{
+		ParentID: txn.FileContractID(0),
+		UnlockConditions: types.UnlockConditions{
+			PublicKeys:         []types.UnlockKey{renterKey.UnlockKey(), h.PublicKey().UnlockKey()},
+			SignaturesRequired: 2,
+		},
+		FileContract: types.FileContract{
+			RevisionNumber:     1,
+			Filesize:           fc.Filesize,
+			FileMerkleRoot:     fc.FileMerkleRoot,
+			WindowStart:        fc.WindowStart,
+			WindowEnd:          fc.WindowEnd,
+			ValidProofOutputs:  fc.ValidProofOutputs,
+			MissedProofOutputs: fc.MissedProofOutputs,
+			UnlockHash:         fc.UnlockHash,
+		},
+	}
+	revHash := hashRevision(rev)
+	if len(renterSigs.RevisionSignature.Signature) != len(types.Signature{}) || !renterKey.VerifyHash(revHash, *(*types.Signature)(renterSigs.RevisionSignature.Signature)) {
+		return errors.New("renter's revision signature is invalid")
+	}
+	hostSig := h.privKey.SignHash(revHash)
+	hostRevisionSig := types.TransactionSignature{
+		ParentID:       types.Hash256(rev.ParentID),
+		CoveredFields:  types.CoveredFields{FileContractRevisions: []uint64{0}},
+		PublicKeyIndex: 1,
+		Signature:      hostSig[:],
+	}
+
+	h.mu.Lock()
+	h.contracts[rev.ParentID] = &hostContract{
+		rev: rhpv2.ContractRevision{
+			Revision:   rev,
+			Signatures: [2]types.TransactionSignature{renterSigs.RevisionSignature, hostRevisionSig},
+		},
+		renterKey: renterKey,
+	}
+	h.mu.Unlock()
+	return t.WriteResponse(&rhpv2.RPCFormContractSignatures{RevisionSignature: hostRevisionSig})
+}
+
+func (h *Host) rpcLock(t *rhpv2.Transport, locked *types.FileContractID) error {
+	var req rhpv2.RPCLockRequest
+	if err := t.ReadRequest(&req, 4096); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	c, ok := h.contracts[req.ContractID]
+	if !ok {
+		h.mu.Unlock()
+		return errors.New("contract not found")
+	}
+	newChallenge, ok := t.VerifyChallenge(req.Signature, c.renterKey)
+	if !ok {
+		h.mu.Unlock()
+		return errors.New("challenge signature is invalid")
+	}
+	acquired := !c.locked
+	if acquired {
+		h.unlockContract(*locked)
+		c.locked = true
+		*locked = req.ContractID
+	}
+	rev := c.rev
+	h.mu.Unlock()
+
+	return t.WriteResponse(&rhpv2.RPCLockResponse{
+		Acquired:     acquired,
+		NewChallenge: newChallenge,
+		Revision:     rev.Revision,
+		Signatures:   rev.Signatures[:],
+	})
+}
+
+func (h *Host) rpcRead(t *rhpv2.Transport, locked types.FileContractID) error {
+	var req rhpv2.RPCReadRequest
+	if err := t.ReadRequest(&req, 4096*4); err != nil {
+		return err
+	}
+
+	// read the requested sections
+	var sections [][]byte
+	for _, sec := range req.Sections {
+		sector, ok := h.Sector(sec.MerkleRoot)
+		if !ok {
+			return ErrSectorNotFound
+		} else if sec.Offset+sec.Length > rhpv2.SectorSize || sec.Offset%rhpv2.LeafSize != 0 || sec.Length%rhpv2.LeafSize != 0 {
+			return errors.New("invalid section")
+		}
+		sections = append(sections, sector)
+	}
+
+	// sign the new revision
+	hostSig, err := h.revise(locked, req.RevisionNumber, req.ValidProofValues, req.MissedProofValues, req.Signature, nil)
+	if err != nil {
+		return err
+	}
+
+	// send the sections, the signature is sent along with the last one
+	for i, sec := range req.Sections {
+		resp := &readResponse{Data: sections[i][sec.Offset:][:sec.Length]}
+		if req.MerkleProof {
+			start, end := sec.Offset/rhpv2.LeafSize, (sec.Offset+sec.Length)/rhpv2.LeafSize
+			resp.MerkleProof = rhpv2.BuildProof((*[rhpv2.SectorSize]byte)(sections[i]), start, end, nil)
+		}
+		if i == len(req.Sections)-1 {
+			resp.Signature = hostSig[:]
+		}
+		if err := t.WriteResponse(resp); err != nil {
+			return err
+		}
+	}
+
+	// wait for the renter to stop the RPC
+	var stop types.Specifier
+	if err := t.ReadResponse(&stop, 16); err != nil {
+		return err
+	} else if stop != rhpv2.RPCReadStop {
+		return errors.New("expected stop signal")
+	}
+	return nil
+}
+
+func (h *Host) rpcSectorRoots(t *rhpv2.Transport, locked types.FileContractID) error {
+	var req rhpv2.RPCSectorRootsRequest
+	if err := t.ReadRequest(&req, 4096); err != nil {
+		return err
+	}
+
+	roots, ok := h.ContractRoots(locked)
+	if !ok {
+		return errors.New("no contract locked")
+	} else if req.RootOffset+req.NumRoots > uint64(len(roots)) {
+		return errors.New("requested range is out-of-bounds")
+	}
+	hostSig, err := h.revise(locked, req.RevisionNumber, req.ValidProofValues, req.MissedProofValues, req.Signature, nil)
+	if err != nil {
+		return err
+	}
+	return t.WriteResponse(&rhpv2.RPCSectorRootsResponse{
+		Signature:   hostSig,
+		SectorRoots: roots[req.RootOffset:][:req.NumRoots],
+		MerkleProof: rhpv2.BuildSectorRangeProof(roots, req.RootOffset, req.RootOffset+req.NumRoots),
+	})
+}
+
+func (h *Host) rpcWrite(t *rhpv2.Transport, locked types.FileContractID) error {
+	var req rhpv2.RPCWriteRequest
+	if err := t.ReadRequest(&req, maxWriteRequestSize); err != nil {
+		return err
+	}
+
+	// apply the actions to a copy of the contract's roots
+	oldRoots, ok := h.ContractRoots(locked)
+	if !ok {
+		return errors.New("no contract locked")
+	}
+	roots := append([]types.Hash256(nil), oldRoots...)
+	var sectors []*[rhpv2.SectorSize]byte
+	for _, action := range req.Actions {
+		switch action.Type {
+		case rhpv2.RPCWriteActionAppend:
+			if len(action.Data) != rhpv2.SectorSize {
+				return errors.New("invalid sector size")
+			}
+			sector := (*[rhpv2.SectorSize]byte)(action.Data)
+			sectors = append(sectors, sector)
+			roots = append(roots, rhpv2.SectorRoot(sector))
+		case rhpv2.RPCWriteActionTrim:
+			if action.A > uint64(len(roots)) {
+				return errors.New("trim out of bounds")
+			}
+			roots = roots[:uint64(len(roots))-action.A]
+		case rhpv2.RPCWriteActionSwap:
+			if action.A >= uint64(len(roots)) || action.B >= uint64(len(roots)) {
+				return errors.New("swap out of bounds")
+			}
+			roots[action.A], roots[action.B] = roots[action.B], roots[action.A]
+		default:
+			return fmt.Errorf("unsupported write action %v", action.Type)
+		}
+	}
+
+	// send the Merkle proof and exchange signatures
+	newRoot := rhpv2.MetaRoot(roots)
+	resp := &rhpv2.RPCWriteMerkleProof{NewMerkleRoot: newRoot}
+	if req.MerkleProof {
+		resp.OldSubtreeHashes, resp.OldLeafHashes = rhpv2.BuildDiffProof(req.Actions, oldRoots)
+	}
+	if err := t.WriteResponse(resp); err != nil {
+		return err
+	}
+	var renterSig rhpv2.RPCWriteResponse
+	if err := t.ReadResponse(&renterSig, 4096); err != nil {
+		return err
+	}
+	hostSig, err := h.revise(locked, req.RevisionNumber, req.ValidProofValues, req.MissedProofValues, renterSig.Signature, func(rev *types.FileContractRevision) {
+		rev.Filesize = uint64(len(roots)) * rhpv2.SectorSize
+		rev.FileMerkleRoot = newRoot
+	})
+	if err != nil {
+		return err
+	}
+
+	// store the sectors once the revision is signed
+	for _, sector := range sectors {
+		h.AddSector(sector)
+	}
+	h.mu.Lock()
+	h.contracts[locked].roots = roots
+	h.mu.Unlock()
+	return t.WriteResponse(&rhpv2.RPCWriteResponse{Signature: hostSig})
+}
+
+// revise updates the revision of the locked contract if the renter's signature
+// is valid, it returns the host's signature.
+func (h *Host) revise(id types.FileContractID, revisionNumber uint64, valid, missed []types.Currency, renterSig types.Signature, update func(*types.FileContractRevision)) (types.Signature, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c, ok := h.contracts[id]
+	if !ok {
+		return types.Signature{}, errors.New("no contract locked")
+	}
+
+	rev := c.rev.Revision
+	if revisionNumber <= rev.RevisionNumber {
+		return types.Signature{}, errors.New("revision number must increase")
+	} else if len(valid) != len(rev.ValidProofOutputs) || len(missed) != len(rev.MissedProofOutputs) {
+		return types.Signature{}, errors.New("wrong number of proof outputs")
+	}
+	rev.RevisionNumber = revisionNumber
+	rev.ValidProofOutputs = append([]types.SiacoinOutput(nil), rev.ValidProofOutputs...)
+	rev.MissedProofOutputs = append([]types.SiacoinOutput(nil), rev.MissedProofOutputs...)
+	for i := range valid {
+		rev.ValidProofOutputs[i].Value = valid[i]
+	}
+	for i := range missed {
+		rev.MissedProofOutputs[i].Value = missed[i]
+	}
+	if update != nil {
+		update(&rev)
+	}
+
+	revHash := hashRevision(rev)
+	if !c.renterKey.VerifyHash(revHash, renterSig) {
+		return types.Signature{}, errors.New("renter's signature is invalid")
+	}
+	hostSig := h.privKey.SignHash(revHash)
+	c.rev.Revision = rev
+	c.rev.Signatures[0].Signature = renterSig[:]
+	c.rev.Signatures[1].Signature = hostSig[:]
+	return hostSig, nil
+}
+
+func (h *Host) unlock(id types.FileContractID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.unlockContract(id)
+}
+
+func (h *Host) unlockContract(id types.FileContractID) {
+	if c, ok := h.contracts[id]; ok {
+		c.locked = false
+	}
+}
+
+func hashRevision(rev types.FileContractRevision) types.Hash256 {
+	h := types.NewHasher()
+	rev.EncodeTo(h.E)
+	return h.Sum()
+}
+
+// readResponse is a Read RPC response whose signature is only sent along with
+// the last section.
+type readResponse struct {
+	Signature   []byte
+	Data        []byte
+	MerkleProof []types.Hash256
+}
+
+// EncodeTo implements rhpv2.ProtocolObject.
+func (r *readResponse) EncodeTo(e *types.Encoder) {
+	e.WriteBytes(r.Signature)
+	e.WriteBytes(r.Data)
+	e.WritePrefix(len(r.MerkleProof))
+	for i := range r.MerkleProof {
+		e.Write(r.MerkleProof[i][:])
+	}
+}
+
+// DecodeFrom implements rhpv2.ProtocolObject.
+func (r *readResponse) DecodeFrom(d *types.Decoder) {
+	r.Signature = d.ReadBytes()
+	r.Data = d.ReadBytes()
+	r.MerkleProof = make([]types.Hash256, d.ReadPrefix())
+	for i := range r.MerkleProof {
+		d.Read(r.MerkleProof[i][:])
+	}
+}
+
+func (h *Host) isOffline() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.offline
+}
@@ -0,0 +1,176 @@
+package mocks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/worker"
+	"lukechampine.com/frand"
+)
+
+func TestHostTransfers(t *testing.T) {
+	h := NewHost()
+
+	// upload a sector
+	var sector [rhpv2.SectorSize]byte
+	frand.Read(sector[:])
+	root, err := h.UploadSector(context.Background(), &sector)
+	if err != nil {
+		t.Fatal(err)
+	} else if root != rhpv2.SectorRoot(&sector) {
+		t.Fatal("unexpected root")
+	}
+
+	// download part of it
+	var buf bytes.Buffer
+	if err := h.DownloadSector(context.Background(), &buf, root, 64, 128); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf.Bytes(), sector[64:192]) {
+		t.Fatal("unexpected data")
+	}
+
+	// take the host offline
+	h.SetOffline(true)
+	if err := h.DownloadSector(context.Background(), &buf, root, 0, 64); !errors.Is(err, ErrHostOffline) {
+		t.Fatal("expected ErrHostOffline, got", err)
+	}
+	h.SetOffline(false)
+
+	// delete the sector
+	if err := h.DeleteSectors(context.Background(), h.Sectors()); err != nil {
+		t.Fatal(err)
+	} else if err := h.DownloadSector(context.Background(), &buf, root, 0, 64); !errors.Is(err, ErrSectorNotFound) {
+		t.Fatal("expected ErrSectorNotFound, got", err)
+	}
+}
+
+func TestHostSettingsRPC(t *testing.T) {
+	h := NewHost()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go h.Serve(l)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	transport, err := rhpv2.NewRenterTransport(conn, h.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.Close()
+
+	var resp rhpv2.RPCSettingsResponse
+	var settings rhpv2.HostSettings
+	if err := transport.Call(rhpv2.RPCSettingsID, nil, &resp); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(resp.Settings, &settings); err != nil {
+		t.Fatal(err)
+	} else if settings.NetAddress != l.Addr().String() {
+		t.Fatal("unexpected net address", settings.NetAddress)
+	} else if !settings.AcceptingContracts {
+		t.Fatal("expected host to accept contracts")
+	}
+}
+
+func TestHostRPCs(t *testing.T) {
+	h := NewHost()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go h.Serve(l)
+
+	// form a contract
+	ctx := context.Background()
+	renterKey := types.GeneratePrivateKey()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport, err := rhpv2.NewRenterTransport(conn, h.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc := rhpv2.PrepareContractFormation(renterKey, h.PublicKey(), types.Siacoins(10), types.Siacoins(20), 100, h.Settings(), types.Address{})
+	rev, _, err := worker.RPCFormContract(ctx, transport, renterKey, []types.Transaction{{FileContracts: []types.FileContract{fc}}})
+	transport.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// lock it and upload two sectors
+	s := worker.NewSession(nil, renterKey, rhpv2.ContractRevision{}, rhpv2.HostSettings{})
+	if err := s.Reconnect(ctx, l.Addr().String(), h.PublicKey(), renterKey, rev.ID()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var sectors [2][rhpv2.SectorSize]byte
+	var roots []types.Hash256
+	for i := range sectors {
+		frand.Read(sectors[i][:])
+		root, err := s.Append(ctx, &sectors[i], types.Siacoins(1), types.ZeroCurrency, types.ZeroCurrency)
+		if err != nil {
+			t.Fatal(err)
+		}
+		roots = append(roots, root)
+	}
+	if stored, ok := h.ContractRoots(rev.ID()); !ok || len(stored) != 2 || stored[0] != roots[0] || stored[1] != roots[1] {
+		t.Fatal("unexpected contract roots", stored)
+	} else if _, ok := h.Sector(roots[1]); !ok {
+		t.Fatal("sector wasn't stored")
+	}
+
+	// the contract is locked by the session
+	conn2, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t2, err := rhpv2.NewRenterTransport(conn2, h.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lockResp rhpv2.RPCLockResponse
+	if err := t2.Call(rhpv2.RPCLockID, &rhpv2.RPCLockRequest{ContractID: rev.ID(), Signature: t2.SignChallenge(renterKey)}, &lockResp); err != nil {
+		t.Fatal(err)
+	} else if lockResp.Acquired {
+		t.Fatal("expected contract to be locked")
+	}
+	t2.Close()
+
+	// fetch the roots and read parts of both sectors
+	if fetched, err := s.SectorRoots(ctx, 0, 2, types.Siacoins(1)); err != nil {
+		t.Fatal(err)
+	} else if fetched[0] != roots[0] || fetched[1] != roots[1] {
+		t.Fatal("unexpected roots", fetched)
+	}
+	var buf bytes.Buffer
+	if err := s.Read(ctx, &buf, []rhpv2.RPCReadRequestSection{
+		{MerkleRoot: roots[0], Offset: 64, Length: 128},
+		{MerkleRoot: roots[1], Offset: 0, Length: 64},
+	}, types.Siacoins(1)); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf.Bytes(), append(sectors[0][64:192:192], sectors[1][:64]...)) {
+		t.Fatal("unexpected data")
+	}
+
+	// delete the first sector
+	if err := s.Delete(ctx, []uint64{0}, types.Siacoins(1)); err != nil {
+		t.Fatal(err)
+	} else if stored, _ := h.ContractRoots(rev.ID()); len(stored) != 1 || stored[0] != roots[1] {
+		t.Fatal("unexpected contract roots", stored)
+	} else if s.Revision().NumSectors() != 1 {
+		t.Fatal("unexpected number of sectors", s.Revision().NumSectors())
+	}
+}
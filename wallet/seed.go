@@ -9,7 +9,9 @@ import (
 	"strings"
 
 	"go.sia.tech/core/types"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/chacha20poly1305"
 )
 
 // NOTE: This is not a full implementation of BIP39; only 12-word phrases (128
@@ -30,24 +32,81 @@ func NewSeedPhrase() string {
 	return encodeBIP39Phrase(&entropy)
 }
 
-// KeyFromPhrase returns the Ed25519 key derived from the supplied seed phrase.
-func KeyFromPhrase(phrase string) (types.PrivateKey, error) {
+// SeedFromPhrase returns the 32-byte wallet seed derived from the supplied seed
+// phrase.
+func SeedFromPhrase(phrase string) (*[32]byte, error) {
 	entropy, err := decodeBIP39Phrase(phrase)
 	if err != nil {
 		return nil, err
 	}
-	h := blake2b.Sum256(entropy[:])
+	seed := blake2b.Sum256(entropy[:])
 	memclr(entropy[:])
+	return &seed, nil
+}
+
+// KeyFromSeed returns the Ed25519 key of the wallet address with the given
+// index. The keys are derived the same way as by other Sia wallets, so the
+// addresses can be found by any wallet restored from the same seed phrase.
+func KeyFromSeed(seed *[32]byte, index uint64) types.PrivateKey {
 	buf := make([]byte, 32+8)
-	copy(buf[:32], h[:])
+	copy(buf[:32], seed[:])
+	binary.LittleEndian.PutUint64(buf[32:], index)
+	h := blake2b.Sum256(buf)
+	memclr(buf)
+	key := types.NewPrivateKeyFromSeed(h[:])
 	memclr(h[:])
-	binary.LittleEndian.PutUint64(buf[32:], 0)
-	seed := blake2b.Sum256(buf)
-	key := types.NewPrivateKeyFromSeed(seed[:])
+	return key
+}
+
+// KeyFromPhrase returns the Ed25519 key of the wallet's primary address derived
+// from the supplied seed phrase.
+func KeyFromPhrase(phrase string) (types.PrivateKey, error) {
+	seed, err := SeedFromPhrase(phrase)
+	if err != nil {
+		return nil, err
+	}
+	key := KeyFromSeed(seed, 0)
 	memclr(seed[:])
 	return key, nil
 }
 
+// EncryptSeedPhrase encrypts the given seed phrase using a key derived from the
+// given passphrase.
+func EncryptSeedPhrase(phrase, passphrase string) []byte {
+	var salt [16]byte
+	if _, err := rand.Read(salt[:]); err != nil {
+		panic("insufficient system entropy")
+	}
+	key := argon2.IDKey([]byte(passphrase), salt[:], 1, 64*1024, 4, chacha20poly1305.KeySize)
+	defer memclr(key)
+	aead, _ := chacha20poly1305.NewX(key)
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic("insufficient system entropy")
+	}
+	out := append(salt[:], nonce...)
+	return aead.Seal(out, nonce, []byte(phrase), nil)
+}
+
+// DecryptSeedPhrase decrypts a seed phrase that was encrypted using
+// EncryptSeedPhrase.
+func DecryptSeedPhrase(ciphertext []byte, passphrase string) (string, error) {
+	if len(ciphertext) < 16+chacha20poly1305.NonceSizeX {
+		return "", errors.New("encrypted seed is too short")
+	}
+	salt, nonce := ciphertext[:16], ciphertext[16:16+chacha20poly1305.NonceSizeX]
+	key := argon2.IDKey([]byte(passphrase), salt, 1, 64*1024, 4, chacha20poly1305.KeySize)
+	defer memclr(key)
+	aead, _ := chacha20poly1305.NewX(key)
+
+	phrase, err := aead.Open(nil, nonce, ciphertext[16+chacha20poly1305.NonceSizeX:], nil)
+	if err != nil {
+		return "", errors.New("failed to decrypt seed, wrong passphrase")
+	}
+	return string(phrase), nil
+}
+
 func bip39checksum(entropy *[16]byte) uint64 {
 	hash := sha256.Sum256(entropy[:])
 	return uint64((hash[0] & 0xF0) >> 4)
@@ -0,0 +1,107 @@
+package wallet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.sia.tech/core/types"
+)
+
+// signerTimeout is the timeout for a signing request to an external signer,
+// hardware wallets might require user interaction.
+const signerTimeout = 5 * time.Minute
+
+type (
+	// A Signer provides signatures for the wallet's transactions, e.g. a
+	// hardware wallet or a KMS. It allows the wallet to sign transactions
+	// without holding its private key.
+	Signer interface {
+		Sign(req SignRequest) ([]types.TransactionSignature, error)
+	}
+
+	// A SignRequest asks a signer to sign the given inputs of a transaction.
+	SignRequest struct {
+		Transaction   types.Transaction   `json:"transaction"`
+		ToSign        []types.Hash256     `json:"toSign"`
+		CoveredFields types.CoveredFields `json:"coveredFields"`
+
+		// Inputs contains the public key that has to sign each input and the
+		// hash it has to sign, in the order of ToSign.
+		Inputs []SignInput `json:"inputs"`
+	}
+
+	// A SignInput is an input that has to be signed by a signer.
+	SignInput struct {
+		ParentID  types.Hash256   `json:"parentID"`
+		PublicKey types.PublicKey `json:"publicKey"`
+		SigHash   types.Hash256   `json:"sigHash"`
+	}
+
+	// SignResponse is the response of a signer, it contains a signature for
+	// every input in the request.
+	SignResponse struct {
+		Signatures []types.TransactionSignature `json:"signatures"`
+	}
+)
+
+// An HTTPSigner is a Signer that POSTs sign requests to an HTTP endpoint,
+// which may be served over a unix socket.
+type HTTPSigner struct {
+	url    string
+	client *http.Client
+}
+
+// Sign implements Signer.
+func (s *HTTPSigner) Sign(req SignRequest) ([]types.TransactionSignature, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), signerTimeout)
+	defer cancel()
+
+	js, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(js))
+	if err != nil {
+		return nil, err
+	}
+	hreq.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(hreq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("signer responded with status %v: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	var sr SignResponse
+	if err := json.NewDecoder(resp.Body).Decode(&sr); err != nil {
+		return nil, err
+	}
+	return sr.Signatures, nil
+}
+
+// NewHTTPSigner returns a signer that sends sign requests to the given address.
+// The address is either an HTTP URL or the path of a unix socket prefixed
+// with "unix://", requests to a socket are POSTed to /sign.
+func NewHTTPSigner(addr string) *HTTPSigner {
+	if path := strings.TrimPrefix(addr, "unix://"); path != addr {
+		return &HTTPSigner{
+			url: "http://unix/sign",
+			client: &http.Client{Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", path)
+				},
+			}},
+		}
+	}
+	return &HTTPSigner{url: addr, client: http.DefaultClient}
+}
@@ -3,6 +3,7 @@ package wallet
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"reflect"
 	"sort"
 	"sync"
@@ -19,10 +20,44 @@ import (
 // TransactionSignature, assuming standard UnlockConditions.
 const BytesPerInput = 241
 
+// The mainnet hardfork heights core uses to pick the replay protection prefix.
+const (
+	mainnetHardforkASIC       = 179000
+	mainnetHardforkFoundation = 298000
+)
+
 // ErrInsufficientBalance is returned when there aren't enough unused outputs to
 // cover the requested amount.
 var ErrInsufficientBalance = errors.New("insufficient balance")
 
+// ErrWalletLocked is returned when trying to sign a transaction while the
+// wallet is locked.
+var ErrWalletLocked = errors.New("wallet is locked")
+
+// ErrWatchOnly is returned when trying to sign a transaction or derive keys
+// using a watch-only wallet.
+var ErrWatchOnly = errors.New("wallet is watch-only")
+
+// ErrUnknownPublicKey is returned when trying to spend outputs of a watch-only
+// wallet that only knows its address.
+var ErrUnknownPublicKey = errors.New("public key of the wallet's address is unknown")
+
+// ErrExternalSigner is returned when trying to derive keys using a wallet
+// whose transactions are signed by an external signer.
+var ErrExternalSigner = errors.New("wallet keys are held by an external signer")
+
+// ErrRescanInProgress is returned when trying to rescan the wallet while a
+// previous rescan hasn't finished yet.
+var ErrRescanInProgress = errors.New("wallet rescan already in progress")
+
+// ErrNoEncryptedSeed is returned when trying to lock or unlock a wallet that
+// has no encrypted seed.
+var ErrNoEncryptedSeed = errors.New("wallet has no encrypted seed")
+
+// ErrUnknownSeedPhrase is returned when trying to export the seed of a wallet
+// that neither has an encrypted seed nor knows its seed phrase.
+var ErrUnknownSeedPhrase = errors.New("wallet's seed phrase is unknown")
+
 // StandardUnlockConditions returns the standard unlock conditions for a single
 // Ed25519 key.
 func StandardUnlockConditions(pk types.PublicKey) types.UnlockConditions {
@@ -91,6 +126,10 @@ type SiacoinElement struct {
 	types.SiacoinOutput
 	ID             types.Hash256
 	MaturityHeight uint64
+
+	// ConfirmationHeight is the height of the block that created the
+	// output.
+	ConfirmationHeight uint64
 }
 
 // A Transaction is an on-chain transaction relevant to a particular wallet,
@@ -110,6 +149,15 @@ type SingleAddressStore interface {
 	Balance() types.Currency
 	UnspentSiacoinElements() ([]SiacoinElement, error)
 	Transactions(since time.Time, max int) ([]Transaction, error)
+
+	// Addresses returns the addresses tracked by the store in the order they
+	// were derived, AddAddress starts tracking an additional address.
+	Addresses() []types.Address
+	AddAddress(addr types.Address) error
+
+	// Rescan resets the state of the store and rebuilds it from the
+	// blockchain, keeping the state below fromHeight.
+	Rescan(fromHeight uint64) error
 }
 
 // A TransactionPool contains transactions that have not yet been included in a
@@ -119,27 +167,199 @@ type TransactionPool interface {
 }
 
 // A SingleAddressWallet is a hot wallet that manages the outputs controlled by
-// a single address.
+// a primary address. Additional addresses can be derived from the wallet's key
+// to receive funds, outputs of all addresses are spent by the wallet.
 type SingleAddressWallet struct {
-	priv  types.PrivateKey
+	pub   types.PublicKey
 	addr  types.Address
 	store SingleAddressStore
 
+	// for locking and unlocking the wallet, watch-only wallets never hold a
+	// seed or private key, the seed phrase is only known to wallets created
+	// from it or unlocked using the encrypted seed
+	keyMu         sync.Mutex
+	seed          *[32]byte
+	priv          types.PrivateKey
+	phrase        []byte
+	encryptedSeed []byte
+	watchOnly     bool
+	signer        Signer
+
+	// derived addresses, protected by keyMu, pubs holds the public key of
+	// every address by derivation index
+	pubs  []types.PublicKey
+	addrs map[types.Address]uint64
+
 	// for building transactions
 	mu   sync.Mutex
 	used map[types.Hash256]bool
 }
 
-// PrivateKey returns the private key of the wallet.
+// PrivateKey returns a copy of the private key of the wallet, it returns nil if
+// the wallet is locked.
 func (w *SingleAddressWallet) PrivateKey() types.PrivateKey {
-	return w.priv
+	w.keyMu.Lock()
+	defer w.keyMu.Unlock()
+	if w.priv == nil {
+		return nil
+	}
+	return append(types.PrivateKey(nil), w.priv...)
 }
 
-// Address returns the address of the wallet.
+// SetEncryptedSeed sets the encrypted seed phrase used to unlock the wallet.
+// The wallet can only be locked after an encrypted seed was set.
+func (w *SingleAddressWallet) SetEncryptedSeed(encryptedSeed []byte) {
+	w.keyMu.Lock()
+	defer w.keyMu.Unlock()
+	w.encryptedSeed = append([]byte(nil), encryptedSeed...)
+}
+
+// WatchOnly returns true if the wallet only holds its public key, its
+// transactions have to be signed externally.
+func (w *SingleAddressWallet) WatchOnly() bool {
+	return w.watchOnly
+}
+
+// Locked returns true if the wallet is locked. Watch-only wallets and wallets
+// using an external signer are never locked.
+func (w *SingleAddressWallet) Locked() bool {
+	w.keyMu.Lock()
+	defer w.keyMu.Unlock()
+	return !w.watchOnly && w.priv == nil && w.signer == nil
+}
+
+// Lock removes the private key from memory, causing all signing operations to
+// fail until the wallet is unlocked again. Only the wallet's own copy of the
+// key is zeroed, the key the wallet was created with is left untouched. Keys
+// derived from the wallet key, e.g. the worker's master key, aren't affected
+// either.
+func (w *SingleAddressWallet) Lock() error {
+	w.keyMu.Lock()
+	defer w.keyMu.Unlock()
+	if w.watchOnly {
+		return ErrWatchOnly
+	} else if w.encryptedSeed == nil {
+		return ErrNoEncryptedSeed
+	}
+	memclr(w.seed[:])
+	memclr(w.priv)
+	memclr(w.phrase)
+	w.seed, w.priv, w.phrase = nil, nil, nil
+	return nil
+}
+
+// Unlock decrypts the wallet's seed using the given passphrase and restores
+// its private key.
+func (w *SingleAddressWallet) Unlock(passphrase string) error {
+	w.keyMu.Lock()
+	defer w.keyMu.Unlock()
+	if w.watchOnly {
+		return ErrWatchOnly
+	} else if w.encryptedSeed == nil {
+		return ErrNoEncryptedSeed
+	}
+	phrase, err := DecryptSeedPhrase(w.encryptedSeed, passphrase)
+	if err != nil {
+		return err
+	}
+	seed, err := SeedFromPhrase(phrase)
+	if err != nil {
+		return err
+	}
+	priv := KeyFromSeed(seed, 0)
+	if priv.PublicKey() != w.pub {
+		memclr(seed[:])
+		memclr(priv)
+		return errors.New("seed doesn't match the wallet's address")
+	}
+	w.seed, w.priv, w.phrase = seed, priv, []byte(phrase)
+	return nil
+}
+
+// ExportSeed returns the wallet's seed phrase encrypted with the export
+// passphrase. If the wallet has an encrypted seed, it's decrypted using the
+// given passphrase, otherwise the seed phrase the wallet was created from is
+// exported and the passphrase is ignored.
+func (w *SingleAddressWallet) ExportSeed(passphrase, exportPassphrase string) ([]byte, error) {
+	w.keyMu.Lock()
+	defer w.keyMu.Unlock()
+	if w.watchOnly {
+		return nil, ErrWatchOnly
+	} else if w.encryptedSeed != nil {
+		phrase, err := DecryptSeedPhrase(w.encryptedSeed, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		return EncryptSeedPhrase(phrase, exportPassphrase), nil
+	} else if w.phrase == nil {
+		return nil, ErrUnknownSeedPhrase
+	}
+	return EncryptSeedPhrase(string(w.phrase), exportPassphrase), nil
+}
+
+// Address returns the primary address of the wallet.
 func (w *SingleAddressWallet) Address() types.Address {
 	return w.addr
 }
 
+// Addresses returns all addresses controlled by the wallet, starting with the
+// primary address.
+func (w *SingleAddressWallet) Addresses() []types.Address {
+	w.keyMu.Lock()
+	defer w.keyMu.Unlock()
+	addrs := make([]types.Address, len(w.pubs))
+	for i, pub := range w.pubs {
+		addrs[i] = StandardAddress(pub)
+	}
+	return addrs
+}
+
+// OwnsAddress returns true if the address is controlled by the wallet.
+func (w *SingleAddressWallet) OwnsAddress(addr types.Address) bool {
+	w.keyMu.Lock()
+	defer w.keyMu.Unlock()
+	_, exists := w.addrs[addr]
+	return exists
+}
+
+// NextAddress derives a fresh address from the wallet's key and starts
+// tracking it. The wallet has to be unlocked to derive new addresses.
+func (w *SingleAddressWallet) NextAddress() (types.Address, error) {
+	w.keyMu.Lock()
+	defer w.keyMu.Unlock()
+	if w.watchOnly {
+		return types.Address{}, ErrWatchOnly
+	} else if w.signer != nil {
+		return types.Address{}, ErrExternalSigner
+	} else if w.priv == nil {
+		return types.Address{}, ErrWalletLocked
+	}
+	key := KeyFromSeed(w.seed, uint64(len(w.pubs)))
+	pub := key.PublicKey()
+	memclr(key)
+
+	addr := StandardAddress(pub)
+	if err := w.store.AddAddress(addr); err != nil {
+		return types.Address{}, err
+	}
+	w.addrs[addr] = uint64(len(w.pubs))
+	w.pubs = append(w.pubs, pub)
+	return addr, nil
+}
+
+// unlockConditions returns the unlock conditions of the given address.
+func (w *SingleAddressWallet) unlockConditions(addr types.Address) (types.UnlockConditions, error) {
+	w.keyMu.Lock()
+	defer w.keyMu.Unlock()
+	index, exists := w.addrs[addr]
+	if !exists {
+		return types.UnlockConditions{}, fmt.Errorf("address %v is not controlled by the wallet", addr)
+	} else if index >= uint64(len(w.pubs)) {
+		return types.UnlockConditions{}, ErrUnknownPublicKey
+	}
+	return StandardUnlockConditions(w.pubs[index]), nil
+}
+
 // Balance returns the balance of the wallet.
 func (w *SingleAddressWallet) Balance() types.Currency {
 	return w.store.Balance()
@@ -151,6 +371,39 @@ func (w *SingleAddressWallet) UnspentOutputs() ([]SiacoinElement, error) {
 	return w.store.UnspentSiacoinElements()
 }
 
+// SpendableOutputs returns the unspent Siacoin outputs controlled by the wallet
+// that matured and aren't used by another transaction.
+func (w *SingleAddressWallet) SpendableOutputs(cs consensus.State, pool []types.Transaction) ([]SiacoinElement, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	utxos, err := w.store.UnspentSiacoinElements()
+	if err != nil {
+		return nil, err
+	}
+	inPool := poolInputs(pool)
+	var spendable []SiacoinElement
+	for _, sce := range utxos {
+		if !w.used[sce.ID] && !inPool[sce.ID] && cs.Index.Height >= sce.MaturityHeight {
+			spendable = append(spendable, sce)
+		}
+	}
+	return spendable, nil
+}
+
+// Rescan rebuilds the wallet's outputs and transaction history from the
+// blockchain, starting at fromHeight. The outputs and transactions below that
+// height are kept. Inputs reserved by pending transactions are released.
+func (w *SingleAddressWallet) Rescan(fromHeight uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.store.Rescan(fromHeight); err != nil {
+		return err
+	}
+	w.used = make(map[types.Hash256]bool)
+	return nil
+}
+
 // Transactions returns up to max transactions relevant to the wallet that have
 // a timestamp later than since.
 func (w *SingleAddressWallet) Transactions(since time.Time, max int) ([]Transaction, error) {
@@ -169,12 +422,7 @@ func (w *SingleAddressWallet) FundTransaction(cs consensus.State, txn *types.Tra
 	}
 
 	// avoid reusing any inputs currently in the transaction pool
-	inPool := make(map[types.Hash256]bool)
-	for _, ptxn := range pool {
-		for _, in := range ptxn.SiacoinInputs {
-			inPool[types.Hash256(in.ParentID)] = true
-		}
-	}
+	inPool := poolInputs(pool)
 
 	utxos, err := w.store.UnspentSiacoinElements()
 	if err != nil {
@@ -197,18 +445,77 @@ func (w *SingleAddressWallet) FundTransaction(cs consensus.State, txn *types.Tra
 	}
 	if outputSum.Cmp(amount) < 0 {
 		return nil, ErrInsufficientBalance
-	} else if outputSum.Cmp(amount) > 0 {
+	}
+	return w.addFundingElements(txn, fundingElements, amount)
+}
+
+// FundTransactionWithOutputs adds the given siacoin outputs as inputs to the
+// provided transaction, all of them are spent even if a subset covers the
+// requested amount. A change output is also added, if necessary. Like
+// FundTransaction, the inputs are not available to future calls until
+// ReleaseInputs is called.
+func (w *SingleAddressWallet) FundTransactionWithOutputs(cs consensus.State, txn *types.Transaction, amount types.Currency, outputs []types.Hash256, pool []types.Transaction) ([]types.Hash256, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	inPool := poolInputs(pool)
+	utxos, err := w.store.UnspentSiacoinElements()
+	if err != nil {
+		return nil, err
+	}
+	elems := make(map[types.Hash256]SiacoinElement)
+	for _, sce := range utxos {
+		elems[sce.ID] = sce
+	}
+
+	var outputSum types.Currency
+	var fundingElements []SiacoinElement
+	for _, id := range outputs {
+		sce, exists := elems[id]
+		if !exists {
+			return nil, fmt.Errorf("output %v is not an unspent output of the wallet", id)
+		} else if w.used[id] || inPool[id] {
+			return nil, fmt.Errorf("output %v is already being spent", id)
+		} else if cs.Index.Height < sce.MaturityHeight {
+			return nil, fmt.Errorf("output %v hasn't matured yet", id)
+		}
+		delete(elems, id) // avoid spending the same output twice
+		fundingElements = append(fundingElements, sce)
+		outputSum = outputSum.Add(sce.Value)
+	}
+	if outputSum.Cmp(amount) < 0 {
+		return nil, ErrInsufficientBalance
+	}
+	return w.addFundingElements(txn, fundingElements, amount)
+}
+
+// addFundingElements adds the given elements as inputs to txn, sending
+// everything exceeding amount back to the wallet's address.
+func (w *SingleAddressWallet) addFundingElements(txn *types.Transaction, fundingElements []SiacoinElement, amount types.Currency) ([]types.Hash256, error) {
+	outputSum := SumOutputs(fundingElements)
+	if outputSum.Cmp(amount) > 0 {
 		txn.SiacoinOutputs = append(txn.SiacoinOutputs, types.SiacoinOutput{
 			Value:   outputSum.Sub(amount),
 			Address: w.addr,
 		})
 	}
 
+	// look up all unlock conditions before adding any input, so a failure
+	// doesn't leave outputs marked as used
+	ucs := make([]types.UnlockConditions, len(fundingElements))
+	for i, sce := range fundingElements {
+		uc, err := w.unlockConditions(sce.Address)
+		if err != nil {
+			return nil, err
+		}
+		ucs[i] = uc
+	}
+
 	toSign := make([]types.Hash256, len(fundingElements))
 	for i, sce := range fundingElements {
 		txn.SiacoinInputs = append(txn.SiacoinInputs, types.SiacoinInput{
 			ParentID:         types.SiacoinOutputID(sce.ID),
-			UnlockConditions: StandardUnlockConditions(w.priv.PublicKey()),
+			UnlockConditions: ucs[i],
 		})
 		toSign[i] = sce.ID
 		w.used[sce.ID] = true
@@ -217,6 +524,17 @@ func (w *SingleAddressWallet) FundTransaction(cs consensus.State, txn *types.Tra
 	return toSign, nil
 }
 
+// poolInputs returns the ids of the outputs spent by the given transactions.
+func poolInputs(pool []types.Transaction) map[types.Hash256]bool {
+	inPool := make(map[types.Hash256]bool)
+	for _, ptxn := range pool {
+		for _, in := range ptxn.SiacoinInputs {
+			inPool[types.Hash256(in.ParentID)] = true
+		}
+	}
+	return inPool
+}
+
 // ReleaseInputs is a helper function that releases the inputs of txn for use in
 // other transactions. It should only be called on transactions that are invalid
 // or will never be broadcast.
@@ -238,35 +556,119 @@ func convertToSiad(core types.EncoderTo, siad encoding.SiaUnmarshaler) {
 
 // SignTransaction adds a signature to each of the specified inputs.
 func (w *SingleAddressWallet) SignTransaction(cs consensus.State, txn *types.Transaction, toSign []types.Hash256, cf types.CoveredFields) error {
-	// NOTE: siad uses different hardfork heights when -tags=testing is set,
-	// so we have to alter cs accordingly.
-	// TODO: remove this
-	switch {
-	case cs.Index.Height >= uint64(stypes.FoundationHardforkHeight):
-		cs.Index.Height = 298000
-	case cs.Index.Height >= uint64(stypes.ASICHardforkHeight):
-		cs.Index.Height = 179000
+	w.keyMu.Lock()
+	defer w.keyMu.Unlock()
+	if w.watchOnly {
+		return ErrWatchOnly
+	} else if w.priv == nil && w.signer == nil {
+		return ErrWalletLocked
 	}
 
-	for _, id := range toSign {
-		ts := types.TransactionSignature{
-			ParentID:       id,
+	cs = replayState(cs)
+
+	// find the address of the input to sign, defaulting to the primary
+	// address for inputs that aren't part of the transaction
+	addrs := make(map[types.Hash256]types.Address)
+	for _, sci := range txn.SiacoinInputs {
+		addrs[types.Hash256(sci.ParentID)] = sci.UnlockConditions.UnlockHash()
+	}
+
+	inputs := make([]SignInput, len(toSign))
+	for i, id := range toSign {
+		var index uint64
+		if addr, exists := addrs[id]; exists {
+			if index, exists = w.addrs[addr]; !exists {
+				return fmt.Errorf("input %v is not controlled by the wallet", id)
+			}
+		}
+		inputs[i] = SignInput{
+			ParentID:  id,
+			PublicKey: w.pubs[index],
+			SigHash:   sigHash(cs, *txn, id, cf),
+		}
+	}
+	if w.signer != nil {
+		return w.signExternally(txn, toSign, cf, inputs)
+	}
+
+	for _, in := range inputs {
+		key := KeyFromSeed(w.seed, w.addrs[StandardAddress(in.PublicKey)])
+		sig := key.SignHash(in.SigHash)
+		memclr(key)
+		txn.Signatures = append(txn.Signatures, types.TransactionSignature{
+			ParentID:       in.ParentID,
 			CoveredFields:  cf,
 			PublicKeyIndex: 0,
+			Signature:      sig[:],
+		})
+	}
+	return nil
+}
+
+// signExternally asks the wallet's signer to sign the given inputs, the
+// signatures are verified before they're added to the transaction.
+func (w *SingleAddressWallet) signExternally(txn *types.Transaction, toSign []types.Hash256, cf types.CoveredFields, inputs []SignInput) error {
+	sigs, err := w.signer.Sign(SignRequest{
+		Transaction:   *txn,
+		ToSign:        toSign,
+		CoveredFields: cf,
+		Inputs:        inputs,
+	})
+	if err != nil {
+		return fmt.Errorf("external signer failed to sign transaction: %w", err)
+	} else if len(sigs) != len(inputs) {
+		return fmt.Errorf("external signer returned %v signatures, expected %v", len(sigs), len(inputs))
+	}
+	verified := make([]types.TransactionSignature, len(inputs))
+	for i, in := range inputs {
+		var sig types.Signature
+		if sigs[i].ParentID != in.ParentID || len(sigs[i].Signature) != len(sig) {
+			return fmt.Errorf("external signer returned an invalid signature for input %v", in.ParentID)
+		}
+		copy(sig[:], sigs[i].Signature)
+		if !in.PublicKey.VerifyHash(in.SigHash, sig) {
+			return fmt.Errorf("external signer returned an invalid signature for input %v", in.ParentID)
 		}
-		var h types.Hash256
-		if cf.WholeTransaction {
-			h = cs.WholeSigHash(*txn, ts.ParentID, ts.PublicKeyIndex, ts.Timelock, cf.Signatures)
-		} else {
-			h = cs.PartialSigHash(*txn, cf)
+		verified[i] = types.TransactionSignature{
+			ParentID:       in.ParentID,
+			CoveredFields:  cf,
+			PublicKeyIndex: 0,
+			Signature:      sig[:],
 		}
-		sig := w.priv.SignHash(h)
-		ts.Signature = sig[:]
-		txn.Signatures = append(txn.Signatures, ts)
 	}
+	txn.Signatures = append(txn.Signatures, verified...)
 	return nil
 }
 
+// replayState returns the state used to compute the sighashes of transactions
+// signed at the given state. core derives the replay protection prefix from
+// the mainnet hardfork heights, while siad uses the hardfork heights of the
+// network it was built for, e.g. Zen activates them at heights 20 and 30. The
+// height is moved into the mainnet era that uses the same prefix.
+func replayState(cs consensus.State) consensus.State {
+	switch {
+	case cs.Index.Height >= uint64(stypes.FoundationHardforkHeight):
+		if cs.Index.Height < mainnetHardforkFoundation {
+			cs.Index.Height = mainnetHardforkFoundation
+		}
+	case cs.Index.Height >= uint64(stypes.ASICHardforkHeight):
+		cs.Index.Height = mainnetHardforkASIC
+	default:
+		if cs.Index.Height >= mainnetHardforkASIC {
+			cs.Index.Height = mainnetHardforkASIC - 1
+		}
+	}
+	return cs
+}
+
+// sigHash returns the hash that has to be signed to spend the given input.
+func sigHash(cs consensus.State, txn types.Transaction, id types.Hash256, cf types.CoveredFields) types.Hash256 {
+	if cf.WholeTransaction {
+		return cs.WholeSigHash(txn, id, 0, 0, cf.Signatures)
+	}
+	return cs.PartialSigHash(txn, cf)
+}
+
 // Redistribute returns a transaction that redistributes money in the wallet by
 // selecting a minimal set of inputs to cover the creation of the requested
 // outputs. It also returns a list of output IDs that need to be signed.
@@ -298,12 +700,7 @@ func (w *SingleAddressWallet) Redistribute(cs consensus.State, outputs int, amou
 	})
 
 	// map used outputs
-	inPool := make(map[types.Hash256]bool)
-	for _, ptxn := range pool {
-		for _, in := range ptxn.SiacoinInputs {
-			inPool[types.Hash256(in.ParentID)] = true
-		}
-	}
+	inPool := poolInputs(pool)
 
 	// estimate the fees
 	outputFees := feePerByte.Mul64(uint64(len(encoding.Marshal(txn.SiacoinOutputs))))
@@ -346,11 +743,19 @@ func (w *SingleAddressWallet) Redistribute(cs consensus.State, outputs int, amou
 	}
 
 	// add the inputs
+	ucs := make([]types.UnlockConditions, len(inputs))
+	for i, sce := range inputs {
+		uc, err := w.unlockConditions(sce.Address)
+		if err != nil {
+			return types.Transaction{}, nil, err
+		}
+		ucs[i] = uc
+	}
 	toSign := make([]types.Hash256, len(inputs))
 	for i, sce := range inputs {
 		txn.SiacoinInputs = append(txn.SiacoinInputs, types.SiacoinInput{
 			ParentID:         types.SiacoinOutputID(sce.ID),
-			UnlockConditions: StandardUnlockConditions(w.priv.PublicKey()),
+			UnlockConditions: ucs[i],
 		})
 		toSign[i] = sce.ID
 		w.used[sce.ID] = true
@@ -367,12 +772,84 @@ func SumOutputs(outputs []SiacoinElement) (sum types.Currency) {
 	return
 }
 
-// NewSingleAddressWallet returns a new SingleAddressWallet using the provided private key and store.
-func NewSingleAddressWallet(priv types.PrivateKey, store SingleAddressStore) *SingleAddressWallet {
-	return &SingleAddressWallet{
+// NewSingleAddressWallet returns a new SingleAddressWallet using the provided
+// seed and store. The primary address and the additional addresses tracked by
+// the store are derived from the seed, see KeyFromSeed. The wallet keeps its
+// own copy of the seed, since locking the wallet zeroes it.
+func NewSingleAddressWallet(seed *[32]byte, store SingleAddressStore) *SingleAddressWallet {
+	priv := KeyFromSeed(seed, 0)
+	seedCopy := *seed
+	w := &SingleAddressWallet{
+		seed:  &seedCopy,
 		priv:  priv,
+		pub:   priv.PublicKey(),
 		addr:  StandardAddress(priv.PublicKey()),
 		store: store,
+		addrs: make(map[types.Address]uint64),
 		used:  make(map[types.Hash256]bool),
 	}
+	w.pubs = []types.PublicKey{w.pub}
+	w.addrs[w.addr] = 0
+	for i := uint64(1); i < uint64(len(store.Addresses())); i++ {
+		key := KeyFromSeed(seed, i)
+		pub := key.PublicKey()
+		memclr(key)
+		w.addrs[StandardAddress(pub)] = i
+		w.pubs = append(w.pubs, pub)
+	}
+	return w
+}
+
+// NewSeedPhraseWallet returns a new SingleAddressWallet using the seed derived
+// from the given seed phrase, see NewSingleAddressWallet. Unlike wallets
+// created from the seed, it can export its seed without an encrypted seed.
+func NewSeedPhraseWallet(phrase string, store SingleAddressStore) (*SingleAddressWallet, error) {
+	seed, err := SeedFromPhrase(phrase)
+	if err != nil {
+		return nil, err
+	}
+	w := NewSingleAddressWallet(seed, store)
+	memclr(seed[:])
+	w.phrase = []byte(phrase)
+	return w, nil
+}
+
+// NewExternalSignerWallet returns a new SingleAddressWallet that tracks the
+// primary address of the given public key, its transactions are signed by
+// the given signer.
+func NewExternalSignerWallet(pub types.PublicKey, store SingleAddressStore, signer Signer) *SingleAddressWallet {
+	w := NewWatchOnlyWallet(pub, store)
+	w.watchOnly = false
+	w.signer = signer
+	return w
+}
+
+// NewWatchOnlyWallet returns a new SingleAddressWallet that tracks the primary
+// address of the given public key. It can fund transactions but never signs
+// them, its transactions have to be signed externally.
+func NewWatchOnlyWallet(pub types.PublicKey, store SingleAddressStore) *SingleAddressWallet {
+	addr := StandardAddress(pub)
+	return &SingleAddressWallet{
+		pub:       pub,
+		addr:      addr,
+		store:     store,
+		watchOnly: true,
+		pubs:      []types.PublicKey{pub},
+		addrs:     map[types.Address]uint64{addr: 0},
+		used:      make(map[types.Hash256]bool),
+	}
+}
+
+// NewWatchOnlyAddressWallet returns a new SingleAddressWallet that tracks the
+// given address without knowing its public key. It reports the address'
+// balance and outputs but can't fund transactions, since it can't build the
+// unlock conditions of its inputs.
+func NewWatchOnlyAddressWallet(addr types.Address, store SingleAddressStore) *SingleAddressWallet {
+	return &SingleAddressWallet{
+		addr:      addr,
+		store:     store,
+		watchOnly: true,
+		addrs:     map[types.Address]uint64{addr: 0},
+		used:      make(map[types.Hash256]bool),
+	}
 }
@@ -1,12 +1,17 @@
 package wallet_test
 
 import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
 	"go.sia.tech/core/consensus"
 	"go.sia.tech/core/types"
+	cwallet "go.sia.tech/core/wallet"
 	"go.sia.tech/renterd/wallet"
 	"lukechampine.com/frand"
 )
@@ -14,6 +19,7 @@ import (
 // mockStore implements wallet.SingleAddressStore and allows to manipulate the
 // wallet's utxos
 type mockStore struct {
+	addrs []types.Address
 	utxos []wallet.SiacoinElement
 }
 
@@ -22,6 +28,12 @@ func (s *mockStore) UnspentSiacoinElements() ([]wallet.SiacoinElement, error) {
 func (s *mockStore) Transactions(since time.Time, max int) ([]wallet.Transaction, error) {
 	return nil, nil
 }
+func (s *mockStore) Addresses() []types.Address     { return s.addrs }
+func (s *mockStore) Rescan(fromHeight uint64) error { return nil }
+func (s *mockStore) AddAddress(addr types.Address) error {
+	s.addrs = append(s.addrs, addr)
+	return nil
+}
 
 var cs = consensus.State{
 	Index: types.ChainIndex{
@@ -36,8 +48,8 @@ func TestWalletRedistribute(t *testing.T) {
 	oneSC := types.Siacoins(1)
 
 	// create a wallet with one output
-	priv := types.GeneratePrivateKey()
-	pub := priv.PublicKey()
+	seed := frand.Entropy256()
+	pub := wallet.KeyFromSeed(&seed, 0).PublicKey()
 	utxo := wallet.SiacoinElement{
 		types.SiacoinOutput{
 			Value:   oneSC.Mul64(20),
@@ -45,9 +57,10 @@ func TestWalletRedistribute(t *testing.T) {
 		},
 		randomOutputID(),
 		0,
+		0,
 	}
 	s := &mockStore{utxos: []wallet.SiacoinElement{utxo}}
-	w := wallet.NewSingleAddressWallet(priv, s)
+	w := wallet.NewSingleAddressWallet(&seed, s)
 
 	numOutputsWithValue := func(v types.Currency) (c uint64) {
 		utxos, _ := w.UnspentOutputs()
@@ -69,7 +82,7 @@ func TestWalletRedistribute(t *testing.T) {
 			}
 		}
 		for _, output := range txn.SiacoinOutputs {
-			s.utxos = append(s.utxos, wallet.SiacoinElement{output, randomOutputID(), 0})
+			s.utxos = append(s.utxos, wallet.SiacoinElement{output, randomOutputID(), 0, 0})
 		}
 	}
 
@@ -131,3 +144,379 @@ func randomOutputID() (t types.Hash256) {
 	frand.Read(t[:])
 	return
 }
+
+// TestWalletLock tests locking and unlocking the wallet using an encrypted
+// seed.
+func TestWalletLock(t *testing.T) {
+	phrase := wallet.NewSeedPhrase()
+	seed, err := wallet.SeedFromPhrase(phrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := *seed
+	w := wallet.NewSingleAddressWallet(seed, &mockStore{})
+
+	// locking requires an encrypted seed
+	if err := w.Lock(); err != wallet.ErrNoEncryptedSeed {
+		t.Fatal("unexpected error", err)
+	}
+	w.SetEncryptedSeed(wallet.EncryptSeedPhrase(phrase, "foo"))
+
+	// lock the wallet, signing should fail
+	if err := w.Lock(); err != nil {
+		t.Fatal(err)
+	} else if !w.Locked() {
+		t.Fatal("wallet should be locked")
+	} else if *seed != orig {
+		t.Fatal("locking the wallet zeroed the seed it was created with")
+	}
+	txn := types.Transaction{}
+	if err := w.SignTransaction(cs, &txn, []types.Hash256{{}}, types.CoveredFields{WholeTransaction: true}); err != wallet.ErrWalletLocked {
+		t.Fatal("unexpected error", err)
+	}
+
+	// unlock with the wrong passphrase
+	if err := w.Unlock("bar"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// unlock with the right passphrase, signing should succeed
+	if err := w.Unlock("foo"); err != nil {
+		t.Fatal(err)
+	} else if w.Locked() {
+		t.Fatal("wallet should be unlocked")
+	}
+	if err := w.SignTransaction(cs, &txn, []types.Hash256{{}}, types.CoveredFields{WholeTransaction: true}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestWalletExportSeed verifies the exported seed is encrypted with the export
+// passphrase.
+func TestWalletExportSeed(t *testing.T) {
+	phrase := wallet.NewSeedPhrase()
+	seed, err := wallet.SeedFromPhrase(phrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := wallet.NewSingleAddressWallet(seed, &mockStore{})
+
+	// exporting requires an encrypted seed unless the wallet was created
+	// from the seed phrase
+	if _, err := w.ExportSeed("foo", "bar"); err != wallet.ErrUnknownSeedPhrase {
+		t.Fatal("unexpected error", err)
+	}
+	w.SetEncryptedSeed(wallet.EncryptSeedPhrase(phrase, "foo"))
+
+	// export with the wrong passphrase
+	if _, err := w.ExportSeed("bar", "bar"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// export with the right passphrase
+	exported, err := w.ExportSeed("foo", "bar")
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := wallet.DecryptSeedPhrase(exported, "foo"); err == nil {
+		t.Fatal("expected error")
+	} else if decrypted, err := wallet.DecryptSeedPhrase(exported, "bar"); err != nil {
+		t.Fatal(err)
+	} else if decrypted != phrase {
+		t.Fatal("unexpected seed phrase")
+	}
+}
+
+// TestWalletExportSeedPhrase verifies a wallet created from a seed phrase
+// exports it without an encrypted seed.
+func TestWalletExportSeedPhrase(t *testing.T) {
+	phrase := wallet.NewSeedPhrase()
+	w, err := wallet.NewSeedPhraseWallet(phrase, &mockStore{})
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := wallet.NewSeedPhraseWallet("foo", &mockStore{}); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// assert the wallet uses the keys derived from the phrase
+	if key, err := wallet.KeyFromPhrase(phrase); err != nil {
+		t.Fatal(err)
+	} else if w.Address() != wallet.StandardAddress(key.PublicKey()) {
+		t.Fatal("unexpected address")
+	}
+
+	// the passphrase is ignored without an encrypted seed
+	exported, err := w.ExportSeed("", "bar")
+	if err != nil {
+		t.Fatal(err)
+	} else if decrypted, err := wallet.DecryptSeedPhrase(exported, "bar"); err != nil {
+		t.Fatal(err)
+	} else if decrypted != phrase {
+		t.Fatal("unexpected seed phrase")
+	}
+
+	// once an encrypted seed is set, the passphrase is required even if the
+	// wallet is unlocked
+	w.SetEncryptedSeed(wallet.EncryptSeedPhrase(phrase, "foo"))
+	if _, err := w.ExportSeed("", "bar"); err == nil {
+		t.Fatal("expected error")
+	} else if _, err := w.ExportSeed("foo", "bar"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestWalletAddresses verifies the wallet derives additional addresses and
+// spends outputs sent to them.
+func TestWalletAddresses(t *testing.T) {
+	seed := frand.Entropy256()
+	s := &mockStore{addrs: []types.Address{wallet.StandardAddress(wallet.KeyFromSeed(&seed, 0).PublicKey())}}
+	w := wallet.NewSingleAddressWallet(&seed, s)
+
+	// derive a new address
+	addr, err := w.NextAddress()
+	if err != nil {
+		t.Fatal(err)
+	} else if addr == w.Address() {
+		t.Fatal("expected a fresh address")
+	} else if !w.OwnsAddress(addr) {
+		t.Fatal("wallet should own the new address")
+	} else if len(s.addrs) != 2 {
+		t.Fatal("new address wasn't added to the store")
+	}
+
+	// a wallet created from the same seed and store derives the same addresses
+	if addrs := wallet.NewSingleAddressWallet(&seed, s).Addresses(); len(addrs) != 2 || addrs[1] != addr {
+		t.Fatal("unexpected addresses", addrs)
+	}
+
+	// fund a transaction using an output sent to the new address
+	s.utxos = []wallet.SiacoinElement{{
+		SiacoinOutput: types.SiacoinOutput{Value: types.Siacoins(1), Address: addr},
+		ID:            randomOutputID(),
+	}}
+	var txn types.Transaction
+	toSign, err := w.FundTransaction(cs, &txn, types.Siacoins(1), nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(txn.SiacoinInputs) != 1 || txn.SiacoinInputs[0].UnlockConditions.UnlockHash() != addr {
+		t.Fatal("unexpected inputs", txn.SiacoinInputs)
+	}
+
+	// the input is signed with the key of the new address
+	if err := w.SignTransaction(cs, &txn, toSign, types.CoveredFields{WholeTransaction: true}); err != nil {
+		t.Fatal(err)
+	}
+	pub := wallet.KeyFromSeed(&seed, 1).PublicKey()
+	h := cs.WholeSigHash(txn, txn.Signatures[0].ParentID, 0, 0, nil)
+	var sig types.Signature
+	copy(sig[:], txn.Signatures[0].Signature)
+	if !pub.VerifyHash(h, sig) {
+		t.Fatal("invalid signature")
+	}
+
+	// deriving addresses requires an unlocked wallet
+	w.SetEncryptedSeed(wallet.EncryptSeedPhrase(wallet.NewSeedPhrase(), "foo"))
+	if err := w.Lock(); err != nil {
+		t.Fatal(err)
+	} else if _, err := w.NextAddress(); err != wallet.ErrWalletLocked {
+		t.Fatal("unexpected error", err)
+	}
+}
+
+// TestWalletCoinControl verifies the wallet spends exactly the pinned outputs
+// and no longer lists them as spendable.
+func TestWalletCoinControl(t *testing.T) {
+	seed := frand.Entropy256()
+	addr := wallet.StandardAddress(wallet.KeyFromSeed(&seed, 0).PublicKey())
+	s := &mockStore{addrs: []types.Address{addr}}
+	for i := 0; i < 3; i++ {
+		s.utxos = append(s.utxos, wallet.SiacoinElement{
+			SiacoinOutput: types.SiacoinOutput{Value: types.Siacoins(uint32(i + 1)), Address: addr},
+			ID:            randomOutputID(),
+		})
+	}
+	w := wallet.NewSingleAddressWallet(&seed, s)
+
+	// pinning outputs that don't cover the amount fails
+	var txn types.Transaction
+	if _, err := w.FundTransactionWithOutputs(cs, &txn, types.Siacoins(2), []types.Hash256{s.utxos[0].ID}, nil); err != wallet.ErrInsufficientBalance {
+		t.Fatal("unexpected error", err)
+	}
+
+	// pinning unknown outputs fails
+	if _, err := w.FundTransactionWithOutputs(cs, &txn, types.Siacoins(1), []types.Hash256{randomOutputID()}, nil); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// spend the first and the last output, both are used even though the
+	// last one covers the amount by itself
+	pinned := []types.Hash256{s.utxos[0].ID, s.utxos[2].ID}
+	toSign, err := w.FundTransactionWithOutputs(cs, &txn, types.Siacoins(2), pinned, nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(toSign) != 2 || toSign[0] != pinned[0] || toSign[1] != pinned[1] {
+		t.Fatal("unexpected inputs", toSign)
+	} else if len(txn.SiacoinOutputs) != 1 || !txn.SiacoinOutputs[0].Value.Equals(types.Siacoins(2)) {
+		t.Fatal("unexpected change output", txn.SiacoinOutputs)
+	}
+
+	// only the middle output is left
+	if spendable, err := w.SpendableOutputs(cs, nil); err != nil {
+		t.Fatal(err)
+	} else if len(spendable) != 1 || spendable[0].ID != s.utxos[1].ID {
+		t.Fatal("unexpected spendable outputs", spendable)
+	}
+
+	// outputs in the pool aren't spendable either
+	pool := []types.Transaction{{SiacoinInputs: []types.SiacoinInput{{ParentID: types.SiacoinOutputID(s.utxos[1].ID)}}}}
+	if spendable, err := w.SpendableOutputs(cs, pool); err != nil {
+		t.Fatal(err)
+	} else if len(spendable) != 0 {
+		t.Fatal("unexpected spendable outputs", spendable)
+	}
+}
+
+// TestWatchOnlyWallet verifies a watch-only wallet funds transactions but
+// refuses to sign them.
+func TestWatchOnlyWallet(t *testing.T) {
+	priv := types.GeneratePrivateKey()
+	addr := wallet.StandardAddress(priv.PublicKey())
+	s := &mockStore{addrs: []types.Address{addr}}
+	s.utxos = []wallet.SiacoinElement{{
+		SiacoinOutput: types.SiacoinOutput{Value: types.Siacoins(1), Address: addr},
+		ID:            randomOutputID(),
+	}}
+	w := wallet.NewWatchOnlyWallet(priv.PublicKey(), s)
+	if !w.WatchOnly() || w.Address() != addr {
+		t.Fatal("unexpected wallet")
+	} else if w.Locked() {
+		t.Fatal("watch-only wallet shouldn't be locked")
+	}
+
+	var txn types.Transaction
+	toSign, err := w.FundTransaction(cs, &txn, types.Siacoins(1), nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := w.SignTransaction(cs, &txn, toSign, types.CoveredFields{WholeTransaction: true}); err != wallet.ErrWatchOnly {
+		t.Fatal("unexpected error", err)
+	} else if _, err := w.NextAddress(); err != wallet.ErrWatchOnly {
+		t.Fatal("unexpected error", err)
+	} else if err := w.Unlock("foo"); err != wallet.ErrWatchOnly {
+		t.Fatal("unexpected error", err)
+	}
+
+	// a wallet watching only the address can't fund transactions, and the
+	// failed attempt must not lock its outputs
+	w = wallet.NewWatchOnlyAddressWallet(addr, s)
+	if !w.WatchOnly() || w.Address() != addr {
+		t.Fatal("unexpected wallet")
+	} else if w.Locked() {
+		t.Fatal("watch-only wallet shouldn't be locked")
+	} else if _, err := w.FundTransaction(cs, &types.Transaction{}, types.Siacoins(1), nil); err != wallet.ErrUnknownPublicKey {
+		t.Fatal("unexpected error", err)
+	} else if outputs, err := w.SpendableOutputs(cs, nil); err != nil {
+		t.Fatal(err)
+	} else if len(outputs) != 1 {
+		t.Fatal("expected the output to remain spendable", len(outputs))
+	}
+}
+
+// TestExternalSigner verifies a wallet using an external signer adds the
+// signer's signatures and rejects invalid ones.
+func TestExternalSigner(t *testing.T) {
+	priv := types.GeneratePrivateKey()
+	addr := wallet.StandardAddress(priv.PublicKey())
+
+	// serve a signer that signs using the wallet's key, or the wrong key if
+	// requested
+	signKey := priv
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req wallet.SignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var resp wallet.SignResponse
+		for _, in := range req.Inputs {
+			if in.PublicKey != priv.PublicKey() {
+				http.Error(w, "unknown key", http.StatusBadRequest)
+				return
+			}
+			sig := signKey.SignHash(in.SigHash)
+			resp.Signatures = append(resp.Signatures, types.TransactionSignature{
+				ParentID:      in.ParentID,
+				CoveredFields: req.CoveredFields,
+				Signature:     sig[:],
+			})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	s := &mockStore{addrs: []types.Address{addr}}
+	s.utxos = []wallet.SiacoinElement{{
+		SiacoinOutput: types.SiacoinOutput{Value: types.Siacoins(1), Address: addr},
+		ID:            randomOutputID(),
+	}}
+	w := wallet.NewExternalSignerWallet(priv.PublicKey(), s, wallet.NewHTTPSigner(srv.URL))
+	if w.WatchOnly() || w.Locked() {
+		t.Fatal("unexpected wallet")
+	} else if _, err := w.NextAddress(); err != wallet.ErrExternalSigner {
+		t.Fatal("unexpected error", err)
+	}
+
+	// sign a transaction
+	var txn types.Transaction
+	toSign, err := w.FundTransaction(cs, &txn, types.Siacoins(1), nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := w.SignTransaction(cs, &txn, toSign, types.CoveredFields{WholeTransaction: true}); err != nil {
+		t.Fatal(err)
+	} else if len(txn.Signatures) != 1 {
+		t.Fatal("unexpected signatures", len(txn.Signatures))
+	}
+
+	// signatures made with the wrong key are rejected
+	signKey = types.GeneratePrivateKey()
+	txn.Signatures = nil
+	if err := w.SignTransaction(cs, &txn, toSign, types.CoveredFields{WholeTransaction: true}); err == nil || !strings.Contains(err.Error(), "invalid signature") {
+		t.Fatal("unexpected error", err)
+	} else if len(txn.Signatures) != 0 {
+		t.Fatal("invalid signatures were added")
+	}
+}
+
+// TestKeyFromSeed asserts the wallet derives the same addresses from a seed
+// phrase as other Sia wallets do.
+func TestKeyFromSeed(t *testing.T) {
+	const phrase = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	seed, err := wallet.SeedFromPhrase(phrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var coreSeed [32]byte
+	if err := cwallet.SeedFromPhrase(&coreSeed, phrase); err != nil {
+		t.Fatal(err)
+	} else if *seed != coreSeed {
+		t.Fatal("seed mismatch")
+	}
+
+	for i, want := range []string{
+		"addr:a2a3773f76136bdb05a0ff79a0f4fcc2826436794f8db36db6408355c5ca32345002db43c2eb",
+		"addr:e4d4c489d4682c38ce78ce6a6268e8884be2d390e71d94938ef8c36207c1d6051509d3823880",
+		"addr:70dd9f5060628a6b6b9482aac834644b8a72f8cf06f5b0357bb71ca42679b928831a0e095aeb",
+	} {
+		key := wallet.KeyFromSeed(seed, uint64(i))
+		if addr := wallet.StandardAddress(key.PublicKey()); addr.String() != want {
+			t.Fatalf("address %v: expected %v, got %v", i, want, addr)
+		} else if !bytes.Equal(key, cwallet.KeyFromSeed(&coreSeed, uint64(i))) {
+			t.Fatalf("key %v doesn't match the reference derivation", i)
+		}
+	}
+
+	// the primary address is the one derived from the phrase directly
+	if key, err := wallet.KeyFromPhrase(phrase); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(key, wallet.KeyFromSeed(seed, 0)) {
+		t.Fatal("KeyFromPhrase doesn't return the key at index 0")
+	}
+}
@@ -0,0 +1,153 @@
+package worker
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"go.sia.tech/jape"
+	"go.sia.tech/renterd/api"
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	// tokenPrefix is prepended to all read-only access tokens.
+	tokenPrefix = "rt_"
+
+	// maxTokenValidity is the maximum amount of time a read-only access token
+	// is valid for.
+	maxTokenValidity = 30 * 24 * time.Hour
+)
+
+var (
+	errInvalidToken         = errors.New("invalid token")
+	errEmptyTokenPrefix     = errors.New("prefix can't be empty")
+	errInvalidTokenValidity = fmt.Errorf("validity has to be positive and at most %v", maxTokenValidity)
+)
+
+// tokenKey derives the key used to sign read-only access tokens from the
+// worker's masterkey.
+func tokenKey(masterKey [32]byte) [32]byte {
+	return blake2b.Sum256(append(masterKey[:], []byte("tokenkey")...))
+}
+
+// tokenSignature returns the signature of a read-only token for the given
+// prefix and expiry.
+func tokenSignature(key [32]byte, prefix string, expires uint64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], expires)
+	h, _ := blake2b.New256(key[:])
+	h.Write(buf[:])
+	h.Write([]byte(prefix))
+	return h.Sum(nil)
+}
+
+// encodeToken creates a read-only token that grants access to all objects
+// under prefix until it expires.
+func encodeToken(key [32]byte, prefix string, expires uint64) string {
+	buf := make([]byte, 8, 8+32+len(prefix))
+	binary.LittleEndian.PutUint64(buf, expires)
+	buf = append(buf, tokenSignature(key, prefix, expires)...)
+	buf = append(buf, prefix...)
+	return tokenPrefix + base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// decodeToken verifies the given token and returns the prefix it grants
+// access to.
+func decodeToken(key [32]byte, token string) (string, error) {
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return "", errInvalidToken
+	}
+	buf, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(token, tokenPrefix))
+	if err != nil || len(buf) < 40 {
+		return "", errInvalidToken
+	}
+	expires := binary.LittleEndian.Uint64(buf[:8])
+	sig, prefix := buf[8:40], string(buf[40:])
+	if subtle.ConstantTimeCompare(sig, tokenSignature(key, prefix, expires)) != 1 {
+		return "", errInvalidToken
+	} else if uint64(time.Now().Unix()) > expires {
+		return "", errInvalidToken
+	}
+	return prefix, nil
+}
+
+// verifyTokenRequest returns true if the request is a download carrying a
+// valid read-only token for the requested path.
+func verifyTokenRequest(key [32]byte, req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	} else if !strings.HasPrefix(req.URL.Path, "/objects/") {
+		return false
+	}
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return false
+	}
+	prefix, err := decodeToken(key, token)
+	if err != nil || strings.TrimPrefix(prefix, "/") == "" {
+		return false
+	}
+
+	// only allow clean paths to avoid escaping the prefix
+	p := req.URL.Path
+	if path.Clean(p) != strings.TrimSuffix(p, "/") {
+		return false
+	}
+	return hasPathPrefix(strings.TrimPrefix(p, "/objects/"), strings.TrimPrefix(prefix, "/"))
+}
+
+// hasPathPrefix returns true if p is prefix or beneath it, a prefix that
+// doesn't end in a slash only matches at a path boundary, i.e. "a" matches "a"
+// and "a/b" but not "ab".
+func hasPathPrefix(p, prefix string) bool {
+	if prefix == "" || strings.HasSuffix(prefix, "/") {
+		return strings.HasPrefix(p, prefix)
+	}
+	return p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// Auth wraps the given authentication middleware so that object downloads
+// carrying a valid presigned URL signature or read-only token bypass it.
+func Auth(masterKey [32]byte, auth func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	pk, tk := presignKey(masterKey), tokenKey(masterKey)
+	return func(h http.Handler) http.Handler {
+		authed := auth(h)
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			if verifyPresignedRequest(pk, req) || verifyTokenRequest(tk, req) {
+				h.ServeHTTP(w, req)
+				return
+			}
+			authed.ServeHTTP(w, req)
+		})
+	}
+}
+
+func (w *worker) tokensHandlerPOST(jc jape.Context) {
+	var req api.TokenRequest
+	if jc.Decode(&req) != nil {
+		return
+	}
+	validity := time.Duration(req.Validity)
+	if validity <= 0 || validity > maxTokenValidity {
+		jc.Error(errInvalidTokenValidity, http.StatusBadRequest)
+		return
+	}
+
+	prefix := strings.TrimPrefix(req.Prefix, "/")
+	if prefix == "" {
+		jc.Error(errEmptyTokenPrefix, http.StatusBadRequest)
+		return
+	}
+
+	var resp api.TokenResponse
+	resp.Expires = time.Now().Add(validity).Truncate(time.Second)
+	resp.Token = encodeToken(tokenKey(w.masterKey), prefix, uint64(resp.Expires.Unix()))
+	jc.Encode(resp)
+}
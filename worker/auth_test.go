@@ -0,0 +1,166 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.sia.tech/jape"
+	"go.sia.tech/renterd/api"
+	"lukechampine.com/frand"
+)
+
+func TestPresignedAuth(t *testing.T) {
+	var masterKey [32]byte
+	frand.Read(masterKey[:])
+
+	h := Auth(masterKey, jape.BasicAuth("password"))(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	status := func(method, target string) int {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+		return rec.Code
+	}
+	signed := func(path string, expires time.Time) string {
+		sig := presignSignature(presignKey(masterKey), path, expires.Unix())
+		return path + "?expires=" + strconv.FormatInt(expires.Unix(), 10) + "&signature=" + hex.EncodeToString(sig)
+	}
+
+	// unsigned requests require the password
+	if code := status(http.MethodGet, "/objects/foo"); code != http.StatusUnauthorized {
+		t.Fatal("unexpected status", code)
+	}
+
+	// valid signature
+	target := signed("/objects/foo", time.Now().Add(time.Hour))
+	if code := status(http.MethodGet, target); code != http.StatusOK {
+		t.Fatal("unexpected status", code)
+	}
+
+	// signature is only valid for downloads
+	if code := status(http.MethodDelete, target); code != http.StatusUnauthorized {
+		t.Fatal("unexpected status", code)
+	}
+
+	// signature is only valid for the signed path
+	if code := status(http.MethodGet, "/objects/bar"+target[len("/objects/foo"):]); code != http.StatusUnauthorized {
+		t.Fatal("unexpected status", code)
+	}
+
+	// expired signature
+	if code := status(http.MethodGet, signed("/objects/foo", time.Now().Add(-time.Hour))); code != http.StatusUnauthorized {
+		t.Fatal("unexpected status", code)
+	}
+
+	// moving digits between the path and the expiry doesn't yield a valid
+	// signature for another path
+	expires := time.Now().Add(time.Hour).Unix()
+	sig := hex.EncodeToString(presignSignature(presignKey(masterKey), "/objects/foo1", expires))
+	forged := "/objects/foo?expires=1" + strconv.FormatInt(expires, 10) + "&signature=" + sig
+	if code := status(http.MethodGet, forged); code != http.StatusUnauthorized {
+		t.Fatal("unexpected status", code)
+	}
+}
+
+func TestReadOnlyTokenAuth(t *testing.T) {
+	var masterKey [32]byte
+	frand.Read(masterKey[:])
+	key := tokenKey(masterKey)
+
+	h := Auth(masterKey, jape.BasicAuth("password"))(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	status := func(method, target, token string) int {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	expires := uint64(time.Now().Add(time.Hour).Unix())
+	token := encodeToken(key, "media/", expires)
+	if prefix, err := decodeToken(key, token); err != nil || prefix != "media/" {
+		t.Fatal("unexpected", prefix, err)
+	}
+
+	// token grants read access to the prefix
+	if code := status(http.MethodGet, "/objects/media/foo", token); code != http.StatusOK {
+		t.Fatal("unexpected status", code)
+	}
+	if code := status(http.MethodHead, "/objects/media/", token); code != http.StatusOK {
+		t.Fatal("unexpected status", code)
+	}
+
+	// but not outside of it or for other methods
+	for _, tc := range []struct{ method, target string }{
+		{http.MethodGet, "/objects/secret"},
+		{http.MethodGet, "/objects/media/../secret"},
+		{http.MethodDelete, "/objects/media/foo"},
+		{http.MethodPost, "/rhp/fund"},
+	} {
+		if code := status(tc.method, tc.target, token); code != http.StatusUnauthorized {
+			t.Fatal("unexpected status", tc, code)
+		}
+	}
+
+	// a prefix without a trailing slash only matches at a path boundary
+	dirToken := encodeToken(key, "media", expires)
+	if code := status(http.MethodGet, "/objects/media/foo", dirToken); code != http.StatusOK {
+		t.Fatal("unexpected status", code)
+	} else if code := status(http.MethodGet, "/objects/mediafoo", dirToken); code != http.StatusUnauthorized {
+		t.Fatal("unexpected status", code)
+	}
+
+	// expired, tampered and non-expiring tokens are rejected
+	if code := status(http.MethodGet, "/objects/media/foo", encodeToken(key, "media/", 1)); code != http.StatusUnauthorized {
+		t.Fatal("unexpected status", code)
+	}
+	if code := status(http.MethodGet, "/objects/media/foo", encodeToken(tokenKey([32]byte{}), "media/", expires)); code != http.StatusUnauthorized {
+		t.Fatal("unexpected status", code)
+	}
+	if code := status(http.MethodGet, "/objects/media/foo", encodeToken(key, "media/", 0)); code != http.StatusUnauthorized {
+		t.Fatal("unexpected status", code)
+	}
+
+	// tokens are only valid for object downloads, even if their prefix is
+	// empty or the root
+	for _, tk := range []string{token, encodeToken(key, "", expires), encodeToken(key, "/", expires)} {
+		for _, target := range []string{
+			"/debug/pprof/heap",
+			"/accounts",
+			"/rhp/contracts/active",
+			"/uploads",
+			"/downloads/foo/data",
+			"/objects/foo",
+		} {
+			if code := status(http.MethodGet, target, tk); code != http.StatusUnauthorized {
+				t.Fatal("unexpected status", target, code)
+			}
+		}
+	}
+}
+
+func TestTokensHandler(t *testing.T) {
+	w := &worker{}
+	frand.Read(w.masterKey[:])
+	h := jape.Mux(map[string]jape.Handler{"POST /tokens": w.tokensHandlerPOST})
+	request := func(prefix string) int {
+		body, _ := json.Marshal(api.TokenRequest{Prefix: prefix, Validity: api.ParamDuration(time.Hour)})
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/tokens", bytes.NewReader(body)))
+		return rec.Code
+	}
+
+	// tokens for the root of all objects can't be created
+	for _, prefix := range []string{"", "/"} {
+		if code := request(prefix); code != http.StatusBadRequest {
+			t.Fatalf("unexpected status for prefix %q: %v", prefix, code)
+		}
+	}
+	if code := request("/media/"); code != http.StatusOK {
+		t.Fatal("unexpected status", code)
+	}
+}
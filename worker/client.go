@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"time"
 
 	rhpv2 "go.sia.tech/core/rhp/v2"
@@ -27,6 +28,13 @@ func (c *Client) ID(ctx context.Context) (id string, err error) {
 	return
 }
 
+// Health runs the worker's health checks, an error is returned if any of them
+// fails.
+func (c *Client) Health(ctx context.Context) (resp api.HealthResponse, err error) {
+	err = c.c.WithContext(ctx).GET("/health", &resp)
+	return
+}
+
 // RHPScan scans a host, returning its current settings.
 func (c *Client) RHPScan(ctx context.Context, hostKey types.PublicKey, hostIP string, timeout time.Duration) (resp api.RHPScanResponse, err error) {
 	err = c.c.WithContext(ctx).POST("/rhp/scan", api.RHPScanRequest{
@@ -68,6 +76,64 @@ func (c *Client) RHPRenew(ctx context.Context, fcid types.FileContractID, endHei
 	return resp.Contract, resp.TransactionSet, err
 }
 
+// RHPContractRenew renews the contract with the given id until the given end
+// height and adds the renewed contract to the bus.
+func (c *Client) RHPContractRenew(ctx context.Context, fcid types.FileContractID, endHeight uint64, renterFunds types.Currency) (contract api.ContractMetadata, err error) {
+	req := api.RHPContractRenewRequest{
+		EndHeight:   endHeight,
+		RenterFunds: renterFunds,
+	}
+	err = c.c.WithContext(ctx).POST(fmt.Sprintf("/rhp/contract/%s/renew", fcid), req, &contract)
+	return
+}
+
+// RHPContractRefresh refreshes the contract with the given id, adding funds
+// without changing its end height, and adds the renewed contract to the bus.
+func (c *Client) RHPContractRefresh(ctx context.Context, fcid types.FileContractID, renterFunds types.Currency) (contract api.ContractMetadata, err error) {
+	req := api.RHPContractRefreshRequest{
+		RenterFunds: renterFunds,
+	}
+	err = c.c.WithContext(ctx).POST(fmt.Sprintf("/rhp/contract/%s/refresh", fcid), req, &contract)
+	return
+}
+
+// RHPContractBroadcast broadcasts the latest revision of the contract with the
+// given id.
+func (c *Client) RHPContractBroadcast(ctx context.Context, fcid types.FileContractID) (cb api.ContractBroadcast, err error) {
+	err = c.c.WithContext(ctx).POST(fmt.Sprintf("/rhp/contract/%s/broadcast", fcid), nil, &cb)
+	return
+}
+
+// RHPContractRoots fetches the latest revision of the contract and the roots of
+// all sectors stored in it from the host, the contract doesn't have to be
+// known to the bus.
+func (c *Client) RHPContractRoots(ctx context.Context, fcid types.FileContractID, hostKey types.PublicKey, hostIP string) (resp api.RHPContractRootsResponse, err error) {
+	req := api.RHPContractRootsRequest{HostKey: hostKey, HostIP: hostIP}
+	err = c.c.WithContext(ctx).POST(fmt.Sprintf("/rhp/contract/%s/roots", fcid), req, &resp)
+	return
+}
+
+// RHPContractPrunable returns the size of the contract and the number of bytes
+// stored on it that are no longer referenced by any object.
+func (c *Client) RHPContractPrunable(ctx context.Context, fcid types.FileContractID) (resp api.RHPContractPrunableResponse, err error) {
+	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/rhp/contract/%s/prunable", fcid), &resp)
+	return
+}
+
+// RHPContractPrune deletes all sectors from the contract that are no longer
+// referenced by any object.
+func (c *Client) RHPContractPrune(ctx context.Context, fcid types.FileContractID) (resp api.RHPContractPruneResponse, err error) {
+	err = c.c.WithContext(ctx).POST(fmt.Sprintf("/rhp/contract/%s/prune", fcid), nil, &resp)
+	return
+}
+
+// ContractKeys returns the renter keys the worker forms contracts with the
+// given hosts with.
+func (c *Client) ContractKeys(ctx context.Context, hostKeys []types.PublicKey) (keys []api.ContractKeys, err error) {
+	err = c.c.WithContext(ctx).POST("/rhp/contractkeys", hostKeys, &keys)
+	return
+}
+
 // RHPFund funds an ephemeral account using the supplied contract.
 func (c *Client) RHPFund(ctx context.Context, contractID types.FileContractID, hostKey types.PublicKey, amount types.Currency) (err error) {
 	req := api.RHPFundRequest{
@@ -112,41 +178,118 @@ func (c *Client) RHPUpdateRegistry(ctx context.Context, hostKey types.PublicKey,
 	return
 }
 
+// RHPPrewarm establishes sessions with the given hosts ahead of scheduled
+// work, if no hosts are given all hosts in the contract set are prewarmed.
+func (c *Client) RHPPrewarm(ctx context.Context, hostKeys []types.PublicKey) (resp api.RHPPrewarmResponse, err error) {
+	err = c.c.WithContext(ctx).POST("/rhp/prewarm", api.RHPPrewarmRequest{HostKeys: hostKeys}, &resp)
+	return
+}
+
+// Stats returns the worker's stats.
+func (c *Client) Stats(ctx context.Context) (resp api.WorkerStatsResponse, err error) {
+	err = c.c.WithContext(ctx).GET("/stats", &resp)
+	return
+}
+
 // MigrateSlab migrates the specified slab.
 func (c *Client) MigrateSlab(ctx context.Context, slab object.Slab) error {
 	return c.c.WithContext(ctx).POST("/slab/migrate", slab, nil)
 }
 
+// ReshardObject erasure codes the object with the given key again using the
+// current redundancy settings.
+func (c *Client) ReshardObject(ctx context.Context, key string) (err error) {
+	err = c.c.WithContext(ctx).POST(fmt.Sprintf("/reshard/%s", key), nil, nil)
+	return
+}
+
+// AuditSectors verifies the given sectors are still stored by their hosts.
+func (c *Client) AuditSectors(ctx context.Context, audits []api.SectorAudit) (results []api.SectorAuditResult, err error) {
+	err = c.c.WithContext(ctx).POST("/sectors/audit", audits, &results)
+	return
+}
+
+// AuditObjects verifies the data of the given objects still matches their
+// ETag.
+func (c *Client) AuditObjects(ctx context.Context, paths []string) (results []api.ObjectAuditResult, err error) {
+	err = c.c.WithContext(ctx).POST("/objects/audit", paths, &results)
+	return
+}
+
+// DeleteOrphanedSectors deletes up to limit sectors that were pruned by the
+// garbage collector from their hosts.
+func (c *Client) DeleteOrphanedSectors(ctx context.Context, limit int) (resp api.DeleteSectorsResponse, err error) {
+	err = c.c.WithContext(ctx).POST(fmt.Sprintf("/gc/sectors?limit=%d", limit), nil, &resp)
+	return
+}
+
 // UploadObject uploads the data in r, creating an object with the given name.
 func (c *Client) UploadObject(ctx context.Context, r io.Reader, name string) (err error) {
+	return c.uploadObject(ctx, r, name, "", "", "")
+}
+
+// UploadObjectIfMatch uploads the data in r, replacing the object with the
+// given name only if its ETag matches ifMatch, the value of an If-Match
+// header. Otherwise an error wrapping api.ErrPreconditionFailed is returned.
+func (c *Client) UploadObjectIfMatch(ctx context.Context, r io.Reader, name, ifMatch string) (err error) {
+	return c.uploadObject(ctx, r, name, "", "", ifMatch)
+}
+
+// UploadObjectWithPassphrase uploads the data in r, creating an object with the
+// given name whose key is protected by the given passphrase. Such objects are
+// never migrated, resharded or audited since that requires the passphrase.
+func (c *Client) UploadObjectWithPassphrase(ctx context.Context, r io.Reader, name, passphrase string) (err error) {
+	return c.uploadObject(ctx, r, name, passphrase, "", "")
+}
+
+// UploadObjectToContractSet uploads the data in r to the hosts of the given
+// contract set instead of the default one, creating an object with the given
+// name.
+func (c *Client) UploadObjectToContractSet(ctx context.Context, r io.Reader, name, contractSet string) (err error) {
+	return c.uploadObject(ctx, r, name, "", contractSet, "")
+}
+
+func (c *Client) uploadObject(ctx context.Context, r io.Reader, name, passphrase, contractSet, ifMatch string) (err error) {
 	c.c.Custom("PUT", fmt.Sprintf("/objects/%s", name), []byte{}, nil)
 
-	req, err := http.NewRequestWithContext(ctx, "PUT", fmt.Sprintf("%v/objects/%v", c.c.BaseURL, name), r)
+	req, err := http.NewRequestWithContext(ctx, "PUT", fmt.Sprintf("%v/objects/%v%v", c.c.BaseURL, name, contractSetQuery(contractSet)), r)
 	if err != nil {
 		panic(err)
 	}
 	req.SetBasicAuth("", c.c.WithContext(ctx).Password)
+	if passphrase != "" {
+		req.Header.Set(headerPassphrase, passphrase)
+	}
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
 	defer io.Copy(io.Discard, resp.Body)
 	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		err, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%w: %s", api.ErrPreconditionFailed, err)
+	} else if resp.StatusCode != 200 {
 		err, _ := io.ReadAll(resp.Body)
 		return errors.New(string(err))
 	}
 	return
 }
 
-func (c *Client) object(ctx context.Context, path string, w io.Writer, entries *[]string) (err error) {
-	c.c.Custom("GET", fmt.Sprintf("/objects/%s", path), nil, (*[]string)(nil))
+func (c *Client) object(ctx context.Context, path, passphrase, contractSet string, w io.Writer, entries *[]api.ObjectMetadata) (err error) {
+	c.c.Custom("GET", fmt.Sprintf("/objects/%s", path), nil, (*[]api.ObjectMetadata)(nil))
 
-	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%v/objects/%v", c.c.BaseURL, path), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%v/objects/%v%v", c.c.BaseURL, path, contractSetQuery(contractSet)), nil)
 	if err != nil {
 		panic(err)
 	}
 	req.SetBasicAuth("", c.c.WithContext(ctx).Password)
+	if passphrase != "" {
+		req.Header.Set(headerPassphrase, passphrase)
+	}
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
@@ -165,16 +308,125 @@ func (c *Client) object(ctx context.Context, path string, w io.Writer, entries *
 	return
 }
 
+// contractSetQuery returns the query string that overrides the contract set
+// of a transfer, it's empty if the default set should be used.
+func contractSetQuery(contractSet string) string {
+	if contractSet == "" {
+		return ""
+	}
+	return "?" + url.Values{queryStringParamContractSet: []string{contractSet}}.Encode()
+}
+
 // ObjectEntries returns the entries at the given path, which must end in /.
-func (c *Client) ObjectEntries(ctx context.Context, path string) (entries []string, err error) {
-	err = c.object(ctx, path, nil, &entries)
+func (c *Client) ObjectEntries(ctx context.Context, path string) (entries []api.ObjectMetadata, err error) {
+	err = c.object(ctx, path, "", "", nil, &entries)
 	return
 }
 
 // DownloadObject downloads the object at the given path, writing its data to
 // w.
 func (c *Client) DownloadObject(ctx context.Context, w io.Writer, path string) (err error) {
-	err = c.object(ctx, path, w, nil)
+	err = c.object(ctx, path, "", "", w, nil)
+	return
+}
+
+// DownloadObjectWithPassphrase downloads the passphrase protected object at the
+// given path, writing its data to w.
+func (c *Client) DownloadObjectWithPassphrase(ctx context.Context, w io.Writer, path, passphrase string) (err error) {
+	err = c.object(ctx, path, passphrase, "", w, nil)
+	return
+}
+
+// DownloadObjectFromContractSet downloads the object at the given path from
+// the hosts of the given contract set instead of the default one, writing its
+// data to w.
+func (c *Client) DownloadObjectFromContractSet(ctx context.Context, w io.Writer, path, contractSet string) (err error) {
+	err = c.object(ctx, path, "", contractSet, w, nil)
+	return
+}
+
+// PresignObjectURL returns a URL, relative to the worker's API address, that
+// allows downloading the object at the given path without the API password
+// until it expires.
+func (c *Client) PresignObjectURL(ctx context.Context, path string, validity time.Duration) (resp api.PresignResponse, err error) {
+	err = c.c.WithContext(ctx).POST("/presign", api.PresignRequest{
+		Path:     path,
+		Validity: api.ParamDuration(validity),
+	}, &resp)
+	return
+}
+
+// CreateReadOnlyToken returns a token that grants read-only access to all
+// objects under the given prefix. A validity of zero creates a token that never
+// expires.
+func (c *Client) CreateReadOnlyToken(ctx context.Context, prefix string, validity time.Duration) (resp api.TokenResponse, err error) {
+	err = c.c.WithContext(ctx).POST("/tokens", api.TokenRequest{
+		Prefix:   prefix,
+		Validity: api.ParamDuration(validity),
+	}, &resp)
+	return
+}
+
+// Uploads returns the status of the active object uploads.
+func (c *Client) Uploads(ctx context.Context) (uploads []api.UploadStatus, err error) {
+	err = c.c.WithContext(ctx).GET("/uploads", &uploads)
+	return
+}
+
+// Upload returns the status of the object upload with the given ID, the ID is
+// returned in the Renterd-Upload-ID header of an upload's response.
+func (c *Client) Upload(ctx context.Context, id string) (upload api.UploadStatus, err error) {
+	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/uploads/%s", id), &upload)
+	return
+}
+
+// StartDownloadJob starts a job that downloads an object, or all objects under
+// a prefix, in the background.
+func (c *Client) StartDownloadJob(ctx context.Context, req api.DownloadJobRequest) (job api.DownloadJob, err error) {
+	err = c.c.WithContext(ctx).POST("/downloads", req, &job)
+	return
+}
+
+// DownloadJobs returns the download jobs of the worker.
+func (c *Client) DownloadJobs(ctx context.Context) (jobs []api.DownloadJob, err error) {
+	err = c.c.WithContext(ctx).GET("/downloads", &jobs)
+	return
+}
+
+// DownloadJob returns the download job with the given ID.
+func (c *Client) DownloadJob(ctx context.Context, id string) (job api.DownloadJob, err error) {
+	err = c.c.WithContext(ctx).GET(fmt.Sprintf("/downloads/%s", id), &job)
+	return
+}
+
+// CancelDownloadJob cancels the download job with the given ID, if the job is
+// finished it's removed together with its staged data.
+func (c *Client) CancelDownloadJob(ctx context.Context, id string) (err error) {
+	err = c.c.WithContext(ctx).DELETE(fmt.Sprintf("/downloads/%s", id))
+	return
+}
+
+// DownloadJobData writes the data staged by the download job with the given ID
+// to w.
+func (c *Client) DownloadJobData(ctx context.Context, w io.Writer, id string) (err error) {
+	c.c.Custom("GET", fmt.Sprintf("/downloads/%s/data", id), nil, (*[]byte)(nil))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%v/downloads/%s/data", c.c.BaseURL, id), nil)
+	if err != nil {
+		panic(err)
+	}
+	req.SetBasicAuth("", c.c.WithContext(ctx).Password)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer io.Copy(io.Discard, resp.Body)
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		err, _ := io.ReadAll(resp.Body)
+		return errors.New(string(err))
+	}
+	_, err = io.Copy(w, resp.Body)
 	return
 }
 
@@ -184,6 +436,34 @@ func (c *Client) DeleteObject(ctx context.Context, name string) (err error) {
 	return
 }
 
+// DeleteObjectIfMatch deletes the object with the given name only if its ETag
+// matches ifMatch, the value of an If-Match header. Otherwise an error
+// wrapping api.ErrPreconditionFailed is returned.
+func (c *Client) DeleteObjectIfMatch(ctx context.Context, name, ifMatch string) (err error) {
+	c.c.Custom("DELETE", fmt.Sprintf("/objects/%s", name), nil, nil)
+
+	req, err := http.NewRequestWithContext(ctx, "DELETE", fmt.Sprintf("%v/objects/%v", c.c.BaseURL, name), nil)
+	if err != nil {
+		panic(err)
+	}
+	req.SetBasicAuth("", c.c.WithContext(ctx).Password)
+	req.Header.Set("If-Match", ifMatch)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer io.Copy(io.Discard, resp.Body)
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		err, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%w: %s", api.ErrPreconditionFailed, err)
+	} else if resp.StatusCode != 200 {
+		err, _ := io.ReadAll(resp.Body)
+		return errors.New(string(err))
+	}
+	return nil
+}
+
 // ActiveContracts returns all active contracts from the worker. These contracts
 // decorate a bus contract with the contract's latest revision.
 func (c *Client) ActiveContracts(ctx context.Context, hostTimeout time.Duration) (resp api.ContractsResponse, err error) {
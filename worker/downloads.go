@@ -0,0 +1,481 @@
+package worker
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/jape"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/object"
+	"lukechampine.com/frand"
+)
+
+// maxFinishedDownloadJobs is the number of finished download jobs that are
+// kept, the oldest ones are dropped first together with their staged data.
+const maxFinishedDownloadJobs = 100
+
+var (
+	// errDownloadJobNotFound is returned if an unknown download job is
+	// requested.
+	errDownloadJobNotFound = errors.New("download job not found")
+
+	// errDownloadJobNotStaged is returned if the data of a download job is
+	// requested that isn't done or wasn't staged by the worker.
+	errDownloadJobNotStaged = errors.New("download job has no staged data")
+)
+
+type downloadJob struct {
+	api.DownloadJob
+
+	cancel    context.CancelFunc
+	cancelled bool
+	staged    string // path of the staged data, empty if the job has a path
+}
+
+// A downloadTracker keeps track of the download jobs handled by the worker.
+// Jobs outlive the request that started them, they're only interrupted when
+// they are cancelled or the tracker is shut down.
+type downloadTracker struct {
+	ctx      context.Context
+	shutdown context.CancelFunc
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	jobs     map[string]*downloadJob
+	finished []string // IDs of finished jobs, oldest first
+}
+
+func newDownloadTracker() *downloadTracker {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &downloadTracker{
+		ctx:      ctx,
+		shutdown: cancel,
+		jobs:     make(map[string]*downloadJob),
+	}
+}
+
+// Start starts tracking a job downloading the object or prefix with the given
+// key. It returns the job's ID and the context the job should run with.
+func (dt *downloadTracker) Start(key, path, staged string) (string, context.Context) {
+	ctx, cancel := context.WithCancel(dt.ctx)
+	id := hex.EncodeToString(frand.Bytes(16))
+
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	dt.jobs[id] = &downloadJob{
+		DownloadJob: api.DownloadJob{
+			ID:      id,
+			Key:     key,
+			Path:    path,
+			State:   api.DownloadJobStateActive,
+			Started: time.Now(),
+		},
+		cancel: cancel,
+		staged: staged,
+	}
+	dt.wg.Add(1)
+	return id, ctx
+}
+
+// SetTotals records the number of objects and bytes the job downloads.
+func (dt *downloadTracker) SetTotals(id string, objects int, bytes uint64) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	if job, ok := dt.jobs[id]; ok {
+		job.ObjectsTotal = objects
+		job.BytesTotal = bytes
+	}
+}
+
+// BytesDownloaded records that n bytes were downloaded by the job.
+func (dt *downloadTracker) BytesDownloaded(id string, n int) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	if job, ok := dt.jobs[id]; ok {
+		job.BytesDownloaded += uint64(n)
+	}
+}
+
+// ObjectDone records that the job finished downloading an object.
+func (dt *downloadTracker) ObjectDone(id string) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	if job, ok := dt.jobs[id]; ok {
+		job.ObjectsDone++
+	}
+}
+
+// Finish marks the job as done, or as failed or cancelled if err is not nil.
+func (dt *downloadTracker) Finish(id string, err error) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	job, ok := dt.jobs[id]
+	if !ok {
+		return
+	}
+	defer dt.wg.Done()
+	job.cancel()
+	job.Finished = time.Now()
+	if err == nil {
+		job.State = api.DownloadJobStateDone
+	} else {
+		if job.cancelled {
+			job.State = api.DownloadJobStateCancelled
+		} else {
+			job.State = api.DownloadJobStateFailed
+			job.Error = err.Error()
+		}
+		dt.removeStaged(job)
+	}
+
+	dt.finished = append(dt.finished, id)
+	if len(dt.finished) > maxFinishedDownloadJobs {
+		dt.removeStaged(dt.jobs[dt.finished[0]])
+		delete(dt.jobs, dt.finished[0])
+		dt.finished = dt.finished[1:]
+	}
+}
+
+// Cancel cancels the job if it's still active. Finished jobs are forgotten and
+// their staged data is removed.
+func (dt *downloadTracker) Cancel(id string) bool {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	job, ok := dt.jobs[id]
+	if !ok {
+		return false
+	}
+	if job.State == api.DownloadJobStateActive {
+		job.cancelled = true
+		job.cancel()
+		return true
+	}
+
+	dt.removeStaged(job)
+	delete(dt.jobs, id)
+	for i, fid := range dt.finished {
+		if fid == id {
+			dt.finished = append(dt.finished[:i], dt.finished[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// Job returns the download job with the given ID.
+func (dt *downloadTracker) Job(id string) (api.DownloadJob, bool) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	job, ok := dt.jobs[id]
+	if !ok {
+		return api.DownloadJob{}, false
+	}
+	return job.DownloadJob, true
+}
+
+// Jobs returns all download jobs, oldest first.
+func (dt *downloadTracker) Jobs() []api.DownloadJob {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	jobs := make([]api.DownloadJob, 0, len(dt.jobs))
+	for _, job := range dt.jobs {
+		jobs = append(jobs, job.DownloadJob)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Started.Before(jobs[j].Started)
+	})
+	return jobs
+}
+
+// Staged returns the path of the job's staged data, it's only available once
+// the job is done.
+func (dt *downloadTracker) Staged(id string) (string, bool) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	job, ok := dt.jobs[id]
+	if !ok || job.State != api.DownloadJobStateDone || job.staged == "" {
+		return "", false
+	}
+	return job.staged, true
+}
+
+// Shutdown cancels all active jobs and waits for them to finish.
+func (dt *downloadTracker) Shutdown() {
+	dt.shutdown()
+	dt.wg.Wait()
+}
+
+func (dt *downloadTracker) removeStaged(job *downloadJob) {
+	if job.staged != "" {
+		os.Remove(job.staged)
+		job.staged = ""
+	}
+}
+
+// A progressWriter reports the number of bytes written to the underlying
+// writer to the download tracker.
+type progressWriter struct {
+	w  io.Writer
+	dt *downloadTracker
+	id string
+}
+
+func (pw progressWriter) Write(p []byte) (int, error) {
+	n, err := pw.w.Write(p)
+	pw.dt.BytesDownloaded(pw.id, n)
+	return n, err
+}
+
+// exportPath returns the path within the export directory dir that the path of
+// a download job refers to, refusing absolute paths and paths that escape the
+// directory.
+func exportPath(dir, path string) (string, error) {
+	if dir == "" {
+		return "", errors.New("downloading to a path is disabled, the worker has no export directory")
+	} else if filepath.IsAbs(path) {
+		return "", errors.New("path must be relative to the worker's export directory")
+	}
+	exported := filepath.Join(dir, filepath.FromSlash(path))
+	if !strings.HasPrefix(exported, filepath.Clean(dir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %q escapes the worker's export directory", path)
+	}
+	return exported, nil
+}
+
+// downloadJobPath returns the path an object downloaded as part of a prefix is
+// written to, refusing paths that escape the job's directory.
+func downloadJobPath(dir, prefix, name string) (string, error) {
+	rel := strings.TrimPrefix(strings.TrimPrefix(name, "/"), prefix)
+	path := filepath.Join(dir, filepath.FromSlash(rel))
+	if rel == "" || !strings.HasPrefix(path, filepath.Clean(dir)+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid object name %q", name)
+	}
+	return path, nil
+}
+
+// listObjectsRecursive returns the objects under the given prefix, descending
+// into its directories.
+func (w *worker) listObjectsRecursive(ctx context.Context, prefix string) ([]api.ObjectMetadata, error) {
+	_, entries, err := w.bus.Object(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	var objects []api.ObjectMetadata
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name, "/") {
+			objects = append(objects, entry)
+			continue
+		}
+		children, err := w.listObjectsRecursive(ctx, strings.TrimPrefix(entry.Name, "/"))
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, children...)
+	}
+	return objects, nil
+}
+
+// runDownloadJob downloads the object or prefix requested by req, writing the
+// objects to req.Path or to the job's staged file.
+func (w *worker) runDownloadJob(ctx context.Context, id string, req api.DownloadJobRequest, staged string, dp api.DownloadParams) error {
+	ctx = WithGougingChecker(ctx, dp.GougingParams)
+	ctx = WithContractSpendingRecorder(ctx, w.contractSpendingRecorder)
+
+	// collect the objects to download
+	var objects []api.ObjectMetadata
+	if strings.HasSuffix(req.Key, "/") {
+		var err error
+		objects, err = w.listObjectsRecursive(ctx, req.Key)
+		if err != nil {
+			return fmt.Errorf("couldn't list objects: %w", err)
+		}
+	} else {
+		objects = []api.ObjectMetadata{{Name: "/" + req.Key}}
+	}
+	var total uint64
+	for _, o := range objects {
+		total += uint64(o.Size)
+	}
+	w.downloads.SetTotals(id, len(objects), total)
+
+	for _, entry := range objects {
+		key := strings.TrimPrefix(entry.Name, "/")
+		o, _, err := w.bus.Object(ctx, key)
+		if err != nil {
+			return fmt.Errorf("couldn't fetch object %v: %w", key, err)
+		}
+		if len(objects) == 1 && entry.Size == 0 {
+			w.downloads.SetTotals(id, 1, uint64(o.Size()))
+		}
+
+		// unwrap the object key if it's protected by a passphrase
+		if o.Wrap != nil {
+			if req.Passphrase == "" {
+				return fmt.Errorf("object %v is protected by a passphrase", key)
+			}
+			if err := o.UnwrapKeys(req.Passphrase); err != nil {
+				return fmt.Errorf("couldn't unwrap keys of object %v: %w", key, err)
+			}
+		}
+
+		// open the destination, files that already exist are never
+		// overwritten
+		var f *os.File
+		var path string
+		if staged != "" {
+			path = staged
+			f, err = os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0600)
+		} else {
+			path = req.Path
+			if strings.HasSuffix(req.Key, "/") {
+				path, err = downloadJobPath(req.Path, req.Key, entry.Name)
+				if err != nil {
+					return err
+				}
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+				return err
+			}
+			f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		}
+		if err != nil {
+			return err
+		}
+
+		err = w.downloadJobObject(ctx, f, id, key, o, dp.ContractSet)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			if staged == "" {
+				os.Remove(path)
+			}
+			return fmt.Errorf("couldn't download object %v: %w", key, err)
+		}
+		w.downloads.ObjectDone(id)
+	}
+	return nil
+}
+
+func (w *worker) downloadJobObject(ctx context.Context, f *os.File, id, key string, o object.Object, contractSet string) error {
+	if len(o.Slabs) == 0 && o.PartialSlab == nil {
+		return nil
+	}
+	pw := progressWriter{w: f, dt: w.downloads, id: id}
+	if _, err := w.downloadObject(ctx, pw, key, o, 0, o.Size(), contractSet); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+func (w *worker) downloadsHandlerPOST(jc jape.Context) {
+	ctx := jc.Request.Context()
+	var req api.DownloadJobRequest
+	if jc.Decode(&req) != nil {
+		return
+	}
+	req.Key = strings.TrimPrefix(req.Key, "/")
+	if req.Key == "" {
+		jc.Error(errors.New("no key given"), http.StatusBadRequest)
+		return
+	} else if strings.HasSuffix(req.Key, "/") && req.Path == "" {
+		jc.Error(errors.New("downloading a prefix requires a path"), http.StatusBadRequest)
+		return
+	} else if req.Path != "" {
+		path, err := exportPath(w.downloadExportDir, req.Path)
+		if err != nil {
+			jc.Error(err, http.StatusBadRequest)
+			return
+		}
+		req.Path = path
+	}
+
+	dp, err := w.bus.DownloadParams(ctx)
+	if jc.Check("couldn't fetch download parameters from bus", err) != nil {
+		return
+	}
+	if req.ContractSet != "" {
+		dp.ContractSet = req.ContractSet
+	}
+
+	// refuse to download once the download spending cap is reached
+	if jc.Check("couldn't start download", w.bus.AuthorizeSpending(ctx, api.SpendingCategoryDownload, types.ZeroCurrency)) != nil {
+		return
+	}
+
+	// stage the object if it isn't written to a path
+	var staged string
+	if req.Path == "" {
+		f, err := os.CreateTemp(w.uploadSpillDir, "renterd-download-*")
+		if jc.Check("couldn't create staging file", err) != nil {
+			return
+		}
+		f.Close()
+		staged = f.Name()
+	}
+
+	id, jobCtx := w.downloads.Start(req.Key, req.Path, staged)
+	go func() {
+		err := w.runDownloadJob(jobCtx, id, req, staged, dp)
+		if err != nil && jobCtx.Err() == nil {
+			w.logger.Errorf("download job %v failed, err: %v", id, err)
+		}
+		w.downloads.Finish(id, err)
+	}()
+
+	job, _ := w.downloads.Job(id)
+	jc.Encode(job)
+}
+
+func (w *worker) downloadsHandlerGET(jc jape.Context) {
+	jc.Encode(w.downloads.Jobs())
+}
+
+func (w *worker) downloadsIDHandlerGET(jc jape.Context) {
+	job, ok := w.downloads.Job(jc.PathParam("id"))
+	if !ok {
+		jc.Error(errDownloadJobNotFound, http.StatusNotFound)
+		return
+	}
+	jc.Encode(job)
+}
+
+func (w *worker) downloadsIDHandlerDELETE(jc jape.Context) {
+	if !w.downloads.Cancel(jc.PathParam("id")) {
+		jc.Error(errDownloadJobNotFound, http.StatusNotFound)
+	}
+}
+
+func (w *worker) downloadsIDDataHandlerGET(jc jape.Context) {
+	id := jc.PathParam("id")
+	if _, ok := w.downloads.Job(id); !ok {
+		jc.Error(errDownloadJobNotFound, http.StatusNotFound)
+		return
+	}
+	path, ok := w.downloads.Staged(id)
+	if !ok {
+		jc.Error(errDownloadJobNotStaged, http.StatusBadRequest)
+		return
+	}
+	f, err := os.Open(path)
+	if jc.Check("couldn't open staged data", err) != nil {
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if jc.Check("couldn't stat staged data", err) != nil {
+		return
+	}
+	http.ServeContent(jc.ResponseWriter, jc.Request, "", fi.ModTime(), f)
+}
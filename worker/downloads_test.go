@@ -0,0 +1,140 @@
+package worker
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.sia.tech/renterd/api"
+)
+
+// TestDownloadTracker verifies the download tracker reports the progress of
+// download jobs and handles their cancellation.
+func TestDownloadTracker(t *testing.T) {
+	dt := newDownloadTracker()
+
+	staged := filepath.Join(t.TempDir(), "staged")
+	if err := os.WriteFile(staged, []byte("foo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// start a job and record some progress
+	foo, _ := dt.Start("foo", "", staged)
+	dt.SetTotals(foo, 1, 3)
+	dt.BytesDownloaded(foo, 3)
+	dt.ObjectDone(foo)
+	if job, ok := dt.Job(foo); !ok {
+		t.Fatal("job not found")
+	} else if job.State != api.DownloadJobStateActive || job.ObjectsDone != 1 || job.BytesDownloaded != 3 || job.BytesTotal != 3 {
+		t.Fatal("unexpected job", job)
+	}
+
+	// staged data is only available once the job is done
+	if _, ok := dt.Staged(foo); ok {
+		t.Fatal("expected no staged data")
+	}
+	dt.Finish(foo, nil)
+	if path, ok := dt.Staged(foo); !ok || path != staged {
+		t.Fatal("unexpected staged data", path, ok)
+	}
+
+	// cancel an active job
+	bar, ctx := dt.Start("bar/", "/tmp/bar", "")
+	if !dt.Cancel(bar) {
+		t.Fatal("job not found")
+	}
+	<-ctx.Done()
+	dt.Finish(bar, ctx.Err())
+	if job, _ := dt.Job(bar); job.State != api.DownloadJobStateCancelled || job.Error != "" {
+		t.Fatal("unexpected job", job)
+	}
+
+	// a failed job reports its error
+	baz, _ := dt.Start("baz", "/tmp/baz", "")
+	dt.Finish(baz, errors.New("failed"))
+	if job, _ := dt.Job(baz); job.State != api.DownloadJobStateFailed || job.Error != "failed" {
+		t.Fatal("unexpected job", job)
+	}
+	if jobs := dt.Jobs(); len(jobs) != 3 || jobs[0].ID != foo || jobs[2].ID != baz {
+		t.Fatal("unexpected jobs", jobs)
+	}
+
+	// removing a finished job removes its staged data
+	if !dt.Cancel(foo) {
+		t.Fatal("job not found")
+	} else if _, ok := dt.Job(foo); ok {
+		t.Fatal("expected job to be removed")
+	} else if _, err := os.Stat(staged); !os.IsNotExist(err) {
+		t.Fatal("expected staged data to be removed", err)
+	} else if dt.Cancel(foo) {
+		t.Fatal("expected job to be unknown")
+	}
+
+	// shutting down cancels active jobs
+	qux, ctx := dt.Start("qux", "/tmp/qux", "")
+	go func() {
+		<-ctx.Done()
+		dt.Finish(qux, ctx.Err())
+	}()
+	dt.Shutdown()
+	if job, _ := dt.Job(qux); job.State != api.DownloadJobStateFailed {
+		t.Fatal("unexpected job", job)
+	}
+}
+
+// TestDownloadJobPath verifies the paths of objects downloaded as part of a
+// prefix can't escape the job's directory.
+func TestDownloadJobPath(t *testing.T) {
+	dir := filepath.FromSlash("/restore")
+	tests := []struct {
+		name string
+		path string
+		ok   bool
+	}{
+		{"/photos/a.jpg", filepath.FromSlash("/restore/a.jpg"), true},
+		{"/photos/2023/b.jpg", filepath.FromSlash("/restore/2023/b.jpg"), true},
+		{"/photos/../../etc/passwd", "", false},
+		{"/photos/", "", false},
+	}
+	for _, test := range tests {
+		path, err := downloadJobPath(dir, "photos/", test.name)
+		if test.ok && (err != nil || path != test.path) {
+			t.Fatalf("%v: unexpected path %v, err %v", test.name, path, err)
+		} else if !test.ok && err == nil {
+			t.Fatalf("%v: expected error, got %v", test.name, path)
+		}
+	}
+}
+
+// TestExportPath verifies download jobs can't write outside of the worker's
+// export directory.
+func TestExportPath(t *testing.T) {
+	dir := filepath.FromSlash("/export")
+	tests := []struct {
+		path     string
+		exported string
+		ok       bool
+	}{
+		{"a.jpg", filepath.FromSlash("/export/a.jpg"), true},
+		{"photos/2023", filepath.FromSlash("/export/photos/2023"), true},
+		{"photos/../a.jpg", filepath.FromSlash("/export/a.jpg"), true},
+		{"../etc/passwd", "", false},
+		{"photos/../../etc/passwd", "", false},
+		{".", "", false},
+		{filepath.FromSlash("/etc/passwd"), "", false},
+	}
+	for _, test := range tests {
+		exported, err := exportPath(dir, test.path)
+		if test.ok && (err != nil || exported != test.exported) {
+			t.Fatalf("%v: unexpected path %v, err %v", test.path, exported, err)
+		} else if !test.ok && err == nil {
+			t.Fatalf("%v: expected error, got %v", test.path, exported)
+		}
+	}
+
+	// writing to the filesystem is disabled without an export directory
+	if _, err := exportPath("", "a.jpg"); err == nil {
+		t.Fatal("expected error")
+	}
+}
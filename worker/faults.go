@@ -0,0 +1,170 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"lukechampine.com/frand"
+)
+
+const (
+	// faultSettingsRefreshInterval is the interval at which the fault
+	// injection settings are refetched from the bus.
+	faultSettingsRefreshInterval = 10 * time.Second
+)
+
+var (
+	// errInjectedFault is returned by operations that failed due to an
+	// injected error.
+	errInjectedFault = errors.New("injected fault")
+
+	// errInjectedTimeout is returned by operations that failed due to an
+	// injected timeout.
+	errInjectedTimeout = errors.New("injected timeout")
+)
+
+// faultInjector caches the fault injection settings of the bus so they don't
+// have to be fetched for every transfer.
+type faultInjector struct {
+	setting func(ctx context.Context, key string) (string, error)
+
+	mu          sync.Mutex
+	settings    api.FaultInjectionSettings
+	lastRefresh time.Time
+}
+
+func newFaultInjector(setting func(ctx context.Context, key string) (string, error)) *faultInjector {
+	return &faultInjector{setting: setting}
+}
+
+// Settings returns the fault injection settings, a missing setting disables
+// fault injection. If the settings can't be fetched the previously fetched
+// settings remain in use until the next refresh.
+func (fi *faultInjector) Settings(ctx context.Context) api.FaultInjectionSettings {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	if time.Since(fi.lastRefresh) < faultSettingsRefreshInterval {
+		return fi.settings
+	}
+	fi.lastRefresh = time.Now()
+
+	value, err := fi.setting(ctx, api.SettingFaultInjection)
+	if err != nil && strings.Contains(err.Error(), api.ErrSettingNotFound.Error()) {
+		fi.settings = api.FaultInjectionSettings{}
+	} else if err == nil {
+		var fs api.FaultInjectionSettings
+		if json.Unmarshal([]byte(value), &fs) == nil {
+			fi.settings = fs
+		}
+	}
+	return fi.settings
+}
+
+// faultyStoreProvider wraps the sector stores of a storeProvider in a
+// faultyStore.
+type faultyStoreProvider struct {
+	sp       storeProvider
+	settings api.FaultInjectionSettings
+}
+
+func (p faultyStoreProvider) withHost(ctx context.Context, contractID types.FileContractID, hostKey types.PublicKey, hostIP string, fn func(SectorStore) error) error {
+	return p.sp.withHost(ctx, contractID, hostKey, hostIP, func(ss SectorStore) error {
+		return fn(&faultyStore{ss: ss, cfg: p.settings.Config(hostKey)})
+	})
+}
+
+// faultyStore is a SectorStore that injects latency, timeouts and errors into
+// the operations of the store it wraps.
+type faultyStore struct {
+	ss  SectorStore
+	cfg api.FaultConfig
+}
+
+func (fs *faultyStore) Contract() types.FileContractID { return fs.ss.Contract() }
+func (fs *faultyStore) PublicKey() types.PublicKey     { return fs.ss.PublicKey() }
+
+func (fs *faultyStore) UploadSector(ctx context.Context, sector *[rhpv2.SectorSize]byte) (types.Hash256, error) {
+	if err := fs.inject(ctx); err != nil {
+		return types.Hash256{}, err
+	}
+	return fs.ss.UploadSector(ctx, sector)
+}
+
+func (fs *faultyStore) DownloadSector(ctx context.Context, w io.Writer, root types.Hash256, offset, length uint32) error {
+	if err := fs.inject(ctx); err != nil {
+		return err
+	}
+	return fs.ss.DownloadSector(ctx, w, root, offset, length)
+}
+
+func (fs *faultyStore) UploadSectors(ctx context.Context, sectors []*[rhpv2.SectorSize]byte) ([]types.Hash256, error) {
+	if err := fs.inject(ctx); err != nil {
+		return nil, err
+	}
+	return fs.ss.UploadSectors(ctx, sectors)
+}
+
+func (fs *faultyStore) DownloadSectors(ctx context.Context, w io.Writer, roots []types.Hash256, offset, length uint32) error {
+	if err := fs.inject(ctx); err != nil {
+		return err
+	}
+	return fs.ss.DownloadSectors(ctx, w, roots, offset, length)
+}
+
+func (fs *faultyStore) DeleteSectors(ctx context.Context, roots []types.Hash256) error {
+	if err := fs.inject(ctx); err != nil {
+		return err
+	}
+	return fs.ss.DeleteSectors(ctx, roots)
+}
+
+// inject delays the operation and decides whether it should fail.
+func (fs *faultyStore) inject(ctx context.Context) error {
+	if fs.cfg.Latency > 0 {
+		if err := sleepCtx(ctx, fs.cfg.Latency); err != nil {
+			return err
+		}
+	}
+	if fs.cfg.TimeoutRate > 0 && frand.Float64() < fs.cfg.TimeoutRate {
+		if fs.cfg.Timeout == 0 {
+			<-ctx.Done()
+			return ctx.Err()
+		} else if err := sleepCtx(ctx, fs.cfg.Timeout); err != nil {
+			return err
+		}
+		return errInjectedTimeout
+	}
+	if fs.cfg.ErrorRate > 0 && frand.Float64() < fs.cfg.ErrorRate {
+		return errInjectedFault
+	}
+	return nil
+}
+
+// sleepCtx sleeps for d or until the context is done.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// storeProvider returns the storeProvider used for transfers, if fault
+// injection is enabled its sector stores inject faults.
+func (w *worker) storeProvider(ctx context.Context) storeProvider {
+	if fs := w.faults.Settings(ctx); fs.Enabled {
+		return faultyStoreProvider{sp: w, settings: fs}
+	}
+	return w
+}
@@ -0,0 +1,148 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/object"
+	"lukechampine.com/frand"
+)
+
+func TestFaultyStore(t *testing.T) {
+	h := newMockHost()
+	var sector [rhpv2.SectorSize]byte
+	frand.Read(sector[:])
+
+	// without faults the operations reach the host
+	fs := &faultyStore{ss: h}
+	root, err := fs.UploadSector(context.Background(), &sector)
+	if err != nil {
+		t.Fatal(err)
+	} else if _, ok := h.sectors[root]; !ok {
+		t.Fatal("sector wasn't uploaded")
+	}
+
+	// inject errors
+	fs.cfg = api.FaultConfig{ErrorRate: 1}
+	if err := fs.DeleteSectors(context.Background(), []types.Hash256{root}); !errors.Is(err, errInjectedFault) {
+		t.Fatal("expected errInjectedFault, got", err)
+	} else if _, ok := h.sectors[root]; !ok {
+		t.Fatal("sector shouldn't have been deleted")
+	}
+
+	// inject timeouts that last until the context is done
+	fs.cfg = api.FaultConfig{TimeoutRate: 1}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	var buf bytes.Buffer
+	if err := fs.DownloadSector(ctx, &buf, root, 0, 64); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected context.DeadlineExceeded, got", err)
+	}
+
+	// inject timeouts with a fixed duration
+	fs.cfg = api.FaultConfig{TimeoutRate: 1, Timeout: 10 * time.Millisecond}
+	if err := fs.DownloadSector(context.Background(), &buf, root, 0, 64); !errors.Is(err, errInjectedTimeout) {
+		t.Fatal("expected errInjectedTimeout, got", err)
+	}
+
+	// inject latency
+	fs.cfg = api.FaultConfig{Latency: 50 * time.Millisecond}
+	start := time.Now()
+	if err := fs.DownloadSector(context.Background(), &buf, root, 0, 64); err != nil {
+		t.Fatal(err)
+	} else if time.Since(start) < fs.cfg.Latency {
+		t.Fatal("operation wasn't delayed")
+	} else if !bytes.Equal(buf.Bytes(), sector[:64]) {
+		t.Fatal("unexpected data")
+	}
+}
+
+func TestFaultInjectionDownload(t *testing.T) {
+	mockLocker := &mockContractLocker{}
+
+	// prepare hosts
+	var hosts []SectorStore
+	for i := 0; i < 6; i++ {
+		hosts = append(hosts, newMockHost())
+	}
+	sp := newMockStoreProvider(hosts)
+	var contracts []api.ContractMetadata
+	for _, h := range hosts {
+		contracts = append(contracts, api.ContractMetadata{ID: h.Contract(), HostKey: h.PublicKey()})
+	}
+
+	// upload a slab
+	data := frand.Bytes(1000)
+	s, _, _, err := uploadSlab(context.Background(), sp, bytes.NewReader(data), object.GenerateEncryptionKey(), 2, 6, contracts, mockLocker, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// make all but two hosts fail, the slab should still be recoverable
+	fsp := faultyStoreProvider{sp: sp, settings: api.FaultInjectionSettings{
+		Enabled: true,
+		Default: api.FaultConfig{ErrorRate: 1},
+		Hosts: map[types.PublicKey]api.FaultConfig{
+			hosts[1].PublicKey(): {},
+			hosts[4].PublicKey(): {},
+		},
+	}}
+	var buf bytes.Buffer
+	ss := object.SlabSlice{Slab: s, Offset: 0, Length: uint32(len(data))}
+	if _, err := downloadSlab(context.Background(), fsp, &buf, ss, contracts, mockLocker, nil, 0); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("unexpected data")
+	}
+
+	// make another host fail, the download should fail
+	fsp.settings.Hosts[hosts[4].PublicKey()] = api.FaultConfig{ErrorRate: 1}
+	buf.Reset()
+	if _, err := downloadSlab(context.Background(), fsp, &buf, ss, contracts, mockLocker, nil, 0); err == nil || !strings.Contains(err.Error(), errInjectedFault.Error()) {
+		t.Fatal("expected errInjectedFault, got", err)
+	}
+}
+
+func TestFaultInjectorSettings(t *testing.T) {
+	var value string
+	var calls int
+	fi := newFaultInjector(func(ctx context.Context, key string) (string, error) {
+		calls++
+		if key != api.SettingFaultInjection {
+			t.Fatal("unexpected key", key)
+		} else if value == "" {
+			return "", api.ErrSettingNotFound
+		}
+		return value, nil
+	})
+
+	// a missing setting disables fault injection
+	if fs := fi.Settings(context.Background()); fs.Enabled {
+		t.Fatal("expected fault injection to be disabled")
+	}
+
+	// the settings are cached
+	js, _ := json.Marshal(api.FaultInjectionSettings{Enabled: true})
+	value = string(js)
+	if fs := fi.Settings(context.Background()); fs.Enabled {
+		t.Fatal("expected cached settings")
+	} else if calls != 1 {
+		t.Fatal("unexpected number of calls", calls)
+	}
+
+	// after the refresh interval they are refetched
+	fi.lastRefresh = time.Time{}
+	if fs := fi.Settings(context.Background()); !fs.Enabled {
+		t.Fatal("expected fault injection to be enabled")
+	} else if calls != 2 {
+		t.Fatal("unexpected number of calls", calls)
+	}
+}
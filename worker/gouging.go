@@ -151,8 +151,8 @@ func checkPriceGougingHS(gs api.GougingSettings, hs *rhpv2.HostSettings) error {
 	}
 
 	// check max storage price
-	if !gs.MaxStoragePrice.IsZero() && hs.StoragePrice.Cmp(gs.MaxStoragePrice) > 0 {
-		return fmt.Errorf("storage price exceeds max: %v>%v", hs.StoragePrice, gs.MaxUploadPrice)
+	if maxStoragePrice := gs.StoragePriceLimit(); !maxStoragePrice.IsZero() && hs.StoragePrice.Cmp(maxStoragePrice) > 0 {
+		return fmt.Errorf("storage price exceeds max: %v>%v", hs.StoragePrice, maxStoragePrice)
 	}
 
 	// check contract price
@@ -197,8 +197,8 @@ func checkPriceGougingPT(gs api.GougingSettings, cs api.ConsensusState, txnFee t
 	}
 
 	// check max storage
-	if !gs.MaxStoragePrice.IsZero() && pt.WriteStoreCost.Cmp(gs.MaxStoragePrice) > 0 {
-		return fmt.Errorf("storage price exceeds max: %v>%v", pt.WriteStoreCost, gs.MaxStoragePrice)
+	if maxStoragePrice := gs.StoragePriceLimit(); !maxStoragePrice.IsZero() && pt.WriteStoreCost.Cmp(maxStoragePrice) > 0 {
+		return fmt.Errorf("storage price exceeds max: %v>%v", pt.WriteStoreCost, maxStoragePrice)
 	}
 
 	// check max collateral
@@ -317,6 +317,12 @@ func checkPriceGougingPT(gs api.GougingSettings, cs api.ConsensusState, txnFee t
 }
 
 func checkDownloadGougingRHPv2(gs api.GougingSettings, rs api.RedundancySettings, hs rhpv2.HostSettings) error {
+	if err := joinErrors(
+		checkMaxPrice("download bandwidth price", hs.DownloadBandwidthPrice, gs.MaxDownloadBandwidthPriceRHPv2),
+		checkMaxPrice("sector access price", hs.SectorAccessPrice, gs.MaxReadBaseCost),
+	); err != nil {
+		return err
+	}
 	sectorDownloadPrice, overflow := sectorReadCostRHPv2(hs)
 	if overflow {
 		return fmt.Errorf("overflow detected when computing sector download price")
@@ -325,6 +331,12 @@ func checkDownloadGougingRHPv2(gs api.GougingSettings, rs api.RedundancySettings
 }
 
 func checkDownloadGougingRHPv3(gs api.GougingSettings, rs api.RedundancySettings, pt rhpv3.HostPriceTable) error {
+	if err := joinErrors(
+		checkMaxPrice("download bandwidth cost", pt.DownloadBandwidthCost, gs.MaxDownloadBandwidthPriceRHPv3),
+		checkMaxPrice("read base cost", pt.ReadBaseCost, gs.MaxReadBaseCost),
+	); err != nil {
+		return err
+	}
 	sectorDownloadPrice, overflow := sectorReadCostRHPv3(pt)
 	if overflow {
 		return fmt.Errorf("overflow detected when computing sector download price")
@@ -333,6 +345,9 @@ func checkDownloadGougingRHPv3(gs api.GougingSettings, rs api.RedundancySettings
 }
 
 func checkDownloadGouging(gs api.GougingSettings, rs api.RedundancySettings, sectorDownloadPrice types.Currency) error {
+	if !gs.MaxSectorAccessPrice.IsZero() && sectorDownloadPrice.Cmp(gs.MaxSectorAccessPrice) > 0 {
+		return fmt.Errorf("cost per sector exceeds max sector access price: %v>%v", sectorDownloadPrice, gs.MaxSectorAccessPrice)
+	}
 	dpptb, overflow := sectorDownloadPrice.Mul64WithOverflow(1 << 40 / modules.SectorSize) // sectors per TiB
 	if overflow {
 		return fmt.Errorf("overflow detected when computing download price per TiB")
@@ -349,6 +364,9 @@ func checkDownloadGouging(gs api.GougingSettings, rs api.RedundancySettings, sec
 }
 
 func checkUploadGougingRHPv2(gs api.GougingSettings, rs api.RedundancySettings, hs rhpv2.HostSettings) error {
+	if err := checkMaxPrice("upload bandwidth price", hs.UploadBandwidthPrice, gs.MaxUploadBandwidthPriceRHPv2); err != nil {
+		return err
+	}
 	sectorUploadPricePerMonth, overflow := sectorUploadCostPerMonthRHPv2(hs)
 	if overflow {
 		return fmt.Errorf("overflow detected when computing sector price")
@@ -357,6 +375,12 @@ func checkUploadGougingRHPv2(gs api.GougingSettings, rs api.RedundancySettings,
 }
 
 func checkUploadGougingRHPv3(gs api.GougingSettings, rs api.RedundancySettings, pt rhpv3.HostPriceTable) error {
+	if err := joinErrors(
+		checkMaxPrice("upload bandwidth cost", pt.UploadBandwidthCost, gs.MaxUploadBandwidthPriceRHPv3),
+		checkMaxPrice("write base cost", pt.WriteBaseCost, gs.MaxWriteBaseCost),
+	); err != nil {
+		return err
+	}
 	sectorUploadPricePerMonth, overflow := sectorUploadCostPerMonthRHPv3(pt)
 	if overflow {
 		return fmt.Errorf("overflow detected when computing sector price")
@@ -380,6 +404,15 @@ func checkUploadGouging(gs api.GougingSettings, rs api.RedundancySettings, secto
 	return nil
 }
 
+// checkMaxPrice returns an error if price exceeds max, a zero max disables the
+// check.
+func checkMaxPrice(name string, price, max types.Currency) error {
+	if !max.IsZero() && price.Cmp(max) > 0 {
+		return fmt.Errorf("%s exceeds max: %v>%v", name, price, max)
+	}
+	return nil
+}
+
 func filterErrors(errs ...error) []error {
 	filtered := errs[:0]
 	for _, err := range errs {
@@ -0,0 +1,137 @@
+package worker
+
+import (
+	"testing"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	rhpv3 "go.sia.tech/core/rhp/v3"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+// TestPeriodGougingSettings verifies per-period and per-sector limits are
+// converted and enforced by the gouging checks.
+func TestPeriodGougingSettings(t *testing.T) {
+	const period = 144 * 7 // 1 week
+
+	// 1KS per TiB per week
+	gs := api.GougingSettings{
+		MinMaxCollateral:         types.Siacoins(1),
+		MaxStoragePricePerPeriod: types.Siacoins(1000),
+		Period:                   period,
+	}
+	limit := types.Siacoins(1000).Div64(1 << 40).Div64(period)
+	if got := gs.StoragePriceLimit(); !got.Equals(limit) {
+		t.Fatalf("unexpected limit, %v != %v", got, limit)
+	}
+
+	// the stricter limit applies
+	gs.MaxStoragePrice = limit.Div64(2)
+	if got := gs.StoragePriceLimit(); !got.Equals(limit.Div64(2)) {
+		t.Fatal("unexpected limit", got)
+	}
+	gs.MaxStoragePrice = limit.Mul64(2)
+	if got := gs.StoragePriceLimit(); !got.Equals(limit) {
+		t.Fatal("unexpected limit", got)
+	}
+
+	hs := rhpv2.HostSettings{MaxCollateral: types.Siacoins(1), StoragePrice: limit}
+	if err := checkPriceGougingHS(gs, &hs); err != nil {
+		t.Fatal(err)
+	}
+	hs.StoragePrice = limit.Add(types.NewCurrency64(1))
+	if err := checkPriceGougingHS(gs, &hs); err == nil {
+		t.Fatal("expected gouging error")
+	}
+
+	// a per-period limit requires a period
+	gs.Period = 0
+	if err := gs.Validate(); err == nil {
+		t.Fatal("expected validation error")
+	} else if got := gs.StoragePriceLimit(); !got.Equals(gs.MaxStoragePrice) {
+		t.Fatal("unexpected limit", got)
+	}
+
+	// check the sector access price
+	rs := api.RedundancySettings{MinShards: 1, TotalShards: 1}
+	gs = api.GougingSettings{MaxSectorAccessPrice: types.Siacoins(1)}
+	if err := checkDownloadGouging(gs, rs, types.Siacoins(1)); err != nil {
+		t.Fatal(err)
+	} else if err := checkDownloadGouging(gs, rs, types.Siacoins(2)); err == nil {
+		t.Fatal("expected gouging error")
+	}
+}
+
+// TestGranularGougingSettings verifies the bandwidth and base cost limits are
+// enforced independently of the aggregated download and upload prices.
+func TestGranularGougingSettings(t *testing.T) {
+	rs := api.RedundancySettings{MinShards: 1, TotalShards: 1}
+	gs := api.GougingSettings{
+		MaxDownloadBandwidthPriceRHPv2: types.NewCurrency64(10),
+		MaxUploadBandwidthPriceRHPv2:   types.NewCurrency64(10),
+		MaxDownloadBandwidthPriceRHPv3: types.NewCurrency64(10),
+		MaxUploadBandwidthPriceRHPv3:   types.NewCurrency64(10),
+		MaxReadBaseCost:                types.NewCurrency64(10),
+		MaxWriteBaseCost:               types.NewCurrency64(10),
+	}
+
+	// RHPv2
+	hs := rhpv2.HostSettings{
+		DownloadBandwidthPrice: types.NewCurrency64(10),
+		UploadBandwidthPrice:   types.NewCurrency64(10),
+		SectorAccessPrice:      types.NewCurrency64(10),
+	}
+	if err := checkDownloadGougingRHPv2(gs, rs, hs); err != nil {
+		t.Fatal(err)
+	} else if err := checkUploadGougingRHPv2(gs, rs, hs); err != nil {
+		t.Fatal(err)
+	}
+	for _, fn := range []func(*rhpv2.HostSettings){
+		func(hs *rhpv2.HostSettings) { hs.DownloadBandwidthPrice = types.NewCurrency64(11) },
+		func(hs *rhpv2.HostSettings) { hs.SectorAccessPrice = types.NewCurrency64(11) },
+	} {
+		gouging := hs
+		fn(&gouging)
+		if err := checkDownloadGougingRHPv2(gs, rs, gouging); err == nil {
+			t.Fatal("expected download gouging error")
+		}
+	}
+	gouging := hs
+	gouging.UploadBandwidthPrice = types.NewCurrency64(11)
+	if err := checkUploadGougingRHPv2(gs, rs, gouging); err == nil {
+		t.Fatal("expected upload gouging error")
+	}
+
+	// RHPv3
+	pt := rhpv3.HostPriceTable{
+		DownloadBandwidthCost: types.NewCurrency64(10),
+		UploadBandwidthCost:   types.NewCurrency64(10),
+		ReadBaseCost:          types.NewCurrency64(10),
+		WriteBaseCost:         types.NewCurrency64(10),
+	}
+	if err := checkDownloadGougingRHPv3(gs, rs, pt); err != nil {
+		t.Fatal(err)
+	} else if err := checkUploadGougingRHPv3(gs, rs, pt); err != nil {
+		t.Fatal(err)
+	}
+	for _, fn := range []func(*rhpv3.HostPriceTable){
+		func(pt *rhpv3.HostPriceTable) { pt.DownloadBandwidthCost = types.NewCurrency64(11) },
+		func(pt *rhpv3.HostPriceTable) { pt.ReadBaseCost = types.NewCurrency64(11) },
+	} {
+		gouging := pt
+		fn(&gouging)
+		if err := checkDownloadGougingRHPv3(gs, rs, gouging); err == nil {
+			t.Fatal("expected download gouging error")
+		}
+	}
+	for _, fn := range []func(*rhpv3.HostPriceTable){
+		func(pt *rhpv3.HostPriceTable) { pt.UploadBandwidthCost = types.NewCurrency64(11) },
+		func(pt *rhpv3.HostPriceTable) { pt.WriteBaseCost = types.NewCurrency64(11) },
+	} {
+		gouging := pt
+		fn(&gouging)
+		if err := checkUploadGougingRHPv3(gs, rs, gouging); err == nil {
+			t.Fatal("expected upload gouging error")
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package worker
+
+import (
+	"context"
+	"sync"
+)
+
+// memoryManager limits the amount of memory used to buffer the slabs of
+// uploads. A nil memoryManager doesn't impose a limit.
+type memoryManager struct {
+	budget uint64
+
+	mu      sync.Mutex
+	used    uint64
+	waiters []chan struct{}
+}
+
+func newMemoryManager(budget uint64) *memoryManager {
+	if budget == 0 {
+		return nil
+	}
+	return &memoryManager{budget: budget}
+}
+
+// tryAcquire reserves the given amount of memory if it fits within the budget,
+// it returns whether the memory was reserved.
+func (mm *memoryManager) tryAcquire(n uint64) bool {
+	if mm == nil {
+		return true
+	}
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	if mm.used+n > mm.budget {
+		return false
+	}
+	mm.used += n
+	return true
+}
+
+// acquire blocks until the given amount of memory fits within the budget and
+// reserves it. Requests that exceed the budget are granted once no other
+// memory is reserved, so they can't block forever.
+func (mm *memoryManager) acquire(ctx context.Context, n uint64) error {
+	if mm == nil {
+		return nil
+	}
+	for {
+		mm.mu.Lock()
+		if mm.used+n <= mm.budget || mm.used == 0 {
+			mm.used += n
+			mm.mu.Unlock()
+			return nil
+		}
+		released := make(chan struct{})
+		mm.waiters = append(mm.waiters, released)
+		mm.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release returns the given amount of memory to the budget.
+func (mm *memoryManager) release(n uint64) {
+	if mm == nil {
+		return
+	}
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	if n > mm.used {
+		panic("released more memory than was acquired") // developer error
+	}
+	mm.used -= n
+	for _, released := range mm.waiters {
+		close(released)
+	}
+	mm.waiters = nil
+}
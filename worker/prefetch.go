@@ -0,0 +1,140 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/object"
+	"lukechampine.com/frand"
+)
+
+// slabContractsFn returns the contracts that can be used to download the given
+// slab.
+type slabContractsFn func(ctx context.Context, ss object.SlabSlice) ([]api.ContractMetadata, error)
+
+// prefetchedSlab is a slab that is downloaded ahead of being written to the
+// client.
+type prefetchedSlab struct {
+	memory uint64
+	done   chan struct{}
+
+	buf bytes.Buffer
+	err error
+}
+
+// slabDownloadMemory returns the amount of memory that is reserved for
+// downloading the given slab, it covers both the shards and the recovered
+// data.
+func slabDownloadMemory(ss object.SlabSlice) uint64 {
+	return uint64(ss.MinShards) * rhpv2.SectorSize
+}
+
+// downloadSlabs downloads the given slabs and writes them to out in order.
+// While a slab is written, up to prefetchSlabs of the following slabs are
+// downloaded into memory, as long as the memory reserved for them doesn't
+// exceed prefetchMemory. If a slab fails to download, its index is returned
+// alongside the error.
+func downloadSlabs(ctx context.Context, sp storeProvider, out io.Writer, slabs []object.SlabSlice, slabContracts slabContractsFn, locker contractLocker, downloadTimeouts *hostTimeouts, overdrive uint64, prefetchSlabs int, prefetchMemory uint64) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// keep track of slow hosts so we can avoid them in consecutive slab
+	// downloads
+	var slowMu sync.Mutex
+	slow := make(map[types.PublicKey]int)
+
+	download := func(ss object.SlabSlice, w io.Writer) error {
+		contracts, err := slabContracts(ctx, ss)
+		if err != nil {
+			return err
+		}
+		if len(contracts) < int(ss.MinShards) {
+			return fmt.Errorf("not enough contracts to download the slab, %d<%d", len(contracts), ss.MinShards)
+		}
+
+		// randomize order of contracts so we don't always download from the
+		// same hosts
+		frand.Shuffle(len(contracts), func(i, j int) { contracts[i], contracts[j] = contracts[j], contracts[i] })
+
+		// move slow hosts to the back of the array
+		slowMu.Lock()
+		sort.SliceStable(contracts, func(i, j int) bool {
+			return slow[contracts[i].HostKey] < slow[contracts[j].HostKey]
+		})
+		slowMu.Unlock()
+
+		slowHosts, err := downloadSlab(ctx, sp, w, ss, contracts, locker, downloadTimeouts, overdrive)
+		slowMu.Lock()
+		for _, h := range slowHosts {
+			slow[contracts[h].HostKey]++
+		}
+		slowMu.Unlock()
+		return err
+	}
+
+	// without prefetching the slabs are streamed to the client directly
+	if prefetchSlabs <= 0 {
+		for i, ss := range slabs {
+			if err := download(ss, out); err != nil {
+				return i, err
+			}
+		}
+		return 0, nil
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	var reserved uint64
+	pending := make([]*prefetchedSlab, 0, prefetchSlabs+1)
+	next := 0
+	for i := range slabs {
+		// start downloading the current slab and as many of the following
+		// slabs as the limits allow, the current slab is always downloaded
+		for next < len(slabs) && next-i <= prefetchSlabs {
+			memory := slabDownloadMemory(slabs[next])
+			if next > i && reserved+memory > prefetchMemory {
+				break
+			}
+			ps := &prefetchedSlab{
+				memory: memory,
+				done:   make(chan struct{}),
+			}
+			ps.buf.Grow(int(slabs[next].Length))
+			reserved += memory
+			pending = append(pending, ps)
+
+			wg.Add(1)
+			go func(ss object.SlabSlice) {
+				defer wg.Done()
+				defer close(ps.done)
+				ps.err = download(ss, &ps.buf)
+			}(slabs[next])
+			next++
+		}
+
+		// write the current slab
+		ps := pending[0]
+		pending = pending[1:]
+		select {
+		case <-ps.done:
+		case <-ctx.Done():
+			return i, ctx.Err()
+		}
+		reserved -= ps.memory
+		if ps.err != nil {
+			return i, ps.err
+		}
+		if _, err := out.Write(ps.buf.Bytes()); err != nil {
+			return i, err
+		}
+	}
+	return 0, nil
+}
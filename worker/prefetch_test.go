@@ -0,0 +1,82 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/object"
+	"lukechampine.com/frand"
+)
+
+func TestDownloadSlabsPrefetch(t *testing.T) {
+	mockLocker := &mockContractLocker{}
+
+	// prepare hosts
+	var hosts []SectorStore
+	for i := 0; i < 3; i++ {
+		hosts = append(hosts, newMockHost())
+	}
+	sp := newMockStoreProvider(hosts)
+	var contracts []api.ContractMetadata
+	for _, h := range hosts {
+		contracts = append(contracts, api.ContractMetadata{ID: h.Contract(), HostKey: h.PublicKey()})
+	}
+
+	// upload a few slabs
+	data := frand.Bytes(rhpv2.SectorSize*5 + 100)
+	r := bytes.NewReader(data)
+	var slabs []object.SlabSlice
+	for r.Len() > 0 {
+		s, length, _, err := uploadSlab(context.Background(), sp, r, object.GenerateEncryptionKey(), 2, 3, contracts, mockLocker, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		slabs = append(slabs, object.SlabSlice{Slab: s, Offset: 0, Length: uint32(length)})
+	}
+	slabContracts := func(context.Context, object.SlabSlice) ([]api.ContractMetadata, error) {
+		return append([]api.ContractMetadata(nil), contracts...), nil
+	}
+
+	// download them with various prefetch settings, a memory budget that's
+	// too small for a single slab should still download the slabs one by one
+	for _, test := range []struct {
+		slabs  int
+		memory uint64
+	}{
+		{0, 0},
+		{1, 1 << 30},
+		{2, 1 << 30},
+		{10, 1 << 30},
+		{2, 1},
+	} {
+		var buf bytes.Buffer
+		if _, err := downloadSlabs(context.Background(), sp, &buf, slabs, slabContracts, mockLocker, nil, 0, test.slabs, test.memory); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(buf.Bytes(), data) {
+			t.Fatalf("unexpected data when prefetching %v slabs within %v bytes", test.slabs, test.memory)
+		}
+	}
+
+	// make fetching the contracts of the last slab fail, the slabs leading up
+	// to it should still be written
+	errFailed := errors.New("failed")
+	failingContracts := func(ctx context.Context, ss object.SlabSlice) ([]api.ContractMetadata, error) {
+		if ss.Key.String() == slabs[len(slabs)-1].Key.String() {
+			return nil, errFailed
+		}
+		return slabContracts(ctx, ss)
+	}
+	var buf bytes.Buffer
+	i, err := downloadSlabs(context.Background(), sp, &buf, slabs, failingContracts, mockLocker, nil, 0, 2, 1<<30)
+	if !errors.Is(err, errFailed) {
+		t.Fatalf("unexpected error, %v", err)
+	} else if i != len(slabs)-1 {
+		t.Fatalf("unexpected index of failed slab, %v != %v", i, len(slabs)-1)
+	} else if !bytes.Equal(buf.Bytes(), data[:rhpv2.SectorSize*4]) {
+		t.Fatal("unexpected data")
+	}
+}
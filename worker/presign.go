@@ -0,0 +1,103 @@
+package worker
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.sia.tech/jape"
+	"go.sia.tech/renterd/api"
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	// maxPresignValidity is the maximum amount of time a presigned URL is
+	// valid for.
+	maxPresignValidity = 7 * 24 * time.Hour
+
+	queryStringParamExpires   = "expires"
+	queryStringParamSignature = "signature"
+)
+
+var (
+	errInvalidPresignPath     = errors.New("presigned URLs can only be created for objects")
+	errInvalidPresignValidity = fmt.Errorf("validity has to be positive and at most %v", maxPresignValidity)
+)
+
+// presignKey derives the key used to sign presigned URLs from the worker's
+// masterkey.
+func presignKey(masterKey [32]byte) [32]byte {
+	return blake2b.Sum256(append(masterKey[:], []byte("presignkey")...))
+}
+
+// presignSignature returns the signature of a presigned URL for the object at
+// the given path, which should include the /objects prefix. The path is length
+// prefixed so different splits of the signed fields never collide.
+func presignSignature(key [32]byte, path string, expires int64) []byte {
+	var buf [8]byte
+	h, _ := blake2b.New256(key[:])
+	binary.LittleEndian.PutUint64(buf[:], uint64(len(path)))
+	h.Write(buf[:])
+	h.Write([]byte(path))
+	binary.LittleEndian.PutUint64(buf[:], uint64(expires))
+	h.Write(buf[:])
+	return h.Sum(nil)
+}
+
+// verifyPresignedRequest returns true if the request is a download carrying a
+// valid, unexpired signature.
+func verifyPresignedRequest(key [32]byte, req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	} else if !strings.HasPrefix(req.URL.Path, "/objects/") {
+		return false
+	}
+
+	q := req.URL.Query()
+	expires, err := strconv.ParseInt(q.Get(queryStringParamExpires), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	sig, err := hex.DecodeString(q.Get(queryStringParamSignature))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(sig, presignSignature(key, req.URL.Path, expires)) == 1
+}
+
+func (w *worker) presignHandlerPOST(jc jape.Context) {
+	var req api.PresignRequest
+	if jc.Decode(&req) != nil {
+		return
+	}
+	validity := time.Duration(req.Validity)
+	if validity <= 0 || validity > maxPresignValidity {
+		jc.Error(errInvalidPresignValidity, http.StatusBadRequest)
+		return
+	}
+	path := strings.TrimPrefix(req.Path, "/")
+	if path == "" || strings.HasSuffix(path, "/") {
+		jc.Error(errInvalidPresignPath, http.StatusBadRequest)
+		return
+	}
+
+	// escape the path the same way the client would when requesting it
+	u := url.URL{Path: "/objects/" + path}
+	expires := time.Now().Add(validity).Truncate(time.Second)
+	sig := presignSignature(presignKey(w.masterKey), u.Path, expires.Unix())
+
+	q := url.Values{}
+	q.Set(queryStringParamExpires, strconv.FormatInt(expires.Unix(), 10))
+	q.Set(queryStringParamSignature, hex.EncodeToString(sig))
+	jc.Encode(api.PresignResponse{
+		URL:     u.EscapedPath() + "?" + q.Encode(),
+		Expires: expires,
+	})
+}
@@ -0,0 +1,91 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.sia.tech/renterd/api"
+)
+
+const (
+	// prewarmDownloadMinSlabs is the number of slabs a download needs to
+	// span before the sessions with the involved hosts are prewarmed.
+	prewarmDownloadMinSlabs = 4
+
+	// prewarmTimeout is the maximum amount of time spent prewarming the
+	// sessions before the work starts.
+	prewarmTimeout = 30 * time.Second
+)
+
+// prewarmStats keeps track of the sessions that were established ahead of
+// scheduled work.
+type prewarmStats struct {
+	mu          sync.Mutex
+	active      int
+	warmed      uint64
+	failed      uint64
+	lastPrewarm time.Time
+}
+
+func (ps *prewarmStats) start() {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.active++
+	ps.lastPrewarm = time.Now()
+}
+
+func (ps *prewarmStats) finish(warmed, failed int) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.active--
+	ps.warmed += uint64(warmed)
+	ps.failed += uint64(failed)
+}
+
+func (ps *prewarmStats) stats() api.PrewarmStats {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return api.PrewarmStats{
+		Active:      ps.active,
+		Warmed:      ps.warmed,
+		Failed:      ps.failed,
+		LastPrewarm: ps.lastPrewarm,
+	}
+}
+
+// prewarmSessions establishes sessions with the hosts of the given contracts
+// in parallel, locking the contract and fetching the host's settings, so the
+// first transfer isn't penalized by a cold connection. The sessions remain in
+// the pool after the contracts are unlocked again.
+func (w *worker) prewarmSessions(ctx context.Context, contracts []api.ContractMetadata) (warmed, failed int) {
+	w.prewarm.start()
+	defer func() { w.prewarm.finish(warmed, failed) }()
+
+	ctx, cancel := context.WithTimeout(ctx, prewarmTimeout)
+	defer cancel()
+
+	var mu sync.Mutex
+	_ = w.withHosts(ctx, contracts, func(ss []SectorStore) error {
+		var wg sync.WaitGroup
+		for _, store := range ss {
+			wg.Add(1)
+			go func(store *sharedSession) {
+				defer wg.Done()
+				_, err := store.Revision(ctx)
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					w.logger.Debugf("failed to prewarm session with host %v, err: %v", store.PublicKey(), err)
+					failed++
+				} else {
+					warmed++
+				}
+			}(store.(*sharedSession))
+		}
+		wg.Wait()
+		return nil
+	})
+	return
+}
@@ -0,0 +1,39 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+	"go.uber.org/zap"
+)
+
+func TestPrewarmSessions(t *testing.T) {
+	w := &worker{
+		pool:   newSessionPool(time.Second, time.Minute, 0),
+		logger: zap.NewNop().Sugar(),
+	}
+	defer w.pool.Close()
+
+	// prewarm a session with an unreachable host
+	contracts := []api.ContractMetadata{{
+		ID:      types.FileContractID{1},
+		HostKey: types.PublicKey{1},
+		HostIP:  "127.0.0.1:0",
+	}}
+	warmed, failed := w.prewarmSessions(context.Background(), contracts)
+	if warmed != 0 || failed != 1 {
+		t.Fatalf("unexpected result, %v warmed, %v failed", warmed, failed)
+	}
+
+	stats := w.prewarm.stats()
+	if stats.Active != 0 {
+		t.Fatal("expected no active prewarms", stats.Active)
+	} else if stats.Warmed != 0 || stats.Failed != 1 {
+		t.Fatalf("unexpected stats, %v warmed, %v failed", stats.Warmed, stats.Failed)
+	} else if stats.LastPrewarm.IsZero() {
+		t.Fatal("expected last prewarm to be set")
+	}
+}
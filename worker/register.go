@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.sia.tech/renterd/api"
+)
+
+// workerRegisterInterval is the interval at which the worker renews its
+// registration with the bus, the bus considers workers unhealthy if they miss
+// a few renewals.
+const workerRegisterInterval = time.Minute
+
+// A busRegistration keeps the worker registered with the bus so the bus can
+// route object requests to it.
+type busRegistration struct {
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+}
+
+// RegisterWithBus registers the worker with the bus, which reaches the
+// worker's API at the given address using the given password. The
+// registration is renewed until the worker is shut down.
+func (w *worker) RegisterWithBus(address, password string) {
+	req := api.WorkerRegisterRequest{
+		ID:           w.id,
+		Address:      address,
+		Password:     password,
+		Capabilities: []string{api.WorkerCapabilityUpload, api.WorkerCapabilityDownload},
+	}
+	register := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), workerRegisterInterval)
+		defer cancel()
+		if err := w.bus.RegisterWorker(ctx, req); err != nil {
+			w.logger.Errorf("couldn't register with the bus, err: %v", err)
+		}
+	}
+
+	r := &busRegistration{stopChan: make(chan struct{})}
+	w.registration = r
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		t := time.NewTicker(workerRegisterInterval)
+		defer t.Stop()
+		for {
+			register()
+			select {
+			case <-r.stopChan:
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
+
+// stop stops renewing the registration.
+func (r *busRegistration) stop() {
+	close(r.stopChan)
+	r.wg.Wait()
+}
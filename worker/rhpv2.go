@@ -217,11 +217,11 @@ type Session struct {
 
 // Append calls the Write RPC with a single action, appending the provided
 // sector. It returns the Merkle root of the sector.
-func (s *Session) Append(ctx context.Context, sector *[rhpv2.SectorSize]byte, price, collateral types.Currency) (types.Hash256, error) {
+func (s *Session) Append(ctx context.Context, sector *[rhpv2.SectorSize]byte, price, storage, collateral types.Currency) (types.Hash256, error) {
 	err := s.Write(ctx, []rhpv2.RPCWriteAction{{
 		Type: rhpv2.RPCWriteActionAppend,
 		Data: sector[:],
-	}}, price, collateral)
+	}}, price, storage, collateral)
 	if err != nil {
 		return types.Hash256{}, err
 	}
@@ -272,7 +272,7 @@ func (s *Session) Delete(ctx context.Context, sectorIndices []uint64, price type
 	// NOTE: siad hosts will accept up to 20 MiB of data in the request,
 	// which should be sufficient to delete up to 2.5 TiB of sector data
 	// at a time.
-	return s.Write(ctx, actions, price, types.ZeroCurrency)
+	return s.Write(ctx, actions, price, types.ZeroCurrency, types.ZeroCurrency)
 }
 
 // HostKey returns the public key of the host.
@@ -287,7 +287,7 @@ func (s *Session) HostKey() types.PublicKey { return s.revision.HostKey() }
 func (s *Session) Read(ctx context.Context, w io.Writer, sections []rhpv2.RPCReadRequestSection, price types.Currency) (err error) {
 	defer wrapErr(&err, "Read")
 	defer recordRPC(ctx, s.transport, s.revision, rhpv2.RPCReadID, &err)()
-	defer recordContractSpending(ctx, s.revision.ID(), api.ContractSpending{Downloads: price}, &err)
+	defer func() { recordContractSpending(ctx, s.revision.Revision, api.ContractSpending{Downloads: price}, &err) }()
 
 	empty := true
 	for _, s := range sections {
@@ -615,11 +615,14 @@ func (s *Session) Unlock(ctx context.Context) (err error) {
 }
 
 // Write implements the Write RPC, except for ActionUpdate. A Merkle proof is
-// always requested.
-func (s *Session) Write(ctx context.Context, actions []rhpv2.RPCWriteAction, price, collateral types.Currency) (err error) {
+// always requested. Storage is the part of the price that pays for storing
+// the appended sectors, it's recorded separately from the upload spending.
+func (s *Session) Write(ctx context.Context, actions []rhpv2.RPCWriteAction, price, storage, collateral types.Currency) (err error) {
 	defer wrapErr(&err, "Write")
 	defer recordRPC(ctx, s.transport, s.revision, rhpv2.RPCWriteID, &err)()
-	defer recordContractSpending(ctx, s.revision.ID(), api.ContractSpending{Uploads: price}, &err)
+	defer func() {
+		recordContractSpending(ctx, s.revision.Revision, api.ContractSpending{Uploads: price.Sub(storage), Storage: storage}, &err)
+	}()
 
 	if !s.isRevisable() {
 		return ErrContractFinalized
@@ -1001,3 +1004,19 @@ func RPCFormContract(ctx context.Context, t *rhpv2.Transport, renterKey types.Pr
 		},
 	}, signedTxnSet, nil
 }
+
+// RenterFundsToExpectedStorage returns how much storage a renter is expected to
+// be able to afford given the provided 'renterFunds'.
+func RenterFundsToExpectedStorage(renterFunds types.Currency, duration uint64, host rhpv2.HostSettings) uint64 {
+	costPerByte := host.UploadBandwidthPrice.Add(host.StoragePrice.Mul64(duration)).Add(host.DownloadBandwidthPrice)
+	// If storage is free, we can afford 'unlimited' data.
+	if costPerByte.IsZero() {
+		return math.MaxUint64
+	}
+	// Catch overflow.
+	expectedStorage := renterFunds.Div(costPerByte)
+	if expectedStorage.Cmp(types.NewCurrency64(math.MaxUint64)) > 0 {
+		return math.MaxUint64
+	}
+	return expectedStorage.Big().Uint64()
+}
@@ -35,7 +35,7 @@ func (w *worker) fundAccount(ctx context.Context, account *account, pt rhpv3.Hos
 			if err := RPCFundAccount(t, &payment, account.id, pt.UID); err != nil {
 				return err
 			}
-			w.contractSpendingRecorder.Record(revision.ParentID, api.ContractSpending{FundAccount: cost})
+			w.contractSpendingRecorder.Record(*revision, api.ContractSpending{FundAccount: cost})
 			return nil
 		})
 	})
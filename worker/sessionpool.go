@@ -11,19 +11,79 @@ import (
 	"go.sia.tech/core/types"
 )
 
+// appendStorageCost returns the part of the price returned by
+// rhpv2.RPCAppendCost that pays for storing the sector, including the same
+// leeway.
+func appendStorageCost(settings rhpv2.HostSettings, storageDuration uint64) types.Currency {
+	return settings.StoragePrice.Mul64(rhpv2.SectorSize).Mul64(storageDuration).Mul64(125).Div64(100)
+}
+
+// rpcAppendBatchCost returns the price and collateral of a Write RPC with n
+// append operations. Unlike multiplying the result of rhpv2.RPCAppendCost by n,
+// the base RPC price is only paid once.
+func rpcAppendBatchCost(settings rhpv2.HostSettings, storageDuration, n uint64) (price, collateral types.Currency) {
+	price = settings.StoragePrice.Mul64(rhpv2.SectorSize).Mul64(storageDuration).
+		Add(settings.UploadBandwidthPrice.Mul64(rhpv2.SectorSize)).
+		Add(settings.DownloadBandwidthPrice.Mul64(128 * 32)). // proof
+		Mul64(n).
+		Add(settings.BaseRPCPrice)
+	collateral = settings.Collateral.Mul64(rhpv2.SectorSize).Mul64(storageDuration).Mul64(n)
+	// add the same leeway as rhpv2.RPCAppendCost
+	price = price.Mul64(125).Div64(100)
+	collateral = collateral.Mul64(95).Div64(100)
+	return
+}
+
 func (s *Session) appendSector(ctx context.Context, sector *[rhpv2.SectorSize]byte, currentHeight uint64) (types.Hash256, error) {
 	if currentHeight > uint64(s.Revision().Revision.WindowStart) {
 		return types.Hash256{}, fmt.Errorf("contract has expired")
 	}
 	storageDuration := uint64(s.Revision().Revision.WindowStart) - currentHeight
 	price, collateral := rhpv2.RPCAppendCost(s.settings, storageDuration)
-	root, err := s.Append(ctx, sector, price, collateral)
+	root, err := s.Append(ctx, sector, price, appendStorageCost(s.settings, storageDuration), collateral)
 	if err != nil {
 		return root, err
 	}
 	return root, nil
 }
 
+// appendSectors appends the given sectors using as few Write RPCs as the
+// host's batch size allows, amortizing the revision overhead.
+func (s *Session) appendSectors(ctx context.Context, sectors []*[rhpv2.SectorSize]byte, currentHeight uint64) ([]types.Hash256, error) {
+	if currentHeight > uint64(s.Revision().Revision.WindowStart) {
+		return nil, fmt.Errorf("contract has expired")
+	}
+	storageDuration := uint64(s.Revision().Revision.WindowStart) - currentHeight
+	storage := appendStorageCost(s.settings, storageDuration)
+
+	batchSize := s.settings.MaxReviseBatchSize / rhpv2.SectorSize
+	if batchSize == 0 {
+		batchSize = 1
+	}
+
+	roots := make([]types.Hash256, 0, len(sectors))
+	for len(sectors) > 0 {
+		n := uint64(len(sectors))
+		if n > batchSize {
+			n = batchSize
+		}
+		actions := make([]rhpv2.RPCWriteAction, n)
+		for i := range actions {
+			actions[i] = rhpv2.RPCWriteAction{
+				Type: rhpv2.RPCWriteActionAppend,
+				Data: sectors[i][:],
+			}
+		}
+		price, collateral := rpcAppendBatchCost(s.settings, storageDuration, n)
+		if err := s.Write(ctx, actions, price, storage.Mul64(n), collateral); err != nil {
+			return nil, err
+		}
+		roots = append(roots, s.appendRoots...)
+		sectors = sectors[n:]
+	}
+	return roots, nil
+}
+
 func (s *Session) readSector(ctx context.Context, w io.Writer, root types.Hash256, offset, length uint32) error {
 	sections := []rhpv2.RPCReadRequestSection{{
 		MerkleRoot: root,
@@ -37,25 +97,69 @@ func (s *Session) readSector(ctx context.Context, w io.Writer, root types.Hash25
 	return nil
 }
 
-func (s *Session) deleteSectors(ctx context.Context, roots []types.Hash256) error {
-	// download the full set of SectorRoots
+// readSectors reads the same region of the given sectors using as few Read
+// RPCs as the host's batch size allows, the regions are written to w in
+// order.
+func (s *Session) readSectors(ctx context.Context, w io.Writer, roots []types.Hash256, offset, length uint32) error {
+	batchSize := uint64(len(roots))
+	if length > 0 && s.settings.MaxDownloadBatchSize > 0 {
+		batchSize = s.settings.MaxDownloadBatchSize / uint64(length)
+	}
+	if batchSize == 0 {
+		batchSize = 1
+	}
+
+	for len(roots) > 0 {
+		n := uint64(len(roots))
+		if n > batchSize {
+			n = batchSize
+		}
+		sections := make([]rhpv2.RPCReadRequestSection, n)
+		for i := range sections {
+			sections[i] = rhpv2.RPCReadRequestSection{
+				MerkleRoot: roots[i],
+				Offset:     uint64(offset),
+				Length:     uint64(length),
+			}
+		}
+		price := rhpv2.RPCReadCost(s.settings, sections)
+		if err := s.Read(ctx, w, sections, price); err != nil {
+			return err
+		}
+		roots = roots[n:]
+	}
+	return nil
+}
+
+func (s *Session) sectorRoots(ctx context.Context) ([]types.Hash256, error) {
 	contractSectors := s.Revision().NumSectors()
-	rootIndices := make(map[types.Hash256]uint64, contractSectors)
+	roots := make([]types.Hash256, 0, contractSectors)
 	for offset := uint64(0); offset < contractSectors; {
 		n := uint64(130000) // a little less than 4MiB of roots
 		if offset+n > contractSectors {
 			n = contractSectors - offset
 		}
 		price := rhpv2.RPCSectorRootsCost(s.settings, n)
-		roots, err := s.SectorRoots(ctx, offset, n, price)
+		batch, err := s.SectorRoots(ctx, offset, n, price)
 		if err != nil {
-			return err
-		}
-		for i, root := range roots {
-			rootIndices[root] = offset + uint64(i)
+			return nil, err
 		}
+		roots = append(roots, batch...)
 		offset += n
 	}
+	return roots, nil
+}
+
+func (s *Session) deleteSectors(ctx context.Context, roots []types.Hash256) error {
+	// download the full set of SectorRoots
+	contractRoots, err := s.sectorRoots(ctx)
+	if err != nil {
+		return err
+	}
+	rootIndices := make(map[types.Hash256]uint64, len(contractRoots))
+	for i, root := range contractRoots {
+		rootIndices[root] = uint64(i)
+	}
 
 	// look up the index of each sector
 	badIndices := make([]uint64, 0, len(roots))
@@ -70,6 +174,34 @@ func (s *Session) deleteSectors(ctx context.Context, roots []types.Hash256) erro
 	return s.Delete(ctx, badIndices, price)
 }
 
+// pruneSectors deletes every sector from the contract that isn't in keep and
+// returns the number of deleted sectors.
+func (s *Session) pruneSectors(ctx context.Context, keep []types.Hash256) (uint64, error) {
+	contractRoots, err := s.sectorRoots(ctx)
+	if err != nil {
+		return 0, err
+	}
+	keepRoots := make(map[types.Hash256]struct{}, len(keep))
+	for _, r := range keep {
+		keepRoots[r] = struct{}{}
+	}
+
+	var badIndices []uint64
+	for i, root := range contractRoots {
+		if _, ok := keepRoots[root]; ok {
+			delete(keepRoots, root) // prune duplicates
+			continue
+		}
+		badIndices = append(badIndices, uint64(i))
+	}
+
+	price := rhpv2.RPCDeleteCost(s.settings, len(badIndices))
+	if err := s.Delete(ctx, badIndices, price); err != nil {
+		return 0, err
+	}
+	return uint64(len(badIndices)), nil
+}
+
 // sharedSession implements Host via the renter-host protocol.
 type sharedSession struct {
 	hostKey    types.PublicKey
@@ -92,7 +224,7 @@ func (ss *sharedSession) Revision(ctx context.Context) (rhpv2.ContractRevision,
 	if err != nil {
 		return rhpv2.ContractRevision{}, err
 	}
-	defer ss.pool.release(s)
+	defer ss.pool.release(ss, s)
 	return s.Revision(), nil
 }
 
@@ -101,7 +233,7 @@ func (ss *sharedSession) RenewContract(ctx context.Context, prepareFn func(rev t
 	if err != nil {
 		return rhpv2.ContractRevision{}, nil, err
 	}
-	defer ss.pool.release(s)
+	defer ss.pool.release(ss, s)
 
 	if errs := PerformGougingChecks(ctx, &s.settings, nil).CanUpload(); len(errs) > 0 {
 		return rhpv2.ContractRevision{}, nil, fmt.Errorf("failed reneww contract, gouging check failed: %v", errs)
@@ -128,11 +260,17 @@ func (ss *sharedSession) UploadSector(ctx context.Context, sector *[rhpv2.Sector
 	if err != nil {
 		return types.Hash256{}, err
 	}
-	defer ss.pool.release(s)
+	defer ss.pool.release(ss, s)
 	if errs := PerformGougingChecks(ctx, &s.settings, nil).CanUpload(); len(errs) > 0 {
 		return types.Hash256{}, fmt.Errorf("failed to upload sector, gouging check failed: %v", errs)
 	}
-	return s.appendSector(ctx, sector, currentHeight)
+	root, err := s.appendSector(ctx, sector, currentHeight)
+	if err != nil {
+		return types.Hash256{}, err
+	} else if err := recordUploadingSectors(ctx, ss.contractID, []types.Hash256{root}); err != nil {
+		return types.Hash256{}, fmt.Errorf("failed to record uploaded sector: %w", err)
+	}
+	return root, nil
 }
 
 func (ss *sharedSession) DownloadSector(ctx context.Context, w io.Writer, root types.Hash256, offset, length uint32) error {
@@ -140,45 +278,144 @@ func (ss *sharedSession) DownloadSector(ctx context.Context, w io.Writer, root t
 	if err != nil {
 		return err
 	}
-	defer ss.pool.release(s)
+	defer ss.pool.release(ss, s)
 	if errs := PerformGougingChecks(ctx, &s.settings, nil).CanDownload(); len(errs) > 0 {
 		return fmt.Errorf("failed to download sector, gouging check failed: %v", errs)
 	}
 	return s.readSector(ctx, w, root, offset, length)
 }
 
+// UploadSectors uploads the given sectors back-to-back over a single session.
+func (ss *sharedSession) UploadSectors(ctx context.Context, sectors []*[rhpv2.SectorSize]byte) ([]types.Hash256, error) {
+	currentHeight := ss.pool.currentHeight()
+	if currentHeight == 0 {
+		panic("cannot upload without knowing current height") // developer error
+	}
+	s, err := ss.pool.acquire(ctx, ss)
+	if err != nil {
+		return nil, err
+	}
+	defer ss.pool.release(ss, s)
+	if errs := PerformGougingChecks(ctx, &s.settings, nil).CanUpload(); len(errs) > 0 {
+		return nil, fmt.Errorf("failed to upload sectors, gouging check failed: %v", errs)
+	}
+	roots, err := s.appendSectors(ctx, sectors, currentHeight)
+	if err != nil {
+		return nil, err
+	} else if err := recordUploadingSectors(ctx, ss.contractID, roots); err != nil {
+		return nil, fmt.Errorf("failed to record uploaded sectors: %w", err)
+	}
+	return roots, nil
+}
+
+// DownloadSectors downloads the same region of the given sectors back-to-back
+// over a single session.
+func (ss *sharedSession) DownloadSectors(ctx context.Context, w io.Writer, roots []types.Hash256, offset, length uint32) error {
+	s, err := ss.pool.acquire(ctx, ss)
+	if err != nil {
+		return err
+	}
+	defer ss.pool.release(ss, s)
+	if errs := PerformGougingChecks(ctx, &s.settings, nil).CanDownload(); len(errs) > 0 {
+		return fmt.Errorf("failed to download sectors, gouging check failed: %v", errs)
+	}
+	return s.readSectors(ctx, w, roots, offset, length)
+}
+
 func (ss *sharedSession) DeleteSectors(ctx context.Context, roots []types.Hash256) error {
 	s, err := ss.pool.acquire(ctx, ss)
 	if err != nil {
 		return err
 	}
-	defer ss.pool.release(s)
+	defer ss.pool.release(ss, s)
 	return s.deleteSectors(ctx, roots)
 }
 
+// SectorRoots returns the latest revision of the contract and the roots of all
+// sectors stored in it.
+func (ss *sharedSession) SectorRoots(ctx context.Context) (rhpv2.ContractRevision, []types.Hash256, error) {
+	s, err := ss.pool.acquire(ctx, ss)
+	if err != nil {
+		return rhpv2.ContractRevision{}, nil, err
+	}
+	defer ss.pool.release(ss, s)
+	if errs := PerformGougingChecks(ctx, &s.settings, nil).CanDownload(); len(errs) > 0 {
+		return rhpv2.ContractRevision{}, nil, fmt.Errorf("failed to fetch sector roots, gouging check failed: %v", errs)
+	}
+	roots, err := s.sectorRoots(ctx)
+	if err != nil {
+		return rhpv2.ContractRevision{}, nil, err
+	}
+	return s.Revision(), roots, nil
+}
+
+// PruneSectors deletes all sectors from the contract that aren't in keep.
+func (ss *sharedSession) PruneSectors(ctx context.Context, keep []types.Hash256) (uint64, error) {
+	s, err := ss.pool.acquire(ctx, ss)
+	if err != nil {
+		return 0, err
+	}
+	defer ss.pool.release(ss, s)
+	return s.pruneSectors(ctx, keep)
+}
+
 // A sessionPool is a set of sessions that can be used for uploading and
-// downloading.
+// downloading. Sessions are kept alive across requests, idle sessions are
+// health checked periodically and closed once they exceed the idle timeout.
 type sessionPool struct {
 	sessionReconnectTimeout time.Duration
 	sessionTTL              time.Duration
+	sessionIdleTimeout      time.Duration
+
+	closeOnce sync.Once
+	closeChan chan struct{}
 
 	mu     sync.Mutex
 	height uint64
-	hosts  map[types.PublicKey]*Session
+	hosts  map[types.PublicKey]*pooledSession
 }
 
-func (sp *sessionPool) acquire(ctx context.Context, ss *sharedSession) (_ *Session, err error) {
+// A pooledSession is a session in the pool, its fields are protected by the
+// pool's mutex.
+type pooledSession struct {
+	*Session
+	refs     int
+	lastUsed time.Time
+}
+
+// ref returns the session for the given host, creating it if necessary, and
+// prevents it from being removed from the pool until unref is called.
+func (sp *sessionPool) ref(hostKey types.PublicKey) *Session {
 	sp.mu.Lock()
-	if sp.hosts[ss.hostKey] == nil {
-		sp.hosts[ss.hostKey] = &Session{}
+	defer sp.mu.Unlock()
+	ps, exists := sp.hosts[hostKey]
+	if !exists {
+		ps = &pooledSession{Session: &Session{}}
+		sp.hosts[hostKey] = ps
 	}
-	s := sp.hosts[ss.hostKey]
-	sp.mu.Unlock()
+	ps.refs++
+	ps.lastUsed = time.Now()
+	return ps.Session
+}
+
+func (sp *sessionPool) unref(hostKey types.PublicKey) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if ps, exists := sp.hosts[hostKey]; exists {
+		ps.refs--
+		ps.lastUsed = time.Now()
+	}
+}
+
+func (sp *sessionPool) acquire(ctx context.Context, ss *sharedSession) (_ *Session, err error) {
+	hostKey := ss.hostKey
+	s := sp.ref(hostKey)
 
 	s.mu.Lock()
 	defer func() {
 		if err != nil {
 			s.mu.Unlock()
+			sp.unref(hostKey)
 		}
 	}()
 
@@ -203,8 +440,9 @@ func (sp *sessionPool) acquire(ctx context.Context, ss *sharedSession) (_ *Sessi
 	return s, nil
 }
 
-func (sp *sessionPool) release(s *Session) {
+func (sp *sessionPool) release(ss *sharedSession, s *Session) {
 	s.mu.Unlock()
+	sp.unref(ss.hostKey)
 }
 
 // setCurrentHeight sets the pol's current height. This value is used when
@@ -236,11 +474,17 @@ func (sp *sessionPool) session(hostKey types.PublicKey, hostIP string, contractI
 
 func (sp *sessionPool) unlockContract(ctx context.Context, ss *sharedSession) {
 	sp.mu.Lock()
-	s, ok := ss.pool.hosts[ss.hostKey]
+	ps, ok := ss.pool.hosts[ss.hostKey]
+	if ok {
+		ps.refs++
+	}
 	sp.mu.Unlock()
 	if !ok {
 		return
 	}
+	defer sp.unref(ss.hostKey)
+
+	s := ps.Session
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if s.transport != nil && s.Revision().ID() == ss.contractID {
@@ -248,8 +492,104 @@ func (sp *sessionPool) unlockContract(ctx context.Context, ss *sharedSession) {
 	}
 }
 
+// maintainSessions closes the sessions that have been idle for longer than
+// the idle timeout and pings the remaining idle sessions, closing the ones
+// that turn out to be unhealthy so they are reconnected on the next request.
+//
+// Sessions are removed from the pool while they are being pinged, that way
+// the ping doesn't block other users of the host, who will connect a new
+// session instead.
+func (sp *sessionPool) maintainSessions() {
+	var idle []*Session
+	var check []types.PublicKey
+	checking := make(map[types.PublicKey]*pooledSession)
+	sp.mu.Lock()
+	for hostKey, ps := range sp.hosts {
+		// NOTE: a session without references isn't locked by anyone, so it's
+		// safe to inspect it while holding the pool's mutex
+		if ps.refs > 0 {
+			continue
+		}
+		if sp.sessionIdleTimeout > 0 && time.Since(ps.lastUsed) >= sp.sessionIdleTimeout {
+			delete(sp.hosts, hostKey)
+			idle = append(idle, ps.Session)
+		} else if ps.transport == nil {
+			delete(sp.hosts, hostKey)
+		} else if time.Since(ps.lastSeen) >= sp.sessionTTL {
+			delete(sp.hosts, hostKey)
+			check = append(check, hostKey)
+			checking[hostKey] = ps
+		}
+	}
+	sp.mu.Unlock()
+
+	for _, s := range idle {
+		s.Close()
+	}
+
+	var wg sync.WaitGroup
+	for _, hostKey := range check {
+		wg.Add(1)
+		go func(hostKey types.PublicKey, ps *pooledSession) {
+			defer wg.Done()
+			if !sp.healthCheck(ps.Session) {
+				ps.Close()
+				return
+			}
+
+			// add the session back to the pool unless a new session was
+			// created in the meantime
+			sp.mu.Lock()
+			_, exists := sp.hosts[hostKey]
+			if !exists {
+				sp.hosts[hostKey] = ps
+			}
+			sp.mu.Unlock()
+			if exists {
+				ps.Close()
+			}
+		}(hostKey, checking[hostKey])
+	}
+	wg.Wait()
+}
+
+// healthCheck pings the given session, the session must not be part of the
+// pool while it's being checked.
+func (sp *sessionPool) healthCheck(s *Session) bool {
+	ctx := context.Background()
+	if sp.sessionReconnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sp.sessionReconnectTimeout)
+		defer cancel()
+	}
+
+	// use RPCSettings as a generic "ping"
+	if err := s.updateSettings(ctx); err != nil {
+		return false
+	}
+	s.lastSeen = time.Now()
+	return true
+}
+
+func (sp *sessionPool) threadedMaintainSessions(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-sp.closeChan:
+			return
+		case <-t.C:
+		}
+		sp.maintainSessions()
+	}
+}
+
 // Close gracefully closes all of the sessions in the pool.
 func (sp *sessionPool) Close() error {
+	sp.closeOnce.Do(func() { close(sp.closeChan) })
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
 	for hostKey, sess := range sp.hosts {
 		sess.Close()
 		delete(sp.hosts, hostKey)
@@ -258,10 +598,22 @@ func (sp *sessionPool) Close() error {
 }
 
 // newSessionPool creates a new sessionPool.
-func newSessionPool(sessionReconectTimeout, sessionTTL time.Duration) *sessionPool {
-	return &sessionPool{
+func newSessionPool(sessionReconectTimeout, sessionTTL, sessionIdleTimeout time.Duration) *sessionPool {
+	sp := &sessionPool{
 		sessionReconnectTimeout: sessionReconectTimeout,
 		sessionTTL:              sessionTTL,
-		hosts:                   make(map[types.PublicKey]*Session),
+		sessionIdleTimeout:      sessionIdleTimeout,
+		closeChan:               make(chan struct{}),
+		hosts:                   make(map[types.PublicKey]*pooledSession),
+	}
+
+	// maintain the sessions at the shorter of the TTL and idle timeout
+	interval := sessionTTL
+	if sessionIdleTimeout > 0 && (interval == 0 || sessionIdleTimeout < interval) {
+		interval = sessionIdleTimeout
+	}
+	if interval > 0 {
+		go sp.threadedMaintainSessions(interval)
 	}
+	return sp
 }
@@ -0,0 +1,73 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/core/types"
+)
+
+func TestSessionPoolMaintenance(t *testing.T) {
+	sp := newSessionPool(0, 0, time.Minute)
+	defer sp.Close()
+
+	idle := types.PublicKey{1}
+	inUse := types.PublicKey{2}
+	recent := types.PublicKey{3}
+	for _, hk := range []types.PublicKey{idle, inUse, recent} {
+		sp.ref(hk)
+		sp.unref(hk)
+	}
+	sp.ref(inUse)
+
+	// backdate the idle sessions
+	sp.mu.Lock()
+	sp.hosts[idle].lastUsed = time.Now().Add(-2 * time.Minute)
+	sp.hosts[inUse].lastUsed = time.Now().Add(-2 * time.Minute)
+	sp.mu.Unlock()
+
+	// the idle session should be closed, the session in use should be kept
+	// and the recently used session isn't connected so it's dropped by the
+	// health check
+	sp.maintainSessions()
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+	if _, exists := sp.hosts[idle]; exists {
+		t.Fatal("idle session wasn't closed")
+	} else if ps, exists := sp.hosts[inUse]; !exists {
+		t.Fatal("session in use was closed")
+	} else if ps.refs != 1 {
+		t.Fatal("unexpected refs", ps.refs)
+	} else if _, exists := sp.hosts[recent]; exists {
+		t.Fatal("unhealthy session wasn't dropped")
+	}
+}
+
+func TestRPCAppendBatchCost(t *testing.T) {
+	settings := rhpv2.HostSettings{
+		BaseRPCPrice:           types.Siacoins(1),
+		StoragePrice:           types.NewCurrency64(3),
+		UploadBandwidthPrice:   types.NewCurrency64(5),
+		DownloadBandwidthPrice: types.NewCurrency64(7),
+		Collateral:             types.NewCurrency64(11),
+	}
+
+	// a batch of a single sector should cost the same as a single append
+	price, collateral := rpcAppendBatchCost(settings, 100, 1)
+	expectedPrice, expectedCollateral := rhpv2.RPCAppendCost(settings, 100)
+	if !price.Equals(expectedPrice) || !collateral.Equals(expectedCollateral) {
+		t.Fatalf("unexpected cost %v %v, expected %v %v", price, collateral, expectedPrice, expectedCollateral)
+	}
+
+	// the base RPC price should only be charged once per batch
+	price, collateral = rpcAppendBatchCost(settings, 100, 10)
+	settings.BaseRPCPrice = types.ZeroCurrency
+	sectorPrice, sectorCollateral := rhpv2.RPCAppendCost(settings, 100)
+	expectedPrice = sectorPrice.Mul64(10).Add(types.Siacoins(1).Mul64(125).Div64(100))
+	if !price.Equals(expectedPrice) {
+		t.Fatalf("unexpected price %v, expected %v", price, expectedPrice)
+	} else if !collateral.Equals(sectorCollateral.Mul64(10)) {
+		t.Fatalf("unexpected collateral %v, expected %v", collateral, sectorCollateral.Mul64(10))
+	}
+}
@@ -17,7 +17,7 @@ const keyContractSpendingRecorder contextKey = "ContractSpendingRecorder"
 type (
 	// A ContractSpendingRecorder records the spending of a contract.
 	ContractSpendingRecorder interface {
-		Record(fcid types.FileContractID, cs api.ContractSpending)
+		Record(rev types.FileContractRevision, cs api.ContractSpending)
 	}
 
 	contractSpendingRecorder struct {
@@ -26,17 +26,17 @@ type (
 		logger        *zap.SugaredLogger
 
 		mu                          sync.Mutex
-		contractSpendings           map[types.FileContractID]api.ContractSpending
+		contractSpendings           map[types.FileContractID]api.ContractSpendingRecord
 		contractSpendingsFlushTimer *time.Timer
 	}
 )
 
-func recordContractSpending(ctx context.Context, fcid types.FileContractID, cs api.ContractSpending, err *error) {
+func recordContractSpending(ctx context.Context, rev types.FileContractRevision, cs api.ContractSpending, err *error) {
 	if err != nil && *err != nil {
 		return
 	}
 	if sr, ok := ctx.Value(keyContractSpendingRecorder).(ContractSpendingRecorder); ok {
-		sr.Record(fcid, cs)
+		sr.Record(rev, cs)
 		return
 	}
 }
@@ -50,19 +50,27 @@ func WithContractSpendingRecorder(ctx context.Context, sr ContractSpendingRecord
 func (w *worker) newContractSpendingRecorder() *contractSpendingRecorder {
 	return &contractSpendingRecorder{
 		bus:               w.bus,
-		contractSpendings: make(map[types.FileContractID]api.ContractSpending),
+		contractSpendings: make(map[types.FileContractID]api.ContractSpendingRecord),
 		flushInterval:     w.busFlushInterval,
 		logger:            w.logger,
 	}
 }
 
-// Record sends contract spending records to the bus.
-func (sr *contractSpendingRecorder) Record(fcid types.FileContractID, cs api.ContractSpending) {
+// Record sends contract spending records to the bus, together with the funds
+// remaining in the given revision.
+func (sr *contractSpendingRecorder) Record(rev types.FileContractRevision, cs api.ContractSpending) {
 	sr.mu.Lock()
 	defer sr.mu.Unlock()
 
 	// Add spending to buffer.
-	sr.contractSpendings[fcid] = sr.contractSpendings[fcid].Add(cs)
+	record := sr.contractSpendings[rev.ParentID]
+	record.ContractID = rev.ParentID
+	record.ContractSpending = record.ContractSpending.Add(cs)
+	if rev.RevisionNumber >= record.RevisionNumber {
+		record.RevisionNumber = rev.RevisionNumber
+		record.RemainingFunds = rev.ValidRenterPayout()
+	}
+	sr.contractSpendings[rev.ParentID] = record
 
 	// If a thread was scheduled to flush the buffer we are done.
 	if sr.contractSpendingsFlushTimer != nil {
@@ -81,16 +89,13 @@ func (sr *contractSpendingRecorder) flush() {
 		ctx, span := tracing.Tracer.Start(context.Background(), "worker: flushContractSpending")
 		defer span.End()
 		records := make([]api.ContractSpendingRecord, 0, len(sr.contractSpendings))
-		for fcid, cs := range sr.contractSpendings {
-			records = append(records, api.ContractSpendingRecord{
-				ContractID:       fcid,
-				ContractSpending: cs,
-			})
+		for _, record := range sr.contractSpendings {
+			records = append(records, record)
 		}
 		if err := sr.bus.RecordContractSpending(ctx, records); err != nil {
 			sr.logger.Errorw(fmt.Sprintf("failed to record contract spending: %v", err))
 		} else {
-			sr.contractSpendings = make(map[types.FileContractID]api.ContractSpending)
+			sr.contractSpendings = make(map[types.FileContractID]api.ContractSpendingRecord)
 		}
 	}
 	sr.contractSpendingsFlushTimer = nil
@@ -0,0 +1,122 @@
+package worker
+
+import (
+	"context"
+	"io"
+	"os"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/internal/tracing"
+	"go.sia.tech/renterd/object"
+)
+
+// spillChunkSize is the size of the shard regions that are encoded at once
+// when a slab is spilled to disk.
+const spillChunkSize = 1 << 16
+
+// uploadSlabMemory returns the amount of memory it takes to upload a slab with
+// the given redundancy in memory, it covers the slab data and its shards.
+func uploadSlabMemory(m, n uint8) uint64 {
+	return (uint64(m) + uint64(n)) * rhpv2.SectorSize
+}
+
+// fileShards is a shardSource for a slab whose shards were spilled to a file,
+// a shard is only read back into memory, within the memory budget, right
+// before it is uploaded.
+type fileShards struct {
+	f      *os.File
+	shards int
+	mm     *memoryManager
+}
+
+func (fs *fileShards) numSlabs() int  { return 1 }
+func (fs *fileShards) numShards() int { return fs.shards }
+
+func (fs *fileShards) loadShards(ctx context.Context, index int) ([]*[rhpv2.SectorSize]byte, func(), error) {
+	if err := fs.mm.acquire(ctx, rhpv2.SectorSize); err != nil {
+		return nil, nil, err
+	}
+	buf := getSectorBuffer()[:rhpv2.SectorSize]
+	if _, err := fs.f.ReadAt(buf, int64(index)*rhpv2.SectorSize); err != nil {
+		putSectorBuffers([][]byte{buf})
+		fs.mm.release(rhpv2.SectorSize)
+		return nil, nil, err
+	}
+	return []*[rhpv2.SectorSize]byte{(*[rhpv2.SectorSize]byte)(buf)}, func() {
+		putSectorBuffers([][]byte{buf})
+		fs.mm.release(rhpv2.SectorSize)
+	}, nil
+}
+
+// createSpillFile creates a temporary file in dir, or in the default directory
+// for temporary files if dir is empty. The file is removed when closed through
+// the returned function.
+func createSpillFile(dir string) (*os.File, func(), error) {
+	f, err := os.CreateTemp(dir, "renterd-upload-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, func() {
+		f.Close()
+		os.Remove(f.Name())
+	}, nil
+}
+
+// uploadSlabSpilled is like uploadSlab, but rather than holding the slab in
+// memory its data is encoded in small chunks and the encoded shards are
+// spilled to a temporary file in dir.
+func uploadSlabSpilled(ctx context.Context, sp storeProvider, r io.Reader, key object.EncryptionKey, m, n uint8, contracts []api.ContractMetadata, locker contractLocker, uploadTimeouts *hostTimeouts, overdrive uint64, dir string, mm *memoryManager) (object.Slab, int, []int, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "uploadSlabSpilled")
+	defer span.End()
+
+	f, closeFn, err := createSpillFile(dir)
+	if err != nil {
+		return object.Slab{}, 0, nil, err
+	}
+	defer closeFn()
+
+	s := object.Slab{
+		Key:       key,
+		MinShards: m,
+	}
+
+	// encode the slab chunk by chunk, the i-th shard is written to the i-th
+	// sector of the file
+	data := make([]byte, int(m)*spillChunkSize)
+	chunks := make([][]byte, n)
+	for i := range chunks {
+		chunks[i] = make([]byte, spillChunkSize)
+	}
+	var length int
+	for off := 0; off < rhpv2.SectorSize; off += spillChunkSize {
+		read, err := io.ReadFull(r, data)
+		if err == io.EOF && off == 0 {
+			return object.Slab{}, 0, nil, io.EOF
+		} else if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return object.Slab{}, 0, nil, err
+		}
+		for i := read; i < len(data); i++ {
+			data[i] = 0
+		}
+		length += read
+
+		if err := s.EncodeChunk(data, chunks); err != nil {
+			return object.Slab{}, 0, nil, err
+		}
+		s.EncryptAt(chunks, uint32(off))
+		for i, chunk := range chunks {
+			if _, err := f.WriteAt(chunk, int64(i)*rhpv2.SectorSize+int64(off)); err != nil {
+				return object.Slab{}, 0, nil, err
+			}
+		}
+	}
+
+	sectors, slowHosts, err := uploadShards(ctx, sp, &fileShards{f: f, shards: int(n), mm: mm}, contracts, locker, uploadTimeouts, overdrive)
+	if err != nil {
+		return object.Slab{}, 0, nil, err
+	}
+
+	s.Shards = sectors[0]
+	return s, length, slowHosts, nil
+}
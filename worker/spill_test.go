@@ -0,0 +1,118 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/renterd/api"
+	"go.sia.tech/renterd/object"
+	"lukechampine.com/frand"
+)
+
+func TestUploadSlabSpilled(t *testing.T) {
+	mockLocker := &mockContractLocker{}
+
+	// prepare hosts
+	var hosts []SectorStore
+	for i := 0; i < 5; i++ {
+		hosts = append(hosts, newMockHost())
+	}
+	sp := newMockStoreProvider(hosts)
+	var contracts []api.ContractMetadata
+	for _, h := range hosts {
+		contracts = append(contracts, api.ContractMetadata{ID: h.Contract(), HostKey: h.PublicKey()})
+	}
+
+	// upload a slab with a memory budget that only fits a single sector
+	dir := t.TempDir()
+	mm := newMemoryManager(rhpv2.SectorSize)
+	data := frand.Bytes(rhpv2.SectorSize*2 - 1000)
+	key := object.GenerateEncryptionKey()
+	s, length, _, err := uploadSlabSpilled(context.Background(), sp, bytes.NewReader(data), key, 2, 5, contracts, mockLocker, nil, 0, dir, mm)
+	if err != nil {
+		t.Fatal(err)
+	} else if length != len(data) {
+		t.Fatalf("unexpected length, %v != %v", length, len(data))
+	} else if mm.used != 0 {
+		t.Fatalf("memory wasn't released, %v bytes in use", mm.used)
+	}
+
+	// the spill file should have been removed
+	if entries, err := os.ReadDir(dir); err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 0 {
+		t.Fatalf("spill directory wasn't cleaned up, %v entries", len(entries))
+	}
+
+	// the slab should match the one uploaded from memory
+	expected, _, _, err := uploadSlab(context.Background(), sp, bytes.NewReader(data), key, 2, 5, contracts, mockLocker, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range s.Shards {
+		if s.Shards[i].Root != expected.Shards[i].Root {
+			t.Fatalf("shard %v doesn't match", i)
+		}
+	}
+
+	// download the slab
+	var buf bytes.Buffer
+	ss := object.SlabSlice{Slab: s, Offset: 0, Length: uint32(length)}
+	if _, err := downloadSlab(context.Background(), sp, &buf, ss, contracts, mockLocker, nil, 0); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("unexpected data")
+	}
+
+	// spilling an empty reader should return io.EOF
+	if _, _, _, err := uploadSlabSpilled(context.Background(), sp, bytes.NewReader(nil), key, 2, 5, contracts, mockLocker, nil, 0, dir, mm); err != io.EOF {
+		t.Fatal("expected io.EOF, got", err)
+	}
+}
+
+func TestMemoryManager(t *testing.T) {
+	// a nil manager doesn't impose a limit
+	var mm *memoryManager
+	if !mm.tryAcquire(1 << 40) {
+		t.Fatal("expected memory to be acquired")
+	}
+	mm.release(1 << 40)
+
+	mm = newMemoryManager(100)
+	if !mm.tryAcquire(60) {
+		t.Fatal("expected memory to be acquired")
+	} else if mm.tryAcquire(60) {
+		t.Fatal("expected memory to exceed the budget")
+	}
+
+	// acquire should block until enough memory was released
+	acquired := make(chan error)
+	go func() { acquired <- mm.acquire(context.Background(), 60) }()
+	select {
+	case <-acquired:
+		t.Fatal("memory shouldn't have been acquired")
+	case <-time.After(50 * time.Millisecond):
+	}
+	mm.release(60)
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+
+	// acquire respects the context
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := mm.acquire(ctx, 60); err != context.DeadlineExceeded {
+		t.Fatal("unexpected error", err)
+	}
+
+	// requests exceeding the budget are granted once no memory is in use
+	mm.release(60)
+	if err := mm.acquire(context.Background(), 1000); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,105 @@
+package worker
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"go.sia.tech/core/types"
+)
+
+const (
+	// hostTimeoutSamples is the number of sector latencies that are kept per
+	// host to derive its timeout from.
+	hostTimeoutSamples = 100
+
+	// hostTimeoutMinSamples is the number of sector latencies that need to be
+	// observed before a host's timeout is derived from its latencies, until
+	// then the static timeout is used.
+	hostTimeoutMinSamples = 10
+
+	// hostTimeoutPercentile is the percentile of a host's latencies that is
+	// multiplied by hostTimeoutFactor to derive its timeout.
+	hostTimeoutPercentile = 95
+	hostTimeoutFactor     = 3
+
+	// minHostTimeout is the lower bound of a derived timeout, it prevents
+	// hosts that are consistently fast from being flagged as slow because of
+	// a small hiccup.
+	minHostTimeout = 500 * time.Millisecond
+)
+
+// hostTimeouts derives the timeout of a sector transfer from the latencies
+// previously observed for the host involved. The static timeout is used for
+// unknown hosts and serves as the upper bound of the derived timeouts, that
+// way one slow host doesn't define the timeout applied to all hosts. A nil
+// hostTimeouts disables the timeouts.
+type hostTimeouts struct {
+	static time.Duration
+
+	mu        sync.Mutex
+	latencies map[types.PublicKey]*latencySamples
+}
+
+// latencySamples is a ring buffer of sector latencies.
+type latencySamples struct {
+	samples [hostTimeoutSamples]time.Duration
+	count   uint64
+}
+
+func newHostTimeouts(static time.Duration) *hostTimeouts {
+	return &hostTimeouts{
+		static:    static,
+		latencies: make(map[types.PublicKey]*latencySamples),
+	}
+}
+
+// timeout returns the timeout for transferring a single sector with the given
+// host, a timeout of 0 means no timeout is applied.
+func (ht *hostTimeouts) timeout(hk types.PublicKey) time.Duration {
+	if ht == nil || ht.static == 0 {
+		return 0
+	}
+
+	ht.mu.Lock()
+	ls, exists := ht.latencies[hk]
+	if !exists || ls.count < hostTimeoutMinSamples {
+		ht.mu.Unlock()
+		return ht.static
+	}
+	n := ls.count
+	if n > hostTimeoutSamples {
+		n = hostTimeoutSamples
+	}
+	samples := append([]time.Duration(nil), ls.samples[:n]...)
+	ht.mu.Unlock()
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	i := (len(samples)*hostTimeoutPercentile+99)/100 - 1
+	timeout := samples[i] * hostTimeoutFactor
+	if timeout < minHostTimeout {
+		timeout = minHostTimeout
+	}
+	if timeout > ht.static {
+		timeout = ht.static
+	}
+	return timeout
+}
+
+// track records the latency of transferring a single sector with the given
+// host.
+func (ht *hostTimeouts) track(hk types.PublicKey, latency time.Duration) {
+	if ht == nil || latency <= 0 {
+		return
+	}
+
+	ht.mu.Lock()
+	defer ht.mu.Unlock()
+	ls, exists := ht.latencies[hk]
+	if !exists {
+		ls = new(latencySamples)
+		ht.latencies[hk] = ls
+	}
+	ls.samples[ls.count%hostTimeoutSamples] = latency
+	ls.count++
+}
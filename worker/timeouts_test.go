@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"go.sia.tech/core/types"
+)
+
+func TestHostTimeouts(t *testing.T) {
+	// a nil tracker or a static timeout of 0 disables the timeouts
+	var ht *hostTimeouts
+	ht.track(types.PublicKey{1}, time.Second)
+	if timeout := ht.timeout(types.PublicKey{1}); timeout != 0 {
+		t.Fatal("unexpected timeout", timeout)
+	}
+	if timeout := newHostTimeouts(0).timeout(types.PublicKey{1}); timeout != 0 {
+		t.Fatal("unexpected timeout", timeout)
+	}
+
+	// unknown hosts fall back to the static timeout
+	ht = newHostTimeouts(10 * time.Second)
+	fast, slow := types.PublicKey{1}, types.PublicKey{2}
+	if timeout := ht.timeout(fast); timeout != 10*time.Second {
+		t.Fatal("unexpected timeout", timeout)
+	}
+
+	// hosts with too few samples fall back to the static timeout as well
+	for i := 0; i < hostTimeoutMinSamples-1; i++ {
+		ht.track(fast, time.Second)
+	}
+	if timeout := ht.timeout(fast); timeout != 10*time.Second {
+		t.Fatal("unexpected timeout", timeout)
+	}
+
+	// once enough samples were tracked the timeout is derived from them
+	for i := 0; i < hostTimeoutSamples; i++ {
+		ht.track(fast, time.Second)
+	}
+	if timeout := ht.timeout(fast); timeout != hostTimeoutFactor*time.Second {
+		t.Fatal("unexpected timeout", timeout)
+	}
+
+	// the percentile ignores the occasional outlier
+	ht.track(fast, time.Minute)
+	if timeout := ht.timeout(fast); timeout != hostTimeoutFactor*time.Second {
+		t.Fatal("unexpected timeout", timeout)
+	}
+
+	// the derived timeout is capped by the static timeout and doesn't affect
+	// the timeout of other hosts
+	for i := 0; i < hostTimeoutSamples; i++ {
+		ht.track(slow, time.Minute)
+	}
+	if timeout := ht.timeout(slow); timeout != 10*time.Second {
+		t.Fatal("unexpected timeout", timeout)
+	}
+	if timeout := ht.timeout(fast); timeout != hostTimeoutFactor*time.Second {
+		t.Fatal("unexpected timeout", timeout)
+	}
+
+	// the derived timeout has a lower bound
+	for i := 0; i < hostTimeoutSamples; i++ {
+		ht.track(fast, time.Millisecond)
+	}
+	if timeout := ht.timeout(fast); timeout != minHostTimeout {
+		t.Fatal("unexpected timeout", timeout)
+	}
+}
@@ -1,12 +1,12 @@
 package worker
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"sort"
+	"sync"
 	"time"
 
 	"go.opentelemetry.io/otel/attribute"
@@ -22,75 +22,317 @@ import (
 const (
 	contractLockingUploadPriority   = 1
 	contractLockingDownloadPriority = 2
+
+	// contractLockingLeaseDuration is the lease of the contract locks held by
+	// the worker, it's renewed until the lock is released so a worker that
+	// dies only blocks the contract for one lease.
+	contractLockingLeaseDuration = 30 * time.Second
 )
 
 var (
 	errUnusedHost            = errors.New("host not used")
 	errDownloadSectorTimeout = errors.New("download sector timed out")
 	errUploadSectorTimeout   = errors.New("upload sector timed out")
+	errUploadRaceLost        = errors.New("shard was uploaded to another host first")
 )
 
-// A sectorStore stores contract data.
-type sectorStore interface {
+// acquireContractLease acquires the lock of the given contract and keeps its
+// lease alive until the returned release function is called. The returned
+// context is cancelled if the lease is lost, e.g. because the bus expired it,
+// so the contract isn't revised while another worker may hold the lock.
+func acquireContractLease(ctx context.Context, locker contractLocker, fcid types.FileContractID, priority int, d time.Duration) (context.Context, func(context.Context), error) {
+	lockID, err := locker.AcquireContract(ctx, fcid, priority, d)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	leaseCtx, cancel := context.WithCancel(ctx)
+	doneChan := make(chan struct{})
+	go func() {
+		t := time.NewTicker(d / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-doneChan:
+				return
+			case <-leaseCtx.Done():
+				return
+			case <-t.C:
+			}
+			keepaliveCtx, keepaliveCancel := context.WithTimeout(leaseCtx, d/3)
+			err := locker.KeepaliveContract(keepaliveCtx, fcid, lockID, d)
+			keepaliveCancel()
+			if err != nil && leaseCtx.Err() == nil {
+				cancel() // lease lost
+				return
+			}
+		}
+	}()
+
+	return leaseCtx, func(ctx context.Context) {
+		close(doneChan)
+		cancel()
+		locker.ReleaseContract(ctx, fcid, lockID)
+	}, nil
+}
+
+// A SectorStore stores contract data.
+type SectorStore interface {
 	Contract() types.FileContractID
 	PublicKey() types.PublicKey
 	UploadSector(ctx context.Context, sector *[rhpv2.SectorSize]byte) (types.Hash256, error)
 	DownloadSector(ctx context.Context, w io.Writer, root types.Hash256, offset, length uint32) error
+	UploadSectors(ctx context.Context, sectors []*[rhpv2.SectorSize]byte) ([]types.Hash256, error)
+	DownloadSectors(ctx context.Context, w io.Writer, roots []types.Hash256, offset, length uint32) error
 	DeleteSectors(ctx context.Context, roots []types.Hash256) error
 }
 
+// sectorBufferPool pools sector-sized buffers so the transfer code can stream
+// sectors into buffers that are reused across slabs instead of allocating new
+// ones for every sector.
+var sectorBufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, rhpv2.SectorSize)
+		return &b
+	},
+}
+
+// getSectorBuffer returns an empty buffer with a capacity of one sector.
+func getSectorBuffer() []byte {
+	return (*sectorBufferPool.Get().(*[]byte))[:0]
+}
+
+// putSectorBuffers returns the given buffers to the pool, the caller must not
+// use them afterwards.
+func putSectorBuffers(bufs [][]byte) {
+	for _, b := range bufs {
+		if cap(b) == rhpv2.SectorSize {
+			buf := b[:0]
+			sectorBufferPool.Put(&buf)
+		}
+	}
+}
+
+// slabBufferPool pools the buffers holding the slab data before it's erasure
+// coded.
+var slabBufferPool sync.Pool
+
+// getSlabBuffer returns a zeroed buffer of the given size.
+func getSlabBuffer(size int) []byte {
+	if b, ok := slabBufferPool.Get().(*[]byte); ok && cap(*b) >= size {
+		buf := (*b)[:size]
+		for i := range buf {
+			buf[i] = 0
+		}
+		return buf
+	}
+	return make([]byte, size)
+}
+
+// putSlabBuffer returns the given buffer to the pool, the caller must not use
+// it afterwards.
+func putSlabBuffer(b []byte) {
+	slabBufferPool.Put(&b)
+}
+
+// shardWriter streams consecutive regions of sector data into shard buffers,
+// every shard receives length bytes.
+type shardWriter struct {
+	shards [][]byte
+	length int
+	i      int
+}
+
+func (sw *shardWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if sw.i >= len(sw.shards) {
+			return 0, errors.New("received more data than expected")
+		}
+		take := sw.length - len(sw.shards[sw.i])
+		if take > len(p) {
+			take = len(p)
+		}
+		sw.shards[sw.i] = append(sw.shards[sw.i], p[:take]...)
+		p = p[take:]
+		if len(sw.shards[sw.i]) == sw.length {
+			sw.i++
+		}
+	}
+	return n, nil
+}
+
+// full returns whether every shard received all of its data.
+func (sw *shardWriter) full() bool {
+	for _, shard := range sw.shards {
+		if len(shard) != sw.length {
+			return false
+		}
+	}
+	return true
+}
+
+// A shardSource provides the shards of the slabs that are uploaded together.
+// The shards at a given index are loaded right before they are uploaded and
+// released once the upload finished.
+type shardSource interface {
+	numSlabs() int
+	numShards() int
+	loadShards(ctx context.Context, index int) ([]*[rhpv2.SectorSize]byte, func(), error)
+}
+
+// memoryShards is a shardSource for slabs that are held in memory.
+type memoryShards [][][]byte
+
+func (ms memoryShards) numSlabs() int  { return len(ms) }
+func (ms memoryShards) numShards() int { return len(ms[0]) }
+
+func (ms memoryShards) loadShards(_ context.Context, index int) ([]*[rhpv2.SectorSize]byte, func(), error) {
+	sectors := make([]*[rhpv2.SectorSize]byte, len(ms))
+	for i := range ms {
+		sectors[i] = (*[rhpv2.SectorSize]byte)(ms[i][index])
+	}
+	return sectors, func() {}, nil
+}
+
 type storeProvider interface {
-	withHost(context.Context, types.FileContractID, types.PublicKey, string, func(sectorStore) error) (err error)
+	withHost(context.Context, types.FileContractID, types.PublicKey, string, func(SectorStore) error) (err error)
 }
 
-func parallelUploadSlab(ctx context.Context, sp storeProvider, shards [][]byte, contracts []api.ContractMetadata, locker contractLocker, uploadSectorTimeout time.Duration) ([]object.Sector, []int, error) {
-	if len(contracts) < len(shards) {
-		return nil, nil, fmt.Errorf("not enough hosts to upload slab, %v<%v", len(contracts), len(shards))
+func parallelUploadSlab(ctx context.Context, sp storeProvider, shards [][]byte, contracts []api.ContractMetadata, locker contractLocker, uploadTimeouts *hostTimeouts, overdrive uint64) ([]object.Sector, []int, error) {
+	sectors, slowHosts, err := parallelUploadSlabs(ctx, sp, [][][]byte{shards}, contracts, locker, uploadTimeouts, overdrive)
+	if err != nil {
+		return nil, nil, err
 	}
+	return sectors[0], slowHosts, nil
+}
+
+// parallelUploadSlabs uploads the shards of multiple slabs, the i-th shard of
+// every slab is uploaded to the same host, pipelining the sectors over a
+// single session.
+func parallelUploadSlabs(ctx context.Context, sp storeProvider, slabs [][][]byte, contracts []api.ContractMetadata, locker contractLocker, uploadTimeouts *hostTimeouts, overdrive uint64) ([][]object.Sector, []int, error) {
+	if len(slabs) == 0 {
+		return nil, nil, nil
+	}
+	shards := slabs[0]
+	for _, s := range slabs[1:] {
+		if len(s) != len(shards) {
+			return nil, nil, errors.New("slabs have a different number of shards")
+		}
+	}
+	return uploadShards(ctx, sp, memoryShards(slabs), contracts, locker, uploadTimeouts, overdrive)
+}
+
+// uploadShards uploads the shards provided by src to the given hosts, the
+// shards with the same index are pipelined to the same host.
+func uploadShards(ctx context.Context, sp storeProvider, src shardSource, contracts []api.ContractMetadata, locker contractLocker, uploadTimeouts *hostTimeouts, overdrive uint64) ([][]object.Sector, []int, error) {
+	numSlabs, numShards := src.numSlabs(), src.numShards()
+	if len(contracts) < numShards {
+		return nil, nil, fmt.Errorf("not enough hosts to upload slab, %v<%v", len(contracts), numShards)
+	}
+
+	// every shard gets its own context, that way we can cancel the requests
+	// that lost the race once a shard was uploaded, the contracts are
+	// released and the redundant sectors are deleted using the parent context
+	parentCtx := ctx
+	shardCtxs := make([]context.Context, numShards)
+	shardCancels := make([]context.CancelFunc, numShards)
+	for i := range shardCancels {
+		shardCtxs[i], shardCancels[i] = context.WithCancel(ctx)
+		defer shardCancels[i]()
+	}
+
+	// keep track of which shards were uploaded, only the first host to finish
+	// uploading a shard gets to keep it
+	var uploadedMu sync.Mutex
+	uploaded := make([]bool, numShards)
 
 	type req struct {
 		contract   api.ContractMetadata
 		shardIndex int
 	}
 	type resp struct {
-		req  req
-		root types.Hash256
-		err  error
+		req   req
+		roots []types.Hash256
+		err   error
 	}
 	respChan := make(chan resp, 2*len(contracts)) // every host can send up to 2 responses
+	var wg sync.WaitGroup
 	worker := func(r req) {
+		defer wg.Done()
+
+		// load the shards before the timeout starts ticking, loading them
+		// might have to wait for memory to become available
+		sectors, release, err := src.loadShards(shardCtxs[r.shardIndex], r.shardIndex)
+		if err != nil {
+			respChan <- resp{r, nil, err}
+			return
+		}
+		defer release()
+
 		doneChan := make(chan struct{})
 
 		// Trace the upload.
-		ctx, span := tracing.Tracer.Start(ctx, "upload-request")
+		ctx, span := tracing.Tracer.Start(shardCtxs[r.shardIndex], "upload-request")
 		span.SetAttributes(attribute.Stringer("host", r.contract.HostKey))
 		span.SetAttributes(attribute.Stringer("contract", r.contract.ID))
 
 		go func(r req) {
 			defer close(doneChan)
 
-			lockID, err := locker.AcquireContract(ctx, r.contract.ID, contractLockingUploadPriority, 30*time.Second)
+			ctx, release, err := acquireContractLease(ctx, locker, r.contract.ID, contractLockingUploadPriority, contractLockingLeaseDuration)
 			if err != nil {
-				respChan <- resp{r, types.Hash256{}, err}
+				respChan <- resp{r, nil, err}
 				span.SetStatus(codes.Error, "acquiring the contract failed")
 				span.RecordError(err)
 				return
 			}
-			defer locker.ReleaseContract(ctx, r.contract.ID, lockID)
-
-			_ = sp.withHost(ctx, r.contract.ID, r.contract.HostKey, r.contract.HostIP, func(ss sectorStore) error {
-				root, err := ss.UploadSector(ctx, (*[rhpv2.SectorSize]byte)(shards[r.shardIndex]))
+			defer release(parentCtx)
+
+			_ = sp.withHost(ctx, r.contract.ID, r.contract.HostKey, r.contract.HostIP, func(ss SectorStore) error {
+				var roots []types.Hash256
+				start := time.Now()
+				if len(sectors) == 1 {
+					var root types.Hash256
+					root, err = ss.UploadSector(ctx, sectors[0])
+					roots = []types.Hash256{root}
+				} else {
+					roots, err = ss.UploadSectors(ctx, sectors)
+				}
 				if err != nil {
 					span.SetStatus(codes.Error, "uploading the sector failed")
 					span.RecordError(err)
+					respChan <- resp{r, nil, err}
+					return err
 				}
-				respChan <- resp{r, root, err}
-				return err
+				uploadTimeouts.track(r.contract.HostKey, time.Since(start)/time.Duration(len(sectors)))
+
+				// claim the shard, the response is sent while holding the
+				// lock to ensure the winner's response is received first
+				uploadedMu.Lock()
+				won := !uploaded[r.shardIndex]
+				if won {
+					uploaded[r.shardIndex] = true
+					respChan <- resp{r, roots, nil}
+				}
+				uploadedMu.Unlock()
+				if won {
+					return nil
+				}
+
+				// another host won the race, clean up the redundant sector
+				span.SetAttributes(attribute.Bool("overdrive", true))
+				if err := ss.DeleteSectors(parentCtx, roots); err != nil {
+					span.RecordError(err)
+				}
+				respChan <- resp{r, roots, errUploadRaceLost}
+				return nil
 			})
 		}(r)
 
-		if uploadSectorTimeout > 0 {
-			timer := time.NewTimer(uploadSectorTimeout)
+		// the timeout applies to every sector that is pipelined
+		if timeout := uploadTimeouts.timeout(r.contract.HostKey); timeout > 0 {
+			timer := time.NewTimer(timeout * time.Duration(numSlabs))
 			select {
 			case <-timer.C:
 				span.SetAttributes(attribute.Bool("slow", true))
@@ -111,7 +353,8 @@ func parallelUploadSlab(ctx context.Context, sp storeProvider, shards [][]byte,
 	// spawn workers and send initial requests
 	hostIndex := 0
 	inflight := 0
-	for i := range shards {
+	for i := 0; i < numShards; i++ {
+		wg.Add(1)
 		go worker(req{contracts[hostIndex], i})
 		hostIndex++
 		inflight++
@@ -119,30 +362,66 @@ func parallelUploadSlab(ctx context.Context, sp storeProvider, shards [][]byte,
 
 	// collect responses
 	var errs HostErrorSet
-	sectors := make([]object.Sector, len(shards))
-	rem := len(shards)
+	var overdriven uint64
+	sectors := make([][]object.Sector, numSlabs)
+	for i := range sectors {
+		sectors[i] = make([]object.Sector, numShards)
+	}
+	rem := numShards
 	for rem > 0 && inflight > 0 {
 		resp := <-respChan
-		if !errors.Is(resp.err, errUploadSectorTimeout) {
+		timedOut := errors.Is(resp.err, errUploadSectorTimeout)
+		if !timedOut {
 			inflight--
 		}
 
+		// ignore responses for shards that were already uploaded, these are
+		// the requests that lost the race
+		if sectors[0][resp.req.shardIndex].Root != (types.Hash256{}) {
+			continue
+		}
+
 		if resp.err != nil {
 			errs = append(errs, &HostError{resp.req.contract.HostKey, resp.err})
+
+			// slow hosts are raced against the next host as long as the
+			// overdrive budget allows it, failed hosts are always replaced
+			if timedOut && overdriven >= overdrive {
+				continue
+			} else if timedOut {
+				overdriven++
+			}
+
 			// try next host
 			if hostIndex < len(contracts) {
+				wg.Add(1)
 				go worker(req{contracts[hostIndex], resp.req.shardIndex})
 				hostIndex++
 				inflight++
 			}
-		} else if sectors[resp.req.shardIndex].Root == (types.Hash256{}) {
-			sectors[resp.req.shardIndex] = object.Sector{
-				Host: resp.req.contract.HostKey,
-				Root: resp.root,
+		} else {
+			for i, root := range resp.roots {
+				sectors[i][resp.req.shardIndex] = object.Sector{
+					Host: resp.req.contract.HostKey,
+					Root: root,
+				}
 			}
+			shardCancels[resp.req.shardIndex]()
 			rem--
 		}
 	}
+
+	// cancel the requests that are still in flight and wait for them to
+	// return, the caller reuses the shard buffers once we return
+	for _, cancel := range shardCancels {
+		cancel()
+	}
+	for inflight > 0 {
+		if resp := <-respChan; !errors.Is(resp.err, errUploadSectorTimeout) {
+			inflight--
+		}
+	}
+	wg.Wait()
 	if rem > 0 {
 		return nil, nil, errs
 	}
@@ -166,24 +445,33 @@ func parallelUploadSlab(ctx context.Context, sp storeProvider, shards [][]byte,
 	return sectors, slowHosts, nil
 }
 
-func uploadSlab(ctx context.Context, sp storeProvider, r io.Reader, m, n uint8, contracts []api.ContractMetadata, locker contractLocker, uploadSectorTimeout time.Duration) (object.Slab, int, []int, error) {
+func uploadSlab(ctx context.Context, sp storeProvider, r io.Reader, key object.EncryptionKey, m, n uint8, contracts []api.ContractMetadata, locker contractLocker, uploadTimeouts *hostTimeouts, overdrive uint64) (object.Slab, int, []int, error) {
 	ctx, span := tracing.Tracer.Start(ctx, "uploadSlab")
 	defer span.End()
 
-	buf := make([]byte, int(m)*rhpv2.SectorSize)
-	shards := make([][]byte, n)
+	buf := getSlabBuffer(int(m) * rhpv2.SectorSize)
+	defer putSlabBuffer(buf)
 	length, err := io.ReadFull(r, buf)
 	if err != nil && err != io.ErrUnexpectedEOF {
 		return object.Slab{}, 0, nil, err
 	}
+
+	// encode into pooled shard buffers, they are reused once the upload
+	// returned
+	shards := make([][]byte, n)
+	for i := range shards {
+		shards[i] = getSectorBuffer()
+	}
+	defer putSectorBuffers(shards)
+
 	s := object.Slab{
-		Key:       object.GenerateEncryptionKey(),
+		Key:       key,
 		MinShards: m,
 	}
 	s.Encode(buf, shards)
 	s.Encrypt(shards)
 
-	sectors, slowHosts, err := parallelUploadSlab(ctx, sp, shards, contracts, locker, uploadSectorTimeout)
+	sectors, slowHosts, err := parallelUploadSlab(ctx, sp, shards, contracts, locker, uploadTimeouts, overdrive)
 	if err != nil {
 		return object.Slab{}, 0, nil, err
 	}
@@ -192,69 +480,154 @@ func uploadSlab(ctx context.Context, sp storeProvider, r io.Reader, m, n uint8,
 	return s, length, slowHosts, nil
 }
 
-func parallelDownloadSlab(ctx context.Context, sp storeProvider, ss object.SlabSlice, contracts []api.ContractMetadata, locker contractLocker, downloadSectorTimeout time.Duration) ([][]byte, []int, error) {
-	// check whether we can recover the slab
-	if len(contracts) < int(ss.MinShards) {
+// uploadSlabs encodes every piece of data into its own slab and uploads them
+// together, pipelining the shards that end up on the same host.
+func uploadSlabs(ctx context.Context, sp storeProvider, data [][]byte, m, n uint8, contracts []api.ContractMetadata, locker contractLocker, uploadTimeouts *hostTimeouts, overdrive uint64) ([]object.Slab, []int, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "uploadSlabs")
+	defer span.End()
+
+	for i := range data {
+		if len(data[i]) > int(m)*rhpv2.SectorSize {
+			return nil, nil, fmt.Errorf("data exceeds slab size, %v>%v", len(data[i]), int(m)*rhpv2.SectorSize)
+		}
+	}
+
+	slabs := make([]object.Slab, len(data))
+	shards := make([][][]byte, len(data))
+	for i := range data {
+		buf := getSlabBuffer(int(m) * rhpv2.SectorSize)
+		copy(buf, data[i])
+		slabs[i] = object.Slab{
+			Key:       object.GenerateEncryptionKey(),
+			MinShards: m,
+		}
+		shards[i] = make([][]byte, n)
+		for j := range shards[i] {
+			shards[i][j] = getSectorBuffer()
+		}
+		defer putSectorBuffers(shards[i])
+		slabs[i].Encode(buf, shards[i])
+		putSlabBuffer(buf)
+		slabs[i].Encrypt(shards[i])
+	}
+
+	sectors, slowHosts, err := parallelUploadSlabs(ctx, sp, shards, contracts, locker, uploadTimeouts, overdrive)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := range slabs {
+		slabs[i].Shards = sectors[i]
+	}
+	return slabs, slowHosts, nil
+}
+
+func parallelDownloadSlab(ctx context.Context, sp storeProvider, ss object.SlabSlice, contracts []api.ContractMetadata, locker contractLocker, downloadTimeouts *hostTimeouts, overdrive uint64) ([][]byte, []int, error) {
+	// check whether we can recover the slab, hosts might store more than one
+	// shard of the slab
+	available := make(map[types.PublicKey]struct{})
+	for _, c := range contracts {
+		available[c.HostKey] = struct{}{}
+	}
+	var recoverable int
+	for _, shard := range ss.Shards {
+		if _, exists := available[shard.Host]; exists {
+			recoverable++
+		}
+	}
+	if recoverable < int(ss.MinShards) {
 		return nil, nil, errors.New("not enough hosts to recover slab")
 	}
 
+	// derive a context that allows us to cancel the requests that are still
+	// in flight once we've downloaded enough shards, the contracts are
+	// released using the parent context
+	parentCtx := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	type req struct {
 		hostIndex int
 	}
 	type resp struct {
-		req   req
-		shard []byte
-		err   error
+		req     req
+		indices []int
+		shards  [][]byte
+		err     error
 	}
 	respChan := make(chan resp, 2*len(contracts)) // every host can send up to 2 responses
 	worker := func(r req) {
 		doneChan := make(chan struct{})
+		c := contracts[r.hostIndex]
 
 		// Trace the download.
 		ctx, span := tracing.Tracer.Start(ctx, "download-request")
-		span.SetAttributes(attribute.Stringer("host", contracts[r.hostIndex].HostKey))
-		span.SetAttributes(attribute.Stringer("contract", contracts[r.hostIndex].ID))
+		span.SetAttributes(attribute.Stringer("host", c.HostKey))
+		span.SetAttributes(attribute.Stringer("contract", c.ID))
+
+		// collect all shards stored on the host, they are pipelined over a
+		// single session
+		var indices []int
+		var roots []types.Hash256
+		for i := range ss.Shards {
+			if ss.Shards[i].Host == c.HostKey {
+				indices = append(indices, i)
+				roots = append(roots, ss.Shards[i].Root)
+			}
+		}
 
 		go func(r req) {
 			defer close(doneChan)
-			c := contracts[r.hostIndex]
 
-			lockID, err := locker.AcquireContract(ctx, c.ID, contractLockingDownloadPriority, 30*time.Second)
+			ctx, release, err := acquireContractLease(ctx, locker, c.ID, contractLockingDownloadPriority, contractLockingLeaseDuration)
 			if err != nil {
-				respChan <- resp{r, nil, err}
+				respChan <- resp{r, nil, nil, err}
 				span.SetStatus(codes.Error, "acquiring the contract failed")
 				span.RecordError(err)
 				return
 			}
-			defer locker.ReleaseContract(ctx, c.ID, lockID)
+			defer release(parentCtx)
 
-			var shard *object.Sector
-			for i := range ss.Shards {
-				if ss.Shards[i].Host == c.HostKey {
-					shard = &ss.Shards[i]
-					break
-				}
-			}
-			if shard == nil {
-				respChan <- resp{r, nil, fmt.Errorf("host %v, err: %w", c.HostKey, errUnusedHost)}
+			if len(indices) == 0 {
+				respChan <- resp{r, nil, nil, fmt.Errorf("host %v, err: %w", c.HostKey, errUnusedHost)}
 				return
 			}
 
+			// stream the sectors straight into pooled shard buffers
 			offset, length := ss.SectorRegion()
-			buf := bytes.NewBuffer(make([]byte, 0, rhpv2.SectorSize))
-			_ = sp.withHost(ctx, c.ID, c.HostKey, c.HostIP, func(ss sectorStore) error {
-				err = ss.DownloadSector(ctx, buf, shard.Root, offset, length)
+			shards := make([][]byte, len(indices))
+			for i := range shards {
+				shards[i] = getSectorBuffer()
+			}
+			sw := &shardWriter{shards: shards, length: int(length)}
+			_ = sp.withHost(ctx, c.ID, c.HostKey, c.HostIP, func(ss SectorStore) error {
+				start := time.Now()
+				if len(roots) == 1 {
+					err = ss.DownloadSector(ctx, sw, roots[0], offset, length)
+				} else {
+					err = ss.DownloadSectors(ctx, sw, roots, offset, length)
+				}
+				if err == nil && !sw.full() {
+					err = errors.New("received less data than expected")
+				}
 				if err != nil {
 					span.SetStatus(codes.Error, "downloading the sector failed")
 					span.RecordError(err)
+					putSectorBuffers(shards)
+					respChan <- resp{r, nil, nil, err}
+					return err
 				}
-				respChan <- resp{r, buf.Bytes(), err}
-				return err
+				downloadTimeouts.track(c.HostKey, time.Since(start)/time.Duration(len(roots)))
+				respChan <- resp{r, indices, shards, nil}
+				return nil
 			})
 		}(r)
 
-		if downloadSectorTimeout > 0 {
-			timer := time.NewTimer(downloadSectorTimeout)
+		if timeout := downloadTimeouts.timeout(c.HostKey); timeout > 0 {
+			// the timeout applies to every sector that is pipelined
+			if len(indices) > 1 {
+				timeout *= time.Duration(len(indices))
+			}
+			timer := time.NewTimer(timeout)
 			select {
 			case <-timer.C:
 				span.SetAttributes(attribute.Bool("slow", true))
@@ -272,10 +645,15 @@ func parallelDownloadSlab(ctx context.Context, sp storeProvider, ss object.SlabS
 		span.End()
 	}
 
-	// spawn workers and send initial requests
+	// spawn workers and send initial requests, overdrive launches additional
+	// requests up front so that slow hosts don't hold up the download
+	initial := uint64(ss.MinShards) + overdrive
+	if initial > uint64(len(contracts)) {
+		initial = uint64(len(contracts))
+	}
 	hostIndex := 0
 	inflight := 0
-	for i := uint8(0); i < ss.MinShards; i++ {
+	for i := uint64(0); i < initial; i++ {
 		go worker(req{hostIndex})
 		hostIndex++
 		inflight++
@@ -299,16 +677,18 @@ func parallelDownloadSlab(ctx context.Context, sp storeProvider, ss object.SlabS
 				inflight++
 			}
 		} else {
-			for i := range ss.Shards {
-				if ss.Shards[i].Host == contracts[resp.req.hostIndex].HostKey && len(shards[i]) == 0 {
-					shards[i] = resp.shard
+			for j, i := range resp.indices {
+				if shards[i] == nil && rem > 0 {
+					shards[i] = resp.shards[j]
 					rem--
-					break
+				} else {
+					putSectorBuffers(resp.shards[j : j+1])
 				}
 			}
 		}
 	}
 	if rem > 0 {
+		putSectorBuffers(shards)
 		return nil, nil, errs
 	}
 
@@ -332,14 +712,22 @@ func parallelDownloadSlab(ctx context.Context, sp storeProvider, ss object.SlabS
 	return shards, slowHosts, nil
 }
 
-func downloadSlab(ctx context.Context, sp storeProvider, out io.Writer, ss object.SlabSlice, contracts []api.ContractMetadata, locker contractLocker, downloadSectorTimeout time.Duration) ([]int, error) {
+func downloadSlab(ctx context.Context, sp storeProvider, out io.Writer, ss object.SlabSlice, contracts []api.ContractMetadata, locker contractLocker, downloadTimeouts *hostTimeouts, overdrive uint64) ([]int, error) {
 	ctx, span := tracing.Tracer.Start(ctx, "parallelDownloadSlab")
 	defer span.End()
 
-	shards, slowHosts, err := parallelDownloadSlab(ctx, sp, ss, contracts, locker, downloadSectorTimeout)
+	shards, slowHosts, err := parallelDownloadSlab(ctx, sp, ss, contracts, locker, downloadTimeouts, overdrive)
 	if err != nil {
 		return nil, err
 	}
+	defer putSectorBuffers(shards)
+
+	// provide buffers for the data shards that need to be recovered
+	for i := 0; i < int(ss.MinShards); i++ {
+		if shards[i] == nil {
+			shards[i] = getSectorBuffer()
+		}
+	}
 	ss.Decrypt(shards)
 	err = ss.Recover(out, shards)
 	if err != nil {
@@ -377,7 +765,7 @@ func slabsForDownload(slabs []object.SlabSlice, offset, length int64) []object.S
 	return slabs
 }
 
-func deleteSlabs(ctx context.Context, slabs []object.Slab, hosts []sectorStore) error {
+func deleteSlabs(ctx context.Context, slabs []object.Slab, hosts []SectorStore) error {
 	rootsBysectorStore := make(map[types.PublicKey][]types.Hash256)
 	for _, s := range slabs {
 		for _, sector := range s.Shards {
@@ -387,7 +775,7 @@ func deleteSlabs(ctx context.Context, slabs []object.Slab, hosts []sectorStore)
 
 	errChan := make(chan *HostError)
 	for _, h := range hosts {
-		go func(h sectorStore) {
+		go func(h SectorStore) {
 			// NOTE: if host is not storing any sectors, the map lookup will return
 			// nil, making this a no-op
 			err := h.DeleteSectors(ctx, rootsBysectorStore[h.PublicKey()])
@@ -411,7 +799,7 @@ func deleteSlabs(ctx context.Context, slabs []object.Slab, hosts []sectorStore)
 	return nil
 }
 
-func migrateSlab(ctx context.Context, sp storeProvider, s *object.Slab, contracts []api.ContractMetadata, locker contractLocker, downloadSectorTimeout, uploadSectorTimeout time.Duration) error {
+func migrateSlab(ctx context.Context, sp storeProvider, s *object.Slab, contracts []api.ContractMetadata, locker contractLocker, downloadTimeouts, uploadTimeouts *hostTimeouts, downloadOverdrive, uploadOverdrive uint64) error {
 	ctx, span := tracing.Tracer.Start(ctx, "migrateSlab")
 	defer span.End()
 
@@ -460,10 +848,20 @@ func migrateSlab(ctx context.Context, sp storeProvider, s *object.Slab, contract
 		Offset: 0,
 		Length: uint32(s.MinShards) * rhpv2.SectorSize,
 	}
-	shards, slowHosts, err := parallelDownloadSlab(ctx, sp, ss, contracts, locker, downloadSectorTimeout)
+	shards, slowHosts, err := parallelDownloadSlab(ctx, sp, ss, contracts, locker, downloadTimeouts, downloadOverdrive)
 	if err != nil {
 		return fmt.Errorf("failed to download slab for migration: %w", err)
 	}
+
+	// provide buffers for the shards that need to be reconstructed, all
+	// buffers are returned to the pool once the shards are reuploaded
+	for i := range shards {
+		if shards[i] == nil {
+			shards[i] = getSectorBuffer()
+		}
+	}
+	defer putSectorBuffers(append([][]byte(nil), shards...))
+
 	ss.Decrypt(shards)
 	if err := s.Reconstruct(shards); err != nil {
 		return fmt.Errorf("failed to reconstruct shards downloaded for migration: %w", err)
@@ -497,7 +895,7 @@ func migrateSlab(ctx context.Context, sp storeProvider, s *object.Slab, contract
 	})
 
 	// reupload those shards
-	uploaded, _, err := parallelUploadSlab(ctx, sp, shards, filtered, locker, uploadSectorTimeout)
+	uploaded, _, err := parallelUploadSlab(ctx, sp, shards, filtered, locker, uploadTimeouts, uploadOverdrive)
 	if err != nil {
 		return fmt.Errorf("failed to upload slab for migration: %w", err)
 	}
@@ -47,6 +47,27 @@ func (h *mockHost) DownloadSector(_ context.Context, w io.Writer, root types.Has
 	return err
 }
 
+func (h *mockHost) UploadSectors(ctx context.Context, sectors []*[rhpv2.SectorSize]byte) ([]types.Hash256, error) {
+	roots := make([]types.Hash256, len(sectors))
+	for i, sector := range sectors {
+		root, err := h.UploadSector(ctx, sector)
+		if err != nil {
+			return nil, err
+		}
+		roots[i] = root
+	}
+	return roots, nil
+}
+
+func (h *mockHost) DownloadSectors(ctx context.Context, w io.Writer, roots []types.Hash256, offset, length uint32) error {
+	for _, root := range roots {
+		if err := h.DownloadSector(ctx, w, root, offset, length); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (h *mockHost) DeleteSectors(_ context.Context, roots []types.Hash256) error {
 	for _, root := range roots {
 		delete(h.sectors, root)
@@ -65,9 +86,11 @@ func newMockHost() *mockHost {
 }
 
 type mockContractLocker struct {
-	mu       sync.Mutex
-	acquired int
-	released int
+	mu         sync.Mutex
+	acquired   int
+	released   int
+	keepalives int
+	lost       bool // fail keepalives as if the lease expired
 }
 
 func (l *mockContractLocker) AcquireContract(ctx context.Context, fcid types.FileContractID, priority int, d time.Duration) (lockID uint64, err error) {
@@ -77,6 +100,16 @@ func (l *mockContractLocker) AcquireContract(ctx context.Context, fcid types.Fil
 	return 0, nil
 }
 
+func (l *mockContractLocker) KeepaliveContract(ctx context.Context, fcid types.FileContractID, lockID uint64, d time.Duration) (err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.keepalives++
+	if l.lost {
+		return errors.New("contract lock is not held")
+	}
+	return nil
+}
+
 func (l *mockContractLocker) ReleaseContract(ctx context.Context, fcid types.FileContractID, lockID uint64) (err error) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
@@ -85,12 +118,12 @@ func (l *mockContractLocker) ReleaseContract(ctx context.Context, fcid types.Fil
 }
 
 type mockStoreProvider struct {
-	hosts map[types.PublicKey]sectorStore
+	hosts map[types.PublicKey]SectorStore
 }
 
-func newMockStoreProvider(hosts []sectorStore) *mockStoreProvider {
+func newMockStoreProvider(hosts []SectorStore) *mockStoreProvider {
 	sp := &mockStoreProvider{
-		hosts: make(map[types.PublicKey]sectorStore),
+		hosts: make(map[types.PublicKey]SectorStore),
 	}
 	for _, h := range hosts {
 		sp.hosts[h.PublicKey()] = h
@@ -98,7 +131,7 @@ func newMockStoreProvider(hosts []sectorStore) *mockStoreProvider {
 	return sp
 }
 
-func (sp *mockStoreProvider) withHost(ctx context.Context, contractID types.FileContractID, hostKey types.PublicKey, hostIP string, f func(sectorStore) error) (err error) {
+func (sp *mockStoreProvider) withHost(ctx context.Context, contractID types.FileContractID, hostKey types.PublicKey, hostIP string, f func(SectorStore) error) (err error) {
 	h, exists := sp.hosts[hostKey]
 	if !exists {
 		panic("doesn't exist")
@@ -127,7 +160,7 @@ func TestMultipleObjects(t *testing.T) {
 	r := io.MultiReader(rs...)
 
 	// Prepare hosts.
-	var hosts []sectorStore
+	var hosts []SectorStore
 	for i := 0; i < 10; i++ {
 		hosts = append(hosts, newMockHost())
 	}
@@ -140,7 +173,7 @@ func TestMultipleObjects(t *testing.T) {
 	// upload
 	var slabs []object.Slab
 	for {
-		s, _, _, err := uploadSlab(context.Background(), sp, r, 3, 10, contracts, mockLocker, 0)
+		s, _, _, err := uploadSlab(context.Background(), sp, r, object.GenerateEncryptionKey(), 3, 10, contracts, mockLocker, nil, 0)
 		if err == io.EOF {
 			break
 		} else if err != nil {
@@ -170,7 +203,7 @@ func TestMultipleObjects(t *testing.T) {
 		dst := o.Key.Decrypt(&buf, int64(offset))
 		ss := slabsForDownload(o.Slabs, int64(offset), int64(length))
 		for _, s := range ss {
-			if _, err := downloadSlab(context.Background(), sp, dst, s, contracts, mockLocker, 0); err != nil {
+			if _, err := downloadSlab(context.Background(), sp, dst, s, contracts, mockLocker, nil, 0); err != nil {
 				t.Error(err)
 				return
 			}
@@ -213,3 +246,321 @@ func TestMultipleObjects(t *testing.T) {
 	}
 	mockLocker.mu.Unlock()
 }
+
+type blockingHost struct {
+	SectorStore
+	cancelled chan struct{}
+}
+
+func (h *blockingHost) DownloadSector(ctx context.Context, w io.Writer, root types.Hash256, offset, length uint32) error {
+	<-ctx.Done()
+	close(h.cancelled)
+	return ctx.Err()
+}
+
+func TestDownloadOverdrive(t *testing.T) {
+	mockLocker := &mockContractLocker{}
+
+	// prepare hosts
+	var hosts []SectorStore
+	for i := 0; i < 3; i++ {
+		hosts = append(hosts, newMockHost())
+	}
+	sp := newMockStoreProvider(hosts)
+	var contracts []api.ContractMetadata
+	for _, h := range hosts {
+		contracts = append(contracts, api.ContractMetadata{ID: h.Contract(), HostKey: h.PublicKey()})
+	}
+
+	// upload a slab
+	data := frand.Bytes(1000)
+	s, _, _, err := uploadSlab(context.Background(), sp, bytes.NewReader(data), object.GenerateEncryptionKey(), 2, 3, contracts, mockLocker, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// make the first host hang until its request is cancelled, without
+	// overdrive or a sector timeout the download would never finish
+	slow := &blockingHost{SectorStore: hosts[0], cancelled: make(chan struct{})}
+	sp.hosts[slow.PublicKey()] = slow
+
+	var buf bytes.Buffer
+	ss := object.SlabSlice{Slab: s, Offset: 0, Length: uint32(len(data))}
+	if _, err := downloadSlab(context.Background(), sp, &buf, ss, contracts, mockLocker, nil, 1); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf.Bytes(), data) {
+		t.Fatal("unexpected data")
+	}
+
+	// the straggler should have been cancelled
+	select {
+	case <-slow.cancelled:
+	case <-time.After(10 * time.Second):
+		t.Fatal("slow request wasn't cancelled")
+	}
+}
+
+type slowHost struct {
+	*mockHost
+	delay time.Duration
+
+	mu sync.Mutex
+}
+
+func (h *slowHost) UploadSector(ctx context.Context, sector *[rhpv2.SectorSize]byte) (types.Hash256, error) {
+	time.Sleep(h.delay)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.mockHost.UploadSector(ctx, sector)
+}
+
+func (h *slowHost) DeleteSectors(ctx context.Context, roots []types.Hash256) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.mockHost.DeleteSectors(ctx, roots)
+}
+
+func (h *slowHost) numSectors() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.sectors)
+}
+
+func TestUploadOverdrive(t *testing.T) {
+	mockLocker := &mockContractLocker{}
+	data := frand.Bytes(1000)
+
+	upload := func(overdrive uint64) (*slowHost, object.Slab, []int) {
+		t.Helper()
+
+		// prepare hosts, the first one being slow
+		slow := &slowHost{mockHost: newMockHost(), delay: time.Second}
+		hosts := []SectorStore{slow}
+		for i := 0; i < 3; i++ {
+			hosts = append(hosts, newMockHost())
+		}
+		sp := newMockStoreProvider(hosts)
+		var contracts []api.ContractMetadata
+		for _, h := range hosts {
+			contracts = append(contracts, api.ContractMetadata{ID: h.Contract(), HostKey: h.PublicKey()})
+		}
+
+		s, _, slowHosts, err := uploadSlab(context.Background(), sp, bytes.NewReader(data), object.GenerateEncryptionKey(), 1, 2, contracts, mockLocker, newHostTimeouts(100*time.Millisecond), overdrive)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return slow, s, slowHosts
+	}
+
+	isSlow := func(slowHosts []int) bool {
+		for _, h := range slowHosts {
+			if h == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	// without overdrive the slow host is waited for
+	slow, s, slowHosts := upload(0)
+	if !isSlow(slowHosts) {
+		t.Fatal("expected the first host to be slow", slowHosts)
+	} else if s.Shards[0].Host != slow.PublicKey() {
+		t.Fatal("expected the slow host to store the shard")
+	} else if slow.numSectors() != 1 {
+		t.Fatal("expected the slow host to store the sector")
+	}
+
+	// with overdrive the slow host is raced and its sector is cleaned up
+	slow, s, slowHosts = upload(1)
+	if !isSlow(slowHosts) {
+		t.Fatal("expected the first host to be slow", slowHosts)
+	}
+	for _, shard := range s.Shards {
+		if shard.Host == slow.PublicKey() {
+			t.Fatal("expected the slow host to lose the race")
+		}
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for slow.numSectors() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the redundant sector to be deleted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPipelinedTransfers(t *testing.T) {
+	mockLocker := &mockContractLocker{}
+
+	// prepare hosts
+	var hosts []*mockHost
+	var stores []SectorStore
+	for i := 0; i < 3; i++ {
+		hosts = append(hosts, newMockHost())
+		stores = append(stores, hosts[i])
+	}
+	sp := newMockStoreProvider(stores)
+	var contracts []api.ContractMetadata
+	for _, h := range hosts {
+		contracts = append(contracts, api.ContractMetadata{ID: h.Contract(), HostKey: h.PublicKey()})
+	}
+
+	// upload two slabs at once
+	data := [][]byte{frand.Bytes(1000), frand.Bytes(2000)}
+	slabs, _, err := uploadSlabs(context.Background(), sp, data, 2, 3, contracts, mockLocker, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	} else if len(slabs) != len(data) {
+		t.Fatalf("expected %v slabs, got %v", len(data), len(slabs))
+	}
+
+	// every host should have received a sector of each slab
+	for _, h := range hosts {
+		if len(h.sectors) != len(slabs) {
+			t.Fatalf("expected host to store %v sectors, got %v", len(slabs), len(h.sectors))
+		}
+	}
+
+	// download the slabs
+	for i, s := range slabs {
+		var buf bytes.Buffer
+		ss := object.SlabSlice{Slab: s, Offset: 0, Length: uint32(len(data[i]))}
+		if _, err := downloadSlab(context.Background(), sp, &buf, ss, contracts, mockLocker, nil, 0); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(buf.Bytes(), data[i]) {
+			t.Fatal("unexpected data")
+		}
+	}
+
+	// move the second shard of the first slab to the first host, downloading
+	// the slab from that host alone requires both shards to be pipelined
+	s := slabs[0]
+	shard := s.Shards[1]
+	hosts[0].sectors[shard.Root] = hosts[1].sectors[shard.Root]
+	s.Shards[1].Host = hosts[0].PublicKey()
+
+	var buf bytes.Buffer
+	ss := object.SlabSlice{Slab: s, Offset: 0, Length: uint32(len(data[0]))}
+	if _, err := downloadSlab(context.Background(), sp, &buf, ss, contracts[:1], mockLocker, nil, 0); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(buf.Bytes(), data[0]) {
+		t.Fatal("unexpected data")
+	}
+}
+
+// discardHost is a host that discards uploaded sectors and serves downloads
+// from a single sector, it's used to benchmark the transfer code without
+// measuring the mock host's allocations.
+type discardHost struct {
+	*mockHost
+	sector []byte
+}
+
+func (h *discardHost) UploadSector(_ context.Context, _ *[rhpv2.SectorSize]byte) (root types.Hash256, _ error) {
+	frand.Read(root[:])
+	return
+}
+
+func (h *discardHost) UploadSectors(ctx context.Context, sectors []*[rhpv2.SectorSize]byte) ([]types.Hash256, error) {
+	roots := make([]types.Hash256, len(sectors))
+	for i := range roots {
+		roots[i], _ = h.UploadSector(ctx, sectors[i])
+	}
+	return roots, nil
+}
+
+func (h *discardHost) DownloadSector(_ context.Context, w io.Writer, _ types.Hash256, offset, length uint32) error {
+	_, err := w.Write(h.sector[offset:][:length])
+	return err
+}
+
+func (h *discardHost) DownloadSectors(ctx context.Context, w io.Writer, roots []types.Hash256, offset, length uint32) error {
+	for _, root := range roots {
+		if err := h.DownloadSector(ctx, w, root, offset, length); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newBenchmarkHosts(n int) (*mockStoreProvider, []api.ContractMetadata) {
+	var hosts []SectorStore
+	for i := 0; i < n; i++ {
+		hosts = append(hosts, &discardHost{newMockHost(), frand.Bytes(rhpv2.SectorSize)})
+	}
+	var contracts []api.ContractMetadata
+	for _, h := range hosts {
+		contracts = append(contracts, api.ContractMetadata{ID: h.Contract(), HostKey: h.PublicKey()})
+	}
+	return newMockStoreProvider(hosts), contracts
+}
+
+// BenchmarkUploadSlab benchmarks uploading a 10-of-30 slab.
+func BenchmarkUploadSlab(b *testing.B) {
+	sp, contracts := newBenchmarkHosts(30)
+	data := frand.Bytes(10 * rhpv2.SectorSize)
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, _, err := uploadSlab(context.Background(), sp, bytes.NewReader(data), object.GenerateEncryptionKey(), 10, 30, contracts, &mockContractLocker{}, nil, 0)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDownloadSlab benchmarks downloading a 10-of-30 slab.
+func BenchmarkDownloadSlab(b *testing.B) {
+	sp, contracts := newBenchmarkHosts(30)
+	s := object.Slab{Key: object.GenerateEncryptionKey(), MinShards: 10}
+	for _, c := range contracts {
+		s.Shards = append(s.Shards, object.Sector{Host: c.HostKey})
+	}
+	ss := object.SlabSlice{Slab: s, Length: 10 * rhpv2.SectorSize}
+
+	b.SetBytes(int64(ss.Length))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := downloadSlab(context.Background(), sp, io.Discard, ss, contracts, &mockContractLocker{}, nil, 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestContractLease verifies contract leases are kept alive while they're held
+// and the lease's context is cancelled once the lease is lost.
+func TestContractLease(t *testing.T) {
+	locker := &mockContractLocker{}
+	ctx, release, err := acquireContractLease(context.Background(), locker, types.FileContractID{1}, 0, 30*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the lease is renewed while it's held
+	time.Sleep(50 * time.Millisecond)
+	locker.mu.Lock()
+	keepalives := locker.keepalives
+	locker.lost = true
+	locker.mu.Unlock()
+	if keepalives == 0 {
+		t.Fatal("lease wasn't kept alive")
+	} else if ctx.Err() != nil {
+		t.Fatal("lease context was cancelled")
+	}
+
+	// losing the lease cancels its context
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("lease context wasn't cancelled")
+	}
+
+	release(context.Background())
+	if locker.acquired != 1 || locker.released != 1 {
+		t.Fatal("unexpected acquire/release", locker.acquired, locker.released)
+	}
+}
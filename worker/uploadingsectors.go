@@ -0,0 +1,33 @@
+package worker
+
+import (
+	"context"
+
+	"go.sia.tech/core/types"
+)
+
+const keyUploadingSectorsRecorder contextKey = "UploadingSectorsRecorder"
+
+// An UploadingSectorsRecorder records the roots of the sectors that were
+// uploaded to a contract but aren't referenced by an object yet, preventing
+// them from being pruned while the upload is in progress.
+type UploadingSectorsRecorder interface {
+	AddUploadingSectors(ctx context.Context, fcid types.FileContractID, roots []types.Hash256) error
+}
+
+// recordUploadingSectors records the given roots with the
+// UploadingSectorsRecorder attached to the context, if any. It's called while
+// the contract is still locked, so the sectors can't be pruned before they're
+// recorded.
+func recordUploadingSectors(ctx context.Context, fcid types.FileContractID, roots []types.Hash256) error {
+	if ur, ok := ctx.Value(keyUploadingSectorsRecorder).(UploadingSectorsRecorder); ok {
+		return ur.AddUploadingSectors(ctx, fcid, roots)
+	}
+	return nil
+}
+
+// WithUploadingSectorsRecorder returns a context with the
+// UploadingSectorsRecorder attached.
+func WithUploadingSectorsRecorder(ctx context.Context, ur UploadingSectorsRecorder) context.Context {
+	return context.WithValue(ctx, keyUploadingSectorsRecorder, ur)
+}
@@ -0,0 +1,156 @@
+package worker
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/jape"
+	"go.sia.tech/renterd/api"
+	"lukechampine.com/frand"
+)
+
+const (
+	// headerUploadID is the response header that contains the ID of an object
+	// upload, it can be used to query the upload's progress.
+	headerUploadID = "Renterd-Upload-ID"
+
+	// maxFinishedUploads is the number of finished uploads whose status is
+	// kept, the oldest ones are dropped first.
+	maxFinishedUploads = 100
+)
+
+// errUploadNotFound is returned if the status of an unknown upload is
+// requested.
+var errUploadNotFound = errors.New("upload not found")
+
+// An uploadTracker keeps track of the progress of the object uploads handled
+// by the worker.
+type uploadTracker struct {
+	mu       sync.Mutex
+	uploads  map[string]*api.UploadStatus
+	finished []string // IDs of finished uploads, oldest first
+}
+
+func newUploadTracker() *uploadTracker {
+	return &uploadTracker{
+		uploads: make(map[string]*api.UploadStatus),
+	}
+}
+
+// Start starts tracking an upload of the object with the given key and returns
+// its ID. size is the size of the object or -1 if it's unknown.
+func (ut *uploadTracker) Start(key string, size, slabSize int64) string {
+	id := hex.EncodeToString(frand.Bytes(16))
+	status := &api.UploadStatus{
+		ID:         id,
+		Key:        key,
+		State:      api.UploadStateActive,
+		Started:    time.Now(),
+		BytesTotal: -1,
+	}
+	if size >= 0 {
+		status.BytesTotal = size
+		status.SlabsTotal = int((size + slabSize - 1) / slabSize)
+	}
+
+	ut.mu.Lock()
+	defer ut.mu.Unlock()
+	ut.uploads[id] = status
+	return id
+}
+
+// SlabStarted records that a slab is about to be uploaded to the given hosts.
+func (ut *uploadTracker) SlabStarted(id string, hosts []types.PublicKey) {
+	ut.mu.Lock()
+	defer ut.mu.Unlock()
+	if status, ok := ut.uploads[id]; ok {
+		status.Hosts = append([]types.PublicKey(nil), hosts...)
+	}
+}
+
+// SlabUploaded records that a slab containing length bytes of the object was
+// uploaded.
+func (ut *uploadTracker) SlabUploaded(id string, length int) {
+	ut.mu.Lock()
+	defer ut.mu.Unlock()
+	if status, ok := ut.uploads[id]; ok {
+		status.SlabsUploaded++
+		status.BytesUploaded += uint64(length)
+	}
+}
+
+// Finish marks the upload as done, or as failed if err is not nil.
+func (ut *uploadTracker) Finish(id string, err error) {
+	ut.mu.Lock()
+	defer ut.mu.Unlock()
+	status, ok := ut.uploads[id]
+	if !ok {
+		return
+	}
+	status.Finished = time.Now()
+	status.Hosts = nil
+	if err != nil {
+		status.State = api.UploadStateFailed
+		status.Errors = append(status.Errors, err.Error())
+	} else {
+		status.State = api.UploadStateDone
+	}
+
+	ut.finished = append(ut.finished, id)
+	if len(ut.finished) > maxFinishedUploads {
+		delete(ut.uploads, ut.finished[0])
+		ut.finished = ut.finished[1:]
+	}
+}
+
+// Upload returns the status of the upload with the given ID.
+func (ut *uploadTracker) Upload(id string) (api.UploadStatus, bool) {
+	ut.mu.Lock()
+	defer ut.mu.Unlock()
+	status, ok := ut.uploads[id]
+	if !ok {
+		return api.UploadStatus{}, false
+	}
+	return copyUploadStatus(status), true
+}
+
+// Active returns the status of the active uploads, oldest first.
+func (ut *uploadTracker) Active() []api.UploadStatus {
+	ut.mu.Lock()
+	defer ut.mu.Unlock()
+	active := make([]api.UploadStatus, 0, len(ut.uploads))
+	for _, status := range ut.uploads {
+		if status.State == api.UploadStateActive {
+			active = append(active, copyUploadStatus(status))
+		}
+	}
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].Started.Before(active[j].Started)
+	})
+	return active
+}
+
+func copyUploadStatus(status *api.UploadStatus) api.UploadStatus {
+	cpy := *status
+	cpy.Hosts = append([]types.PublicKey(nil), status.Hosts...)
+	cpy.Errors = append([]string(nil), status.Errors...)
+	return cpy
+}
+
+func (w *worker) uploadsHandlerGET(jc jape.Context) {
+	jc.Encode(w.uploads.Active())
+}
+
+func (w *worker) uploadsIDHandlerGET(jc jape.Context) {
+	status, ok := w.uploads.Upload(jc.PathParam("id"))
+	if !ok {
+		jc.Error(errUploadNotFound, http.StatusNotFound)
+		return
+	}
+	jc.Encode(status)
+}
@@ -0,0 +1,65 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.sia.tech/core/types"
+	"go.sia.tech/renterd/api"
+)
+
+// TestUploadTracker verifies the upload tracker reports the progress of
+// active uploads and keeps the status of a limited number of finished ones.
+func TestUploadTracker(t *testing.T) {
+	ut := newUploadTracker()
+
+	// start an upload of 2.5 slabs and one of unknown size
+	foo := ut.Start("foo", 250, 100)
+	bar := ut.Start("bar", -1, 100)
+	if active := ut.Active(); len(active) != 2 || active[0].ID != foo || active[1].ID != bar {
+		t.Fatal("unexpected active uploads", active)
+	}
+	if status, ok := ut.Upload(foo); !ok {
+		t.Fatal("upload not found")
+	} else if status.SlabsTotal != 3 || status.BytesTotal != 250 || status.State != api.UploadStateActive {
+		t.Fatal("unexpected status", status)
+	}
+	if status, _ := ut.Upload(bar); status.SlabsTotal != 0 || status.BytesTotal != -1 {
+		t.Fatal("unexpected status", status)
+	}
+
+	// upload a slab
+	hosts := []types.PublicKey{{1}, {2}}
+	ut.SlabStarted(foo, hosts)
+	if status, _ := ut.Upload(foo); len(status.Hosts) != 2 || status.Hosts[0] != hosts[0] {
+		t.Fatal("unexpected hosts", status.Hosts)
+	}
+	ut.SlabUploaded(foo, 100)
+	if status, _ := ut.Upload(foo); status.SlabsUploaded != 1 || status.BytesUploaded != 100 {
+		t.Fatal("unexpected progress", status)
+	}
+
+	// finish the uploads
+	ut.Finish(foo, nil)
+	ut.Finish(bar, errors.New("failed"))
+	if active := ut.Active(); len(active) != 0 {
+		t.Fatal("unexpected active uploads", active)
+	}
+	if status, _ := ut.Upload(foo); status.State != api.UploadStateDone || status.Finished.IsZero() || len(status.Hosts) != 0 {
+		t.Fatal("unexpected status", status)
+	}
+	if status, _ := ut.Upload(bar); status.State != api.UploadStateFailed || len(status.Errors) != 1 || status.Errors[0] != "failed" {
+		t.Fatal("unexpected status", status)
+	}
+
+	// finished uploads are dropped once the limit is reached
+	for i := 0; i < maxFinishedUploads-1; i++ {
+		ut.Finish(ut.Start(fmt.Sprint(i), 0, 100), nil)
+	}
+	if _, ok := ut.Upload(foo); ok {
+		t.Fatal("expected oldest upload to be dropped")
+	} else if _, ok := ut.Upload(bar); !ok {
+		t.Fatal("upload not found")
+	}
+}
@@ -1,7 +1,9 @@
 package worker
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -23,6 +25,7 @@ import (
 	"go.sia.tech/jape"
 	"go.sia.tech/renterd/api"
 	"go.sia.tech/renterd/hostdb"
+	"go.sia.tech/renterd/internal/profiling"
 	"go.sia.tech/renterd/internal/tracing"
 	"go.sia.tech/renterd/metrics"
 	"go.sia.tech/renterd/object"
@@ -32,17 +35,59 @@ import (
 )
 
 const (
-	lockingPriorityRenew   = 100 // highest
-	lockingPriorityFunding = 90
+	lockingPriorityRenew     = 100 // highest
+	lockingPriorityFunding   = 90
+	lockingPriorityPruning   = 80
+	lockingPriorityBroadcast = 70
 
-	lockingDurationRenew   = time.Minute
-	lockingDurationFunding = 30 * time.Second
+	// lockingDurationPackedSlab is the time the tails packed into a slab are
+	// locked for while the slab is uploaded.
+	lockingDurationPackedSlab = 10 * time.Minute
+
+	// packedSlabsUploadLimit is the max number of packed slabs uploaded
+	// after an object upload.
+	packedSlabsUploadLimit = 2
 
 	queryStringParamContractSet = "contractset"
 	queryStringParamMinShards   = "minshards"
 	queryStringParamTotalShards = "totalshards"
+
+	// headerPassphrase is the header used to pass the passphrase protecting an
+	// object's encryption key.
+	headerPassphrase = "Renterd-Passphrase"
 )
 
+// checkNotModified sets the ETag and Last-Modified headers of the object and
+// returns true if the conditional headers of the request indicate that the
+// client's copy of the object is up to date, in which case the object doesn't
+// need to be sent. As per RFC 7232, If-None-Match takes precedence over
+// If-Modified-Since.
+func checkNotModified(w http.ResponseWriter, req *http.Request, o object.Object) bool {
+	var etag string
+	if o.ETag != "" {
+		etag = fmt.Sprintf("%q", o.ETag)
+		w.Header().Set("ETag", etag)
+	}
+	if !o.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", o.ModTime.UTC().Format(http.TimeFormat))
+	}
+
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || (etag != "" && tag == etag) {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := req.Header.Get("If-Modified-Since"); ims != "" && !o.ModTime.IsZero() {
+		t, err := http.ParseTime(ims)
+		return err == nil && !o.ModTime.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
 // parseRange parses a Range header string as per RFC 7233. Only the first range
 // is returned. If no range is specified, parseRange returns 0, size.
 func parseRange(s string, size int64) (offset, length int64, _ error) {
@@ -187,6 +232,21 @@ func toHostInteraction(m metrics.Metric) (hostdb.Interaction, bool) {
 			Elapsed   time.Duration `json:"elapsed"`
 		}{m.HostIP, m.Timestamp, m.Elapsed})
 	case MetricRPC:
+		// sector transfers are recorded with their measured performance
+		if m.RPC == rhpv2.RPCWriteID || m.RPC == rhpv2.RPCReadID {
+			typ, bytes := hostdb.InteractionTypeUpload, m.Uploaded
+			if m.RPC == rhpv2.RPCReadID {
+				typ, bytes = hostdb.InteractionTypeDownload, m.Downloaded
+			}
+			b, _ := json.Marshal(hostdb.NewTransferResult(bytes, m.Elapsed, m.Err))
+			return hostdb.Interaction{
+				Host:      m.HostKey,
+				Timestamp: m.Timestamp,
+				Type:      typ,
+				Result:    json.RawMessage(b),
+				Success:   m.Err == nil,
+			}, true
+		}
 		return transform(m.HostKey, m.Timestamp, "rhpv2 rpc", m.Err, struct {
 			RPC        string         `json:"RPC"`
 			Timestamp  time.Time      `json:"timestamp"`
@@ -212,6 +272,7 @@ type AccountStore interface {
 type contractLocker interface {
 	AcquireContract(ctx context.Context, fcid types.FileContractID, priority int, d time.Duration) (lockID uint64, err error)
 	ReleaseContract(ctx context.Context, fcid types.FileContractID, lockID uint64) (err error)
+	KeepaliveContract(ctx context.Context, fcid types.FileContractID, lockID uint64, d time.Duration) (err error)
 }
 
 // A Bus is the source of truth within a renterd system.
@@ -220,8 +281,14 @@ type Bus interface {
 	contractLocker
 
 	ActiveContracts(ctx context.Context) ([]api.ContractMetadata, error)
+	AddRenewedContract(ctx context.Context, contract rhpv2.ContractRevision, totalCost types.Currency, startHeight uint64, renewedFrom types.FileContractID) (api.ContractMetadata, error)
+	Contract(ctx context.Context, id types.FileContractID) (api.ContractMetadata, error)
+	ContractRoots(ctx context.Context, id types.FileContractID) ([]types.Hash256, error)
+	AddUploadingSectors(ctx context.Context, fcid types.FileContractID, roots []types.Hash256) error
 	Contracts(ctx context.Context, set string) ([]api.ContractMetadata, error)
+	ContractSets(ctx context.Context) ([]string, error)
 	ContractsForSlab(ctx context.Context, shards []object.Sector, contractSetName string) ([]api.ContractMetadata, error)
+	RecordContractBroadcast(ctx context.Context, fcid types.FileContractID, cb api.ContractBroadcast) error
 	RecordInteractions(ctx context.Context, interactions []hostdb.Interaction) error
 	RecordContractSpending(ctx context.Context, records []api.ContractSpendingRecord) error
 
@@ -231,14 +298,31 @@ type Bus interface {
 	GougingParams(ctx context.Context) (api.GougingParams, error)
 	UploadParams(ctx context.Context) (api.UploadParams, error)
 
-	Object(ctx context.Context, key string) (object.Object, []string, error)
-	AddObject(ctx context.Context, key string, o object.Object, usedContracts map[types.PublicKey]types.FileContractID) error
+	Object(ctx context.Context, key string) (object.Object, []api.ObjectMetadata, error)
+	AddObject(ctx context.Context, key string, o object.Object, usedContracts map[types.PublicKey]types.FileContractID, rs *api.RedundancySettings) error
+	AddObjectIfMatch(ctx context.Context, key, ifMatch string, o object.Object, usedContracts map[types.PublicKey]types.FileContractID, rs *api.RedundancySettings) error
 	DeleteObject(ctx context.Context, key string) error
+	DeleteObjectIfMatch(ctx context.Context, key, ifMatch string) error
+
+	ContractSectorDeletions(ctx context.Context, id types.FileContractID) ([]types.Hash256, error)
+	RemoveSectorDeletions(ctx context.Context, deletions []api.SectorDeletions) error
+	SectorDeletions(ctx context.Context, limit int) ([]api.SectorDeletions, error)
+
+	MarkPackedSlabsUploaded(ctx context.Context, slabs []api.UploadedPackedSlab) error
+	PackedSlabsForUpload(ctx context.Context, lockingDuration time.Duration, minShards, totalShards uint8, limit int) ([]api.PackedSlab, error)
 
 	Accounts(ctx context.Context, owner string) ([]api.Account, error)
+	Setting(ctx context.Context, key string) (string, error)
 	UpdateSlab(ctx context.Context, s object.Slab, goodContracts map[types.PublicKey]types.FileContractID) error
 
+	AuthorizeSpending(ctx context.Context, category string, amount types.Currency) error
+	RegisterWorker(ctx context.Context, req api.WorkerRegisterRequest) error
+
+	BroadcastTransaction(ctx context.Context, txns []types.Transaction) error
+	WalletAddress(ctx context.Context) (types.Address, error)
 	WalletDiscard(ctx context.Context, txn types.Transaction) error
+	WalletFund(ctx context.Context, txn *types.Transaction, amount types.Currency) ([]types.Hash256, []types.Transaction, error)
+	WalletSign(ctx context.Context, txn *types.Transaction, toSign []types.Hash256, cf types.CoveredFields) error
 	WalletPrepareForm(ctx context.Context, renterAddress types.Address, renterKey types.PrivateKey, renterFunds, hostCollateral types.Currency, hostKey types.PublicKey, hostSettings rhpv2.HostSettings, endHeight uint64) (txns []types.Transaction, err error)
 	WalletPrepareRenew(ctx context.Context, contract types.FileContractRevision, renterAddress types.Address, renterKey types.PrivateKey, renterFunds, newCollateral types.Currency, hostKey types.PublicKey, hostSettings rhpv2.HostSettings, endHeight uint64) ([]types.Transaction, types.Currency, error)
 }
@@ -255,6 +339,27 @@ func (w *worker) deriveSubKey(purpose string) types.PrivateKey {
 	return pk
 }
 
+// objectKey returns a new encryption key for an upload. Unless random keys are
+// enabled, the key is derived from the worker's masterkey and a random nonce,
+// which is returned as well and has to be stored with the object. The nonce
+// ensures overwriting an object never reuses the key of the previous upload.
+func (w *worker) objectKey() (object.EncryptionKey, *[32]byte) {
+	if w.randomObjectKeys {
+		return object.GenerateEncryptionKey(), nil
+	}
+	nonce := frand.Entropy256()
+	return object.DeriveEncryptionKey(w.masterKey, nonce), &nonce
+}
+
+// slabKey returns the encryption key for the slab at the given index of an
+// object encrypted with objectKey.
+func (w *worker) slabKey(objectKey object.EncryptionKey, index int) object.EncryptionKey {
+	if w.randomObjectKeys {
+		return object.GenerateEncryptionKey()
+	}
+	return objectKey.DeriveSlabKey(uint64(index))
+}
+
 // TODO: deriving the renter key from the host key using the master key only
 // works if we persist a hash of the renter's master key in the database and
 // compare it on startup, otherwise there's no way of knowing the derived key is
@@ -295,8 +400,53 @@ type worker struct {
 
 	contractSpendingRecorder *contractSpendingRecorder
 
-	downloadSectorTimeout time.Duration
-	uploadSectorTimeout   time.Duration
+	// downloadTimeouts and uploadTimeouts derive the sector timeouts from
+	// the latencies observed per host
+	downloadTimeouts *hostTimeouts
+	uploadTimeouts   *hostTimeouts
+
+	// downloadOverdrive is the number of sectors that are requested on top of
+	// the minimum number of shards required to recover a slab
+	downloadOverdrive uint64
+
+	// downloadPrefetchSlabs is the number of slabs that are downloaded ahead
+	// of the slab that is being streamed to the client, within the memory
+	// budget of downloadPrefetchMemory bytes
+	downloadPrefetchSlabs  int
+	downloadPrefetchMemory uint64
+
+	// uploadOverdrive is the number of slow sector uploads per slab that are
+	// raced against another host
+	uploadOverdrive uint64
+
+	// uploadMemory limits the memory used to buffer the slabs of uploads,
+	// slabs that don't fit within the budget are spilled to uploadSpillDir
+	uploadMemory   *memoryManager
+	uploadSpillDir string
+
+	// downloadExportDir is the directory download jobs write objects to,
+	// writing to the worker's filesystem is disabled if it's empty
+	downloadExportDir string
+
+	// randomObjectKeys disables deriving object keys from the master key
+	randomObjectKeys bool
+
+	// uploads tracks the progress of the object uploads
+	uploads *uploadTracker
+
+	// downloads tracks the download jobs that outlive the request that
+	// started them
+	downloads *downloadTracker
+
+	// registration keeps the worker registered with the bus, it's nil
+	// unless RegisterWithBus was called
+	registration *busRegistration
+
+	prewarm prewarmStats
+
+	// faults injects faults into the sector transfers if fault injection
+	// is enabled on the bus
+	faults *faultInjector
 
 	logger *zap.SugaredLogger
 }
@@ -380,17 +530,17 @@ func withTransportV3(ctx context.Context, hostIP string, hostKey types.PublicKey
 	return fn(t)
 }
 
-func (w *worker) withHost(ctx context.Context, contractID types.FileContractID, hostKey types.PublicKey, hostIP string, fn func(sectorStore) error) (err error) {
+func (w *worker) withHost(ctx context.Context, contractID types.FileContractID, hostKey types.PublicKey, hostIP string, fn func(SectorStore) error) (err error) {
 	return w.withHosts(ctx, []api.ContractMetadata{{
 		ID:      contractID,
 		HostKey: hostKey,
 		HostIP:  hostIP,
-	}}, func(ss []sectorStore) error {
+	}}, func(ss []SectorStore) error {
 		return fn(ss[0])
 	})
 }
 
-func (w *worker) unlockHosts(hosts []sectorStore) {
+func (w *worker) unlockHosts(hosts []SectorStore) {
 	// apply a pessimistic timeout, ensuring unlocking the contract or force
 	// closing the session does not deadlock and keep this goroutine around
 	// forever. Use a background context as the parent to avoid timing out
@@ -409,8 +559,8 @@ func (w *worker) unlockHosts(hosts []sectorStore) {
 	wg.Wait()
 }
 
-func (w *worker) withHosts(ctx context.Context, contracts []api.ContractMetadata, fn func([]sectorStore) error) (err error) {
-	var hosts []sectorStore
+func (w *worker) withHosts(ctx context.Context, contracts []api.ContractMetadata, fn func([]SectorStore) error) (err error) {
+	var hosts []SectorStore
 	for _, c := range contracts {
 		hosts = append(hosts, w.pool.session(c.HostKey, c.HostIP, c.ID, w.deriveRenterKey(c.HostKey)))
 	}
@@ -498,6 +648,48 @@ func (w *worker) rhpPriceTableHandler(jc jape.Context) {
 	jc.Encode(pt)
 }
 
+func (w *worker) rhpPrewarmHandlerPOST(jc jape.Context) {
+	ctx := jc.Request.Context()
+	var req api.RHPPrewarmRequest
+	if jc.Decode(&req) != nil {
+		return
+	}
+
+	up, err := w.bus.UploadParams(ctx)
+	if jc.Check("couldn't fetch upload parameters from bus", err) != nil {
+		return
+	}
+
+	// allow overriding contract set
+	if w.decodeContractSet(jc, &up.ContractSet) != nil {
+		return
+	}
+
+	contracts, err := w.bus.Contracts(ctx, up.ContractSet)
+	if jc.Check("couldn't fetch contracts from bus", err) != nil {
+		return
+	}
+
+	// filter the contracts down to the requested hosts
+	if len(req.HostKeys) > 0 {
+		hosts := make(map[types.PublicKey]struct{})
+		for _, hk := range req.HostKeys {
+			hosts[hk] = struct{}{}
+		}
+		filtered := contracts[:0]
+		for _, c := range contracts {
+			if _, ok := hosts[c.HostKey]; ok {
+				filtered = append(filtered, c)
+			}
+		}
+		contracts = filtered
+	}
+
+	var resp api.RHPPrewarmResponse
+	resp.Warmed, resp.Failed = w.prewarmSessions(ctx, contracts)
+	jc.Encode(resp)
+}
+
 func (w *worker) rhpFormHandler(jc jape.Context) {
 	ctx := jc.Request.Context()
 	var rfr api.RHPFormRequest
@@ -565,25 +757,102 @@ func (w *worker) rhpRenewHandler(jc jape.Context) {
 		return
 	}
 
-	lockID, err := w.bus.AcquireContract(jc.Request.Context(), rrr.ContractID, lockingPriorityRenew, lockingDurationRenew)
-	if jc.Check("could not lock contract for renewal", err) != nil {
+	contract, txnSet, err := w.renewContract(ctx, gp, rrr.ContractID, rrr.HostKey, rrr.HostIP, rrr.RenterAddress, rrr.RenterFunds, rrr.EndHeight, func(types.FileContractRevision, rhpv2.HostSettings) types.Currency {
+		return rrr.NewCollateral
+	})
+	if jc.Check("couldn't renew contract", err) != nil {
 		return
 	}
-	defer func() {
-		_ = w.bus.ReleaseContract(ctx, rrr.ContractID, lockID) // TODO: log error
-	}()
+	jc.Encode(api.RHPRenewResponse{
+		ContractID:     contract.ID(),
+		Contract:       contract,
+		TransactionSet: txnSet,
+	})
+}
 
-	hostIP, hostKey, toRenewID, renterFunds, newCollateral := rrr.HostIP, rrr.HostKey, rrr.ContractID, rrr.RenterFunds, rrr.NewCollateral
-	renterAddress, endHeight := rrr.RenterAddress, rrr.EndHeight
-	renterKey := w.deriveRenterKey(hostKey)
+func (w *worker) rhpContractRenewHandlerPOST(jc jape.Context) {
+	var id types.FileContractID
+	var req api.RHPContractRenewRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
+		return
+	}
+	w.renewContractManually(jc, id, req.EndHeight, req.RenterFunds)
+}
 
-	var contract rhpv2.ContractRevision
-	var txnSet []types.Transaction
-	ctx = WithGougingChecker(jc.Request.Context(), gp)
-	err = w.withHost(ctx, toRenewID, hostKey, hostIP, func(ss sectorStore) error {
+func (w *worker) rhpContractRefreshHandlerPOST(jc jape.Context) {
+	var id types.FileContractID
+	var req api.RHPContractRefreshRequest
+	if jc.DecodeParam("id", &id) != nil || jc.Decode(&req) != nil {
+		return
+	}
+	w.renewContractManually(jc, id, 0, req.RenterFunds)
+}
+
+// renewContractManually renews the contract with the given id on behalf of the
+// operator and adds the renewed contract to the bus. The contract is
+// refreshed if the end height is zero. The host's collateral is derived from
+// the renter funds the same way the autopilot does.
+func (w *worker) renewContractManually(jc jape.Context, fcid types.FileContractID, endHeight uint64, renterFunds types.Currency) {
+	ctx := jc.Request.Context()
+	if renterFunds.IsZero() {
+		jc.Error(errors.New("renter funds must be greater than zero"), http.StatusBadRequest)
+		return
+	}
+
+	c, err := w.bus.Contract(ctx, fcid)
+	if jc.Check("couldn't fetch contract", err) != nil {
+		return
+	}
+	gp, err := w.bus.GougingParams(ctx)
+	if jc.Check("could not get gouging parameters", err) != nil {
+		return
+	}
+	blockHeight := gp.ConsensusState.BlockHeight
+	if endHeight == 0 {
+		endHeight = c.WindowStart
+	} else if endHeight < c.WindowStart {
+		jc.Error(fmt.Errorf("end height %v is before the contract's end height %v", endHeight, c.WindowStart), http.StatusBadRequest)
+		return
+	}
+	if endHeight <= blockHeight {
+		jc.Error(fmt.Errorf("end height %v has already been reached", endHeight), http.StatusBadRequest)
+		return
+	}
+	renterAddress, err := w.bus.WalletAddress(ctx)
+	if jc.Check("couldn't fetch wallet address", err) != nil {
+		return
+	}
+
+	contract, _, err := w.renewContract(ctx, gp, fcid, c.HostKey, c.HostIP, renterAddress, renterFunds, endHeight, func(rev types.FileContractRevision, host rhpv2.HostSettings) types.Currency {
+		expectedStorage := RenterFundsToExpectedStorage(renterFunds, endHeight-blockHeight, host)
+		return rhpv2.ContractRenewalCollateral(rev.FileContract, expectedStorage, host, blockHeight, endHeight)
+	})
+	if jc.Check("couldn't renew contract", err) != nil {
+		return
+	}
+	renewed, err := w.bus.AddRenewedContract(ctx, contract, renterFunds, blockHeight, fcid)
+	if jc.Check("couldn't add renewed contract", err) != nil {
+		return
+	}
+	jc.Encode(renewed)
+}
+
+// renewContract locks the contract and renews it with the host, collateral
+// returns the host's new collateral given the contract's latest revision and
+// the host's settings.
+func (w *worker) renewContract(ctx context.Context, gp api.GougingParams, fcid types.FileContractID, hostKey types.PublicKey, hostIP string, renterAddress types.Address, renterFunds types.Currency, endHeight uint64, collateral func(types.FileContractRevision, rhpv2.HostSettings) types.Currency) (contract rhpv2.ContractRevision, txnSet []types.Transaction, err error) {
+	ctx, release, err := acquireContractLease(ctx, &tracedContractLocker{w.bus}, fcid, lockingPriorityRenew, contractLockingLeaseDuration)
+	if err != nil {
+		return rhpv2.ContractRevision{}, nil, fmt.Errorf("could not lock contract for renewal: %w", err)
+	}
+	defer release(context.Background())
+
+	renterKey := w.deriveRenterKey(hostKey)
+	ctx = WithGougingChecker(ctx, gp)
+	err = w.withHost(ctx, fcid, hostKey, hostIP, func(ss SectorStore) error {
 		session := ss.(*sharedSession)
 		contract, txnSet, err = session.RenewContract(ctx, func(rev types.FileContractRevision, host rhpv2.HostSettings) ([]types.Transaction, types.Currency, func(), error) {
-			renterTxnSet, finalPayment, err := w.bus.WalletPrepareRenew(ctx, rev, renterAddress, renterKey, renterFunds, newCollateral, hostKey, host, endHeight)
+			renterTxnSet, finalPayment, err := w.bus.WalletPrepareRenew(ctx, rev, renterAddress, renterKey, renterFunds, collateral(rev, host), hostKey, host, endHeight)
 			if err != nil {
 				return nil, types.Currency{}, nil, err
 			}
@@ -591,14 +860,22 @@ func (w *worker) rhpRenewHandler(jc jape.Context) {
 		})
 		return err
 	})
-	if jc.Check("couldn't renew contract", err) != nil {
+	return
+}
+
+func (w *worker) rhpContractKeysHandlerPOST(jc jape.Context) {
+	var hostKeys []types.PublicKey
+	if jc.Decode(&hostKeys) != nil {
 		return
 	}
-	jc.Encode(api.RHPRenewResponse{
-		ContractID:     contract.ID(),
-		Contract:       contract,
-		TransactionSet: txnSet,
-	})
+	keys := make([]api.ContractKeys, len(hostKeys))
+	for i, hk := range hostKeys {
+		keys[i] = api.ContractKeys{
+			HostKey:   hk,
+			RenterKey: w.deriveRenterKey(hk).PublicKey(),
+		}
+	}
+	jc.Encode(keys)
 }
 
 func (w *worker) rhpFundHandler(jc jape.Context) {
@@ -607,6 +884,11 @@ func (w *worker) rhpFundHandler(jc jape.Context) {
 	if jc.Decode(&rfr) != nil {
 		return
 	}
+	// Check the amount against the spending caps.
+	if jc.Check("couldn't fund account", w.bus.AuthorizeSpending(ctx, api.SpendingCategoryFundAccount, rfr.Amount)) != nil {
+		return
+	}
+
 	// Get account for the host.
 	account, err := w.accounts.ForHost(rfr.HostKey)
 	if jc.Check("failed to get account for provided host", err) != nil {
@@ -621,19 +903,17 @@ func (w *worker) rhpFundHandler(jc jape.Context) {
 	hostIP := h.Settings.NetAddress
 	siamuxAddr := h.Settings.SiamuxAddr()
 
-	// Get contract revision.
-	lockID, err := w.bus.AcquireContract(jc.Request.Context(), rfr.ContractID, lockingPriorityFunding, lockingDurationFunding)
+	// Lock the contract.
+	ctx, release, err := acquireContractLease(ctx, &tracedContractLocker{w.bus}, rfr.ContractID, lockingPriorityFunding, contractLockingLeaseDuration)
 	if jc.Check("failed to acquire contract for funding EA", err) != nil {
 		return
 	}
-	defer func() {
-		_ = w.bus.ReleaseContract(ctx, rfr.ContractID, lockID) // TODO: log error
-	}()
+	defer release(context.Background())
 
 	// Get contract revision.
 	var revision types.FileContractRevision
-	err = w.withHost(jc.Request.Context(), rfr.ContractID, rfr.HostKey, hostIP, func(ss sectorStore) error {
-		rev, err := ss.(*sharedSession).Revision(jc.Request.Context())
+	err = w.withHost(ctx, rfr.ContractID, rfr.HostKey, hostIP, func(ss SectorStore) error {
+		rev, err := ss.(*sharedSession).Revision(ctx)
 		if err != nil {
 			return err
 		}
@@ -648,7 +928,7 @@ func (w *worker) rhpFundHandler(jc jape.Context) {
 	pt, ptValid := w.priceTables.PriceTable(rfr.HostKey)
 	if !ptValid {
 		paymentFunc := w.preparePriceTableContractPayment(rfr.HostKey, &revision)
-		pt, err = w.priceTables.Update(jc.Request.Context(), paymentFunc, siamuxAddr, rfr.HostKey)
+		pt, err = w.priceTables.Update(ctx, paymentFunc, siamuxAddr, rfr.HostKey)
 		if jc.Check("failed to update outdated price table", err) != nil {
 			return
 		}
@@ -715,11 +995,8 @@ func (w *worker) slabMigrateHandler(jc jape.Context) {
 	}
 
 	// allow overriding contract set
-	var contractset string
-	if jc.DecodeForm(queryStringParamContractSet, &contractset) != nil {
+	if w.decodeContractSet(jc, &up.ContractSet) != nil {
 		return
-	} else if contractset != "" {
-		up.ContractSet = contractset
 	}
 
 	// attach gouging checker to the context
@@ -727,6 +1004,7 @@ func (w *worker) slabMigrateHandler(jc jape.Context) {
 
 	// attach contract spending recorder to the context.
 	ctx = WithContractSpendingRecorder(ctx, w.contractSpendingRecorder)
+	ctx = WithUploadingSectorsRecorder(ctx, w.bus)
 
 	contracts, err := w.bus.Contracts(ctx, up.ContractSet)
 	if jc.Check("couldn't fetch contracts from bus", err) != nil {
@@ -734,7 +1012,7 @@ func (w *worker) slabMigrateHandler(jc jape.Context) {
 	}
 
 	w.pool.setCurrentHeight(up.CurrentHeight)
-	err = migrateSlab(ctx, w, &slab, contracts, w.bus, w.downloadSectorTimeout, w.uploadSectorTimeout)
+	err = migrateSlab(ctx, w.storeProvider(ctx), &slab, contracts, w.bus, w.downloadTimeouts, w.uploadTimeouts, w.downloadOverdrive, w.uploadOverdrive)
 	if jc.Check("couldn't migrate slabs", err) != nil {
 		return
 	}
@@ -758,149 +1036,750 @@ func (w *worker) slabMigrateHandler(jc jape.Context) {
 	}
 }
 
-func (w *worker) objectsKeyHandlerGET(jc jape.Context) {
+func (w *worker) reshardKeyHandlerPOST(jc jape.Context) {
 	ctx := jc.Request.Context()
-	jc.Custom(nil, []string{})
-
 	key := strings.TrimPrefix(jc.PathParam("key"), "/")
-	o, es, err := w.bus.Object(ctx, key)
-	if jc.Check("couldn't get object or entries", err) != nil {
-		return
-	}
-	if len(es) > 0 {
-		jc.Encode(es)
-		return
-	}
-	if len(o.Slabs) == 0 {
-		jc.Error(errors.New("object has no data"), http.StatusInternalServerError)
+
+	up, err := w.bus.UploadParams(ctx)
+	if jc.Check("couldn't fetch upload parameters from bus", err) != nil {
 		return
 	}
-
 	dp, err := w.bus.DownloadParams(ctx)
 	if jc.Check("couldn't fetch download parameters from bus", err) != nil {
 		return
 	}
+	rs := up.RedundancySettings
 
-	// allow overriding contract set
-	var contractset string
-	if jc.DecodeForm(queryStringParamContractSet, &contractset) != nil {
-		return
-	} else if contractset != "" {
-		dp.ContractSet = contractset
-	}
-
-	// attach gouging checker to the context
-	ctx = WithGougingChecker(ctx, dp.GougingParams)
-
-	// attach contract spending recorder to the context.
+	// attach gouging checker and contract spending recorder to the context
+	ctx = WithGougingChecker(ctx, up.GougingParams)
 	ctx = WithContractSpendingRecorder(ctx, w.contractSpendingRecorder)
+	ctx = WithUploadingSectorsRecorder(ctx, w.bus)
+	w.pool.setCurrentHeight(up.CurrentHeight)
 
-	// NOTE: ideally we would use http.ServeContent in this handler, but that
-	// has performance issues. If we implemented io.ReadSeeker in the most
-	// straightforward fashion, we would need one (or more!) RHP RPCs for each
-	// Read call. We can improve on this to some degree by buffering, but
-	// without knowing the exact ranges being requested, this will always be
-	// suboptimal. Thus, sadly, we have to roll our own range support.
-	offset, length, err := parseRange(jc.Request.Header.Get("Range"), o.Size())
-	if err != nil {
-		jc.Error(err, http.StatusRequestedRangeNotSatisfiable)
+	o, _, err := w.bus.Object(ctx, key)
+	if jc.Check("couldn't fetch object from bus", err) != nil {
+		return
+	} else if o.Wrap != nil {
+		jc.Error(errors.New("objects protected by a passphrase can't be resharded"), http.StatusBadRequest)
+		return
+	} else if o.ETag == "" {
+		jc.Error(errors.New("objects without an ETag can't be resharded"), http.StatusBadRequest)
 		return
 	}
-	if length < o.Size() {
-		jc.ResponseWriter.WriteHeader(http.StatusPartialContent)
-		jc.ResponseWriter.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, o.Size()))
+	contracts, err := w.uploadContracts(ctx, up.ContractSet)
+	if jc.Check("couldn't fetch contracts from bus", err) != nil {
+		return
 	}
-	jc.ResponseWriter.Header().Set("Content-Length", strconv.FormatInt(length, 10))
-
-	// keep track of slow hosts so we can avoid them in consecutive slab uploads
-	slow := make(map[types.PublicKey]int)
 
-	cw := o.Key.Decrypt(jc.ResponseWriter, offset)
-	for i, ss := range slabsForDownload(o.Slabs, offset, length) {
-		contracts, err := w.bus.ContractsForSlab(ctx, ss.Shards, dp.ContractSet)
-		if err != nil {
-			w.logger.Errorf("couldn't fetch contracts for object %v slab %d, err: %v", key, i, err)
-			if i == 0 {
-				jc.Error(err, http.StatusInternalServerError)
+	// download the object's slabs, the data is piped to the upload without
+	// decrypting it with the object key so the object's key is kept
+	pr, pw := io.Pipe()
+	go func() {
+		for _, ss := range o.Slabs {
+			slabContracts, err := w.bus.ContractsForSlab(ctx, ss.Shards, dp.ContractSet)
+			if err == nil {
+				_, err = downloadSlab(ctx, w.storeProvider(ctx), pw, ss, slabContracts, &tracedContractLocker{w.bus}, w.downloadTimeouts, w.downloadOverdrive)
+			}
+			if err != nil {
+				pw.CloseWithError(fmt.Errorf("couldn't download slab: %w", err))
+				return
 			}
-			return
 		}
+		pw.Close()
+	}()
 
-		if len(contracts) < int(ss.MinShards) {
-			err = fmt.Errorf("not enough contracts to download the slab, %d<%d", len(contracts), ss.MinShards)
-			w.logger.Errorf("couldn't download object %v slab %d, err: %v", key, i, err)
-			if i == 0 {
-				jc.Error(err, http.StatusInternalServerError)
-			}
+	// upload the data again using the current redundancy settings
+	var slabs []object.SlabSlice
+	usedContracts := make(map[types.PublicKey]types.FileContractID)
+	for {
+		s, length, _, err := uploadSlab(ctx, w.storeProvider(ctx), io.LimitReader(pr, int64(rs.MinShards)*rhpv2.SectorSize), object.GenerateEncryptionKey(), uint8(rs.MinShards), uint8(rs.TotalShards), contracts, &tracedContractLocker{w.bus}, w.uploadTimeouts, w.uploadOverdrive)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			pr.CloseWithError(err)
+			jc.Check("couldn't reshard object", err)
 			return
 		}
-
-		// randomize order of contracts so we don't always download from the same hosts
-		frand.Shuffle(len(contracts), func(i, j int) { contracts[i], contracts[j] = contracts[j], contracts[i] })
-
-		// move slow hosts to the back of the array
-		sort.SliceStable(contracts, func(i, j int) bool {
-			return slow[contracts[i].HostKey] < slow[contracts[j].HostKey]
+		slabs = append(slabs, object.SlabSlice{
+			Slab:   s,
+			Offset: 0,
+			Length: uint32(length),
 		})
-
-		slowHosts, err := downloadSlab(ctx, w, cw, ss, contracts, &tracedContractLocker{w.bus}, w.downloadSectorTimeout)
-		for _, h := range slowHosts {
-			slow[contracts[h].HostKey]++
-		}
-		if err != nil {
-			w.logger.Errorf("couldn't download object %v slab %d, err: %v", key, i, err)
-			if i == 0 {
-				jc.Error(err, http.StatusInternalServerError)
+		for _, ss := range s.Shards {
+			for _, c := range contracts {
+				if c.HostKey == ss.Host {
+					usedContracts[ss.Host] = c.ID
+					break
+				}
 			}
-			return
 		}
 	}
+
+	// the object is only replaced if it wasn't overwritten in the meantime,
+	// the bus checks its ETag in the same transaction it updates the object
+	o.Slabs = slabs
+	err = w.bus.AddObjectIfMatch(ctx, key, fmt.Sprintf("%q", o.ETag), o, usedContracts, nil)
+	if errors.Is(err, api.ErrPreconditionFailed) {
+		jc.Error(errors.New("object was modified while it was resharded"), http.StatusConflict)
+		return
+	}
+	jc.Check("couldn't update object", err)
 }
 
-func (w *worker) objectsKeyHandlerPUT(jc jape.Context) {
-	jc.Custom((*[]byte)(nil), nil)
+func (w *worker) sectorsAuditHandlerPOST(jc jape.Context) {
 	ctx := jc.Request.Context()
-
-	up, err := w.bus.UploadParams(ctx)
-	if jc.Check("couldn't fetch upload parameters from bus", err) != nil {
+	var audits []api.SectorAudit
+	if jc.Decode(&audits) != nil {
 		return
 	}
-	rs := up.RedundancySettings
 
-	// allow overriding the redundancy settings
-	if jc.DecodeForm(queryStringParamMinShards, &rs.MinShards) != nil {
+	dp, err := w.bus.DownloadParams(ctx)
+	if jc.Check("couldn't fetch download parameters from bus", err) != nil {
 		return
 	}
-	if jc.DecodeForm(queryStringParamTotalShards, &rs.TotalShards) != nil {
-		return
+
+	// attach gouging checker and contract spending recorder to the context
+	ctx = WithGougingChecker(ctx, dp.GougingParams)
+	ctx = WithContractSpendingRecorder(ctx, w.contractSpendingRecorder)
+
+	results := make([]api.SectorAuditResult, len(audits))
+	var wg sync.WaitGroup
+	for i, a := range audits {
+		wg.Add(1)
+		go func(i int, a api.SectorAudit) {
+			defer wg.Done()
+			results[i] = w.auditSector(ctx, a)
+		}(i, a)
 	}
-	if jc.Check("invalid redundancy settings", rs.Validate()) != nil {
+	wg.Wait()
+	jc.Encode(results)
+}
+
+// auditSector verifies the host still stores the sector by downloading a
+// random leaf of it, which the host has to prove is part of the sector.
+func (w *worker) auditSector(ctx context.Context, a api.SectorAudit) api.SectorAuditResult {
+	res := api.SectorAuditResult{
+		ContractID: a.ContractID,
+		HostKey:    a.HostKey,
+		Root:       a.Root,
+	}
+	ctx, release, err := acquireContractLease(ctx, &tracedContractLocker{w.bus}, a.ContractID, contractLockingDownloadPriority, contractLockingLeaseDuration)
+	if err == nil {
+		defer release(context.Background())
+		offset := uint32(frand.Intn(rhpv2.LeavesPerSector)) * rhpv2.LeafSize
+		err = w.withHost(ctx, a.ContractID, a.HostKey, a.HostIP, func(ss SectorStore) error {
+			return ss.DownloadSector(ctx, io.Discard, a.Root, offset, rhpv2.LeafSize)
+		})
+	}
+	if err != nil {
+		res.Error = err.Error()
+		res.Missing = isSectorNotFound(err)
+	}
+	return res
+}
+
+// isSectorNotFound returns true if the error is the host's response to a
+// request for a sector it doesn't store.
+func isSectorNotFound(err error) bool {
+	var rpcErr *rhpv2.RPCError
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	desc := strings.ToLower(rpcErr.Description)
+	return strings.Contains(desc, "sector not found") || strings.Contains(desc, "could not find the desired sector")
+}
+
+func (w *worker) objectsAuditHandlerPOST(jc jape.Context) {
+	ctx := jc.Request.Context()
+	var paths []string
+	if jc.Decode(&paths) != nil {
 		return
 	}
 
-	// allow overriding contract set
-	var contractset string
-	if jc.DecodeForm(queryStringParamContractSet, &contractset) != nil {
+	dp, err := w.bus.DownloadParams(ctx)
+	if jc.Check("couldn't fetch download parameters from bus", err) != nil {
 		return
-	} else if contractset != "" {
-		up.ContractSet = contractset
 	}
 
-	// attach gouging checker to the context
-	ctx = WithGougingChecker(ctx, up.GougingParams)
+	// refuse to audit once the download spending cap is reached
+	if jc.Check("couldn't audit objects", w.bus.AuthorizeSpending(ctx, api.SpendingCategoryDownload, types.ZeroCurrency)) != nil {
+		return
+	}
 
-	// attach contract spending recorder to the context.
+	// attach gouging checker and contract spending recorder to the context
+	ctx = WithGougingChecker(ctx, dp.GougingParams)
 	ctx = WithContractSpendingRecorder(ctx, w.contractSpendingRecorder)
 
-	o := object.Object{
-		Key: object.GenerateEncryptionKey(),
+	// objects are audited one at a time since every audit downloads the
+	// whole object
+	results := make([]api.ObjectAuditResult, len(paths))
+	for i, path := range paths {
+		results[i] = w.auditObject(ctx, path, dp.ContractSet)
 	}
-	w.pool.setCurrentHeight(up.CurrentHeight)
-	usedContracts := make(map[types.PublicKey]types.FileContractID)
+	jc.Encode(results)
+}
 
-	// fetch contracts
-	contracts, err := w.bus.Contracts(ctx, up.ContractSet)
-	if jc.Check("couldn't fetch contracts from bus", err) != nil {
+// auditObject verifies the object's data still matches its ETag by downloading
+// and hashing it. Objects whose key is protected by a passphrase can't be
+// audited.
+func (w *worker) auditObject(ctx context.Context, path, contractSet string) api.ObjectAuditResult {
+	res := api.ObjectAuditResult{Path: path}
+	o, _, err := w.bus.Object(ctx, path)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	} else if o.Wrap != nil {
+		res.Error = "object is protected by a passphrase"
+		return res
+	} else if o.ETag == "" {
+		res.Error = "object has no ETag"
+		return res
+	}
+
+	h := o.Key.ETagHasher()
+	if _, err := w.downloadObject(ctx, h, path, o, 0, o.Size(), contractSet); err != nil {
+		// a failed download doesn't mean the object is corrupt, the
+		// sectors that couldn't be downloaded are found by the sector
+		// audits
+		res.Error = err.Error()
+	} else if etag := hex.EncodeToString(h.Sum(nil)); etag != o.ETag {
+		res.Corrupt = true
+		res.Error = fmt.Sprintf("ETag mismatch, expected %v, got %v", o.ETag, etag)
+	}
+	return res
+}
+
+func (w *worker) gcSectorsHandlerPOST(jc jape.Context) {
+	ctx := jc.Request.Context()
+	limit := 1000
+	if jc.DecodeForm("limit", &limit) != nil {
+		return
+	}
+
+	deletions, err := w.bus.SectorDeletions(ctx, limit)
+	if jc.Check("couldn't fetch sector deletions from bus", err) != nil {
+		return
+	} else if len(deletions) == 0 {
+		jc.Encode(api.DeleteSectorsResponse{})
+		return
+	}
+
+	up, err := w.bus.UploadParams(ctx)
+	if jc.Check("couldn't fetch upload parameters from bus", err) != nil {
+		return
+	}
+
+	// attach gouging checker and contract spending recorder to the context
+	ctx = WithGougingChecker(ctx, up.GougingParams)
+	ctx = WithContractSpendingRecorder(ctx, w.contractSpendingRecorder)
+	w.pool.setCurrentHeight(up.CurrentHeight)
+
+	// delete the sectors from every host in parallel
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var deleted []api.SectorDeletions
+	var resp api.DeleteSectorsResponse
+	for _, d := range deletions {
+		wg.Add(1)
+		go func(d api.SectorDeletions) {
+			defer wg.Done()
+			roots, err := w.deleteSectors(ctx, d)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				resp.Errors = append(resp.Errors, HostError{d.HostKey, err}.Error())
+				return
+			}
+			deleted = append(deleted, d) // re-uploaded roots are unscheduled too
+			resp.Deleted += len(roots)
+		}(d)
+	}
+	wg.Wait()
+	resp.ReclaimedBytes = uint64(resp.Deleted) * rhpv2.SectorSize
+
+	if jc.Check("couldn't remove sector deletions", w.bus.RemoveSectorDeletions(ctx, deleted)) == nil {
+		jc.Encode(resp)
+	}
+}
+
+// deleteSectors deletes the sectors of d from the host while holding the lock
+// of the contract. The roots are checked against the bus once the lock is
+// acquired, sectors that were uploaded again in the meantime are kept. It
+// returns the roots that were deleted.
+func (w *worker) deleteSectors(ctx context.Context, d api.SectorDeletions) ([]types.Hash256, error) {
+	ctx, release, err := acquireContractLease(ctx, &tracedContractLocker{w.bus}, d.ContractID, lockingPriorityPruning, contractLockingLeaseDuration)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't acquire contract: %w", err)
+	}
+	defer release(context.Background())
+
+	scheduled, err := w.bus.ContractSectorDeletions(ctx, d.ContractID)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't fetch sector deletions: %w", err)
+	}
+	isScheduled := make(map[types.Hash256]struct{}, len(scheduled))
+	for _, root := range scheduled {
+		isScheduled[root] = struct{}{}
+	}
+	var roots []types.Hash256
+	for _, root := range d.Roots {
+		if _, ok := isScheduled[root]; ok {
+			roots = append(roots, root)
+		}
+	}
+	if len(roots) == 0 {
+		return nil, nil
+	}
+
+	err = w.withHost(ctx, d.ContractID, d.HostKey, d.HostIP, func(ss SectorStore) error {
+		return ss.DeleteSectors(ctx, roots)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return roots, nil
+}
+
+func (w *worker) rhpContractBroadcastHandlerPOST(jc jape.Context) {
+	ctx := jc.Request.Context()
+	var fcid types.FileContractID
+	if jc.DecodeParam("id", &fcid) != nil {
+		return
+	}
+
+	c, err := w.bus.Contract(ctx, fcid)
+	if jc.Check("couldn't fetch contract", err) != nil {
+		return
+	}
+	gp, err := w.bus.GougingParams(ctx)
+	if jc.Check("could not get gouging parameters", err) != nil {
+		return
+	}
+
+	// fetch the latest revision, signed by both parties, from the host
+	ctx, release, err := acquireContractLease(ctx, &tracedContractLocker{w.bus}, fcid, lockingPriorityBroadcast, contractLockingLeaseDuration)
+	if jc.Check("couldn't acquire contract for broadcasting", err) != nil {
+		return
+	}
+	defer release(context.Background())
+	var rev rhpv2.ContractRevision
+	err = w.withHost(ctx, fcid, c.HostKey, c.HostIP, func(ss SectorStore) (err error) {
+		rev, err = ss.(*sharedSession).Revision(ctx)
+		return
+	})
+	if jc.Check("couldn't fetch contract revision", err) != nil {
+		return
+	}
+
+	// the signatures only cover the revision, so the wallet can add the
+	// inputs that pay the fee
+	txn := types.Transaction{
+		FileContractRevisions: []types.FileContractRevision{rev.Revision},
+		Signatures:            rev.Signatures[:],
+	}
+	toSign, parents, err := w.bus.WalletFund(ctx, &txn, types.ZeroCurrency)
+	if jc.Check("couldn't fund revision transaction", err) != nil {
+		return
+	}
+	err = w.bus.WalletSign(ctx, &txn, toSign, types.CoveredFields{WholeTransaction: true})
+	if jc.Check("couldn't sign revision transaction", err) != nil {
+		_ = w.bus.WalletDiscard(ctx, txn)
+		return
+	}
+	err = w.bus.BroadcastTransaction(ctx, append(parents, txn))
+	if jc.Check("couldn't broadcast revision transaction", err) != nil {
+		_ = w.bus.WalletDiscard(ctx, txn)
+		return
+	}
+
+	cb := api.ContractBroadcast{
+		RevisionNumber: rev.Revision.RevisionNumber,
+		Height:         gp.ConsensusState.BlockHeight,
+		TransactionID:  txn.ID(),
+	}
+	if jc.Check("couldn't record contract broadcast", w.bus.RecordContractBroadcast(ctx, fcid, cb)) == nil {
+		jc.Encode(cb)
+	}
+}
+
+func (w *worker) rhpContractPrunableHandlerGET(jc jape.Context) {
+	ctx := jc.Request.Context()
+	var fcid types.FileContractID
+	if jc.DecodeParam("id", &fcid) != nil {
+		return
+	}
+
+	c, err := w.bus.Contract(ctx, fcid)
+	if jc.Check("couldn't fetch contract", err) != nil {
+		return
+	}
+	roots, err := w.bus.ContractRoots(ctx, fcid)
+	if jc.Check("couldn't fetch contract roots", err) != nil {
+		return
+	}
+
+	var size uint64
+	err = w.withHost(ctx, fcid, c.HostKey, c.HostIP, func(ss SectorStore) error {
+		rev, err := ss.(*sharedSession).Revision(ctx)
+		if err != nil {
+			return err
+		}
+		size = rev.NumSectors() * rhpv2.SectorSize
+		return nil
+	})
+	if jc.Check("couldn't fetch contract revision", err) != nil {
+		return
+	}
+
+	var prunable uint64
+	if referenced := uint64(len(roots)) * rhpv2.SectorSize; size > referenced {
+		prunable = size - referenced
+	}
+	jc.Encode(api.RHPContractPrunableResponse{
+		Size:     size,
+		Prunable: prunable,
+	})
+}
+
+func (w *worker) rhpContractRootsHandlerPOST(jc jape.Context) {
+	ctx := jc.Request.Context()
+	var fcid types.FileContractID
+	var req api.RHPContractRootsRequest
+	if jc.DecodeParam("id", &fcid) != nil || jc.Decode(&req) != nil {
+		return
+	}
+
+	gp, err := w.bus.GougingParams(ctx)
+	if jc.Check("could not get gouging parameters", err) != nil {
+		return
+	}
+
+	// NOTE: the contract isn't looked up on the bus since this endpoint is
+	// used to recover contracts the bus doesn't know about, which is also
+	// why the spending isn't recorded
+	ctx = WithGougingChecker(ctx, gp)
+
+	var resp api.RHPContractRootsResponse
+	err = w.withHost(ctx, fcid, req.HostKey, req.HostIP, func(ss SectorStore) (err error) {
+		resp.Revision, resp.Roots, err = ss.(*sharedSession).SectorRoots(ctx)
+		return
+	})
+	if jc.Check("couldn't fetch contract roots", err) == nil {
+		jc.Encode(resp)
+	}
+}
+
+func (w *worker) rhpContractPruneHandlerPOST(jc jape.Context) {
+	ctx := jc.Request.Context()
+	var fcid types.FileContractID
+	if jc.DecodeParam("id", &fcid) != nil {
+		return
+	}
+
+	c, err := w.bus.Contract(ctx, fcid)
+	if jc.Check("couldn't fetch contract", err) != nil {
+		return
+	}
+	up, err := w.bus.UploadParams(ctx)
+	if jc.Check("couldn't fetch upload parameters from bus", err) != nil {
+		return
+	}
+
+	// lock the contract, uploads to it have to wait until the contract
+	// is pruned
+	ctx, release, err := acquireContractLease(ctx, &tracedContractLocker{w.bus}, fcid, lockingPriorityPruning, contractLockingLeaseDuration)
+	if jc.Check("couldn't acquire contract for pruning", err) != nil {
+		return
+	}
+	defer release(context.Background())
+
+	// fetch the roots after acquiring the lock to make sure we don't prune
+	// sectors that were uploaded in the meantime, the roots include the
+	// sectors of uploads that are still in progress since uploads record
+	// them with the bus before releasing the contract
+	roots, err := w.bus.ContractRoots(ctx, fcid)
+	if jc.Check("couldn't fetch contract roots", err) != nil {
+		return
+	}
+
+	// attach gouging checker and contract spending recorder to the context
+	ctx = WithGougingChecker(ctx, up.GougingParams)
+	ctx = WithContractSpendingRecorder(ctx, w.contractSpendingRecorder)
+	w.pool.setCurrentHeight(up.CurrentHeight)
+
+	var resp api.RHPContractPruneResponse
+	err = w.withHost(ctx, fcid, c.HostKey, c.HostIP, func(ss SectorStore) error {
+		pruned, err := ss.(*sharedSession).PruneSectors(ctx, roots)
+		if err != nil {
+			return err
+		}
+		rev, err := ss.(*sharedSession).Revision(ctx)
+		if err != nil {
+			return err
+		}
+		resp.Pruned = pruned * rhpv2.SectorSize
+		resp.Remaining = rev.NumSectors() * rhpv2.SectorSize
+		return nil
+	})
+	if jc.Check("couldn't prune contract", err) == nil {
+		jc.Encode(resp)
+	}
+}
+
+// decodeContractSet overrides the given contract set with the one passed in
+// the query string, if any, after verifying that it exists.
+func (w *worker) decodeContractSet(jc jape.Context, set *string) error {
+	var contractset string
+	if err := jc.DecodeForm(queryStringParamContractSet, &contractset); err != nil {
+		return err
+	} else if contractset == "" || contractset == *set {
+		return nil
+	}
+
+	sets, err := w.bus.ContractSets(jc.Request.Context())
+	if jc.Check("couldn't fetch contract sets from bus", err) != nil {
+		return err
+	}
+	for _, s := range sets {
+		if s == contractset {
+			*set = contractset
+			return nil
+		}
+	}
+	err = fmt.Errorf("contract set '%v' not found", contractset)
+	jc.Error(err, http.StatusBadRequest)
+	return err
+}
+
+// uploadContracts returns the contracts in the given set that are good for
+// upload.
+func (w *worker) uploadContracts(ctx context.Context, set string) ([]api.ContractMetadata, error) {
+	contracts, err := w.bus.Contracts(ctx, set)
+	if err != nil {
+		return nil, err
+	}
+	good := contracts[:0]
+	for _, c := range contracts {
+		if c.GoodForUpload {
+			good = append(good, c)
+		}
+	}
+	return good, nil
+}
+
+func (w *worker) objectsKeyHandlerGET(jc jape.Context) {
+	ctx := jc.Request.Context()
+	jc.Custom(nil, []api.ObjectMetadata{})
+
+	key := strings.TrimPrefix(jc.PathParam("key"), "/")
+	o, es, err := w.bus.Object(ctx, key)
+	if jc.Check("couldn't get object or entries", err) != nil {
+		return
+	}
+	if len(es) > 0 {
+		jc.Encode(es)
+		return
+	}
+	if len(o.Slabs) == 0 && o.PartialSlab == nil {
+		jc.Error(errors.New("object has no data"), http.StatusInternalServerError)
+		return
+	}
+
+	// unwrap the object key if it's protected by a passphrase
+	if o.Wrap != nil {
+		passphrase := jc.Request.Header.Get(headerPassphrase)
+		if passphrase == "" {
+			jc.Error(errors.New("object is protected by a passphrase"), http.StatusUnauthorized)
+			return
+		}
+		err = o.UnwrapKeys(passphrase)
+		if errors.Is(err, object.ErrInvalidPassphrase) {
+			jc.Error(err, http.StatusUnauthorized)
+			return
+		} else if jc.Check("couldn't unwrap object keys", err) != nil {
+			return
+		}
+	}
+
+	// answer conditional and HEAD requests without downloading the object
+	if checkNotModified(jc.ResponseWriter, jc.Request, o) {
+		jc.ResponseWriter.WriteHeader(http.StatusNotModified)
+		return
+	} else if jc.Request.Method == http.MethodHead {
+		jc.ResponseWriter.Header().Set("Content-Length", strconv.FormatInt(o.Size(), 10))
+		return
+	}
+
+	dp, err := w.bus.DownloadParams(ctx)
+	if jc.Check("couldn't fetch download parameters from bus", err) != nil {
+		return
+	}
+
+	// refuse to download once the download spending cap is reached
+	if jc.Check("couldn't download object", w.bus.AuthorizeSpending(ctx, api.SpendingCategoryDownload, types.ZeroCurrency)) != nil {
+		return
+	}
+
+	// allow overriding contract set
+	if w.decodeContractSet(jc, &dp.ContractSet) != nil {
+		return
+	}
+
+	// attach gouging checker to the context
+	ctx = WithGougingChecker(ctx, dp.GougingParams)
+
+	// attach contract spending recorder to the context.
+	ctx = WithContractSpendingRecorder(ctx, w.contractSpendingRecorder)
+
+	// NOTE: ideally we would use http.ServeContent in this handler, but that
+	// has performance issues. If we implemented io.ReadSeeker in the most
+	// straightforward fashion, we would need one (or more!) RHP RPCs for each
+	// Read call. We can improve on this to some degree by buffering, but
+	// without knowing the exact ranges being requested, this will always be
+	// suboptimal. Thus, sadly, we have to roll our own range support.
+	offset, length, err := parseRange(jc.Request.Header.Get("Range"), o.Size())
+	if err != nil {
+		jc.Error(err, http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	if length < o.Size() {
+		jc.ResponseWriter.WriteHeader(http.StatusPartialContent)
+		jc.ResponseWriter.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+length-1, o.Size()))
+	}
+	jc.ResponseWriter.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+
+	if i, err := w.downloadObject(ctx, jc.ResponseWriter, key, o, offset, length, dp.ContractSet); err != nil {
+		w.logger.Errorf("couldn't download object %v slab %d, err: %v", key, i, err)
+		if i == 0 {
+			jc.Error(err, http.StatusInternalServerError)
+		}
+	}
+}
+
+// downloadObject decrypts and writes length bytes of the object, starting at
+// offset, to dst. If the download fails it returns the index of the slab that
+// couldn't be downloaded, the partial slab being indexed after all others.
+func (w *worker) downloadObject(ctx context.Context, dst io.Writer, key string, o object.Object, offset, length int64, contractSet string) (int, error) {
+	// split the range between the slabs and the partial slab that follows
+	// them
+	slabsLength := length
+	var partial []byte
+	if ps := o.PartialSlab; ps != nil {
+		slabsSize := o.Size() - int64(len(ps.Data))
+		if offset+length > slabsSize {
+			partialOffset := offset - slabsSize
+			if partialOffset < 0 {
+				partialOffset = 0
+			}
+			partial = ps.Data[partialOffset : offset+length-slabsSize]
+			slabsLength -= int64(len(partial))
+		}
+	}
+	var slabs []object.SlabSlice
+	if slabsLength > 0 {
+		slabs = slabsForDownload(o.Slabs, offset, slabsLength)
+	}
+
+	// prewarm the sessions with the hosts involved in large downloads
+	if len(slabs) >= prewarmDownloadMinSlabs {
+		var shards []object.Sector
+		seen := make(map[types.PublicKey]struct{})
+		for _, ss := range slabs {
+			for _, shard := range ss.Shards {
+				if _, ok := seen[shard.Host]; !ok {
+					seen[shard.Host] = struct{}{}
+					shards = append(shards, shard)
+				}
+			}
+		}
+		if contracts, err := w.bus.ContractsForSlab(ctx, shards, contractSet); err != nil {
+			w.logger.Errorf("couldn't fetch contracts to prewarm for object %v, err: %v", key, err)
+		} else {
+			w.prewarmSessions(ctx, contracts)
+		}
+	}
+
+	cw := o.Key.Decrypt(dst, offset)
+	slabContracts := func(ctx context.Context, ss object.SlabSlice) ([]api.ContractMetadata, error) {
+		return w.bus.ContractsForSlab(ctx, ss.Shards, contractSet)
+	}
+	if i, err := downloadSlabs(ctx, w.storeProvider(ctx), cw, slabs, slabContracts, &tracedContractLocker{w.bus}, w.downloadTimeouts, w.downloadOverdrive, w.downloadPrefetchSlabs, w.downloadPrefetchMemory); err != nil {
+		return i, err
+	}
+
+	// write the tail of the object that wasn't packed into a slab yet
+	if len(partial) > 0 {
+		if _, err := cw.Write(partial); err != nil {
+			return len(slabs), err
+		}
+	}
+	return 0, nil
+}
+
+func (w *worker) objectsKeyHandlerPUT(jc jape.Context) {
+	jc.Custom((*[]byte)(nil), nil)
+	ctx := jc.Request.Context()
+
+	up, err := w.bus.UploadParams(ctx)
+	if jc.Check("couldn't fetch upload parameters from bus", err) != nil {
+		return
+	}
+	rs := up.RedundancySettings
+
+	// refuse to upload once the upload or storage spending cap is reached
+	if jc.Check("couldn't upload object", w.bus.AuthorizeSpending(ctx, api.SpendingCategoryUpload, types.ZeroCurrency)) != nil {
+		return
+	} else if jc.Check("couldn't upload object", w.bus.AuthorizeSpending(ctx, api.SpendingCategoryStorage, types.ZeroCurrency)) != nil {
+		return
+	}
+
+	// allow overriding the redundancy settings
+	if jc.DecodeForm(queryStringParamMinShards, &rs.MinShards) != nil {
+		return
+	}
+	if jc.DecodeForm(queryStringParamTotalShards, &rs.TotalShards) != nil {
+		return
+	}
+	if jc.Check("invalid redundancy settings", rs.Validate()) != nil {
+		return
+	}
+
+	// persist overridden redundancy settings on the object and check for
+	// gouging using the object's redundancy
+	var redundancy *api.RedundancySettings
+	if rs != up.RedundancySettings {
+		redundancy = &rs
+		up.RedundancySettings = rs
+	}
+
+	// allow overriding contract set
+	if w.decodeContractSet(jc, &up.ContractSet) != nil {
+		return
+	}
+
+	// attach gouging checker to the context
+	ctx = WithGougingChecker(ctx, up.GougingParams)
+
+	// attach contract spending recorder to the context.
+	ctx = WithContractSpendingRecorder(ctx, w.contractSpendingRecorder)
+	ctx = WithUploadingSectorsRecorder(ctx, w.bus)
+
+	// objects protected by a passphrase use a random key, the key of the
+	// object shouldn't be derivable from the master key
+	key := strings.TrimPrefix(jc.PathParam("key"), "/")
+	passphrase := jc.Request.Header.Get(headerPassphrase)
+	var o object.Object
+	if passphrase != "" {
+		o.Key = object.GenerateEncryptionKey()
+	} else {
+		o.Key, o.KeyNonce = w.objectKey()
+	}
+	w.pool.setCurrentHeight(up.CurrentHeight)
+	usedContracts := make(map[types.PublicKey]types.FileContractID)
+
+	// fetch contracts
+	contracts, err := w.uploadContracts(ctx, up.ContractSet)
+	if jc.Check("couldn't fetch contracts from bus", err) != nil {
 		return
 	}
 
@@ -910,28 +1789,86 @@ func (w *worker) objectsKeyHandlerPUT(jc jape.Context) {
 	// keep track of slow hosts so we can avoid them in consecutive slab uploads
 	slow := make(map[types.PublicKey]int)
 
-	cr := o.Key.Encrypt(jc.Request.Body)
+	// track the upload's progress, the ID is returned in a header so clients
+	// can query it while the upload is ongoing
+	uploadID := w.uploads.Start(key, jc.Request.ContentLength, int64(rs.MinShards)*rhpv2.SectorSize)
+	jc.ResponseWriter.Header().Set(headerUploadID, uploadID)
+	var uploadErr error
+	defer func() { w.uploads.Finish(uploadID, uploadErr) }()
+
+	// hash the object's data while it's uploaded, the hash serves as the
+	// object's ETag
+	h := o.Key.ETagHasher()
+	cr := o.Key.Encrypt(io.TeeReader(jc.Request.Body, h))
 	for {
 		var s object.Slab
 		var length int
 		var slowHosts []int
 
-		lr := io.LimitReader(cr, int64(rs.MinShards)*rhpv2.SectorSize)
+		// slabs that don't fit within the memory budget are spilled to disk
+		slabMemory := uploadSlabMemory(uint8(rs.MinShards), uint8(rs.TotalShards))
+		spill := !w.uploadMemory.tryAcquire(slabMemory)
+		releaseMemory := func() {
+			if !spill {
+				w.uploadMemory.release(slabMemory)
+			}
+		}
+
+		var lr io.Reader = io.LimitReader(cr, int64(rs.MinShards)*rhpv2.SectorSize)
+		releaseBuf := func() {}
+		// buffer the tail of the object as a partial slab instead of
+		// padding it to a full slab
+		if up.UploadPacking {
+			buf, release, partial, err := w.bufferSlab(lr, int64(rs.MinShards)*rhpv2.SectorSize, spill)
+			if err != nil {
+				releaseMemory()
+				uploadErr = err
+				jc.Check("couldn't read object data", err)
+				return
+			} else if partial != nil {
+				releaseMemory()
+				if len(partial) > 0 {
+					o.PartialSlab = &object.PartialSlab{
+						MinShards:   uint8(rs.MinShards),
+						TotalShards: uint8(rs.TotalShards),
+						Data:        partial,
+					}
+					w.uploads.SlabUploaded(uploadID, len(partial))
+				}
+				break
+			}
+			lr, releaseBuf = buf, release
+		}
+
 		// move slow hosts to the back of the array
 		sort.SliceStable(contracts, func(i, j int) bool {
 			return slow[contracts[i].HostKey] < slow[contracts[j].HostKey]
 		})
 
-		// upload the slab
-		s, length, slowHosts, err = uploadSlab(ctx, w, lr, uint8(rs.MinShards), uint8(rs.TotalShards), contracts, &tracedContractLocker{w.bus}, w.uploadSectorTimeout)
+		// upload the slab, the first hosts are the ones the shards are
+		// uploaded to unless they turn out to be slow
+		hosts := make([]types.PublicKey, 0, rs.TotalShards)
+		for i := 0; i < len(contracts) && i < rs.TotalShards; i++ {
+			hosts = append(hosts, contracts[i].HostKey)
+		}
+		w.uploads.SlabStarted(uploadID, hosts)
+		if spill {
+			s, length, slowHosts, err = uploadSlabSpilled(ctx, w.storeProvider(ctx), lr, w.slabKey(o.Key, len(o.Slabs)), uint8(rs.MinShards), uint8(rs.TotalShards), contracts, &tracedContractLocker{w.bus}, w.uploadTimeouts, w.uploadOverdrive, w.uploadSpillDir, w.uploadMemory)
+		} else {
+			s, length, slowHosts, err = uploadSlab(ctx, w.storeProvider(ctx), lr, w.slabKey(o.Key, len(o.Slabs)), uint8(rs.MinShards), uint8(rs.TotalShards), contracts, &tracedContractLocker{w.bus}, w.uploadTimeouts, w.uploadOverdrive)
+		}
+		releaseMemory()
+		releaseBuf()
 		for _, h := range slowHosts {
 			slow[contracts[h].HostKey]++
 		}
 		if err == io.EOF {
 			break
 		} else if jc.Check("couldn't upload slab", err); err != nil {
+			uploadErr = err
 			return
 		}
+		w.uploads.SlabUploaded(uploadID, length)
 
 		o.Slabs = append(o.Slabs, object.SlabSlice{
 			Slab:   s,
@@ -951,14 +1888,137 @@ func (w *worker) objectsKeyHandlerPUT(jc jape.Context) {
 		}
 	}
 
-	key := strings.TrimPrefix(jc.PathParam("key"), "/")
-	if jc.Check("couldn't add object", w.bus.AddObject(ctx, key, o, usedContracts)) != nil {
+	o.ETag = hex.EncodeToString(h.Sum(nil))
+
+	// wrap the object's keys if a passphrase was provided
+	if passphrase != "" {
+		o.WrapKeys(passphrase)
+	}
+
+	// only replace the object if it matches the client's precondition
+	if ifMatch := jc.Request.Header.Get("If-Match"); ifMatch != "" {
+		err = w.bus.AddObjectIfMatch(ctx, key, ifMatch, o, usedContracts, redundancy)
+	} else {
+		err = w.bus.AddObject(ctx, key, o, usedContracts, redundancy)
+	}
+	if errors.Is(err, api.ErrPreconditionFailed) {
+		uploadErr = err
+		jc.Error(err, http.StatusPreconditionFailed)
+		return
+	} else if jc.Check("couldn't add object", err) != nil {
+		uploadErr = err
 		return
 	}
+
+	// upload the slabs packed from the buffered tails in the background
+	if o.PartialSlab != nil {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), lockingDurationPackedSlab)
+			defer cancel()
+			ctx = WithGougingChecker(ctx, up.GougingParams)
+			ctx = WithContractSpendingRecorder(ctx, w.contractSpendingRecorder)
+			ctx = WithUploadingSectorsRecorder(ctx, w.bus)
+			if err := w.uploadPackedSlabs(ctx, rs, contracts); err != nil {
+				w.logger.Errorf("couldn't upload packed slabs, err: %v", err)
+			}
+		}()
+	}
+}
+
+// bufferSlab reads up to size bytes of slab data from r. If less than size
+// bytes are available, the data is returned as partial slab data, which is
+// empty but non-nil if r had no data left. Otherwise a reader for the
+// buffered slab is returned alongside a function that releases the buffer.
+// The slab is buffered in a temporary file rather than in memory if spill is
+// true.
+func (w *worker) bufferSlab(r io.Reader, size int64, spill bool) (io.Reader, func(), []byte, error) {
+	if !spill {
+		buf := make([]byte, size)
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, nil, buf[:n], nil
+		} else if err != nil {
+			return nil, nil, nil, err
+		}
+		return bytes.NewReader(buf), func() {}, nil, nil
+	}
+
+	f, closeFn, err := createSpillFile(w.uploadSpillDir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	n, err := io.Copy(f, r)
+	if err != nil {
+		closeFn()
+		return nil, nil, nil, err
+	} else if n < size {
+		defer closeFn()
+		partial := make([]byte, n)
+		if _, err := f.ReadAt(partial, 0); err != nil {
+			return nil, nil, nil, err
+		}
+		return nil, nil, partial, nil
+	}
+	return io.NewSectionReader(f, 0, n), closeFn, nil, nil
+}
+
+// uploadPackedSlabs uploads the slabs packed from the buffered tails of
+// objects with the given redundancy.
+func (w *worker) uploadPackedSlabs(ctx context.Context, rs api.RedundancySettings, contracts []api.ContractMetadata) error {
+	packed, err := w.bus.PackedSlabsForUpload(ctx, lockingDurationPackedSlab, uint8(rs.MinShards), uint8(rs.TotalShards), packedSlabsUploadLimit)
+	if err != nil {
+		return fmt.Errorf("couldn't fetch packed slabs from bus: %w", err)
+	}
+
+	if len(packed) == 0 {
+		return nil
+	}
+
+	// upload the packed slabs together, the sectors destined for the same
+	// host are pipelined over a single session
+	data := make([][]byte, len(packed))
+	for i, ps := range packed {
+		data[i] = ps.Data
+	}
+	slabs, _, err := uploadSlabs(ctx, w.storeProvider(ctx), data, uint8(rs.MinShards), uint8(rs.TotalShards), contracts, &tracedContractLocker{w.bus}, w.uploadTimeouts, w.uploadOverdrive)
+	if err != nil {
+		return fmt.Errorf("couldn't upload packed slabs: %w", err)
+	}
+
+	var uploaded []api.UploadedPackedSlab
+	for i, ps := range packed {
+		s := slabs[i]
+		usedContracts := make(map[types.PublicKey]types.FileContractID)
+		for _, ss := range s.Shards {
+			for _, c := range contracts {
+				if c.HostKey == ss.Host {
+					usedContracts[ss.Host] = c.ID
+					break
+				}
+			}
+		}
+		uploaded = append(uploaded, api.UploadedPackedSlab{
+			Partials:      ps.Partials,
+			Slab:          s,
+			UsedContracts: usedContracts,
+		})
+	}
+	return w.bus.MarkPackedSlabsUploaded(ctx, uploaded)
 }
 
 func (w *worker) objectsKeyHandlerDELETE(jc jape.Context) {
-	jc.Check("couldn't delete object", w.bus.DeleteObject(jc.Request.Context(), jc.PathParam("key")))
+	var err error
+	key := strings.TrimPrefix(jc.PathParam("key"), "/")
+	if ifMatch := jc.Request.Header.Get("If-Match"); ifMatch != "" {
+		err = w.bus.DeleteObjectIfMatch(jc.Request.Context(), key, ifMatch)
+	} else {
+		err = w.bus.DeleteObject(jc.Request.Context(), key)
+	}
+	if errors.Is(err, api.ErrPreconditionFailed) {
+		jc.Error(err, http.StatusPreconditionFailed)
+		return
+	}
+	jc.Check("couldn't delete object", err)
 }
 
 func (w *worker) rhpActiveContractsHandlerGET(jc jape.Context) {
@@ -975,7 +2035,7 @@ func (w *worker) rhpActiveContractsHandlerGET(jc jape.Context) {
 
 	// fetch all contracts
 	var contracts []api.Contract
-	err = w.withHosts(jc.Request.Context(), busContracts, func(ss []sectorStore) error {
+	err = w.withHosts(jc.Request.Context(), busContracts, func(ss []SectorStore) error {
 		var errs HostErrorSet
 		for i, store := range ss {
 			func() {
@@ -1039,21 +2099,116 @@ func (w *worker) idHandlerGET(jc jape.Context) {
 	jc.Encode(w.id)
 }
 
+func (w *worker) statsHandlerGET(jc jape.Context) {
+	jc.Encode(api.WorkerStatsResponse{
+		Prewarm: w.prewarm.stats(),
+	})
+}
+
+func (w *worker) healthHandlerGET(jc jape.Context) {
+	ctx := jc.Request.Context()
+	results := make(map[string]error)
+	up, err := w.bus.UploadParams(ctx)
+	results["bus"] = err
+	if err == nil {
+		results["consensus"] = func() error {
+			if !up.ConsensusState.Synced {
+				return errors.New("consensus is not synced")
+			}
+			return nil
+		}()
+		results["contracts"] = func() error {
+			contracts, err := w.bus.Contracts(ctx, up.ContractSet)
+			if err != nil {
+				return err
+			} else if len(contracts) == 0 {
+				return fmt.Errorf("contract set '%v' is empty", up.ContractSet)
+			}
+			return nil
+		}()
+	}
+
+	resp := api.NewHealthResponse(results)
+	if !resp.OK {
+		jc.ResponseWriter.Header().Set("Content-Type", "application/json")
+		jc.ResponseWriter.WriteHeader(http.StatusServiceUnavailable)
+	}
+	jc.Encode(resp)
+}
+
+// Config contains the configuration of a worker.
+type Config struct {
+	// ID uniquely identifies the worker, it's used internally, e.g. to
+	// namespace the worker's ephemeral accounts.
+	ID string
+
+	// BusFlushInterval is the interval at which buffered host interactions
+	// and contract spending are flushed to the bus.
+	BusFlushInterval time.Duration
+
+	// SessionReconnectTimeout, SessionTTL and SessionIdleTimeout configure
+	// the pool of host sessions, see newSessionPool.
+	SessionReconnectTimeout time.Duration
+	SessionTTL              time.Duration
+	SessionIdleTimeout      time.Duration
+
+	// DownloadSectorTimeout and UploadSectorTimeout cap the timeouts applied
+	// to sector transfers, the timeout of a host is derived from its latencies
+	// once enough transfers were observed.
+	DownloadSectorTimeout time.Duration
+	UploadSectorTimeout   time.Duration
+
+	// DownloadOverdrive and UploadOverdrive are the number of sectors that are
+	// transferred on top of the ones that are required, the slowest transfers
+	// are cancelled.
+	DownloadOverdrive uint64
+	UploadOverdrive   uint64
+
+	// DownloadPrefetchSlabs is the number of slabs downloaded ahead of the one
+	// being streamed, DownloadPrefetchMemory caps the memory reserved for them
+	// per download.
+	DownloadPrefetchSlabs  int
+	DownloadPrefetchMemory uint64
+
+	// UploadMemoryBudget caps the memory used to buffer the slabs of uploads,
+	// slabs exceeding it are spilled to UploadSpillDir. Zero means no limit.
+	UploadMemoryBudget uint64
+	UploadSpillDir     string
+
+	// DownloadExportDir is the directory download jobs write objects to,
+	// writing to the worker's filesystem is disabled if it's empty.
+	DownloadExportDir string
+
+	// RandomObjectKeys disables deriving object keys from the master key.
+	RandomObjectKeys bool
+}
+
 // New returns an HTTP handler that serves the worker API.
-func New(masterKey [32]byte, id string, b Bus, sessionReconectTimeout, sessionTTL, busFlushInterval, downloadSectorTimeout, uploadSectorTimeout time.Duration, l *zap.Logger) *worker {
+func New(cfg Config, masterKey [32]byte, b Bus, l *zap.Logger) *worker {
 	w := &worker{
-		id:                    id,
-		bus:                   b,
-		pool:                  newSessionPool(sessionReconectTimeout, sessionTTL),
-		masterKey:             masterKey,
-		busFlushInterval:      busFlushInterval,
-		downloadSectorTimeout: downloadSectorTimeout,
-		uploadSectorTimeout:   uploadSectorTimeout,
-		logger:                l.Sugar().Named("worker").Named(id),
+		id:                     cfg.ID,
+		bus:                    b,
+		pool:                   newSessionPool(cfg.SessionReconnectTimeout, cfg.SessionTTL, cfg.SessionIdleTimeout),
+		masterKey:              masterKey,
+		busFlushInterval:       cfg.BusFlushInterval,
+		downloadTimeouts:       newHostTimeouts(cfg.DownloadSectorTimeout),
+		uploadTimeouts:         newHostTimeouts(cfg.UploadSectorTimeout),
+		downloadOverdrive:      cfg.DownloadOverdrive,
+		uploadOverdrive:        cfg.UploadOverdrive,
+		downloadPrefetchSlabs:  cfg.DownloadPrefetchSlabs,
+		downloadPrefetchMemory: cfg.DownloadPrefetchMemory,
+		uploadMemory:           newMemoryManager(cfg.UploadMemoryBudget),
+		uploads:                newUploadTracker(),
+		downloads:              newDownloadTracker(),
+		uploadSpillDir:         cfg.UploadSpillDir,
+		downloadExportDir:      cfg.DownloadExportDir,
+		randomObjectKeys:       cfg.RandomObjectKeys,
+		logger:                 l.Sugar().Named("worker").Named(cfg.ID),
 	}
 	w.accounts = newAccounts(w.id, w.deriveSubKey("accountkey"), b)
 	w.contractSpendingRecorder = w.newContractSpendingRecorder()
 	w.priceTables = newPriceTables()
+	w.faults = newFaultInjector(b.Setting)
 	return w
 }
 
@@ -1069,28 +2224,80 @@ func (w *worker) accountsResetDriftHandlerPOST(jc jape.Context) {
 
 // Handler returns an HTTP handler that serves the worker API.
 func (w *worker) Handler() http.Handler {
-	return jape.Mux(tracing.TracedRoutes("worker", map[string]jape.Handler{
+	routes := tracing.TracedRoutes("worker", map[string]jape.Handler{
 		"GET    /accounts":                w.accountsHandlerGET,
 		"GET    /accounts/host/:id":       w.accountHandlerGET,
 		"POST   /accounts/:id/resetdrift": w.accountsResetDriftHandlerPOST,
 
-		"GET    /id": w.idHandlerGET,
-
-		"GET    /rhp/contracts/active": w.rhpActiveContractsHandlerGET,
-		"POST   /rhp/scan":             w.rhpScanHandler,
-		"POST   /rhp/form":             w.rhpFormHandler,
-		"POST   /rhp/renew":            w.rhpRenewHandler,
-		"POST   /rhp/fund":             w.rhpFundHandler,
-		"POST   /rhp/pricetable":       w.rhpPriceTableHandler,
-		"POST   /rhp/registry/read":    w.rhpRegistryReadHandler,
-		"POST   /rhp/registry/update":  w.rhpRegistryUpdateHandler,
+		"GET    /health": w.healthHandlerGET,
+		"GET    /id":     w.idHandlerGET,
+		"GET    /stats":  w.statsHandlerGET,
+
+		"GET    /debug/pprof/*profile": profiling.Handler(w.bus.Setting),
+
+		"POST   /presign": w.presignHandlerPOST,
+		"POST   /tokens":  w.tokensHandlerPOST,
+
+		"GET    /rhp/contracts/active":       w.rhpActiveContractsHandlerGET,
+		"POST   /rhp/scan":                   w.rhpScanHandler,
+		"POST   /rhp/form":                   w.rhpFormHandler,
+		"POST   /rhp/renew":                  w.rhpRenewHandler,
+		"POST   /rhp/contract/:id/renew":     w.rhpContractRenewHandlerPOST,
+		"POST   /rhp/contract/:id/refresh":   w.rhpContractRefreshHandlerPOST,
+		"POST   /rhp/contract/:id/broadcast": w.rhpContractBroadcastHandlerPOST,
+		"GET    /rhp/contract/:id/prunable":  w.rhpContractPrunableHandlerGET,
+		"POST   /rhp/contract/:id/prune":     w.rhpContractPruneHandlerPOST,
+		"POST   /rhp/contract/:id/roots":     w.rhpContractRootsHandlerPOST,
+		"POST   /rhp/contractkeys":           w.rhpContractKeysHandlerPOST,
+		"POST   /rhp/fund":                   w.rhpFundHandler,
+		"POST   /rhp/pricetable":             w.rhpPriceTableHandler,
+		"POST   /rhp/prewarm":                w.rhpPrewarmHandlerPOST,
+		"POST   /rhp/registry/read":          w.rhpRegistryReadHandler,
+		"POST   /rhp/registry/update":        w.rhpRegistryUpdateHandler,
 
 		"POST   /slab/migrate": w.slabMigrateHandler,
 
+		"POST   /reshard/*key": w.reshardKeyHandlerPOST,
+
+		"POST   /objects/audit": w.objectsAuditHandlerPOST,
+		"POST   /sectors/audit": w.sectorsAuditHandlerPOST,
+
+		"POST   /gc/sectors": w.gcSectorsHandlerPOST,
+
 		"GET    /objects/*key": w.objectsKeyHandlerGET,
+		"HEAD   /objects/*key": w.objectsKeyHandlerGET,
 		"PUT    /objects/*key": w.objectsKeyHandlerPUT,
 		"DELETE /objects/*key": w.objectsKeyHandlerDELETE,
-	}))
+
+		"GET    /uploads":     w.uploadsHandlerGET,
+		"GET    /uploads/:id": w.uploadsIDHandlerGET,
+
+		"GET    /downloads":          w.downloadsHandlerGET,
+		"POST   /downloads":          w.downloadsHandlerPOST,
+		"GET    /downloads/:id":      w.downloadsIDHandlerGET,
+		"DELETE /downloads/:id":      w.downloadsIDHandlerDELETE,
+		"GET    /downloads/:id/data": w.downloadsIDDataHandlerGET,
+	})
+
+	// jape doesn't support HEAD routes so they are registered on the router
+	// directly, HEAD requests for objects are served by the GET handler, which
+	// omits the body
+	head := make(map[string]jape.Handler)
+	for route, h := range routes {
+		if fs := strings.Fields(route); fs[0] == http.MethodHead {
+			head[fs[1]] = h
+			delete(routes, route)
+		}
+	}
+	router := jape.Mux(routes)
+	for path, h := range head {
+		h := h
+		router.Handler(http.MethodHead, path, http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			_, ps, _ := router.Lookup(http.MethodHead, req.URL.Path)
+			h(jape.Context{ResponseWriter: rw, Request: req, PathParams: ps})
+		}))
+	}
+	return router
 }
 
 // Shutdown shuts down the worker.
@@ -1102,9 +2309,19 @@ func (w *worker) Shutdown(_ context.Context) error {
 	}
 	w.interactionsMu.Unlock()
 
+	// Stop renewing the registration with the bus.
+	if w.registration != nil {
+		w.registration.stop()
+	}
+
+	// Cancel the download jobs.
+	w.downloads.Shutdown()
+
 	// Stop contract spending recorder.
 	w.contractSpendingRecorder.Stop()
-	return nil
+
+	// Close the sessions.
+	return w.pool.Close()
 }
 
 func (w *worker) recordInteractions(interactions []hostdb.Interaction) {
@@ -1157,6 +2374,18 @@ func (l *tracedContractLocker) AcquireContract(ctx context.Context, fcid types.F
 	return
 }
 
+func (l *tracedContractLocker) KeepaliveContract(ctx context.Context, fcid types.FileContractID, lockID uint64, d time.Duration) (err error) {
+	ctx, span := tracing.Tracer.Start(ctx, "tracedContractLocker.KeepaliveContract")
+	defer span.End()
+	err = l.l.KeepaliveContract(ctx, fcid, lockID, d)
+	if err != nil {
+		span.SetStatus(codes.Error, "failed to keep contract lock alive")
+		span.RecordError(err)
+	}
+	span.SetAttributes(attribute.Stringer("contract", fcid))
+	return
+}
+
 func (l *tracedContractLocker) ReleaseContract(ctx context.Context, fcid types.FileContractID, lockID uint64) (err error) {
 	ctx, span := tracing.Tracer.Start(ctx, "tracedContractLocker.ReleaseContract")
 	defer span.End()
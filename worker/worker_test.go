@@ -0,0 +1,95 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	rhpv2 "go.sia.tech/core/rhp/v2"
+	"go.sia.tech/renterd/object"
+	"lukechampine.com/frand"
+)
+
+func TestCheckNotModified(t *testing.T) {
+	modTime := time.Date(2023, 3, 1, 12, 0, 0, 500, time.UTC)
+	o := object.Object{ModTime: modTime, ETag: "abcd"}
+
+	for _, test := range []struct {
+		headers     map[string]string
+		notModified bool
+	}{
+		{nil, false},
+		{map[string]string{"If-None-Match": `"abcd"`}, true},
+		{map[string]string{"If-None-Match": `"ef01", W/"abcd"`}, true},
+		{map[string]string{"If-None-Match": `*`}, true},
+		{map[string]string{"If-None-Match": `"ef01"`}, false},
+		{map[string]string{"If-Modified-Since": modTime.Format(http.TimeFormat)}, true},
+		{map[string]string{"If-Modified-Since": modTime.Add(time.Hour).Format(http.TimeFormat)}, true},
+		{map[string]string{"If-Modified-Since": modTime.Add(-time.Second).Format(http.TimeFormat)}, false},
+		{map[string]string{"If-Modified-Since": "invalid"}, false},
+
+		// If-None-Match takes precedence over If-Modified-Since
+		{map[string]string{"If-None-Match": `"ef01"`, "If-Modified-Since": modTime.Format(http.TimeFormat)}, false},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/objects/foo", nil)
+		for k, v := range test.headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		if notModified := checkNotModified(rec, req, o); notModified != test.notModified {
+			t.Fatalf("unexpected result for headers %v, %v != %v", test.headers, notModified, test.notModified)
+		} else if etag := rec.Header().Get("ETag"); etag != `"abcd"` {
+			t.Fatal("unexpected ETag", etag)
+		} else if lm := rec.Header().Get("Last-Modified"); lm != modTime.Format(http.TimeFormat) {
+			t.Fatal("unexpected Last-Modified", lm)
+		}
+	}
+
+	// objects without an ETag or modification time never match
+	req := httptest.NewRequest(http.MethodGet, "/objects/foo", nil)
+	req.Header.Set("If-None-Match", `""`)
+	rec := httptest.NewRecorder()
+	if checkNotModified(rec, req, object.Object{}) {
+		t.Fatal("expected object to be modified")
+	} else if len(rec.Header()) != 0 {
+		t.Fatal("unexpected headers", rec.Header())
+	}
+}
+
+func TestIsSectorNotFound(t *testing.T) {
+	for _, test := range []struct {
+		err      error
+		notFound bool
+	}{
+		{&rhpv2.RPCError{Description: "sector not found"}, true},
+		{fmt.Errorf("failed to download sector: %w", &rhpv2.RPCError{Description: "could not find the desired sector"}), true},
+		{&rhpv2.RPCError{Description: "insufficient funds"}, false},
+		{ErrInvalidMerkleProof, false},
+		{errors.New("sector not found"), false}, // not reported by the host
+	} {
+		if isSectorNotFound(test.err) != test.notFound {
+			t.Fatal("unexpected result for", test.err)
+		}
+	}
+}
+
+func TestObjectKey(t *testing.T) {
+	w := &worker{masterKey: frand.Entropy256()}
+
+	// derived keys can be re-derived from the master key and the nonce
+	key, nonce := w.objectKey()
+	if nonce == nil {
+		t.Fatal("expected nonce")
+	} else if derived := object.DeriveEncryptionKey(w.masterKey, *nonce); derived.String() != key.String() {
+		t.Fatal("re-derived key doesn't match")
+	}
+
+	// random keys don't have a nonce
+	w.randomObjectKeys = true
+	if _, nonce := w.objectKey(); nonce != nil {
+		t.Fatal("unexpected nonce")
+	}
+}